@@ -0,0 +1,94 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxAboutRunes bounds an /about description, which is sent with the first
+// prompt of every new session.
+const maxAboutRunes = 2000
+
+// aboutDir returns the directory /about descriptions of workDir are kept
+// under: its repository root, or workDir itself outside a repository.
+func aboutDir(workDir string) string {
+	if root, _, ok := repoState(workDir); ok {
+		return root
+	}
+	return workDir
+}
+
+// withAboutContext prepends the chat's description of workDir's
+// environment to the first prompt of a new session.
+func (r *Router) withAboutContext(chatID, workDir, prompt string) string {
+	about := r.getSession(chatID).About[aboutDir(workDir)]
+	if about == "" {
+		return prompt
+	}
+	return "[devbot 环境说明]\n" + about + "\n[/devbot 环境说明]\n\n" + prompt
+}
+
+// cmdAbout shows or sets the description of the current repository's
+// environment: how it is built, tested and deployed, and anything else a
+// new session should know without being told again.
+func (r *Router) cmdAbout(ctx context.Context, chatID, args string) {
+	usage := "用法: /about [set <说明>|clear|list]\n为当前仓库记录环境说明（如部署到哪个集群、CI 用什么、用哪些 make 目标），每次开启新会话时自动附在第一条 prompt 前。"
+	dir := aboutDir(r.getSession(chatID).WorkDir)
+	args = strings.TrimSpace(args)
+	sub, rest := args, ""
+	if i := strings.IndexAny(args, " \n"); i >= 0 {
+		sub, rest = args[:i], args[i+1:]
+	}
+	switch sub {
+	case "":
+		about := r.getSession(chatID).About[dir]
+		if about == "" {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("%s 还没有环境说明。\n%s", dir, usage))
+			return
+		}
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "环境说明: " + dir, Content: about + "\n\n新会话的第一条 prompt 会附上这段说明。`/about set <说明>` 修改，`/about clear` 删除。"})
+	case "set":
+		text := strings.TrimSpace(rest)
+		if text == "" {
+			r.sender.SendText(ctx, chatID, usage)
+			return
+		}
+		if n := utf8.RuneCountInString(text); n > maxAboutRunes {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("环境说明太长（%d 字），最多 %d 字。", n, maxAboutRunes))
+			return
+		}
+		r.store.UpdateSession(chatID, func(s *Session) {
+			if s.About == nil {
+				s.About = make(map[string]string)
+			}
+			s.About[dir] = text
+		})
+		r.save()
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已保存 %s 的环境说明，下次开启新会话（或 /new）时生效。", dir))
+	case "clear":
+		if r.getSession(chatID).About[dir] == "" {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("%s 没有环境说明。", dir))
+			return
+		}
+		r.store.UpdateSession(chatID, func(s *Session) {
+			delete(s.About, dir)
+		})
+		r.save()
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已删除 %s 的环境说明。", dir))
+	case "list":
+		about := r.getSession(chatID).About
+		if len(about) == 0 {
+			r.sender.SendText(ctx, chatID, "本聊天还没有环境说明。\n"+usage)
+			return
+		}
+		var sb strings.Builder
+		for _, d := range sortedKeys(about) {
+			fmt.Fprintf(&sb, "**%s**\n%s\n\n", d, truncateRunes(about[d], 200))
+		}
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("环境说明（%d 个目录）", len(about)), Content: strings.TrimSpace(sb.String())})
+	default:
+		r.sender.SendText(ctx, chatID, usage)
+	}
+}
@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCmdAbout(t *testing.T) {
+	r, sender, repo, _ := newCacheRouter(t)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "/about")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "还没有环境说明") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "/about set deploys to k8s cluster prod-1\nCI is GitHub Actions, use make targets")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "已保存 "+repo) {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	// Subdirectories share the repository's description.
+	sub := filepath.Join(repo, "pkg")
+	r.store.UpdateSession("chat1", func(s *Session) { s.WorkDir = sub })
+	r.Route(ctx, "chat1", "user1", "/about")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "CI is GitHub Actions") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "/about list")
+	if msg := sender.LastMessage(); !strings.Contains(msg, repo) || !strings.Contains(msg, "prod-1") {
+		t.Fatalf("unexpected list %q", msg)
+	}
+	if other := r.getSession("chat2").About; len(other) != 0 {
+		t.Fatalf("description leaked into another chat: %v", other)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/about set "+strings.Repeat("长", maxAboutRunes+1))
+	if msg := sender.LastMessage(); !strings.Contains(msg, "太长") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "/about clear")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "已删除") || len(r.getSession("chat1").About) != 0 {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "/about clear")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "没有环境说明") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+}
+
+func TestRouterExecClaude_NewSessionGetsAbout(t *testing.T) {
+	r, _, _, prompts := newCacheRouter(t)
+	ctx := context.Background()
+	r.Route(ctx, "chat1", "user1", "/about set use make test, never go test directly")
+
+	r.Route(ctx, "chat1", "user1", "fix the bug")
+	r.Route(ctx, "chat1", "user1", "and add a test")
+
+	logged, _ := os.ReadFile(prompts)
+	runs := strings.Split(strings.TrimSuffix(string(logged), "---END---\n"), "---END---\n")
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 runs, got %q", logged)
+	}
+	if !strings.Contains(runs[0], "[devbot 环境说明]\nuse make test, never go test directly\n[/devbot 环境说明]") {
+		t.Errorf("expected the first prompt to carry the description, got %q", runs[0])
+	}
+	if strings.Contains(runs[1], "环境说明") {
+		t.Errorf("expected the resumed prompt without the description, got %q", runs[1])
+	}
+}
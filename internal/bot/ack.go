@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Feishu emoji_type keys used to acknowledge prompts in reaction mode.
+const (
+	ackPendingEmoji = "OnIt"
+	ackDoneEmoji    = "DONE"
+	ackFailEmoji    = "CrossMark"
+)
+
+type messageIDKey struct{}
+
+// withMessageID records the ID of the Feishu message being handled, so a
+// prompt can be acknowledged with a reaction on it.
+func withMessageID(ctx context.Context, messageID string) context.Context {
+	if messageID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, messageIDKey{}, messageID)
+}
+
+// messageIDFrom returns the message ID set by withMessageID.
+func messageIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(messageIDKey{}).(string)
+	return id
+}
+
+// ack acknowledges one prompt, either with a reaction on the user's
+// message or, when that is off or unavailable, with a text message.
+type ack struct {
+	reactor    Reactor
+	messageID  string
+	reactionID string // pending reaction; "" when acknowledged by text
+}
+
+// ackStart acknowledges the prompt being handled in ctx: with reactions on
+// for the chat it adds the pending reaction to the user's message,
+// otherwise it sends text.
+func (r *Router) ackStart(ctx context.Context, chatID, text string) *ack {
+	a := &ack{messageID: messageIDFrom(ctx)}
+	if rc, ok := r.sender.(Reactor); ok && a.messageID != "" && r.getSession(chatID).AckReaction && !r.inIncident(chatID) {
+		id, err := rc.AddReaction(ctx, a.messageID, ackPendingEmoji)
+		if err == nil {
+			a.reactor, a.reactionID = rc, id
+			return a
+		}
+		slog.WarnContext(ctx, "router: ack reaction failed", "chat_id", chatID, "err", err)
+	}
+	r.sender.SendText(ctx, chatID, text)
+	return a
+}
+
+// reacting reports whether the prompt was acknowledged with a reaction, in
+// which case callers skip their own completion text.
+func (a *ack) reacting() bool {
+	return a.reactionID != ""
+}
+
+// finish swaps the pending reaction for one showing whether the prompt
+// succeeded. Text acknowledgements need nothing more.
+func (a *ack) finish(ctx context.Context, ok bool) {
+	if !a.reacting() {
+		return
+	}
+	if err := a.reactor.RemoveReaction(ctx, a.messageID, a.reactionID); err != nil {
+		slog.WarnContext(ctx, "router: remove ack reaction failed", "message_id", a.messageID, "err", err)
+	}
+	emoji := ackDoneEmoji
+	if !ok {
+		emoji = ackFailEmoji
+	}
+	if _, err := a.reactor.AddReaction(ctx, a.messageID, emoji); err != nil {
+		slog.WarnContext(ctx, "router: ack reaction failed", "message_id", a.messageID, "err", err)
+	}
+	a.reactionID = ""
+}
+
+// cmdAck switches how the chat's prompts are acknowledged.
+func (r *Router) cmdAck(ctx context.Context, chatID, args string) {
+	mode := strings.TrimSpace(args)
+	if mode == "" {
+		current := "text"
+		if r.getSession(chatID).AckReaction {
+			current = "react"
+		}
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("当前确认方式: %s\n用法: /ack react|text\nreact: 收到 prompt 时在消息上添加表情，完成后换成 ✅ 或 ❌，不再发送「执行中...」和「完成」消息。\ntext: 发送文字消息（默认）。", current))
+		return
+	}
+	if mode != "react" && mode != "text" {
+		r.sender.SendText(ctx, chatID, "用法: /ack react|text")
+		return
+	}
+	if _, ok := r.sender.(Reactor); !ok && mode == "react" {
+		r.sender.SendText(ctx, chatID, "当前消息通道不支持表情回复。")
+		return
+	}
+	r.getSession(chatID) // ensure session exists
+	r.store.UpdateSession(chatID, func(s *Session) {
+		s.AckReaction = mode == "react"
+	})
+	r.save()
+	if mode == "react" {
+		r.sender.SendText(ctx, chatID, "✓ 已切换为表情确认：执行中的 prompt 会被标记，完成后标记为 ✅ 或 ❌。")
+	} else {
+		r.sender.SendText(ctx, chatID, "✓ 已切换为文字确认。")
+	}
+}
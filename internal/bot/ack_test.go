@@ -0,0 +1,96 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// reactSpySender records reactions as "+<emoji>" and "-<reaction ID>".
+type reactSpySender struct {
+	spySender
+	reactions []string
+}
+
+func (s *reactSpySender) AddReaction(_ context.Context, messageID, emojiType string) (string, error) {
+	s.reactions = append(s.reactions, "+"+emojiType)
+	return fmt.Sprintf("%s-r%d", messageID, len(s.reactions)), nil
+}
+
+func (s *reactSpySender) RemoveReaction(_ context.Context, _, reactionID string) error {
+	s.reactions = append(s.reactions, "-"+reactionID)
+	return nil
+}
+
+func newAckRouter(t *testing.T, claude string) (*Router, *reactSpySender) {
+	t.Helper()
+	dir := t.TempDir()
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	sender := &reactSpySender{}
+	r := NewRouter(context.Background(), NewClaudeExecutor(claude, "sonnet", 10*time.Second), store, sender, map[string]bool{"user1": true}, dir, nil)
+	return r, sender
+}
+
+func TestRouterAckReaction(t *testing.T) {
+	claude := filepath.Join(t.TempDir(), "claude")
+	os.WriteFile(claude, []byte(`#!/bin/sh
+echo '{"type":"result","result":"done","session_id":"s1"}'
+`), 0755)
+	r, sender := newAckRouter(t, claude)
+	ctx := withMessageID(context.Background(), "om_1")
+
+	r.Route(ctx, "chat1", "user1", "hello")
+	if sender.messages[0] != "执行中..." || !strings.HasPrefix(sender.LastMessage(), "✓ 完成") || len(sender.reactions) != 0 {
+		t.Fatalf("expected text acknowledgement by default, got %q %v", sender.messages, sender.reactions)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/ack react")
+	if !r.getSession("chat1").AckReaction {
+		t.Fatal("expected reaction mode saved")
+	}
+	sender.messages = nil
+	r.Route(ctx, "chat1", "user1", "hello again")
+	if want := []string{"+OnIt", "-om_1-r1", "+DONE"}; strings.Join(sender.reactions, " ") != strings.Join(want, " ") {
+		t.Fatalf("expected reactions %v, got %v", want, sender.reactions)
+	}
+	if len(sender.messages) != 1 || !strings.Contains(sender.messages[0], "done") {
+		t.Fatalf("expected only the result card, got %q", sender.messages)
+	}
+
+	// Without a message to react to, fall back to text.
+	sender.messages = nil
+	r.Route(context.Background(), "chat1", "user1", "no message id")
+	if sender.messages[0] != "执行中..." {
+		t.Fatalf("expected text fallback, got %q", sender.messages)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/ack text")
+	if r.getSession("chat1").AckReaction {
+		t.Fatal("expected text mode saved")
+	}
+}
+
+func TestRouterAckReactionFailure(t *testing.T) {
+	r, sender := newAckRouter(t, "/nonexistent_binary_for_test")
+	ctx := withMessageID(context.Background(), "om_2")
+	r.Route(ctx, "chat1", "user1", "/ack react")
+	r.Route(ctx, "chat1", "user1", "hello")
+	if got := strings.Join(sender.reactions, " "); got != "+OnIt -om_2-r1 +CrossMark" {
+		t.Fatalf("unexpected reactions %q", got)
+	}
+	if !strings.Contains(sender.LastMessage(), "执行出错") {
+		t.Fatalf("expected error card, got %q", sender.LastMessage())
+	}
+}
+
+func TestRouterAckUnsupported(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/ack react")
+	if !strings.Contains(sender.LastMessage(), "不支持表情回复") || r.getSession("chat1").AckReaction {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+}
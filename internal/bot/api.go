@@ -0,0 +1,104 @@
+package bot
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxAPIBody bounds the size of REST API request bodies.
+const maxAPIBody = 1 << 20 // 1 MB
+
+type apiPromptRequest struct {
+	Prompt string `json:"prompt"`
+}
+
+type apiExecution struct {
+	ID         string    `json:"id"`
+	ChatID     string    `json:"chatID"`
+	Status     string    `json:"status"`
+	Prompt     string    `json:"prompt"`
+	Output     string    `json:"output,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMS int64     `json:"durationMs,omitempty"`
+}
+
+func writeAPIJSON(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(v)
+}
+
+func writeAPIError(rw http.ResponseWriter, status int, msg string) {
+	writeAPIJSON(rw, status, map[string]string{"error": msg})
+}
+
+// handleChatPrompts serves POST /api/v1/chats/{id}/prompts. The prompt goes
+// through the same session and queue as a chat message; progress and results
+// are also posted to the chat.
+func (w *WebServer) handleChatPrompts(rw http.ResponseWriter, req *http.Request) {
+	rest := strings.TrimPrefix(req.URL.Path, "/api/v1/chats/")
+	parts := strings.Split(rest, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "prompts" {
+		writeAPIError(rw, http.StatusNotFound, "not found")
+		return
+	}
+	if req.Method != http.MethodPost {
+		writeAPIError(rw, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	chatID := parts[0]
+
+	var body apiPromptRequest
+	if err := json.NewDecoder(http.MaxBytesReader(rw, req.Body, maxAPIBody)).Decode(&body); err != nil {
+		writeAPIError(rw, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	prompt := strings.TrimSpace(body.Prompt)
+	if prompt == "" {
+		writeAPIError(rw, http.StatusBadRequest, "prompt is required")
+		return
+	}
+
+	id, err := w.router.SubmitPrompt(w.router.ctx, chatID, prompt)
+	if err != nil {
+		writeAPIError(rw, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	rec, status, _ := w.router.LookupExec(id)
+	writeAPIJSON(rw, http.StatusAccepted, toAPIExecution(rec, status))
+}
+
+// handleExecution serves GET /api/v1/executions/{id}.
+func (w *WebServer) handleExecution(rw http.ResponseWriter, req *http.Request) {
+	id := strings.TrimPrefix(req.URL.Path, "/api/v1/executions/")
+	if id == "" || strings.Contains(id, "/") {
+		writeAPIError(rw, http.StatusNotFound, "not found")
+		return
+	}
+	if req.Method != http.MethodGet {
+		writeAPIError(rw, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	rec, status, ok := w.router.LookupExec(id)
+	if !ok {
+		writeAPIError(rw, http.StatusNotFound, "execution not found")
+		return
+	}
+	writeAPIJSON(rw, http.StatusOK, toAPIExecution(rec, status))
+}
+
+func toAPIExecution(rec ExecRecord, status string) apiExecution {
+	return apiExecution{
+		ID:         rec.ID,
+		ChatID:     rec.ChatID,
+		Status:     status,
+		Prompt:     rec.Prompt,
+		Output:     rec.Output,
+		Error:      rec.Error,
+		StartedAt:  rec.StartedAt,
+		DurationMS: rec.Duration.Milliseconds(),
+	}
+}
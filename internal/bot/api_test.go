@@ -0,0 +1,136 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestAPIServer(t *testing.T, script string) (*WebServer, *Router) {
+	t.Helper()
+	dir := t.TempDir()
+	claude := filepath.Join(dir, "claude")
+	os.WriteFile(claude, []byte(script), 0755)
+
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	sender := &spySender{}
+	ex := NewClaudeExecutor(claude, "sonnet", 10*time.Second)
+	r := NewRouter(context.Background(), ex, store, sender, map[string]bool{"user1": true}, dir, nil)
+	q := NewMessageQueue()
+	t.Cleanup(q.Shutdown)
+	r.SetQueue(q)
+
+	w := NewWebServer(r, "dash")
+	w.EnableAPI("api")
+	return w, r
+}
+
+func apiRequest(w *WebServer, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, req)
+	return rec
+}
+
+const okClaudeScript = "#!/bin/sh\necho '{\"type\":\"result\",\"result\":\"api done\",\"session_id\":\"s1\"}'\n"
+
+func TestAPI_SubmitAndFetch(t *testing.T) {
+	w, r := newTestAPIServer(t, okClaudeScript)
+
+	rec := apiRequest(w, http.MethodPost, "/api/v1/chats/chat1/prompts", "api", `{"prompt":"run the tests"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var submitted apiExecution
+	if err := json.Unmarshal(rec.Body.Bytes(), &submitted); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if submitted.ID == "" || submitted.ChatID != "chat1" || submitted.Prompt != "run the tests" {
+		t.Fatalf("unexpected submit response: %+v", submitted)
+	}
+
+	var got apiExecution
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		rec = apiRequest(w, http.MethodGet, "/api/v1/executions/"+submitted.ID, "api", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		json.Unmarshal(rec.Body.Bytes(), &got)
+		if got.Status == ExecSucceeded {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if got.Status != ExecSucceeded || got.Output != "api done" {
+		t.Fatalf("expected succeeded execution with output, got %+v", got)
+	}
+	if sess := r.getSession("chat1"); sess.LastPrompt != "run the tests" {
+		t.Fatalf("expected API prompt to be saved for /retry, got %q", sess.LastPrompt)
+	}
+}
+
+func TestAPI_Disabled(t *testing.T) {
+	r, _ := newTestRouter(t)
+	w := NewWebServer(r, "dash")
+	rec := apiRequest(w, http.MethodPost, "/api/v1/chats/chat1/prompts", "dash", `{"prompt":"x"}`)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 when API disabled, got %d", rec.Code)
+	}
+}
+
+func TestAPI_DashboardTokenRejected(t *testing.T) {
+	w, _ := newTestAPIServer(t, okClaudeScript)
+	rec := apiRequest(w, http.MethodPost, "/api/v1/chats/chat1/prompts", "dash", `{"prompt":"x"}`)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with dashboard token, got %d", rec.Code)
+	}
+}
+
+func TestAPI_BadRequests(t *testing.T) {
+	w, _ := newTestAPIServer(t, okClaudeScript)
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPost, "/api/v1/chats/chat1/prompts", `not json`, http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/chats/chat1/prompts", `{"prompt":"  "}`, http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/chats/chat1/prompts", ``, http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/v1/chats/chat1/prompts/extra", `{"prompt":"x"}`, http.StatusNotFound},
+		{http.MethodPost, "/api/v1/chats/chat1/other", `{"prompt":"x"}`, http.StatusNotFound},
+		{http.MethodGet, "/api/v1/executions/missing", ``, http.StatusNotFound},
+		{http.MethodDelete, "/api/v1/executions/abc", ``, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		rec := apiRequest(w, tt.method, tt.path, "api", tt.body)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: expected %d, got %d: %s", tt.method, tt.path, tt.want, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestRouterLookupExec_States(t *testing.T) {
+	r, _ := newTestRouter(t)
+	r.setQueued(ExecRecord{ID: "q1", ChatID: "chat1"})
+	r.setActive(ExecRecord{ID: "a1", ChatID: "chat1"})
+	r.store.AddExecRecord(ExecRecord{ID: "ok1", ChatID: "chat1"})
+	r.store.AddExecRecord(ExecRecord{ID: "bad1", ChatID: "chat1", Error: "boom"})
+
+	for id, want := range map[string]string{"q1": ExecQueued, "a1": ExecRunning, "ok1": ExecSucceeded, "bad1": ExecFailed} {
+		if _, status, ok := r.LookupExec(id); !ok || status != want {
+			t.Errorf("LookupExec(%q) = %q, %v; want %q", id, status, ok, want)
+		}
+	}
+	if _, _, ok := r.LookupExec("nope"); ok {
+		t.Fatalf("expected unknown execution to be missing")
+	}
+}
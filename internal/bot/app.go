@@ -5,6 +5,7 @@ import (
 
     larkcore "github.com/larksuite/oapi-sdk-go/v3/core"
     "github.com/larksuite/oapi-sdk-go/v3/event/dispatcher"
+    "github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
     larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
     larkws "github.com/larksuite/oapi-sdk-go/v3/ws"
 )
@@ -23,6 +24,9 @@ func buildEventHandler(h *Handler) *dispatcher.EventDispatcher {
     return dispatcher.NewEventDispatcher("", "").
         OnP2MessageReceiveV1(func(ctx context.Context, event *larkim.P2MessageReceiveV1) error {
             return h.HandleMessage(ctx, event)
+        }).
+        OnP2CardActionTrigger(func(ctx context.Context, event *callback.CardActionTriggerEvent) (*callback.CardActionTriggerResponse, error) {
+            return h.HandleCardAction(ctx, event)
         })
 }
 
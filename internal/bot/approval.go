@@ -0,0 +1,431 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// approvalExpiry is how long an approval request collects votes.
+const approvalExpiry = 24 * time.Hour
+
+type userIDKey struct{}
+
+type approvedKey struct{}
+
+// withApproved marks ctx as running a command its approvers approved, so
+// it is not held again.
+func withApproved(ctx context.Context) context.Context {
+	return context.WithValue(ctx, approvedKey{}, true)
+}
+
+// approvedFrom reports whether ctx was marked by withApproved.
+func approvedFrom(ctx context.Context) bool {
+	ok, _ := ctx.Value(approvedKey{}).(bool)
+	return ok
+}
+
+// withUserID attaches the ID of the user who sent a command.
+func withUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+// userIDFrom returns the user attached by withUserID, or "".
+func userIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(userIDKey{}).(string)
+	return id
+}
+
+// approvalRule is a configured ApprovalRule with its command pattern
+// compiled.
+type approvalRule struct {
+	ApprovalRule
+	re *regexp.Regexp
+}
+
+// pendingApproval is a command waiting for its approvers.
+type pendingApproval struct {
+	rec  ApprovalRecord
+	rule approvalRule
+}
+
+// approvalPattern compiles an approval rule's command pattern: "*"
+// matches any text, everything else itself, ignoring case and runs of
+// spaces.
+func approvalPattern(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString(`(?i)^`)
+	for i, part := range strings.Split(strings.Join(strings.Fields(pattern), " "), "*") {
+		if i > 0 {
+			sb.WriteString(`.*`)
+		}
+		sb.WriteString(regexp.QuoteMeta(part))
+	}
+	sb.WriteString(`$`)
+	return regexp.MustCompile(sb.String())
+}
+
+// SetApprovalRules holds commands matching rules until enough of their
+// approvers approve them.
+func (r *Router) SetApprovalRules(rules []ApprovalRule) {
+	r.approvalRules = nil
+	for _, rule := range rules {
+		r.approvalRules = append(r.approvalRules, approvalRule{ApprovalRule: rule, re: approvalPattern(rule.Command)})
+	}
+}
+
+// matchApprovalRule returns the first rule covering command, in any of
+// its approvalForms. A "> …" line typed into a /shell counts as the /exec
+// of the same command.
+func (r *Router) matchApprovalRule(command string) (approvalRule, bool) {
+	name := strings.ToLower(strings.SplitN(command, " ", 2)[0])
+	if name == "/approve" || name == "/reject" {
+		return approvalRule{}, false
+	}
+	if line, ok := strings.CutPrefix(command, ">"); ok {
+		command = "/exec " + line
+	}
+	forms := approvalForms(command)
+	for _, rule := range r.approvalRules {
+		for _, form := range forms {
+			if rule.re.MatchString(form) {
+				return rule, true
+			}
+		}
+	}
+	return approvalRule{}, false
+}
+
+// approvalForms returns the texts approval rules are matched against: the
+// command itself, the command a /foreach runs, and for every git push it
+// runs however it is entered (/push, /git push, /exec with git push
+// anywhere in the shell line) the canonical "/push [--force] <args>", with
+// -f, --force-with-lease, a +refspec and the like all spelled --force, so
+// a "/push *--force*" rule covers them.
+func approvalForms(command string) []string {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil
+	}
+	forms := []string{strings.Join(fields, " ")}
+	name := strings.ToLower(fields[0])
+	_, rest := cutWord(command)
+	if name == "/foreach" && len(fields) > 2 {
+		_, inner := cutWord(rest)
+		return append(forms, approvalForms(inner)...)
+	}
+	for _, push := range gitPushes(name, rest) {
+		forms = append(forms, canonicalPush(push))
+	}
+	return forms
+}
+
+// cutWord splits the first whitespace-separated word off s.
+func cutWord(s string) (word, rest string) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, " \t\n"); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i:])
+	}
+	return s, ""
+}
+
+// gitPushes returns the arguments of each git push a command named name
+// with the argument text rest runs.
+func gitPushes(name, rest string) [][]string {
+	switch name {
+	case "/push":
+		return [][]string{strings.Fields(rest)}
+	case "/git":
+		if args, ok := gitSubcommandArgs(strings.Fields(rest), "push"); ok {
+			return [][]string{args}
+		}
+	case "/exec":
+		if f, err := parseExecFlags(rest); err == nil {
+			rest = f.command
+		}
+		return shellGitPushes(rest)
+	}
+	return nil
+}
+
+// shellGitPushes returns the arguments of every git push in a shell
+// command line. Quotes are dropped rather than parsed, so a push wrapped in
+// sh -c '…', eval "…" or $(…) counts too.
+func shellGitPushes(command string) [][]string {
+	var pushes [][]string
+	unquote := strings.NewReplacer("'", " ", `"`, " ", "`", " ", "$", " ")
+	segments := strings.FieldsFunc(command, func(c rune) bool {
+		return c == ';' || c == '&' || c == '|' || c == '\n' || c == '(' || c == ')'
+	})
+	for _, seg := range segments {
+		words := strings.Fields(unquote.Replace(seg))
+		for i, w := range words {
+			if filepath.Base(w) != "git" {
+				continue
+			}
+			if args, ok := gitSubcommandArgs(words[i+1:], "push"); ok {
+				pushes = append(pushes, args)
+			}
+		}
+	}
+	return pushes
+}
+
+// gitSubcommandArgs returns the arguments after sub when args, git's
+// command line without "git", runs that subcommand.
+func gitSubcommandArgs(args []string, sub string) ([]string, bool) {
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == sub:
+			return args[i+1:], true
+		case args[i] == "-C" || args[i] == "-c":
+			i++ // takes a value
+		case !strings.HasPrefix(args[i], "-"):
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// canonicalPush renders push arguments as "/push [--force] <args>".
+func canonicalPush(args []string) string {
+	force := false
+	var rest []string
+	for _, arg := range args {
+		switch {
+		case arg == "-f" || strings.HasPrefix(arg, "--force"):
+			force = true
+			continue
+		case strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.Contains(arg, "f"):
+			force = true
+			arg = strings.ReplaceAll(arg, "f", "")
+			if arg == "-" {
+				continue
+			}
+		case strings.HasPrefix(arg, "+"):
+			force = true
+			arg = arg[1:]
+		}
+		rest = append(rest, arg)
+	}
+	if force {
+		rest = append([]string{"--force"}, rest...)
+	}
+	return strings.Join(append([]string{"/push"}, rest...), " ")
+}
+
+func (rule approvalRule) label() string {
+	if rule.Name != "" {
+		return rule.Name
+	}
+	return rule.Command
+}
+
+func (rule approvalRule) isApprover(userID string) bool {
+	for _, a := range rule.Approvers {
+		if a == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// holdForApproval reports whether command needs approval, in which case
+// it is held and an approval card is posted instead of running it. A
+// command already approved (withApproved) is never held.
+func (r *Router) holdForApproval(ctx context.Context, chatID, userID, command string) bool {
+	if approvedFrom(ctx) {
+		return false
+	}
+	rule, ok := r.matchApprovalRule(command)
+	if !ok {
+		return false
+	}
+	eligible := len(rule.Approvers)
+	if rule.isApprover(userID) {
+		eligible--
+	}
+	if eligible < rule.Required {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("%s 需要 %d 位审批人批准，但除你之外只有 %d 位审批人，无法执行。", command, rule.Required, eligible))
+		return true
+	}
+	now := time.Now()
+	p := &pendingApproval{
+		rec: ApprovalRecord{
+			ID: newExecID(), ChatID: chatID, Command: command, Rule: rule.label(),
+			Requester: userID, Required: rule.Required, RequestedAt: now,
+		},
+		rule: rule,
+	}
+	r.mu.Lock()
+	r.pendingApprovals[p.rec.ID] = p
+	r.mu.Unlock()
+	slog.InfoContext(ctx, "approval: requested", "user_id", userID, "command", command, "chat_id", chatID, "rule", rule.label())
+	r.sender.SendCard(ctx, chatID, CardMsg{
+		Title: "🔐 需要审批: " + rule.label(),
+		Content: fmt.Sprintf("**命令:** `%s`\n**发起人:** %s\n**需要:** %d 位审批人批准（发起人除外）\n**审批人:** %s\n\n审批人点击下方按钮，或发送 `/approve %s`、`/reject %s`；%d 小时内未获批准则作废。",
+			command, userID, rule.Required, strings.Join(rule.Approvers, ", "), p.rec.ID, p.rec.ID, int(approvalExpiry.Hours())),
+		Template: "orange",
+		Buttons: []CardButton{
+			{Text: "批准", Command: "/approve " + p.rec.ID, Type: "primary"},
+			{Text: "拒绝", Command: "/reject " + p.rec.ID, Type: "danger"},
+		},
+	})
+	return true
+}
+
+// recordApproval records the chain of a decided request in the audit log.
+func (r *Router) recordApproval(rec ApprovalRecord, outcome string, now time.Time) {
+	rec.Outcome = outcome
+	rec.DecidedAt = now
+	r.store.AddApprovalRecord(rec)
+	r.save()
+	slog.Info("approval: "+outcome, "approval_id", rec.ID, "command", rec.Command, "votes", formatApprovalVotes(rec.Votes))
+}
+
+// expireApprovals drops the requests that ran out of time at now.
+func (r *Router) expireApprovals(now time.Time) {
+	r.mu.Lock()
+	var expired []ApprovalRecord
+	for id, p := range r.pendingApprovals {
+		if now.Sub(p.rec.RequestedAt) > approvalExpiry {
+			expired = append(expired, p.rec)
+			delete(r.pendingApprovals, id)
+		}
+	}
+	r.mu.Unlock()
+	for _, rec := range expired {
+		r.recordApproval(rec, "expired", now)
+	}
+}
+
+func formatApprovalVotes(votes []ApprovalVote) string {
+	if len(votes) == 0 {
+		return "-"
+	}
+	var parts []string
+	for _, v := range votes {
+		mark := "✓"
+		if !v.Approve {
+			mark = "✗"
+		}
+		parts = append(parts, fmt.Sprintf("%s %s %s", mark, v.UserID, v.At.Format("01-02 15:04")))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func countApprovals(votes []ApprovalVote) int {
+	n := 0
+	for _, v := range votes {
+		if v.Approve {
+			n++
+		}
+	}
+	return n
+}
+
+// cmdApprove records the sending user's approval or rejection of a held
+// command, and runs the command once its rule's quorum is reached. Without
+// an ID it lists the chat's pending requests.
+func (r *Router) cmdApprove(ctx context.Context, chatID, args string, approve bool) {
+	now := time.Now()
+	r.expireApprovals(now)
+	id := strings.TrimSpace(args)
+	if id == "" {
+		r.listApprovals(ctx, chatID)
+		return
+	}
+	userID := userIDFrom(ctx)
+	r.mu.Lock()
+	p := r.pendingApprovals[id]
+	var problem string
+	switch {
+	case p == nil:
+		problem = fmt.Sprintf("没有待审批的请求 %s（可能已执行、被拒绝或已过期）。", id)
+	case !p.rule.isApprover(userID):
+		problem = fmt.Sprintf("你不是「%s」的审批人。", p.rule.label())
+	case userID == p.rec.Requester:
+		problem = "不能审批自己发起的请求。"
+	default:
+		for _, v := range p.rec.Votes {
+			if v.UserID == userID {
+				problem = "你已经审批过这个请求了。"
+			}
+		}
+	}
+	if problem != "" {
+		r.mu.Unlock()
+		r.sender.SendText(ctx, chatID, problem)
+		return
+	}
+	p.rec.Votes = append(p.rec.Votes, ApprovalVote{UserID: userID, Approve: approve, At: now})
+	approvals := countApprovals(p.rec.Votes)
+	if !approve || approvals >= p.rec.Required {
+		// Decided: no later vote may act on it.
+		delete(r.pendingApprovals, id)
+	}
+	rec := p.rec
+	r.mu.Unlock()
+
+	notify := func(card CardMsg) {
+		r.sender.SendCard(ctx, rec.ChatID, card)
+		if chatID != rec.ChatID {
+			r.sender.SendText(ctx, chatID, card.Title)
+		}
+	}
+	chain := fmt.Sprintf("**命令:** `%s`\n**发起人:** %s\n**审批:** %s", rec.Command, rec.Requester, formatApprovalVotes(rec.Votes))
+	switch {
+	case !approve:
+		r.recordApproval(rec, "rejected", now)
+		notify(CardMsg{Title: fmt.Sprintf("❌ %s 拒绝了 %s", userID, rec.Command), Content: chain, Template: "red"})
+	case approvals >= rec.Required:
+		r.recordApproval(rec, "approved", now)
+		notify(CardMsg{Title: fmt.Sprintf("✅ 已获批准（%d/%d），执行 %s", approvals, rec.Required, rec.Command), Content: chain, Template: "green"})
+		runCtx := withApproved(withUserID(ctx, rec.Requester))
+		if strings.HasPrefix(rec.Command, ">") {
+			r.shellInput(runCtx, rec.ChatID, rec.Command)
+		} else {
+			r.handleCommand(runCtx, rec.ChatID, rec.Command)
+		}
+	default:
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已记录 %s 的批准（%d/%d），还需 %d 位审批人批准。", userID, approvals, rec.Required, rec.Required-approvals))
+	}
+}
+
+// listApprovals shows the chat's requests waiting for approval.
+func (r *Router) listApprovals(ctx context.Context, chatID string) {
+	r.mu.Lock()
+	var pending []ApprovalRecord
+	for _, p := range r.pendingApprovals {
+		if p.rec.ChatID == chatID {
+			pending = append(pending, p.rec)
+		}
+	}
+	r.mu.Unlock()
+	if len(pending) == 0 {
+		r.sender.SendText(ctx, chatID, "没有等待审批的命令。")
+		return
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].RequestedAt.Before(pending[j].RequestedAt) })
+	var sb strings.Builder
+	for _, rec := range pending {
+		fmt.Fprintf(&sb, "- `%s` `%s`（%s 发起，%d/%d）\n", rec.ID, rec.Command, rec.Requester, countApprovals(rec.Votes), rec.Required)
+	}
+	sb.WriteString("\n审批: /approve <ID>，拒绝: /reject <ID>")
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("🔐 等待审批（%d）", len(pending)), Content: sb.String()})
+}
+
+// formatApprovalAudit renders recent approval chains for /audit.
+func formatApprovalAudit(records []ApprovalRecord) string {
+	outcomes := map[string]string{"approved": "✓ 批准", "rejected": "✗ 拒绝", "expired": "⌛ 过期"}
+	var sb strings.Builder
+	for _, rec := range records {
+		fmt.Fprintf(&sb, "%s `%s` %s · `%s` · `%s` · 发起 %s · %s\n", outcomes[rec.Outcome], rec.ID, rec.RequestedAt.Format("01-02 15:04"), rec.ChatID, rec.Command, rec.Requester, formatApprovalVotes(rec.Votes))
+	}
+	return sb.String()
+}
@@ -0,0 +1,193 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApprovalPattern(t *testing.T) {
+	re := approvalPattern("/push *--force*")
+	for _, cmd := range []string{"/push --force", "/push origin main --force", "/PUSH origin --force-with-lease"} {
+		if !re.MatchString(cmd) {
+			t.Errorf("expected %q to match", cmd)
+		}
+	}
+	for _, cmd := range []string{"/push origin main", "/pushy --force x", "/git push --force"} {
+		if re.MatchString(cmd) {
+			t.Errorf("expected %q not to match", cmd)
+		}
+	}
+	if approvalPattern("/deploy prod").MatchString("/deploy production") {
+		t.Error("expected a pattern without * to match the whole command")
+	}
+}
+
+func TestMatchApprovalRule_GitPushForms(t *testing.T) {
+	r, _ := newTestRouter(t)
+	r.SetApprovalRules([]ApprovalRule{{Command: "/push *--force*", Approvers: []string{"user2"}, Required: 1}})
+	for _, cmd := range []string{
+		"/push -f", "/push origin +main", "/push -uf origin main", "/push --force-with-lease",
+		"/git push --force", "/git -C svc push -f", "/exec git push origin +main",
+		"/foreach svc,api /git push -f", "/foreach * /exec /usr/bin/git push --force",
+		"/exec sh -c 'git push -f'", `/exec --env A=1 bash -c "cd svc && git push origin +main"`, "/exec echo $(git push -f)",
+		"> git push -f", ">  cd svc; git push --force",
+	} {
+		if _, ok := r.matchApprovalRule(cmd); !ok {
+			t.Errorf("expected %q to need approval", cmd)
+		}
+	}
+	for _, cmd := range []string{"/push", "/push -u origin main", "/git push origin main", "/git log -f", "/exec git fetch --force", "/foreach svc /git status"} {
+		if _, ok := r.matchApprovalRule(cmd); ok {
+			t.Errorf("expected %q not to need approval", cmd)
+		}
+	}
+}
+
+// newApprovalRouter returns a router where /pwd needs two of user2, user3
+// and user4, and /ls needs user1 and user2 both.
+func newApprovalRouter(t *testing.T) (*Router, *spySender) {
+	t.Helper()
+	r, sender := newTestRouter(t)
+	for _, u := range []string{"user2", "user3", "user4", "user5"} {
+		r.allowedUsers[u] = true
+	}
+	r.SetApprovalRules([]ApprovalRule{
+		{Name: "查看目录", Command: "/pwd", Approvers: []string{"user2", "user3", "user4"}, Required: 2},
+		{Command: "/ls *", Approvers: []string{"user1", "user2"}, Required: 2},
+	})
+	return r, sender
+}
+
+func pendingApprovalID(t *testing.T, r *Router) string {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id := range r.pendingApprovals {
+		return id
+	}
+	t.Fatal("expected a pending approval")
+	return ""
+}
+
+func TestRouterApprovalQuorum(t *testing.T) {
+	r, sender := newApprovalRouter(t)
+	ctx := context.Background()
+	workDir := r.getSession("chat1").WorkDir
+
+	r.Route(ctx, "chat1", "user1", "/pwd")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "需要审批: 查看目录") || !strings.Contains(msg, "2 位审批人批准") {
+		t.Fatalf("expected an approval card, got %q", msg)
+	}
+	id := pendingApprovalID(t, r)
+
+	for _, c := range []struct{ user, want string }{
+		{"user5", "不是「查看目录」的审批人"},
+		{"user2", "已记录 user2 的批准（1/2），还需 1 位"},
+		{"user2", "已经审批过"},
+	} {
+		r.Route(ctx, "chat1", c.user, "/approve "+id)
+		if !strings.Contains(sender.LastMessage(), c.want) {
+			t.Fatalf("%s: expected %q, got %q", c.user, c.want, sender.LastMessage())
+		}
+	}
+	r.Route(ctx, "chat1", "user2", "/approve")
+	if !strings.Contains(sender.LastMessage(), "等待审批（1）") || !strings.Contains(sender.LastMessage(), "1/2") {
+		t.Fatalf("unexpected list %q", sender.LastMessage())
+	}
+
+	r.Route(ctx, "chat1", "user3", "/approve "+id)
+	n := len(sender.messages)
+	if sender.messages[n-1] != workDir || !strings.Contains(sender.messages[n-2], "已获批准（2/2），执行 /pwd") {
+		t.Fatalf("expected the command run after the quorum, got %q", sender.messages[n-2:])
+	}
+	r.Route(ctx, "chat1", "user4", "/approve "+id)
+	if !strings.Contains(sender.LastMessage(), "没有待审批的请求") {
+		t.Fatalf("expected the request closed, got %q", sender.LastMessage())
+	}
+
+	recs := r.store.ApprovalRecords(0)
+	if len(recs) != 1 || recs[0].Outcome != "approved" || recs[0].Requester != "user1" || len(recs[0].Votes) != 2 || recs[0].Votes[1].UserID != "user3" {
+		t.Fatalf("unexpected approval records %+v", recs)
+	}
+	r.Route(ctx, "chat1", "user1", "/audit")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "审批记录") || !strings.Contains(msg, "✓ 批准 `"+id+"`") || !strings.Contains(msg, "✓ user3") {
+		t.Fatalf("expected the chain in the audit log, got %q", msg)
+	}
+}
+
+func TestRouterApproval_ExecRepeatAndShell(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.allowedUsers["user2"] = true
+	r.SetApprovalRules([]ApprovalRule{{Command: "/exec *touch*", Approvers: []string{"user2"}, Required: 1}})
+	ctx := context.Background()
+	marker := filepath.Join(r.getSession("chat1").WorkDir, "marker")
+
+	r.Route(ctx, "chat1", "user1", "/exec touch marker")
+	r.Route(ctx, "chat1", "user2", "/approve "+pendingApprovalID(t, r))
+	if !fileExists(marker) {
+		t.Fatalf("expected the approved command run, got %q", sender.LastMessage())
+	}
+	os.Remove(marker)
+
+	// Repeating it from the history needs approval again.
+	for _, cmd := range []string{"/exec !!", "/exec !1"} {
+		r.Route(ctx, "chat1", "user1", cmd)
+		if msg := sender.LastMessage(); !strings.Contains(msg, "需要审批") || !strings.Contains(msg, "/exec touch marker") {
+			t.Fatalf("%s: expected an approval card for the expanded command, got %q", cmd, msg)
+		}
+		if fileExists(marker) {
+			t.Fatalf("%s ran without approval", cmd)
+		}
+	}
+	if _, ok := r.matchApprovalRule("> touch marker"); !ok {
+		t.Fatal("expected shell input to need approval")
+	}
+}
+
+func TestRouterApprovalRejectAndExpiry(t *testing.T) {
+	r, sender := newApprovalRouter(t)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user2", "/ls project1")
+	if !strings.Contains(sender.LastMessage(), "除你之外只有 1 位审批人") {
+		t.Fatalf("expected an unreachable quorum refused, got %q", sender.LastMessage())
+	}
+
+	r.Route(ctx, "chat1", "user3", "/ls project1")
+	id := pendingApprovalID(t, r)
+	r.Route(ctx, "chat1", "user3", "/approve "+id)
+	if !strings.Contains(sender.LastMessage(), "不是") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "user1", "/approve "+id)
+	r.Route(ctx, "chat2", "user2", "/reject "+id)
+	n := len(sender.messages)
+	if !strings.Contains(sender.messages[n-2], "user2 拒绝了 /ls project1") || !strings.Contains(sender.messages[n-2], "✓ user1") || !strings.Contains(sender.messages[n-1], "拒绝了") {
+		t.Fatalf("expected the rejection posted to both chats, got %q", sender.messages[n-2:])
+	}
+	if recs := r.store.ApprovalRecords(0); len(recs) != 1 || recs[0].Outcome != "rejected" {
+		t.Fatalf("unexpected approval records %+v", recs)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/pwd")
+	id = pendingApprovalID(t, r)
+	r.mu.Lock()
+	r.pendingApprovals[id].rec.RequestedAt = time.Now().Add(-approvalExpiry - time.Minute)
+	r.mu.Unlock()
+	r.Route(ctx, "chat1", "user2", "/approve "+id)
+	if !strings.Contains(sender.LastMessage(), "没有待审批的请求") {
+		t.Fatalf("expected the request expired, got %q", sender.LastMessage())
+	}
+	if recs := r.store.ApprovalRecords(1); recs[0].Outcome != "expired" {
+		t.Fatalf("unexpected approval records %+v", recs)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/ls")
+	if strings.Contains(sender.LastMessage(), "需要审批") {
+		t.Fatal("expected commands outside the rules to run directly")
+	}
+}
@@ -0,0 +1,181 @@
+package bot
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxAttachmentRunes caps one expanded @file or @diff.
+	maxAttachmentRunes = 20000
+	// maxAttachmentsRunes caps everything attached to one prompt.
+	maxAttachmentsRunes = 60000
+)
+
+// attachmentRe matches @file:<path>[#L<start>[-<end>]] and @diff[:<ref>]
+// at the start of a word.
+var attachmentRe = regexp.MustCompile(`(^|\s)@(file:(\S+)|diff(?::(\S+))?)`)
+
+var lineRangeRe = regexp.MustCompile(`^(.*)#L(\d+)(?:-L?(\d+))?$`)
+
+// attachment is one expanded @ reference.
+type attachment struct {
+	Ref     string // as written, e.g. "@file:main.go#L1-20"
+	Label   string // what was attached, e.g. "main.go (行 1-20)"
+	Content string
+}
+
+// expandAttachments appends the contents of the @file and @diff
+// references in prompt, resolved against workDir, to the prompt. The
+// references stay in place so Claude can tell what each block is. It
+// returns the expanded prompt, what was attached and problems to report.
+func expandAttachments(workDir, prompt string) (string, []attachment, []string) {
+	matches := attachmentRe.FindAllStringSubmatch(prompt, -1)
+	if len(matches) == 0 {
+		return prompt, nil, nil
+	}
+	seen := make(map[string]bool)
+	var atts []attachment
+	var problems []string
+	total := 0
+	for _, m := range matches {
+		ref := "@" + strings.TrimRight(m[2], ".,;:!?)）。，；：！？")
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		var att attachment
+		var err error
+		if strings.HasPrefix(ref, "@file:") {
+			att, err = fileAttachment(workDir, strings.TrimPrefix(ref, "@file:"))
+		} else {
+			att, err = diffAttachment(workDir, strings.TrimPrefix(strings.TrimPrefix(ref, "@diff"), ":"))
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", ref, err))
+			continue
+		}
+		att.Ref = ref
+		if n := len([]rune(att.Content)); n > maxAttachmentRunes {
+			att.Content = string([]rune(att.Content)[:maxAttachmentRunes]) + fmt.Sprintf("\n...（已截断，共 %d 字符）", n)
+		}
+		if total+len([]rune(att.Content)) > maxAttachmentsRunes {
+			problems = append(problems, fmt.Sprintf("%s: 附件总量超过 %d 字符，未附加", ref, maxAttachmentsRunes))
+			continue
+		}
+		total += len([]rune(att.Content))
+		atts = append(atts, att)
+	}
+	if len(atts) == 0 {
+		return prompt, nil, problems
+	}
+	var sb strings.Builder
+	sb.WriteString(prompt)
+	sb.WriteString("\n\n[devbot 附件]\n")
+	for _, att := range atts {
+		fence := "```"
+		for strings.Contains(att.Content, fence) {
+			fence += "`"
+		}
+		fmt.Fprintf(&sb, "\n%s — %s\n%s\n%s\n%s\n", att.Ref, att.Label, fence, strings.TrimRight(att.Content, "\n"), fence)
+	}
+	sb.WriteString("[/devbot 附件]")
+	return sb.String(), atts, problems
+}
+
+// fileAttachment reads a workdir file, optionally limited to a line range
+// written as path#L10-20.
+func fileAttachment(workDir, spec string) (attachment, error) {
+	path, start, end := spec, 0, 0
+	if m := lineRangeRe.FindStringSubmatch(spec); m != nil {
+		path = m[1]
+		start, _ = strconv.Atoi(m[2])
+		end = start
+		if m[3] != "" {
+			end, _ = strconv.Atoi(m[3])
+		}
+		if start < 1 || end < start {
+			return attachment{}, fmt.Errorf("无效的行号范围")
+		}
+	}
+	full := path
+	if !filepath.IsAbs(full) {
+		full = filepath.Join(workDir, full)
+	}
+	if !underRoot(workDir, full) {
+		return attachment{}, fmt.Errorf("不在工作目录内")
+	}
+	info, err := os.Stat(full)
+	if err != nil {
+		return attachment{}, fmt.Errorf("文件不存在")
+	}
+	if info.IsDir() {
+		return attachment{}, fmt.Errorf("是目录，不是文件")
+	}
+	data, err := os.ReadFile(full)
+	if err != nil {
+		return attachment{}, err
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return attachment{}, fmt.Errorf("是二进制文件")
+	}
+	rel, _ := filepath.Rel(workDir, full)
+	label := rel
+	content := string(data)
+	if start > 0 {
+		lines := strings.SplitAfter(content, "\n")
+		if start > len(lines) {
+			return attachment{}, fmt.Errorf("文件只有 %d 行", len(lines))
+		}
+		if end > len(lines) {
+			end = len(lines)
+		}
+		content = strings.Join(lines[start-1:end], "")
+		label = fmt.Sprintf("%s（行 %d-%d）", rel, start, end)
+	}
+	return attachment{Label: label, Content: content}, nil
+}
+
+// diffAttachment returns the workdir's uncommitted changes, or its diff
+// against ref.
+func diffAttachment(workDir, ref string) (attachment, error) {
+	if strings.HasPrefix(ref, "-") {
+		return attachment{}, fmt.Errorf("无效的引用")
+	}
+	args := []string{"diff", "HEAD"}
+	label := "未提交的变更（git diff HEAD）"
+	if ref != "" {
+		args = []string{"diff", ref}
+		label = fmt.Sprintf("相对 %s 的变更（git diff %s）", ref, ref)
+	}
+	out, err := runGitOutput(workDir, args...)
+	if err != nil {
+		return attachment{}, fmt.Errorf("git diff 出错: %s", truncateRunes(out, 200))
+	}
+	if out == "" {
+		out = "（无变更）"
+	}
+	return attachment{Label: label, Content: out}, nil
+}
+
+// attachmentNotice tells the chat what was attached to a prompt and what
+// could not be, or "" when the prompt had no references.
+func attachmentNotice(atts []attachment, problems []string) string {
+	var lines []string
+	if len(atts) > 0 {
+		var parts []string
+		for _, att := range atts {
+			parts = append(parts, fmt.Sprintf("%s（%s）", att.Label, formatSize(int64(len(att.Content)))))
+		}
+		lines = append(lines, "📎 已附加: "+strings.Join(parts, "，"))
+	}
+	for _, p := range problems {
+		lines = append(lines, "⚠️ 未能附加 "+p)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,109 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandAttachments(t *testing.T) {
+	workDir := t.TempDir()
+	os.WriteFile(filepath.Join(workDir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644)
+	os.WriteFile(filepath.Join(workDir, "notes.md"), []byte("```go\nx\n```\n"), 0644)
+	os.WriteFile(filepath.Join(workDir, "app.bin"), []byte{0, 1, 2}, 0644)
+	os.Mkdir(filepath.Join(workDir, "pkg"), 0755)
+
+	prompt := "look at @file:main.go#L3, @file:notes.md and @file:main.go#L3. also @file:missing.go @file:../etc/passwd @file:pkg @file:app.bin @file:main.go#L9 me@file:x"
+	got, atts, problems := expandAttachments(workDir, prompt)
+	if !strings.HasPrefix(got, prompt+"\n\n[devbot 附件]\n") || !strings.HasSuffix(got, "[/devbot 附件]") {
+		t.Fatalf("unexpected expansion %q", got)
+	}
+	if len(atts) != 2 || atts[0].Label != "main.go（行 3-3）" || atts[0].Content != "func main() {}\n" {
+		t.Fatalf("unexpected attachments %+v", atts)
+	}
+	if !strings.Contains(got, "@file:notes.md — notes.md\n````\n```go\nx\n```\n````") {
+		t.Fatalf("expected a longer fence around backticks, got %q", got)
+	}
+	want := []string{
+		"@file:missing.go: 文件不存在",
+		"@file:../etc/passwd: 不在工作目录内",
+		"@file:pkg: 是目录，不是文件",
+		"@file:app.bin: 是二进制文件",
+		"@file:main.go#L9: 文件只有 4 行",
+	}
+	if strings.Join(problems, "|") != strings.Join(want, "|") {
+		t.Fatalf("unexpected problems %q", problems)
+	}
+
+	if got, atts, problems := expandAttachments(workDir, "email me@example.com"); got != "email me@example.com" || atts != nil || problems != nil {
+		t.Fatalf("expected prompt unchanged, got %q %v %v", got, atts, problems)
+	}
+}
+
+func TestExpandAttachments_Caps(t *testing.T) {
+	workDir := t.TempDir()
+	big := strings.Repeat("x", maxAttachmentRunes+10)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		os.WriteFile(filepath.Join(workDir, name), []byte(big), 0644)
+	}
+	_, atts, problems := expandAttachments(workDir, "@file:a.txt @file:b.txt @file:c.txt @file:d.txt")
+	if len(atts) != 2 || !strings.Contains(atts[0].Content, "已截断") {
+		t.Fatalf("expected two truncated attachments, got %d", len(atts))
+	}
+	if len(problems) != 2 || !strings.Contains(problems[0], "附件总量超过") {
+		t.Fatalf("unexpected problems %q", problems)
+	}
+}
+
+func TestExpandAttachments_Diff(t *testing.T) {
+	workDir := t.TempDir()
+	for _, args := range [][]string{{"init", "-q"}, {"commit", "-q", "--allow-empty", "-m", "init"}} {
+		if out, err := exec.Command("git", append([]string{"-C", workDir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v %s", args, err, out)
+		}
+	}
+	_, atts, _ := expandAttachments(workDir, "@diff")
+	if len(atts) != 1 || atts[0].Content != "（无变更）" {
+		t.Fatalf("unexpected clean diff %+v", atts)
+	}
+	os.WriteFile(filepath.Join(workDir, "a.txt"), []byte("hello\n"), 0644)
+	exec.Command("git", "-C", workDir, "add", "a.txt").Run()
+	got, atts, problems := expandAttachments(workDir, "review @diff please, and @diff:--output=x")
+	if len(atts) != 1 || !strings.Contains(got, "+hello") || len(problems) != 1 || !strings.Contains(problems[0], "无效的引用") {
+		t.Fatalf("unexpected diff expansion %q %q", got, problems)
+	}
+}
+
+func TestRouterPromptAttachments(t *testing.T) {
+	dir := t.TempDir()
+	seen := filepath.Join(dir, "seen")
+	claude := filepath.Join(dir, "claude")
+	os.WriteFile(claude, []byte(`#!/bin/sh
+printf '%s' "$(cat)" > `+seen+`
+echo '{"type":"result","result":"ok","session_id":"s1"}'
+`), 0755)
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	sender := &syncSpySender{}
+	r := NewRouter(context.Background(), NewClaudeExecutor(claude, "sonnet", 10*time.Second), store, sender, map[string]bool{"user1": true}, dir, nil)
+	os.WriteFile(filepath.Join(dir, "todo.txt"), []byte("ship it\n"), 0644)
+
+	r.Route(context.Background(), "chat1", "user1", "what is in @file:todo.txt")
+	data, _ := os.ReadFile(seen)
+	if !strings.Contains(string(data), "@file:todo.txt — todo.txt\n```\nship it\n```") {
+		t.Fatalf("expected file contents sent to claude, got %q", data)
+	}
+	found := false
+	for _, m := range sender.Messages() {
+		found = found || strings.HasPrefix(m, "📎 已附加: todo.txt")
+	}
+	if !found {
+		t.Fatalf("expected attachment notice, got %v", sender.Messages())
+	}
+	if recs := r.store.ExecRecords("chat1", 1); len(recs) != 1 || recs[0].Prompt != "what is in @file:todo.txt" {
+		t.Fatalf("expected record to keep the prompt as written, got %+v", recs)
+	}
+}
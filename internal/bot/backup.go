@@ -0,0 +1,330 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// backupPrefix and backupTimeFormat name backups
+	// state-20060102-150405.json, so they sort by time.
+	backupPrefix     = "state-"
+	backupTimeFormat = "20060102-150405"
+	// backupUploadTimeout bounds one upload to S3.
+	backupUploadTimeout = 2 * time.Minute
+	// backupCheckInterval is how often the scheduler checks whether a
+	// backup is due.
+	backupCheckInterval = time.Hour
+	// Secrets holding the S3 credentials.
+	backupAccessKeySecret = "backup_s3_access_key"
+	backupSecretKeySecret = "backup_s3_secret_key"
+)
+
+// SetBackupConfig enables state backups to dir every interval, keeping the
+// newest keep copies; s3URL (https://host/bucket[/prefix]) also uploads
+// each copy. An empty dir disables backups.
+func (r *Router) SetBackupConfig(dir string, interval time.Duration, keep int, s3URL, region string) {
+	r.backupDir = dir
+	r.backupInterval = interval
+	r.backupKeep = keep
+	r.backupS3URL = strings.TrimRight(s3URL, "/")
+	r.backupS3Region = region
+}
+
+// StartBackups backs the state up whenever the newest backup is older than
+// the interval, checking now and then hourly until ctx is done, so restarts
+// neither skip nor multiply backups.
+func (r *Router) StartBackups(ctx context.Context) {
+	if r.backupDir == "" || r.backupInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(backupCheckInterval)
+		defer ticker.Stop()
+		for {
+			backups, _ := listBackups(r.backupDir)
+			if len(backups) == 0 || time.Since(backups[0].At) >= r.backupInterval {
+				if res, err := r.backupState(ctx, time.Now()); err != nil {
+					slog.WarnContext(ctx, "backup: failed", "err", err)
+				} else if res.UploadErr != nil {
+					slog.WarnContext(ctx, "backup: saved, upload failed", "name", res.Name, "err", res.UploadErr)
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// backupFile is one backup in the backup directory.
+type backupFile struct {
+	Name string
+	At   time.Time
+	Size int64
+}
+
+// listBackups returns the backups in dir, newest first.
+func listBackups(dir string) ([]backupFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []backupFile
+	for _, e := range entries {
+		stamp, ok := strings.CutPrefix(e.Name(), backupPrefix)
+		if !ok || e.IsDir() {
+			continue
+		}
+		at, err := time.ParseInLocation(backupTimeFormat, strings.TrimSuffix(stamp, ".json"), time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, backupFile{Name: e.Name(), At: at, Size: info.Size()})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].At.After(out[j].At) })
+	return out, nil
+}
+
+// backupResult describes one backup: the file written, how many old ones
+// were rotated out and where it was uploaded.
+type backupResult struct {
+	Name      string
+	Size      int
+	Removed   int
+	Uploaded  string
+	UploadErr error
+}
+
+// backupState writes the current state to the backup directory, removes
+// backups beyond the newest backupKeep and uploads the new one when S3 is
+// configured. A failed upload is reported in the result, not as an error:
+// the local copy exists.
+func (r *Router) backupState(ctx context.Context, now time.Time) (backupResult, error) {
+	data, err := r.store.Snapshot()
+	if err != nil {
+		return backupResult{}, err
+	}
+	// The state holds tokens: keep backups private.
+	if err := os.MkdirAll(r.backupDir, 0700); err != nil {
+		return backupResult{}, err
+	}
+	res := backupResult{Name: backupPrefix + now.Format(backupTimeFormat) + ".json", Size: len(data)}
+	path := filepath.Join(r.backupDir, res.Name)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return backupResult{}, err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return backupResult{}, err
+	}
+	if backups, err := listBackups(r.backupDir); err == nil && r.backupKeep > 0 && len(backups) > r.backupKeep {
+		for _, b := range backups[r.backupKeep:] {
+			if os.Remove(filepath.Join(r.backupDir, b.Name)) == nil {
+				res.Removed++
+			}
+		}
+	}
+	if r.backupS3URL != "" {
+		res.Uploaded, res.UploadErr = r.uploadBackup(ctx, res.Name, data, now)
+	}
+	slog.InfoContext(ctx, "backup: saved", "name", res.Name, "bytes", res.Size, "rotated_out", res.Removed)
+	return res, nil
+}
+
+// uploadBackup PUTs data to the S3-compatible bucket as name, returning
+// the object URL.
+func (r *Router) uploadBackup(ctx context.Context, name string, data []byte, now time.Time) (string, error) {
+	accessKey, ok := r.secrets.Get(backupAccessKeySecret)
+	if !ok {
+		return "", fmt.Errorf("未配置 %s 密钥", backupAccessKeySecret)
+	}
+	secretKey, ok := r.secrets.Get(backupSecretKeySecret)
+	if !ok {
+		return "", fmt.Errorf("未配置 %s 密钥", backupSecretKeySecret)
+	}
+	ctx, cancel := context.WithTimeout(ctx, backupUploadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, r.backupS3URL+"/"+url.PathEscape(name), bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	signS3Request(req, data, r.backupS3Region, accessKey, secretKey, now)
+	if _, _, err := doShareRequest(req); err != nil {
+		return "", err
+	}
+	return req.URL.String(), nil
+}
+
+// signS3Request adds AWS Signature Version 4 headers for the S3 service to
+// req, whose body is payload.
+func signS3Request(req *http.Request, payload []byte, region, accessKey, secretKey string, now time.Time) {
+	payloadHash := sha256Hex(payload)
+	amzDate := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	req.Header.Set("Authorization", sigV4Authorization(req.Method, req.URL, req.URL.Host,
+		[][2]string{{"x-amz-content-sha256", payloadHash}, {"x-amz-date", amzDate}},
+		payloadHash, region, "s3", accessKey, secretKey, now))
+}
+
+// sigV4Authorization computes the AWS Signature Version 4 Authorization
+// header for a request signed over host and headers (lowercase names,
+// sorted, excluding host).
+func sigV4Authorization(method string, u *url.URL, host string, headers [][2]string, payloadHash, region, service, accessKey, secretKey string, now time.Time) string {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := now.UTC().Format("20060102")
+	canonicalHeaders := "host:" + host + "\n"
+	signedHeaders := "host"
+	for _, h := range headers {
+		canonicalHeaders += h[0] + ":" + strings.TrimSpace(h[1]) + "\n"
+		signedHeaders += ";" + h[0]
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{method, path, u.Query().Encode(), canonicalHeaders, signedHeaders, payloadHash}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	return fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// cmdAdmin runs bot maintenance for admins: /admin backup now|list.
+func (r *Router) cmdAdmin(ctx context.Context, chatID, args string) {
+	usage := "用法: /admin backup now  立即备份状态文件\n       /admin backup list  查看本地备份"
+	fields := strings.Fields(args)
+	if len(fields) != 2 || fields[0] != "backup" {
+		r.sender.SendText(ctx, chatID, usage)
+		return
+	}
+	if r.backupDir == "" {
+		r.sender.SendText(ctx, chatID, "未配置备份目录，请在配置中设置 backup_dir。")
+		return
+	}
+	switch fields[1] {
+	case "now":
+		res, err := r.backupState(ctx, time.Now())
+		if err != nil {
+			r.sender.SendCard(ctx, chatID, CardMsg{Title: "备份失败", Content: err.Error(), Template: "red"})
+			return
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "**文件:** `%s`（%s）\n**目录:** %s\n", res.Name, formatSize(int64(res.Size)), r.backupDir)
+		if res.Removed > 0 {
+			fmt.Fprintf(&sb, "**轮换:** 删除了 %d 份旧备份（保留 %d 份）\n", res.Removed, r.backupKeep)
+		}
+		tpl := "green"
+		switch {
+		case res.UploadErr != nil:
+			fmt.Fprintf(&sb, "**上传失败:** %v\n", res.UploadErr)
+			tpl = "orange"
+		case res.Uploaded != "":
+			fmt.Fprintf(&sb, "**已上传:** %s\n", res.Uploaded)
+		}
+		fmt.Fprintf(&sb, "\n恢复: 停止 devbot 后运行 `devbot restore %s`", res.Name)
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "💾 已备份", Content: sb.String(), Template: tpl})
+	case "list":
+		backups, err := listBackups(r.backupDir)
+		if err != nil || len(backups) == 0 {
+			r.sender.SendText(ctx, chatID, "还没有备份。")
+			return
+		}
+		var sb strings.Builder
+		for _, b := range backups {
+			fmt.Fprintf(&sb, "- `%s`  %s\n", b.Name, formatSize(b.Size))
+		}
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("状态备份（%d）", len(backups)), Content: sb.String()})
+	default:
+		r.sender.SendText(ctx, chatID, usage)
+	}
+}
+
+// RestoreState replaces the state file at statePath with a backup: a path,
+// or the name of a backup in backupDir. The current state is kept next to
+// it as <state>.before-restore-<time>. With an empty backup it lists the
+// available backups.
+func RestoreState(statePath, backupDir, backup string, out io.Writer) error {
+	if backup == "" {
+		if backupDir == "" {
+			return errors.New("用法: devbot restore <备份文件>（未配置 backup_dir）")
+		}
+		backups, err := listBackups(backupDir)
+		if err != nil || len(backups) == 0 {
+			return fmt.Errorf("%s 中没有备份", backupDir)
+		}
+		fmt.Fprintf(out, "%s 中的备份（最新在前）:\n", backupDir)
+		for _, b := range backups {
+			fmt.Fprintf(out, "  %s  %s\n", b.Name, formatSize(b.Size))
+		}
+		fmt.Fprintln(out, "\n用法: devbot restore <备份>")
+		return nil
+	}
+	path := backup
+	if _, err := os.Stat(path); os.IsNotExist(err) && backupDir != "" && !strings.ContainsRune(backup, filepath.Separator) {
+		path = filepath.Join(backupDir, backup)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取备份: %w", err)
+	}
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		return fmt.Errorf("备份 %s 不是有效的状态文件: %w", path, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(statePath), 0755); err != nil {
+		return err
+	}
+	if current, err := os.ReadFile(statePath); err == nil {
+		aside := statePath + ".before-restore-" + time.Now().Format(backupTimeFormat)
+		if err := os.WriteFile(aside, current, 0600); err != nil {
+			return fmt.Errorf("保存当前状态文件: %w", err)
+		}
+		fmt.Fprintf(out, "当前状态文件已保存为 %s\n", aside)
+	}
+	if err := os.WriteFile(statePath+".tmp", data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(statePath+".tmp", statePath); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "已从 %s 恢复 %s（%d 个聊天，%d 条执行记录）。重新启动 devbot 生效。\n", path, statePath, len(st.Chats), len(st.Executions))
+	return nil
+}
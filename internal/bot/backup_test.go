@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The get-vanilla case of the AWS Signature Version 4 test suite.
+func TestSigV4Authorization(t *testing.T) {
+	u, _ := url.Parse("https://example.amazonaws.com/")
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	got := sigV4Authorization("GET", u, "example.amazonaws.com", [][2]string{{"x-amz-date", "20150830T123600Z"}},
+		sha256Hex(nil), "us-east-1", "service", "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", now)
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestRouterAdminBackup(t *testing.T) {
+	var gotPath, gotAuth string
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotPath, gotAuth = req.URL.Path, req.Header.Get("Authorization")
+		gotBody, _ = io.ReadAll(req.Body)
+	}))
+	defer srv.Close()
+	t.Setenv("DEVBOT_SECRET_BACKUP_S3_ACCESS_KEY", "AK")
+	t.Setenv("DEVBOT_SECRET_BACKUP_S3_SECRET_KEY", "SK")
+
+	r, sender := newTestRouter(t)
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "backups")
+	r.SetBackupConfig(dir, 24*time.Hour, 2, srv.URL+"/bucket/devbot/", "us-east-1")
+	r.store.SetDocBinding("/tmp/a.md", "doc1")
+
+	r.Route(ctx, "chat1", "user1", "/admin backup now")
+	if !strings.Contains(sender.LastMessage(), "仅限管理员") {
+		t.Fatalf("expected non-admins refused, got %q", sender.LastMessage())
+	}
+	r.SetAdmins(map[string]bool{"user1": true})
+	os.MkdirAll(dir, 0700)
+	for _, old := range []string{"state-20200101-000000.json", "state-20200102-000000.json", "notes.txt"} {
+		os.WriteFile(filepath.Join(dir, old), []byte("{}"), 0600)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/admin backup now")
+	msg := sender.LastMessage()
+	if !strings.Contains(msg, "已备份") || !strings.Contains(msg, "删除了 1 份旧备份") || !strings.Contains(msg, "已上传") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	backups, _ := listBackups(dir)
+	if len(backups) != 2 || backups[1].Name != "state-20200102-000000.json" {
+		t.Fatalf("expected the newest two backups kept, got %+v", backups)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Fatal("expected unrelated files left alone")
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, backups[0].Name))
+	if !strings.Contains(string(data), "doc1") || !bytes.Equal(gotBody, data) {
+		t.Fatalf("expected the state uploaded, got %q", gotBody)
+	}
+	if gotPath != "/bucket/devbot/"+backups[0].Name || !strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=AK/") {
+		t.Fatalf("unexpected upload %s %s", gotPath, gotAuth)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/admin backup list")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "状态备份（2）") {
+		t.Fatalf("unexpected list %q", msg)
+	}
+}
+
+func TestRestoreState(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := filepath.Join(dir, "backups")
+	os.MkdirAll(backupDir, 0700)
+	os.WriteFile(filepath.Join(backupDir, "state-20260101-000000.json"), []byte(`{"chats":{"c1":{"workDir":"/w"}},"docBindings":{}}`), 0600)
+	os.WriteFile(filepath.Join(backupDir, "broken.json"), []byte(`{"chats":`), 0600)
+	statePath := filepath.Join(dir, "state.json")
+	os.WriteFile(statePath, []byte(`{"chats":{}}`), 0644)
+
+	var out bytes.Buffer
+	if err := RestoreState(statePath, backupDir, "", &out); err != nil || !strings.Contains(out.String(), "state-20260101-000000.json") {
+		t.Fatalf("expected the backups listed, got %v %q", err, out.String())
+	}
+	if err := RestoreState(statePath, backupDir, "broken.json", &out); err == nil {
+		t.Fatal("expected an invalid backup rejected")
+	}
+	out.Reset()
+	if err := RestoreState(statePath, backupDir, "state-20260101-000000.json", &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "1 个聊天") {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+	store, err := NewStore(statePath)
+	if err != nil || store.GetSession("c1", "", "").WorkDir != "/w" {
+		t.Fatalf("expected the backup restored, got %v", err)
+	}
+	asides, _ := filepath.Glob(statePath + ".before-restore-*")
+	if len(asides) != 1 {
+		t.Fatalf("expected the previous state kept aside, got %v", asides)
+	}
+	if data, _ := os.ReadFile(asides[0]); string(data) != `{"chats":{}}` {
+		t.Fatalf("unexpected aside content %q", data)
+	}
+}
@@ -0,0 +1,223 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// buildTimeout bounds each target of /buildbin.
+	buildTimeout = 10 * time.Minute
+	// maxUploadSize is the largest file the chat accepts (Feishu: 30 MB).
+	maxUploadSize = 30 << 20
+)
+
+// SetBuildConfig sets the GOOS/GOARCH targets /buildbin builds by default
+// (e.g. "linux/amd64"; empty = the host platform) and the directory
+// binaries are copied to instead of being uploaded to the chat.
+func (r *Router) SetBuildConfig(targets []string, artifactDir string) {
+	r.buildTargets = targets
+	r.artifactDir = artifactDir
+}
+
+// validBuildTarget reports whether t has the form "goos/goarch".
+func validBuildTarget(t string) bool {
+	goos, goarch, ok := strings.Cut(t, "/")
+	return ok && goos != "" && goarch != "" && !strings.ContainsAny(goarch, "/ ")
+}
+
+// buildArtifact is one binary produced by /buildbin.
+type buildArtifact struct {
+	Target string
+	Name   string
+	Path   string
+	Size   int64
+	SHA256 string
+	Err    string // build error output, if the target failed
+}
+
+// goBinaryName returns the output file name for pkg in dir built for
+// target, e.g. "devbot-linux-amd64".
+func goBinaryName(dir, pkg, target string) string {
+	base := filepath.Base(filepath.Clean(filepath.Join(dir, pkg)))
+	goos, goarch, _ := strings.Cut(target, "/")
+	name := fmt.Sprintf("%s-%s-%s", base, goos, goarch)
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// goBuild builds pkg in dir for target into outDir.
+func goBuild(ctx context.Context, dir, pkg, target, outDir string) buildArtifact {
+	art := buildArtifact{Target: target, Name: goBinaryName(dir, pkg, target)}
+	art.Path = filepath.Join(outDir, art.Name)
+	goos, goarch, _ := strings.Cut(target, "/")
+
+	execCtx, cancel := context.WithTimeout(ctx, buildTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(execCtx, "go", "build", "-trimpath", "-o", art.Path, pkg)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch, "CGO_ENABLED=0")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		art.Err = strings.TrimSpace(cleanTerminal(out.String()))
+		if art.Err == "" {
+			art.Err = err.Error()
+		}
+		return art
+	}
+	data, err := os.ReadFile(art.Path)
+	if err != nil {
+		art.Err = err.Error()
+		return art
+	}
+	sum := sha256.Sum256(data)
+	art.Size = int64(len(data))
+	art.SHA256 = hex.EncodeToString(sum[:])
+	return art
+}
+
+// formatSize renders n bytes as B, KB, MB or GB.
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// parseBuildArgs splits "/buildbin" arguments into targets and the package
+// to build. "all" or no target selects the configured targets.
+func (r *Router) parseBuildArgs(args string) (targets []string, pkg string, ok bool) {
+	pkg = "."
+	for _, f := range strings.Fields(args) {
+		switch {
+		case f == "all":
+		case strings.HasPrefix(f, "./") || f == ".":
+			pkg = f
+		case validBuildTarget(f):
+			targets = append(targets, f)
+		default:
+			return nil, "", false
+		}
+	}
+	if len(targets) == 0 {
+		targets = r.buildTargets
+	}
+	if len(targets) == 0 {
+		targets = []string{runtime.GOOS + "/" + runtime.GOARCH}
+	}
+	return targets, pkg, true
+}
+
+func (r *Router) cmdBuildBin(ctx context.Context, chatID, args string) {
+	targets, pkg, ok := r.parseBuildArgs(args)
+	if !ok {
+		r.sender.SendText(ctx, chatID, "用法: /buildbin [目标|all] [./包路径]\n示例: /buildbin\n示例: /buildbin linux/arm64\n示例: /buildbin all ./cmd/server\n不指定目标时构建配置的 build_targets（默认本机平台）。")
+		return
+	}
+	session := r.getSession(chatID)
+	dir := session.WorkDir
+	if dir == "" {
+		dir = r.store.WorkRoot()
+	}
+	if !fileExists(filepath.Join(dir, "go.mod")) {
+		r.sender.SendText(ctx, chatID, "当前目录不是 Go 项目（未找到 go.mod），/buildbin 目前只支持 Go。")
+		return
+	}
+
+	outDir := r.artifactDir
+	if outDir == "" {
+		tmp, err := os.MkdirTemp("", "devbot-build-")
+		if err != nil {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("创建临时目录失败: %v", err))
+			return
+		}
+		defer os.RemoveAll(tmp)
+		outDir = tmp
+	} else {
+		// Keep the builds of different commits apart in the artifact store.
+		rev := shortHash(gitHead(dir))
+		if rev == "" {
+			rev = time.Now().Format("20060102-150405")
+		}
+		outDir = filepath.Join(outDir, filepath.Base(dir), rev)
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("创建产物目录失败: %v", err))
+			return
+		}
+	}
+
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("构建中（%s）...", strings.Join(targets, ", ")))
+	start := time.Now()
+	var arts []buildArtifact
+	for _, t := range targets {
+		arts = append(arts, goBuild(ctx, dir, pkg, t, outDir))
+	}
+
+	var sb strings.Builder
+	if head := gitHead(dir); head != "" {
+		fmt.Fprintf(&sb, "**提交:** `%s`\n", shortHash(head))
+	}
+	fmt.Fprintf(&sb, "**包:** `%s` · **耗时:** %s\n", pkg, time.Since(start).Truncate(time.Second))
+	failed := 0
+	for _, a := range arts {
+		if a.Err != "" {
+			failed++
+			fmt.Fprintf(&sb, "\n✗ **%s**\n```\n%s\n```\n", a.Target, truncateForDisplay(a.Err, 1500))
+			continue
+		}
+		fmt.Fprintf(&sb, "\n✓ **%s** `%s` %s\nsha256 `%s`\n", a.Target, a.Name, formatSize(a.Size), a.SHA256)
+		switch {
+		case r.artifactDir != "":
+			fmt.Fprintf(&sb, "已保存到 %s\n", a.Path)
+		case a.Size > r.fileLimit():
+			fmt.Fprintf(&sb, "超过 %s，无法上传到聊天；请配置 artifact_dir\n", formatSize(r.fileLimit()))
+		case a.Size > maxUploadSize:
+			fmt.Fprintf(&sb, "超过 %s，将上传到云空间\n", formatSize(maxUploadSize))
+		}
+	}
+
+	title, tpl := fmt.Sprintf("✓ 构建完成（%d 个目标）", len(arts)), "green"
+	if failed == len(arts) {
+		title, tpl = "构建失败", "red"
+	} else if failed > 0 {
+		title, tpl = fmt.Sprintf("构建部分失败（%d/%d）", failed, len(arts)), "orange"
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: strings.TrimSpace(sb.String()), Template: tpl})
+
+	if r.artifactDir != "" {
+		return
+	}
+	if _, ok := r.sender.(FileSender); !ok {
+		return
+	}
+	for _, a := range arts {
+		if a.Err != "" || a.Size > r.fileLimit() {
+			continue
+		}
+		data, err := os.ReadFile(a.Path)
+		if err == nil {
+			err = r.deliverFile(ctx, chatID, a.Name, data)
+		}
+		if err != nil {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("上传 %s 失败: %v", a.Name, err))
+		}
+	}
+}
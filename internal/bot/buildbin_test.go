@@ -0,0 +1,121 @@
+package bot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseBuildArgs(t *testing.T) {
+	r, _ := newTestRouter(t)
+	host := runtime.GOOS + "/" + runtime.GOARCH
+	if targets, pkg, ok := r.parseBuildArgs(""); !ok || len(targets) != 1 || targets[0] != host || pkg != "." {
+		t.Fatalf("expected host target by default, got %v %q %v", targets, pkg, ok)
+	}
+	r.SetBuildConfig([]string{"linux/amd64", "darwin/arm64"}, "")
+	if targets, _, _ := r.parseBuildArgs("all"); len(targets) != 2 {
+		t.Fatalf("expected configured targets, got %v", targets)
+	}
+	if targets, pkg, ok := r.parseBuildArgs("windows/amd64 ./cmd/app"); !ok || len(targets) != 1 || targets[0] != "windows/amd64" || pkg != "./cmd/app" {
+		t.Fatalf("unexpected parse: %v %q %v", targets, pkg, ok)
+	}
+	if _, _, ok := r.parseBuildArgs("linux"); ok {
+		t.Fatal("expected invalid target to be rejected")
+	}
+}
+
+func TestGoBinaryName(t *testing.T) {
+	if got := goBinaryName("/src/devbot", ".", "linux/amd64"); got != "devbot-linux-amd64" {
+		t.Fatalf("unexpected name %q", got)
+	}
+	if got := goBinaryName("/src/devbot", "./cmd/server", "windows/arm64"); got != "server-windows-arm64.exe" {
+		t.Fatalf("unexpected name %q", got)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for n, want := range map[int64]string{512: "512 B", 2048: "2.0 KB", 3 << 20: "3.0 MB"} {
+		if got := formatSize(n); got != want {
+			t.Errorf("formatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+// newBuildRouter returns a router whose chat1 works in a small Go module
+// named hello.
+func newBuildRouter(t *testing.T) (*Router, *fileSpySender, string) {
+	t.Helper()
+	r, _ := newTestRouter(t)
+	sender := &fileSpySender{}
+	r.sender = sender
+	dir := filepath.Join(t.TempDir(), "hello")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module hello\n\ngo 1.20\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() { println(\"hi\") }\n"), 0644)
+	r.getSession("chat1")
+	r.store.UpdateSession("chat1", func(s *Session) { s.WorkDir = dir })
+	return r, sender, dir
+}
+
+func TestRouterBuildBin_Uploads(t *testing.T) {
+	r, sender, _ := newBuildRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/buildbin")
+
+	name := "hello-" + runtime.GOOS + "-" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	data, ok := sender.files[name]
+	if !ok || len(data) == 0 {
+		t.Fatalf("expected %s to be uploaded, got %v (%v)", name, len(sender.files), sender.messages)
+	}
+	sum := sha256.Sum256(data)
+	var card string
+	for _, m := range sender.messages {
+		if strings.HasPrefix(m, "✓ 构建完成") {
+			card = m
+		}
+	}
+	if !strings.Contains(card, "`"+name+"` "+formatSize(int64(len(data)))) || !strings.Contains(card, hex.EncodeToString(sum[:])) {
+		t.Fatalf("expected size and checksum in card, got %q", card)
+	}
+}
+
+func TestRouterBuildBin_ArtifactDirAndFailure(t *testing.T) {
+	r, sender, dir := newBuildRouter(t)
+	store := t.TempDir()
+	r.SetBuildConfig(nil, store)
+	os.MkdirAll(filepath.Join(dir, "broken"), 0755)
+	os.WriteFile(filepath.Join(dir, "broken", "main.go"), []byte("package main\n\nfunc main() { undefined() }\n"), 0644)
+
+	r.Route(context.Background(), "chat1", "user1", "/buildbin ./broken")
+	if msg := sender.LastMessage(); !strings.HasPrefix(msg, "构建失败") || !strings.Contains(msg, "undefined") {
+		t.Fatalf("expected build failure card, got %q", msg)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/buildbin")
+	if len(sender.files) != 0 {
+		t.Fatalf("expected no uploads with an artifact store, got %v", len(sender.files))
+	}
+	matches, _ := filepath.Glob(filepath.Join(store, "hello", "*", "hello-*"))
+	if len(matches) != 1 || !strings.Contains(sender.LastMessage(), "已保存到 "+matches[0]) {
+		t.Fatalf("expected binary in artifact store, got %v, %q", matches, sender.LastMessage())
+	}
+}
+
+func TestRouterBuildBin_NotGo(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/buildbin")
+	if !strings.Contains(sender.LastMessage(), "未找到 go.mod") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/buildbin linux")
+	if !strings.HasPrefix(sender.LastMessage(), "用法:") {
+		t.Fatalf("expected usage, got %q", sender.LastMessage())
+	}
+}
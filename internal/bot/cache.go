@@ -0,0 +1,380 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Knowledge cache kinds. Kinds are free-form; these are the ones devbot
+// produces itself.
+const (
+	cacheRepoMap = "repomap"
+	cacheStats   = "stats"
+)
+
+// maxRepoMapEntries bounds the directories and files listed in a repo map.
+const maxRepoMapEntries = 40
+
+// maxCacheRepos bounds the repositories kept in the knowledge cache; the
+// least recently updated ones are evicted first.
+const maxCacheRepos = 50
+
+type cacheItem struct {
+	Value     string    `json:"value"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type cacheRepo struct {
+	Commit    string               `json:"commit"`
+	Items     map[string]cacheItem `json:"items"`
+	UpdatedAt time.Time            `json:"updatedAt"`
+}
+
+// CacheRepoStatus describes one repository's cached knowledge.
+type CacheRepoStatus struct {
+	Repo      string
+	Commit    string
+	Kinds     []string
+	Bytes     int
+	UpdatedAt time.Time
+}
+
+// KnowledgeCache stores knowledge derived from a repository (repo map,
+// stats, ...) keyed by repository root and commit. A repository's entries
+// are dropped as soon as its HEAD is seen at another commit, so cached
+// knowledge never outlives the code it describes. The cache is persisted
+// to path (if set) so it survives restarts; it is disposable, and an
+// unreadable file just starts an empty cache.
+type KnowledgeCache struct {
+	mu     sync.Mutex
+	path   string
+	repos  map[string]*cacheRepo
+	hits   int
+	misses int
+}
+
+func NewKnowledgeCache(path string) *KnowledgeCache {
+	c := &KnowledgeCache{path: path, repos: make(map[string]*cacheRepo)}
+	if path == "" {
+		return c
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("cache: read failed, starting empty", "path", path, "err", err)
+		}
+		return c
+	}
+	if err := json.Unmarshal(data, &c.repos); err != nil || c.repos == nil {
+		slog.Warn("cache: parse failed, starting empty", "path", path, "err", err)
+		c.repos = make(map[string]*cacheRepo)
+	}
+	return c
+}
+
+// Get returns the cached value of kind for repo at commit. Entries cached
+// for a different commit are invalidated.
+func (c *KnowledgeCache) Get(repo, commit, kind string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.observeLocked(repo, commit)
+	if e, ok := c.repos[repo]; ok {
+		if item, ok := e.Items[kind]; ok {
+			c.hits++
+			return item.Value, true
+		}
+	}
+	c.misses++
+	return "", false
+}
+
+// Put caches value as kind for repo at commit.
+func (c *KnowledgeCache) Put(repo, commit, kind, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.observeLocked(repo, commit)
+	now := time.Now()
+	e, ok := c.repos[repo]
+	if !ok {
+		e = &cacheRepo{Commit: commit, Items: make(map[string]cacheItem)}
+		c.repos[repo] = e
+	}
+	e.Items[kind] = cacheItem{Value: value, CreatedAt: now}
+	e.UpdatedAt = now
+	c.evictLocked()
+	c.saveLocked()
+}
+
+// Observe records that repo's HEAD is at commit, dropping its knowledge if
+// it was cached for another commit. It reports whether anything was dropped.
+func (c *KnowledgeCache) Observe(repo, commit string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.observeLocked(repo, commit) {
+		c.saveLocked()
+		return true
+	}
+	return false
+}
+
+func (c *KnowledgeCache) observeLocked(repo, commit string) bool {
+	if e, ok := c.repos[repo]; ok && e.Commit != commit {
+		delete(c.repos, repo)
+		slog.Info("cache: repo moved, invalidated", "repo", repo, "from", shortHash(e.Commit), "to", shortHash(commit))
+		return true
+	}
+	return false
+}
+
+// Clear drops the knowledge cached for repo, or for every repository when
+// repo is empty. It returns the number of repositories cleared.
+func (c *KnowledgeCache) Clear(repo string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	if repo == "" {
+		n = len(c.repos)
+		c.repos = make(map[string]*cacheRepo)
+	} else if _, ok := c.repos[repo]; ok {
+		delete(c.repos, repo)
+		n = 1
+	}
+	if n > 0 {
+		c.saveLocked()
+	}
+	return n
+}
+
+// Status lists the cached repositories, most recently updated first, with
+// the hit and miss counts since startup.
+func (c *KnowledgeCache) Status() (repos []CacheRepoStatus, hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for root, e := range c.repos {
+		st := CacheRepoStatus{Repo: root, Commit: e.Commit, UpdatedAt: e.UpdatedAt}
+		for kind, item := range e.Items {
+			st.Kinds = append(st.Kinds, kind)
+			st.Bytes += len(item.Value)
+		}
+		sort.Strings(st.Kinds)
+		repos = append(repos, st)
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].UpdatedAt.After(repos[j].UpdatedAt) })
+	return repos, c.hits, c.misses
+}
+
+func (c *KnowledgeCache) evictLocked() {
+	for len(c.repos) > maxCacheRepos {
+		var oldest string
+		for root, e := range c.repos {
+			if oldest == "" || e.UpdatedAt.Before(c.repos[oldest].UpdatedAt) {
+				oldest = root
+			}
+		}
+		delete(c.repos, oldest)
+	}
+}
+
+// saveLocked writes the cache to disk. Failures are logged, not returned:
+// losing the cache only costs a rebuild.
+func (c *KnowledgeCache) saveLocked() {
+	if c.path == "" {
+		return
+	}
+	data, err := json.Marshal(c.repos)
+	if err != nil {
+		slog.Warn("cache: marshal failed", "err", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		slog.Warn("cache: save failed", "err", err)
+		return
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		slog.Warn("cache: write failed", "path", c.path, "err", err)
+		return
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		slog.Warn("cache: write failed", "path", c.path, "err", err)
+	}
+}
+
+func (r *Router) SetKnowledgeCache(c *KnowledgeCache) {
+	r.cache = c
+}
+
+// repoState returns the git repository root containing workDir and its
+// HEAD commit.
+func repoState(workDir string) (root, head string, ok bool) {
+	if workDir == "" {
+		return "", "", false
+	}
+	out, err := runGitOutput(workDir, "rev-parse", "--show-toplevel", "HEAD")
+	if err != nil {
+		return "", "", false
+	}
+	lines := strings.Split(out, "\n")
+	if len(lines) != 2 {
+		return "", "", false
+	}
+	return lines[0], lines[1], true
+}
+
+// cachedKnowledge returns kind for the repository containing workDir,
+// building and caching it on a miss. ok is false when there is no cache or
+// workDir is not in a git repository with commits.
+func (r *Router) cachedKnowledge(workDir, kind string, build func(root string) (string, bool)) (string, bool) {
+	if r.cache == nil {
+		return "", false
+	}
+	root, head, ok := repoState(workDir)
+	if !ok {
+		return "", false
+	}
+	if v, ok := r.cache.Get(root, head, kind); ok {
+		return v, true
+	}
+	v, ok := build(root)
+	if !ok {
+		return "", false
+	}
+	r.cache.Put(root, head, kind, v)
+	return v, true
+}
+
+// observeHead invalidates the cached knowledge for workDir's repository if
+// its HEAD moved (e.g. Claude committed during an execution).
+func (r *Router) observeHead(workDir string) {
+	if r.cache == nil {
+		return
+	}
+	if root, head, ok := repoState(workDir); ok {
+		r.cache.Observe(root, head)
+	}
+}
+
+// buildRepoMap summarizes the tracked files of the repository at root: the
+// top-level directories with their file counts, and the top-level files.
+func buildRepoMap(root string) (string, bool) {
+	out, err := runGitOutput(root, "ls-files")
+	if err != nil || out == "" {
+		return "", false
+	}
+	dirs := make(map[string]int)
+	var files []string
+	total := 0
+	for _, f := range strings.Split(out, "\n") {
+		total++
+		if i := strings.IndexByte(f, '/'); i >= 0 {
+			dirs[f[:i]]++
+		} else {
+			files = append(files, f)
+		}
+	}
+	names := make([]string, 0, len(dirs))
+	for d := range dirs {
+		names = append(names, d)
+	}
+	sort.Strings(names)
+	sort.Strings(files)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "共 %d 个受版本控制的文件。\n", total)
+	n := 0
+	for _, d := range names {
+		if n == maxRepoMapEntries {
+			break
+		}
+		fmt.Fprintf(&sb, "- %s/ (%d 个文件)\n", d, dirs[d])
+		n++
+	}
+	for _, f := range files {
+		if n == maxRepoMapEntries {
+			break
+		}
+		fmt.Fprintf(&sb, "- %s\n", f)
+		n++
+	}
+	if rest := len(names) + len(files) - n; rest > 0 {
+		fmt.Fprintf(&sb, "- …（还有 %d 项）\n", rest)
+	}
+	return strings.TrimRight(sb.String(), "\n"), true
+}
+
+// withRepoContext prepends the cached repo map and the Feishu doc bindings
+// inside the repository to the first prompt of a new Claude session, so
+// Claude does not have to rediscover the layout.
+func (r *Router) withRepoContext(workDir, prompt string) string {
+	repoMap, ok := r.cachedKnowledge(workDir, cacheRepoMap, buildRepoMap)
+	if !ok {
+		return prompt
+	}
+	root, _, _ := repoState(workDir)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[devbot 项目上下文]\n仓库: %s\n%s\n", root, repoMap)
+	var links []string
+	for path, docID := range r.store.DocBindings() {
+		if underRoot(root, path) {
+			rel, _ := filepath.Rel(root, path)
+			links = append(links, fmt.Sprintf("- %s ↔ 飞书文档 %s", rel, docID))
+		}
+	}
+	if len(links) > 0 {
+		sort.Strings(links)
+		sb.WriteString("已绑定的飞书文档:\n")
+		sb.WriteString(strings.Join(links, "\n"))
+		sb.WriteString("\n")
+	}
+	sb.WriteString("[/devbot 项目上下文]\n\n")
+	sb.WriteString(prompt)
+	return sb.String()
+}
+
+func (r *Router) cmdCache(ctx context.Context, chatID, args string) {
+	if r.cache == nil {
+		r.sender.SendText(ctx, chatID, "知识缓存未启用。")
+		return
+	}
+	session := r.getSession(chatID)
+	root, _, inRepo := repoState(session.WorkDir)
+
+	switch args {
+	case "", "status":
+		repos, hits, misses := r.cache.Status()
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "**命中/未命中:** %d / %d\n**已缓存仓库:** %d\n", hits, misses, len(repos))
+		for _, st := range repos {
+			mark := ""
+			if inRepo && st.Repo == root {
+				mark = " ←"
+			}
+			fmt.Fprintf(&sb, "\n`%s`%s\n提交 `%s` · %s · %d 字节 · 更新于 %s\n",
+				st.Repo, mark, shortHash(st.Commit), strings.Join(st.Kinds, ", "), st.Bytes, st.UpdatedAt.Format("01-02 15:04"))
+		}
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "知识缓存", Content: sb.String()})
+	case "clear":
+		if !inRepo {
+			r.sender.SendText(ctx, chatID, "当前目录不是 git 仓库。使用 `/cache clear all` 清空全部缓存。")
+			return
+		}
+		if r.cache.Clear(root) == 0 {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("%s 没有缓存。", root))
+			return
+		}
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已清除 %s 的缓存", root))
+	case "clear all":
+		n := r.cache.Clear("")
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已清除全部缓存（%d 个仓库）", n))
+	default:
+		r.sender.SendText(ctx, chatID, "用法: /cache [status]  查看知识缓存\n/cache clear  清除当前仓库的缓存\n/cache clear all  清空全部缓存")
+	}
+}
@@ -0,0 +1,274 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// initTestRepo creates a git repository in dir with files committed.
+func initTestRepo(t *testing.T, dir string, files map[string]string) func(args ...string) {
+	t.Helper()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=t", "-c", "user.email=t@t"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	os.MkdirAll(dir, 0755)
+	git("init")
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+	git("add", ".")
+	git("commit", "-m", "init")
+	return git
+}
+
+func TestKnowledgeCache_InvalidatesOnNewCommit(t *testing.T) {
+	c := NewKnowledgeCache("")
+	c.Put("/repo", "c1", cacheRepoMap, "map v1")
+	if v, ok := c.Get("/repo", "c1", cacheRepoMap); !ok || v != "map v1" {
+		t.Fatalf("expected hit, got %q, %v", v, ok)
+	}
+	if _, ok := c.Get("/repo", "c1", cacheStats); ok {
+		t.Fatal("expected miss for uncached kind")
+	}
+	if _, ok := c.Get("/repo", "c2", cacheRepoMap); ok {
+		t.Fatal("expected miss after HEAD moved")
+	}
+	if _, ok := c.Get("/repo", "c1", cacheRepoMap); ok {
+		t.Fatal("expected entry for old commit to be dropped")
+	}
+	if _, hits, misses := c.Status(); hits != 1 || misses != 3 {
+		t.Fatalf("expected 1 hit / 3 misses, got %d / %d", hits, misses)
+	}
+
+	c.Put("/repo", "c2", cacheRepoMap, "map v2")
+	if c.Observe("/repo", "c2") {
+		t.Fatal("expected no invalidation for the same commit")
+	}
+	if !c.Observe("/repo", "c3") {
+		t.Fatal("expected invalidation for a new commit")
+	}
+}
+
+func TestKnowledgeCache_PersistsAndClears(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "knowledge-cache.json")
+	c := NewKnowledgeCache(path)
+	c.Put("/a", "c1", cacheRepoMap, "map a")
+	c.Put("/b", "c1", cacheStats, "stats b")
+
+	reloaded := NewKnowledgeCache(path)
+	if v, ok := reloaded.Get("/a", "c1", cacheRepoMap); !ok || v != "map a" {
+		t.Fatalf("expected cache to survive reload, got %q, %v", v, ok)
+	}
+	repos, _, _ := reloaded.Status()
+	if len(repos) != 2 {
+		t.Fatalf("expected 2 repos, got %+v", repos)
+	}
+
+	if n := reloaded.Clear("/a"); n != 1 {
+		t.Fatalf("expected 1 repo cleared, got %d", n)
+	}
+	if n := reloaded.Clear("/a"); n != 0 {
+		t.Fatalf("expected nothing left to clear, got %d", n)
+	}
+	if n := reloaded.Clear(""); n != 1 {
+		t.Fatalf("expected clear all to drop 1 repo, got %d", n)
+	}
+	if repos, _, _ := NewKnowledgeCache(path).Status(); len(repos) != 0 {
+		t.Fatalf("expected cleared cache to be persisted, got %+v", repos)
+	}
+}
+
+func TestKnowledgeCache_CorruptFileStartsEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "knowledge-cache.json")
+	os.WriteFile(path, []byte("{not json"), 0644)
+	c := NewKnowledgeCache(path)
+	if repos, _, _ := c.Status(); len(repos) != 0 {
+		t.Fatalf("expected empty cache, got %+v", repos)
+	}
+	c.Put("/a", "c1", cacheRepoMap, "x")
+	if _, ok := NewKnowledgeCache(path).Get("/a", "c1", cacheRepoMap); !ok {
+		t.Fatal("expected corrupt file to be overwritten")
+	}
+}
+
+func TestKnowledgeCache_EvictsLeastRecentlyUpdated(t *testing.T) {
+	c := NewKnowledgeCache("")
+	for i := 0; i <= maxCacheRepos; i++ {
+		c.Put(fmt.Sprintf("/repo%d", i), "c1", cacheRepoMap, "x")
+		time.Sleep(time.Millisecond)
+	}
+	repos, _, _ := c.Status()
+	if len(repos) != maxCacheRepos {
+		t.Fatalf("expected %d repos, got %d", maxCacheRepos, len(repos))
+	}
+	if _, ok := c.Get("/repo0", "c1", cacheRepoMap); ok {
+		t.Fatal("expected the oldest repo to be evicted")
+	}
+}
+
+func TestBuildRepoMap(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "repo")
+	initTestRepo(t, dir, map[string]string{
+		"go.mod":              "module x",
+		"main.go":             "package main",
+		"internal/a/a.go":     "package a",
+		"internal/b/b.go":     "package b",
+		"docs/guide/intro.md": "# hi",
+	})
+	got, ok := buildRepoMap(dir)
+	want := "共 5 个受版本控制的文件。\n- docs/ (1 个文件)\n- internal/ (2 个文件)\n- go.mod\n- main.go"
+	if !ok || got != want {
+		t.Fatalf("buildRepoMap = %q, %v; want %q", got, ok, want)
+	}
+	if _, ok := buildRepoMap(t.TempDir()); ok {
+		t.Fatal("expected no repo map outside a git repository")
+	}
+}
+
+// newCacheRouter returns a router with a knowledge cache whose claude
+// script logs each prompt and echoes a fixed result.
+func newCacheRouter(t *testing.T) (*Router, *spySender, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "repo")
+	initTestRepo(t, repo, map[string]string{"main.go": "package main\n", "pkg/util.go": "package pkg\n"})
+
+	prompts := filepath.Join(dir, "prompts")
+	claude := filepath.Join(dir, "claude")
+	os.WriteFile(claude, []byte(fmt.Sprintf(`#!/bin/sh
+printf '%%s\n---END---\n' "$* $(cat)" >> %s
+echo '{"type":"result","result":"ok","session_id":"s1"}'
+`, prompts)), 0755)
+
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	sender := &spySender{}
+	r := NewRouter(context.Background(), NewClaudeExecutor(claude, "sonnet", 10*time.Second), store, sender, map[string]bool{"user1": true}, dir, nil)
+	r.SetKnowledgeCache(NewKnowledgeCache(filepath.Join(dir, "knowledge-cache.json")))
+	r.getSession("chat1")
+	r.store.UpdateSession("chat1", func(s *Session) { s.WorkDir = repo })
+	return r, sender, repo, prompts
+}
+
+func TestRouterExecClaude_NewSessionGetsRepoContext(t *testing.T) {
+	r, _, repo, prompts := newCacheRouter(t)
+	r.store.SetDocBinding(filepath.Join(repo, "README.md"), "doccn123")
+
+	r.Route(context.Background(), "chat1", "user1", "fix the bug")
+	r.Route(context.Background(), "chat1", "user1", "and add a test")
+
+	logged, _ := os.ReadFile(prompts)
+	runs := strings.Split(strings.TrimSuffix(string(logged), "---END---\n"), "---END---\n")
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 runs, got %q", logged)
+	}
+	for _, want := range []string{"[devbot 项目上下文]", "- pkg/ (1 个文件)", "- main.go", "README.md ↔ 飞书文档 doccn123", "fix the bug"} {
+		if !strings.Contains(runs[0], want) {
+			t.Errorf("expected first prompt to contain %q, got %q", want, runs[0])
+		}
+	}
+	if strings.Contains(runs[1], "[devbot 项目上下文]") || !strings.Contains(runs[1], "--resume s1") {
+		t.Errorf("expected resumed prompt without repo context, got %q", runs[1])
+	}
+	if recs := r.store.ExecRecords("chat1", 0); recs[len(recs)-1].Prompt != "fix the bug" {
+		t.Errorf("expected the record to keep the user's prompt, got %q", recs[len(recs)-1].Prompt)
+	}
+	if _, hits, misses := r.cache.Status(); hits != 0 || misses != 1 {
+		t.Errorf("expected one repo map build, got %d hits / %d misses", hits, misses)
+	}
+}
+
+func TestRouterExecClaude_InvalidatesCacheWhenHeadMoves(t *testing.T) {
+	r, _, repo, _ := newCacheRouter(t)
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=t", "-c", "user.email=t@t"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	r.Route(context.Background(), "chat1", "user1", "look around")
+	if repos, _, _ := r.cache.Status(); len(repos) != 1 {
+		t.Fatalf("expected repo map to be cached, got %+v", repos)
+	}
+
+	os.WriteFile(filepath.Join(repo, "new.go"), []byte("package main\n"), 0644)
+	git("add", ".")
+	git("commit", "-m", "new")
+	r.observeHead(repo)
+	if repos, _, _ := r.cache.Status(); len(repos) != 0 {
+		t.Fatalf("expected cache to be invalidated after commit, got %+v", repos)
+	}
+}
+
+func TestRouterStats_CachedForCleanCheckout(t *testing.T) {
+	r, sender, repo, _ := newCacheRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/stats")
+	first := sender.LastMessage()
+	r.Route(context.Background(), "chat1", "user1", "/stats")
+	if sender.LastMessage() != first {
+		t.Fatalf("expected identical stats, got %q vs %q", sender.LastMessage(), first)
+	}
+	if _, hits, _ := r.cache.Status(); hits != 1 {
+		t.Fatalf("expected second /stats to hit the cache, got %d hits", hits)
+	}
+	if !strings.Contains(first, "**最近提交:**") || !strings.Contains(first, ".go") {
+		t.Fatalf("unexpected stats card %q", first)
+	}
+
+	// A dirty tree is counted fresh.
+	os.WriteFile(filepath.Join(repo, "extra.py"), []byte("print(1)\n"), 0644)
+	r.Route(context.Background(), "chat1", "user1", "/stats")
+	if !strings.Contains(sender.LastMessage(), ".py") {
+		t.Fatalf("expected uncommitted file in stats, got %q", sender.LastMessage())
+	}
+	if _, hits, _ := r.cache.Status(); hits != 1 {
+		t.Fatalf("expected dirty tree to bypass the cache, got %d hits", hits)
+	}
+}
+
+func TestRouterCacheCommand(t *testing.T) {
+	r, sender, repo, _ := newCacheRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/stats")
+
+	r.Route(context.Background(), "chat1", "user1", "/cache")
+	msg := sender.LastMessage()
+	if !strings.HasPrefix(msg, "知识缓存") || !strings.Contains(msg, repo+"` ←") || !strings.Contains(msg, "stats") {
+		t.Fatalf("unexpected cache status %q", msg)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/cache clear")
+	if sender.LastMessage() != "✓ 已清除 "+repo+" 的缓存" {
+		t.Fatalf("unexpected clear reply %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/cache clear")
+	if !strings.Contains(sender.LastMessage(), "没有缓存") {
+		t.Fatalf("expected nothing to clear, got %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/cache clear all")
+	if sender.LastMessage() != "✓ 已清除全部缓存（0 个仓库）" {
+		t.Fatalf("unexpected clear all reply %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/cache bogus")
+	if !strings.Contains(sender.LastMessage(), "用法: /cache") {
+		t.Fatalf("expected usage, got %q", sender.LastMessage())
+	}
+}
+
+func TestRouterCacheCommand_Disabled(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/cache")
+	if sender.LastMessage() != "知识缓存未启用。" {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+}
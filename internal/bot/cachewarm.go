@@ -0,0 +1,212 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// cacheWarmTimeout bounds warming one repository.
+	cacheWarmTimeout = 10 * time.Minute
+	// cacheWarmLookback is how far back executions count towards a
+	// repository being frequently used.
+	cacheWarmLookback = 7 * 24 * time.Hour
+)
+
+// buildCacheStats counts build cache warm-ups and how often /test found
+// packages cached. Guarded by Router.mu.
+type buildCacheStats struct {
+	warmRuns     int
+	warmFailures int
+	lastWarm     time.Time
+	lastRepos    []string
+	// fingerprints are the trees last warmed, by repository, so unchanged
+	// repositories are not warmed again.
+	fingerprints map[string]string
+
+	testPkgs   int
+	testCached int
+}
+
+// SetCacheWarming makes StartCacheWarming warm the Go build and test caches
+// of the `repos` most used repositories every interval while the bot is idle
+// (interval <= 0 disables it).
+func (r *Router) SetCacheWarming(interval time.Duration, repos int) {
+	r.cacheWarmInterval = interval
+	r.cacheWarmRepos = repos
+}
+
+// StartCacheWarming warms caches on every tick of the configured interval
+// until ctx is done, skipping ticks while anything is running or queued.
+func (r *Router) StartCacheWarming(ctx context.Context) {
+	if r.cacheWarmInterval <= 0 || r.cacheWarmRepos <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(r.cacheWarmInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if !r.idle() {
+				continue
+			}
+			r.warmCaches(ctx)
+		}
+	}()
+}
+
+// idle reports whether no execution is running or waiting.
+func (r *Router) idle() bool {
+	if len(r.ActiveExecs()) > 0 {
+		return false
+	}
+	if r.queue != nil {
+		if running, waiting, _ := r.queue.PoolStats(); running+waiting > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// frequentGoRepos returns the Go repositories executions ran in most over
+// the last week, most used first, at most n.
+func (r *Router) frequentGoRepos(n int) []string {
+	counts := make(map[string]int)
+	since := time.Now().Add(-cacheWarmLookback)
+	for _, rec := range r.store.ExecRecords("", 0) {
+		if rec.StartedAt.Before(since) {
+			break
+		}
+		if rec.WorkDir == "" {
+			continue
+		}
+		counts[repoRoot(rec.WorkDir)]++
+	}
+	var repos []string
+	for repo := range counts {
+		if fileExists(filepath.Join(repo, "go.mod")) {
+			repos = append(repos, repo)
+		}
+	}
+	sort.Slice(repos, func(i, j int) bool {
+		if counts[repos[i]] != counts[repos[j]] {
+			return counts[repos[i]] > counts[repos[j]]
+		}
+		return repos[i] < repos[j]
+	})
+	if len(repos) > n {
+		repos = repos[:n]
+	}
+	return repos
+}
+
+// warmCaches runs `go build ./...` and `go test -run ^$ ./...` in each
+// frequently used repository whose tree changed since it was last warmed,
+// so the next interactive build or /test finds its packages compiled.
+func (r *Router) warmCaches(ctx context.Context) {
+	var warmed []string
+	for _, repo := range r.frequentGoRepos(r.cacheWarmRepos) {
+		fp := treeFingerprint(repo)
+		r.mu.Lock()
+		unchanged := fp != "" && r.buildCache.fingerprints[repo] == fp
+		r.mu.Unlock()
+		if unchanged || !r.idle() {
+			continue
+		}
+
+		err := warmGoCache(ctx, repo)
+		r.mu.Lock()
+		r.buildCache.warmRuns++
+		if err != nil {
+			r.buildCache.warmFailures++
+		} else {
+			if r.buildCache.fingerprints == nil {
+				r.buildCache.fingerprints = make(map[string]string)
+			}
+			r.buildCache.fingerprints[repo] = fp
+		}
+		r.mu.Unlock()
+		if err != nil {
+			slog.Warn("cache warm: failed", "repo", repo, "err", err)
+			continue
+		}
+		warmed = append(warmed, filepath.Base(repo))
+	}
+	if len(warmed) > 0 {
+		r.mu.Lock()
+		r.buildCache.lastWarm = time.Now()
+		r.buildCache.lastRepos = warmed
+		r.mu.Unlock()
+		slog.Info("cache warm: warmed", "repos", warmed)
+	}
+}
+
+// warmGoCache compiles the packages and test binaries of the module at
+// repo without running any test.
+func warmGoCache(ctx context.Context, repo string) error {
+	ctx, cancel := context.WithTimeout(ctx, cacheWarmTimeout)
+	defer cancel()
+	for _, args := range [][]string{{"build", "./..."}, {"test", "-run", "^$", "./..."}} {
+		cmd := exec.CommandContext(ctx, "go", args...)
+		cmd.Dir = repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("go %s: %v: %s", strings.Join(args, " "), err, truncateRunes(strings.TrimSpace(string(out)), 200))
+		}
+	}
+	return nil
+}
+
+// recordTestCache counts the packages of a /test run's output and how many
+// of them were cached.
+func (r *Router) recordTestCache(output string) {
+	pkgs, cached := 0, 0
+	for _, res := range parseGoTestSummary(output) {
+		if res.status == "?" {
+			continue
+		}
+		pkgs++
+		if res.cached {
+			cached++
+		}
+	}
+	r.mu.Lock()
+	r.buildCache.testPkgs += pkgs
+	r.buildCache.testCached += cached
+	r.mu.Unlock()
+}
+
+// cacheStatusLine summarizes build cache warming and /test cache hits for
+// /status, or "" when there is nothing to report.
+func (r *Router) cacheStatusLine() string {
+	r.mu.Lock()
+	st := r.buildCache
+	r.mu.Unlock()
+	if r.cacheWarmInterval <= 0 && st.testPkgs == 0 {
+		return ""
+	}
+	var parts []string
+	if r.cacheWarmInterval > 0 {
+		warm := fmt.Sprintf("预热 %d 次", st.warmRuns)
+		if st.warmFailures > 0 {
+			warm += fmt.Sprintf("（失败 %d）", st.warmFailures)
+		}
+		if !st.lastWarm.IsZero() {
+			warm += fmt.Sprintf("，上次 %s: %s", st.lastWarm.Format("01-02 15:04"), strings.Join(st.lastRepos, ", "))
+		}
+		parts = append(parts, warm)
+	}
+	if st.testPkgs > 0 {
+		parts = append(parts, fmt.Sprintf("/test 缓存命中 %d/%d 个包（%d%%）", st.testCached, st.testPkgs, st.testCached*100/st.testPkgs))
+	}
+	return strings.Join(parts, "；")
+}
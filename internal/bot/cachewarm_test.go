@@ -0,0 +1,55 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFrequentGoRepos(t *testing.T) {
+	r, _ := newTestRouter(t)
+	root := r.store.WorkRoot()
+	for _, name := range []string{"project1", "project2"} {
+		os.WriteFile(filepath.Join(root, name, "go.mod"), []byte("module "+name+"\n"), 0644)
+	}
+	now := time.Now()
+	for i, dir := range []string{"project2", "project1", "project2", "README.md", "project1"} {
+		rec := ExecRecord{ID: newExecID(), ChatID: "chat1", WorkDir: filepath.Join(root, dir), StartedAt: now.Add(time.Duration(i) * time.Minute)}
+		if i == 0 {
+			rec.StartedAt = now.Add(-8 * 24 * time.Hour) // too old to count
+		}
+		r.store.AddExecRecord(rec)
+	}
+	got := r.frequentGoRepos(1)
+	if len(got) != 1 || got[0] != filepath.Join(root, "project1") {
+		t.Fatalf("frequentGoRepos = %v", got)
+	}
+}
+
+func TestWarmCaches(t *testing.T) {
+	r, sender := newTestRouter(t)
+	repo := filepath.Join(r.store.WorkRoot(), "project1")
+	os.WriteFile(filepath.Join(repo, "go.mod"), []byte("module warm\n\ngo 1.21\n"), 0644)
+	os.WriteFile(filepath.Join(repo, "a_test.go"), []byte("package warm\n\nimport \"testing\"\n\nfunc TestA(t *testing.T) {}\n"), 0644)
+	initGitRepo(t, repo)
+	runGitOutput(repo, "add", "-A")
+	runGitOutput(repo, "commit", "-qm", "init")
+	r.store.AddExecRecord(ExecRecord{ID: newExecID(), ChatID: "chat1", WorkDir: repo, StartedAt: time.Now()})
+	r.SetCacheWarming(time.Hour, 3)
+
+	r.warmCaches(context.Background())
+	r.warmCaches(context.Background()) // unchanged tree: skipped
+	if r.buildCache.warmRuns != 1 || r.buildCache.warmFailures != 0 {
+		t.Fatalf("warm runs = %d, failures = %d", r.buildCache.warmRuns, r.buildCache.warmFailures)
+	}
+
+	r.recordTestCache("ok  \twarm\t(cached)\nok  \twarm/b\t0.2s\n?   \twarm/c\t[no test files]")
+	r.Route(context.Background(), "chat1", "user1", "/status")
+	msg := sender.LastMessage()
+	if !strings.Contains(msg, "预热 1 次，上次") || !strings.Contains(msg, "project1") || !strings.Contains(msg, "缓存命中 1/2 个包（50%）") {
+		t.Fatalf("status = %q", msg)
+	}
+}
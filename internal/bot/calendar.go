@@ -0,0 +1,78 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	lark "github.com/larksuite/oapi-sdk-go/v3"
+	larkcalendar "github.com/larksuite/oapi-sdk-go/v3/service/calendar/v4"
+)
+
+// CalendarEvent is an event /remind puts on the shared calendar.
+type CalendarEvent struct {
+	Summary     string
+	Description string
+	Start       time.Time
+	End         time.Time
+}
+
+// Calendar creates and deletes events on a calendar. It abstracts the
+// Feishu calendar API so that tests can use a fake implementation.
+type Calendar interface {
+	CreateEvent(ctx context.Context, calendarID string, ev CalendarEvent) (eventID string, err error)
+	DeleteEvent(ctx context.Context, calendarID, eventID string) error
+}
+
+// LarkCalendar implements Calendar using the Feishu calendar API.
+type LarkCalendar struct {
+	client *lark.Client
+}
+
+func NewLarkCalendar(client *lark.Client) *LarkCalendar {
+	return &LarkCalendar{client: client}
+}
+
+// CreateEvent creates ev with a notification at its start and returns the
+// event's ID.
+func (c *LarkCalendar) CreateEvent(ctx context.Context, calendarID string, ev CalendarEvent) (string, error) {
+	timeInfo := func(t time.Time) *larkcalendar.TimeInfo {
+		return larkcalendar.NewTimeInfoBuilder().Timestamp(strconv.FormatInt(t.Unix(), 10)).Build()
+	}
+	req := larkcalendar.NewCreateCalendarEventReqBuilder().
+		CalendarId(calendarID).
+		CalendarEvent(larkcalendar.NewCalendarEventBuilder().
+			Summary(ev.Summary).
+			Description(ev.Description).
+			NeedNotification(true).
+			StartTime(timeInfo(ev.Start)).
+			EndTime(timeInfo(ev.End)).
+			Reminders([]*larkcalendar.Reminder{larkcalendar.NewReminderBuilder().Minutes(0).Build()}).
+			Build()).
+		Build()
+	resp, err := c.client.Calendar.CalendarEvent.Create(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("lark API error: %w", err)
+	}
+	if !resp.Success() || resp.Data == nil || resp.Data.Event == nil || resp.Data.Event.EventId == nil {
+		return "", fmt.Errorf("lark API failed: code=%d msg=%s", resp.Code, resp.Msg)
+	}
+	return *resp.Data.Event.EventId, nil
+}
+
+// DeleteEvent deletes an event created by CreateEvent.
+func (c *LarkCalendar) DeleteEvent(ctx context.Context, calendarID, eventID string) error {
+	req := larkcalendar.NewDeleteCalendarEventReqBuilder().
+		CalendarId(calendarID).
+		EventId(eventID).
+		Build()
+	resp, err := c.client.Calendar.CalendarEvent.Delete(ctx, req)
+	if err != nil {
+		return fmt.Errorf("lark API error: %w", err)
+	}
+	if !resp.Success() {
+		return fmt.Errorf("lark API failed: code=%d msg=%s", resp.Code, resp.Msg)
+	}
+	return nil
+}
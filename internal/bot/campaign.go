@@ -0,0 +1,351 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Campaign repository states.
+const (
+	campaignPending     = "pending"
+	campaignPR          = "pr"           // bumped, tested and PR opened
+	campaignTestsFailed = "tests_failed" // bumped on a local branch, tests fail
+	campaignFailed      = "failed"
+	campaignSkipped     = "skipped" // left alone, e.g. uncommitted changes
+	campaignCurrent     = "current" // already on the target version
+)
+
+// campaignStepTimeout bounds each step (bump, tests, push, PR) per repo.
+const campaignStepTimeout = 10 * time.Minute
+
+// maxCampaignDepth bounds how deep under the work root repositories are
+// looked for.
+const maxCampaignDepth = 3
+
+var campaignIcons = map[string]string{
+	campaignPending:     "⏳",
+	campaignPR:          "✅",
+	campaignTestsFailed: "❌",
+	campaignFailed:      "❌",
+	campaignSkipped:     "⚠️",
+	campaignCurrent:     "➖",
+}
+
+var campaignLabels = map[string]string{
+	campaignPending:     "等待中",
+	campaignPR:          "PR 已创建",
+	campaignTestsFailed: "测试失败（分支仅在本地）",
+	campaignFailed:      "失败",
+	campaignSkipped:     "已跳过",
+	campaignCurrent:     "已是目标版本",
+}
+
+// bumpDependency upgrades module to version in the project in dir using
+// the ecosystem's own tooling. It is a variable so tests can avoid the
+// network.
+var bumpDependency = func(ctx context.Context, dir, eco, module, version string) (string, error) {
+	var steps [][]string
+	switch eco {
+	case "go":
+		steps = [][]string{{"go", "get", module + "@" + version}, {"go", "mod", "tidy"}}
+	case "npm":
+		steps = [][]string{{"npm", "install", module + "@" + version}}
+	default:
+		return "", fmt.Errorf("不支持的项目类型: %s", eco)
+	}
+	var all strings.Builder
+	for _, argv := range steps {
+		out, err := runInDir(ctx, dir, campaignStepTimeout, argv...)
+		all.WriteString(out)
+		if err != nil {
+			return all.String(), fmt.Errorf("%s: %w", strings.Join(argv, " "), err)
+		}
+	}
+	return all.String(), nil
+}
+
+// goModVersion returns the version of module required by a go.mod file.
+func goModVersion(data []byte, module string) (string, bool) {
+	inBlock := false
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case inBlock && fields[0] == ")":
+			inBlock = false
+		case fields[0] == "require" && len(fields) == 2 && fields[1] == "(":
+			inBlock = true
+		case inBlock && len(fields) >= 2 && fields[0] == module:
+			return fields[1], true
+		case fields[0] == "require" && len(fields) >= 3 && fields[1] == module:
+			return fields[2], true
+		}
+	}
+	return "", false
+}
+
+// dependencyVersion reports which ecosystem of the project in dir depends
+// on module, and at which version, from go.mod or package.json.
+func dependencyVersion(dir, module string) (eco, version string, ok bool) {
+	if data, err := os.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+		if v, ok := goModVersion(data, module); ok {
+			return "go", v, true
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "package.json")); err == nil {
+		var pkg struct {
+			Dependencies    map[string]string `json:"dependencies"`
+			DevDependencies map[string]string `json:"devDependencies"`
+		}
+		if json.Unmarshal(data, &pkg) == nil {
+			if v, ok := pkg.Dependencies[module]; ok {
+				return "npm", v, true
+			}
+			if v, ok := pkg.DevDependencies[module]; ok {
+				return "npm", v, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// campaignRepos returns the git repositories under root, up to
+// maxCampaignDepth levels down, skipping hidden and vendored directories.
+func campaignRepos(root string) []string {
+	var repos []string
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() || path == root {
+			return nil
+		}
+		name := info.Name()
+		if strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor" {
+			return filepath.SkipDir
+		}
+		if fileExists(filepath.Join(path, ".git")) {
+			repos = append(repos, path)
+			return filepath.SkipDir
+		}
+		if rel, _ := filepath.Rel(root, path); strings.Count(rel, string(filepath.Separator))+1 >= maxCampaignDepth {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return repos
+}
+
+var campaignBranchUnsafe = regexp.MustCompile(`[^A-Za-z0-9._/-]+`)
+
+// campaignBranch names the branch a campaign creates in each repository.
+func campaignBranch(module, version string) string {
+	return "deps/" + campaignBranchUnsafe.ReplaceAllString(strings.TrimPrefix(module, "@")+"-"+strings.TrimLeft(version, "^~="), "-")
+}
+
+func (r *Router) cmdCampaign(ctx context.Context, chatID, args string) {
+	sub, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	rest = strings.TrimSpace(rest)
+	switch sub {
+	case "bump":
+		r.startCampaign(ctx, chatID, rest)
+	case "status":
+		r.campaignStatus(ctx, chatID, rest)
+	default:
+		r.sender.SendText(ctx, chatID, "用法: /campaign bump <模块>@<版本>\n       /campaign status [ID]\n在根目录下所有依赖该模块的仓库中创建分支、升级依赖、运行测试并创建 PR。\n示例: /campaign bump github.com/pkg/errors@v0.9.1")
+	}
+}
+
+// startCampaign records a campaign for every repository that depends on
+// the module and queues the rollout.
+func (r *Router) startCampaign(ctx context.Context, chatID, spec string) {
+	i := strings.LastIndex(spec, "@")
+	if i <= 0 || i == len(spec)-1 || strings.ContainsAny(spec, " \t") || strings.HasPrefix(spec, "-") || strings.HasPrefix(spec[i+1:], "-") {
+		r.sender.SendText(ctx, chatID, "用法: /campaign bump <模块>@<版本>\n示例: /campaign bump github.com/pkg/errors@v0.9.1")
+		return
+	}
+	module, version := spec[:i], spec[i+1:]
+	root := r.store.WorkRoot()
+	c := Campaign{
+		ID:        newExecID(),
+		ChatID:    chatID,
+		Module:    module,
+		Version:   version,
+		Branch:    campaignBranch(module, version),
+		CreatedAt: time.Now(),
+	}
+	for _, dir := range campaignRepos(root) {
+		if _, _, ok := dependencyVersion(dir, module); ok {
+			c.Repos = append(c.Repos, &CampaignRepo{Dir: dir, Status: campaignPending})
+		}
+	}
+	if len(c.Repos) == 0 {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("根目录 %s 下没有依赖 %s 的仓库。", root, module))
+		return
+	}
+	r.store.AddCampaign(c)
+	r.save()
+	slog.InfoContext(ctx, "router: campaign started", "campaign", c.ID, "chat_id", chatID, "module", module, "version", version, "repos", len(c.Repos))
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("升级战役 %s 已创建：%d 个仓库依赖 %s，将依次升级到 %s（分支 %s）。\n使用 /campaign status 查看进度。", c.ID, len(c.Repos), module, version, c.Branch))
+
+	if r.queue == nil {
+		r.runCampaign(ctx, c)
+		return
+	}
+	r.setQueued(ExecRecord{ID: c.ID, ChatID: chatID, Prompt: "/campaign bump " + spec, StartedAt: time.Now()})
+	if _, err := r.queue.EnqueueTask(chatID, QueueEntry{ID: c.ID}, func() { r.runCampaign(r.ctx, c) }); err != nil {
+		r.clearQueued(c.ID)
+		r.sender.SendText(ctx, chatID, "队列已满，请稍后再试。")
+	}
+}
+
+// runCampaign bumps each repository in turn and posts the final status.
+func (r *Router) runCampaign(ctx context.Context, c Campaign) {
+	r.clearQueued(c.ID)
+	r.setActive(ExecRecord{ID: c.ID, ChatID: c.ChatID, Prompt: fmt.Sprintf("/campaign bump %s@%s", c.Module, c.Version), StartedAt: time.Now()})
+	defer r.clearActive(c.ID)
+	for _, repo := range c.Repos {
+		if ctx.Err() != nil {
+			break
+		}
+		status, detail := r.bumpRepo(ctx, c, repo.Dir)
+		slog.InfoContext(ctx, "router: campaign repo done", "campaign", c.ID, "repo", repo.Dir, "status", status)
+		r.store.UpdateCampaignRepo(c.ID, repo.Dir, func(cr *CampaignRepo) {
+			cr.Status, cr.Detail, cr.UpdatedAt = status, detail, time.Now()
+		})
+		r.save()
+	}
+	r.campaignStatus(ctx, c.ChatID, c.ID)
+}
+
+// bumpRepo creates the campaign branch in dir, applies the bump, runs the
+// tests and opens a PR, leaving dir on its original branch. It returns the
+// repository's new status and detail.
+func (r *Router) bumpRepo(ctx context.Context, c Campaign, dir string) (string, string) {
+	eco, current, ok := dependencyVersion(dir, c.Module)
+	if !ok {
+		return campaignSkipped, "不再依赖该模块"
+	}
+	if strings.TrimLeft(current, "^~=v") == strings.TrimLeft(c.Version, "^~=v") {
+		return campaignCurrent, current
+	}
+	if out, err := runGitOutput(dir, "status", "--porcelain"); err != nil || out != "" {
+		return campaignSkipped, "工作区有未提交的更改"
+	}
+	base := gitBranch(dir)
+	if base == "" {
+		return campaignSkipped, "当前不在任何分支上（detached HEAD）"
+	}
+	if out, err := runGitOutput(dir, "checkout", "-b", c.Branch); err != nil {
+		return campaignFailed, "创建分支失败: " + out
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			// The tree was clean before the bump; drop what it left behind.
+			runGitOutput(dir, "reset", "--hard", "-q")
+			runGitOutput(dir, "clean", "-fdq")
+		}
+		runGitOutput(dir, "checkout", "-q", base)
+		if !committed {
+			runGitOutput(dir, "branch", "-D", c.Branch)
+		}
+	}()
+
+	if out, err := bumpDependency(ctx, dir, eco, c.Module, c.Version); err != nil {
+		return campaignFailed, fmt.Sprintf("升级失败: %v\n%s", err, truncateTail(strings.TrimSpace(out), 500))
+	}
+	if out, _ := runGitOutput(dir, "status", "--porcelain"); out == "" {
+		return campaignCurrent, "升级后没有变更"
+	}
+	title := fmt.Sprintf("Bump %s to %s", c.Module, c.Version)
+	runGitOutput(dir, "add", "-A")
+	if out, err := runGitOutput(dir, "commit", "-q", "-m", title); err != nil {
+		return campaignFailed, "提交失败: " + out
+	}
+	committed = true
+
+	if argv := testCommand(dir); argv != nil {
+		if out, err := runInDir(ctx, dir, campaignStepTimeout, argv...); err != nil {
+			return campaignTestsFailed, truncateTail(strings.TrimSpace(out), 500)
+		}
+	}
+	if out, err := runGitOutput(dir, "push", "-u", "origin", c.Branch); err != nil {
+		return campaignFailed, "推送失败（分支仅在本地）: " + out
+	}
+	body := fmt.Sprintf("Bumps %s from %s to %s.\n\nPart of dependency upgrade campaign %s.", c.Module, current, c.Version, c.ID)
+	out, err := runInDir(ctx, dir, campaignStepTimeout, "gh", "pr", "create", "--head", c.Branch, "--title", title, "--body", body)
+	out = strings.TrimSpace(out)
+	if err != nil {
+		return campaignFailed, "创建 PR 失败（分支已推送）: " + out
+	}
+	return campaignPR, out
+}
+
+// campaignStatus shows campaign id of the chat, or the latest one when id
+// is empty, with one line per repository.
+func (r *Router) campaignStatus(ctx context.Context, chatID, id string) {
+	campaigns := r.store.Campaigns(chatID)
+	if len(campaigns) == 0 {
+		r.sender.SendText(ctx, chatID, "暂无升级战役。使用 /campaign bump <模块>@<版本> 创建。")
+		return
+	}
+	c := campaigns[len(campaigns)-1]
+	if id != "" {
+		found := false
+		for _, x := range campaigns {
+			if x.ID == id {
+				c, found = x, true
+			}
+		}
+		if !found {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("未找到升级战役: %s", id))
+			return
+		}
+	}
+
+	root := r.store.WorkRoot()
+	counts := make(map[string]int)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**%s@%s** · 分支 `%s` · %s\n\n", c.Module, c.Version, c.Branch, c.CreatedAt.Format("01-02 15:04"))
+	for _, repo := range c.Repos {
+		counts[repo.Status]++
+		name := repo.Dir
+		if rel, err := filepath.Rel(root, repo.Dir); err == nil {
+			name = rel
+		}
+		fmt.Fprintf(&sb, "%s **%s** — %s", campaignIcons[repo.Status], name, campaignLabels[repo.Status])
+		if repo.Detail != "" {
+			if strings.Contains(repo.Detail, "\n") {
+				fmt.Fprintf(&sb, "\n```\n%s\n```", repo.Detail)
+			} else {
+				fmt.Fprintf(&sb, ": %s", truncateRunes(repo.Detail, 200))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	if len(campaigns) > 1 {
+		sb.WriteString("\n其他战役:\n")
+		for i := len(campaigns) - 1; i >= 0; i-- {
+			if x := campaigns[i]; x.ID != c.ID {
+				fmt.Fprintf(&sb, "- `%s` %s@%s（%s）\n", x.ID, x.Module, x.Version, x.CreatedAt.Format("01-02 15:04"))
+			}
+		}
+	}
+	tpl := "green"
+	switch {
+	case counts[campaignFailed]+counts[campaignTestsFailed] > 0:
+		tpl = "red"
+	case counts[campaignPending] > 0:
+		tpl = "blue"
+	}
+	title := fmt.Sprintf("升级战役 %s: %d/%d 已创建 PR", c.ID, counts[campaignPR], len(c.Repos))
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: sb.String(), Template: tpl})
+}
@@ -0,0 +1,176 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGoModVersion(t *testing.T) {
+	gomod := []byte(`module example.com/app
+
+go 1.20
+
+require example.com/single v0.1.0 // indirect
+
+require (
+	example.com/lib v1.0.0
+	// example.com/commented v9.9.9
+	example.com/other v2.0.0 // indirect
+)
+`)
+	cases := map[string]string{
+		"example.com/single":    "v0.1.0",
+		"example.com/lib":       "v1.0.0",
+		"example.com/other":     "v2.0.0",
+		"example.com/commented": "",
+		"example.com/app":       "",
+	}
+	for module, want := range cases {
+		if got, _ := goModVersion(gomod, module); got != want {
+			t.Errorf("goModVersion(%s) = %q, want %q", module, got, want)
+		}
+	}
+}
+
+func TestDependencyVersion(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "package.json"), []byte(`{"devDependencies":{"@scope/kit":"^1.2.0"}}`), 0644)
+	if eco, v, ok := dependencyVersion(dir, "@scope/kit"); !ok || eco != "npm" || v != "^1.2.0" {
+		t.Fatalf("got %s %s %v", eco, v, ok)
+	}
+	if _, _, ok := dependencyVersion(dir, "left-pad"); ok {
+		t.Fatal("expected no dependency")
+	}
+}
+
+func TestCampaignRepos(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"a/.git", "a/nested/.git", "group/b/.git", ".hidden/c/.git", "x/y/z/d/.git", "node_modules/e/.git"} {
+		os.MkdirAll(filepath.Join(root, d), 0755)
+	}
+	var got []string
+	for _, repo := range campaignRepos(root) {
+		rel, _ := filepath.Rel(root, repo)
+		got = append(got, rel)
+	}
+	if strings.Join(got, ",") != "a,group/b" {
+		t.Fatalf("unexpected repos %v", got)
+	}
+}
+
+func TestCampaignBranch(t *testing.T) {
+	if got := campaignBranch("@scope/kit", "^1.2.0"); got != "deps/scope/kit-1.2.0" {
+		t.Fatalf("got %q", got)
+	}
+	if got := campaignBranch("example.com/lib", "v1.2.0"); got != "deps/example.com/lib-v1.2.0" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+// campaignRepo creates a Go repository under root that requires
+// example.com/lib v1.0.0, with a test that passes or fails and a bare
+// origin to push to.
+func campaignRepo(t *testing.T, root, name string, pass bool) string {
+	t.Helper()
+	dir := filepath.Join(root, name)
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/"+name+"\n\ngo 1.20\n\nrequire example.com/lib v1.0.0\n"), 0644)
+	body := ""
+	if !pass {
+		body = `t.Fatal("broken")`
+	}
+	os.WriteFile(filepath.Join(dir, "x_test.go"), []byte("package x\n\nimport \"testing\"\n\nfunc TestX(t *testing.T) { "+body+" }\n"), 0644)
+	remote := filepath.Join(t.TempDir(), name+".git")
+	for _, args := range [][]string{
+		{"init", "-q", "--bare", remote},
+		{"-C", dir, "init", "-q"},
+		{"-C", dir, "add", "-A"},
+		{"-C", dir, "commit", "-q", "-m", "init"},
+		{"-C", dir, "remote", "add", "origin", remote},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v %s", args, err, out)
+		}
+	}
+	return dir
+}
+
+func TestRouterCampaign(t *testing.T) {
+	old := bumpDependency
+	bumpDependency = func(_ context.Context, dir, eco, module, version string) (string, error) {
+		data, _ := os.ReadFile(filepath.Join(dir, "go.mod"))
+		return "", os.WriteFile(filepath.Join(dir, "go.mod"), []byte(strings.Replace(string(data), module+" v1.0.0", module+" "+version, 1)), 0644)
+	}
+	defer func() { bumpDependency = old }()
+
+	bin := t.TempDir()
+	os.WriteFile(filepath.Join(bin, "gh"), []byte("#!/bin/sh\necho https://example.com/pr/1\n"), 0755)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("GOPROXY", "off")
+
+	r, sender := newTestRouter(t)
+	root := r.store.WorkRoot()
+	ok := campaignRepo(t, root, "ok", true)
+	broken := campaignRepo(t, root, "broken", false)
+	dirty := campaignRepo(t, root, "dirty", true)
+	os.WriteFile(filepath.Join(dirty, "wip.txt"), []byte("wip"), 0644)
+	base := gitBranch(ok)
+
+	r.Route(context.Background(), "chat1", "user1", "/campaign bump example.com/lib@v1.2.0")
+	msg := sender.LastMessage()
+	if !strings.Contains(msg, "1/3 已创建 PR") {
+		t.Fatalf("unexpected status %q", msg)
+	}
+	for _, want := range []string{"✅ **ok** — PR 已创建: https://example.com/pr/1", "❌ **broken** — 测试失败", "⚠️ **dirty** — 已跳过"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected %q in %q", want, msg)
+		}
+	}
+
+	branch := "deps/example.com/lib-v1.2.0"
+	if gitBranch(ok) != base || gitBranch(broken) != base {
+		t.Fatal("expected repos back on their original branch")
+	}
+	if out, _ := runGitOutput(ok, "ls-remote", "origin", branch); out == "" {
+		t.Fatal("expected branch pushed")
+	}
+	if out, _ := runGitOutput(broken, "show", branch+":go.mod"); !strings.Contains(out, "example.com/lib v1.2.0") {
+		t.Fatalf("expected bump committed on local branch, got %q", out)
+	}
+	if out, _ := runGitOutput(broken, "ls-remote", "origin", branch); out != "" {
+		t.Fatal("expected failing branch not pushed")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dirty, "wip.txt")); string(data) != "wip" {
+		t.Fatal("expected dirty repo untouched")
+	}
+
+	campaigns := r.store.Campaigns("chat1")
+	if len(campaigns) != 1 || len(campaigns[0].Repos) != 3 {
+		t.Fatalf("unexpected campaigns %+v", campaigns)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/campaign status "+campaigns[0].ID)
+	if !strings.Contains(sender.LastMessage(), "1/3 已创建 PR") {
+		t.Fatalf("unexpected status %q", sender.LastMessage())
+	}
+}
+
+func TestRouterCampaign_Usage(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/campaign status")
+	if !strings.Contains(sender.LastMessage(), "暂无升级战役") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/campaign bump example.com/lib")
+	if !strings.Contains(sender.LastMessage(), "用法") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/campaign bump example.com/lib@v1.2.0")
+	if !strings.Contains(sender.LastMessage(), "没有依赖") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+}
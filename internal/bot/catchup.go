@@ -0,0 +1,154 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultCatchupMessages is how many recent messages /catchup reads
+	// without an argument; maxCatchupMessages caps the argument.
+	defaultCatchupMessages = 50
+	maxCatchupMessages     = 200
+	// maxCatchupRunes caps the transcript sent to Claude; the oldest
+	// messages are dropped first.
+	maxCatchupRunes = 30000
+)
+
+// ChatMessage is one message of a chat's history.
+type ChatMessage struct {
+	SenderID string
+	FromBot  bool
+	Time     time.Time
+	Text     string
+}
+
+// messageText renders the content of a message of msgType as plain text:
+// the text of text and post messages, a placeholder for anything else.
+func messageText(msgType, content string) string {
+	switch msgType {
+	case "text":
+		var tc struct {
+			Text string `json:"text"`
+		}
+		if json.Unmarshal([]byte(content), &tc) != nil {
+			return ""
+		}
+		return strings.TrimSpace(tc.Text)
+	case "post":
+		var pc postContent
+		if json.Unmarshal([]byte(content), &pc) != nil {
+			return ""
+		}
+		var parts []string
+		if pc.Title != "" {
+			parts = append(parts, pc.Title)
+		}
+		for _, para := range pc.Content {
+			var line []string
+			for _, elem := range para {
+				if (elem.Tag == "text" || elem.Tag == "a") && strings.TrimSpace(elem.Text) != "" {
+					line = append(line, strings.TrimSpace(elem.Text))
+				}
+			}
+			if len(line) > 0 {
+				parts = append(parts, strings.Join(line, " "))
+			}
+		}
+		return strings.Join(parts, "\n")
+	case "image":
+		return "[图片]"
+	case "file":
+		return "[文件]"
+	case "merge_forward":
+		return "[合并转发的聊天记录]"
+	}
+	return ""
+}
+
+// catchupTranscript renders the human messages of msgs (oldest first) as
+// "[15:04] 成员1: text" lines, naming senders by order of appearance. Bot
+// messages and commands are left out. It returns the transcript and how
+// many messages it holds.
+func catchupTranscript(msgs []ChatMessage) (string, int) {
+	return chatTranscript(msgs, false)
+}
+
+// chatTranscript renders msgs like catchupTranscript, keeping bot messages,
+// named "机器人", when withBots is set.
+func chatTranscript(msgs []ChatMessage, withBots bool) (string, int) {
+	names := make(map[string]string)
+	var lines []string
+	for _, m := range msgs {
+		text := strings.TrimSpace(m.Text)
+		if m.FromBot && !withBots || text == "" || strings.HasPrefix(text, "/") {
+			continue
+		}
+		name, ok := names[m.SenderID]
+		switch {
+		case m.FromBot:
+			name = "机器人"
+		case !ok:
+			name = fmt.Sprintf("成员%d", len(names)+1)
+			names[m.SenderID] = name
+		}
+		lines = append(lines, fmt.Sprintf("[%s] %s: %s", m.Time.Format("01-02 15:04"), name, strings.ReplaceAll(text, "\n", "\n  ")))
+	}
+	total := 0
+	for i := len(lines) - 1; i >= 0; i-- {
+		total += len([]rune(lines[i])) + 1
+		if total > maxCatchupRunes {
+			lines = lines[i+1:]
+			break
+		}
+	}
+	return strings.Join(lines, "\n"), len(lines)
+}
+
+// catchupPrompt asks Claude to summarize a chat discussion and keep it as
+// context for the requests that follow in the session.
+func catchupPrompt(transcript string) string {
+	return "Below is the recent discussion in the chat you are working in (oldest first). " +
+		"Summarize it in the same language as the discussion: the problem, what is known so far, decisions made, open questions and suggested next steps. " +
+		"Keep this context in mind for the requests that follow; do not modify any files now.\n\n" +
+		transcript + "\n"
+}
+
+// cmdCatchup reads the chat's last n messages, has Claude summarize the
+// human discussion in the current session and so seeds the session with
+// it, e.g. when the bot is pulled into an ongoing incident thread.
+func (r *Router) cmdCatchup(ctx context.Context, chatID, args string) {
+	n := defaultCatchupMessages
+	if args = strings.TrimSpace(args); args != "" {
+		v, err := strconv.Atoi(args)
+		if err != nil || v <= 0 {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("用法: /catchup [条数]（默认 %d，最多 %d）", defaultCatchupMessages, maxCatchupMessages))
+			return
+		}
+		if v > maxCatchupMessages {
+			v = maxCatchupMessages
+		}
+		n = v
+	}
+	hr, ok := r.sender.(HistoryReader)
+	if !ok {
+		r.sender.SendText(ctx, chatID, "当前环境无法读取聊天记录。")
+		return
+	}
+	msgs, err := hr.RecentMessages(ctx, chatID, n)
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("读取聊天记录失败: %v\n请确认应用已开通获取群组消息的权限。", err))
+		return
+	}
+	transcript, count := catchupTranscript(msgs)
+	if count == 0 {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("最近 %d 条消息中没有可总结的讨论。", n))
+		return
+	}
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("正在总结最近 %d 条讨论，总结会作为当前会话的上下文...", count))
+	r.execClaudeQueued(ctx, chatID, catchupPrompt(transcript))
+}
@@ -0,0 +1,124 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// historySpySender serves a fixed chat history to /catchup.
+type historySpySender struct {
+	spySender
+	history []ChatMessage
+	err     error
+	asked   int
+}
+
+func (s *historySpySender) RecentMessages(_ context.Context, _ string, n int) ([]ChatMessage, error) {
+	s.asked = n
+	if n < len(s.history) {
+		return s.history[len(s.history)-n:], s.err
+	}
+	return s.history, s.err
+}
+
+func TestMessageText(t *testing.T) {
+	cases := []struct{ msgType, content, want string }{
+		{"text", `{"text":" 数据库连接池满了 "}`, "数据库连接池满了"},
+		{"post", `{"title":"故障","content":[[{"tag":"text","text":"看"},{"tag":"a","text":"面板","href":"https://x"}],[{"tag":"img","image_key":"k"}]]}`, "故障\n看 面板"},
+		{"image", `{"image_key":"k"}`, "[图片]"},
+		{"interactive", `{}`, ""},
+		{"text", `not json`, ""},
+	}
+	for _, c := range cases {
+		if got := messageText(c.msgType, c.content); got != c.want {
+			t.Errorf("messageText(%s, %s) = %q, want %q", c.msgType, c.content, got, c.want)
+		}
+	}
+}
+
+func TestCatchupTranscript(t *testing.T) {
+	at := time.Date(2026, 3, 1, 14, 5, 0, 0, time.Local)
+	transcript, n := catchupTranscript([]ChatMessage{
+		{SenderID: "ou_a", Time: at, Text: "502 又出现了"},
+		{SenderID: "bot", FromBot: true, Time: at, Text: "✓ 完成"},
+		{SenderID: "ou_b", Time: at, Text: "/status"},
+		{SenderID: "ou_b", Time: at, Text: "看起来是连接池\n满了"},
+		{SenderID: "ou_a", Time: at, Text: "我先扩容"},
+	})
+	want := "[03-01 14:05] 成员1: 502 又出现了\n[03-01 14:05] 成员2: 看起来是连接池\n  满了\n[03-01 14:05] 成员1: 我先扩容"
+	if transcript != want || n != 3 {
+		t.Fatalf("got %d %q", n, transcript)
+	}
+
+	long := make([]ChatMessage, 10)
+	for i := range long {
+		long[i] = ChatMessage{SenderID: "ou_a", Time: at, Text: fmt.Sprintf("%d %s", i, strings.Repeat("x", maxCatchupRunes/4))}
+	}
+	transcript, n = catchupTranscript(long)
+	if n != 3 || !strings.HasPrefix(transcript, "[03-01 14:05] 成员1: 7 ") {
+		t.Fatalf("expected the newest messages kept, got %d messages starting %q", n, transcript[:30])
+	}
+}
+
+func TestRouterCatchup(t *testing.T) {
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args")
+	claude := filepath.Join(dir, "claude")
+	os.WriteFile(claude, []byte(fmt.Sprintf(`#!/bin/sh
+echo "$@" "$(cat)" > %s
+echo '{"type":"result","result":"连接池耗尽，正在扩容。","session_id":"s1"}'
+`, args)), 0755)
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	sender := &historySpySender{}
+	r := NewRouter(context.Background(), NewClaudeExecutor(claude, "sonnet", 10*time.Second), store, sender, map[string]bool{"user1": true}, dir, nil)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "/catchup")
+	if sender.asked != defaultCatchupMessages || !strings.Contains(sender.LastMessage(), "没有可总结的讨论") {
+		t.Fatalf("unexpected reply %q (asked %d)", sender.LastMessage(), sender.asked)
+	}
+
+	sender.history = []ChatMessage{
+		{SenderID: "ou_a", Time: time.Now(), Text: "502 又出现了"},
+		{SenderID: "ou_b", Time: time.Now(), Text: "看起来是连接池满了"},
+		{SenderID: "ou_a", Time: time.Now(), Text: "/catchup 500"},
+	}
+	r.Route(ctx, "chat1", "user1", "/catchup 500")
+	if sender.asked != maxCatchupMessages {
+		t.Fatalf("expected the count capped, asked %d", sender.asked)
+	}
+	if !strings.Contains(strings.Join(sender.messages, "\n"), "正在总结最近 2 条讨论") || !strings.Contains(strings.Join(sender.messages, "\n"), "连接池耗尽") {
+		t.Fatalf("unexpected messages %q", sender.messages)
+	}
+	data, _ := os.ReadFile(args)
+	if !strings.Contains(string(data), "成员2: 看起来是连接池满了") || strings.Contains(string(data), "/catchup") {
+		t.Fatalf("unexpected claude args %q", data)
+	}
+	if r.getSession("chat1").ClaudeSessionID != "s1" {
+		t.Fatal("expected the summary to seed the session")
+	}
+
+	sender.err = errors.New("code=99991672")
+	r.Route(ctx, "chat1", "user1", "/catchup 10")
+	if !strings.Contains(sender.LastMessage(), "读取聊天记录失败") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "user1", "/catchup abc")
+	if !strings.HasPrefix(sender.LastMessage(), "用法: /catchup") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+}
+
+func TestRouterCatchupUnsupported(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/catchup")
+	if !strings.Contains(sender.LastMessage(), "无法读取聊天记录") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+}
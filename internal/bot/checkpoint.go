@@ -0,0 +1,177 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCheckpoints is how many checkpoints each chat keeps.
+const maxCheckpoints = 50
+
+// Checkpoint links a state of the code to a state of the conversation:
+// the commit capturing the workdir's tracked files (uncommitted changes
+// included) and the Claude session at the time of /checkpoint.
+type Checkpoint struct {
+	SHA       string    `json:"sha"`
+	SessionID string    `json:"sessionID,omitempty"`
+	WorkDir   string    `json:"workDir"`
+	Summary   string    `json:"summary"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// checkpointRef is the ref that keeps a checkpoint's commit from being
+// garbage collected; commits made by `git stash create` are otherwise
+// unreachable.
+func checkpointRef(sha string) string {
+	return "refs/devbot/checkpoints/" + sha
+}
+
+// cmdCheckpoint records the current commit and Claude session as a
+// checkpoint of the chat.
+func (r *Router) cmdCheckpoint(ctx context.Context, chatID, args string) {
+	summary := strings.TrimSpace(args)
+	if summary == "" {
+		r.sender.SendText(ctx, chatID, "用法: /checkpoint <说明>\n记录当前代码状态（git 提交，含未提交的改动）和 Claude 会话；/checkpoints 查看，/restore <序号> 恢复。")
+		return
+	}
+	session := r.getSession(chatID)
+	sha := treeSnapshot(session.WorkDir)
+	if sha == "" {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("%s 不是 git 仓库（或还没有提交），无法记录检查点。", session.WorkDir))
+		return
+	}
+	if out, err := runGitOutput(session.WorkDir, "update-ref", checkpointRef(sha), sha); err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("记录检查点失败: %s", out))
+		return
+	}
+	cp := Checkpoint{
+		SHA:       sha,
+		SessionID: session.ClaudeSessionID,
+		WorkDir:   session.WorkDir,
+		Summary:   summary,
+		CreatedAt: time.Now(),
+	}
+	var n int
+	r.store.UpdateSession(chatID, func(s *Session) {
+		s.Checkpoints = append(s.Checkpoints, cp)
+		if len(s.Checkpoints) > maxCheckpoints {
+			s.Checkpoints = append([]Checkpoint(nil), s.Checkpoints[len(s.Checkpoints)-maxCheckpoints:]...)
+		}
+		n = len(s.Checkpoints)
+	})
+	r.save()
+
+	state := "提交 " + shortHash(sha)
+	if sha != gitHead(session.WorkDir) {
+		state += "（含未提交的改动）"
+	}
+	sessionNote := "会话 " + orDash(cp.SessionID)
+	if cp.SessionID == "" {
+		sessionNote = "尚无 Claude 会话"
+	}
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 检查点 #%d: %s · %s\n%s", n, state, sessionNote, summary))
+}
+
+// cmdCheckpoints lists the chat's checkpoints, oldest first, numbered for
+// /restore.
+func (r *Router) cmdCheckpoints(ctx context.Context, chatID string) {
+	cps := r.getSession(chatID).Checkpoints
+	if len(cps) == 0 {
+		r.sender.SendText(ctx, chatID, "还没有检查点。使用 /checkpoint <说明> 记录当前代码和会话。")
+		return
+	}
+	var sb strings.Builder
+	for i, cp := range cps {
+		fmt.Fprintf(&sb, "%d. **%s** · `%s` · 会话 %s · %s\n   %s\n",
+			i+1, cp.CreatedAt.Format("01-02 15:04"), shortHash(cp.SHA), shortHash(orDash(cp.SessionID)), cp.WorkDir, cp.Summary)
+	}
+	sb.WriteString("\n使用 /restore <序号> 在工作树中恢复代码并切换到对应会话。")
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("📍 检查点（%d）", len(cps)), Content: sb.String()})
+}
+
+// cmdRestore checks checkpoint n out in a detached worktree next to its
+// repository and moves the chat there, resuming the checkpoint's Claude
+// session, so code and conversation are back in step. The original
+// checkout is left untouched.
+func (r *Router) cmdRestore(ctx context.Context, chatID, args string) {
+	cps := r.getSession(chatID).Checkpoints
+	n, err := strconv.Atoi(strings.TrimSpace(args))
+	if err != nil {
+		r.sender.SendText(ctx, chatID, "用法: /restore <序号>\n序号见 /checkpoints。")
+		return
+	}
+	if n < 1 || n > len(cps) {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("检查点 #%d 不存在，请用 /checkpoints 查看有效序号。", n))
+		return
+	}
+	for _, rec := range r.ActiveExecs() {
+		if rec.ChatID == chatID {
+			r.sender.SendText(ctx, chatID, "当前聊天有任务正在执行，请等待完成或 /kill 后再恢复。")
+			return
+		}
+	}
+	cp := cps[n-1]
+
+	top, err := runGitOutput(cp.WorkDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("检查点 #%d 的目录 %s 已不是 git 仓库: %s", n, cp.WorkDir, top))
+		return
+	}
+	wt := filepath.Join(filepath.Dir(top), fmt.Sprintf("%s-checkpoint-%s", filepath.Base(top), shortHash(cp.SHA)))
+	if root := r.store.WorkRoot(); !underRoot(root, wt) {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("工作树 %s 不在工作根目录 %s 下，无法恢复。", wt, root))
+		return
+	}
+	if head := gitHead(wt); head == "" {
+		if out, err := runGitOutput(top, "worktree", "add", "--detach", wt, cp.SHA); err != nil {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("创建工作树失败: %s", out))
+			return
+		}
+	}
+	workDir := wt
+	if rel, err := filepath.Rel(top, cp.WorkDir); err == nil && rel != "." {
+		workDir = filepath.Join(wt, rel)
+	}
+
+	r.store.UpdateSession(chatID, func(s *Session) {
+		if s.ClaudeSessionID != cp.SessionID {
+			history := s.History[:0]
+			for _, id := range s.History {
+				if id != cp.SessionID {
+					history = append(history, id)
+				}
+			}
+			s.History = history
+			if s.ClaudeSessionID != "" {
+				s.History = append(s.History, s.ClaudeSessionID)
+			}
+		}
+		s.ClaudeSessionID = cp.SessionID
+		s.WorkDir = workDir
+		s.LastOutput = ""
+		if cp.SessionID != "" {
+			// Registered for the worktree so checkResume resumes it there.
+			if s.DirSessions == nil {
+				s.DirSessions = make(map[string]string)
+			}
+			s.DirSessions[workDir] = cp.SessionID
+		}
+	})
+	r.save()
+	slog.InfoContext(ctx, "router: restored checkpoint", "commit", shortHash(cp.SHA), "session_id", cp.SessionID, "work_dir", workDir, "chat_id", chatID)
+
+	sessionNote := "会话 " + cp.SessionID
+	if cp.SessionID == "" {
+		sessionNote = "检查点没有 Claude 会话，将开启新对话"
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{
+		Title:    fmt.Sprintf("⏪ 已恢复检查点 #%d", n),
+		Content:  fmt.Sprintf("**说明:** %s\n**代码:** `%s`（工作树 %s）\n**会话:** %s\n\n原目录 %s 保持不变，可用 /cd 切回。", cp.Summary, shortHash(cp.SHA), workDir, sessionNote, cp.WorkDir),
+		Template: "blue",
+	})
+}
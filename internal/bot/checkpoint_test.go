@@ -0,0 +1,85 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckpointRestore(t *testing.T) {
+	r, sender := newTestRouter(t)
+	ctx := context.Background()
+	proj := filepath.Join(r.store.WorkRoot(), "project1")
+	initGitRepo(t, proj)
+	os.WriteFile(filepath.Join(proj, "a.txt"), []byte("v1\n"), 0644)
+	for _, args := range [][]string{{"add", "a.txt"}, {"commit", "-q", "-m", "init"}} {
+		if out, err := exec.Command("git", append([]string{"-C", proj}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v %s", args, err, out)
+		}
+	}
+	r.getSession("chat1")
+	r.store.UpdateSession("chat1", func(s *Session) {
+		s.WorkDir = proj
+		s.ClaudeSessionID = "s1"
+	})
+
+	r.Route(ctx, "chat1", "user1", "/checkpoint schema done")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "检查点 #1") || strings.Contains(msg, "未提交") {
+		t.Fatalf("first checkpoint reply = %q", msg)
+	}
+	os.WriteFile(filepath.Join(proj, "a.txt"), []byte("v2\n"), 0644)
+	r.store.UpdateSession("chat1", func(s *Session) { s.ClaudeSessionID = "s2" })
+	r.Route(ctx, "chat1", "user1", "/checkpoint api half done")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "检查点 #2") || !strings.Contains(msg, "含未提交的改动") {
+		t.Fatalf("second checkpoint reply = %q", msg)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/checkpoints")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "1. ") || !strings.Contains(msg, "schema done") || !strings.Contains(msg, "api half done") {
+		t.Fatalf("checkpoint list = %q", msg)
+	}
+
+	for n, want := range map[string]struct{ content, session string }{"1": {"v1\n", "s1"}, "2": {"v2\n", "s2"}} {
+		r.Route(ctx, "chat1", "user1", "/restore "+n)
+		if msg := sender.LastMessage(); !strings.Contains(msg, "已恢复检查点 #"+n) {
+			t.Fatalf("restore %s reply = %q", n, msg)
+		}
+		s := r.getSession("chat1")
+		if s.ClaudeSessionID != want.session || s.DirSessions[s.WorkDir] != want.session {
+			t.Fatalf("restore %s: session = %+v", n, s)
+		}
+		if !strings.HasPrefix(filepath.Base(s.WorkDir), "project1-checkpoint-") {
+			t.Fatalf("restore %s: workdir = %s", n, s.WorkDir)
+		}
+		if data, _ := os.ReadFile(filepath.Join(s.WorkDir, "a.txt")); string(data) != want.content {
+			t.Fatalf("restore %s: a.txt = %q, want %q", n, data, want.content)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(proj, "a.txt")); string(data) != "v2\n" {
+		t.Fatalf("original checkout changed: %q", data)
+	}
+}
+
+func TestCheckpoint_Usage(t *testing.T) {
+	r, sender := newTestRouter(t)
+	ctx := context.Background()
+	r.Route(ctx, "chat1", "user1", "/checkpoint")
+	if !strings.Contains(sender.LastMessage(), "用法") {
+		t.Fatalf("reply = %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "user1", "/checkpoint x")
+	if !strings.Contains(sender.LastMessage(), "不是 git 仓库") {
+		t.Fatalf("reply = %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "user1", "/checkpoints")
+	if !strings.Contains(sender.LastMessage(), "还没有检查点") {
+		t.Fatalf("reply = %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "user1", "/restore 3")
+	if !strings.Contains(sender.LastMessage(), "不存在") {
+		t.Fatalf("reply = %q", sender.LastMessage())
+	}
+}
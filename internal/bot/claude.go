@@ -6,7 +6,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
 	"os/exec"
 	"strings"
 	"sync"
@@ -17,6 +18,9 @@ type ExecResult struct {
 	Output             string
 	SessionID          string
 	IsPermissionDenial bool
+	// Model and CLIVersion are reported by the CLI's init event (stream mode).
+	Model      string
+	CLIVersion string
 }
 
 type ClaudeExecutor struct {
@@ -27,6 +31,8 @@ type ClaudeExecutor struct {
 	running          *exec.Cmd
 	lastExecDuration time.Duration
 	execCount        int
+	imageInputOnce   sync.Once
+	imageInputOK     bool
 }
 
 func NewClaudeExecutor(claudePath, model string, timeout time.Duration) *ClaudeExecutor {
@@ -38,7 +44,9 @@ func NewClaudeExecutor(claudePath, model string, timeout time.Duration) *ClaudeE
 }
 
 func (c *ClaudeExecutor) Exec(ctx context.Context, prompt, workDir, sessionID, permissionMode, model string) (ExecResult, error) {
-	args := []string{"-p", prompt, "--output-format", "json"}
+	// The prompt is written to stdin rather than passed as an argument:
+	// arguments are size-limited and show up in process listings.
+	args := []string{"-p", "--output-format", "json"}
 	if sessionID != "" {
 		args = append(args, "--resume", sessionID)
 	}
@@ -48,12 +56,22 @@ func (c *ClaudeExecutor) Exec(ctx context.Context, prompt, workDir, sessionID, p
 	if permissionMode == "yolo" {
 		args = append(args, "--dangerously-skip-permissions")
 	}
+	scratch := scratchDirFrom(ctx)
+	if scratch != "" {
+		args = append(args, "--add-dir", scratch)
+	}
+	args = append(args, referenceDirArgs(ctx)...)
 
 	ctx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, c.claudePath, args...)
 	cmd.Dir = workDir
+	if scratch != "" {
+		cmd.Env = append(os.Environ(), "TMPDIR="+scratch)
+	}
+
+	cmd.Stdin = strings.NewReader(prompt)
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -85,11 +103,11 @@ func (c *ClaudeExecutor) Exec(ctx context.Context, prompt, workDir, sessionID, p
 	}
 
 	rawOut := stdout.String()
-	log.Printf("claude: raw output len=%d session=%s", len(rawOut), sessionID)
+	slog.DebugContext(ctx, "claude: raw output", "len", len(rawOut), "session_id", sessionID)
 	if len(rawOut) < 3000 {
-		log.Printf("claude: raw json: %s", rawOut)
+		slog.DebugContext(ctx, "claude: raw json", "output", rawOut)
 	} else {
-		log.Printf("claude: raw json (truncated): %s", rawOut[:3000])
+		slog.DebugContext(ctx, "claude: raw json (truncated)", "output", rawOut[:3000])
 	}
 
 	var resp struct {
@@ -102,7 +120,7 @@ func (c *ClaudeExecutor) Exec(ctx context.Context, prompt, workDir, sessionID, p
 	if err := json.Unmarshal([]byte(rawOut), &resp); err != nil {
 		return ExecResult{}, fmt.Errorf("failed to parse claude response: %w\nraw: %s", err, rawOut)
 	}
-	log.Printf("claude: parsed result_len=%d session_id=%s is_error=%v subtype=%s denials=%d", len(resp.Result), resp.SessionID, resp.IsError, resp.Subtype, len(resp.PermissionDenials))
+	slog.DebugContext(ctx, "claude: parsed", "result_len", len(resp.Result), "session_id", resp.SessionID, "is_error", resp.IsError, "subtype", resp.Subtype, "denials", len(resp.PermissionDenials))
 	if resp.IsError {
 		errMsg := resp.Result
 		if errMsg == "" {
@@ -152,9 +170,13 @@ func (c *ClaudeExecutor) Model() string {
 // WaitIdle blocks until no execution is running or the timeout expires.
 // Returns true if idle, false if timed out.
 func (c *ClaudeExecutor) WaitIdle(timeout time.Duration) bool {
+	return waitIdle(c.IsRunning, timeout)
+}
+
+func waitIdle(isRunning func() bool, timeout time.Duration) bool {
 	deadline := time.After(timeout)
 	for {
-		if !c.IsRunning() {
+		if !isRunning() {
 			return true
 		}
 		select {
@@ -177,6 +199,10 @@ func (c *ClaudeExecutor) LastExecDuration() time.Duration {
 	return c.lastExecDuration
 }
 
+func (c *ClaudeExecutor) LocalPaths() bool {
+	return true
+}
+
 type permissionDenial struct {
 	ToolName  string          `json:"tool_name"`
 	ToolInput json.RawMessage `json:"tool_input"`
@@ -229,6 +255,8 @@ type streamEvent struct {
 	PermissionDenials []permissionDenial `json:"permission_denials"`
 	Message           json.RawMessage    `json:"message"`
 	Errors            []string           `json:"errors"`
+	Model             string             `json:"model"`
+	CLIVersion        string             `json:"claude_code_version"`
 }
 
 func extractAssistantText(msg json.RawMessage) string {
@@ -257,7 +285,25 @@ func extractAssistantText(msg json.RawMessage) string {
 // It calls onProgress with the text from each assistant message during execution.
 // Returns the final ExecResult when done.
 func (c *ClaudeExecutor) ExecStream(ctx context.Context, prompt, workDir, sessionID, permissionMode, model string, onProgress func(text string)) (ExecResult, error) {
-	args := []string{"-p", prompt, "--output-format", "stream-json", "--verbose"}
+	// Images go in as a stream-json user message when the CLI supports it.
+	var input []byte
+	if images := imagesFrom(ctx); len(images) > 0 {
+		rest := images
+		if c.imageInput() {
+			input, rest = imageInputMessage(prompt, images)
+		}
+		if input == nil {
+			prompt = imagePathPrompt(prompt, rest)
+		}
+	}
+	// The prompt goes in on stdin, as plain text or as the stream-json
+	// message carrying the images, never as an argument (see Exec).
+	args := []string{"-p", "--output-format", "stream-json", "--verbose"}
+	if input != nil {
+		args = []string{"-p", "--input-format", "stream-json", "--output-format", "stream-json", "--verbose"}
+	} else {
+		input = []byte(prompt)
+	}
 	if sessionID != "" {
 		args = append(args, "--resume", sessionID)
 	}
@@ -267,12 +313,42 @@ func (c *ClaudeExecutor) ExecStream(ctx context.Context, prompt, workDir, sessio
 	if permissionMode == "yolo" {
 		args = append(args, "--dangerously-skip-permissions")
 	}
+	scratch := scratchDirFrom(ctx)
+	if scratch != "" {
+		args = append(args, "--add-dir", scratch)
+	}
+	args = append(args, referenceDirArgs(ctx)...)
 
 	ctx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
 
+	var env []string
+	if scratch != "" {
+		env = append(env, "TMPDIR="+scratch)
+	}
+	var gate *deleteGate
+	if guard := deleteGuardFrom(ctx); guard != nil {
+		// Deletions are gated by a PreToolUse hook, which the CLI runs and
+		// waits for before the tool.
+		g, err := startDeleteGate(guard, cancel)
+		if err != nil {
+			return ExecResult{}, fmt.Errorf("failed to start deletion guard: %w", err)
+		}
+		defer g.Close()
+		settings, err := g.settings()
+		if err != nil {
+			return ExecResult{}, fmt.Errorf("failed to start deletion guard: %w", err)
+		}
+		gate = g
+		args = append(args, "--settings", settings)
+		env = append(env, g.env())
+	}
+
 	cmd := exec.CommandContext(ctx, c.claudePath, args...)
 	cmd.Dir = workDir
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -280,6 +356,7 @@ func (c *ClaudeExecutor) ExecStream(ctx context.Context, prompt, workDir, sessio
 	}
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
+	cmd.Stdin = bytes.NewReader(input)
 
 	if err := cmd.Start(); err != nil {
 		return ExecResult{}, fmt.Errorf("failed to start claude: %w", err)
@@ -304,7 +381,7 @@ func (c *ClaudeExecutor) ExecStream(ctx context.Context, prompt, workDir, sessio
 
 		var ev streamEvent
 		if err := json.Unmarshal(line, &ev); err != nil {
-			log.Printf("claude stream: failed to parse line: %v", err)
+			slog.WarnContext(ctx, "claude stream: failed to parse line", "err", err)
 			continue
 		}
 
@@ -315,7 +392,12 @@ func (c *ClaudeExecutor) ExecStream(ctx context.Context, prompt, workDir, sessio
 				onProgress(text)
 			}
 		case "system":
-			log.Printf("claude stream: system event: %s", string(line))
+			slog.DebugContext(ctx, "claude stream: system event", "event", string(line))
+			if ev.Subtype == "init" {
+				result.Model = ev.Model
+				result.CLIVersion = ev.CLIVersion
+				result.SessionID = ev.SessionID
+			}
 		case "result":
 			result.Output = ev.Result
 			result.SessionID = ev.SessionID
@@ -331,7 +413,7 @@ func (c *ClaudeExecutor) ExecStream(ctx context.Context, prompt, workDir, sessio
 				c.execCount++
 				c.lastExecDuration = duration
 				c.mu.Unlock()
-				log.Printf("claude stream: error result raw: %s", string(line))
+				slog.WarnContext(ctx, "claude stream: error result raw", "event", string(line))
 				errMsg := ev.Result
 				if errMsg == "" && len(ev.Errors) > 0 {
 					errMsg = strings.Join(ev.Errors, "; ")
@@ -340,7 +422,7 @@ func (c *ClaudeExecutor) ExecStream(ctx context.Context, prompt, workDir, sessio
 					errMsg = "unknown error"
 				}
 				if stderrStr := stderr.String(); stderrStr != "" {
-					log.Printf("claude stream: stderr: %s", stderrStr)
+					slog.WarnContext(ctx, "claude stream: error result", "stderr", stderrStr)
 					return ExecResult{SessionID: ev.SessionID}, fmt.Errorf("claude error: %s\nstderr: %s", errMsg, stderrStr)
 				}
 				return ExecResult{SessionID: ev.SessionID}, fmt.Errorf("claude error: %s", errMsg)
@@ -358,6 +440,9 @@ func (c *ClaudeExecutor) ExecStream(ctx context.Context, prompt, workDir, sessio
 	c.lastExecDuration = duration
 	c.mu.Unlock()
 
+	if gate != nil && gate.wasRejected() {
+		return ExecResult{SessionID: result.SessionID}, errDeletionRejected
+	}
 	if !gotResult {
 		if ctx.Err() == context.DeadlineExceeded {
 			return ExecResult{}, fmt.Errorf("execution timed out after %v", c.timeout)
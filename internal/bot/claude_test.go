@@ -597,3 +597,45 @@ func TestClaudeExec_StartError(t *testing.T) {
 		t.Fatalf("expected 'failed to start claude' error, got: %v", err)
 	}
 }
+
+// fakeStdinClaude writes a fake CLI to dir that records its arguments and
+// its stdin, then answers in the given output format.
+func fakeStdinClaude(t *testing.T, dir, result string) string {
+	t.Helper()
+	script := filepath.Join(dir, "claude")
+	os.WriteFile(script, []byte(fmt.Sprintf("#!/bin/sh\necho \"$@\" > %[1]s/args\ncat > %[1]s/stdin\necho '%[2]s'\n", dir, result)), 0755)
+	return script
+}
+
+func TestClaudeExec_LargePromptViaStdin(t *testing.T) {
+	dir := t.TempDir()
+	prompt := strings.Repeat("a very long pasted log line\n", 20000) // ~560KB
+	exec := NewClaudeExecutor(fakeStdinClaude(t, dir, `{"result":"ok","session_id":"s1"}`), "sonnet", 30*time.Second)
+	if _, err := exec.Exec(context.Background(), prompt, dir, "", "safe", "sonnet"); err != nil {
+		t.Fatalf("Exec error: %v", err)
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	if strings.Contains(string(args), "pasted log") || !strings.HasPrefix(string(args), "-p --output-format json") {
+		t.Fatalf("prompt must not be passed as an argument, got args %q", truncateRunes(string(args), 100))
+	}
+	if stdin, _ := os.ReadFile(filepath.Join(dir, "stdin")); string(stdin) != prompt {
+		t.Fatalf("expected the whole prompt on stdin, got %d bytes", len(stdin))
+	}
+}
+
+func TestClaudeExecStream_LargePromptViaStdin(t *testing.T) {
+	dir := t.TempDir()
+	prompt := strings.Repeat("第 N 行日志：连接超时\n", 20000) // ~600KB
+	exec := NewClaudeExecutor(fakeStdinClaude(t, dir, `{"type":"result","result":"ok","session_id":"s1"}`), "sonnet", 30*time.Second)
+	result, err := exec.ExecStream(context.Background(), prompt, dir, "", "safe", "sonnet", nil)
+	if err != nil || result.Output != "ok" {
+		t.Fatalf("ExecStream = %+v, %v", result, err)
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	if strings.Contains(string(args), "日志") || strings.Contains(string(args), "--input-format") {
+		t.Fatalf("prompt must not be passed as an argument, got args %q", truncateRunes(string(args), 100))
+	}
+	if stdin, _ := os.ReadFile(filepath.Join(dir, "stdin")); string(stdin) != prompt {
+		t.Fatalf("expected the whole prompt on stdin, got %d bytes", len(stdin))
+	}
+}
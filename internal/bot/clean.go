@@ -0,0 +1,230 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// cleanCommandTimeout bounds each /clean build command.
+const cleanCommandTimeout = 5 * time.Minute
+
+// defaultCleanRules apply to projects without a configured rule, by the
+// marker file found in the repository root.
+var defaultCleanRules = []struct {
+	marker string
+	rule   CleanRule
+}{
+	{"go.mod", CleanRule{Commands: []string{"go clean"}}},
+	{"package.json", CleanRule{Paths: []string{"node_modules/.cache"}}},
+	{"Cargo.toml", CleanRule{Paths: []string{"target"}}},
+}
+
+// validCleanPath reports whether p names something inside a project: a
+// relative path that is not the project itself and does not climb out of
+// it.
+func validCleanPath(p string) bool {
+	p = filepath.Clean(p)
+	return p != "." && !filepath.IsAbs(p) && p != ".." && !strings.HasPrefix(p, ".."+string(filepath.Separator)) && p != ".git" && !strings.HasPrefix(p, ".git"+string(filepath.Separator))
+}
+
+// SetCleanRules sets what /clean build removes in each project.
+func (r *Router) SetCleanRules(rules []CleanRule) {
+	r.cleanRules = rules
+}
+
+// cleanTarget is a path /clean build removes, relative to the repository root.
+type cleanTarget struct {
+	rel  string
+	size int64
+}
+
+// cleanPlan is what /clean build would do in root.
+type cleanPlan struct {
+	root     string
+	targets  []cleanTarget
+	commands []string
+	// skipped are matched paths holding files tracked by git.
+	skipped  []string
+	defaults bool
+}
+
+func (p cleanPlan) empty() bool {
+	return len(p.targets) == 0 && len(p.commands) == 0
+}
+
+func (p cleanPlan) targetSize() int64 {
+	var n int64
+	for _, t := range p.targets {
+		n += t.size
+	}
+	return n
+}
+
+// planClean collects the rules for root, falling back to the defaults for
+// its project type, and resolves their paths.
+func (r *Router) planClean(root string) cleanPlan {
+	plan := cleanPlan{root: root}
+	var rules []CleanRule
+	for _, rule := range r.cleanRules {
+		if r.inProject(rule.Project, root) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		plan.defaults = true
+		for _, d := range defaultCleanRules {
+			if _, err := os.Stat(filepath.Join(root, d.marker)); err == nil {
+				rules = append(rules, d.rule)
+			}
+		}
+	}
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		for _, pattern := range rule.Paths {
+			if !validCleanPath(pattern) {
+				continue
+			}
+			matches, _ := filepath.Glob(filepath.Join(root, pattern))
+			for _, m := range matches {
+				rel, err := filepath.Rel(root, m)
+				if err != nil || !validCleanPath(rel) || seen[rel] {
+					continue
+				}
+				seen[rel] = true
+				if out, err := runGitOutput(root, "ls-files", "--", rel); err == nil && strings.TrimSpace(out) != "" {
+					plan.skipped = append(plan.skipped, rel)
+					continue
+				}
+				plan.targets = append(plan.targets, cleanTarget{rel: rel, size: pathSize(m)})
+			}
+		}
+		plan.commands = append(plan.commands, rule.Commands...)
+	}
+	sort.Slice(plan.targets, func(i, j int) bool { return plan.targets[i].rel < plan.targets[j].rel })
+	return plan
+}
+
+// cmdCleanBuild previews (/clean build) or runs (/clean build run) the
+// cleanup of build artifacts in the current repository.
+func (r *Router) cmdCleanBuild(ctx context.Context, chatID, args string) {
+	session := r.getSession(chatID)
+	dir := session.WorkDir
+	if dir == "" {
+		dir = r.store.WorkRoot()
+	}
+	root := repoRoot(dir)
+	args = strings.TrimSpace(args)
+	if args != "" && args != "run" {
+		r.sender.SendText(ctx, chatID, "用法: /clean build  预览当前项目要清理的构建产物\n       /clean build run  执行清理")
+		return
+	}
+	plan := r.planClean(root)
+	if plan.empty() {
+		msg := fmt.Sprintf("%s 没有可清理的内容。", root)
+		if len(plan.skipped) > 0 {
+			msg += fmt.Sprintf("\n（%s 包含 git 跟踪的文件，已跳过）", strings.Join(plan.skipped, "、"))
+		}
+		if plan.defaults {
+			msg += "\n可在配置文件的 clean_rules 中为项目设置清理的路径和命令。"
+		}
+		r.sender.SendText(ctx, chatID, msg)
+		return
+	}
+	if args == "" {
+		r.sender.SendCard(ctx, chatID, CardMsg{
+			Title:    "🧹 清理预览: " + root,
+			Content:  formatCleanPlan(plan),
+			Template: "orange",
+			Buttons:  []CardButton{{Text: "开始清理", Command: "/clean build run", Type: "danger"}},
+		})
+		return
+	}
+	for _, rec := range r.ActiveExecs() {
+		if rec.ChatID == chatID {
+			r.sender.SendText(ctx, chatID, "当前聊天有任务正在执行，请等待完成后再清理，以免删除正在使用的构建产物。")
+			return
+		}
+	}
+
+	r.sender.SendText(ctx, chatID, "清理中...")
+	var sb strings.Builder
+	failed := false
+	var reclaimed int64
+	for _, t := range plan.targets {
+		if err := os.RemoveAll(filepath.Join(root, t.rel)); err != nil {
+			failed = true
+			fmt.Fprintf(&sb, "✗ 删除 `%s`: %v\n", t.rel, err)
+			continue
+		}
+		reclaimed += t.size
+		fmt.Fprintf(&sb, "✓ 删除 `%s`（%s）\n", t.rel, formatSize(t.size))
+	}
+	if len(plan.commands) > 0 {
+		// Commands may clean anywhere in the project; measure what they
+		// freed there.
+		before := pathSize(root)
+		for _, command := range plan.commands {
+			start := time.Now()
+			out, err := runInDir(ctx, root, cleanCommandTimeout, "sh", "-c", command)
+			elapsed := time.Since(start).Truncate(time.Second)
+			if err != nil {
+				failed = true
+				slog.WarnContext(ctx, "clean: command failed", "command", command, "root", root, "err", err)
+				fmt.Fprintf(&sb, "✗ `%s`（%s）: %v\n", command, elapsed, err)
+				if out = strings.TrimSpace(out); out != "" {
+					fmt.Fprintf(&sb, "```\n%s\n```\n", truncateRunes(out, 1000))
+				}
+				continue
+			}
+			fmt.Fprintf(&sb, "✓ `%s`（%s）\n", command, elapsed)
+		}
+		if freed := before - pathSize(root); freed > 0 {
+			reclaimed += freed
+		}
+	}
+	fmt.Fprintf(&sb, "\n共释放 %s", formatSize(reclaimed))
+	if len(plan.commands) > 0 {
+		sb.WriteString("（不含命令在项目目录以外清理的缓存）")
+	}
+	title, tpl := "🧹 清理完成", "green"
+	if failed {
+		title, tpl = "🧹 清理完成（部分失败）", "orange"
+	}
+	slog.InfoContext(ctx, "clean: reclaimed", "root", root, "bytes", reclaimed, "chat_id", chatID)
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: sb.String(), Template: tpl})
+}
+
+// formatCleanPlan renders the /clean build preview.
+func formatCleanPlan(plan cleanPlan) string {
+	var sb strings.Builder
+	if len(plan.targets) > 0 {
+		sb.WriteString("**将删除:**\n")
+		for _, t := range plan.targets {
+			fmt.Fprintf(&sb, "- `%s`（%s）\n", t.rel, formatSize(t.size))
+		}
+	}
+	if len(plan.commands) > 0 {
+		sb.WriteString("**将运行:**\n")
+		for _, c := range plan.commands {
+			fmt.Fprintf(&sb, "- `%s`\n", c)
+		}
+	}
+	if len(plan.skipped) > 0 {
+		fmt.Fprintf(&sb, "**跳过（包含 git 跟踪的文件）:** %s\n", strings.Join(plan.skipped, "、"))
+	}
+	fmt.Fprintf(&sb, "\n预计释放 %s", formatSize(plan.targetSize()))
+	if len(plan.commands) > 0 {
+		sb.WriteString("，另加命令清理的空间（执行后统计）")
+	}
+	if plan.defaults {
+		sb.WriteString("\n\n未配置本项目的 clean_rules，使用按项目类型的默认规则。")
+	}
+	sb.WriteString("\n\n点击按钮或发送 `/clean build run` 执行清理。")
+	return sb.String()
+}
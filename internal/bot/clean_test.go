@@ -0,0 +1,125 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCleanRouter(t *testing.T, dir string) (*Router, *cardSpySender) {
+	t.Helper()
+	store, _ := NewStore(filepath.Join(t.TempDir(), "state.json"))
+	sender := &cardSpySender{}
+	ex := NewClaudeExecutor("claude", "sonnet", 10*time.Second)
+	return NewRouter(context.Background(), ex, store, sender, map[string]bool{"user1": true}, dir, nil), sender
+}
+
+func TestRouterCleanBuild_PreviewAndRun(t *testing.T) {
+	dir := t.TempDir()
+	initGitRepo(t, dir)
+	os.MkdirAll(filepath.Join(dir, "dist"), 0755)
+	os.WriteFile(filepath.Join(dir, "dist", "app.js"), make([]byte, 2048), 0644)
+	os.WriteFile(filepath.Join(dir, "run.log"), []byte("log"), 0644)
+	os.WriteFile(filepath.Join(dir, "keep.log"), []byte("tracked"), 0644)
+	for _, args := range [][]string{{"add", "keep.log"}, {"commit", "-qm", "init"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	r, sender := newCleanRouter(t, dir)
+	r.SetCleanRules([]CleanRule{
+		{Project: "other", Paths: []string{"src"}},
+		{Paths: []string{"dist", "*.log"}, Commands: []string{"touch cleaned"}},
+	})
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "/clean build")
+	if len(sender.cards) != 1 {
+		t.Fatalf("expected a preview card, got %d cards, texts %q", len(sender.cards), sender.texts)
+	}
+	preview := sender.cards[0]
+	for _, want := range []string{"`dist`（2.0 KB）", "`run.log`", "`touch cleaned`", "跳过（包含 git 跟踪的文件）:** keep.log"} {
+		if !strings.Contains(preview.Content, want) {
+			t.Errorf("preview missing %q:\n%s", want, preview.Content)
+		}
+	}
+	if strings.Contains(preview.Content, "src") || strings.Contains(preview.Content, "默认规则") {
+		t.Errorf("preview used the wrong rules:\n%s", preview.Content)
+	}
+	if len(preview.Buttons) != 1 || preview.Buttons[0].Command != "/clean build run" {
+		t.Fatalf("buttons = %+v", preview.Buttons)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "dist")); err != nil {
+		t.Fatal("preview removed dist")
+	}
+
+	r.Route(ctx, "chat1", "user1", "/clean build run")
+	done := sender.cards[len(sender.cards)-1]
+	if done.Template != "green" || !strings.Contains(done.Content, "✓ 删除 `dist`") || !strings.Contains(done.Content, "共释放 2.0 KB") {
+		t.Fatalf("result card = %+v", done)
+	}
+	for _, gone := range []string{"dist", "run.log"} {
+		if _, err := os.Stat(filepath.Join(dir, gone)); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", gone)
+		}
+	}
+	for _, kept := range []string{"keep.log", "cleaned"} {
+		if _, err := os.Stat(filepath.Join(dir, kept)); err != nil {
+			t.Errorf("%s missing: %v", kept, err)
+		}
+	}
+}
+
+func TestRouterCleanBuild_Defaults(t *testing.T) {
+	dir := t.TempDir()
+	initGitRepo(t, dir)
+	os.WriteFile(filepath.Join(dir, "package.json"), []byte("{}"), 0644)
+	r, sender := newCleanRouter(t, dir)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "/clean build")
+	if len(sender.texts) != 1 || !strings.Contains(sender.texts[0], "没有可清理的内容") || !strings.Contains(sender.texts[0], "clean_rules") {
+		t.Fatalf("texts = %q", sender.texts)
+	}
+
+	os.MkdirAll(filepath.Join(dir, "node_modules", ".cache"), 0755)
+	r.Route(ctx, "chat1", "user1", "/clean build")
+	if len(sender.cards) != 1 || !strings.Contains(sender.cards[0].Content, "`node_modules/.cache`") || !strings.Contains(sender.cards[0].Content, "默认规则") {
+		t.Fatalf("cards = %+v", sender.cards)
+	}
+
+	r.setActive(ExecRecord{ID: "run1", ChatID: "chat1"})
+	r.Route(ctx, "chat1", "user1", "/clean build run")
+	if msg := sender.texts[len(sender.texts)-1]; !strings.Contains(msg, "有任务正在执行") {
+		t.Fatalf("busy = %q", msg)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "node_modules", ".cache")); err != nil {
+		t.Fatal("cache removed while busy")
+	}
+}
+
+func TestValidCleanPath(t *testing.T) {
+	for p, want := range map[string]bool{
+		"target":              true,
+		"node_modules/.cache": true,
+		"*.log":               true,
+		"":                    false,
+		".":                   false,
+		"..":                  false,
+		"../other":            false,
+		"a/../../b":           false,
+		"/tmp":                false,
+		".git":                false,
+		".git/objects":        false,
+	} {
+		if got := validCleanPath(p); got != want {
+			t.Errorf("validCleanPath(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
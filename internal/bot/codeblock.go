@@ -0,0 +1,256 @@
+package bot
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// minCodeRunLines is how many code-looking lines in a row fenceCode needs
+// before it wraps them in a code block.
+const minCodeRunLines = 3
+
+// langByExt maps file extensions to the language tags Feishu highlights.
+var langByExt = map[string]string{
+	".go": "go", ".py": "python", ".js": "javascript", ".mjs": "javascript", ".jsx": "jsx",
+	".ts": "typescript", ".tsx": "tsx", ".java": "java", ".kt": "kotlin", ".swift": "swift",
+	".rs": "rust", ".c": "c", ".h": "c", ".cc": "cpp", ".cpp": "cpp", ".hpp": "cpp",
+	".cs": "csharp", ".rb": "ruby", ".php": "php", ".lua": "lua", ".sh": "bash", ".bash": "bash",
+	".zsh": "bash", ".sql": "sql", ".json": "json", ".yaml": "yaml", ".yml": "yaml",
+	".toml": "toml", ".xml": "xml", ".html": "html", ".css": "css", ".scss": "scss",
+	".md": "markdown", ".proto": "protobuf", ".diff": "diff", ".patch": "diff",
+}
+
+// langForPath returns the language tag for a file name, or "".
+func langForPath(path string) string {
+	base := filepath.Base(path)
+	switch {
+	case base == "Dockerfile" || strings.HasPrefix(base, "Dockerfile."):
+		return "dockerfile"
+	case base == "Makefile" || base == "GNUmakefile":
+		return "makefile"
+	}
+	return langByExt[strings.ToLower(filepath.Ext(base))]
+}
+
+// fileRefRe finds a file name with an extension in prose, e.g. "在 cmd/main.go 中".
+var fileRefRe = regexp.MustCompile(`[\w./-]+\.[A-Za-z]{1,5}\b|\bDockerfile\b|\bMakefile\b`)
+
+// langFromContext returns the language of the last file named in line.
+func langFromContext(line string) string {
+	refs := fileRefRe.FindAllString(line, -1)
+	for i := len(refs) - 1; i >= 0; i-- {
+		if lang := langForPath(refs[i]); lang != "" {
+			return lang
+		}
+	}
+	return ""
+}
+
+// langSignals are content patterns per language; guessLang picks the
+// language with the most matching patterns.
+var langSignals = []struct {
+	lang     string
+	patterns []*regexp.Regexp
+}{
+	{"diff", []*regexp.Regexp{
+		regexp.MustCompile(`(?m)^diff --git `),
+		regexp.MustCompile(`(?m)^@@ -\d+(,\d+)? \+\d+(,\d+)? @@`),
+		regexp.MustCompile(`(?m)^(---|\+\+\+) [ab/]`),
+	}},
+	{"go", []*regexp.Regexp{
+		regexp.MustCompile(`(?m)^package \w+$`),
+		regexp.MustCompile(`(?m)^\s*func (\(\w+ \*?\w+\) )?\w+\(`),
+		regexp.MustCompile(`\w+ :?= `),
+		regexp.MustCompile(`if err != nil`),
+		regexp.MustCompile(`(?m)^import \($`),
+	}},
+	{"python", []*regexp.Regexp{
+		regexp.MustCompile(`(?m)^\s*def \w+\(.*\):\s*$`),
+		regexp.MustCompile(`(?m)^\s*(from [\w.]+ )?import [\w., ]+$`),
+		regexp.MustCompile(`\bself\.\w+`),
+		regexp.MustCompile(`(?m)^\s*(if|elif|for|while|with|class|try|except)\b.*:\s*$`),
+		regexp.MustCompile(`\bprint\(`),
+	}},
+	{"typescript", []*regexp.Regexp{
+		regexp.MustCompile(`(?m)^\s*(export )?(interface|type) \w+`),
+		regexp.MustCompile(`\w+: (string|number|boolean)\b`),
+		regexp.MustCompile(`(?m)^import .* from ['"]`),
+	}},
+	{"javascript", []*regexp.Regexp{
+		regexp.MustCompile(`(?m)^\s*(const|let|var) \w+ = `),
+		regexp.MustCompile(`=> \{?`),
+		regexp.MustCompile(`\bfunction\s*\w*\(`),
+		regexp.MustCompile(`console\.log\(`),
+		regexp.MustCompile(`\brequire\(['"]`),
+	}},
+	{"rust", []*regexp.Regexp{
+		regexp.MustCompile(`(?m)^\s*(pub )?fn \w+`),
+		regexp.MustCompile(`\blet mut \w+`),
+		regexp.MustCompile(`(?m)^\s*(impl|use) \w+`),
+		regexp.MustCompile(`\w+!\(`),
+	}},
+	{"java", []*regexp.Regexp{
+		regexp.MustCompile(`\bpublic (static )?(class|void|final)\b`),
+		regexp.MustCompile(`System\.out\.print`),
+		regexp.MustCompile(`@Override`),
+	}},
+	{"cpp", []*regexp.Regexp{
+		regexp.MustCompile(`(?m)^#include [<"]`),
+		regexp.MustCompile(`\bstd::`),
+		regexp.MustCompile(`(?m)^int main\(`),
+	}},
+	{"sql", []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\bselect\b[\s\S]+\bfrom\b`),
+		regexp.MustCompile(`(?i)^\s*(insert into|update \w+ set|create table|alter table|delete from)\b`),
+	}},
+	{"bash", []*regexp.Regexp{
+		regexp.MustCompile(`(?m)^#!/(usr/)?bin/(env )?(ba)?sh`),
+		regexp.MustCompile(`(?m)^\s*\$ \w+`),
+		regexp.MustCompile(`(?m)^\s*(export \w+=|echo |cd |sudo |apt-get |npm |go (build|test|run) |make\b)`),
+	}},
+	{"yaml", []*regexp.Regexp{
+		regexp.MustCompile(`(?m)^\w[\w-]*:\s*$`),
+		regexp.MustCompile(`(?m)^\s+- \w[\w-]*: `),
+		regexp.MustCompile(`(?m)^\s{2,}\w[\w-]*: \S`),
+	}},
+}
+
+// guessLang returns the language the code most likely is written in, or ""
+// when nothing matches. JSON is recognized by parsing it.
+func guessLang(code string) string {
+	trimmed := strings.TrimSpace(code)
+	if (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)) {
+		return "json"
+	}
+	if strings.HasPrefix(trimmed, "<") && strings.HasSuffix(trimmed, ">") {
+		if strings.HasPrefix(strings.ToLower(trimmed), "<!doctype html") || strings.Contains(trimmed, "</div>") {
+			return "html"
+		}
+		return "xml"
+	}
+	best, bestScore := "", 0
+	for _, s := range langSignals {
+		score := 0
+		for _, p := range s.patterns {
+			if p.MatchString(code) {
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore = s.lang, score
+		}
+	}
+	return best
+}
+
+// codeLineRe matches lines that look like code rather than prose: typical
+// statement starts, or lines ending in a brace, semicolon or colon-opened
+// block.
+var codeLineRe = regexp.MustCompile(`^\s*(func|def|class|import|from|package|return|if|for|while|const|let|var|fn|pub|use|impl|#include|public|private|SELECT|INSERT|UPDATE|CREATE)\b|[{};]\s*$|^\s*[})\]]|^\s*\w[\w.]*(\[.*\])? :?= |^\s*\w[\w.]*\(.*\)\s*$`)
+
+// isCodeLine reports whether an unfenced line looks like code. Markdown
+// structure (lists, headings, tables, quotes) never does.
+func isCodeLine(line string) bool {
+	t := strings.TrimSpace(line)
+	if t == "" || strings.HasPrefix(t, "- ") || strings.HasPrefix(t, "* ") || strings.HasPrefix(t, "#") && !strings.HasPrefix(t, "#include") ||
+		strings.HasPrefix(t, "|") || strings.HasPrefix(t, ">") || strings.HasPrefix(t, "**") {
+		return false
+	}
+	if strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "    ") {
+		return true
+	}
+	return codeLineRe.MatchString(line)
+}
+
+// fenceCode prepares Claude's markdown for a card: fenced blocks without a
+// language get one, from a file named just before the block or from the
+// code itself, and runs of unfenced code lines are wrapped in a fenced
+// block, so Feishu renders them monospaced and highlighted instead of as
+// prose.
+func fenceCode(text string) string {
+	lines := strings.Split(text, "\n")
+	var out []string
+	prose := "" // last prose line, for file names
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			fence := trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, "`"))]
+			end := i + 1
+			for end < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[end]), fence) {
+				end++
+			}
+			if strings.TrimSpace(trimmed[len(fence):]) == "" && end < len(lines) {
+				if lang := blockLang(prose, strings.Join(lines[i+1:end], "\n")); lang != "" {
+					line = line[:strings.Index(line, fence)+len(fence)] + lang
+				}
+			}
+			out = append(out, line)
+			if end < len(lines) {
+				end++
+			}
+			out = append(out, lines[i+1:end]...)
+			i = end
+			continue
+		}
+		if isCodeLine(line) {
+			end, code := i, 0
+			for end < len(lines) && (isCodeLine(lines[end]) || strings.TrimSpace(lines[end]) == "" && end+1 < len(lines) && isCodeLine(lines[end+1])) {
+				if isCodeLine(lines[end]) {
+					code++
+				}
+				end++
+			}
+			block := strings.Join(lines[i:end], "\n")
+			if lang := blockLang(prose, block); code >= minCodeRunLines && lang != "" {
+				out = append(out, "```"+lang, dedent(block), "```")
+				i = end
+				continue
+			}
+		}
+		if trimmed != "" {
+			prose = line
+		}
+		out = append(out, line)
+		i++
+	}
+	return strings.Join(out, "\n")
+}
+
+// blockLang picks a code block's language: a file named in the preceding
+// prose wins over guessing from the content.
+func blockLang(prose, code string) string {
+	if lang := langFromContext(prose); lang != "" {
+		return lang
+	}
+	return guessLang(code)
+}
+
+// dedent removes the indentation every non-blank line of block shares.
+func dedent(block string) string {
+	lines := strings.Split(block, "\n")
+	prefix := ""
+	first := true
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		indent := l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+		if first {
+			prefix, first = indent, false
+			continue
+		}
+		for !strings.HasPrefix(indent, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if prefix == "" {
+		return block
+	}
+	for i, l := range lines {
+		lines[i] = strings.TrimPrefix(l, prefix)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,56 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGuessLang(t *testing.T) {
+	cases := map[string]string{
+		"package main\n\nfunc main() {\n\tif err != nil {\n\t}\n}": "go",
+		"def run(self):\n    print(self.name)":                     "python",
+		"const x = 1;\nconsole.log(x);":                            "javascript",
+		"interface User {\n  name: string;\n}":                     "typescript",
+		"SELECT id FROM users WHERE age > 3;":                      "sql",
+		"#!/bin/sh\necho hi":                                       "bash",
+		`{"a": [1, 2]}`:                                            "json",
+		"diff --git a/x b/x\n@@ -1,2 +1,2 @@\n-a\n+b":              "diff",
+		"#include <stdio.h>\nint main() {}":                        "cpp",
+		"services:\n  api:\n    image: nginx":                      "yaml",
+		"这只是一段普通的说明文字。":                                            "",
+	}
+	for code, want := range cases {
+		if got := guessLang(code); got != want {
+			t.Errorf("guessLang(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func TestLangForPath(t *testing.T) {
+	for path, want := range map[string]string{"cmd/main.go": "go", "a/B.TSX": "tsx", "Dockerfile": "dockerfile", "notes.txt": ""} {
+		if got := langForPath(path); got != want {
+			t.Errorf("langForPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestFenceCode(t *testing.T) {
+	in := "修改 handler.py：\n```\nx = load()\n```\n\n然后运行：\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n\n- 列表项\n- 另一项"
+	want := "修改 handler.py：\n```python\nx = load()\n```\n\n然后运行：\n\n```go\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n```\n\n- 列表项\n- 另一项"
+	if got := fenceCode(in); got != want {
+		t.Fatalf("fenceCode:\n%s\nwant:\n%s", got, want)
+	}
+
+	tagged := "```js\nlet a = 1\n```"
+	if got := fenceCode(tagged); got != tagged {
+		t.Fatalf("expected tagged block unchanged, got %q", got)
+	}
+	prose := "我已经修复了这个问题。\n改动很小，只涉及一个函数。\n请重新运行测试。"
+	if got := fenceCode(prose); got != prose {
+		t.Fatalf("expected prose unchanged, got %q", got)
+	}
+	indented := "示例 config.yaml 写法：\n    server:\n      port: 8080\n      host: 0.0.0.0\n结束"
+	if got := fenceCode(indented); !strings.Contains(got, "```yaml\nserver:\n  port: 8080\n  host: 0.0.0.0\n```\n结束") {
+		t.Fatalf("expected indented block fenced and dedented, got %q", got)
+	}
+}
@@ -2,6 +2,9 @@ package bot
 
 import (
 	"errors"
+	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -14,6 +17,7 @@ type Config struct {
 	AppID          string
 	AppSecret      string
 	AllowedUserIDs map[string]bool
+	AdminUserIDs   map[string]bool // may also run host commands (/ps, /port)
 	BotOpenID      string
 	WorkRoot       string
 	ClaudePath     string
@@ -21,20 +25,304 @@ type Config struct {
 	ClaudeTimeout  int
 	StateFile      string
 	SkipBotSelf    bool
+	// FeedbackButtons shows 👍/👎 buttons under result cards (default true).
+	FeedbackButtons bool
+	WebAddr         string
+	WebToken        string
+	APIToken        string
+	// HookURL is the base URL git hooks installed by /hooks use to reach the
+	// web server; it defaults to the local web_addr.
+	HookURL string
+	// PublicURL is the externally reachable base URL of the web server,
+	// used for /guest links.
+	PublicURL      string
+	ExecutorAddr   string
+	ExecutorListen string
+	ExecutorToken  string
+	Executors      []ExecutorBackend
+	ExecutorTLS    ExecutorTLS
+	// Shared worker pool: QueueWorkers bounds tasks running across all chats
+	// (0 = unlimited); QueueChatLimit bounds each chat's in-flight tasks,
+	// overridden per chat by QueueChatLimits.
+	QueueWorkers    int
+	QueueChatLimit  int
+	QueueChatLimits map[string]int
+	// /json structured output: JSONSchema is an optional JSON Schema file
+	// the payload must satisfy; JSONRetries bounds correction rounds.
+	JSONSchema  string
+	JSONRetries int
+	// CacheFile persists the per-repo knowledge cache.
+	CacheFile string
+	// WatchInterval is the minimum number of seconds between two triggers
+	// of the same /watch rule.
+	WatchInterval int
+	// LicenseDeny lists the dependency licenses /licenses reports as
+	// violations; LicenseBlockPR makes /pr refuse while violations exist.
+	LicenseDeny    []string
+	LicenseBlockPR bool
+	// BuildTargets are the GOOS/GOARCH pairs /buildbin builds by default;
+	// ArtifactDir, if set, stores binaries instead of uploading them.
+	BuildTargets []string
+	ArtifactDir  string
+	// DockerRegistry is where /docker build ... push pushes images, logging
+	// in as DockerUsername with the docker_password secret.
+	DockerRegistry string
+	DockerUsername string
+	// SecretsFile is a YAML map of secret names to values, readable only
+	// by its owner.
+	SecretsFile string
+	// TailServices maps /tail service names to "systemd:<unit>" or
+	// "docker:<container>".
+	TailServices map[string]string
+	// ReferenceDirs maps names to read-only directories, possibly outside
+	// WorkRoot, that /file, /grep --ref and Claude may read but not write.
+	ReferenceDirs map[string]string
+	// DBConnections are the databases /db may query; DBMaxRows bounds the
+	// rows read per query.
+	DBConnections []DBConnection
+	DBMaxRows     int
+	// CurlHosts are the hosts /curl may reach; CurlTimeout (seconds) and
+	// CurlMaxBody (characters shown) bound each request.
+	CurlHosts   []string
+	CurlTimeout int
+	CurlMaxBody int
+	// ScratchDir holds each chat's scratch space for uploads and temporary
+	// files, keeping them out of the repos.
+	ScratchDir string
+	// TrashRetentionDays is how long files saved to .devbot-trash before a
+	// deletion are kept.
+	TrashRetentionDays int
+	// SessionSummaryModel, when set, is the model used to summarize a
+	// session when /new archives it (empty = no summaries).
+	SessionSummaryModel string
+	// CostConfirmTokens is the estimated input size above which prompts
+	// wait for confirmation (0 = never ask).
+	CostConfirmTokens int
+	// ShareProvider is where /share uploads results: "gist" or "paste"
+	// (a 0x0.st-compatible service at ShareURL); empty disables /share.
+	// ShareURL overrides the GitHub API base for gists. Shares expire after
+	// ShareExpiryHours.
+	ShareProvider    string
+	ShareURL         string
+	ShareExpiryHours int
+	// ReportFolder is the Feishu folder token /report week creates its
+	// document in (empty = the app's root folder).
+	ReportFolder string
+	// DriveFolder is the Feishu folder token files too large for the chat
+	// are uploaded to (empty = the app's root folder).
+	DriveFolder string
+	// IssueAfterFailures is how many times the same prompt must fail in a
+	// chat within IssueWindowMinutes before devbot offers a GitHub issue
+	// for it (0 = never); with IssueMode "auto" it files the issue itself.
+	IssueAfterFailures int
+	IssueWindowMinutes int
+	IssueMode          string
+	// BackupDir, when set, receives a copy of the state file every
+	// BackupIntervalHours, keeping the newest BackupKeep; BackupS3URL
+	// (https://host/bucket[/prefix]) additionally uploads each copy to
+	// S3-compatible storage in BackupS3Region.
+	BackupDir           string
+	BackupIntervalHours int
+	BackupKeep          int
+	BackupS3URL         string
+	BackupS3Region      string
+	// CalendarID is the shared Feishu calendar /remind adds its reminders
+	// and scheduled runs to; "" keeps them in the bot only.
+	CalendarID string
+	// ApprovalRules hold matching commands until enough approvers agree.
+	ApprovalRules []ApprovalRule
+	// PromptTemplates are variants of the bot's own prompts by kind
+	// (commit, summary, review), split by weight (see /experiments).
+	PromptTemplates map[string][]PromptTemplate
+	// CleanRules are what /clean build removes in each project.
+	CleanRules []CleanRule
+	// FormatAfterExec formats the files an execution changed before its
+	// result is shown; Formatters override the formatter per extension
+	// (".ts": "npx prettier --write"), the files are appended.
+	FormatAfterExec bool
+	Formatters      map[string]string
+	// OutputProcessors post-process Claude's output before it is sent, in
+	// order (redact, fix_markdown, local_links, translate);
+	// ChatOutputProcessors replace the list for individual chats.
+	// RepoBrowserURL is the local_links URL template ({repo}, {path}, {branch}) and
+	// TranslateTo the translate step's target language.
+	OutputProcessors     []string
+	ChatOutputProcessors map[string][]string
+	RepoBrowserURL       string
+	TranslateTo          string
+	// TestShards is how many concurrent go test processes /test splits a
+	// module's packages across (<= 1 = a single go test ./...).
+	TestShards int
+	// CacheWarmIntervalMinutes, when set, warms the Go build and test
+	// caches of the CacheWarmRepos most used repositories that often while
+	// the bot is idle.
+	CacheWarmIntervalMinutes int
+	CacheWarmRepos           int
+	// MaxPromptChars is the size above which a prompt typed in the chat is
+	// trimmed to its opening, error lines and tail before it reaches Claude;
+	// 0 turns trimming off.
+	MaxPromptChars int
+	// DefaultBranch is the branch chats are expected to work on, RepoSync
+	// how a chat's repository is refreshed ("off", "fetch" or "pull") when
+	// the chat becomes active after RepoSyncIdleMinutes of inactivity.
+	DefaultBranch       string
+	RepoSync            string
+	RepoSyncIdleMinutes int
+	// ReadOnlyUserIDs may only view state (/status, /last, /log, /file);
+	// they are included in AllowedUserIDs.
+	ReadOnlyUserIDs map[string]bool
+	// LogLevel is the initial log level (debug, info, warn or error; /loglevel
+	// changes it at runtime), LogFormat "json" for JSON lines or "text".
+	LogLevel  string
+	LogFormat string
+}
+
+// ExecutorBackend is one member of the executor pool. Addr is a gRPC
+// executor address, or "local" for the in-process Claude CLI. Roots limits
+// the backend to work directories under those paths (empty = all).
+type ExecutorBackend struct {
+	Name  string   `yaml:"name"`
+	Addr  string   `yaml:"addr"`
+	Roots []string `yaml:"roots"`
+}
+
+// ExecutorTLS secures the connection between the frontend and the
+// execution backends. The backend serves CertFile/KeyFile and, with
+// CAFile, requires client certificates signed by it; the frontend verifies
+// backends against CAFile or the system roots and presents
+// CertFile/KeyFile when set. Insecure turns TLS off, which is only allowed
+// on loopback addresses.
+type ExecutorTLS struct {
+	CAFile   string `yaml:"ca_file"`
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	Insecure bool   `yaml:"insecure"`
+}
+
+// ApprovalRule requires Required of Approvers (user IDs) to approve a
+// command matching Command, where "*" matches any text (e.g.
+// "/push *--force*"), before it runs. Name labels the rule on the
+// approval card.
+type ApprovalRule struct {
+	Name      string   `yaml:"name"`
+	Command   string   `yaml:"command"`
+	Approvers []string `yaml:"approvers"`
+	Required  int      `yaml:"required"`
+}
+
+// PromptTemplate is one variant of a prompt the bot writes itself, chosen
+// for Weight out of the kind's total weight. Template replaces the
+// built-in instruction (the output to summarize or the diff to review is
+// appended); "" keeps the built-in one, as a control.
+type PromptTemplate struct {
+	Name     string `yaml:"name"`
+	Weight   int    `yaml:"weight"`
+	Template string `yaml:"template"`
+}
+
+// CleanRule is what /clean build removes in a project: Paths (relative to the
+// repository root, globs allowed, e.g. "node_modules/.cache") and Commands
+// run in the root (e.g. "go clean -cache"). Project limits it like
+// DBConnection.Project.
+type CleanRule struct {
+	Project  string   `yaml:"project"`
+	Paths    []string `yaml:"paths"`
+	Commands []string `yaml:"commands"`
+}
+
+// DBConnection is a database /db can query. Project limits it to chats
+// working in that directory (absolute or relative to work_root; empty =
+// every project) and DSNSecret names the secret holding its DSN.
+type DBConnection struct {
+	Name      string `yaml:"name"`
+	Project   string `yaml:"project"`
+	Driver    string `yaml:"driver"` // postgres or mysql
+	DSNSecret string `yaml:"dsn_secret"`
 }
 
 // yamlConfig mirrors Config for YAML unmarshalling.
 type yamlConfig struct {
-	AppID          string   `yaml:"app_id"`
-	AppSecret      string   `yaml:"app_secret"`
-	AllowedUserIDs []string `yaml:"allowed_user_ids"`
-	BotOpenID      string   `yaml:"bot_open_id"`
-	WorkRoot       string   `yaml:"work_root"`
-	ClaudePath     string   `yaml:"claude_path"`
-	ClaudeModel    string   `yaml:"claude_model"`
-	ClaudeTimeout  int      `yaml:"claude_timeout"`
-	StateFile      string   `yaml:"state_file"`
-	SkipBotSelf    *bool    `yaml:"skip_bot_self"`
+	AppID           string                      `yaml:"app_id"`
+	AppSecret       string                      `yaml:"app_secret"`
+	AllowedUserIDs  []string                    `yaml:"allowed_user_ids"`
+	AdminUserIDs    []string                    `yaml:"admin_user_ids"`
+	ReadOnlyUserIDs []string                    `yaml:"readonly_user_ids"`
+	BotOpenID       string                      `yaml:"bot_open_id"`
+	WorkRoot        string                      `yaml:"work_root"`
+	ClaudePath      string                      `yaml:"claude_path"`
+	ClaudeModel     string                      `yaml:"claude_model"`
+	ClaudeTimeout   int                         `yaml:"claude_timeout"`
+	StateFile       string                      `yaml:"state_file"`
+	SkipBotSelf     *bool                       `yaml:"skip_bot_self"`
+	FeedbackButtons *bool                       `yaml:"feedback_buttons"`
+	WebAddr         string                      `yaml:"web_addr"`
+	WebToken        string                      `yaml:"web_token"`
+	APIToken        string                      `yaml:"api_token"`
+	HookURL         string                      `yaml:"hook_url"`
+	PublicURL       string                      `yaml:"public_url"`
+	ExecutorAddr    string                      `yaml:"executor_addr"`
+	ExecutorListen  string                      `yaml:"executor_listen"`
+	ExecutorToken   string                      `yaml:"executor_token"`
+	Executors       []ExecutorBackend           `yaml:"executors"`
+	ExecutorTLS     ExecutorTLS                 `yaml:"executor_tls"`
+	QueueWorkers    int                         `yaml:"queue_workers"`
+	QueueChatLimit  int                         `yaml:"queue_chat_limit"`
+	QueueChatLimits map[string]int              `yaml:"queue_chat_limits"`
+	JSONSchema      string                      `yaml:"json_schema"`
+	JSONRetries     *int                        `yaml:"json_retries"`
+	CacheFile       string                      `yaml:"cache_file"`
+	WatchInterval   int                         `yaml:"watch_interval"`
+	LicenseDeny     []string                    `yaml:"license_deny"`
+	LicenseBlockPR  bool                        `yaml:"license_block_pr"`
+	BuildTargets    []string                    `yaml:"build_targets"`
+	ArtifactDir     string                      `yaml:"artifact_dir"`
+	DockerRegistry  string                      `yaml:"docker_registry"`
+	DockerUsername  string                      `yaml:"docker_username"`
+	SecretsFile     string                      `yaml:"secrets_file"`
+	TailServices    map[string]string           `yaml:"tail_services"`
+	ReferenceDirs   map[string]string           `yaml:"reference_dirs"`
+	DBConnections   []DBConnection              `yaml:"db_connections"`
+	DBMaxRows       int                         `yaml:"db_max_rows"`
+	CurlHosts       []string                    `yaml:"curl_hosts"`
+	CurlTimeout     int                         `yaml:"curl_timeout"`
+	CurlMaxBody     int                         `yaml:"curl_max_body"`
+	ScratchDir      string                      `yaml:"scratch_dir"`
+	TrashRetention  int                         `yaml:"trash_retention_days"`
+	SummaryModel    string                      `yaml:"session_summary_model"`
+	CostConfirm     int                         `yaml:"cost_confirm_tokens"`
+	ShareProvider   string                      `yaml:"share_provider"`
+	ShareURL        string                      `yaml:"share_url"`
+	ShareExpiry     int                         `yaml:"share_expiry_hours"`
+	ReportFolder    string                      `yaml:"report_folder"`
+	DriveFolder     string                      `yaml:"drive_folder"`
+	IssueAfter      int                         `yaml:"issue_after_failures"`
+	IssueWindow     int                         `yaml:"issue_window_minutes"`
+	IssueMode       string                      `yaml:"issue_mode"`
+	BackupDir       string                      `yaml:"backup_dir"`
+	BackupInterval  int                         `yaml:"backup_interval_hours"`
+	BackupKeep      int                         `yaml:"backup_keep"`
+	BackupS3URL     string                      `yaml:"backup_s3_url"`
+	BackupS3Region  string                      `yaml:"backup_s3_region"`
+	CalendarID      string                      `yaml:"calendar_id"`
+	Approvals       []ApprovalRule              `yaml:"approvals"`
+	PromptTemplates map[string][]PromptTemplate `yaml:"prompt_templates"`
+	CleanRules      []CleanRule                 `yaml:"clean_rules"`
+	FormatAfterExec bool                        `yaml:"format_after_exec"`
+	Formatters      map[string]string           `yaml:"formatters"`
+
+	OutputProcessors     []string            `yaml:"output_processors"`
+	ChatOutputProcessors map[string][]string `yaml:"chat_output_processors"`
+	RepoBrowserURL       string              `yaml:"repo_browser_url"`
+	TranslateTo          string              `yaml:"translate_to"`
+	TestShards           int                 `yaml:"test_shards"`
+	CacheWarmInterval    int                 `yaml:"cache_warm_interval_minutes"`
+	CacheWarmRepos       int                 `yaml:"cache_warm_repos"`
+	MaxPromptChars       *int                `yaml:"max_prompt_chars"`
+	DefaultBranch        string              `yaml:"default_branch"`
+	RepoSync             string              `yaml:"repo_sync"`
+	RepoSyncIdle         int                 `yaml:"repo_sync_idle_minutes"`
+	LogLevel             string              `yaml:"log_level"`
+	LogFormat            string              `yaml:"log_format"`
 }
 
 // LoadConfig loads configuration from environment variables only (backward compatible).
@@ -67,9 +355,67 @@ func LoadConfigFrom(configPath string) (Config, error) {
 		return strings.TrimSpace(os.Getenv(envKey))
 	}
 
+	// Split deployment: executor_listen runs this process as the execution
+	// backend only; executor_addr makes the chat frontend send runs there.
+	executorAddr := pick(yc.ExecutorAddr, "DEVBOT_EXECUTOR_ADDR")
+	executorListen := pick(yc.ExecutorListen, "DEVBOT_EXECUTOR_LISTEN")
+	executorToken := pick(yc.ExecutorToken, "DEVBOT_EXECUTOR_TOKEN")
+	// Executor pool: yaml list, fallback to env comma-separated addresses.
+	executors := yc.Executors
+	if len(executors) == 0 {
+		if raw := strings.TrimSpace(os.Getenv("DEVBOT_EXECUTORS")); raw != "" {
+			for _, addr := range strings.Split(raw, ",") {
+				if addr = strings.TrimSpace(addr); addr != "" {
+					executors = append(executors, ExecutorBackend{Addr: addr})
+				}
+			}
+		}
+	}
+	needsToken := executorAddr != "" || executorListen != ""
+	for i := range executors {
+		if executors[i].Addr == "" {
+			return Config{}, errors.New("executors: addr is required for every backend")
+		}
+		if executors[i].Name == "" {
+			executors[i].Name = executors[i].Addr
+		}
+		if executors[i].Addr != "local" {
+			needsToken = true
+		}
+	}
+	if executorAddr != "" && executorListen != "" {
+		return Config{}, errors.New("executor_addr and executor_listen are mutually exclusive")
+	}
+	if len(executors) > 0 && (executorAddr != "" || executorListen != "") {
+		return Config{}, errors.New("executors cannot be combined with executor_addr or executor_listen")
+	}
+	if needsToken && executorToken == "" {
+		return Config{}, errors.New("executor_token is required when remote executors are configured (config file or DEVBOT_EXECUTOR_TOKEN)")
+	}
+	executorTLS := ExecutorTLS{
+		CAFile:   pick(yc.ExecutorTLS.CAFile, "DEVBOT_EXECUTOR_CA_FILE"),
+		CertFile: pick(yc.ExecutorTLS.CertFile, "DEVBOT_EXECUTOR_CERT_FILE"),
+		KeyFile:  pick(yc.ExecutorTLS.KeyFile, "DEVBOT_EXECUTOR_KEY_FILE"),
+		Insecure: yc.ExecutorTLS.Insecure,
+	}
+	if v := strings.TrimSpace(os.Getenv("DEVBOT_EXECUTOR_INSECURE")); v == "true" || v == "1" {
+		executorTLS.Insecure = true
+	}
+	if (executorTLS.CertFile == "") != (executorTLS.KeyFile == "") {
+		return Config{}, errors.New("executor_tls: cert_file and key_file must be set together")
+	}
+	if executorListen != "" && executorTLS.CertFile == "" && !executorTLS.Insecure {
+		return Config{}, errors.New("executor_listen needs executor_tls.cert_file and key_file (or executor_tls.insecure on a loopback address)")
+	}
+	if executorListen != "" && executorTLS.Insecure && !isLoopbackAddr(executorListen) {
+		return Config{}, fmt.Errorf("executor_tls.insecure is only allowed on a loopback address, not %q", executorListen)
+	}
+	// The execution backend never talks to Feishu.
+	backendOnly := executorListen != ""
+
 	appID := pick(yc.AppID, "DEVBOT_APP_ID")
 	appSecret := pick(yc.AppSecret, "DEVBOT_APP_SECRET")
-	if appID == "" || appSecret == "" {
+	if (appID == "" || appSecret == "") && !backendOnly {
 		return Config{}, errors.New("app_id and app_secret are required (config file or DEVBOT_APP_ID / DEVBOT_APP_SECRET)")
 	}
 
@@ -93,10 +439,43 @@ func LoadConfigFrom(configPath string) (Config, error) {
 			}
 		}
 	}
-	if len(allowedUserIDs) == 0 {
+	if len(allowedUserIDs) == 0 && !backendOnly {
 		return Config{}, errors.New("allowed_user_ids is required (config file or DEVBOT_ALLOWED_USER_IDS)")
 	}
 
+	// Admin user IDs: yaml list, fallback to env comma-separated
+	adminIDs := yc.AdminUserIDs
+	if len(adminIDs) == 0 {
+		if raw := strings.TrimSpace(os.Getenv("DEVBOT_ADMIN_USER_IDS")); raw != "" {
+			adminIDs = strings.Split(raw, ",")
+		}
+	}
+	adminUserIDs := make(map[string]bool)
+	for _, id := range adminIDs {
+		if id = strings.TrimSpace(id); id != "" {
+			adminUserIDs[id] = true
+		}
+	}
+
+	// Read-only user IDs: yaml list, fallback to env comma-separated
+	readOnlyIDs := yc.ReadOnlyUserIDs
+	if len(readOnlyIDs) == 0 {
+		if raw := strings.TrimSpace(os.Getenv("DEVBOT_READONLY_USER_IDS")); raw != "" {
+			readOnlyIDs = strings.Split(raw, ",")
+		}
+	}
+	readOnlyUserIDs := make(map[string]bool)
+	for _, id := range readOnlyIDs {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+		if adminUserIDs[id] {
+			return Config{}, fmt.Errorf("user %s cannot be both an admin and read-only", id)
+		}
+		readOnlyUserIDs[id] = true
+		allowedUserIDs[id] = true
+	}
+
 	home, _ := os.UserHomeDir()
 
 	workRoot := pick(yc.WorkRoot, "DEVBOT_WORK_ROOT")
@@ -131,6 +510,16 @@ func LoadConfigFrom(configPath string) (Config, error) {
 		stateFile = filepath.Join(home, ".devbot", "state.json")
 	}
 
+	cacheFile := pick(yc.CacheFile, "DEVBOT_CACHE_FILE")
+	if cacheFile == "" {
+		cacheFile = filepath.Join(filepath.Dir(stateFile), "knowledge-cache.json")
+	}
+
+	scratchDir := pick(yc.ScratchDir, "DEVBOT_SCRATCH_DIR")
+	if scratchDir == "" {
+		scratchDir = filepath.Join(filepath.Dir(stateFile), "scratch")
+	}
+
 	botOpenID := pick(yc.BotOpenID, "DEVBOT_BOT_OPEN_ID")
 
 	skipBotSelf := true
@@ -140,16 +529,484 @@ func LoadConfigFrom(configPath string) (Config, error) {
 		skipBotSelf = false
 	}
 
+	feedbackButtons := true
+	if yc.FeedbackButtons != nil {
+		feedbackButtons = *yc.FeedbackButtons
+	} else if v := strings.TrimSpace(os.Getenv("DEVBOT_FEEDBACK_BUTTONS")); v == "false" || v == "0" {
+		feedbackButtons = false
+	}
+
+	// Optional read-only dashboard; it is never served without a token.
+	webAddr := pick(yc.WebAddr, "DEVBOT_WEB_ADDR")
+	webToken := pick(yc.WebToken, "DEVBOT_WEB_TOKEN")
+	if webAddr != "" && webToken == "" {
+		return Config{}, errors.New("web_token is required when web_addr is set (config file or DEVBOT_WEB_TOKEN)")
+	}
+	// The REST API shares the web listener but has its own token.
+	apiToken := pick(yc.APIToken, "DEVBOT_API_TOKEN")
+	if apiToken != "" && webAddr == "" {
+		return Config{}, errors.New("web_addr is required when api_token is set (config file or DEVBOT_WEB_ADDR)")
+	}
+
+	// Git hooks run on this host, so by default they reach the web server
+	// over loopback.
+	hookURL := pick(yc.HookURL, "DEVBOT_HOOK_URL")
+	if hookURL != "" && webAddr == "" {
+		return Config{}, errors.New("web_addr is required when hook_url is set (config file or DEVBOT_WEB_ADDR)")
+	}
+	if hookURL == "" && webAddr != "" {
+		hookURL = defaultHookURL(webAddr)
+	}
+	publicURL := pick(yc.PublicURL, "DEVBOT_PUBLIC_URL")
+	if publicURL != "" && webAddr == "" {
+		return Config{}, errors.New("web_addr is required when public_url is set (config file or DEVBOT_WEB_ADDR)")
+	}
+
+	queueWorkers := yc.QueueWorkers
+	if queueWorkers <= 0 {
+		queueWorkers = envInt("DEVBOT_QUEUE_WORKERS")
+	}
+	queueChatLimit := yc.QueueChatLimit
+	if queueChatLimit <= 0 {
+		queueChatLimit = envInt("DEVBOT_QUEUE_CHAT_LIMIT")
+	}
+	if queueChatLimit <= 0 {
+		queueChatLimit = 1
+	}
+
+	watchInterval := yc.WatchInterval
+	if watchInterval <= 0 {
+		watchInterval = envInt("DEVBOT_WATCH_INTERVAL")
+	}
+	if watchInterval <= 0 {
+		watchInterval = 60
+	}
+
+	// License policy: yaml list, fallback to env comma-separated.
+	licenseDeny := yc.LicenseDeny
+	if len(licenseDeny) == 0 {
+		if raw := strings.TrimSpace(os.Getenv("DEVBOT_LICENSE_DENY")); raw != "" {
+			for _, l := range strings.Split(raw, ",") {
+				if l = strings.TrimSpace(l); l != "" {
+					licenseDeny = append(licenseDeny, l)
+				}
+			}
+		}
+	}
+	licenseBlockPR := yc.LicenseBlockPR
+	if v := strings.TrimSpace(os.Getenv("DEVBOT_LICENSE_BLOCK_PR")); v == "true" || v == "1" {
+		licenseBlockPR = true
+	}
+
+	buildTargets := yc.BuildTargets
+	if len(buildTargets) == 0 {
+		if raw := strings.TrimSpace(os.Getenv("DEVBOT_BUILD_TARGETS")); raw != "" {
+			buildTargets = strings.Split(raw, ",")
+		}
+	}
+	for i, t := range buildTargets {
+		buildTargets[i] = strings.TrimSpace(t)
+		if !validBuildTarget(buildTargets[i]) {
+			return Config{}, fmt.Errorf("build_targets: invalid target %q (want goos/goarch, e.g. linux/amd64)", t)
+		}
+	}
+	artifactDir := pick(yc.ArtifactDir, "DEVBOT_ARTIFACT_DIR")
+	dockerRegistry := pick(yc.DockerRegistry, "DEVBOT_DOCKER_REGISTRY")
+	dockerUsername := pick(yc.DockerUsername, "DEVBOT_DOCKER_USERNAME")
+	secretsFile := pick(yc.SecretsFile, "DEVBOT_SECRETS_FILE")
+	seen := make(map[string]bool)
+	for _, c := range yc.DBConnections {
+		switch {
+		case c.Name == "" || c.DSNSecret == "":
+			return Config{}, errors.New("db_connections: name and dsn_secret are required")
+		case !dbDrivers[c.Driver]:
+			return Config{}, fmt.Errorf("db_connections: unsupported driver %q for %s (want postgres or mysql)", c.Driver, c.Name)
+		case seen[c.Name+"\x00"+c.Project]:
+			return Config{}, fmt.Errorf("db_connections: duplicate connection %s", c.Name)
+		}
+		seen[c.Name+"\x00"+c.Project] = true
+	}
+	approvals := yc.Approvals
+	for i, a := range approvals {
+		switch {
+		case !strings.HasPrefix(a.Command, "/"):
+			return Config{}, fmt.Errorf("approvals: command %q must start with /", a.Command)
+		case len(a.Approvers) == 0:
+			return Config{}, fmt.Errorf("approvals: %s needs approvers", a.Command)
+		case a.Required < 0 || a.Required > len(a.Approvers):
+			return Config{}, fmt.Errorf("approvals: %s requires %d of %d approvers", a.Command, a.Required, len(a.Approvers))
+		}
+		if a.Required == 0 {
+			approvals[i].Required = 1
+		}
+	}
+	for kind, variants := range yc.PromptTemplates {
+		if _, ok := builtinTemplates[kind]; !ok {
+			return Config{}, fmt.Errorf("prompt_templates: unknown prompt %q (want commit, summary or review)", kind)
+		}
+		if len(variants) == 0 {
+			return Config{}, fmt.Errorf("prompt_templates: %s has no variants", kind)
+		}
+		names := make(map[string]bool)
+		for i, v := range variants {
+			switch {
+			case v.Name == "" || strings.ContainsAny(v.Name, " /\t"):
+				return Config{}, fmt.Errorf("prompt_templates: %s variant %q needs a name without spaces or slashes", kind, v.Name)
+			case names[v.Name]:
+				return Config{}, fmt.Errorf("prompt_templates: duplicate %s variant %s", kind, v.Name)
+			case v.Weight < 0:
+				return Config{}, fmt.Errorf("prompt_templates: %s/%s has a negative weight", kind, v.Name)
+			}
+			names[v.Name] = true
+			if v.Weight == 0 {
+				variants[i].Weight = 1
+			}
+		}
+	}
+	for _, c := range yc.CleanRules {
+		if len(c.Paths) == 0 && len(c.Commands) == 0 {
+			return Config{}, fmt.Errorf("clean_rules: rule for project %q needs paths or commands", c.Project)
+		}
+		for _, p := range c.Paths {
+			if !validCleanPath(p) {
+				return Config{}, fmt.Errorf("clean_rules: path %q must be relative to the project and stay inside it", p)
+			}
+		}
+	}
+	for ext, command := range yc.Formatters {
+		if !strings.HasPrefix(ext, ".") || strings.TrimSpace(command) == "" {
+			return Config{}, fmt.Errorf("formatters: %q needs a file extension starting with \".\" and a command", ext)
+		}
+	}
+	repoBrowserURL := pick(yc.RepoBrowserURL, "DEVBOT_REPO_BROWSER_URL")
+	translateTo := pick(yc.TranslateTo, "DEVBOT_TRANSLATE_TO")
+	pipelines := map[string][]string{"output_processors": yc.OutputProcessors}
+	for chat, names := range yc.ChatOutputProcessors {
+		pipelines["chat_output_processors."+chat] = names
+	}
+	for key, names := range pipelines {
+		for _, name := range names {
+			if _, ok := outputProcessors[name]; !ok {
+				return Config{}, fmt.Errorf("%s: unknown processor %q (redact, fix_markdown, local_links, translate)", key, name)
+			}
+			if name == "local_links" && repoBrowserURL == "" {
+				return Config{}, fmt.Errorf("%s: local_links requires repo_browser_url", key)
+			}
+			if name == "translate" && translateTo == "" {
+				return Config{}, fmt.Errorf("%s: translate requires translate_to", key)
+			}
+		}
+	}
+	testShards := yc.TestShards
+	if testShards == 0 {
+		testShards = envInt("DEVBOT_TEST_SHARDS")
+	}
+	if testShards < 0 {
+		return Config{}, errors.New("test_shards must not be negative")
+	}
+	cacheWarmInterval := yc.CacheWarmInterval
+	if cacheWarmInterval == 0 {
+		cacheWarmInterval = envInt("DEVBOT_CACHE_WARM_INTERVAL_MINUTES")
+	}
+	cacheWarmRepos := yc.CacheWarmRepos
+	if cacheWarmRepos == 0 {
+		cacheWarmRepos = envInt("DEVBOT_CACHE_WARM_REPOS")
+	}
+	if cacheWarmInterval < 0 || cacheWarmRepos < 0 {
+		return Config{}, errors.New("cache_warm_interval_minutes and cache_warm_repos must not be negative")
+	}
+	if cacheWarmRepos == 0 {
+		cacheWarmRepos = 3
+	}
+	maxPromptChars := defaultMaxPromptChars
+	if yc.MaxPromptChars != nil {
+		maxPromptChars = *yc.MaxPromptChars
+	} else if v := strings.TrimSpace(os.Getenv("DEVBOT_MAX_PROMPT_CHARS")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			maxPromptChars = n
+		}
+	}
+	if maxPromptChars < 0 || maxPromptChars != 0 && maxPromptChars < 1000 {
+		return Config{}, errors.New("max_prompt_chars must be 0 (no trimming) or at least 1000")
+	}
+	repoSync := pick(yc.RepoSync, "DEVBOT_REPO_SYNC")
+	if repoSync != "" && !validRepoSyncMode(repoSync) {
+		return Config{}, fmt.Errorf("repo_sync must be off, fetch or pull, got %q", repoSync)
+	}
+	repoSyncIdle := yc.RepoSyncIdle
+	if repoSyncIdle == 0 {
+		repoSyncIdle = envInt("DEVBOT_REPO_SYNC_IDLE_MINUTES")
+	}
+	if repoSyncIdle < 0 {
+		return Config{}, errors.New("repo_sync_idle_minutes must not be negative")
+	}
+	dbMaxRows := yc.DBMaxRows
+	if dbMaxRows == 0 {
+		dbMaxRows = envInt("DEVBOT_DB_MAX_ROWS")
+	}
+	if dbMaxRows < 0 {
+		return Config{}, errors.New("db_max_rows must not be negative")
+	}
+	curlHosts := yc.CurlHosts
+	if len(curlHosts) == 0 {
+		if raw := strings.TrimSpace(os.Getenv("DEVBOT_CURL_HOSTS")); raw != "" {
+			curlHosts = strings.Split(raw, ",")
+		}
+	}
+	for i, h := range curlHosts {
+		curlHosts[i] = strings.TrimSpace(h)
+	}
+	curlTimeout := yc.CurlTimeout
+	if curlTimeout == 0 {
+		curlTimeout = envInt("DEVBOT_CURL_TIMEOUT")
+	}
+	curlMaxBody := yc.CurlMaxBody
+	if curlMaxBody == 0 {
+		curlMaxBody = envInt("DEVBOT_CURL_MAX_BODY")
+	}
+	if curlTimeout < 0 || curlMaxBody < 0 {
+		return Config{}, errors.New("curl_timeout and curl_max_body must not be negative")
+	}
+	trashRetention := yc.TrashRetention
+	if trashRetention == 0 {
+		trashRetention = envInt("DEVBOT_TRASH_RETENTION_DAYS")
+	}
+	if trashRetention < 0 {
+		return Config{}, errors.New("trash_retention_days must not be negative")
+	}
+	costConfirm := yc.CostConfirm
+	if costConfirm == 0 {
+		costConfirm = envInt("DEVBOT_COST_CONFIRM_TOKENS")
+	}
+	if costConfirm < 0 {
+		return Config{}, errors.New("cost_confirm_tokens must not be negative")
+	}
+	shareProvider := pick(yc.ShareProvider, "DEVBOT_SHARE_PROVIDER")
+	shareURL := pick(yc.ShareURL, "DEVBOT_SHARE_URL")
+	switch shareProvider {
+	case "", "gist":
+	case "paste":
+		if shareURL == "" {
+			return Config{}, errors.New("share_provider paste requires share_url")
+		}
+	default:
+		return Config{}, fmt.Errorf("share_provider must be gist or paste, got %q", shareProvider)
+	}
+	shareExpiry := yc.ShareExpiry
+	if shareExpiry == 0 {
+		shareExpiry = envInt("DEVBOT_SHARE_EXPIRY_HOURS")
+	}
+	if shareExpiry < 0 {
+		return Config{}, errors.New("share_expiry_hours must not be negative")
+	}
+	issueAfter := yc.IssueAfter
+	if issueAfter == 0 {
+		issueAfter = envInt("DEVBOT_ISSUE_AFTER_FAILURES")
+	}
+	issueWindow := yc.IssueWindow
+	if issueWindow == 0 {
+		issueWindow = envInt("DEVBOT_ISSUE_WINDOW_MINUTES")
+	}
+	if issueAfter < 0 || issueWindow < 0 {
+		return Config{}, errors.New("issue_after_failures and issue_window_minutes must not be negative")
+	}
+	if issueWindow == 0 {
+		issueWindow = 60
+	}
+	issueMode := pick(yc.IssueMode, "DEVBOT_ISSUE_MODE")
+	switch issueMode {
+	case "":
+		issueMode = "offer"
+	case "offer", "auto":
+	default:
+		return Config{}, fmt.Errorf("issue_mode must be offer or auto, got %q", issueMode)
+	}
+	logLevel := strings.ToLower(pick(yc.LogLevel, "DEVBOT_LOG_LEVEL"))
+	if logLevel == "" {
+		logLevel = "info"
+	} else if _, err := parseLogLevel(logLevel); err != nil {
+		return Config{}, fmt.Errorf("log_level: %w", err)
+	}
+	logFormat := pick(yc.LogFormat, "DEVBOT_LOG_FORMAT")
+	switch logFormat {
+	case "":
+		logFormat = "text"
+	case "text", "json":
+	default:
+		return Config{}, fmt.Errorf("log_format must be text or json, got %q", logFormat)
+	}
+	backupInterval := yc.BackupInterval
+	if backupInterval == 0 {
+		backupInterval = envInt("DEVBOT_BACKUP_INTERVAL_HOURS")
+	}
+	backupKeep := yc.BackupKeep
+	if backupKeep == 0 {
+		backupKeep = envInt("DEVBOT_BACKUP_KEEP")
+	}
+	if backupInterval < 0 || backupKeep < 0 {
+		return Config{}, errors.New("backup_interval_hours and backup_keep must not be negative")
+	}
+	if backupInterval == 0 {
+		backupInterval = 24
+	}
+	if backupKeep == 0 {
+		backupKeep = 7
+	}
+	backupDir := pick(yc.BackupDir, "DEVBOT_BACKUP_DIR")
+	backupS3URL := pick(yc.BackupS3URL, "DEVBOT_BACKUP_S3_URL")
+	if backupS3URL != "" {
+		if backupDir == "" {
+			return Config{}, errors.New("backup_dir is required when backup_s3_url is set")
+		}
+		if u, err := url.Parse(backupS3URL); err != nil || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+			return Config{}, fmt.Errorf("backup_s3_url must look like https://host/bucket[/prefix], got %q", backupS3URL)
+		}
+	}
+	backupS3Region := pick(yc.BackupS3Region, "DEVBOT_BACKUP_S3_REGION")
+	if backupS3Region == "" {
+		backupS3Region = "us-east-1"
+	}
+	for name, spec := range yc.TailServices {
+		if !validTailService(spec) {
+			return Config{}, fmt.Errorf("tail_services: invalid source %q for %s (want systemd:<unit> or docker:<container>)", spec, name)
+		}
+	}
+	for name, dir := range yc.ReferenceDirs {
+		if name == "" || strings.ContainsAny(name, `/\`) {
+			return Config{}, fmt.Errorf("reference_dirs: invalid name %q", name)
+		}
+		if !filepath.IsAbs(dir) {
+			return Config{}, fmt.Errorf("reference_dirs: %s must be an absolute path, got %q", name, dir)
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return Config{}, fmt.Errorf("reference_dirs: %s (%s) is not a directory", name, dir)
+		}
+		if dir = filepath.Clean(dir); underRoot(dir, filepath.Clean(workRoot)) {
+			return Config{}, fmt.Errorf("reference_dirs: %s (%s) contains work_root, which must stay writable", name, dir)
+		}
+	}
+
+	jsonSchema := pick(yc.JSONSchema, "DEVBOT_JSON_SCHEMA")
+	jsonRetries := defaultJSONRetries
+	if yc.JSONRetries != nil {
+		jsonRetries = *yc.JSONRetries
+	} else if v := strings.TrimSpace(os.Getenv("DEVBOT_JSON_RETRIES")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			jsonRetries = n
+		}
+	}
+	if jsonRetries < 0 {
+		return Config{}, errors.New("json_retries must not be negative")
+	}
+
 	return Config{
-		AppID:          appID,
-		AppSecret:      appSecret,
-		AllowedUserIDs: allowedUserIDs,
-		BotOpenID:      botOpenID,
-		WorkRoot:       workRoot,
-		ClaudePath:     claudePath,
-		ClaudeModel:    claudeModel,
-		ClaudeTimeout:  claudeTimeout,
-		StateFile:      stateFile,
-		SkipBotSelf:    skipBotSelf,
+		AppID:           appID,
+		AppSecret:       appSecret,
+		AllowedUserIDs:  allowedUserIDs,
+		AdminUserIDs:    adminUserIDs,
+		ReadOnlyUserIDs: readOnlyUserIDs,
+		BotOpenID:       botOpenID,
+		WorkRoot:        workRoot,
+		ClaudePath:      claudePath,
+		ClaudeModel:     claudeModel,
+		ClaudeTimeout:   claudeTimeout,
+		StateFile:       stateFile,
+		SkipBotSelf:     skipBotSelf,
+		FeedbackButtons: feedbackButtons,
+		WebAddr:         webAddr,
+		WebToken:        webToken,
+		APIToken:        apiToken,
+		HookURL:         hookURL,
+		PublicURL:       publicURL,
+		ExecutorAddr:    executorAddr,
+		ExecutorListen:  executorListen,
+		ExecutorToken:   executorToken,
+		Executors:       executors,
+		ExecutorTLS:     executorTLS,
+		QueueWorkers:    queueWorkers,
+		QueueChatLimit:  queueChatLimit,
+		QueueChatLimits: yc.QueueChatLimits,
+		JSONSchema:      jsonSchema,
+		JSONRetries:     jsonRetries,
+		CacheFile:       cacheFile,
+		WatchInterval:   watchInterval,
+		LicenseDeny:     licenseDeny,
+		LicenseBlockPR:  licenseBlockPR,
+		BuildTargets:    buildTargets,
+		ArtifactDir:     artifactDir,
+		DockerRegistry:  dockerRegistry,
+		DockerUsername:  dockerUsername,
+		SecretsFile:     secretsFile,
+		TailServices:    yc.TailServices,
+		ReferenceDirs:   yc.ReferenceDirs,
+		DBConnections:   yc.DBConnections,
+		DBMaxRows:       dbMaxRows,
+		CurlHosts:       curlHosts,
+		CurlTimeout:     curlTimeout,
+		CurlMaxBody:     curlMaxBody,
+		ScratchDir:      scratchDir,
+
+		TrashRetentionDays:  trashRetention,
+		SessionSummaryModel: pick(yc.SummaryModel, "DEVBOT_SESSION_SUMMARY_MODEL"),
+		CostConfirmTokens:   costConfirm,
+		ShareProvider:       shareProvider,
+		ShareURL:            shareURL,
+		ShareExpiryHours:    shareExpiry,
+		ReportFolder:        pick(yc.ReportFolder, "DEVBOT_REPORT_FOLDER"),
+		DriveFolder:         pick(yc.DriveFolder, "DEVBOT_DRIVE_FOLDER"),
+		IssueAfterFailures:  issueAfter,
+		IssueWindowMinutes:  issueWindow,
+		IssueMode:           issueMode,
+		BackupDir:           backupDir,
+		BackupIntervalHours: backupInterval,
+		BackupKeep:          backupKeep,
+		BackupS3URL:         backupS3URL,
+		BackupS3Region:      backupS3Region,
+		CalendarID:          pick(yc.CalendarID, "DEVBOT_CALENDAR_ID"),
+		ApprovalRules:       approvals,
+		PromptTemplates:     yc.PromptTemplates,
+		CleanRules:          yc.CleanRules,
+		FormatAfterExec:     yc.FormatAfterExec,
+		Formatters:          yc.Formatters,
+
+		OutputProcessors:     yc.OutputProcessors,
+		ChatOutputProcessors: yc.ChatOutputProcessors,
+		RepoBrowserURL:       repoBrowserURL,
+		TranslateTo:          translateTo,
+		TestShards:           testShards,
+
+		CacheWarmIntervalMinutes: cacheWarmInterval,
+		CacheWarmRepos:           cacheWarmRepos,
+		MaxPromptChars:           maxPromptChars,
+
+		DefaultBranch:       pick(yc.DefaultBranch, "DEVBOT_DEFAULT_BRANCH"),
+		RepoSync:            repoSync,
+		RepoSyncIdleMinutes: repoSyncIdle,
+		LogLevel:            logLevel,
+		LogFormat:           logFormat,
 	}, nil
 }
+
+// envInt parses a positive integer environment variable, returning 0 when
+// it is unset or invalid.
+func envInt(key string) int {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+// defaultHookURL returns the loopback URL of the web server listening on
+// addr; wildcard hosts are replaced by 127.0.0.1.
+func defaultHookURL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://" + addr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
@@ -3,6 +3,7 @@ package bot
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -68,6 +69,9 @@ func TestLoadConfigDefaults(t *testing.T) {
 	if !cfg.SkipBotSelf {
 		t.Fatalf("expected default SkipBotSelf true")
 	}
+	if !cfg.FeedbackButtons {
+		t.Fatalf("expected default FeedbackButtons true")
+	}
 }
 
 func TestLoadConfigCustomValues(t *testing.T) {
@@ -80,6 +84,7 @@ func TestLoadConfigCustomValues(t *testing.T) {
 	t.Setenv("DEVBOT_CLAUDE_TIMEOUT", "300")
 	t.Setenv("DEVBOT_STATE_FILE", "/tmp/state.json")
 	t.Setenv("DEVBOT_SKIP_BOT_SELF", "false")
+	t.Setenv("DEVBOT_FEEDBACK_BUTTONS", "0")
 
 	cfg, err := LoadConfig()
 	if err != nil {
@@ -103,6 +108,9 @@ func TestLoadConfigCustomValues(t *testing.T) {
 	if cfg.SkipBotSelf {
 		t.Fatalf("SkipBotSelf should be false")
 	}
+	if cfg.FeedbackButtons {
+		t.Fatalf("FeedbackButtons should be false")
+	}
 }
 
 func TestLoadConfigFromYAML(t *testing.T) {
@@ -245,3 +253,919 @@ func TestLoadConfigFromInvalidYAML(t *testing.T) {
 		t.Fatalf("expected error for invalid YAML")
 	}
 }
+
+func TestLoadConfigWebRequiresToken(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_WEB_ADDR", ":8080")
+	t.Setenv("DEVBOT_WEB_TOKEN", "")
+
+	if _, err := LoadConfig(); err == nil {
+		t.Fatalf("expected error when web_addr is set without web_token")
+	}
+
+	t.Setenv("DEVBOT_WEB_TOKEN", "tok")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.WebAddr != ":8080" || cfg.WebToken != "tok" {
+		t.Fatalf("web config mismatch: %q %q", cfg.WebAddr, cfg.WebToken)
+	}
+}
+
+func TestLoadConfigAPITokenRequiresWebAddr(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_WEB_ADDR", "")
+	t.Setenv("DEVBOT_WEB_TOKEN", "")
+	t.Setenv("DEVBOT_API_TOKEN", "apitok")
+
+	if _, err := LoadConfig(); err == nil {
+		t.Fatalf("expected error when api_token is set without web_addr")
+	}
+
+	t.Setenv("DEVBOT_WEB_ADDR", ":8080")
+	t.Setenv("DEVBOT_WEB_TOKEN", "tok")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.APIToken != "apitok" {
+		t.Fatalf("expected APIToken apitok, got %q", cfg.APIToken)
+	}
+}
+
+func TestLoadConfigExecutor(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_EXECUTOR_ADDR", "backend:7070")
+	t.Setenv("DEVBOT_EXECUTOR_LISTEN", "")
+	t.Setenv("DEVBOT_EXECUTOR_TOKEN", "")
+
+	if _, err := LoadConfig(); err == nil {
+		t.Fatalf("expected error when executor_addr is set without executor_token")
+	}
+
+	t.Setenv("DEVBOT_EXECUTOR_TOKEN", "tok")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ExecutorAddr != "backend:7070" || cfg.ExecutorToken != "tok" {
+		t.Fatalf("executor config mismatch: %q %q", cfg.ExecutorAddr, cfg.ExecutorToken)
+	}
+
+	t.Setenv("DEVBOT_EXECUTOR_LISTEN", ":7070")
+	if _, err := LoadConfig(); err == nil {
+		t.Fatalf("expected error when both executor_addr and executor_listen are set")
+	}
+}
+
+func TestLoadConfigExecutorBackendNeedsNoFeishu(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "")
+	t.Setenv("DEVBOT_APP_SECRET", "")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "")
+	t.Setenv("DEVBOT_EXECUTOR_ADDR", "")
+	t.Setenv("DEVBOT_EXECUTOR_LISTEN", ":7070")
+	t.Setenv("DEVBOT_EXECUTOR_TOKEN", "tok")
+	t.Setenv("DEVBOT_EXECUTOR_CERT_FILE", "/etc/devbot/executor.crt")
+	t.Setenv("DEVBOT_EXECUTOR_KEY_FILE", "/etc/devbot/executor.key")
+	t.Setenv("DEVBOT_EXECUTOR_INSECURE", "")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("expected backend-only config to load without Feishu credentials: %v", err)
+	}
+	if cfg.ExecutorListen != ":7070" || cfg.ExecutorTLS.CertFile != "/etc/devbot/executor.crt" {
+		t.Fatalf("unexpected executor config %q %+v", cfg.ExecutorListen, cfg.ExecutorTLS)
+	}
+}
+
+func TestLoadConfigExecutorTLS(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "")
+	t.Setenv("DEVBOT_APP_SECRET", "")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "")
+	t.Setenv("DEVBOT_EXECUTOR_ADDR", "")
+	t.Setenv("DEVBOT_EXECUTOR_LISTEN", ":7070")
+	t.Setenv("DEVBOT_EXECUTOR_TOKEN", "tok")
+	t.Setenv("DEVBOT_EXECUTOR_CERT_FILE", "")
+	t.Setenv("DEVBOT_EXECUTOR_KEY_FILE", "")
+	t.Setenv("DEVBOT_EXECUTOR_INSECURE", "")
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("expected a backend without a certificate refused")
+	}
+	t.Setenv("DEVBOT_EXECUTOR_CERT_FILE", "/etc/devbot/executor.crt")
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("expected a certificate without a key refused")
+	}
+
+	t.Setenv("DEVBOT_EXECUTOR_CERT_FILE", "")
+	t.Setenv("DEVBOT_EXECUTOR_INSECURE", "true")
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("expected plaintext refused on every interface")
+	}
+	t.Setenv("DEVBOT_EXECUTOR_LISTEN", "127.0.0.1:7070")
+	if cfg, err := LoadConfig(); err != nil || !cfg.ExecutorTLS.Insecure {
+		t.Fatalf("expected plaintext allowed on loopback: %+v %v", cfg.ExecutorTLS, err)
+	}
+}
+
+func TestLoadConfigExecutorPool(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "")
+	t.Setenv("DEVBOT_APP_SECRET", "")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "")
+	t.Setenv("DEVBOT_EXECUTORS", "")
+	t.Setenv("DEVBOT_EXECUTOR_ADDR", "")
+	t.Setenv("DEVBOT_EXECUTOR_LISTEN", "")
+	t.Setenv("DEVBOT_EXECUTOR_TOKEN", "")
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(cfgPath, []byte(`
+app_id: "a"
+app_secret: "s"
+allowed_user_ids: ["u"]
+executors:
+  - addr: local
+  - name: gpu-1
+    addr: "10.0.0.5:7070"
+    roots: ["/src/ml"]
+`), 0644)
+
+	if _, err := LoadConfigFrom(cfgPath); err == nil {
+		t.Fatalf("expected error when remote executors have no executor_token")
+	}
+
+	t.Setenv("DEVBOT_EXECUTOR_TOKEN", "tok")
+	cfg, err := LoadConfigFrom(cfgPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Executors) != 2 || cfg.Executors[0].Name != "local" || cfg.Executors[1].Name != "gpu-1" || cfg.Executors[1].Roots[0] != "/src/ml" {
+		t.Fatalf("unexpected executors: %+v", cfg.Executors)
+	}
+
+	t.Setenv("DEVBOT_EXECUTOR_ADDR", "backend:7070")
+	if _, err := LoadConfigFrom(cfgPath); err == nil {
+		t.Fatalf("expected error combining executors with executor_addr")
+	}
+}
+
+func TestLoadConfigExecutorPoolFromEnv(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_EXECUTOR_ADDR", "")
+	t.Setenv("DEVBOT_EXECUTOR_LISTEN", "")
+	t.Setenv("DEVBOT_EXECUTOR_TOKEN", "")
+	t.Setenv("DEVBOT_EXECUTORS", "local")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("local-only pool should not need a token: %v", err)
+	}
+	if len(cfg.Executors) != 1 || cfg.Executors[0].Addr != "local" {
+		t.Fatalf("unexpected executors: %+v", cfg.Executors)
+	}
+}
+
+func TestLoadConfigQueueLimits(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_QUEUE_WORKERS", "")
+	t.Setenv("DEVBOT_QUEUE_CHAT_LIMIT", "")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.QueueWorkers != 0 || cfg.QueueChatLimit != 1 {
+		t.Fatalf("expected unlimited workers and chat limit 1 by default, got %d/%d", cfg.QueueWorkers, cfg.QueueChatLimit)
+	}
+
+	t.Setenv("DEVBOT_QUEUE_WORKERS", "4")
+	t.Setenv("DEVBOT_QUEUE_CHAT_LIMIT", "2")
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(cfgPath, []byte("queue_chat_limits:\n  oc_ci: 3\n"), 0644)
+	cfg, err = LoadConfigFrom(cfgPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.QueueWorkers != 4 || cfg.QueueChatLimit != 2 || cfg.QueueChatLimits["oc_ci"] != 3 {
+		t.Fatalf("queue limits mismatch: %+v", cfg)
+	}
+}
+
+func TestLoadConfigJSONMode(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_JSON_SCHEMA", "")
+	t.Setenv("DEVBOT_JSON_RETRIES", "")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.JSONSchema != "" || cfg.JSONRetries != defaultJSONRetries {
+		t.Fatalf("expected no schema and default retries, got %q/%d", cfg.JSONSchema, cfg.JSONRetries)
+	}
+
+	t.Setenv("DEVBOT_JSON_SCHEMA", "/etc/devbot/result.schema.json")
+	t.Setenv("DEVBOT_JSON_RETRIES", "5")
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(cfgPath, []byte("json_retries: 0\n"), 0644)
+	cfg, err = LoadConfigFrom(cfgPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.JSONSchema != "/etc/devbot/result.schema.json" || cfg.JSONRetries != 0 {
+		t.Fatalf("expected env schema and yaml retries 0, got %q/%d", cfg.JSONSchema, cfg.JSONRetries)
+	}
+
+	t.Setenv("DEVBOT_JSON_RETRIES", "-1")
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("expected error for negative json_retries")
+	}
+}
+
+func TestLoadConfigCacheFile(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_STATE_FILE", "/srv/devbot/state.json")
+	t.Setenv("DEVBOT_CACHE_FILE", "")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.CacheFile != "/srv/devbot/knowledge-cache.json" {
+		t.Fatalf("expected cache file next to the state file, got %q", cfg.CacheFile)
+	}
+
+	t.Setenv("DEVBOT_CACHE_FILE", "/var/cache/devbot.json")
+	if cfg, _ = LoadConfig(); cfg.CacheFile != "/var/cache/devbot.json" {
+		t.Fatalf("expected env cache file, got %q", cfg.CacheFile)
+	}
+}
+
+func TestLoadConfigWatchInterval(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_WATCH_INTERVAL", "")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.WatchInterval != 60 {
+		t.Fatalf("expected default watch interval 60, got %d", cfg.WatchInterval)
+	}
+	t.Setenv("DEVBOT_WATCH_INTERVAL", "300")
+	if cfg, _ = LoadConfig(); cfg.WatchInterval != 300 {
+		t.Fatalf("expected env watch interval, got %d", cfg.WatchInterval)
+	}
+}
+
+func TestLoadConfigHookURL(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_WEB_ADDR", "")
+	t.Setenv("DEVBOT_WEB_TOKEN", "")
+	t.Setenv("DEVBOT_HOOK_URL", "http://devbot.internal:8080")
+
+	if _, err := LoadConfig(); err == nil {
+		t.Fatalf("expected error when hook_url is set without web_addr")
+	}
+
+	t.Setenv("DEVBOT_WEB_ADDR", ":8080")
+	t.Setenv("DEVBOT_WEB_TOKEN", "tok")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.HookURL != "http://devbot.internal:8080" {
+		t.Fatalf("expected explicit hook URL, got %q", cfg.HookURL)
+	}
+
+	t.Setenv("DEVBOT_HOOK_URL", "")
+	if cfg, _ = LoadConfig(); cfg.HookURL != "http://127.0.0.1:8080" {
+		t.Fatalf("expected loopback hook URL, got %q", cfg.HookURL)
+	}
+}
+
+func TestDefaultHookURL(t *testing.T) {
+	for addr, want := range map[string]string{
+		":8080":          "http://127.0.0.1:8080",
+		"0.0.0.0:9000":   "http://127.0.0.1:9000",
+		"[::]:9000":      "http://127.0.0.1:9000",
+		"10.0.0.5:8080":  "http://10.0.0.5:8080",
+		"localhost:8080": "http://localhost:8080",
+	} {
+		if got := defaultHookURL(addr); got != want {
+			t.Errorf("defaultHookURL(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestLoadConfigLicensePolicy(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_LICENSE_DENY", "GPL-3.0, AGPL-3.0,")
+	t.Setenv("DEVBOT_LICENSE_BLOCK_PR", "true")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.LicenseDeny) != 2 || cfg.LicenseDeny[1] != "AGPL-3.0" || !cfg.LicenseBlockPR {
+		t.Fatalf("unexpected license policy: %v %v", cfg.LicenseDeny, cfg.LicenseBlockPR)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	os.WriteFile(path, []byte("license_deny: [SSPL-1.0]\n"), 0644)
+	t.Setenv("DEVBOT_LICENSE_BLOCK_PR", "")
+	cfg, err = LoadConfigFrom(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.LicenseDeny) != 1 || cfg.LicenseDeny[0] != "SSPL-1.0" || cfg.LicenseBlockPR {
+		t.Fatalf("expected yaml policy, got %v %v", cfg.LicenseDeny, cfg.LicenseBlockPR)
+	}
+}
+
+func TestLoadConfigBuildTargets(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_BUILD_TARGETS", "linux/amd64, darwin/arm64")
+	t.Setenv("DEVBOT_ARTIFACT_DIR", "/srv/artifacts")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.BuildTargets) != 2 || cfg.BuildTargets[1] != "darwin/arm64" || cfg.ArtifactDir != "/srv/artifacts" {
+		t.Fatalf("unexpected build config: %v %q", cfg.BuildTargets, cfg.ArtifactDir)
+	}
+
+	t.Setenv("DEVBOT_BUILD_TARGETS", "linux")
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("expected error for a target without GOARCH")
+	}
+}
+
+func TestLoadConfigDocker(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_DOCKER_REGISTRY", "registry.example.com/team")
+	t.Setenv("DEVBOT_DOCKER_USERNAME", "ci")
+	t.Setenv("DEVBOT_SECRETS_FILE", "/etc/devbot/secrets.yaml")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.DockerRegistry != "registry.example.com/team" || cfg.DockerUsername != "ci" || cfg.SecretsFile != "/etc/devbot/secrets.yaml" {
+		t.Fatalf("unexpected docker config: %+v", cfg)
+	}
+}
+
+func TestLoadConfigTailServices(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte("tail_services:\n  api: \"systemd:api.service\"\n  web: \"docker:web\"\n"), 0644)
+
+	cfg, err := LoadConfigFrom(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.TailServices) != 2 || cfg.TailServices["web"] != "docker:web" {
+		t.Fatalf("unexpected tail services: %v", cfg.TailServices)
+	}
+
+	os.WriteFile(path, []byte("tail_services:\n  api: \"api.service\"\n"), 0644)
+	if _, err := LoadConfigFrom(path); err == nil {
+		t.Fatal("expected error for a source without a kind")
+	}
+}
+
+func TestLoadConfigAdminUserIDs(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1,user2")
+	t.Setenv("DEVBOT_ADMIN_USER_IDS", " user1 ,")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.AdminUserIDs) != 1 || !cfg.AdminUserIDs["user1"] {
+		t.Fatalf("unexpected admins: %v", cfg.AdminUserIDs)
+	}
+}
+
+func TestLoadConfigReadOnlyUserIDs(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_ADMIN_USER_IDS", "user1")
+	t.Setenv("DEVBOT_READONLY_USER_IDS", "viewer1, viewer2")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.ReadOnlyUserIDs) != 2 || !cfg.ReadOnlyUserIDs["viewer2"] {
+		t.Fatalf("unexpected read-only users: %v", cfg.ReadOnlyUserIDs)
+	}
+	// Read-only users may reach the bot without being listed twice.
+	if !cfg.AllowedUserIDs["viewer1"] || !cfg.AllowedUserIDs["user1"] {
+		t.Fatalf("unexpected allowed users: %v", cfg.AllowedUserIDs)
+	}
+
+	t.Setenv("DEVBOT_READONLY_USER_IDS", "user1")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "both an admin and read-only") {
+		t.Fatalf("expected an error for an admin listed as read-only, got %v", err)
+	}
+}
+
+func TestLoadConfigDBConnections(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_DB_MAX_ROWS", "100")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte("db_connections:\n  - name: shop\n    project: shop\n    driver: postgres\n    dsn_secret: shop_dsn\n"), 0644)
+
+	cfg, err := LoadConfigFrom(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.DBConnections) != 1 || cfg.DBConnections[0].DSNSecret != "shop_dsn" || cfg.DBMaxRows != 100 {
+		t.Fatalf("unexpected db config: %+v %d", cfg.DBConnections, cfg.DBMaxRows)
+	}
+
+	os.WriteFile(path, []byte("db_connections:\n  - name: shop\n    driver: sqlite\n    dsn_secret: shop_dsn\n"), 0644)
+	if _, err := LoadConfigFrom(path); err == nil {
+		t.Fatal("expected error for an unsupported driver")
+	}
+}
+
+func TestLoadConfigCurl(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_CURL_HOSTS", "localhost:8080, *.internal")
+	t.Setenv("DEVBOT_CURL_TIMEOUT", "5")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.CurlHosts) != 2 || cfg.CurlHosts[1] != "*.internal" || cfg.CurlTimeout != 5 || cfg.CurlMaxBody != 0 {
+		t.Fatalf("unexpected curl config: %v %d %d", cfg.CurlHosts, cfg.CurlTimeout, cfg.CurlMaxBody)
+	}
+}
+
+func TestLoadConfigScratchDir(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_STATE_FILE", "/var/lib/devbot/state.json")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ScratchDir != "/var/lib/devbot/scratch" {
+		t.Fatalf("expected default scratch dir next to state file, got %q", cfg.ScratchDir)
+	}
+
+	t.Setenv("DEVBOT_SCRATCH_DIR", "/tmp/devbot-scratch")
+	if cfg, err = LoadConfig(); err != nil || cfg.ScratchDir != "/tmp/devbot-scratch" {
+		t.Fatalf("expected DEVBOT_SCRATCH_DIR to win, got %q (%v)", cfg.ScratchDir, err)
+	}
+}
+
+func TestLoadConfigTrashRetention(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_TRASH_RETENTION_DAYS", "3")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.TrashRetentionDays != 3 {
+		t.Fatalf("expected 3 days, got %d", cfg.TrashRetentionDays)
+	}
+}
+
+func TestLoadConfigSessionSummaryModel(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_SESSION_SUMMARY_MODEL", "haiku")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.SessionSummaryModel != "haiku" {
+		t.Fatalf("expected haiku, got %q", cfg.SessionSummaryModel)
+	}
+}
+
+func TestLoadConfigCostConfirmTokens(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_COST_CONFIRM_TOKENS", "80000")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.CostConfirmTokens != 80000 {
+		t.Fatalf("expected 80000, got %d", cfg.CostConfirmTokens)
+	}
+}
+
+func TestLoadConfigShare(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_SHARE_PROVIDER", "paste")
+	t.Setenv("DEVBOT_SHARE_EXPIRY_HOURS", "24")
+
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "share_url") {
+		t.Fatalf("expected share_url error, got %v", err)
+	}
+	t.Setenv("DEVBOT_SHARE_URL", "https://paste.example.com")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ShareProvider != "paste" || cfg.ShareURL != "https://paste.example.com" || cfg.ShareExpiryHours != 24 {
+		t.Fatalf("unexpected share config %+v", cfg)
+	}
+	t.Setenv("DEVBOT_SHARE_PROVIDER", "pastebin")
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("expected error for unknown provider")
+	}
+}
+
+func TestLoadConfigIssue(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.IssueAfterFailures != 0 || cfg.IssueWindowMinutes != 60 || cfg.IssueMode != "offer" {
+		t.Fatalf("unexpected defaults %+v", cfg)
+	}
+	t.Setenv("DEVBOT_ISSUE_AFTER_FAILURES", "3")
+	t.Setenv("DEVBOT_ISSUE_WINDOW_MINUTES", "30")
+	t.Setenv("DEVBOT_ISSUE_MODE", "auto")
+	cfg, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.IssueAfterFailures != 3 || cfg.IssueWindowMinutes != 30 || cfg.IssueMode != "auto" {
+		t.Fatalf("unexpected issue config %+v", cfg)
+	}
+	t.Setenv("DEVBOT_ISSUE_MODE", "always")
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("expected error for unknown issue_mode")
+	}
+}
+
+func TestLoadConfigBackup(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.BackupDir != "" || cfg.BackupIntervalHours != 24 || cfg.BackupKeep != 7 || cfg.BackupS3Region != "us-east-1" {
+		t.Fatalf("unexpected defaults %+v", cfg)
+	}
+	t.Setenv("DEVBOT_BACKUP_S3_URL", "https://s3.example.com/bucket/devbot")
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("expected error for backup_s3_url without backup_dir")
+	}
+	t.Setenv("DEVBOT_BACKUP_DIR", "/var/lib/devbot/backups")
+	t.Setenv("DEVBOT_BACKUP_INTERVAL_HOURS", "6")
+	t.Setenv("DEVBOT_BACKUP_KEEP", "28")
+	cfg, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.BackupDir != "/var/lib/devbot/backups" || cfg.BackupIntervalHours != 6 || cfg.BackupKeep != 28 || cfg.BackupS3URL != "https://s3.example.com/bucket/devbot" {
+		t.Fatalf("unexpected backup config %+v", cfg)
+	}
+	t.Setenv("DEVBOT_BACKUP_S3_URL", "s3.example.com")
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("expected error for invalid backup_s3_url")
+	}
+}
+
+func TestLoadConfigCalendar(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_CALENDAR_ID", "cal_shared")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.CalendarID != "cal_shared" {
+		t.Fatalf("expected cal_shared, got %q", cfg.CalendarID)
+	}
+}
+
+func TestLoadConfigApprovals(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte("approvals:\n  - command: \"/push *--force*\"\n    approvers: [ou_a, ou_b]\n"), 0644)
+
+	cfg, err := LoadConfigFrom(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.ApprovalRules) != 1 || cfg.ApprovalRules[0].Required != 1 || len(cfg.ApprovalRules[0].Approvers) != 2 {
+		t.Fatalf("unexpected approval rules %+v", cfg.ApprovalRules)
+	}
+	for _, bad := range []string{
+		"approvals:\n  - command: push\n    approvers: [ou_a]\n",
+		"approvals:\n  - command: /push\n",
+		"approvals:\n  - command: /push\n    approvers: [ou_a]\n    required: 2\n",
+	} {
+		os.WriteFile(path, []byte(bad), 0644)
+		if _, err := LoadConfigFrom(path); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestLoadConfigCleanRules(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte("clean_rules:\n  - project: shop\n    paths: [dist, \"*.log\"]\n    commands: [\"go clean -cache\"]\n"), 0644)
+
+	cfg, err := LoadConfigFrom(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.CleanRules) != 1 || cfg.CleanRules[0].Project != "shop" || len(cfg.CleanRules[0].Paths) != 2 || len(cfg.CleanRules[0].Commands) != 1 {
+		t.Fatalf("unexpected clean rules %+v", cfg.CleanRules)
+	}
+	for _, bad := range []string{
+		"clean_rules:\n  - project: shop\n",
+		"clean_rules:\n  - paths: [/tmp]\n",
+		"clean_rules:\n  - paths: [../other]\n",
+		"clean_rules:\n  - paths: [.]\n",
+	} {
+		os.WriteFile(path, []byte(bad), 0644)
+		if _, err := LoadConfigFrom(path); err == nil || !strings.Contains(err.Error(), "clean_rules") {
+			t.Errorf("expected a clean_rules error for %q, got %v", bad, err)
+		}
+	}
+}
+
+func TestLoadConfigFormatters(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte("format_after_exec: true\nformatters:\n  .py: ruff format\n"), 0644)
+
+	cfg, err := LoadConfigFrom(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.FormatAfterExec || cfg.Formatters[".py"] != "ruff format" {
+		t.Fatalf("unexpected formatting config %v %v", cfg.FormatAfterExec, cfg.Formatters)
+	}
+	for _, bad := range []string{"formatters:\n  py: ruff format\n", "formatters:\n  .py: \"\"\n"} {
+		os.WriteFile(path, []byte(bad), 0644)
+		if _, err := LoadConfigFrom(path); err == nil || !strings.Contains(err.Error(), "formatters") {
+			t.Errorf("expected a formatters error for %q, got %v", bad, err)
+		}
+	}
+}
+
+func TestLoadConfigOutputProcessors(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte("output_processors: [redact, local_links]\nchat_output_processors:\n  oc_intl: [redact, translate]\n  oc_raw: []\nrepo_browser_url: https://github.com/acme/{repo}/blob/main/{path}\ntranslate_to: English\n"), 0644)
+
+	cfg, err := LoadConfigFrom(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(cfg.OutputProcessors, ",") != "redact,local_links" || strings.Join(cfg.ChatOutputProcessors["oc_intl"], ",") != "redact,translate" || cfg.TranslateTo != "English" {
+		t.Fatalf("unexpected output processing config %+v %+v %q", cfg.OutputProcessors, cfg.ChatOutputProcessors, cfg.TranslateTo)
+	}
+	if names, ok := cfg.ChatOutputProcessors["oc_raw"]; !ok || len(names) != 0 {
+		t.Fatalf("empty chat override should be kept, got %v %v", names, ok)
+	}
+	for _, bad := range []string{
+		"output_processors: [shout]\n",
+		"output_processors: [local_links]\n",
+		"chat_output_processors:\n  oc_1: [translate]\n",
+	} {
+		os.WriteFile(path, []byte(bad), 0644)
+		if _, err := LoadConfigFrom(path); err == nil || !strings.Contains(err.Error(), "output_processors") {
+			t.Errorf("expected an output_processors error for %q, got %v", bad, err)
+		}
+	}
+}
+
+func TestLoadConfigReportFolder(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_REPORT_FOLDER", "fldcn123")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ReportFolder != "fldcn123" {
+		t.Fatalf("expected fldcn123, got %q", cfg.ReportFolder)
+	}
+}
+
+func TestLoadConfigPublicURL(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_WEB_ADDR", "")
+	t.Setenv("DEVBOT_WEB_TOKEN", "")
+	t.Setenv("DEVBOT_PUBLIC_URL", "https://devbot.example.com")
+
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "public_url") {
+		t.Fatalf("expected error when public_url is set without web_addr, got %v", err)
+	}
+	t.Setenv("DEVBOT_WEB_ADDR", ":8080")
+	t.Setenv("DEVBOT_WEB_TOKEN", "tok")
+	cfg, err := LoadConfig()
+	if err != nil || cfg.PublicURL != "https://devbot.example.com" {
+		t.Fatalf("unexpected config %q %v", cfg.PublicURL, err)
+	}
+}
+
+func TestLoadConfigMaxPromptChars(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_MAX_PROMPT_CHARS", "500")
+
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "max_prompt_chars") {
+		t.Fatalf("expected error for a tiny max_prompt_chars, got %v", err)
+	}
+	t.Setenv("DEVBOT_MAX_PROMPT_CHARS", "50000")
+	cfg, err := LoadConfig()
+	if err != nil || cfg.MaxPromptChars != 50000 {
+		t.Fatalf("unexpected config %d %v", cfg.MaxPromptChars, err)
+	}
+	t.Setenv("DEVBOT_MAX_PROMPT_CHARS", "0")
+	if cfg, err := LoadConfig(); err != nil || cfg.MaxPromptChars != 0 {
+		t.Fatalf("expected 0 to turn trimming off, got %d %v", cfg.MaxPromptChars, err)
+	}
+	t.Setenv("DEVBOT_MAX_PROMPT_CHARS", "")
+	if cfg, err := LoadConfig(); err != nil || cfg.MaxPromptChars != defaultMaxPromptChars {
+		t.Fatalf("expected the default, got %d %v", cfg.MaxPromptChars, err)
+	}
+}
+
+func TestLoadConfigRepoSync(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	t.Setenv("DEVBOT_REPO_SYNC", "always")
+
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "repo_sync") {
+		t.Fatalf("expected error for an unknown repo_sync, got %v", err)
+	}
+	t.Setenv("DEVBOT_REPO_SYNC", "pull")
+	t.Setenv("DEVBOT_REPO_SYNC_IDLE_MINUTES", "30")
+	t.Setenv("DEVBOT_DEFAULT_BRANCH", "main")
+	cfg, err := LoadConfig()
+	if err != nil || cfg.RepoSync != "pull" || cfg.RepoSyncIdleMinutes != 30 || cfg.DefaultBranch != "main" {
+		t.Fatalf("unexpected config %q %d %q %v", cfg.RepoSync, cfg.RepoSyncIdleMinutes, cfg.DefaultBranch, err)
+	}
+}
+
+func TestLoadConfigReferenceDirs(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	dir := t.TempDir()
+	root := filepath.Join(dir, "work")
+	proto := filepath.Join(dir, "proto")
+	os.MkdirAll(root, 0755)
+	os.MkdirAll(proto, 0755)
+	t.Setenv("DEVBOT_WORK_ROOT", root)
+	path := filepath.Join(dir, "config.yaml")
+
+	os.WriteFile(path, []byte("reference_dirs:\n  proto: "+proto+"\n"), 0644)
+	cfg, err := LoadConfigFrom(path)
+	if err != nil || cfg.ReferenceDirs["proto"] != proto {
+		t.Fatalf("unexpected reference dirs %v %v", cfg.ReferenceDirs, err)
+	}
+	for _, bad := range []string{
+		"reference_dirs:\n  proto: relative/proto\n",
+		"reference_dirs:\n  proto: " + filepath.Join(dir, "missing") + "\n",
+		"reference_dirs:\n  all: " + dir + "\n",
+	} {
+		os.WriteFile(path, []byte(bad), 0644)
+		if _, err := LoadConfigFrom(path); err == nil || !strings.Contains(err.Error(), "reference_dirs") {
+			t.Errorf("expected a reference_dirs error for %q, got %v", bad, err)
+		}
+	}
+}
+
+func TestLoadConfigPromptTemplates(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	os.WriteFile(path, []byte("prompt_templates:\n  commit:\n    - name: builtin\n    - name: conventional\n      weight: 3\n      template: use conventional commits\n"), 0644)
+	cfg, err := LoadConfigFrom(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []PromptTemplate{{Name: "builtin", Weight: 1}, {Name: "conventional", Weight: 3, Template: "use conventional commits"}}
+	if got := cfg.PromptTemplates["commit"]; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("unexpected templates %+v", got)
+	}
+	for _, bad := range []string{
+		"prompt_templates:\n  deploy:\n    - name: a\n",
+		"prompt_templates:\n  commit: []\n",
+		"prompt_templates:\n  commit:\n    - name: a b\n",
+		"prompt_templates:\n  commit:\n    - name: a\n    - name: a\n",
+		"prompt_templates:\n  summary:\n    - name: a\n      weight: -1\n",
+	} {
+		os.WriteFile(path, []byte(bad), 0644)
+		if _, err := LoadConfigFrom(path); err == nil || !strings.Contains(err.Error(), "prompt_templates") {
+			t.Errorf("expected a prompt_templates error for %q, got %v", bad, err)
+		}
+	}
+}
+
+func TestLoadConfigLogging(t *testing.T) {
+	t.Setenv("DEVBOT_APP_ID", "cli_test")
+	t.Setenv("DEVBOT_APP_SECRET", "secret")
+	t.Setenv("DEVBOT_ALLOWED_USER_IDS", "user1")
+
+	cfg, err := LoadConfig()
+	if err != nil || cfg.LogLevel != "info" || cfg.LogFormat != "text" {
+		t.Fatalf("unexpected defaults %q %q %v", cfg.LogLevel, cfg.LogFormat, err)
+	}
+	t.Setenv("DEVBOT_LOG_LEVEL", "verbose")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "log_level") {
+		t.Fatalf("expected error for an unknown log_level, got %v", err)
+	}
+	t.Setenv("DEVBOT_LOG_LEVEL", "debug")
+	t.Setenv("DEVBOT_LOG_FORMAT", "xml")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "log_format") {
+		t.Fatalf("expected error for an unknown log_format, got %v", err)
+	}
+	t.Setenv("DEVBOT_LOG_FORMAT", "json")
+	cfg, err = LoadConfig()
+	if err != nil || cfg.LogLevel != "debug" || cfg.LogFormat != "json" {
+		t.Fatalf("unexpected config %q %q %v", cfg.LogLevel, cfg.LogFormat, err)
+	}
+}
@@ -0,0 +1,294 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// imageTokens is roughly what one attached image costs as input.
+	imageTokens = 1600
+	// maxCostWalkFiles bounds how many files are sized for a directory
+	// mentioned in a prompt.
+	maxCostWalkFiles = 20000
+	// pendingCostTTL is how long a prompt waits for cost confirmation.
+	pendingCostTTL = time.Hour
+)
+
+// modelInputPrices are list prices in USD per million input tokens.
+var modelInputPrices = map[string]float64{
+	"opus":   15,
+	"sonnet": 3,
+	"haiku":  0.8,
+}
+
+// SetCostConfirmTokens sets the estimated input size, in tokens, above
+// which prompts wait for confirmation before running (0 = never).
+func (r *Router) SetCostConfirmTokens(n int) {
+	r.costConfirmTokens = n
+}
+
+// modelPrice returns the input price for model, defaulting to sonnet's.
+func modelPrice(model string) float64 {
+	model = strings.ToLower(model)
+	for name, price := range modelInputPrices {
+		if strings.Contains(model, name) {
+			return price
+		}
+	}
+	return modelInputPrices["sonnet"]
+}
+
+// estimateTokens roughly counts the tokens in text: about four bytes per
+// token for ASCII and one token per other character (e.g. CJK).
+func estimateTokens(text string) int {
+	ascii, other := 0, 0
+	for _, c := range text {
+		if c < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// costAttachment is a file or directory a prompt refers to.
+type costAttachment struct {
+	Path   string
+	Size   int64
+	Tokens int
+}
+
+// isImageFile reports whether path looks like an image by its extension.
+func isImageFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp":
+		return true
+	}
+	return false
+}
+
+// attachmentTokens sizes the files under path, skipping .git.
+func attachmentTokens(path string) (int64, int) {
+	var size int64
+	tokens, n := 0, 0
+	filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if n++; n > maxCostWalkFiles {
+			return filepath.SkipAll
+		}
+		size += info.Size()
+		if isImageFile(p) {
+			tokens += imageTokens
+		} else {
+			tokens += int(info.Size() / 4)
+		}
+		return nil
+	})
+	return size, tokens
+}
+
+// promptAttachments finds the existing files and directories a prompt
+// mentions: absolute paths (such as saved uploads) and paths relative to
+// workDir. The workdir itself counts when written as "./".
+func promptAttachments(prompt, workDir string) []costAttachment {
+	words := strings.FieldsFunc(prompt, func(c rune) bool {
+		return c == ' ' || c == '\n' || c == '\t' || c == ',' || c == '，' || c == '、' || c == '：' || c == '；' || c == '"' || c == '\'' || c == '`' || c == '(' || c == ')' || c == '（' || c == '）'
+	})
+	seen := make(map[string]bool)
+	var out []costAttachment
+	for _, w := range words {
+		w = strings.TrimRight(w, ".。:;!?！？")
+		if strings.HasPrefix(w, "@file:") {
+			w, _, _ = strings.Cut(strings.TrimPrefix(w, "@file:"), "#")
+		}
+		if w == "" || w == ".." || (!strings.Contains(w, "/") && !strings.Contains(w, ".")) {
+			continue
+		}
+		if w == "." && !strings.Contains(prompt, "./") {
+			continue
+		}
+		path := w
+		if !filepath.IsAbs(path) {
+			if workDir == "" {
+				continue
+			}
+			path = filepath.Join(workDir, path)
+			if !underRoot(workDir, path) {
+				continue
+			}
+		}
+		path = filepath.Clean(path)
+		if seen[path] {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		seen[path] = true
+		size, tokens := attachmentTokens(path)
+		out = append(out, costAttachment{Path: path, Size: size, Tokens: tokens})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Tokens > out[j].Tokens })
+	return out
+}
+
+// costEstimate is the expected input of a prompt.
+type costEstimate struct {
+	Model        string
+	PromptTokens int
+	FileTokens   int
+	Files        []costAttachment
+}
+
+func (e costEstimate) Tokens() int { return e.PromptTokens + e.FileTokens }
+
+// USD is the estimated input cost; output and tool use are not included.
+func (e costEstimate) USD() float64 {
+	return float64(e.Tokens()) / 1e6 * modelPrice(e.Model)
+}
+
+func (r *Router) estimateCost(chatID, prompt string) costEstimate {
+	workDir, _, _, model := r.store.SessionExecParams(chatID)
+	if model == "" {
+		model = r.executor.Model()
+	}
+	e := costEstimate{Model: model, PromptTokens: estimateTokens(prompt), Files: promptAttachments(prompt, workDir)}
+	for _, f := range e.Files {
+		e.FileTokens += f.Tokens
+	}
+	return e
+}
+
+// formatTokens renders a token count compactly, e.g. 950 or 12.3k.
+func formatTokens(n int) string {
+	if n < 1000 {
+		return fmt.Sprint(n)
+	}
+	return fmt.Sprintf("%.1fk", float64(n)/1000)
+}
+
+// pendingPrompt is a prompt waiting for /confirm because of its cost.
+type pendingPrompt struct {
+	chatID  string
+	prompt  string
+	opts    execOptions
+	created time.Time
+}
+
+// submitChecked queues a prompt sent by the user, first asking for
+// confirmation when its estimated input exceeds the configured threshold.
+func (r *Router) submitChecked(ctx context.Context, chatID, prompt string, opts execOptions) {
+	if r.costConfirmTokens <= 0 {
+		r.enqueueExec(ctx, chatID, prompt, opts)
+		return
+	}
+	// Images count like files mentioned by path.
+	e := r.estimateCost(chatID, imagePathPrompt(prompt, opts.Images))
+	if e.Tokens() < r.costConfirmTokens {
+		r.enqueueExec(ctx, chatID, prompt, opts)
+		return
+	}
+
+	id := newExecID()
+	r.mu.Lock()
+	for k, p := range r.pendingPrompts {
+		if time.Since(p.created) > pendingCostTTL {
+			delete(r.pendingPrompts, k)
+		}
+	}
+	r.pendingPrompts[id] = &pendingPrompt{chatID: chatID, prompt: prompt, opts: opts, created: time.Now()}
+	r.mu.Unlock()
+	slog.InfoContext(ctx, "router: prompt awaiting cost confirmation", "exec_id", id, "chat_id", chatID, "tokens", e.Tokens())
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**Prompt:** %s\n", truncateRunes(strings.Join(strings.Fields(prompt), " "), 100))
+	fmt.Fprintf(&sb, "**模型:** %s\n", e.Model)
+	fmt.Fprintf(&sb, "**预计输入:** 约 %s tokens（prompt %s + 文件 %s）\n", formatTokens(e.Tokens()), formatTokens(e.PromptTokens), formatTokens(e.FileTokens))
+	fmt.Fprintf(&sb, "**预计费用:** 约 $%.2f（仅输入，不含输出和工具调用）\n", e.USD())
+	if len(e.Files) > 0 {
+		sb.WriteString("**涉及文件:**\n")
+		for i, f := range e.Files {
+			if i == 10 {
+				fmt.Fprintf(&sb, "- ... 另有 %d 项\n", len(e.Files)-10)
+				break
+			}
+			fmt.Fprintf(&sb, "- `%s`（%s，约 %s tokens）\n", f.Path, formatSize(f.Size), formatTokens(f.Tokens))
+		}
+	}
+	fmt.Fprintf(&sb, "\n超过确认阈值 %s tokens。回复 `/confirm %s` 执行，`/deny %s` 取消。", formatTokens(r.costConfirmTokens), id, id)
+	r.sender.SendCard(ctx, chatID, CardMsg{
+		Title:    "⚠️ 预计消耗较大，请确认",
+		Content:  sb.String(),
+		Template: "orange",
+		Buttons: []CardButton{
+			{Text: "确认执行", Command: "/confirm " + id, Type: "primary"},
+			{Text: "取消", Command: "/deny " + id},
+		},
+	})
+}
+
+// takePendingPrompt removes and returns the chat's waiting prompt id, or
+// its most recent one when id is empty.
+func (r *Router) takePendingPrompt(chatID, id string) *pendingPrompt {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id == "" {
+		var latest time.Time
+		for k, p := range r.pendingPrompts {
+			if p.chatID == chatID && p.created.After(latest) {
+				id, latest = k, p.created
+			}
+		}
+	}
+	p := r.pendingPrompts[id]
+	if p == nil || p.chatID != chatID {
+		return nil
+	}
+	delete(r.pendingPrompts, id)
+	return p
+}
+
+// cmdConfirm answers /confirm and /deny. With an ID they settle a prompt
+// waiting for cost confirmation; without one they answer the pending
+// deletion, or else the chat's latest waiting prompt.
+func (r *Router) cmdConfirm(ctx context.Context, chatID, args string, ok bool) {
+	if args == "" && r.resolveDelete(chatID, ok) {
+		if ok {
+			r.sender.SendText(ctx, chatID, "✓ 已允许删除，继续执行。")
+		} else {
+			r.sender.SendText(ctx, chatID, "已拒绝删除。")
+		}
+		return
+	}
+	p := r.takePendingPrompt(chatID, args)
+	if p == nil {
+		if args == "" {
+			r.sender.SendText(ctx, chatID, "当前没有等待确认的删除操作或 prompt。")
+		} else {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("没有等待确认的 prompt: %s（可能已执行、取消或过期）", args))
+		}
+		return
+	}
+	if !ok {
+		r.sender.SendText(ctx, chatID, "已取消。")
+		return
+	}
+	r.enqueueExec(ctx, chatID, p.prompt, p.opts)
+}
@@ -0,0 +1,123 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	cases := map[string]int{"": 0, "abcdefgh": 2, "abc": 1, "你好世界": 4, "hi 你好": 3}
+	for text, want := range cases {
+		if got := estimateTokens(text); got != want {
+			t.Errorf("estimateTokens(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
+
+func TestModelPrice(t *testing.T) {
+	if modelPrice("claude-opus-4") != 15 || modelPrice("haiku") != 0.8 || modelPrice("") != 3 {
+		t.Fatal("unexpected model prices")
+	}
+}
+
+func TestPromptAttachments(t *testing.T) {
+	workDir := t.TempDir()
+	os.WriteFile(filepath.Join(workDir, "big.txt"), make([]byte, 4000), 0644)
+	os.MkdirAll(filepath.Join(workDir, "src", ".git"), 0755)
+	os.WriteFile(filepath.Join(workDir, "src", "a.go"), make([]byte, 400), 0644)
+	os.WriteFile(filepath.Join(workDir, "src", ".git", "pack"), make([]byte, 4000), 0644)
+	upload := filepath.Join(t.TempDir(), "shot.png")
+	os.WriteFile(upload, []byte("png"), 0644)
+
+	got := promptAttachments("总结 big.txt、src/ 和 `../outside`。附带图片路径: "+upload+". Done.", workDir)
+	var desc []string
+	for _, a := range got {
+		desc = append(desc, filepath.Base(a.Path)+"="+formatTokens(a.Tokens))
+	}
+	if strings.Join(desc, ",") != "shot.png=1.6k,big.txt=1.0k,src=100" {
+		t.Fatalf("unexpected attachments %v", desc)
+	}
+	if got := promptAttachments("fix the bug. thanks", workDir); len(got) != 0 {
+		t.Fatalf("expected no attachments, got %+v", got)
+	}
+	if got := promptAttachments("summarize ./ please", workDir); len(got) != 1 || got[0].Path != workDir {
+		t.Fatalf("expected workdir, got %+v", got)
+	}
+}
+
+// newCostRouter returns a router whose claude records each prompt it runs
+// in the file ran.
+func newCostRouter(t *testing.T) (*Router, *cardSpySender, string) {
+	t.Helper()
+	dir := t.TempDir()
+	ran := filepath.Join(dir, "ran")
+	claude := filepath.Join(dir, "claude")
+	os.WriteFile(claude, []byte(`#!/bin/sh
+echo "$(cat)" >> `+ran+`
+echo '{"type":"result","result":"ok","session_id":"s1"}'
+`), 0755)
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	sender := &cardSpySender{}
+	r := NewRouter(context.Background(), NewClaudeExecutor(claude, "sonnet", 10*time.Second), store, sender, map[string]bool{"user1": true}, dir, nil)
+	os.WriteFile(filepath.Join(dir, "huge.log"), make([]byte, 40000), 0644)
+	r.SetCostConfirmTokens(5000)
+	return r, sender, ran
+}
+
+func TestRouterCostConfirm(t *testing.T) {
+	r, sender, ran := newCostRouter(t)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "hello")
+	if data, _ := os.ReadFile(ran); !strings.Contains(string(data), "hello") {
+		t.Fatalf("expected small prompt to run, got %q", data)
+	}
+
+	r.Route(ctx, "chat1", "user1", "summarize huge.log")
+	if len(sender.cards) == 0 {
+		t.Fatal("expected confirmation card")
+	}
+	card := sender.cards[len(sender.cards)-1]
+	if !strings.Contains(card.Title, "请确认") || !strings.Contains(card.Content, "huge.log") || len(card.Buttons) != 2 {
+		t.Fatalf("unexpected card %+v", card)
+	}
+	if data, _ := os.ReadFile(ran); strings.Contains(string(data), "huge.log") {
+		t.Fatal("expected prompt to wait for confirmation")
+	}
+	id := regexp.MustCompile(`/confirm (\w+)`).FindStringSubmatch(card.Content)[1]
+	if card.Buttons[0].Command != "/confirm "+id || card.Buttons[1].Command != "/deny "+id {
+		t.Fatalf("unexpected buttons %+v", card.Buttons)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/confirm "+id)
+	if data, _ := os.ReadFile(ran); !strings.Contains(string(data), "summarize huge.log") {
+		t.Fatalf("expected confirmed prompt to run, got %q", data)
+	}
+	r.Route(ctx, "chat1", "user1", "/confirm "+id)
+	if msg := sender.texts[len(sender.texts)-1]; !strings.Contains(msg, "没有等待确认的 prompt") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+}
+
+func TestRouterCostDeny(t *testing.T) {
+	r, sender, ran := newCostRouter(t)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "/urgent explain huge.log")
+	r.Route(ctx, "chat1", "user1", "/deny")
+	if msg := sender.texts[len(sender.texts)-1]; msg != "已取消。" {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	if fileExists(ran) {
+		t.Fatal("expected denied prompt not to run")
+	}
+	r.Route(ctx, "chat1", "user1", "/deny")
+	if msg := sender.texts[len(sender.texts)-1]; !strings.Contains(msg, "没有等待确认的删除操作或 prompt") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+}
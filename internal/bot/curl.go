@@ -0,0 +1,190 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCurlTimeout = 15 * time.Second
+	// defaultCurlMaxBody is how many characters of a response /curl shows.
+	defaultCurlMaxBody = 4000
+	// maxCurlRead bounds how much of a response /curl reads at all.
+	maxCurlRead = 1 << 20
+)
+
+// curlMethods are the methods /curl accepts.
+var curlMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true,
+	"PATCH": true, "DELETE": true, "OPTIONS": true,
+}
+
+// SetCurlConfig sets the hosts /curl may reach ("api.example.com",
+// "*.internal", "localhost:8080"), the request timeout and how many
+// characters of a response are shown (0 = defaults).
+func (r *Router) SetCurlConfig(hosts []string, timeout time.Duration, maxBody int) {
+	r.curlHosts = hosts
+	r.curlTimeout = timeout
+	r.curlMaxBody = maxBody
+}
+
+// curlAllowed reports whether u's host matches one of hosts. An entry with
+// a port matches only that port; "*.example.com" matches subdomains.
+func curlAllowed(hosts []string, u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	hostPort := host
+	if p := u.Port(); p != "" {
+		hostPort = net.JoinHostPort(host, p)
+	}
+	for _, h := range hosts {
+		h = strings.ToLower(strings.TrimSpace(h))
+		switch {
+		case h == "":
+		case strings.HasPrefix(h, "*."):
+			if strings.HasSuffix(host, h[1:]) {
+				return true
+			}
+		case strings.Contains(h, ":") && !strings.HasPrefix(h, "["):
+			if hostPort == h {
+				return true
+			}
+		case host == strings.Trim(h, "[]"):
+			return true
+		}
+	}
+	return false
+}
+
+// parseCurlArgs splits "/curl" arguments into method, URL and body. The
+// method may be omitted for a GET.
+func parseCurlArgs(args string) (method, rawURL, body string, ok bool) {
+	first, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	if curlMethods[strings.ToUpper(first)] {
+		method = strings.ToUpper(first)
+		rawURL, body, _ = strings.Cut(strings.TrimSpace(rest), " ")
+	} else {
+		method, rawURL, body = "GET", first, rest
+	}
+	body = strings.TrimSpace(body)
+	return method, rawURL, body, rawURL != ""
+}
+
+func (r *Router) cmdCurl(ctx context.Context, chatID, args string) {
+	method, rawURL, body, ok := parseCurlArgs(args)
+	if !ok {
+		r.sender.SendText(ctx, chatID, "用法: /curl [方法] <URL> [请求体]\n示例: /curl https://api.example.com/health\n示例: /curl POST http://localhost:8080/v1/items {\"name\": \"test\"}\n只能访问 curl_hosts 中允许的主机。")
+		return
+	}
+	if len(r.curlHosts) == 0 {
+		r.sender.SendText(ctx, chatID, "未配置 curl_hosts，/curl 不可用。")
+		return
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("无效的 URL: %s（需要 http:// 或 https://）", rawURL))
+		return
+	}
+	if !curlAllowed(r.curlHosts, u) {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("主机 %s 不在 curl_hosts 允许列表中。", u.Host))
+		return
+	}
+
+	timeout := r.curlTimeout
+	if timeout <= 0 {
+		timeout = defaultCurlTimeout
+	}
+	maxBody := r.curlMaxBody
+	if maxBody <= 0 {
+		maxBody = defaultCurlMaxBody
+	}
+	reqCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var reqBody io.Reader
+	if body != "" {
+		reqBody = strings.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(reqCtx, method, u.String(), reqBody)
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("创建请求失败: %v", err))
+		return
+	}
+	if body != "" {
+		ct := "text/plain; charset=utf-8"
+		if json.Valid([]byte(body)) {
+			ct = "application/json"
+		}
+		req.Header.Set("Content-Type", ct)
+	}
+	req.Header.Set("User-Agent", "devbot")
+	client := &http.Client{
+		CheckRedirect: func(next *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("重定向次数过多")
+			}
+			if !curlAllowed(r.curlHosts, next.URL) {
+				return fmt.Errorf("重定向到不允许的主机 %s", next.URL.Host)
+			}
+			return nil
+		},
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("%s %s 失败", method, u.Redacted()), Content: truncateForDisplay(err.Error(), 1000), Template: "red"})
+		return
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCurlRead+1))
+	elapsed := time.Since(start)
+	if err != nil {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("%s %s 读取响应失败", method, u.Redacted()), Content: err.Error(), Template: "red"})
+		return
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**耗时:** %s · **大小:** %s", elapsed.Truncate(time.Millisecond), formatSize(int64(len(data))))
+	if len(data) > maxCurlRead {
+		fmt.Fprintf(&sb, "（仅读取前 %s）", formatSize(maxCurlRead))
+		data = data[:maxCurlRead]
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		fmt.Fprintf(&sb, "\n**Content-Type:** %s", ct)
+	}
+	if loc := resp.Header.Get("Location"); loc != "" {
+		fmt.Fprintf(&sb, "\n**Location:** %s", loc)
+	}
+	if len(data) > 0 {
+		text := string(data)
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, data, "", "  ") == nil {
+			text = pretty.String()
+		}
+		text = strings.TrimRight(text, "\n")
+		if runes := []rune(text); len(runes) > maxBody {
+			text = string(runes[:maxBody])
+			fmt.Fprintf(&sb, "\n（响应过长，仅显示前 %d 个字符）", maxBody)
+		}
+		fmt.Fprintf(&sb, "\n```\n%s\n```", text)
+	}
+
+	tpl := "green"
+	switch {
+	case resp.StatusCode >= 500:
+		tpl = "red"
+	case resp.StatusCode >= 400:
+		tpl = "orange"
+	case resp.StatusCode >= 300:
+		tpl = "blue"
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("%s %s → %s", method, u.Redacted(), resp.Status), Content: sb.String(), Template: tpl})
+}
@@ -0,0 +1,105 @@
+package bot
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCurlAllowed(t *testing.T) {
+	hosts := []string{"api.example.com", "*.internal", "localhost:8080", "[::1]"}
+	tests := map[string]bool{
+		"https://api.example.com/v1":        true,
+		"https://API.example.com:443/":      true,
+		"http://svc.internal/health":        true,
+		"http://internal/":                  false,
+		"http://localhost:8080/":            true,
+		"http://localhost:9090/":            false,
+		"http://[::1]:3000/":                true,
+		"https://evil.com/?api.example.com": false,
+	}
+	for raw, want := range tests {
+		u, _ := url.Parse(raw)
+		if got := curlAllowed(hosts, u); got != want {
+			t.Errorf("curlAllowed(%q) = %v, want %v", raw, got, want)
+		}
+	}
+}
+
+func TestParseCurlArgs(t *testing.T) {
+	if m, u, b, ok := parseCurlArgs("post http://x/items {\"a\": 1}"); !ok || m != "POST" || u != "http://x/items" || b != `{"a": 1}` {
+		t.Fatalf("unexpected parse %q %q %q %v", m, u, b, ok)
+	}
+	if m, u, _, ok := parseCurlArgs("http://x/health"); !ok || m != "GET" || u != "http://x/health" {
+		t.Fatalf("unexpected parse %q %q %v", m, u, ok)
+	}
+	if _, _, _, ok := parseCurlArgs("DELETE"); ok {
+		t.Fatal("expected a missing URL to be rejected")
+	}
+}
+
+func TestRouterCurl(t *testing.T) {
+	var gotBody, gotType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/items":
+			b, _ := io.ReadAll(req.Body)
+			gotBody, gotType = string(b), req.Header.Get("Content-Type")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"id":7,"name":"test"}`)
+		case "/big":
+			io.WriteString(w, strings.Repeat("x", 100))
+		case "/away":
+			http.Redirect(w, req, "http://example.com/", http.StatusFound)
+		case "/slow":
+			time.Sleep(time.Second)
+		default:
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/curl "+srv.URL+"/items")
+	if !strings.Contains(sender.LastMessage(), "未配置 curl_hosts") {
+		t.Fatalf("expected /curl to be disabled, got %q", sender.LastMessage())
+	}
+
+	r.SetCurlConfig([]string{host}, 200*time.Millisecond, 50)
+	r.Route(context.Background(), "chat1", "user1", `/curl POST `+srv.URL+`/items {"name":"test"}`)
+	msg := sender.LastMessage()
+	if !strings.HasPrefix(msg, "POST "+srv.URL+"/items → 201 Created") || !strings.Contains(msg, "\"id\": 7") {
+		t.Fatalf("unexpected response card %q", msg)
+	}
+	if gotBody != `{"name":"test"}` || gotType != "application/json" {
+		t.Fatalf("unexpected request body %q (%s)", gotBody, gotType)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/curl "+srv.URL+"/big")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "仅显示前 50 个字符") || strings.Contains(msg, strings.Repeat("x", 51)) {
+		t.Fatalf("expected truncated body, got %q", msg)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/curl "+srv.URL+"/away")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "失败") || !strings.Contains(msg, "重定向到不允许的主机 example.com") {
+		t.Fatalf("expected redirect to be blocked, got %q", msg)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/curl "+srv.URL+"/slow")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "失败") || !strings.Contains(msg, "deadline exceeded") {
+		t.Fatalf("expected timeout, got %q", msg)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/curl https://example.com/")
+	if !strings.Contains(sender.LastMessage(), "不在 curl_hosts 允许列表中") {
+		t.Fatalf("expected host to be rejected, got %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/curl file:///etc/passwd")
+	if !strings.Contains(sender.LastMessage(), "无效的 URL") {
+		t.Fatalf("expected scheme to be rejected, got %q", sender.LastMessage())
+	}
+}
@@ -0,0 +1,335 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+)
+
+const (
+	// defaultDBMaxRows bounds the rows /db reads from one query.
+	defaultDBMaxRows = 500
+	// maxDBResultBytes bounds the size of one query result.
+	maxDBResultBytes = 5 << 20
+	// dbQueryTimeout bounds one /db query.
+	dbQueryTimeout = 30 * time.Second
+	// dbCardRows is how many rows a result card shows; larger results are
+	// also sent as CSV.
+	dbCardRows = 20
+	// dbCellWidth is the widest a cell is shown in a result card.
+	dbCellWidth = 40
+)
+
+// dbDrivers are the database/sql drivers a connection may use.
+var dbDrivers = map[string]bool{"postgres": true, "mysql": true}
+
+// readOnlyKeywords are the statements /db accepts. The transaction is read
+// only as well; this check just gives a clearer error up front.
+var readOnlyKeywords = map[string]bool{
+	"select": true, "with": true, "show": true, "explain": true,
+	"describe": true, "desc": true, "values": true, "table": true,
+}
+
+// SetDBConnections sets the databases /db may query and the row limit per
+// query (0 = default).
+func (r *Router) SetDBConnections(conns []DBConnection, maxRows int) {
+	r.dbConns = conns
+	r.dbMaxRows = maxRows
+}
+
+// dbConnections returns the connections configured for workDir.
+func (r *Router) dbConnections(workDir string) []DBConnection {
+	var out []DBConnection
+	for _, c := range r.dbConns {
+		if r.inProject(c.Project, workDir) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// inProject reports whether workDir is in project, a directory absolute or
+// relative to the work root; "" is every project.
+func (r *Router) inProject(project, workDir string) bool {
+	if project == "" {
+		return true
+	}
+	if !filepath.IsAbs(project) {
+		project = filepath.Join(r.store.WorkRoot(), project)
+	}
+	return underRoot(filepath.Clean(project), workDir)
+}
+
+// checkReadOnlySQL rejects anything but a single read-only statement.
+func checkReadOnlySQL(query string) error {
+	q := strings.TrimRight(strings.TrimSpace(query), "; \t\n")
+	for {
+		q = strings.TrimSpace(q)
+		if strings.HasPrefix(q, "--") {
+			if i := strings.IndexByte(q, '\n'); i >= 0 {
+				q = q[i+1:]
+				continue
+			}
+			q = ""
+		} else if strings.HasPrefix(q, "/*") {
+			if i := strings.Index(q, "*/"); i >= 0 {
+				q = q[i+2:]
+				continue
+			}
+			q = ""
+		}
+		break
+	}
+	if q == "" {
+		return errors.New("SQL 为空")
+	}
+	if strings.Contains(q, ";") {
+		return errors.New("一次只能执行一条语句")
+	}
+	words := strings.FieldsFunc(q, func(c rune) bool {
+		return !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z')
+	})
+	if len(words) == 0 {
+		return errors.New("无法识别的语句")
+	}
+	keyword := strings.ToLower(words[0])
+	if !readOnlyKeywords[keyword] {
+		return fmt.Errorf("只允许只读查询（SELECT/WITH/SHOW/EXPLAIN 等），不支持 %s", strings.ToUpper(keyword))
+	}
+	return nil
+}
+
+// dbResult is the outcome of one /db query.
+type dbResult struct {
+	Columns   []string
+	Rows      [][]string
+	Truncated bool // stopped at the row or size limit
+}
+
+// dbCell renders a scanned value as text.
+func dbCell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		if !utf8.Valid(v) {
+			return fmt.Sprintf("<%d bytes>", len(v))
+		}
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v)
+}
+
+// runDBQuery runs query in a read-only transaction that is always rolled
+// back, reading at most maxRows rows.
+func runDBQuery(ctx context.Context, driver, dsn, query string, maxRows int) (*dbResult, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	ctx, cancel := context.WithTimeout(ctx, dbQueryTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := &dbResult{}
+	if res.Columns, err = rows.Columns(); err != nil {
+		return nil, err
+	}
+	size := 0
+	for rows.Next() {
+		if len(res.Rows) == maxRows || size > maxDBResultBytes {
+			res.Truncated = true
+			break
+		}
+		vals := make([]interface{}, len(res.Columns))
+		ptrs := make([]interface{}, len(vals))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make([]string, len(vals))
+		for i, v := range vals {
+			row[i] = dbCell(v)
+			size += len(row[i])
+		}
+		res.Rows = append(res.Rows, row)
+	}
+	return res, rows.Err()
+}
+
+// formatDBTable renders the first n rows of res as an aligned text table.
+func formatDBTable(res *dbResult, n int) string {
+	rows := res.Rows
+	if len(rows) > n {
+		rows = rows[:n]
+	}
+	cell := func(s string) string {
+		return truncateRunes(strings.Join(strings.Fields(s), " "), dbCellWidth)
+	}
+	widths := make([]int, len(res.Columns))
+	for i, c := range res.Columns {
+		widths[i] = utf8.RuneCountInString(cell(c))
+	}
+	for _, row := range rows {
+		for i, v := range row {
+			if w := utf8.RuneCountInString(cell(v)); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+	var sb strings.Builder
+	line := func(vals []string) {
+		for i, v := range vals {
+			v = cell(v)
+			if i > 0 {
+				sb.WriteString(" | ")
+			}
+			sb.WriteString(v)
+			if i < len(vals)-1 {
+				sb.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(v)))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	line(res.Columns)
+	sep := make([]string, len(widths))
+	for i, w := range widths {
+		sep[i] = strings.Repeat("-", w)
+	}
+	sb.WriteString(strings.Join(sep, "-+-") + "\n")
+	for _, row := range rows {
+		line(row)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// dbCSV renders res as CSV.
+func dbCSV(res *dbResult) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(res.Columns)
+	w.WriteAll(res.Rows)
+	return buf.Bytes()
+}
+
+func (r *Router) cmdDB(ctx context.Context, chatID, args string) {
+	usage := "用法: /db [list]\n       /db query [@连接] <SQL>\n       /db csv [@连接] <SQL>\n示例: /db query select id, status from orders order by id desc limit 10\n示例: /db csv @replica select * from users where created_at > now() - interval '1 day'\n查询在只读事务中执行；结果超过 20 行时附 CSV 文件。"
+	sub, rest, _ := strings.Cut(args, " ")
+	rest = strings.TrimSpace(rest)
+	workDir := r.getSession(chatID).WorkDir
+	conns := r.dbConnections(workDir)
+
+	switch sub {
+	case "", "list":
+		if len(conns) == 0 {
+			r.sender.SendText(ctx, chatID, "当前项目没有配置数据库连接（db_connections）。")
+			return
+		}
+		var sb strings.Builder
+		for _, c := range conns {
+			fmt.Fprintf(&sb, "- **%s** · %s", c.Name, c.Driver)
+			if _, ok := r.secrets.Get(c.DSNSecret); !ok {
+				fmt.Fprintf(&sb, " · ⚠️ 缺少密钥 `%s`", c.DSNSecret)
+			}
+			sb.WriteString("\n")
+		}
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("数据库连接（%d）", len(conns)), Content: strings.TrimSpace(sb.String())})
+		return
+	case "query", "csv":
+	default:
+		r.sender.SendText(ctx, chatID, usage)
+		return
+	}
+
+	var name string
+	if strings.HasPrefix(rest, "@") {
+		name, rest, _ = strings.Cut(rest[1:], " ")
+		rest = strings.TrimSpace(rest)
+	}
+	if rest == "" {
+		r.sender.SendText(ctx, chatID, usage)
+		return
+	}
+	var conn *DBConnection
+	for i := range conns {
+		if conns[i].Name == name || (name == "" && len(conns) == 1) {
+			conn = &conns[i]
+		}
+	}
+	if conn == nil {
+		switch {
+		case len(conns) == 0:
+			r.sender.SendText(ctx, chatID, "当前项目没有配置数据库连接（db_connections）。")
+		case name == "":
+			r.sender.SendText(ctx, chatID, "当前项目有多个数据库连接，请用 @连接名 指定（/db list 查看）。")
+		default:
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("当前项目没有名为 %s 的数据库连接。", name))
+		}
+		return
+	}
+	if err := checkReadOnlySQL(rest); err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("拒绝执行: %v", err))
+		return
+	}
+	dsn, ok := r.secrets.Get(conn.DSNSecret)
+	if !ok {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("缺少密钥 %s，无法连接 %s。", conn.DSNSecret, conn.Name))
+		return
+	}
+
+	maxRows := r.dbMaxRows
+	if maxRows <= 0 {
+		maxRows = defaultDBMaxRows
+	}
+	slog.InfoContext(ctx, "db: query", "chat_id", chatID, "conn", conn.Name, "query", truncateRunes(rest, 200))
+	start := time.Now()
+	res, err := runDBQuery(ctx, conn.Driver, dsn, rest, maxRows)
+	if err != nil {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "查询失败: " + conn.Name, Content: fmt.Sprintf("```\n%s\n```", truncateForDisplay(err.Error(), 2000)), Template: "red"})
+		return
+	}
+
+	title := fmt.Sprintf("查询结果: %d 行（%s）", len(res.Rows), conn.Name)
+	meta := fmt.Sprintf("**耗时:** %s", time.Since(start).Truncate(time.Millisecond))
+	if res.Truncated {
+		meta += fmt.Sprintf(" · 已截断（上限 %d 行 / %s）", maxRows, formatSize(maxDBResultBytes))
+	}
+	asCSV := sub == "csv" || len(res.Rows) > dbCardRows
+	content := meta
+	if len(res.Columns) > 0 && sub != "csv" {
+		content += "\n```\n" + formatDBTable(res, dbCardRows) + "\n```"
+		if len(res.Rows) > dbCardRows {
+			content += fmt.Sprintf("\n仅显示前 %d 行，完整结果见 CSV 文件。", dbCardRows)
+		}
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: content})
+	if asCSV && len(res.Columns) > 0 {
+		r.sendFile(ctx, chatID, fmt.Sprintf("%s-%s.csv", conn.Name, time.Now().Format("20060102-150405")), dbCSV(res))
+	}
+}
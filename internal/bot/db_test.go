@@ -0,0 +1,217 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDB records what the "fakedb" driver was asked to do.
+var fakeDB struct {
+	sync.Mutex
+	dsn        string
+	readOnly   bool
+	rolledBack bool
+}
+
+func init() {
+	sql.Register("fakedb", fakeDriver{})
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	fakeDB.Lock()
+	fakeDB.dsn = dsn
+	fakeDB.Unlock()
+	return fakeConn{}, nil
+}
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("use BeginTx") }
+
+func (fakeConn) BeginTx(_ context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	fakeDB.Lock()
+	fakeDB.readOnly, fakeDB.rolledBack = opts.ReadOnly, false
+	fakeDB.Unlock()
+	return fakeTx{}, nil
+}
+
+// QueryContext returns n rows for "select n", and fails otherwise.
+func (fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	var n int
+	if _, err := fmt.Sscanf(query, "select %d", &n); err != nil {
+		return nil, errors.New(`pq: relation "nope" does not exist`)
+	}
+	rows := &fakeRows{cols: []string{"id", "name", "created_at", "note"}}
+	for i := 1; i <= n; i++ {
+		rows.rows = append(rows.rows, []driver.Value{int64(i), []byte(fmt.Sprintf("user %d", i)), time.Date(2026, 1, i%28+1, 0, 0, 0, 0, time.UTC), nil})
+	}
+	return rows, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error { return errors.New("read-only queries must not commit") }
+func (fakeTx) Rollback() error {
+	fakeDB.Lock()
+	fakeDB.rolledBack = true
+	fakeDB.Unlock()
+	return nil
+}
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+	i    int
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i == len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.i])
+	r.i++
+	return nil
+}
+
+func TestCheckReadOnlySQL(t *testing.T) {
+	for _, q := range []string{
+		"select 1",
+		"SELECT * FROM t;",
+		"  with x as (select 1) select * from x",
+		"-- why\nexplain select 1",
+		"/* note */ (select 1)",
+		"show tables",
+	} {
+		if err := checkReadOnlySQL(q); err != nil {
+			t.Errorf("checkReadOnlySQL(%q) = %v", q, err)
+		}
+	}
+	for _, q := range []string{
+		"delete from t",
+		"update t set a = 1",
+		"select 1; drop table t",
+		"-- only a comment",
+		"",
+		"123",
+	} {
+		if err := checkReadOnlySQL(q); err == nil {
+			t.Errorf("expected %q to be rejected", q)
+		}
+	}
+}
+
+func TestFormatDBTable(t *testing.T) {
+	res := &dbResult{Columns: []string{"id", "name"}, Rows: [][]string{{"1", "alice"}, {"22", "bob\nsmith"}, {"3", "carol"}}}
+	want := "id | name\n---+----------\n1  | alice\n22 | bob smith"
+	if got := formatDBTable(res, 2); got != want {
+		t.Fatalf("unexpected table:\n%s", got)
+	}
+}
+
+func TestRunDBQuery(t *testing.T) {
+	res, err := runDBQuery(context.Background(), "fakedb", "dsn", "select 5", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rows) != 3 || !res.Truncated || res.Rows[0][1] != "user 1" || res.Rows[0][2] != "2026-01-02T00:00:00Z" || res.Rows[0][3] != "NULL" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	fakeDB.Lock()
+	defer fakeDB.Unlock()
+	if !fakeDB.readOnly || !fakeDB.rolledBack {
+		t.Fatalf("expected a rolled back read-only transaction, got readOnly=%v rolledBack=%v", fakeDB.readOnly, fakeDB.rolledBack)
+	}
+}
+
+func newDBRouter(t *testing.T) (*Router, *fileSpySender) {
+	t.Helper()
+	r, _ := newTestRouter(t)
+	sender := &fileSpySender{}
+	r.sender = sender
+	dir := filepath.Join(r.store.WorkRoot(), "shop")
+	os.MkdirAll(dir, 0755)
+	r.getSession("chat1")
+	r.store.UpdateSession("chat1", func(s *Session) { s.WorkDir = dir })
+	r.SetDBConnections([]DBConnection{
+		{Name: "shop-ro", Project: "shop", Driver: "fakedb", DSNSecret: "shop_dsn"},
+		{Name: "other", Project: "/srv/other", Driver: "fakedb", DSNSecret: "other_dsn"},
+	}, 0)
+	return r, sender
+}
+
+func TestRouterDB_Query(t *testing.T) {
+	r, sender := newDBRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/db list")
+	if msg := sender.LastMessage(); !strings.HasPrefix(msg, "数据库连接（1）") || !strings.Contains(msg, "缺少密钥 `shop_dsn`") {
+		t.Fatalf("unexpected list %q", msg)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/db query select 2")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "缺少密钥 shop_dsn") {
+		t.Fatalf("expected missing secret, got %q", msg)
+	}
+
+	t.Setenv("DEVBOT_SECRET_SHOP_DSN", "postgres://ro@db/shop")
+	r.Route(context.Background(), "chat1", "user1", "/db query select 2")
+	msg := sender.LastMessage()
+	if !strings.HasPrefix(msg, "查询结果: 2 行（shop-ro）") || !strings.Contains(msg, "2  | user 2") || len(sender.files) != 0 {
+		t.Fatalf("unexpected result card %q", msg)
+	}
+	fakeDB.Lock()
+	dsn := fakeDB.dsn
+	fakeDB.Unlock()
+	if dsn != "postgres://ro@db/shop" {
+		t.Fatalf("expected the DSN from the secret, got %q", dsn)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/db query @shop-ro select 30")
+	msg = sender.LastMessage()
+	if !strings.Contains(msg, "仅显示前 20 行") {
+		t.Fatalf("expected a truncated card, got %q", msg)
+	}
+	var data []byte
+	for name, d := range sender.files {
+		if strings.HasPrefix(name, "shop-ro-") && strings.HasSuffix(name, ".csv") {
+			data = d
+		}
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 31 || lines[0] != "id,name,created_at,note" {
+		t.Fatalf("expected CSV with all rows, got %q", data)
+	}
+}
+
+func TestRouterDB_Rejects(t *testing.T) {
+	r, sender := newDBRouter(t)
+	t.Setenv("DEVBOT_SECRET_SHOP_DSN", "dsn")
+	r.Route(context.Background(), "chat1", "user1", "/db query delete from users")
+	if msg := sender.LastMessage(); !strings.HasPrefix(msg, "拒绝执行") || !strings.Contains(msg, "DELETE") {
+		t.Fatalf("expected rejection, got %q", msg)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/db query @other select 1")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "没有名为 other") {
+		t.Fatalf("expected connection of another project to be hidden, got %q", msg)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/db query select * from nope")
+	if msg := sender.LastMessage(); !strings.HasPrefix(msg, "查询失败: shop-ro") || !strings.Contains(msg, "does not exist") {
+		t.Fatalf("expected query error, got %q", msg)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/db drop")
+	if !strings.HasPrefix(sender.LastMessage(), "用法:") {
+		t.Fatalf("expected usage, got %q", sender.LastMessage())
+	}
+}
@@ -0,0 +1,416 @@
+package bot
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// deleteConfirmTimeout is how long a run waits for the user to
+// confirm a deletion before it is cancelled.
+var deleteConfirmTimeout = 5 * time.Minute
+
+// errDeletionRejected ends a run whose deletion the user did not confirm.
+var errDeletionRejected = errors.New("删除操作未获确认，已停止执行")
+
+// deleteGuard is asked before a run deletes paths and reports whether the
+// deletion may go ahead; command is the whole Bash command doing it, or ""
+// for other tools. The tool call waits for it.
+type deleteGuard func(paths []string, command string) bool
+
+type deleteGuardKey struct{}
+
+// withDeleteGuard makes the local Claude executor ask guard, through a
+// PreToolUse hook, before Claude deletes files.
+func withDeleteGuard(ctx context.Context, guard deleteGuard) context.Context {
+	return context.WithValue(ctx, deleteGuardKey{}, guard)
+}
+
+// deleteGuardFrom returns the guard set by withDeleteGuard, or nil.
+func deleteGuardFrom(ctx context.Context) deleteGuard {
+	guard, _ := ctx.Value(deleteGuardKey{}).(deleteGuard)
+	return guard
+}
+
+// toolDeletions returns what a tool call would delete: rm/rmdir/unlink/git
+// rm/find -delete in Bash commands, and the path arguments of tools named
+// like delete or remove.
+func toolDeletions(tool string, input map[string]interface{}) []string {
+	if tool == "Bash" {
+		command, _ := input["command"].(string)
+		return shellDeletions(command)
+	}
+	name := strings.ToLower(tool)
+	if !strings.Contains(name, "delete") && !strings.Contains(name, "remove") && !strings.Contains(name, "unlink") {
+		return nil
+	}
+	var paths []string
+	for _, key := range []string{"path", "file_path", "paths", "target"} {
+		switch v := input[key].(type) {
+		case string:
+			paths = append(paths, v)
+		case []interface{}:
+			for _, p := range v {
+				if s, ok := p.(string); ok {
+					paths = append(paths, s)
+				}
+			}
+		}
+	}
+	if len(paths) == 0 {
+		paths = append(paths, fmt.Sprintf("（%s）", tool))
+	}
+	return paths
+}
+
+// shellSegments splits a shell command line into its simple commands.
+func shellSegments(command string) []string {
+	return strings.FieldsFunc(command, func(c rune) bool {
+		return c == ';' || c == '&' || c == '|' || c == '\n' || c == '(' || c == ')'
+	})
+}
+
+// shellDeletions returns the paths a shell command line deletes.
+func shellDeletions(command string) []string {
+	var paths []string
+	for _, seg := range shellSegments(command) {
+		paths = append(paths, segmentDeletions(seg)...)
+	}
+	return paths
+}
+
+// segmentDeletions returns the paths one simple command deletes, or nil
+// when it is not a deletion.
+func segmentDeletions(seg string) []string {
+	words := strings.Fields(seg)
+	for len(words) > 0 && (words[0] == "sudo" || words[0] == "xargs" || words[0] == "command" || strings.Contains(words[0], "=")) {
+		words = words[1:]
+	}
+	if len(words) == 0 {
+		return nil
+	}
+	var args []string
+	switch {
+	case words[0] == "rm" || words[0] == "rmdir" || words[0] == "unlink" || words[0] == "shred":
+		args = words[1:]
+	case words[0] == "git" && len(words) > 1 && words[1] == "rm":
+		args = words[2:]
+	case words[0] == "find" && containsWord(words, "-delete"):
+		return []string{strings.Join(words, " ")}
+	default:
+		return nil
+	}
+	var paths []string
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") {
+			paths = append(paths, strings.Trim(a, `"'`))
+		}
+	}
+	if len(paths) == 0 {
+		paths = append(paths, strings.Join(words, " "))
+	}
+	return paths
+}
+
+// onlyDeletes reports whether a tool call does nothing but delete: a
+// delete-like tool, or a Bash command every part of which is a deletion,
+// with no substitutions or redirections. Only such calls are approved
+// outright once the user confirms; anything else still goes through the
+// run's normal permission checks.
+func onlyDeletes(tool string, input map[string]interface{}) bool {
+	if tool != "Bash" {
+		return len(toolDeletions(tool, input)) > 0
+	}
+	command, _ := input["command"].(string)
+	if strings.ContainsAny(command, "`$<>") {
+		return false
+	}
+	segments := shellSegments(command)
+	for _, seg := range segments {
+		if strings.TrimSpace(seg) == "" {
+			continue
+		}
+		if segmentDeletions(seg) == nil || strings.Contains(seg, "-exec") || strings.Contains(seg, "-ok") {
+			return false
+		}
+	}
+	return len(segments) > 0
+}
+
+func containsWord(words []string, w string) bool {
+	for _, x := range words {
+		if x == w {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteHookCommand is the devbot subcommand Claude runs as a PreToolUse
+// hook in guarded runs; see RunDeleteHook.
+const DeleteHookCommand = "pretooluse"
+
+// deleteGuardEnv passes the socket of a run's deleteGate to the hook, which
+// the CLI runs with its own environment.
+const deleteGuardEnv = "DEVBOT_DELETE_GUARD"
+
+// deleteHookMatcher selects the tools the hook runs for: those
+// toolDeletions looks at.
+const deleteHookMatcher = "Bash|.*[Dd]elete.*|.*[Rr]emove.*|.*[Uu]nlink.*"
+
+// hookInput is the part of a PreToolUse hook's input the guard needs.
+type hookInput struct {
+	ToolName  string                 `json:"tool_name"`
+	ToolInput map[string]interface{} `json:"tool_input"`
+}
+
+// deleteGate answers the deletion hook of one run. The CLI runs the hook
+// before the tool, and the tool waits for it, so nothing is deleted until
+// the guard has decided.
+type deleteGate struct {
+	ln     net.Listener
+	dir    string
+	socket string
+	guard  deleteGuard
+	stop   func()
+
+	mu       sync.Mutex // one question at a time
+	rejected bool
+}
+
+// startDeleteGate listens for the hook on a socket in a private directory.
+// stop ends the run once a deletion is rejected.
+func startDeleteGate(guard deleteGuard, stop func()) (*deleteGate, error) {
+	dir, err := os.MkdirTemp("", "devbot-guard-")
+	if err != nil {
+		return nil, err
+	}
+	socket := filepath.Join(dir, "guard.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	g := &deleteGate{ln: ln, dir: dir, socket: socket, guard: guard, stop: stop}
+	go g.serve()
+	return g, nil
+}
+
+func (g *deleteGate) serve() {
+	for {
+		conn, err := g.ln.Accept()
+		if err != nil {
+			return
+		}
+		go g.handle(conn)
+	}
+}
+
+// handle reads a hook's input and replies "allow", "deny" or, for tool
+// calls that delete nothing, an empty line.
+func (g *deleteGate) handle(conn net.Conn) {
+	defer conn.Close()
+	var in hookInput
+	if err := json.NewDecoder(conn).Decode(&in); err != nil {
+		slog.Warn("delete guard: bad hook input", "err", err)
+		return
+	}
+	command := ""
+	if in.ToolName == "Bash" {
+		command, _ = in.ToolInput["command"].(string)
+	}
+	fmt.Fprintln(conn, g.decide(toolDeletions(in.ToolName, in.ToolInput), command))
+}
+
+func (g *deleteGate) decide(paths []string, command string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.rejected {
+		return "deny"
+	}
+	if g.guard(paths, command) {
+		return "allow"
+	}
+	g.rejected = true
+	g.stop()
+	return "deny"
+}
+
+// wasRejected reports whether a deletion was rejected during the run.
+func (g *deleteGate) wasRejected() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.rejected
+}
+
+// settings returns the --settings JSON installing the hook.
+func (g *deleteGate) settings() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	hook := map[string]interface{}{
+		"type":    "command",
+		"command": shellQuote(exe) + " " + DeleteHookCommand,
+		"timeout": int((deleteConfirmTimeout + time.Minute).Seconds()),
+	}
+	b, err := json.Marshal(map[string]interface{}{
+		"hooks": map[string]interface{}{
+			"PreToolUse": []interface{}{
+				map[string]interface{}{"matcher": deleteHookMatcher, "hooks": []interface{}{hook}},
+			},
+		},
+	})
+	return string(b), err
+}
+
+// env returns the environment entry pointing the hook at the gate.
+func (g *deleteGate) env() string {
+	return deleteGuardEnv + "=" + g.socket
+}
+
+func (g *deleteGate) Close() {
+	g.ln.Close()
+	os.RemoveAll(g.dir)
+}
+
+// RunDeleteHook is the PreToolUse hook run as `devbot pretooluse`: it asks
+// the deletion guard of the run about a tool call that deletes files and
+// waits for the answer. A confirmed call that only deletes (onlyDeletes)
+// is approved outright, so it also runs in safe mode; any other confirmed
+// call is left to the run's normal permission checks. It returns the exit
+// code; 2 blocks the tool call, which is also what happens when the guard
+// cannot be reached.
+func RunDeleteHook(stdin io.Reader, stdout, stderr io.Writer) int {
+	data, err := io.ReadAll(stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "devbot: read hook input: %v\n", err)
+		return 2
+	}
+	var in hookInput
+	if err := json.Unmarshal(data, &in); err != nil {
+		fmt.Fprintf(stderr, "devbot: bad hook input: %v\n", err)
+		return 2
+	}
+	if len(toolDeletions(in.ToolName, in.ToolInput)) == 0 {
+		return 0
+	}
+	socket := os.Getenv(deleteGuardEnv)
+	if socket == "" {
+		fmt.Fprintln(stderr, "devbot: 删除确认不可用，已阻止删除")
+		return 2
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		fmt.Fprintf(stderr, "devbot: 删除确认不可用，已阻止删除: %v\n", err)
+		return 2
+	}
+	defer conn.Close()
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		fmt.Fprintf(stderr, "devbot: %v\n", err)
+		return 2
+	}
+	reply, _ := bufio.NewReader(conn).ReadString('\n')
+	switch strings.TrimSpace(reply) {
+	case "allow":
+		if !onlyDeletes(in.ToolName, in.ToolInput) {
+			return 0
+		}
+		json.NewEncoder(stdout).Encode(map[string]interface{}{
+			"hookSpecificOutput": map[string]string{
+				"hookEventName":            "PreToolUse",
+				"permissionDecision":       "allow",
+				"permissionDecisionReason": "用户已在聊天中确认删除",
+			},
+		})
+		return 0
+	default:
+		fmt.Fprintln(stderr, errDeletionRejected.Error())
+		return 2
+	}
+}
+
+// pendingDelete is a deletion waiting for /confirm or /deny.
+type pendingDelete struct {
+	paths  []string
+	decide chan bool
+}
+
+// confirmDelete asks the chat to confirm a deletion and waits for the
+// answer, deleteConfirmTimeout or ctx, whichever comes first.
+func (r *Router) confirmDelete(ctx context.Context, chatID string, paths []string, command string) bool {
+	p := &pendingDelete{paths: paths, decide: make(chan bool, 1)}
+	r.mu.Lock()
+	r.pendingDeletes[chatID] = p
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		if r.pendingDeletes[chatID] == p {
+			delete(r.pendingDeletes, chatID)
+		}
+		r.mu.Unlock()
+	}()
+
+	var sb strings.Builder
+	sb.WriteString("Claude 想要删除以下文件，执行已暂停：\n")
+	for i, path := range paths {
+		if i == 20 {
+			fmt.Fprintf(&sb, "- ... 另有 %d 项\n", len(paths)-20)
+			break
+		}
+		fmt.Fprintf(&sb, "- `%s`\n", truncateRunes(path, 200))
+	}
+	if command != "" {
+		// The paths are parsed from it; what else it does is shown too.
+		fmt.Fprintf(&sb, "\n**完整命令:**\n```\n%s\n```\n", truncateRunes(command, 1000))
+	}
+	fmt.Fprintf(&sb, "\n回复 `/confirm` 允许删除，`/deny` 拒绝并停止执行（%s 内未确认将自动拒绝）。", deleteConfirmTimeout)
+	r.sender.SendCard(ctx, chatID, CardMsg{
+		Title:    "确认删除",
+		Content:  sb.String(),
+		Template: "orange",
+		Buttons: []CardButton{
+			{Text: "允许删除", Command: "/confirm", Type: "danger"},
+			{Text: "拒绝", Command: "/deny"},
+		},
+	})
+	slog.InfoContext(ctx, "router: deletion paused", "chat_id", chatID, "paths", paths)
+
+	timer := time.NewTimer(deleteConfirmTimeout)
+	defer timer.Stop()
+	select {
+	case ok := <-p.decide:
+		return ok
+	case <-timer.C:
+		r.sender.SendText(ctx, chatID, "删除确认已超时，已拒绝。")
+	case <-ctx.Done():
+	}
+	return false
+}
+
+// resolveDelete answers the chat's pending deletion, reporting whether
+// there was one.
+func (r *Router) resolveDelete(chatID string, ok bool) bool {
+	r.mu.Lock()
+	p := r.pendingDeletes[chatID]
+	delete(r.pendingDeletes, chatID)
+	r.mu.Unlock()
+	if p == nil {
+		return false
+	}
+	p.decide <- ok
+	return true
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd)
+
+package bot
+
+// diskSpace is only implemented where syscall.Statfs has the same shape
+// (Linux, macOS, FreeBSD); other systems show it as unknown.
+func diskSpace(dir string) string {
+	return "未知"
+}
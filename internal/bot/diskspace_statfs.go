@@ -0,0 +1,18 @@
+//go:build linux || darwin || freebsd
+
+package bot
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// diskSpace reports the free and total space of the filesystem holding dir.
+func diskSpace(dir string) string {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return fmt.Sprintf("出错: %v", err)
+	}
+	bsize := uint64(st.Bsize)
+	return fmt.Sprintf("可用 %s / 共 %s", formatSize(int64(uint64(st.Bavail)*bsize)), formatSize(int64(st.Blocks*bsize)))
+}
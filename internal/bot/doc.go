@@ -4,10 +4,14 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 
 	lark "github.com/larksuite/oapi-sdk-go/v3"
 	larkdocx "github.com/larksuite/oapi-sdk-go/v3/service/docx/v1"
+	larkdrive "github.com/larksuite/oapi-sdk-go/v3/service/drive/v1"
+	larkwiki "github.com/larksuite/oapi-sdk-go/v3/service/wiki/v2"
 )
 
 const maxBlocksPerRequest = 50 // Feishu API limit for DocumentBlockChildren.Create
@@ -19,6 +23,18 @@ type DocPusher interface {
 	PullDocContent(ctx context.Context, docID string) (string, error)
 }
 
+// folderDocPusher is implemented by doc pushers that can create documents
+// in a given folder rather than the app's root.
+type folderDocPusher interface {
+	CreateDocInFolder(ctx context.Context, folderToken, title, content string) (docID, docURL string, err error)
+}
+
+// docReplacer is implemented by doc pushers that can replace the content
+// of an existing document, keeping its ID and URL.
+type docReplacer interface {
+	ReplaceDocContent(ctx context.Context, docID, content string) (docURL string, err error)
+}
+
 // DocSyncer implements DocPusher using the Lark DocX API.
 type DocSyncer struct {
 	client *lark.Client
@@ -30,13 +46,21 @@ func NewDocSyncer(client *lark.Client) *DocSyncer {
 }
 
 // CreateAndPushDoc creates a new Feishu document with the given title, then
-// inserts the content as text paragraph blocks. Returns the document ID and URL.
+// inserts the content converted from Markdown into DocX blocks. Returns the document ID and URL.
 func (d *DocSyncer) CreateAndPushDoc(ctx context.Context, title, content string) (string, string, error) {
+	return d.CreateDocInFolder(ctx, "", title, content)
+}
+
+// CreateDocInFolder is CreateAndPushDoc creating the document in the folder
+// with the given token ("" = the app's root folder).
+func (d *DocSyncer) CreateDocInFolder(ctx context.Context, folderToken, title, content string) (string, string, error) {
 	// 1. Create the document
+	body := larkdocx.NewCreateDocumentReqBodyBuilder().Title(title)
+	if folderToken != "" {
+		body = body.FolderToken(folderToken)
+	}
 	createReq := larkdocx.NewCreateDocumentReqBuilder().
-		Body(larkdocx.NewCreateDocumentReqBodyBuilder().
-			Title(title).
-			Build()).
+		Body(body.Build()).
 		Build()
 
 	createResp, err := d.client.Docx.Document.Create(ctx, createReq)
@@ -51,11 +75,69 @@ func (d *DocSyncer) CreateAndPushDoc(ctx context.Context, title, content string)
 		return "", "", fmt.Errorf("create document: response missing document ID")
 	}
 	docID := *createResp.Data.Document.DocumentId
-	docURL := fmt.Sprintf("https://feishu.cn/docx/%s", docID)
+	docURL := docURLFor(docID)
+
+	// 2. Insert content as DocX blocks
+	if err := d.insertBlocks(ctx, docID, content); err != nil {
+		return docID, docURL, err
+	}
+	return docID, docURL, nil
+}
 
-	// 2. Insert content as paragraph blocks (max 50 per API call)
+// ReplaceDocContent deletes all top-level blocks of the document and
+// inserts content in their place, so the document keeps its ID and URL.
+func (d *DocSyncer) ReplaceDocContent(ctx context.Context, docID, content string) (string, error) {
+	docURL := docURLFor(docID)
+	docID, err := d.resolveDocID(ctx, docID)
+	if err != nil {
+		return docURL, err
+	}
+	getReq := larkdocx.NewGetDocumentBlockReqBuilder().
+		DocumentId(docID).
+		BlockId(docID).
+		DocumentRevisionId(-1).
+		Build()
+	getResp, err := d.client.Docx.DocumentBlock.Get(ctx, getReq)
+	if err != nil {
+		return docURL, fmt.Errorf("get document block: %w", err)
+	}
+	if !getResp.Success() {
+		return docURL, fmt.Errorf("get document block failed: code=%d msg=%s", getResp.Code, getResp.Msg)
+	}
+
+	if getResp.Data != nil && getResp.Data.Block != nil {
+		if n := len(getResp.Data.Block.Children); n > 0 {
+			delReq := larkdocx.NewBatchDeleteDocumentBlockChildrenReqBuilder().
+				DocumentId(docID).
+				BlockId(docID).
+				DocumentRevisionId(-1).
+				Body(larkdocx.NewBatchDeleteDocumentBlockChildrenReqBodyBuilder().
+					StartIndex(0).
+					EndIndex(n).
+					Build()).
+				Build()
+			delResp, err := d.client.Docx.DocumentBlockChildren.BatchDelete(ctx, delReq)
+			if err != nil {
+				return docURL, fmt.Errorf("delete blocks: %w", err)
+			}
+			if !delResp.Success() {
+				return docURL, fmt.Errorf("delete blocks failed: code=%d msg=%s", delResp.Code, delResp.Msg)
+			}
+		}
+	}
+
+	if err := d.insertBlocks(ctx, docID, content); err != nil {
+		return docURL, err
+	}
+	return docURL, nil
+}
+
+// insertBlocks appends content, converted to DocX blocks, to the end of
+// the document (max 50 blocks per API call), then uploads the local images
+// it embeds into their image blocks.
+func (d *DocSyncer) insertBlocks(ctx context.Context, docID, content string) error {
 	if content != "" {
-		blocks := buildParagraphBlocks(content)
+		blocks, images := buildMarkdownBlocks(content, docImageResolver(ctx))
 		for i := 0; i < len(blocks); i += maxBlocksPerRequest {
 			end := i + maxBlocksPerRequest
 			if end > len(blocks) {
@@ -75,19 +157,171 @@ func (d *DocSyncer) CreateAndPushDoc(ctx context.Context, title, content string)
 
 			childResp, err := d.client.Docx.DocumentBlockChildren.Create(ctx, childrenReq)
 			if err != nil {
-				return docID, docURL, fmt.Errorf("insert blocks (batch %d): %w", i/maxBlocksPerRequest, err)
+				return fmt.Errorf("insert blocks (batch %d): %w", i/maxBlocksPerRequest, err)
 			}
 			if !childResp.Success() {
-				return docID, docURL, fmt.Errorf("insert blocks failed (batch %d): code=%d msg=%s", i/maxBlocksPerRequest, childResp.Code, childResp.Msg)
+				return fmt.Errorf("insert blocks failed (batch %d): code=%d msg=%s", i/maxBlocksPerRequest, childResp.Code, childResp.Msg)
+			}
+
+			for j := i; j < end; j++ {
+				path, ok := images[j]
+				if !ok {
+					continue
+				}
+				if childResp.Data == nil || j-i >= len(childResp.Data.Children) || childResp.Data.Children[j-i].BlockId == nil {
+					return fmt.Errorf("insert blocks (batch %d): response missing image block ID", i/maxBlocksPerRequest)
+				}
+				if err := d.uploadImage(ctx, docID, *childResp.Data.Children[j-i].BlockId, path); err != nil {
+					return fmt.Errorf("upload image %s: %w", filepath.Base(path), err)
+				}
 			}
 		}
 	}
+	return nil
+}
 
-	return docID, docURL, nil
+// uploadImage uploads the image file at path as the media of the empty
+// image block blockID and sets it as the block's image.
+func (d *DocSyncer) uploadImage(ctx context.Context, docID, blockID, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	uploadReq := larkdrive.NewUploadAllMediaReqBuilder().
+		Body(larkdrive.NewUploadAllMediaReqBodyBuilder().
+			FileName(filepath.Base(path)).
+			ParentType("docx_image").
+			ParentNode(blockID).
+			Size(int(info.Size())).
+			Extra(fmt.Sprintf(`{"drive_route_token":%q}`, docID)).
+			File(f).
+			Build()).
+		Build()
+	uploadResp, err := d.client.Drive.Media.UploadAll(ctx, uploadReq)
+	if err != nil {
+		return fmt.Errorf("upload media: %w", err)
+	}
+	if !uploadResp.Success() {
+		return fmt.Errorf("upload media failed: code=%d msg=%s", uploadResp.Code, uploadResp.Msg)
+	}
+	if uploadResp.Data == nil || uploadResp.Data.FileToken == nil {
+		return fmt.Errorf("upload media: response missing file token")
+	}
+
+	patchReq := larkdocx.NewPatchDocumentBlockReqBuilder().
+		DocumentId(docID).
+		BlockId(blockID).
+		DocumentRevisionId(-1).
+		UpdateBlockRequest(larkdocx.NewUpdateBlockRequestBuilder().
+			ReplaceImage(larkdocx.NewReplaceImageRequestBuilder().
+				Token(*uploadResp.Data.FileToken).
+				Build()).
+			Build()).
+		Build()
+	patchResp, err := d.client.Docx.DocumentBlock.Patch(ctx, patchReq)
+	if err != nil {
+		return fmt.Errorf("set image: %w", err)
+	}
+	if !patchResp.Success() {
+		return fmt.Errorf("set image failed: code=%d msg=%s", patchResp.Code, patchResp.Msg)
+	}
+	return nil
+}
+
+// maxDocImageSize is the Feishu limit for a media file uploaded in one
+// request.
+const maxDocImageSize = 20 << 20
+
+type docImageKey struct{}
+
+type docImageDir struct{ dir, root string }
+
+// withDocImageDir makes documents pushed with ctx embed local images: image
+// sources are resolved against dir and must stay under root.
+func withDocImageDir(ctx context.Context, dir, root string) context.Context {
+	return context.WithValue(ctx, docImageKey{}, docImageDir{dir, root})
+}
+
+// docImageResolver returns the localImage function buildMarkdownBlocks
+// uses for ctx, or nil if images are not to be uploaded.
+func docImageResolver(ctx context.Context) func(src string) string {
+	d, ok := ctx.Value(docImageKey{}).(docImageDir)
+	if !ok {
+		return nil
+	}
+	return func(src string) string {
+		if strings.Contains(src, "://") || strings.HasPrefix(src, "data:") {
+			return ""
+		}
+		if unescaped, err := url.PathUnescape(src); err == nil {
+			src = unescaped
+		}
+		path := src
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(d.dir, path)
+		}
+		if !underRoot(d.root, path) || !isImageFile(path) {
+			return ""
+		}
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() || info.Size() == 0 || info.Size() > maxDocImageSize {
+			return ""
+		}
+		return path
+	}
+}
+
+// docURLFor returns the browser URL of a DocX document or wiki node.
+func docURLFor(docID string) string {
+	if token, ok := strings.CutPrefix(docID, wikiPrefix); ok {
+		return fmt.Sprintf("https://feishu.cn/wiki/%s", token)
+	}
+	return fmt.Sprintf("https://feishu.cn/docx/%s", docID)
+}
+
+// wikiPrefix marks a document ID that is really the token of a wiki
+// (knowledge base) node, as ParseDocID returns for /wiki/ URLs.
+const wikiPrefix = "wiki:"
+
+// resolveDocID returns the DocX document ID behind docID: docID itself, or
+// for a wiki node the document it holds, since the DocX APIs only accept
+// document IDs.
+func (d *DocSyncer) resolveDocID(ctx context.Context, docID string) (string, error) {
+	token, ok := strings.CutPrefix(docID, wikiPrefix)
+	if !ok {
+		return docID, nil
+	}
+	req := larkwiki.NewGetNodeSpaceReqBuilder().
+		Token(token).
+		ObjType("wiki").
+		Build()
+	resp, err := d.client.Wiki.Space.GetNode(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("get wiki node: %w", err)
+	}
+	if !resp.Success() {
+		return "", fmt.Errorf("get wiki node failed: code=%d msg=%s", resp.Code, resp.Msg)
+	}
+	if resp.Data == nil || resp.Data.Node == nil || resp.Data.Node.ObjToken == nil {
+		return "", fmt.Errorf("get wiki node: response missing document token")
+	}
+	if t := resp.Data.Node.ObjType; t != nil && *t != "docx" {
+		return "", fmt.Errorf("wiki node %s holds a %s, not a docx document", token, *t)
+	}
+	return *resp.Data.Node.ObjToken, nil
 }
 
 // PullDocContent retrieves the raw text content of a Feishu document.
 func (d *DocSyncer) PullDocContent(ctx context.Context, docID string) (string, error) {
+	docID, err := d.resolveDocID(ctx, docID)
+	if err != nil {
+		return "", err
+	}
 	req := larkdocx.NewRawContentDocumentReqBuilder().
 		DocumentId(docID).
 		Build()
@@ -106,35 +340,11 @@ func (d *DocSyncer) PullDocContent(ctx context.Context, docID string) (string, e
 	return *resp.Data.Content, nil
 }
 
-// buildParagraphBlocks splits content by newlines and creates a text block for each line.
-// Empty lines are converted to blocks with a single space, since the Feishu API
-// rejects empty TextRun content (error 99992402 "field validation failed").
-func buildParagraphBlocks(content string) []*larkdocx.Block {
-	lines := strings.Split(content, "\n")
-	blocks := make([]*larkdocx.Block, 0, len(lines))
-	for _, line := range lines {
-		if line == "" {
-			line = " "
-		}
-		textElement := larkdocx.NewTextElementBuilder().
-			TextRun(larkdocx.NewTextRunBuilder().Content(line).Build()).
-			Build()
-
-		block := larkdocx.NewBlockBuilder().
-			BlockType(2). // 2 = Text block
-			Text(larkdocx.NewTextBuilder().
-				Elements([]*larkdocx.TextElement{textElement}).
-				Build()).
-			Build()
-		blocks = append(blocks, block)
-	}
-	return blocks
-}
-
 // ParseDocID extracts a document ID from a Feishu URL or returns the raw ID if
 // it does not look like a URL. Supported URL formats:
 //   - https://xxx.feishu.cn/docx/DOCID
 //   - https://xxx.feishu.cn/docx/DOCID?query...
+//   - https://xxx.feishu.cn/wiki/TOKEN (returned as "wiki:TOKEN")
 //   - Raw doc ID string (returned as-is)
 func ParseDocID(raw string) string {
 	raw = strings.TrimSpace(raw)
@@ -157,6 +367,10 @@ func ParseDocID(raw string) string {
 	if len(parts) >= 2 && parts[0] == "docx" {
 		return parts[1]
 	}
+	// Wiki node tokens are not document IDs; DocSyncer resolves them.
+	if len(parts) >= 2 && parts[0] == "wiki" && parts[1] != "" {
+		return wikiPrefix + parts[1]
+	}
 
 	// Fallback: return the last non-empty path segment
 	for i := len(parts) - 1; i >= 0; i-- {
@@ -52,14 +52,16 @@ func TestParseDocID_Whitespace(t *testing.T) {
 }
 
 func TestParseDocID_FallbackLastSegment(t *testing.T) {
-	// Non-docx URL: should fall back to returning the last non-empty path segment.
+	// Wiki URLs yield wiki node tokens; other URLs fall back to returning
+	// the last non-empty path segment.
 	tests := []struct {
 		input string
 		want  string
 	}{
-		{"https://feishu.cn/wiki/DOC123", "DOC123"},
+		{"https://feishu.cn/wiki/DOC123", "wiki:DOC123"},
 		{"https://feishu.cn/drive/home/FILEID", "FILEID"},
-		{"https://feishu.cn/wiki/DOC123/", "DOC123"},
+		{"https://feishu.cn/wiki/DOC123/", "wiki:DOC123"},
+		{"https://feishu.cn/wiki/DOC123?from=share", "wiki:DOC123"},
 		// Root URL with no path segments — falls back to returning raw URL
 		{"https://feishu.cn/", "https://feishu.cn/"},
 	}
@@ -71,6 +73,33 @@ func TestParseDocID_FallbackLastSegment(t *testing.T) {
 	}
 }
 
+func TestDocURLFor(t *testing.T) {
+	if got := docURLFor("DOC1"); got != "https://feishu.cn/docx/DOC1" {
+		t.Errorf("docURLFor(doc) = %q", got)
+	}
+	if got := docURLFor("wiki:WK1"); got != "https://feishu.cn/wiki/WK1" {
+		t.Errorf("docURLFor(wiki) = %q", got)
+	}
+}
+
+func TestDocBind_WikiURL(t *testing.T) {
+	fake := &fakeDocPusher{pullContent: "from wiki"}
+	r, sender, dir := newTestRouterWithDoc(t, fake)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "/doc bind notes.md https://acme.feishu.cn/wiki/WK42")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "wiki:WK42") {
+		t.Fatalf("bind reply = %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "/doc pull notes.md")
+	if fake.pullDocID != "wiki:WK42" {
+		t.Fatalf("pulled %q, want the wiki token", fake.pullDocID)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "notes.md")); string(data) != "from wiki" {
+		t.Fatalf("pulled content = %q", data)
+	}
+}
+
 func TestParseDocID_URLParseError(t *testing.T) {
 	// url.Parse returns error for malformed URLs — should return raw string
 	malformed := "://invalid"
@@ -82,6 +111,32 @@ func TestParseDocID_URLParseError(t *testing.T) {
 
 // --- Fake DocPusher for router tests ---
 
+func TestDocImageResolver(t *testing.T) {
+	root := t.TempDir()
+	docs := filepath.Join(root, "proj", "docs")
+	os.MkdirAll(filepath.Join(docs, "img"), 0755)
+	os.WriteFile(filepath.Join(docs, "img", "a b.png"), []byte("png"), 0644)
+	os.WriteFile(filepath.Join(root, "proj", "shared.png"), []byte("png"), 0644)
+	os.WriteFile(filepath.Join(docs, "notes.txt"), []byte("txt"), 0644)
+
+	if docImageResolver(context.Background()) != nil {
+		t.Fatal("resolver without image dir should be nil")
+	}
+	resolve := docImageResolver(withDocImageDir(context.Background(), docs, filepath.Join(root, "proj")))
+	for src, want := range map[string]string{
+		"img/a%20b.png":             filepath.Join(docs, "img", "a b.png"),
+		"../shared.png":             filepath.Join(root, "proj", "shared.png"),
+		"../../outside.png":         "",
+		"notes.txt":                 "",
+		"img/missing.png":           "",
+		"https://example.com/x.png": "",
+	} {
+		if got := resolve(src); got != want {
+			t.Errorf("resolve(%q) = %q, want %q", src, got, want)
+		}
+	}
+}
+
 type fakeDocPusher struct {
 	createdTitle   string
 	createdContent string
@@ -162,6 +217,65 @@ func TestDocPush_Success(t *testing.T) {
 	}
 }
 
+func TestDocPush_SourceFileAsCodeBlock(t *testing.T) {
+	fake := &fakeDocPusher{returnDocID: "doc1", returnDocURL: "https://feishu.cn/docx/doc1"}
+	r, _, dir := newTestRouterWithDoc(t, fake)
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644)
+
+	r.Route(context.Background(), "chat1", "user1", "/doc push main.go")
+	if fake.createdContent != "```go\npackage main\n```" {
+		t.Fatalf("expected fenced Go source, got %q", fake.createdContent)
+	}
+}
+
+// fakeDocReplacer is a fakeDocPusher that can also replace a document's
+// content in place.
+type fakeDocReplacer struct {
+	fakeDocPusher
+	replacedDocID   string
+	replacedContent string
+	replaceErr      error
+}
+
+func (f *fakeDocReplacer) ReplaceDocContent(_ context.Context, docID, content string) (string, error) {
+	f.replacedDocID = docID
+	f.replacedContent = content
+	return "https://feishu.cn/docx/" + docID, f.replaceErr
+}
+
+func TestDocPush_BoundFileUpdatesInPlace(t *testing.T) {
+	fake := &fakeDocReplacer{fakeDocPusher: fakeDocPusher{returnDocID: "new1", returnDocURL: "https://feishu.cn/docx/new1"}}
+	r, sender, dir := newTestRouterWithDoc(t, fake)
+	path := filepath.Join(dir, "README.md")
+
+	r.Route(context.Background(), "chat1", "user1", "/doc push README.md")
+	if fake.createdTitle != "README.md" || fake.replacedDocID != "" {
+		t.Fatalf("unbound push should create a document (created %q, replaced %q)", fake.createdTitle, fake.replacedDocID)
+	}
+	fake.createdTitle = ""
+	os.WriteFile(path, []byte("# Test\nUpdated"), 0644)
+
+	r.Route(context.Background(), "chat1", "user1", "/doc push README.md")
+	if fake.createdTitle != "" {
+		t.Fatal("bound push should not create another document")
+	}
+	if fake.replacedDocID != "new1" || fake.replacedContent != "# Test\nUpdated" {
+		t.Fatalf("replaced %q with %q", fake.replacedDocID, fake.replacedContent)
+	}
+	if msg := sender.LastMessage(); !strings.Contains(msg, "文档已更新") || !strings.Contains(msg, "https://feishu.cn/docx/new1") {
+		t.Fatalf("reply = %q", msg)
+	}
+	if r.store.DocBindings()[path] != "new1" {
+		t.Fatalf("binding changed: %v", r.store.DocBindings())
+	}
+
+	fake.replaceErr = fmt.Errorf("code=1770002 not found")
+	r.Route(context.Background(), "chat1", "user1", "/doc push README.md")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "更新文档 new1 出错") || !strings.Contains(msg, "/doc unbind") {
+		t.Fatalf("error reply = %q", msg)
+	}
+}
+
 func TestDocPush_FileNotFound(t *testing.T) {
 	fake := &fakeDocPusher{}
 	r, sender, _ := newTestRouterWithDoc(t, fake)
@@ -0,0 +1,333 @@
+package bot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// dockerBuildTimeout bounds one /docker build including the push.
+	dockerBuildTimeout = 30 * time.Minute
+	// dockerPasswordSecret names the registry password in the secrets store.
+	dockerPasswordSecret = "docker_password"
+	// dockerTailLines is how many output lines progress cards show.
+	dockerTailLines = 8
+)
+
+// Progress cards follow the same rhythm as Claude executions: nothing for
+// the first few seconds, then at most one card per interval.
+var (
+	dockerProgressDelay    = 5 * time.Second
+	dockerProgressInterval = 10 * time.Second
+)
+
+// dockerStepRe matches the step headers of BuildKit's plain progress
+// ("#6 [builder 2/4] RUN go build"), the classic builder ("Step 2/4 : RUN
+// go build") and podman ("STEP 2/4: RUN go build").
+var dockerStepRe = regexp.MustCompile(`^(?:#\d+ \[(?:[^\]]* )?(\d+)/(\d+)\]|Step (\d+)/(\d+) :|STEP (\d+)/(\d+):) *(.*)$`)
+
+// dockerDigestRe finds the manifest digest in `docker push` output.
+var dockerDigestRe = regexp.MustCompile(`digest: (sha256:[0-9a-f]{64})`)
+
+// SetDockerRegistry sets the registry /docker build pushes to and the user
+// it logs in as. The password is read from the secrets store.
+func (r *Router) SetDockerRegistry(registry, username string) {
+	r.dockerRegistry = strings.TrimSuffix(registry, "/")
+	r.dockerUsername = username
+}
+
+// containerTool returns the container CLI to use: docker, else podman.
+func containerTool() string {
+	for _, name := range []string{"docker", "podman"} {
+		if _, err := exec.LookPath(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// containerfile returns the build file in dir, if any.
+func containerfile(dir string) string {
+	for _, name := range []string{"Dockerfile", "Containerfile"} {
+		if fileExists(filepath.Join(dir, name)) {
+			return name
+		}
+	}
+	return ""
+}
+
+// dockerStep turns a step header into "步骤 2/4: RUN go build"; other
+// lines yield "".
+func dockerStep(line string) string {
+	m := dockerStepRe.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return ""
+	}
+	for i := 1; i < 7; i += 2 {
+		if m[i] != "" {
+			return fmt.Sprintf("步骤 %s/%s: %s", m[i], m[i+1], m[7])
+		}
+	}
+	return ""
+}
+
+// defaultImageTag derives "<repo>:<short commit>" from dir, falling back
+// to the "latest" tag outside git.
+func defaultImageTag(dir string) string {
+	name := strings.Map(func(c rune) rune {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '.', c == '_', c == '-':
+			return c
+		}
+		return '-'
+	}, strings.ToLower(filepath.Base(dir)))
+	name = strings.Trim(name, "-._")
+	if name == "" {
+		name = "image"
+	}
+	tag := shortHash(gitHead(dir))
+	if tag == "" {
+		tag = "latest"
+	}
+	return name + ":" + tag
+}
+
+// parseDockerArgs parses "/docker" arguments: "build [tag] [push]".
+func parseDockerArgs(args string) (tag string, push, ok bool) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 || fields[0] != "build" {
+		return "", false, false
+	}
+	for _, f := range fields[1:] {
+		switch {
+		case f == "push" || f == "--push":
+			push = true
+		case tag == "" && !strings.HasPrefix(f, "-"):
+			tag = f
+		default:
+			return "", false, false
+		}
+	}
+	return tag, push, true
+}
+
+// streamCommand runs cmd, calling onLine for every line of its stdout and
+// stderr with terminal escapes removed, and returns the combined output.
+func streamCommand(cmd *exec.Cmd, onLine func(string)) (string, error) {
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	done := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		pw.Close()
+		done <- err
+	}()
+
+	var out strings.Builder
+	sc := bufio.NewScanner(pr)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := cleanTerminal(sc.Text())
+		out.WriteString(line)
+		out.WriteByte('\n')
+		onLine(line)
+	}
+	// Drain whatever the scanner gave up on so the process can exit.
+	io.Copy(io.Discard, pr)
+	return out.String(), <-done
+}
+
+// imageInfo returns the local image ID and size of ref.
+func imageInfo(ctx context.Context, tool, ref string) (id string, size int64, err error) {
+	out, err := exec.CommandContext(ctx, tool, "image", "inspect", "--format", "{{.Id}} {{.Size}}", ref).Output()
+	if err != nil {
+		return "", 0, err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return "", 0, fmt.Errorf("unexpected inspect output %q", strings.TrimSpace(string(out)))
+	}
+	size, err = strconv.ParseInt(fields[1], 10, 64)
+	return fields[0], size, err
+}
+
+// runTool runs a container CLI subcommand and returns its combined output.
+func runTool(ctx context.Context, stdin, tool string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, tool, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	return strings.TrimSpace(out.String()), err
+}
+
+// pushImage logs in to the configured registry, tags ref under it and
+// pushes it, returning the remote reference and its digest.
+func (r *Router) pushImage(ctx context.Context, tool, ref string) (remote, digest string, err error) {
+	remote = ref
+	if !strings.HasPrefix(ref, r.dockerRegistry+"/") {
+		remote = r.dockerRegistry + "/" + ref
+	}
+	if r.dockerUsername != "" {
+		password, ok := r.secrets.Get(dockerPasswordSecret)
+		if !ok {
+			return remote, "", fmt.Errorf("缺少密钥 %s（secrets_file 或 DEVBOT_SECRET_DOCKER_PASSWORD）", dockerPasswordSecret)
+		}
+		host, _, _ := strings.Cut(r.dockerRegistry, "/")
+		if out, err := runTool(ctx, password, tool, "login", host, "-u", r.dockerUsername, "--password-stdin"); err != nil {
+			return remote, "", fmt.Errorf("登录 %s 失败: %s", host, truncateForDisplay(out, 500))
+		}
+	}
+	if remote != ref {
+		if out, err := runTool(ctx, "", tool, "tag", ref, remote); err != nil {
+			return remote, "", fmt.Errorf("打标签失败: %s", truncateForDisplay(out, 500))
+		}
+	}
+	out, err := runTool(ctx, "", tool, "push", remote)
+	if err != nil {
+		return remote, "", fmt.Errorf("推送失败: %s", truncateForDisplay(out, 1500))
+	}
+	if m := dockerDigestRe.FindStringSubmatch(out); m != nil {
+		return remote, m[1], nil
+	}
+	// podman does not print the digest; the pushed image records it.
+	if digests, err := runTool(ctx, "", tool, "image", "inspect", "--format", `{{join .RepoDigests "\n"}}`, remote); err == nil {
+		repo := remote
+		if i := strings.LastIndex(remote, ":"); i > strings.LastIndex(remote, "/") {
+			repo = remote[:i]
+		}
+		for _, d := range strings.Split(digests, "\n") {
+			if name, sum, ok := strings.Cut(strings.TrimSpace(d), "@"); ok && name == repo {
+				return remote, sum, nil
+			}
+		}
+	}
+	return remote, "", nil
+}
+
+func (r *Router) cmdDocker(ctx context.Context, chatID, args string) {
+	tag, push, ok := parseDockerArgs(args)
+	if !ok {
+		r.sender.SendText(ctx, chatID, "用法: /docker build [标签] [push]\n示例: /docker build\n示例: /docker build myapp:dev\n示例: /docker build myapp:1.2 push\n默认标签为 <目录名>:<短提交号>；push 推送到配置的 docker_registry。")
+		return
+	}
+	session := r.getSession(chatID)
+	dir := session.WorkDir
+	if dir == "" {
+		dir = r.store.WorkRoot()
+	}
+	file := containerfile(dir)
+	if file == "" {
+		r.sender.SendText(ctx, chatID, "当前目录没有 Dockerfile 或 Containerfile。")
+		return
+	}
+	tool := containerTool()
+	if tool == "" {
+		r.sender.SendText(ctx, chatID, "未找到 docker 或 podman，无法构建镜像。")
+		return
+	}
+	if push && r.dockerRegistry == "" {
+		r.sender.SendText(ctx, chatID, "未配置 docker_registry，无法推送。")
+		return
+	}
+	if tag == "" {
+		tag = defaultImageTag(dir)
+	}
+
+	buildArgs := []string{"build"}
+	if tool == "docker" {
+		buildArgs = append(buildArgs, "--progress=plain")
+	}
+	buildArgs = append(buildArgs, "-t", tag, "-f", file, ".")
+
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("开始构建镜像 %s（%s）...", tag, tool))
+	execCtx, cancel := context.WithTimeout(ctx, dockerBuildTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(execCtx, tool, buildArgs...)
+	cmd.Dir = dir
+
+	start := time.Now()
+	var lastSend time.Time
+	var step string
+	var tail []string
+	out, err := streamCommand(cmd, func(line string) {
+		if s := dockerStep(line); s != "" {
+			step = s
+		}
+		if strings.TrimSpace(line) != "" {
+			tail = append(tail, line)
+			if len(tail) > dockerTailLines {
+				tail = tail[1:]
+			}
+		}
+		now := time.Now()
+		if now.Sub(start) < dockerProgressDelay || now.Sub(lastSend) < dockerProgressInterval {
+			return
+		}
+		lastSend = now
+		content := fmt.Sprintf("**%s** · %s\n```\n%s\n```", tag, time.Since(start).Truncate(time.Second), truncateForDisplay(strings.Join(tail, "\n"), 1500))
+		if step != "" {
+			content = "**" + step + "**\n" + content
+		}
+		r.sender.SendCard(ctx, chatID, CardMsg{Content: content})
+	})
+	elapsed := time.Since(start).Truncate(time.Second)
+	if err != nil {
+		lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+		if len(lines) > 30 {
+			lines = lines[len(lines)-30:]
+		}
+		content := fmt.Sprintf("**标签:** `%s` · **耗时:** %s\n", tag, elapsed)
+		if step != "" {
+			content += fmt.Sprintf("**失败于:** %s\n", step)
+		}
+		content += fmt.Sprintf("```\n%s\n```", truncateForDisplay(strings.Join(lines, "\n"), 3000))
+		if execCtx.Err() == context.DeadlineExceeded {
+			content += fmt.Sprintf("\n超过 %s 未完成，已终止。", dockerBuildTimeout)
+		}
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "镜像构建失败", Content: content, Template: "red"})
+		return
+	}
+
+	var sb strings.Builder
+	if head := gitHead(dir); head != "" {
+		fmt.Fprintf(&sb, "**提交:** `%s`\n", shortHash(head))
+	}
+	fmt.Fprintf(&sb, "**工具:** %s · **耗时:** %s\n", tool, elapsed)
+	if id, size, err := imageInfo(execCtx, tool, tag); err == nil {
+		fmt.Fprintf(&sb, "**大小:** %s\n**镜像 ID:** `%s`\n", formatSize(size), id)
+	} else {
+		fmt.Fprintf(&sb, "读取镜像信息失败: %v\n", err)
+	}
+
+	title, tpl := "✓ 镜像构建完成: "+tag, "green"
+	if push {
+		remote, digest, err := r.pushImage(execCtx, tool, tag)
+		if err != nil {
+			title, tpl = "镜像已构建，推送失败: "+tag, "orange"
+			fmt.Fprintf(&sb, "\n%v\n", err)
+		} else {
+			fmt.Fprintf(&sb, "\n**已推送:** `%s`\n", remote)
+			if digest != "" {
+				fmt.Fprintf(&sb, "**Digest:** `%s`\n", digest)
+			}
+		}
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: strings.TrimSpace(sb.String()), Template: tpl})
+}
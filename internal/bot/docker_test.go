@@ -0,0 +1,181 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDockerStep(t *testing.T) {
+	tests := map[string]string{
+		"#6 [2/4] RUN go build ./...":          "步骤 2/4: RUN go build ./...",
+		"#7 [builder 3/5] COPY . .":            "步骤 3/5: COPY . .",
+		"Step 1/3 : FROM golang:1.22":          "步骤 1/3: FROM golang:1.22",
+		"STEP 2/2: CMD [\"/app\"]":             "步骤 2/2: CMD [\"/app\"]",
+		"#6 0.512 go: downloading example.com": "",
+		"#1 [internal] load build definition":  "",
+	}
+	for line, want := range tests {
+		if got := dockerStep(line); got != want {
+			t.Errorf("dockerStep(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
+
+func TestParseDockerArgs(t *testing.T) {
+	if tag, push, ok := parseDockerArgs("build"); !ok || tag != "" || push {
+		t.Fatalf("unexpected parse: %q %v %v", tag, push, ok)
+	}
+	if tag, push, ok := parseDockerArgs("build app:1.0 push"); !ok || tag != "app:1.0" || !push {
+		t.Fatalf("unexpected parse: %q %v %v", tag, push, ok)
+	}
+	for _, args := range []string{"", "run", "build a b", "build --no-cache"} {
+		if _, _, ok := parseDockerArgs(args); ok {
+			t.Errorf("expected %q to be rejected", args)
+		}
+	}
+}
+
+func TestDefaultImageTag(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "My_App")
+	os.MkdirAll(dir, 0755)
+	if got := defaultImageTag(dir); got != "my_app:latest" {
+		t.Fatalf("unexpected tag %q", got)
+	}
+}
+
+const fakeDigest = "sha256:4f2b1c0e9d8a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b2c"
+
+// fakeDocker puts a docker executable on PATH that logs its arguments and
+// the login password to files in the returned directory. The build fails
+// when a file named "fail" exists there.
+func fakeDocker(t *testing.T) string {
+	t.Helper()
+	bin := t.TempDir()
+	script := fmt.Sprintf(`#!/bin/sh
+echo "$@" >> %[1]s/args
+case "$1" in
+build)
+	echo "#1 [internal] load build definition from Dockerfile"
+	echo "#5 [1/2] FROM docker.io/library/alpine"
+	echo "#6 [2/2] RUN make"
+	if [ -f %[1]s/fail ]; then echo "#6 ERROR: make: *** No rule to make target"; exit 1; fi
+	;;
+image) echo "sha256:0123abcd 3145728" ;;
+login) cat > %[1]s/password ;;
+push) echo "1.0: digest: %[2]s size: 528" ;;
+esac
+`, bin, fakeDigest)
+	os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0755)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return bin
+}
+
+func newDockerRouter(t *testing.T) (*Router, *spySender, string) {
+	t.Helper()
+	r, sender := newTestRouter(t)
+	os.WriteFile(filepath.Join(r.getSession("chat1").WorkDir, "Dockerfile"), []byte("FROM alpine\nRUN make\n"), 0644)
+	return r, sender, fakeDocker(t)
+}
+
+func TestRouterDocker_Build(t *testing.T) {
+	r, sender, bin := newDockerRouter(t)
+	delay, interval := dockerProgressDelay, dockerProgressInterval
+	dockerProgressDelay, dockerProgressInterval = 0, 0
+	t.Cleanup(func() { dockerProgressDelay, dockerProgressInterval = delay, interval })
+
+	r.Route(context.Background(), "chat1", "user1", "/docker build app:dev")
+	msg := sender.LastMessage()
+	if !strings.HasPrefix(msg, "✓ 镜像构建完成: app:dev") || !strings.Contains(msg, "**大小:** 3.0 MB") || !strings.Contains(msg, "`sha256:0123abcd`") {
+		t.Fatalf("expected build card, got %q", msg)
+	}
+	progress := false
+	for _, m := range sender.messages {
+		if strings.Contains(m, "**步骤 2/2: RUN make**") {
+			progress = true
+		}
+	}
+	if !progress {
+		t.Fatalf("expected a progress card, got %v", sender.messages)
+	}
+	args, _ := os.ReadFile(filepath.Join(bin, "args"))
+	if !strings.Contains(string(args), "build --progress=plain -t app:dev -f Dockerfile .") || strings.Contains(string(args), "push") {
+		t.Fatalf("unexpected docker invocations:\n%s", args)
+	}
+}
+
+func TestRouterDocker_Push(t *testing.T) {
+	r, sender, bin := newDockerRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/docker build app:1.0 push")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "未配置 docker_registry") {
+		t.Fatalf("expected missing registry, got %q", msg)
+	}
+
+	r.SetDockerRegistry("registry.example.com/team/", "ci")
+	t.Setenv("DEVBOT_SECRET_DOCKER_PASSWORD", "")
+	r.Route(context.Background(), "chat1", "user1", "/docker build app:1.0 push")
+	if msg := sender.LastMessage(); !strings.HasPrefix(msg, "镜像已构建，推送失败") || !strings.Contains(msg, "docker_password") {
+		t.Fatalf("expected missing password, got %q", msg)
+	}
+
+	path := filepath.Join(t.TempDir(), "secrets.yaml")
+	os.WriteFile(path, []byte("docker_password: hunter2\n"), 0600)
+	secrets, err := LoadSecrets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetSecrets(secrets)
+	r.Route(context.Background(), "chat1", "user1", "/docker build app:1.0 push")
+	msg := sender.LastMessage()
+	if !strings.Contains(msg, "**已推送:** `registry.example.com/team/app:1.0`") || !strings.Contains(msg, "**Digest:** `"+fakeDigest+"`") {
+		t.Fatalf("expected push card, got %q", msg)
+	}
+	if password, _ := os.ReadFile(filepath.Join(bin, "password")); string(password) != "hunter2" {
+		t.Fatalf("expected password on stdin, got %q", password)
+	}
+	args, _ := os.ReadFile(filepath.Join(bin, "args"))
+	for _, want := range []string{"login registry.example.com -u ci --password-stdin", "tag app:1.0 registry.example.com/team/app:1.0", "push registry.example.com/team/app:1.0"} {
+		if !strings.Contains(string(args), want) {
+			t.Fatalf("expected %q in docker invocations:\n%s", want, args)
+		}
+	}
+	if strings.Contains(string(args), "hunter2") {
+		t.Fatal("password must not appear on the command line")
+	}
+}
+
+func TestRouterDocker_Failure(t *testing.T) {
+	r, sender, bin := newDockerRouter(t)
+	os.WriteFile(filepath.Join(bin, "fail"), nil, 0644)
+	r.Route(context.Background(), "chat1", "user1", "/docker build")
+	msg := sender.LastMessage()
+	if !strings.HasPrefix(msg, "镜像构建失败") || !strings.Contains(msg, "**失败于:** 步骤 2/2: RUN make") || !strings.Contains(msg, "No rule to make target") {
+		t.Fatalf("expected failure card, got %q", msg)
+	}
+	for _, m := range sender.messages {
+		if strings.Contains(m, "**步骤") {
+			t.Fatalf("expected no progress card for a short build, got %q", m)
+		}
+	}
+}
+
+func TestRouterDocker_Prerequisites(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/docker")
+	if !strings.HasPrefix(sender.LastMessage(), "用法:") {
+		t.Fatalf("expected usage, got %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/docker build")
+	if !strings.Contains(sender.LastMessage(), "没有 Dockerfile") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+	os.WriteFile(filepath.Join(r.getSession("chat1").WorkDir, "Containerfile"), []byte("FROM alpine\n"), 0644)
+	t.Setenv("PATH", t.TempDir())
+	r.Route(context.Background(), "chat1", "user1", "/docker build")
+	if !strings.Contains(sender.LastMessage(), "未找到 docker 或 podman") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+}
@@ -0,0 +1,269 @@
+package bot
+
+import (
+	"regexp"
+	"strings"
+
+	larkdocx "github.com/larksuite/oapi-sdk-go/v3/service/docx/v1"
+)
+
+// DocX block types used when converting Markdown.
+const (
+	blockTypeText     = 2
+	blockTypeHeading1 = 3 // Heading1..Heading9 are 3..11
+	blockTypeBullet   = 12
+	blockTypeOrdered  = 13
+	blockTypeCode     = 14
+	blockTypeQuote    = 15
+	blockTypeDivider  = 22
+	blockTypeImage    = 27
+)
+
+// docCodeLanguages maps fence info strings to DocX code block language IDs.
+// Unknown languages fall back to 1 (PlainText).
+var docCodeLanguages = map[string]int{
+	"bash": 7, "sh": 7, "c#": 8, "csharp": 8, "c++": 9, "cpp": 9, "c": 10,
+	"css": 12, "scss": 55, "dockerfile": 18, "go": 22, "golang": 22, "html": 24,
+	"http": 26, "json": 28, "java": 29, "javascript": 30, "js": 30, "jsx": 30,
+	"kotlin": 32, "lua": 36, "makefile": 38, "markdown": 39, "md": 39,
+	"nginx": 40, "php": 43, "perl": 44, "powershell": 46, "protobuf": 48,
+	"proto": 48, "python": 49, "py": 49, "ruby": 52, "rust": 53, "sql": 56,
+	"scala": 57, "shell": 60, "swift": 61, "typescript": 63, "ts": 63, "tsx": 63,
+	"xml": 66, "yaml": 67, "yml": 67,
+}
+
+var (
+	mdHeadingRe = regexp.MustCompile(`^(#{1,9})\s+(.*?)\s*#*\s*$`)
+	mdBulletRe  = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	mdOrderedRe = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	mdDividerRe = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	mdImageRe   = regexp.MustCompile(`^!\[[^\]]*\]\(\s*<?([^)\s>]+)>?(?:\s+"[^"]*")?\s*\)$`)
+)
+
+// buildMarkdownBlocks converts Markdown content into DocX blocks: headings,
+// fenced code, bullet and numbered list items, quotes and dividers each get
+// their own block type, everything else becomes a text paragraph. Inline
+// **bold**, *italic* and `code` spans are carried over as text styles.
+//
+// An image on a line of its own becomes an empty image block if
+// localImage (which may be nil) maps its source to a local file; images
+// maps those blocks' indexes to the files, to be uploaded once the blocks
+// exist. Other images stay as text.
+func buildMarkdownBlocks(content string, localImage func(src string) string) (blocks []*larkdocx.Block, images map[int]string) {
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r")
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence := trimmed[:3]
+			lang := strings.ToLower(strings.TrimSpace(trimmed[3:]))
+			var code []string
+			for i++; i < len(lines); i++ {
+				l := strings.TrimRight(lines[i], "\r")
+				if strings.HasPrefix(strings.TrimSpace(l), fence) {
+					break
+				}
+				code = append(code, l)
+			}
+			blocks = append(blocks, codeBlock(strings.Join(code, "\n"), lang))
+			continue
+		}
+
+		if m := mdHeadingRe.FindStringSubmatch(trimmed); m != nil {
+			blocks = append(blocks, headingBlock(len(m[1]), m[2]))
+			continue
+		}
+		if m := mdImageRe.FindStringSubmatch(trimmed); m != nil && localImage != nil {
+			if path := localImage(m[1]); path != "" {
+				if images == nil {
+					images = make(map[int]string)
+				}
+				images[len(blocks)] = path
+				blocks = append(blocks, larkdocx.NewBlockBuilder().
+					BlockType(blockTypeImage).
+					Image(larkdocx.NewImageBuilder().Build()).
+					Build())
+				continue
+			}
+		}
+		if mdDividerRe.MatchString(trimmed) {
+			blocks = append(blocks, larkdocx.NewBlockBuilder().
+				BlockType(blockTypeDivider).
+				Divider(larkdocx.NewDividerBuilder().Build()).
+				Build())
+			continue
+		}
+		if m := mdBulletRe.FindStringSubmatch(line); m != nil {
+			blocks = append(blocks, larkdocx.NewBlockBuilder().
+				BlockType(blockTypeBullet).
+				Bullet(inlineText(m[1])).
+				Build())
+			continue
+		}
+		if m := mdOrderedRe.FindStringSubmatch(line); m != nil {
+			blocks = append(blocks, larkdocx.NewBlockBuilder().
+				BlockType(blockTypeOrdered).
+				Ordered(inlineText(m[1])).
+				Build())
+			continue
+		}
+		if strings.HasPrefix(trimmed, ">") {
+			// Consecutive quoted lines form one quote block.
+			quoted := []string{strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))}
+			for i+1 < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i+1]), ">") {
+				i++
+				quoted = append(quoted, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")))
+			}
+			blocks = append(blocks, larkdocx.NewBlockBuilder().
+				BlockType(blockTypeQuote).
+				Quote(inlineText(strings.Join(quoted, "\n"))).
+				Build())
+			continue
+		}
+
+		blocks = append(blocks, larkdocx.NewBlockBuilder().
+			BlockType(blockTypeText).
+			Text(inlineText(line)).
+			Build())
+	}
+	return blocks, images
+}
+
+// headingBlock builds a heading block of the given level (1-9).
+func headingBlock(level int, text string) *larkdocx.Block {
+	b := larkdocx.NewBlockBuilder().BlockType(blockTypeHeading1 + level - 1)
+	t := inlineText(text)
+	switch level {
+	case 1:
+		b.Heading1(t)
+	case 2:
+		b.Heading2(t)
+	case 3:
+		b.Heading3(t)
+	case 4:
+		b.Heading4(t)
+	case 5:
+		b.Heading5(t)
+	case 6:
+		b.Heading6(t)
+	case 7:
+		b.Heading7(t)
+	case 8:
+		b.Heading8(t)
+	default:
+		b.Heading9(t)
+	}
+	return b.Build()
+}
+
+// codeBlock builds a code block; the whole fence body goes into one run.
+func codeBlock(code, lang string) *larkdocx.Block {
+	if code == "" {
+		code = " "
+	}
+	langID, ok := docCodeLanguages[lang]
+	if !ok {
+		langID = 1
+	}
+	return larkdocx.NewBlockBuilder().
+		BlockType(blockTypeCode).
+		Code(larkdocx.NewTextBuilder().
+			Style(larkdocx.NewTextStyleBuilder().Language(langID).Wrap(true).Build()).
+			Elements([]*larkdocx.TextElement{textRun(code, nil)}).
+			Build()).
+		Build()
+}
+
+// inlineText splits s into styled text runs. An empty s yields a single
+// space, since the Feishu API rejects empty TextRun content (error 99992402
+// "field validation failed").
+func inlineText(s string) *larkdocx.Text {
+	runs := parseInline(s)
+	if len(runs) == 0 {
+		runs = []inlineRun{{text: " "}}
+	}
+	elements := make([]*larkdocx.TextElement, 0, len(runs))
+	for _, r := range runs {
+		var style *larkdocx.TextElementStyle
+		if r.bold || r.italic || r.code {
+			style = larkdocx.NewTextElementStyleBuilder().
+				Bold(r.bold).
+				Italic(r.italic).
+				InlineCode(r.code).
+				Build()
+		}
+		elements = append(elements, textRun(r.text, style))
+	}
+	return larkdocx.NewTextBuilder().Elements(elements).Build()
+}
+
+func textRun(content string, style *larkdocx.TextElementStyle) *larkdocx.TextElement {
+	run := larkdocx.NewTextRunBuilder().Content(content)
+	if style != nil {
+		run = run.TextElementStyle(style)
+	}
+	return larkdocx.NewTextElementBuilder().TextRun(run.Build()).Build()
+}
+
+// inlineRun is a span of text sharing the same inline style.
+type inlineRun struct {
+	text               string
+	bold, italic, code bool
+}
+
+// parseInline splits s on **bold**, __bold__, *italic*, _italic_ and
+// `code` markers. Unterminated markers are kept as literal text.
+func parseInline(s string) []inlineRun {
+	var runs []inlineRun
+	var plain strings.Builder
+	flush := func() {
+		if plain.Len() > 0 {
+			runs = append(runs, inlineRun{text: plain.String()})
+			plain.Reset()
+		}
+	}
+	for i := 0; i < len(s); {
+		var marker string
+		switch {
+		case s[i] == '`':
+			marker = "`"
+		case strings.HasPrefix(s[i:], "**"), strings.HasPrefix(s[i:], "__"):
+			marker = s[i : i+2]
+		case s[i] == '*', s[i] == '_' && (i == 0 || !isWordByte(s[i-1])):
+			marker = s[i : i+1]
+		}
+		if marker != "" {
+			rest := s[i+len(marker):]
+			// Emphasis must hug its text: "2 * 3 * 4" stays literal.
+			if end := strings.Index(rest, marker); end > 0 && (marker == "`" || rest[0] != ' ') {
+				flush()
+				inner := rest[:end]
+				switch marker {
+				case "`":
+					runs = append(runs, inlineRun{text: inner, code: true})
+				case "**", "__":
+					for _, r := range parseInline(inner) {
+						r.bold = true
+						runs = append(runs, r)
+					}
+				default:
+					for _, r := range parseInline(inner) {
+						r.italic = true
+						runs = append(runs, r)
+					}
+				}
+				i += len(marker) + end + len(marker)
+				continue
+			}
+		}
+		plain.WriteByte(s[i])
+		i++
+	}
+	flush()
+	return runs
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
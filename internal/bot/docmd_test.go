@@ -0,0 +1,103 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildMarkdownBlocks_Types(t *testing.T) {
+	md := "# Title\n## Sub\nplain\n- a\n* b\n1. one\n2) two\n> quoted\n> more\n---\n```go\nfunc main() {}\n```\n"
+	blocks, _ := buildMarkdownBlocks(md, nil)
+	want := []int{3, 4, 2, 12, 12, 13, 13, 15, 22, 14, 2}
+	if len(blocks) != len(want) {
+		t.Fatalf("got %d blocks, want %d", len(blocks), len(want))
+	}
+	for i, b := range blocks {
+		if *b.BlockType != want[i] {
+			t.Errorf("block %d: type %d, want %d", i, *b.BlockType, want[i])
+		}
+	}
+	if got := *blocks[0].Heading1.Elements[0].TextRun.Content; got != "Title" {
+		t.Errorf("heading content = %q", got)
+	}
+	if got := *blocks[7].Quote.Elements[0].TextRun.Content; got != "quoted\nmore" {
+		t.Errorf("quote content = %q", got)
+	}
+	code := blocks[9].Code
+	if *code.Style.Language != 22 {
+		t.Errorf("code language = %d, want 22 (Go)", *code.Style.Language)
+	}
+	if got := *code.Elements[0].TextRun.Content; got != "func main() {}" {
+		t.Errorf("code content = %q", got)
+	}
+}
+
+func TestBuildMarkdownBlocks_EmptyLineIsSpace(t *testing.T) {
+	blocks, _ := buildMarkdownBlocks("a\n\nb", nil)
+	if len(blocks) != 3 {
+		t.Fatalf("got %d blocks, want 3", len(blocks))
+	}
+	if got := *blocks[1].Text.Elements[0].TextRun.Content; got != " " {
+		t.Fatalf("empty line content = %q, want single space", got)
+	}
+}
+
+func TestBuildMarkdownBlocks_UnterminatedFence(t *testing.T) {
+	blocks, _ := buildMarkdownBlocks("```\nx := 1\ny := 2", nil)
+	if len(blocks) != 1 || *blocks[0].BlockType != 14 {
+		t.Fatalf("expected a single code block, got %d blocks", len(blocks))
+	}
+	if got := *blocks[0].Code.Elements[0].TextRun.Content; got != "x := 1\ny := 2" {
+		t.Fatalf("code content = %q", got)
+	}
+	if *blocks[0].Code.Style.Language != 1 {
+		t.Fatalf("expected PlainText language, got %d", *blocks[0].Code.Style.Language)
+	}
+}
+
+func TestBuildMarkdownBlocks_LocalImages(t *testing.T) {
+	local := func(src string) string {
+		if src == "img/arch.png" {
+			return "/repo/docs/img/arch.png"
+		}
+		return ""
+	}
+	blocks, images := buildMarkdownBlocks("intro\n![arch](img/arch.png)\n![logo](https://x.com/logo.png)", local)
+	if len(blocks) != 3 || *blocks[1].BlockType != blockTypeImage || *blocks[2].BlockType != blockTypeText {
+		t.Fatalf("unexpected blocks: %d", len(blocks))
+	}
+	if len(images) != 1 || images[1] != "/repo/docs/img/arch.png" {
+		t.Fatalf("images = %v", images)
+	}
+	if _, images := buildMarkdownBlocks("![arch](img/arch.png)", nil); images != nil {
+		t.Fatalf("images without resolver = %v", images)
+	}
+}
+
+func TestParseInline(t *testing.T) {
+	runs := parseInline("a **bold** and *it* or `x*y` 2 * 3 * 4 snake_case_name")
+	var sb strings.Builder
+	for _, r := range runs {
+		switch {
+		case r.code:
+			sb.WriteString("[c:" + r.text + "]")
+		case r.bold:
+			sb.WriteString("[b:" + r.text + "]")
+		case r.italic:
+			sb.WriteString("[i:" + r.text + "]")
+		default:
+			sb.WriteString(r.text)
+		}
+	}
+	want := "a [b:bold] and [i:it] or [c:x*y] 2 * 3 * 4 snake_case_name"
+	if sb.String() != want {
+		t.Fatalf("parseInline = %q, want %q", sb.String(), want)
+	}
+}
+
+func TestParseInline_Nested(t *testing.T) {
+	runs := parseInline("**bold *both* end**")
+	if len(runs) != 3 || !runs[0].bold || runs[0].italic || !runs[1].bold || !runs[1].italic || runs[1].text != "both" || !runs[2].bold {
+		t.Fatalf("unexpected runs: %+v", runs)
+	}
+}
@@ -0,0 +1,295 @@
+package bot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxDocConflictLines is how many differing lines a /doc sync conflict
+// card previews.
+const maxDocConflictLines = 30
+
+// maxDocDirFiles is how many files one directory /doc push may push.
+const maxDocDirFiles = 100
+
+// docHash fingerprints file or document content for sync bookkeeping.
+func docHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// docPushContent is what gets pushed for the file at path: Markdown as is,
+// source files as one code block rather than being read as Markdown.
+func docPushContent(path string, data []byte) string {
+	content := string(data)
+	if lang := langForPath(path); lang != "" && lang != "markdown" {
+		content = "```" + lang + "\n" + strings.TrimRight(content, "\n") + "\n```"
+	}
+	return content
+}
+
+// pushDocFile pushes data, the content of filePath, to the document bound
+// to it, updating it in place, or to a new document titled title (created
+// in folder, if set) that filePath is then bound to. updated reports
+// whether an existing document was (or was being) updated. The sync is
+// logged and its state recorded.
+func (r *Router) pushDocFile(ctx context.Context, chatID, filePath, title, folder string, data []byte) (docID, docURL string, updated bool, err error) {
+	content := docPushContent(filePath, data)
+	ctx = withDocImageDir(ctx, filepath.Dir(filePath), r.store.WorkRoot())
+	docID = r.store.DocBindings()[filePath]
+	if dr, ok := r.docSyncer.(docReplacer); ok && docID != "" {
+		updated = true
+		docURL, err = dr.ReplaceDocContent(ctx, docID, content)
+	} else if fp, ok := r.docSyncer.(folderDocPusher); ok && folder != "" {
+		docID, docURL, err = fp.CreateDocInFolder(ctx, folder, title, content)
+	} else {
+		docID, docURL, err = r.docSyncer.CreateAndPushDoc(ctx, title, content)
+	}
+	if err != nil {
+		return docID, docURL, updated, err
+	}
+
+	r.store.SetDocBinding(filePath, docID)
+	r.store.AddDocSync(DocSync{ChatID: chatID, Path: filePath, DocID: docID, Direction: "push", At: time.Now()})
+	// The document's text differs from the Markdown pushed, so the
+	// remote side of the sync state is what reading it back returns.
+	remoteHash := ""
+	if remote, err := r.docSyncer.PullDocContent(ctx, docID); err == nil {
+		remoteHash = docHash(remote)
+	} else {
+		slog.WarnContext(ctx, "router: read back after push failed", "doc", docID, "err", err)
+	}
+	r.recordDocSyncState(filePath, docHash(string(data)), remoteHash)
+	r.save()
+	return docID, docURL, updated, nil
+}
+
+// markdownFilesUnder returns the Markdown files under dir, sorted, skipping
+// hidden and dependency directories.
+func markdownFilesUnder(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if p != dir && (strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := strings.ToLower(filepath.Ext(name)); ext == ".md" || ext == ".markdown" {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// pushDocDir pushes every Markdown file under dir as its own document,
+// titled with its path from dir's parent (so "docs/guide/setup.md"), and
+// reports what was created, updated and failed in one card.
+func (r *Router) pushDocDir(ctx context.Context, chatID, dir, folder string) {
+	files, err := markdownFilesUnder(dir)
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("读取目录出错: %v", err))
+		return
+	}
+	if len(files) == 0 {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("%s 下没有 Markdown 文件。", dir))
+		return
+	}
+	if len(files) > maxDocDirFiles {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("%s 下有 %d 个 Markdown 文件，超过单次推送上限 %d，请推送更小的子目录。", dir, len(files), maxDocDirFiles))
+		return
+	}
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("⏳ 正在推送 %d 个文档...", len(files)))
+
+	var created, updated, failed []string
+	base := filepath.Dir(dir)
+	for _, p := range files {
+		rel, _ := filepath.Rel(base, p)
+		title := filepath.ToSlash(rel)
+		data, err := os.ReadFile(p)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("- %s: %v", title, err))
+			continue
+		}
+		_, docURL, isUpdate, err := r.pushDocFile(ctx, chatID, p, title, folder, data)
+		switch {
+		case err != nil:
+			failed = append(failed, fmt.Sprintf("- %s: %v", title, err))
+		case isUpdate:
+			updated = append(updated, fmt.Sprintf("- [%s](%s)", title, docURL))
+		default:
+			created = append(created, fmt.Sprintf("- [%s](%s)", title, docURL))
+		}
+	}
+
+	var sb strings.Builder
+	for _, group := range []struct {
+		label string
+		lines []string
+	}{{"新建", created}, {"更新", updated}, {"失败", failed}} {
+		if len(group.lines) > 0 {
+			fmt.Fprintf(&sb, "**%s（%d）:**\n%s\n\n", group.label, len(group.lines), strings.Join(group.lines, "\n"))
+		}
+	}
+	tmpl := "green"
+	if len(failed) > 0 {
+		tmpl = "orange"
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{
+		Title:    fmt.Sprintf("📚 目录已推送: 新建 %d，更新 %d，失败 %d", len(created), len(updated), len(failed)),
+		Content:  strings.TrimSpace(sb.String()),
+		Template: tmpl,
+	})
+}
+
+// pullDocFile writes content, pulled from docID, to filePath, logging the
+// sync and recording its state.
+func (r *Router) pullDocFile(chatID, filePath, docID, content string) error {
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		return err
+	}
+	r.store.AddDocSync(DocSync{ChatID: chatID, Path: filePath, DocID: docID, Direction: "pull", At: time.Now()})
+	hash := docHash(content)
+	r.recordDocSyncState(filePath, hash, hash)
+	r.save()
+	return nil
+}
+
+func (r *Router) recordDocSyncState(filePath, localHash, remoteHash string) {
+	st := DocSyncState{LocalHash: localHash, RemoteHash: remoteHash, SyncedAt: time.Now()}
+	if info, err := os.Stat(filePath); err == nil {
+		st.LocalModTime = info.ModTime()
+	}
+	r.store.SetDocSyncState(filePath, st)
+}
+
+// cmdDocSync brings a bound file and its document in step: whichever side
+// changed since the last sync is copied to the other; when both did, or
+// there is no record of a last sync and they differ, nothing is copied
+// and a conflict card with a preview diff is sent instead.
+func (r *Router) cmdDocSync(ctx context.Context, chatID, args string) {
+	if r.docSyncer == nil {
+		r.sender.SendText(ctx, chatID, "飞书文档同步未配置，请联系管理员检查 API 配置。")
+		return
+	}
+	if args == "" {
+		r.sender.SendText(ctx, chatID, "用法: /doc sync <文件路径>\n比较本地文件和绑定的飞书文档自上次同步以来的变化：只有一边改动时自动推送或拉取，两边都改动时报告冲突。")
+		return
+	}
+
+	session := r.getSession(chatID)
+	filePath, docID := r.findDocBinding(session.WorkDir, args)
+	if docID == "" {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("未找到 %s 的绑定关系，请先用 /doc bind 绑定或 /doc push 推送。", args))
+		return
+	}
+	root := r.store.WorkRoot()
+	if !underRoot(root, filePath) {
+		r.sender.SendText(ctx, chatID, "不允许访问工作根目录以外的文件: "+root)
+		return
+	}
+
+	remote, err := r.docSyncer.PullDocContent(ctx, docID)
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("拉取文档出错: %v", err))
+		return
+	}
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		if err := r.pullDocFile(chatID, filePath, docID, remote); err != nil {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("写入文件出错: %v", err))
+			return
+		}
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("⬇ 本地文件不存在，已从文档拉取到: %s", args))
+		return
+	}
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("读取文件出错: %v", err))
+		return
+	}
+	local := string(data)
+
+	st, known := r.store.DocSyncState(filePath)
+	localHash, remoteHash := docHash(local), docHash(remote)
+	// remoteUnknown: the document could not be read back after the last
+	// push, so whether it changed since cannot be told.
+	remoteUnknown := known && st.RemoteHash == ""
+	localChanged := !known || localHash != st.LocalHash
+	remoteChanged := !known || remoteUnknown || remoteHash != st.RemoteHash
+	if (!known || remoteUnknown) && strings.TrimSpace(local) == strings.TrimSpace(remote) {
+		r.recordDocSyncState(filePath, localHash, remoteHash)
+		r.save()
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ %s 与文档内容一致，已记录同步状态。", args))
+		return
+	}
+
+	switch {
+	case !localChanged && !remoteChanged:
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ %s 已是最新（上次同步 %s）。", args, st.SyncedAt.Format("01-02 15:04")))
+	case localChanged && !remoteChanged:
+		_, docURL, _, err := r.pushDocFile(ctx, chatID, filePath, filepath.Base(filePath), "", data)
+		if err != nil {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("推送文档出错: %v", err))
+			return
+		}
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "⬆ 已推送本地改动", Content: fmt.Sprintf("**文件:** %s\n**链接:** [%s](%s)", args, docURL, docURL)})
+	case !localChanged && remoteChanged && !remoteUnknown:
+		if err := r.pullDocFile(chatID, filePath, docID, remote); err != nil {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("写入文件出错: %v", err))
+			return
+		}
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("⬇ 已拉取文档改动到: %s", args))
+	default:
+		r.sender.SendCard(ctx, chatID, CardMsg{
+			Title:    "⚠️ 同步冲突: " + args,
+			Content:  docConflictSummary(local, remote, st, known),
+			Template: "orange",
+			Buttons: []CardButton{
+				{Text: "以本地为准（推送）", Command: "/doc push " + args, Type: "primary"},
+				{Text: "以文档为准（拉取）", Command: "/doc pull " + args, Type: "danger"},
+			},
+		})
+	}
+}
+
+// docConflictSummary explains a /doc sync conflict and previews how the
+// local file differs from the document's text.
+func docConflictSummary(local, remote string, st DocSyncState, known bool) string {
+	var sb strings.Builder
+	switch {
+	case known && st.RemoteHash == "":
+		fmt.Fprintf(&sb, "上次同步（%s）推送后没能读回飞书文档，无法判断文档此后是否被改动，且本地文件与文档内容不同。\n", st.SyncedAt.Format("01-02 15:04"))
+	case known:
+		fmt.Fprintf(&sb, "自上次同步（%s）以来，本地文件和飞书文档都有改动。\n", st.SyncedAt.Format("01-02 15:04"))
+	default:
+		sb.WriteString("没有上次同步的记录，且本地文件与飞书文档内容不同，无法判断哪一边更新。\n")
+	}
+	remote, local = strings.TrimSpace(remote), strings.TrimSpace(local)
+	if strings.Count(remote, "\n") >= maxRetryDiffLines || strings.Count(local, "\n") >= maxRetryDiffLines {
+		fmt.Fprintf(&sb, "\n文档 %d 字，本地 %d 字，内容过长，不逐行预览。", len([]rune(remote)), len([]rune(local)))
+	} else {
+		diff := lineDiff(remote, local)
+		shown := diff
+		if len(shown) > maxDocConflictLines {
+			shown = shown[:maxDocConflictLines]
+		}
+		sb.WriteString("\n预览（- 文档，+ 本地；文档为纯文本，Markdown 标记也会显示为差异）:\n```diff\n" + strings.Join(shown, "\n") + "\n```")
+		if len(diff) > len(shown) {
+			fmt.Fprintf(&sb, "\n（另有 %d 行差异未显示）", len(diff)-len(shown))
+		}
+	}
+	sb.WriteString("\n\n选择保留哪一边，另一边的改动将被覆盖。")
+	return sb.String()
+}
@@ -0,0 +1,157 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDocSync(t *testing.T) {
+	fake := &fakeDocReplacer{fakeDocPusher: fakeDocPusher{returnDocID: "doc1", returnDocURL: "https://feishu.cn/docx/doc1", pullContent: "Test\nHello World"}}
+	r, sender, dir := newTestRouterWithDoc(t, fake)
+	ctx := context.Background()
+	path := filepath.Join(dir, "README.md")
+
+	r.Route(ctx, "chat1", "user1", "/doc push README.md")
+	r.Route(ctx, "chat1", "user1", "/doc sync README.md")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "已是最新") {
+		t.Fatalf("unchanged sync = %q", msg)
+	}
+
+	// Only the local file changed: pushed in place.
+	os.WriteFile(path, []byte("# Test\nHello again"), 0644)
+	r.Route(ctx, "chat1", "user1", "/doc sync README.md")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "已推送本地改动") || fake.replacedContent != "# Test\nHello again" {
+		t.Fatalf("local change sync = %q (replaced %q)", msg, fake.replacedContent)
+	}
+
+	// Only the document changed: pulled.
+	fake.pullContent = "Test\nEdited in Feishu"
+	r.Route(ctx, "chat1", "user1", "/doc sync README.md")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "已拉取文档改动") {
+		t.Fatalf("remote change sync = %q", msg)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "Test\nEdited in Feishu" {
+		t.Fatalf("file after pull = %q", data)
+	}
+
+	// Both changed: conflict, nothing copied.
+	os.WriteFile(path, []byte("local edit"), 0644)
+	fake.pullContent = "remote edit"
+	fake.replacedContent = ""
+	r.Route(ctx, "chat1", "user1", "/doc sync README.md")
+	msg := sender.LastMessage()
+	for _, want := range []string{"同步冲突", "都有改动", "- remote edit\n+ local edit"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("conflict card missing %q: %q", want, msg)
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != "local edit" || fake.replacedContent != "" {
+		t.Fatalf("conflict should not copy either side (file %q, replaced %q)", data, fake.replacedContent)
+	}
+}
+
+func TestDocSync_NoSyncState(t *testing.T) {
+	fake := &fakeDocReplacer{fakeDocPusher: fakeDocPusher{pullContent: "# Test\nHello World"}}
+	r, sender, _ := newTestRouterWithDoc(t, fake)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "/doc bind README.md doc9")
+	r.Route(ctx, "chat1", "user1", "/doc sync README.md")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "与文档内容一致") {
+		t.Fatalf("identical sync = %q", msg)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/doc bind README.md doc10")
+	fake.pullContent = "something else"
+	r.Route(ctx, "chat1", "user1", "/doc sync README.md")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "没有上次同步的记录") {
+		t.Fatalf("rebound sync = %q", msg)
+	}
+}
+
+func TestDocSync_UnknownRemoteIsConflict(t *testing.T) {
+	fake := &fakeDocReplacer{fakeDocPusher: fakeDocPusher{returnDocID: "doc1", returnDocURL: "https://feishu.cn/docx/doc1", pullErr: fmt.Errorf("network timeout")}}
+	r, sender, dir := newTestRouterWithDoc(t, fake)
+	ctx := context.Background()
+	path := filepath.Join(dir, "README.md")
+
+	// The read-back after the push fails, so the remote hash is unknown.
+	r.Route(ctx, "chat1", "user1", "/doc push README.md")
+	fake.pullErr = nil
+	fake.pullContent = "edited in Feishu"
+	os.WriteFile(path, []byte("# Test\nlocal edit"), 0644)
+	fake.replacedContent = ""
+	r.Route(ctx, "chat1", "user1", "/doc sync README.md")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "同步冲突") || !strings.Contains(msg, "没能读回") {
+		t.Fatalf("expected a conflict, got %q", msg)
+	}
+	if fake.replacedContent != "" {
+		t.Fatalf("the remote edit was overwritten with %q", fake.replacedContent)
+	}
+}
+
+func TestDocSync_NotBound(t *testing.T) {
+	r, sender, _ := newTestRouterWithDoc(t, &fakeDocPusher{})
+	r.Route(context.Background(), "chat1", "user1", "/doc sync README.md")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "未找到") {
+		t.Fatalf("reply = %q", msg)
+	}
+}
+
+// fakeDirDocPusher hands out a new document ID for each document created.
+type fakeDirDocPusher struct {
+	fakeDocReplacer
+	titles  []string
+	folders []string
+}
+
+func (f *fakeDirDocPusher) CreateAndPushDoc(ctx context.Context, title, content string) (string, string, error) {
+	return f.CreateDocInFolder(ctx, "", title, content)
+}
+
+func (f *fakeDirDocPusher) CreateDocInFolder(_ context.Context, folder, title, _ string) (string, string, error) {
+	f.titles = append(f.titles, title)
+	f.folders = append(f.folders, folder)
+	id := fmt.Sprintf("doc%d", len(f.titles))
+	return id, "https://feishu.cn/docx/" + id, nil
+}
+
+func TestDocPushDirectory(t *testing.T) {
+	fake := &fakeDirDocPusher{}
+	r, sender, dir := newTestRouterWithDoc(t, fake)
+	ctx := context.Background()
+	docs := filepath.Join(dir, "docs")
+	os.MkdirAll(filepath.Join(docs, "guide"), 0755)
+	os.MkdirAll(filepath.Join(docs, ".hidden"), 0755)
+	os.WriteFile(filepath.Join(docs, "index.md"), []byte("# Index"), 0644)
+	os.WriteFile(filepath.Join(docs, "guide", "setup.md"), []byte("# Setup"), 0644)
+	os.WriteFile(filepath.Join(docs, ".hidden", "skip.md"), []byte("# Skip"), 0644)
+	os.WriteFile(filepath.Join(docs, "notes.txt"), []byte("not markdown"), 0644)
+
+	r.Route(ctx, "chat1", "user1", "/doc push --folder fld1 docs/")
+	if got := strings.Join(fake.titles, ","); got != "docs/guide/setup.md,docs/index.md" {
+		t.Fatalf("created titles = %q", got)
+	}
+	if fake.folders[0] != "fld1" {
+		t.Errorf("folder = %q, want fld1", fake.folders[0])
+	}
+	msg := sender.LastMessage()
+	if !strings.Contains(msg, "新建 2，更新 0，失败 0") || !strings.Contains(msg, "[docs/index.md](https://feishu.cn/docx/doc2)") {
+		t.Fatalf("summary card = %q", msg)
+	}
+	bindings := r.store.DocBindings()
+	if bindings[filepath.Join(docs, "index.md")] != "doc2" || bindings[filepath.Join(docs, "guide", "setup.md")] != "doc1" {
+		t.Fatalf("bindings = %v", bindings)
+	}
+
+	// Pushing again updates the bound documents in place.
+	os.WriteFile(filepath.Join(docs, "new.md"), []byte("# New"), 0644)
+	r.Route(ctx, "chat1", "user1", "/doc push docs")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "新建 1，更新 2，失败 0") {
+		t.Fatalf("second summary card = %q", msg)
+	}
+}
@@ -0,0 +1,206 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	larkcore "github.com/larksuite/oapi-sdk-go/v3/core"
+	larkdrive "github.com/larksuite/oapi-sdk-go/v3/service/drive/v1"
+)
+
+const (
+	// maxDriveUploadAll is the largest file Drive accepts in one request;
+	// larger ones are uploaded in parts.
+	maxDriveUploadAll = 20 << 20
+	// maxDriveFileSize bounds what the bot uploads to Drive.
+	maxDriveFileSize = 512 << 20
+)
+
+// SetDriveFolder sets the Drive folder files too large for the chat are
+// uploaded to; "" uses the app's root folder.
+func (s *LarkSender) SetDriveFolder(token string) {
+	s.driveFolder = token
+}
+
+// UploadToDrive uploads data to Drive, lets the members of chatID view it
+// and returns its link.
+func (s *LarkSender) UploadToDrive(ctx context.Context, chatID, fileName string, data []byte) (string, error) {
+	folder := s.driveFolder
+	if folder == "" {
+		var err error
+		if folder, err = s.rootFolder(ctx); err != nil {
+			return "", err
+		}
+	}
+	var token string
+	var err error
+	if len(data) <= maxDriveUploadAll {
+		token, err = s.uploadAll(ctx, folder, fileName, data)
+	} else {
+		token, err = s.uploadParts(ctx, folder, fileName, data)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "sender: drive upload failed", "chat_id", chatID, "file", fileName, "err", err)
+		return "", err
+	}
+
+	req := larkdrive.NewCreatePermissionMemberReqBuilder().
+		Token(token).
+		Type("file").
+		NeedNotification(false).
+		BaseMember(larkdrive.NewBaseMemberBuilder().
+			MemberType("openchat").
+			MemberId(chatID).
+			Perm("view").
+			Build()).
+		Build()
+	resp, err := s.client.Drive.PermissionMember.Create(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("share drive file: %w", err)
+	}
+	if !resp.Success() {
+		return "", fmt.Errorf("share drive file failed: code=%d msg=%s", resp.Code, resp.Msg)
+	}
+	return "https://feishu.cn/file/" + token, nil
+}
+
+// rootFolder returns the token of the app's Drive root folder.
+func (s *LarkSender) rootFolder(ctx context.Context) (string, error) {
+	resp, err := s.client.Get(ctx, "https://open.feishu.cn/open-apis/drive/explorer/v2/root_folder/meta", nil, larkcore.AccessTokenTypeTenant)
+	if err != nil {
+		return "", fmt.Errorf("drive root folder: %w", err)
+	}
+	var body struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(resp.RawBody, &body); err != nil {
+		return "", fmt.Errorf("drive root folder: %w", err)
+	}
+	if body.Code != 0 || body.Data.Token == "" {
+		return "", fmt.Errorf("drive root folder failed: code=%d msg=%s", body.Code, body.Msg)
+	}
+	return body.Data.Token, nil
+}
+
+func (s *LarkSender) uploadAll(ctx context.Context, folder, fileName string, data []byte) (string, error) {
+	req := larkdrive.NewUploadAllFileReqBuilder().
+		Body(larkdrive.NewUploadAllFileReqBodyBuilder().
+			FileName(fileName).
+			ParentType("explorer").
+			ParentNode(folder).
+			Size(len(data)).
+			File(bytes.NewReader(data)).
+			Build()).
+		Build()
+	resp, err := s.client.Drive.File.UploadAll(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("lark API error: %w", err)
+	}
+	if !resp.Success() || resp.Data == nil || resp.Data.FileToken == nil {
+		return "", fmt.Errorf("lark API failed: code=%d msg=%s", resp.Code, resp.Msg)
+	}
+	return *resp.Data.FileToken, nil
+}
+
+// uploadParts uploads data in the parts Drive asks for.
+func (s *LarkSender) uploadParts(ctx context.Context, folder, fileName string, data []byte) (string, error) {
+	prep, err := s.client.Drive.File.UploadPrepare(ctx, larkdrive.NewUploadPrepareFileReqBuilder().
+		FileUploadInfo(larkdrive.NewFileUploadInfoBuilder().
+			FileName(fileName).
+			ParentType("explorer").
+			ParentNode(folder).
+			Size(len(data)).
+			Build()).
+		Build())
+	if err != nil {
+		return "", fmt.Errorf("lark API error: %w", err)
+	}
+	if !prep.Success() || prep.Data == nil || prep.Data.UploadId == nil || prep.Data.BlockSize == nil || prep.Data.BlockNum == nil || *prep.Data.BlockSize <= 0 {
+		return "", fmt.Errorf("lark API failed: code=%d msg=%s", prep.Code, prep.Msg)
+	}
+	uploadID, blockSize, blockNum := *prep.Data.UploadId, *prep.Data.BlockSize, *prep.Data.BlockNum
+	for seq := 0; seq < blockNum; seq++ {
+		start := seq * blockSize
+		end := start + blockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		part, err := s.client.Drive.File.UploadPart(ctx, larkdrive.NewUploadPartFileReqBuilder().
+			Body(larkdrive.NewUploadPartFileReqBodyBuilder().
+				UploadId(uploadID).
+				Seq(seq).
+				Size(end-start).
+				File(bytes.NewReader(data[start:end])).
+				Build()).
+			Build())
+		if err != nil {
+			return "", fmt.Errorf("lark API error: %w", err)
+		}
+		if !part.Success() {
+			return "", fmt.Errorf("lark API failed: part %d code=%d msg=%s", seq, part.Code, part.Msg)
+		}
+	}
+	fin, err := s.client.Drive.File.UploadFinish(ctx, larkdrive.NewUploadFinishFileReqBuilder().
+		Body(larkdrive.NewUploadFinishFileReqBodyBuilder().
+			UploadId(uploadID).
+			BlockNum(blockNum).
+			Build()).
+		Build())
+	if err != nil {
+		return "", fmt.Errorf("lark API error: %w", err)
+	}
+	if !fin.Success() || fin.Data == nil || fin.Data.FileToken == nil {
+		return "", fmt.Errorf("lark API failed: code=%d msg=%s", fin.Code, fin.Msg)
+	}
+	return *fin.Data.FileToken, nil
+}
+
+// deliverFile posts data to the chat as a file. When the file exceeds the
+// chat's limit or the upload fails, it falls back to Drive and posts a
+// link the chat's members can open. The error says why neither worked.
+func (r *Router) deliverFile(ctx context.Context, chatID, fileName string, data []byte) error {
+	var sendErr error
+	reason := "直接发送失败"
+	fs, ok := r.sender.(FileSender)
+	switch {
+	case !ok:
+		sendErr = errors.New("当前通道不支持发送文件")
+	case len(data) > maxUploadSize:
+		sendErr = fmt.Errorf("超过聊天文件上限 %s", formatSize(maxUploadSize))
+		reason = "超过聊天文件上限"
+	default:
+		if sendErr = fs.SendFile(ctx, chatID, fileName, data); sendErr == nil {
+			return nil
+		}
+	}
+	du, ok := r.sender.(DriveUploader)
+	if !ok {
+		return sendErr
+	}
+	if len(data) > maxDriveFileSize {
+		return fmt.Errorf("%v，且超过云空间上传上限 %s", sendErr, formatSize(maxDriveFileSize))
+	}
+	url, err := du.UploadToDrive(ctx, chatID, fileName, data)
+	if err != nil {
+		return fmt.Errorf("%v；上传到云空间也失败: %w", sendErr, err)
+	}
+	slog.InfoContext(ctx, "router: file sent via drive", "file", fileName, "chat_id", chatID, "size", len(data), "reason", sendErr)
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("📎 %s（%s）%s，已上传到云空间（本聊天成员可查看）:\n%s", fileName, formatSize(int64(len(data))), reason, url))
+	return nil
+}
+
+// fileLimit is the largest file deliverFile can get to the chat.
+func (r *Router) fileLimit() int64 {
+	if _, ok := r.sender.(DriveUploader); ok {
+		return maxDriveFileSize
+	}
+	return maxUploadSize
+}
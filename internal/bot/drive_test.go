@@ -0,0 +1,109 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// driveSpySender records files sent to the chat, failing those named in
+// failSend, and files uploaded to Drive.
+type driveSpySender struct {
+	fileSpySender
+	failSend map[string]bool
+	drive    map[string][]byte
+	driveErr error
+}
+
+func (s *driveSpySender) SendFile(ctx context.Context, chatID, fileName string, data []byte) error {
+	if s.failSend[fileName] {
+		return errors.New("upload rejected")
+	}
+	return s.fileSpySender.SendFile(ctx, chatID, fileName, data)
+}
+
+func (s *driveSpySender) UploadToDrive(_ context.Context, chatID, fileName string, data []byte) (string, error) {
+	if s.driveErr != nil {
+		return "", s.driveErr
+	}
+	if s.drive == nil {
+		s.drive = make(map[string][]byte)
+	}
+	s.drive[fileName] = data
+	return "https://feishu.cn/file/tok-" + fileName, nil
+}
+
+func TestDeliverFile(t *testing.T) {
+	r, _ := newTestRouter(t)
+	sender := &driveSpySender{failSend: map[string]bool{"rejected.txt": true}}
+	r.sender = sender
+	ctx := context.Background()
+
+	if err := r.deliverFile(ctx, "chat1", "small.txt", []byte("hi")); err != nil || string(sender.files["small.txt"]) != "hi" || sender.drive != nil {
+		t.Fatalf("expected a chat file, got %v %v %v", err, sender.files, sender.drive)
+	}
+
+	big := bytes.Repeat([]byte("x"), maxUploadSize+1)
+	if err := r.deliverFile(ctx, "chat1", "big.log", big); err != nil || len(sender.drive["big.log"]) != len(big) {
+		t.Fatalf("expected a Drive upload, got %v", err)
+	}
+	if _, ok := sender.files["big.log"]; ok {
+		t.Fatal("oversized file sent to the chat")
+	}
+	if msg := sender.LastMessage(); !strings.Contains(msg, "big.log") || !strings.Contains(msg, "超过聊天文件上限") || !strings.Contains(msg, "https://feishu.cn/file/tok-big.log") {
+		t.Fatalf("unexpected link message %q", msg)
+	}
+
+	if err := r.deliverFile(ctx, "chat1", "rejected.txt", []byte("x")); err != nil || !strings.Contains(sender.LastMessage(), "直接发送失败") {
+		t.Fatalf("expected a Drive fallback after a failed send, got %v %q", err, sender.LastMessage())
+	}
+
+	sender.driveErr = errors.New("no permission")
+	err := r.deliverFile(ctx, "chat1", "rejected.txt", []byte("x"))
+	if err == nil || !strings.Contains(err.Error(), "upload rejected") || !strings.Contains(err.Error(), "no permission") {
+		t.Fatalf("expected both failures reported, got %v", err)
+	}
+}
+
+func TestDeliverFile_NoDrive(t *testing.T) {
+	r, _ := newTestRouter(t)
+	sender := &fileSpySender{}
+	r.sender = sender
+	err := r.deliverFile(context.Background(), "chat1", "big.log", bytes.Repeat([]byte("x"), maxUploadSize+1))
+	if err == nil || !strings.Contains(err.Error(), "超过聊天文件上限") || len(sender.files) != 0 {
+		t.Fatalf("expected a size error, got %v", err)
+	}
+	if r.fileLimit() != maxUploadSize {
+		t.Fatalf("unexpected limit %d", r.fileLimit())
+	}
+}
+
+func TestSendFullOutput_ReportsFailure(t *testing.T) {
+	r, _ := newTestRouter(t)
+	sender := &driveSpySender{driveErr: errors.New("no permission")}
+	r.sender = sender
+	_, full := r.fitOutput("chat1", "test", strings.Repeat("line\n", 2000), true, "输出过长")
+	sender.failSend = map[string]bool{full.fileName(): true}
+
+	r.sendFullOutput(context.Background(), "chat1", full)
+	if msg := sender.LastMessage(); !strings.Contains(msg, "发送失败") || !strings.Contains(msg, "/output "+full.id) {
+		t.Fatalf("expected the failure reported, got %q", msg)
+	}
+}
+
+func TestRouterGet_LargeFileViaDrive(t *testing.T) {
+	r, _ := newTestRouter(t)
+	sender := &driveSpySender{}
+	r.sender = sender
+	dir := r.getSession("chat1").WorkDir
+	os.WriteFile(filepath.Join(dir, "dump.bin"), bytes.Repeat([]byte{1}, maxUploadSize+10), 0644)
+
+	r.Route(context.Background(), "chat1", "user1", "/get dump.bin")
+	if len(sender.drive["dump.bin"]) != maxUploadSize+10 || !strings.Contains(sender.LastMessage(), "已上传到云空间") {
+		t.Fatalf("expected a Drive link, got %q", sender.LastMessage())
+	}
+}
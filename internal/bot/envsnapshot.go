@@ -0,0 +1,84 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// envSnapshotTimeout bounds each command of an environment snapshot.
+const envSnapshotTimeout = 5 * time.Second
+
+// maxSnapshotStatusLines is how many lines of git status a snapshot keeps.
+const maxSnapshotStatusLines = 20
+
+// envSnapshot returns the environment snapshot attached to a failed
+// execution's card, or "" when Claude runs on another host or the
+// execution was cancelled.
+func (r *Router) envSnapshot(ctx context.Context, workDir string) string {
+	local, ok := r.executor.(*ClaudeExecutor)
+	if !ok || ctx.Err() != nil {
+		return ""
+	}
+	return collectEnvSnapshot(ctx, workDir, local.claudePath)
+}
+
+// collectEnvSnapshot describes the environment of a failed execution in workDir:
+// tool versions, git status and free disk space, so a bug report does not
+// need a round of questions about them.
+func collectEnvSnapshot(ctx context.Context, workDir, claudePath string) string {
+	probes := []struct {
+		label string
+		argv  []string
+	}{
+		{"claude", []string{claudePath, "--version"}},
+		{"go", []string{"go", "version"}},
+		{"node", []string{"node", "--version"}},
+		{"git status", []string{"git", "status", "--short", "--branch"}},
+	}
+	results := make([]string, len(probes))
+	var wg sync.WaitGroup
+	for i, p := range probes {
+		wg.Add(1)
+		go func(i int, argv []string) {
+			defer wg.Done()
+			if _, err := exec.LookPath(argv[0]); err != nil {
+				results[i] = "未安装"
+				return
+			}
+			out, err := runInDir(ctx, workDir, envSnapshotTimeout, argv...)
+			out = strings.TrimSpace(out)
+			if err != nil {
+				results[i] = fmt.Sprintf("出错: %v", err)
+				if out != "" {
+					results[i] += "（" + truncateRunes(firstLine(out), 200) + "）"
+				}
+				return
+			}
+			results[i] = out
+		}(i, p.argv)
+	}
+	wg.Wait()
+
+	var sb strings.Builder
+	for i, p := range probes[:3] {
+		fmt.Fprintf(&sb, "- **%s**: %s\n", p.label, firstLine(results[i]))
+	}
+	fmt.Fprintf(&sb, "- **磁盘**: %s\n", diskSpace(workDir))
+	fmt.Fprintf(&sb, "- **工作目录**: %s\n", workDir)
+	status := results[3]
+	if lines := strings.Split(status, "\n"); len(lines) > maxSnapshotStatusLines {
+		status = strings.Join(lines[:maxSnapshotStatusLines], "\n") + fmt.Sprintf("\n...（另有 %d 行）", len(lines)-maxSnapshotStatusLines)
+	}
+	fmt.Fprintf(&sb, "\n**git status**\n```\n%s\n```", status)
+	return sb.String()
+}
+
+// firstLine returns the first line of s.
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectEnvSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	initGitRepo(t, dir)
+	os.WriteFile(filepath.Join(dir, "new.go"), []byte("package x\n"), 0644)
+	fakeCommand(t, "node", "echo v20.11.0")
+	claude := filepath.Join(t.TempDir(), "claude")
+	os.WriteFile(claude, []byte("#!/bin/sh\necho '2.1.0 (Claude Code)'\n"), 0755)
+
+	got := collectEnvSnapshot(context.Background(), dir, claude)
+	for _, want := range []string{"- **claude**: 2.1.0 (Claude Code)", "- **node**: v20.11.0", "- **go**: go version", "- **磁盘**: 可用 ", "?? new.go"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("snapshot missing %q:\n%s", want, got)
+		}
+	}
+
+	got = collectEnvSnapshot(context.Background(), dir, "/nonexistent_binary_for_test")
+	if !strings.Contains(got, "- **claude**: 未安装") {
+		t.Errorf("missing claude not reported:\n%s", got)
+	}
+}
+
+func TestRouterExecClaude_ErrorHasEnvSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	claude := filepath.Join(dir, "claude")
+	os.WriteFile(claude, []byte(`#!/bin/sh
+if [ "$1" = "--version" ]; then echo '2.1.0 (Claude Code)'; exit 0; fi
+echo 'boom' >&2
+exit 1
+`), 0755)
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	sender := &cardSpySender{}
+	r := NewRouter(context.Background(), NewClaudeExecutor(claude, "sonnet", 10*time.Second), store, sender, map[string]bool{"user1": true}, dir, nil)
+
+	r.Route(context.Background(), "chat1", "user1", "fix it")
+	var card *CardMsg
+	for i := range sender.cards {
+		if strings.HasPrefix(sender.cards[i].Title, "执行出错") {
+			card = &sender.cards[i]
+		}
+	}
+	if card == nil {
+		t.Fatalf("no error card in %+v", sender.cards)
+	}
+	if card.Details == nil || card.Details.Title != "环境信息" || !strings.Contains(card.Details.Content, "2.1.0 (Claude Code)") {
+		t.Fatalf("details = %+v", card.Details)
+	}
+}
@@ -0,0 +1,240 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultExecTimeout and maxExecTimeout bound /exec without and with
+	// --timeout.
+	defaultExecTimeout = 30 * time.Second
+	maxExecTimeout     = 30 * time.Minute
+	// maxExecHistory is how many /exec commands each chat keeps.
+	maxExecHistory = 20
+	// redactedEnvValue stands for --env values in the /exec history.
+	redactedEnvValue = "***"
+)
+
+var (
+	envNameRe        = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	execHistoryRefRe = regexp.MustCompile(`^!\d+$`)
+)
+
+// smartQuotes are the typographic quotes chat clients substitute for the
+// ASCII ones, which the shell would otherwise take literally.
+var smartQuotes = strings.NewReplacer("“", `"`, "”", `"`, "‘", "'", "’", "'")
+
+// execFlags are the options given before an /exec command.
+type execFlags struct {
+	timeout time.Duration
+	env     []string
+	cwd     string
+	// command is the rest of the line, passed to sh -c untouched so pipes,
+	// quotes and redirections work as typed.
+	command string
+}
+
+// parseExecFlags splits the leading --timeout, --env and --cwd flags (also
+// as --flag=value) off an /exec line; "--" ends them.
+func parseExecFlags(line string) (execFlags, error) {
+	f := execFlags{timeout: defaultExecTimeout}
+	rest := strings.TrimSpace(smartQuotes.Replace(line))
+	for strings.HasPrefix(rest, "--") {
+		word, after, err := nextWord(rest)
+		if err != nil {
+			return f, err
+		}
+		if word == "--" {
+			rest = strings.TrimSpace(after)
+			break
+		}
+		name, value, hasValue := strings.Cut(word, "=")
+		switch name {
+		case "--timeout", "--env", "--cwd":
+		default:
+			return f, fmt.Errorf("未知的选项 %s（支持 --timeout、--env、--cwd）", name)
+		}
+		if !hasValue {
+			if value, after, err = nextWord(after); err != nil {
+				return f, err
+			}
+			if value == "" {
+				return f, fmt.Errorf("%s 缺少参数", name)
+			}
+		}
+		switch name {
+		case "--timeout":
+			d, err := parseExecTimeout(value)
+			if err != nil {
+				return f, err
+			}
+			f.timeout = d
+		case "--env":
+			key, _, ok := strings.Cut(value, "=")
+			if !ok || !envNameRe.MatchString(key) {
+				return f, fmt.Errorf("--env 需要 KEY=VALUE 格式，如 --env GOFLAGS=-mod=mod")
+			}
+			f.env = append(f.env, value)
+		case "--cwd":
+			f.cwd = value
+		}
+		rest = strings.TrimSpace(after)
+	}
+	f.command = rest
+	return f, nil
+}
+
+// parseExecTimeout reads a duration such as 90s or 5m; a bare number is
+// seconds.
+func parseExecTimeout(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if n, nerr := strconv.Atoi(s); nerr == nil {
+		d, err = time.Duration(n)*time.Second, nil
+	}
+	if err != nil || d < time.Second || d > maxExecTimeout {
+		return 0, fmt.Errorf("无效的 --timeout %q，应为 1s 到 %s 之间，如 90s、5m", s, maxExecTimeout)
+	}
+	return d, nil
+}
+
+// nextWord returns the first shell word of s, with '…' and "…" quoting
+// removed, and the text after it.
+func nextWord(s string) (word, rest string, err error) {
+	s = strings.TrimLeft(s, " \t")
+	var sb strings.Builder
+	var quote rune
+	for i, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				sb.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ' ' || c == '\t' || c == '\n':
+			return sb.String(), s[i:], nil
+		default:
+			sb.WriteRune(c)
+		}
+	}
+	if quote != 0 {
+		return "", "", fmt.Errorf("引号不匹配: %s", s)
+	}
+	return sb.String(), "", nil
+}
+
+// execDir resolves --cwd against workDir; it must be a directory inside it.
+func execDir(workDir, cwd string) (string, error) {
+	if cwd == "" {
+		return workDir, nil
+	}
+	dir := filepath.Clean(cwd)
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(workDir, dir)
+	}
+	if !underRoot(workDir, dir) {
+		return "", fmt.Errorf("--cwd %s 不在工作目录 %s 内", cwd, workDir)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("--cwd %s 不是目录", cwd)
+	}
+	return dir, nil
+}
+
+// resolveExecHistory expands /exec !! (the last command) and !<n> (the
+// n-th of /exec history) into the command line they repeat.
+func (r *Router) resolveExecHistory(chatID, args string) (string, bool, error) {
+	if args != "!!" && !execHistoryRefRe.MatchString(args) {
+		return args, false, nil
+	}
+	history := r.getSession(chatID).ExecHistory
+	if len(history) == 0 {
+		return "", false, fmt.Errorf("本聊天还没有执行过 /exec 命令。")
+	}
+	n := len(history)
+	if args != "!!" {
+		var err error
+		n, err = strconv.Atoi(args[1:])
+		if err != nil || n < 1 || n > len(history) {
+			return "", false, fmt.Errorf("没有第 %s 条命令，/exec history 查看历史（共 %d 条）。", args[1:], len(history))
+		}
+	}
+	line := history[n-1]
+	if f, err := parseExecFlags(line); err == nil {
+		for _, kv := range f.env {
+			if strings.HasSuffix(kv, "="+redactedEnvValue) {
+				return "", false, fmt.Errorf("第 %d 条命令的 --env 值没有保存，请重新发送完整的命令。", n)
+			}
+		}
+	}
+	return line, true, nil
+}
+
+// redactExecEnv replaces the values of line's --env flags with
+// redactedEnvValue, so secrets passed that way stay out of the state file
+// and /exec history.
+func redactExecEnv(line string) string {
+	f, err := parseExecFlags(line)
+	if err != nil || len(f.env) == 0 {
+		return line
+	}
+	var parts []string
+	if f.timeout != defaultExecTimeout {
+		parts = append(parts, "--timeout "+f.timeout.String())
+	}
+	for _, kv := range f.env {
+		key, _, _ := strings.Cut(kv, "=")
+		parts = append(parts, "--env "+key+"="+redactedEnvValue)
+	}
+	if cwd := f.cwd; cwd != "" {
+		if strings.ContainsAny(cwd, " \t'\"") {
+			cwd = shellQuote(cwd)
+		}
+		parts = append(parts, "--cwd "+cwd)
+	}
+	if strings.HasPrefix(f.command, "-") {
+		parts = append(parts, "--")
+	}
+	return strings.Join(append(parts, f.command), " ")
+}
+
+// recordExecHistory appends line, with its --env values redacted, to the
+// chat's /exec history unless it repeats the last entry.
+func (r *Router) recordExecHistory(chatID, line string) {
+	line = redactExecEnv(line)
+	r.store.UpdateSession(chatID, func(s *Session) {
+		if n := len(s.ExecHistory); n > 0 && s.ExecHistory[n-1] == line {
+			return
+		}
+		s.ExecHistory = append(s.ExecHistory, line)
+		if n := len(s.ExecHistory); n > maxExecHistory {
+			s.ExecHistory = s.ExecHistory[n-maxExecHistory:]
+		}
+	})
+	r.save()
+}
+
+// listExecHistory shows the chat's /exec history, oldest first, numbered
+// for /exec !<n>.
+func (r *Router) listExecHistory(ctx context.Context, chatID string) {
+	history := r.getSession(chatID).ExecHistory
+	if len(history) == 0 {
+		r.sender.SendText(ctx, chatID, "本聊天还没有执行过 /exec 命令。")
+		return
+	}
+	var sb strings.Builder
+	for i, line := range history {
+		fmt.Fprintf(&sb, "%d. `%s`\n", i+1, line)
+	}
+	sb.WriteString("\n`/exec !!` 重复上一条，`/exec !<序号>` 重复指定的命令。")
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("/exec 历史（%d）", len(history)), Content: sb.String()})
+}
@@ -0,0 +1,119 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExecFlags(t *testing.T) {
+	tests := []struct {
+		line string
+		want execFlags
+	}{
+		{"ls -la", execFlags{timeout: defaultExecTimeout, command: "ls -la"}},
+		{"--timeout 5m go test ./... | tail -5", execFlags{timeout: 5 * time.Minute, command: "go test ./... | tail -5"}},
+		{"--timeout=90 --env CI=1 --env 'MSG=hello world' --cwd web npm run build", execFlags{timeout: 90 * time.Second, env: []string{"CI=1", "MSG=hello world"}, cwd: "web", command: "npm run build"}},
+		{"--cwd=sub -- --version", execFlags{timeout: defaultExecTimeout, cwd: "sub", command: "--version"}},
+		{"echo “quoted text” | grep ‘text’", execFlags{timeout: defaultExecTimeout, command: `echo "quoted text" | grep 'text'`}},
+	}
+	for _, tt := range tests {
+		got, err := parseExecFlags(tt.line)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseExecFlags(%q) = %+v, %v; want %+v", tt.line, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"--verbose ls", "--timeout", "--timeout 45m ls", "--timeout soon ls", "--env NOVALUE ls", "--env 1X=2 ls", "--env 'A=b ls"} {
+		if _, err := parseExecFlags(bad); err == nil {
+			t.Errorf("parseExecFlags(%q) should fail", bad)
+		}
+	}
+}
+
+func TestRouterExec_FlagsAndExitCode(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "web"), 0755)
+	r, sender := newCleanRouter(t, dir)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", `/exec --cwd web --env GREETING='hi there' sh -c 'echo "$GREETING from $(basename $PWD)"; exit 3' | cat; exit 7`)
+	card := sender.cards[len(sender.cards)-1]
+	if !strings.Contains(card.Content, "hi there from web") || card.Template != "red" {
+		t.Fatalf("card = %+v", card)
+	}
+	if !strings.HasPrefix(card.Title, "$ sh -c") || !strings.Contains(card.Title, "web/，退出码 7，耗时") {
+		t.Fatalf("title = %q", card.Title)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/exec --timeout 1s sleep 5")
+	if card := sender.cards[len(sender.cards)-1]; !strings.Contains(card.Content, "命令超时（1s）") || strings.Contains(card.Title, "退出码") {
+		t.Fatalf("timeout card = %+v", card)
+	}
+
+	for _, bad := range []string{"/exec --cwd ../ ls", "/exec --cwd missing ls", "/exec --timeout 1s"} {
+		r.Route(ctx, "chat1", "user1", bad)
+	}
+	if len(sender.texts) != 3 || !strings.Contains(sender.texts[0], "不在工作目录") || !strings.Contains(sender.texts[1], "不是目录") || !strings.Contains(sender.texts[2], "缺少要执行的命令") {
+		t.Fatalf("texts = %q", sender.texts)
+	}
+}
+
+func TestRouterExec_History(t *testing.T) {
+	dir := t.TempDir()
+	r, sender := newCleanRouter(t, dir)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "/exec !!")
+	if msg := sender.texts[len(sender.texts)-1]; !strings.Contains(msg, "还没有执行过") {
+		t.Fatalf("empty history = %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "/exec echo one")
+	r.Route(ctx, "chat1", "user1", "/exec --timeout 5m echo two")
+	r.Route(ctx, "chat1", "user1", "/exec --timeout 5m echo two")
+
+	r.Route(ctx, "chat1", "user1", "/exec !!")
+	if card := sender.cards[len(sender.cards)-1]; !strings.Contains(card.Content, "two") || !strings.Contains(card.Content, "重复执行") {
+		t.Fatalf("!! card = %+v", card)
+	}
+	r.Route(ctx, "chat1", "user1", "/exec !1")
+	if card := sender.cards[len(sender.cards)-1]; !strings.Contains(card.Content, "one") {
+		t.Fatalf("!1 card = %+v", card)
+	}
+	r.Route(ctx, "chat1", "user1", "/exec !9")
+	if msg := sender.texts[len(sender.texts)-1]; !strings.Contains(msg, "没有第 9 条命令") {
+		t.Fatalf("!9 = %q", msg)
+	}
+
+	// Repeats are recorded too, but not twice in a row.
+	want := []string{"--timeout 5m echo two", "echo one"}
+	if got := r.getSession("chat1").ExecHistory; !reflect.DeepEqual(got, append([]string{"echo one"}, want...)) {
+		t.Fatalf("history = %q", got)
+	}
+	r.Route(ctx, "chat1", "user1", "/exec history")
+	if card := sender.cards[len(sender.cards)-1]; !strings.Contains(card.Content, "2. `--timeout 5m echo two`") {
+		t.Fatalf("history card = %+v", card)
+	}
+
+	// --env values, often secrets, are not kept, so such a line cannot be
+	// repeated.
+	r.Route(ctx, "chat1", "user1", "/exec --env TOKEN=s3cr3t --cwd . sh -c 'echo $TOKEN'")
+	history := r.getSession("chat1").ExecHistory
+	if got := history[len(history)-1]; got != "--env TOKEN=*** --cwd . sh -c 'echo $TOKEN'" {
+		t.Fatalf("recorded %q", got)
+	}
+	r.Route(ctx, "chat1", "user1", "/exec !!")
+	if msg := sender.texts[len(sender.texts)-1]; !strings.Contains(msg, "--env 值没有保存") {
+		t.Fatalf("!! with --env = %q", msg)
+	}
+
+	for i := 0; i < maxExecHistory+5; i++ {
+		r.recordExecHistory("chat1", strings.Repeat("x", i+1))
+	}
+	if n := len(r.getSession("chat1").ExecHistory); n != maxExecHistory {
+		t.Fatalf("history kept %d entries", n)
+	}
+}
@@ -0,0 +1,28 @@
+package bot
+
+import (
+	"context"
+	"time"
+)
+
+// Executor runs Claude prompts for the Router. ClaudeExecutor runs the CLI
+// locally; RemoteExecutor forwards each run to an execution backend over gRPC;
+// ExecutorPool spreads runs across several of them.
+type Executor interface {
+	ExecStream(ctx context.Context, prompt, workDir, sessionID, permissionMode, model string, onProgress func(text string)) (ExecResult, error)
+	Kill() error
+	IsRunning() bool
+	Model() string
+	WaitIdle(timeout time.Duration) bool
+	ExecCount() int
+	LastExecDuration() time.Duration
+	// LocalPaths reports whether work directories are paths on this
+	// machine, so the Router can check them before a run.
+	LocalPaths() bool
+}
+
+var (
+	_ Executor = (*ClaudeExecutor)(nil)
+	_ Executor = (*RemoteExecutor)(nil)
+	_ Executor = (*ExecutorPool)(nil)
+)
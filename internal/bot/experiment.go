@@ -0,0 +1,166 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prompts the bot writes itself that prompt_templates can vary: the
+// instruction of /commit without a message, of /summary and the rubric of
+// /review-local.
+const (
+	templateCommit  = "commit"
+	templateSummary = "summary"
+	templateReview  = "review"
+)
+
+// builtinTemplates are the instructions used when no variant is
+// configured, or a variant leaves its template empty.
+var builtinTemplates = map[string]string{
+	templateCommit:  "Stage tracked file changes with `git add -u` (do NOT use `git add -A` to avoid staging untracked files), then write a concise commit message based on the changes (`git diff --cached`), and commit. Only show the final commit output, no explanation.",
+	templateSummary: "Please summarize the following output concisely:",
+	templateReview:  reviewRubric,
+}
+
+// defaultExperimentDays is the period /experiments covers.
+const defaultExperimentDays = 30
+
+// templateIntn picks variants; tests replace it.
+var templateIntn = rand.Intn
+
+// SetPromptTemplates sets the template variants of the bot's own prompts,
+// by kind (commit, summary, review).
+func (r *Router) SetPromptTemplates(templates map[string][]PromptTemplate) {
+	r.promptTemplates = templates
+}
+
+// pickTemplate chooses the instruction for a prompt of kind, splitting
+// traffic between its variants by weight. name is "<kind>/<variant>" for
+// recording with the execution, or "" when kind has no variants.
+func (r *Router) pickTemplate(kind string) (name, text string) {
+	variants := r.promptTemplates[kind]
+	total := 0
+	for _, v := range variants {
+		total += v.Weight
+	}
+	if total == 0 {
+		return "", builtinTemplates[kind]
+	}
+	n := templateIntn(total)
+	for _, v := range variants {
+		if n < v.Weight {
+			text = v.Template
+			if text == "" {
+				text = builtinTemplates[kind]
+			}
+			return kind + "/" + v.Name, text
+		}
+		n -= v.Weight
+	}
+	return "", builtinTemplates[kind] // unreachable
+}
+
+type promptTemplateKey struct{}
+
+// withPromptTemplate records the template variant a prompt was built from
+// with its execution.
+func withPromptTemplate(ctx context.Context, name string) context.Context {
+	if name == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, promptTemplateKey{}, name)
+}
+
+func promptTemplateFrom(ctx context.Context) string {
+	name, _ := ctx.Value(promptTemplateKey{}).(string)
+	return name
+}
+
+// templateStats are the results of one template variant.
+type templateStats struct {
+	Name       string
+	Executions int
+	Failures   int
+	Duration   time.Duration
+	Feedback   feedbackTally
+}
+
+// collectTemplateStats groups the executions since since by template
+// variant, in name order.
+func (r *Router) collectTemplateStats(since time.Time) []*templateStats {
+	byName := make(map[string]*templateStats)
+	for _, rec := range r.store.ExecRecords("", 0) {
+		if rec.Template == "" || rec.StartedAt.Before(since) {
+			continue
+		}
+		st := byName[rec.Template]
+		if st == nil {
+			st = &templateStats{Name: rec.Template}
+			byName[rec.Template] = st
+		}
+		st.Executions++
+		st.Duration += rec.Duration
+		if rec.Error != "" {
+			st.Failures++
+		}
+		st.Feedback.add(rec.Rating)
+	}
+	stats := make([]*templateStats, 0, len(byName))
+	for _, name := range sortedKeys(byName) {
+		stats = append(stats, byName[name])
+	}
+	return stats
+}
+
+// cmdExperiments compares the prompt template variants over the last days:
+// executions, failure rate, average duration and feedback.
+func (r *Router) cmdExperiments(ctx context.Context, chatID, args string) {
+	days := defaultExperimentDays
+	if args = strings.TrimSpace(args); args != "" {
+		n, err := strconv.Atoi(args)
+		if err != nil || n <= 0 {
+			r.sender.SendText(ctx, chatID, "用法: /experiments [天数]\n比较 prompt_templates 中各模板变体最近 N 天（默认 30 天）的执行次数、失败率、平均耗时和 👍/👎 反馈。")
+			return
+		}
+		days = n
+	}
+
+	var sb strings.Builder
+	if len(r.promptTemplates) == 0 {
+		sb.WriteString("未配置模板实验（prompt_templates），当前使用内置模板。\n")
+	}
+	for _, kind := range sortedKeys(r.promptTemplates) {
+		total := 0
+		for _, v := range r.promptTemplates[kind] {
+			total += v.Weight
+		}
+		var parts []string
+		for _, v := range r.promptTemplates[kind] {
+			part := fmt.Sprintf("%s %d%%", v.Name, v.Weight*100/total)
+			if v.Template == "" {
+				part += "（内置）"
+			}
+			parts = append(parts, part)
+		}
+		fmt.Fprintf(&sb, "**%s:** %s\n", kind, strings.Join(parts, " · "))
+	}
+
+	stats := r.collectTemplateStats(time.Now().AddDate(0, 0, -days))
+	if len(stats) == 0 {
+		fmt.Fprintf(&sb, "\n最近 %d 天没有使用模板变体的执行。", days)
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "Prompt 模板实验", Content: strings.TrimSpace(sb.String())})
+		return
+	}
+	fmt.Fprintf(&sb, "\n**最近 %d 天:**\n", days)
+	for _, st := range stats {
+		avg := st.Duration / time.Duration(st.Executions)
+		fmt.Fprintf(&sb, "- `%s`: 执行 %d 次，失败 %d 次（%d%%），平均 %s，%s\n",
+			st.Name, st.Executions, st.Failures, st.Failures*100/st.Executions, avg.Truncate(time.Second), st.Feedback)
+	}
+	sb.WriteString("\n结果卡片下的 👍/👎 或 /feedback 会计入对应变体。")
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: "Prompt 模板实验", Content: sb.String()})
+}
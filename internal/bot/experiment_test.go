@@ -0,0 +1,90 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPickTemplate(t *testing.T) {
+	r, _ := newTestRouter(t)
+	if name, text := r.pickTemplate(templateCommit); name != "" || text != builtinTemplates[templateCommit] {
+		t.Fatalf("expected the built-in template, got %q %q", name, text)
+	}
+
+	r.SetPromptTemplates(map[string][]PromptTemplate{templateCommit: {
+		{Name: "builtin", Weight: 1},
+		{Name: "conventional", Weight: 3, Template: "conventional please"},
+	}})
+	defer func(orig func(int) int) { templateIntn = orig }(templateIntn)
+	picks := make(map[string]int)
+	for n := 0; n < 4; n++ {
+		templateIntn = func(total int) int {
+			if total != 4 {
+				t.Fatalf("expected a total weight of 4, got %d", total)
+			}
+			return n
+		}
+		name, text := r.pickTemplate(templateCommit)
+		picks[name]++
+		if name == "commit/builtin" && text != builtinTemplates[templateCommit] || name == "commit/conventional" && text != "conventional please" {
+			t.Fatalf("unexpected text %q for %s", text, name)
+		}
+	}
+	if picks["commit/builtin"] != 1 || picks["commit/conventional"] != 3 {
+		t.Fatalf("expected traffic split by weight, got %v", picks)
+	}
+}
+
+func TestRouterCommit_RecordsTemplate(t *testing.T) {
+	dir := t.TempDir()
+	prompts := filepath.Join(dir, "prompt")
+	claude := filepath.Join(dir, "claude")
+	os.WriteFile(claude, []byte("#!/bin/sh\ncat > "+prompts+"\necho '{\"type\":\"result\",\"result\":\"committed\",\"session_id\":\"s1\"}'\n"), 0755)
+	r, _ := newAckRouter(t, claude)
+	r.SetPromptTemplates(map[string][]PromptTemplate{templateCommit: {{Name: "conventional", Weight: 1, Template: "Commit with a Conventional Commits message."}}})
+
+	r.Route(context.Background(), "chat1", "user1", "/commit")
+	if data, _ := os.ReadFile(prompts); !strings.Contains(string(data), "Commit with a Conventional Commits message.") {
+		t.Fatalf("expected the variant's prompt, got %q", data)
+	}
+	recs := r.store.ExecRecords("chat1", 1)
+	if len(recs) != 1 || recs[0].Template != "commit/conventional" {
+		t.Fatalf("expected the variant recorded, got %+v", recs)
+	}
+}
+
+func TestRouterExperiments(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/experiments")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "未配置模板实验") || !strings.Contains(msg, "没有使用模板变体的执行") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+
+	r.SetPromptTemplates(map[string][]PromptTemplate{templateSummary: {{Name: "builtin", Weight: 1}, {Name: "bullets", Weight: 3, Template: "Summarize as bullets:"}}})
+	now := time.Now()
+	r.store.AddExecRecord(ExecRecord{ID: "e1", ChatID: "chat1", StartedAt: now, Duration: 10 * time.Second, Template: "summary/bullets", Rating: ratingUp})
+	r.store.AddExecRecord(ExecRecord{ID: "e2", ChatID: "chat1", StartedAt: now, Duration: 20 * time.Second, Template: "summary/bullets", Error: "boom"})
+	r.store.AddExecRecord(ExecRecord{ID: "e3", ChatID: "chat1", StartedAt: now, Duration: 5 * time.Second, Template: "summary/builtin", Rating: ratingDown})
+	r.store.AddExecRecord(ExecRecord{ID: "e4", ChatID: "chat1", StartedAt: now.AddDate(0, 0, -40), Template: "summary/builtin"})
+	r.store.AddExecRecord(ExecRecord{ID: "e5", ChatID: "chat1", StartedAt: now})
+
+	r.Route(context.Background(), "chat1", "user1", "/experiments")
+	msg := sender.LastMessage()
+	for _, want := range []string{
+		"**summary:** builtin 25%（内置） · bullets 75%",
+		"`summary/bullets`: 执行 2 次，失败 1 次（50%），平均 15s，👍 1 · 👎 0（好评率 100%）",
+		"`summary/builtin`: 执行 1 次，失败 0 次（0%），平均 5s，👍 0 · 👎 1（好评率 0%）",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected %q in:\n%s", want, msg)
+		}
+	}
+	r.Route(context.Background(), "chat1", "user1", "/experiments x")
+	if !strings.HasPrefix(sender.LastMessage(), "用法: /experiments") {
+		t.Fatalf("expected usage, got %q", sender.LastMessage())
+	}
+}
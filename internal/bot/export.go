@@ -0,0 +1,158 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resolveExportSession finds the Claude session /export names: the current
+// one by default, a /save name, a /sessions index or a session ID. Only the
+// chat's own sessions can be named by ID. It returns the session ID and
+// the name to title the transcript with.
+func resolveExportSession(s Session, arg string) (string, string, error) {
+	if arg == "" {
+		if s.ClaudeSessionID == "" {
+			return "", "", fmt.Errorf("当前没有 Claude 会话，先发送一条消息开始会话，或指定要导出的会话。")
+		}
+		return s.ClaudeSessionID, shortHash(s.ClaudeSessionID), nil
+	}
+	if ns, ok := s.NamedSessions[arg]; ok {
+		return ns.SessionID, arg, nil
+	}
+	if i, err := strconv.Atoi(arg); err == nil {
+		if i < 0 || i >= len(s.History) {
+			return "", "", fmt.Errorf("序号 %d 不存在，请用 /sessions 查看有效序号。", i)
+		}
+		return s.History[i], shortHash(s.History[i]), nil
+	}
+	if !chatHasSession(s, arg) {
+		return "", "", fmt.Errorf("会话 %s 不属于当前聊天，请用 /sessions 查看可导出的会话。", arg)
+	}
+	return arg, shortHash(arg), nil
+}
+
+// chatHasSession reports whether id is one of the chat's Claude sessions:
+// the current one, one in its history, a workdir's or a saved one.
+func chatHasSession(s Session, id string) bool {
+	if id == s.ClaudeSessionID {
+		return true
+	}
+	for _, h := range s.History {
+		if h == id {
+			return true
+		}
+	}
+	for _, d := range s.DirSessions {
+		if d == id {
+			return true
+		}
+	}
+	for _, ns := range s.NamedSessions {
+		if ns.SessionID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// renderTranscript renders a session's turns as Markdown.
+func renderTranscript(sessionID, name string, turns []Turn) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# 会话记录 %s\n\n", name)
+	fmt.Fprintf(&sb, "- **会话:** `%s`\n", sessionID)
+	first, last := turns[0], turns[len(turns)-1]
+	fmt.Fprintf(&sb, "- **时间:** %s ~ %s\n", first.At.Format("2006-01-02 15:04"), last.At.Add(last.Duration).Format("2006-01-02 15:04"))
+	fmt.Fprintf(&sb, "- **轮次:** %d\n", len(turns))
+	workDir := ""
+	for i, t := range turns {
+		fmt.Fprintf(&sb, "\n---\n\n## %d · %s · `%s`（%s）\n\n", i+1, t.At.Format("01-02 15:04"), t.ExecID, t.Duration.Truncate(time.Second))
+		if t.WorkDir != "" && t.WorkDir != workDir {
+			fmt.Fprintf(&sb, "*工作目录: %s*\n\n", t.WorkDir)
+			workDir = t.WorkDir
+		}
+		sb.WriteString("**Prompt:**\n\n")
+		for _, line := range strings.Split(strings.TrimSpace(t.Prompt), "\n") {
+			sb.WriteString(strings.TrimRight("> "+line, " ") + "\n")
+		}
+		if t.Error != "" {
+			fmt.Fprintf(&sb, "\n**错误:**\n\n```\n%s\n```\n", strings.TrimSpace(t.Error))
+			continue
+		}
+		output := strings.TrimSpace(t.Output)
+		if output == "" {
+			output = "（无输出）"
+		}
+		fmt.Fprintf(&sb, "\n**回复:**\n\n%s\n", output)
+	}
+	return sb.String()
+}
+
+// cmdExport writes a session's prompts and replies as Markdown, to a file
+// in the workdir or, with "doc", to a new Feishu document.
+func (r *Router) cmdExport(ctx context.Context, chatID, args string) {
+	fields := strings.Fields(args)
+	toDoc := len(fields) > 0 && fields[len(fields)-1] == "doc"
+	if toDoc {
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) > 1 {
+		r.sender.SendText(ctx, chatID, "用法: /export [会话] [doc]\n会话可以是 /save 的名称、/sessions 的序号或会话 ID，默认当前会话；加 doc 推送为飞书文档，否则保存到工作目录。")
+		return
+	}
+	session := r.getSession(chatID)
+	sessionID, name, err := resolveExportSession(session, strings.Join(fields, ""))
+	if err != nil {
+		r.sender.SendText(ctx, chatID, err.Error())
+		return
+	}
+	turns, err := r.store.Turns(sessionID)
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("读取会话记录失败: %v", err))
+		return
+	}
+	if len(turns) == 0 {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("会话 %s 没有可导出的记录。", sessionID))
+		return
+	}
+	// Transcripts may predate redaction of stored output; they leave the
+	// bot here, so hide secrets regardless of the chat's pipeline.
+	transcript := r.secrets.Redact(renderTranscript(sessionID, name, turns))
+
+	if toDoc {
+		if r.docSyncer == nil {
+			r.sender.SendText(ctx, chatID, "未配置飞书文档，无法推送；去掉 doc 参数可保存到工作目录。")
+			return
+		}
+		title := fmt.Sprintf("会话记录 %s %s", name, time.Now().Format("2006-01-02"))
+		_, docURL, err := r.docSyncer.CreateAndPushDoc(ctx, title, transcript)
+		if err != nil {
+			slog.WarnContext(ctx, "router: export doc failed", "chat_id", chatID, "session_id", sessionID, "err", err)
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("创建飞书文档失败: %v", err))
+			return
+		}
+		r.sender.SendCard(ctx, chatID, CardMsg{
+			Title:    "📤 会话已导出",
+			Content:  fmt.Sprintf("**会话:** %s（%d 轮）\n**文档:** [%s](%s)", sessionID, len(turns), docURL, docURL),
+			Template: "green",
+		})
+		return
+	}
+
+	workDir := session.WorkDir
+	if workDir == "" {
+		workDir = r.store.WorkRoot()
+	}
+	file := filepath.Join(workDir, fmt.Sprintf("devbot-session-%s.md", shortHash(sessionID)))
+	if err := os.WriteFile(file, []byte(transcript), 0644); err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("保存会话记录失败: %v", err))
+		return
+	}
+	slog.InfoContext(ctx, "router: session exported", "chat_id", chatID, "session_id", sessionID, "turns", len(turns), "file", file)
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已将会话 %s 的 %d 轮对话导出到 %s", sessionID, len(turns), file))
+}
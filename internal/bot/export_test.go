@@ -0,0 +1,154 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoreTurns(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+
+	if turns, err := store.Turns("s1"); err != nil || turns != nil {
+		t.Fatalf("expected no transcript, got %v, %v", turns, err)
+	}
+	store.AppendTurn("s1", Turn{ExecID: "e1", Prompt: "first", Output: "one"})
+	store.AppendTurn("s1", Turn{ExecID: "e2", Prompt: "second", Error: "boom"})
+	store.AppendTurn("s2", Turn{ExecID: "e3", Prompt: "elsewhere"})
+	turns, err := store.Turns("s1")
+	if err != nil || len(turns) != 2 || turns[0].Prompt != "first" || turns[1].Error != "boom" {
+		t.Fatalf("unexpected transcript: %+v, %v", turns, err)
+	}
+	if err := store.AppendTurn("../evil", Turn{}); err == nil {
+		t.Fatal("expected a session ID with a path separator to be rejected")
+	}
+}
+
+func TestStoreTurns_Prune(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	old := time.Now().Add(-time.Hour)
+	for i := 0; i < maxTranscripts; i++ {
+		id := fmt.Sprintf("old%03d", i)
+		store.AppendTurn(id, Turn{Prompt: "p"})
+		path, _ := store.transcriptPath(id)
+		os.Chtimes(path, old.Add(time.Duration(i)*time.Second), old.Add(time.Duration(i)*time.Second))
+	}
+	store.AppendTurn("new", Turn{Prompt: "p"})
+
+	entries, _ := os.ReadDir(store.transcriptDir())
+	if len(entries) != maxTranscripts {
+		t.Fatalf("expected %d transcripts, got %d", maxTranscripts, len(entries))
+	}
+	if turns, _ := store.Turns("old000"); turns != nil {
+		t.Fatal("expected the oldest transcript to be removed")
+	}
+	if turns, _ := store.Turns("new"); len(turns) != 1 {
+		t.Fatal("expected the new transcript to be kept")
+	}
+}
+
+func newExportRouter(t *testing.T) (*Router, *spySender, string) {
+	t.Helper()
+	dir := t.TempDir()
+	script := filepath.Join(dir, "claude")
+	os.WriteFile(script, []byte("#!/bin/sh\nprintf '%s\\n' '{\"type\":\"result\",\"result\":\"## Answer\\nall good\",\"session_id\":\"sess-1234abcd\"}'\n"), 0755)
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	sender := &spySender{}
+	r := NewRouter(context.Background(), NewClaudeExecutor(script, "sonnet", 10*time.Second), store, sender, map[string]bool{"user1": true}, dir, nil)
+	return r, sender, dir
+}
+
+func TestExport_File(t *testing.T) {
+	r, sender, dir := newExportRouter(t)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "/export")
+	if !strings.Contains(sender.LastMessage(), "当前没有 Claude 会话") {
+		t.Fatalf("expected no-session notice, got %q", sender.LastMessage())
+	}
+
+	r.Route(ctx, "chat1", "user1", "why does\nthe build fail")
+	r.Route(ctx, "chat1", "user1", "fix it")
+	r.Route(ctx, "chat1", "user1", "/export")
+	if !strings.Contains(sender.LastMessage(), "2 轮对话") {
+		t.Fatalf("expected export confirmation, got %q", sender.LastMessage())
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "devbot-session-sess-12.md"))
+	if err != nil {
+		t.Fatalf("expected transcript file: %v", err)
+	}
+	md := string(data)
+	for _, want := range []string{"`sess-1234abcd`", "**轮次:** 2", "> why does\n> the build fail", "> fix it", "## Answer\nall good"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected %q in transcript:\n%s", want, md)
+		}
+	}
+
+	// A named session can be exported after switching away from it.
+	r.Route(ctx, "chat1", "user1", "/save build")
+	r.Route(ctx, "chat1", "user1", "/new")
+	r.Route(ctx, "chat1", "user1", "/export build")
+	if !strings.Contains(sender.LastMessage(), "2 轮对话") {
+		t.Fatalf("expected named export, got %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "user1", "/export 9")
+	if !strings.Contains(sender.LastMessage(), "序号 9 不存在") {
+		t.Fatalf("expected bad index notice, got %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "user1", "/export unknown")
+	if !strings.Contains(sender.LastMessage(), "不属于当前聊天") {
+		t.Fatalf("expected unknown session refused, got %q", sender.LastMessage())
+	}
+
+	// Another chat cannot export this chat's session by ID.
+	r.Route(ctx, "chat2", "user1", "/export sess-1234abcd")
+	if !strings.Contains(sender.LastMessage(), "不属于当前聊天") {
+		t.Fatalf("expected another chat's session refused, got %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "user1", "/export sess-1234abcd")
+	if !strings.Contains(sender.LastMessage(), "2 轮对话") {
+		t.Fatalf("expected own session by ID, got %q", sender.LastMessage())
+	}
+}
+
+func TestExport_Redacts(t *testing.T) {
+	r, _, dir := newExportRouter(t)
+	ctx := context.Background()
+	r.Route(ctx, "chat1", "user1", "hello")
+	// A turn stored before redaction of stored output.
+	r.store.AppendTurn("sess-1234abcd", Turn{ExecID: "old", Prompt: "key?", Output: "it is s3cr3t-value"})
+	r.SetSecrets(&Secrets{values: map[string]string{"token": "s3cr3t-value"}})
+
+	r.Route(ctx, "chat1", "user1", "/export")
+	data, _ := os.ReadFile(filepath.Join(dir, "devbot-session-sess-12.md"))
+	if strings.Contains(string(data), "s3cr3t-value") || !strings.Contains(string(data), "it is [已隐藏]") {
+		t.Fatalf("expected a redacted transcript:\n%s", data)
+	}
+}
+
+func TestExport_Doc(t *testing.T) {
+	r, sender, _ := newExportRouter(t)
+	ctx := context.Background()
+	r.Route(ctx, "chat1", "user1", "hello")
+
+	r.Route(ctx, "chat1", "user1", "/export doc")
+	if !strings.Contains(sender.LastMessage(), "未配置飞书文档") {
+		t.Fatalf("expected missing doc syncer notice, got %q", sender.LastMessage())
+	}
+
+	docs := &fakeDocPusher{returnDocID: "doc1", returnDocURL: "https://example.feishu.cn/docx/doc1"}
+	r.docSyncer = docs
+	r.Route(ctx, "chat1", "user1", "/export doc")
+	if !strings.Contains(docs.createdContent, "> hello") || !strings.HasPrefix(docs.createdTitle, "会话记录 sess-12") {
+		t.Fatalf("unexpected doc: %q\n%s", docs.createdTitle, docs.createdContent)
+	}
+	if !strings.Contains(sender.LastMessage(), "https://example.feishu.cn/docx/doc1") {
+		t.Fatalf("expected doc link, got %q", sender.LastMessage())
+	}
+}
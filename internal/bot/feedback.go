@@ -0,0 +1,244 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ratings of an execution (ExecRecord.Rating).
+const (
+	ratingUp   = "up"
+	ratingDown = "down"
+)
+
+const (
+	// maxFeedbackRunes bounds the comment kept with a rating.
+	maxFeedbackRunes = 500
+	// defaultFeedbackDays is the period /feedback stats covers.
+	defaultFeedbackDays = 30
+	// maxReportDownvotes bounds the downvoted requests a report lists.
+	maxReportDownvotes = 10
+)
+
+// SetFeedbackButtons turns the 👍/👎 buttons under result cards on or off;
+// /feedback works either way.
+func (r *Router) SetFeedbackButtons(on bool) {
+	r.feedbackButtons = on
+}
+
+// feedbackButtons returns the rating buttons for execution id.
+func feedbackButtons(id string) []CardButton {
+	return []CardButton{
+		{Text: "👍", Command: "/feedback " + id + " up"},
+		{Text: "👎", Command: "/feedback " + id + " down"},
+	}
+}
+
+// parseRating recognizes a rating word.
+func parseRating(word string) (string, bool) {
+	switch strings.ToLower(word) {
+	case "up", "👍", "+1", "good", "好":
+		return ratingUp, true
+	case "down", "👎", "-1", "bad", "差":
+		return ratingDown, true
+	}
+	return "", false
+}
+
+func ratingEmoji(rating string) string {
+	if rating == ratingDown {
+		return "👎"
+	}
+	return "👍"
+}
+
+// cmdFeedback rates an execution (the chat's latest by default) and/or
+// stores a comment with it, or shows the feedback statistics.
+func (r *Router) cmdFeedback(ctx context.Context, chatID, args string) {
+	usage := "用法: /feedback [执行ID] up|down [说明]\n       /feedback [执行ID] <说明>\n       /feedback stats [天数]\n评价一次执行（默认最近一次）：up/👍 或 down/👎，可附说明；反馈随执行记录保存，并出现在 /audit csv 和 /report week 中。"
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		r.sender.SendText(ctx, chatID, usage)
+		return
+	}
+	if fields[0] == "stats" {
+		r.feedbackStats(ctx, chatID, fields[1:])
+		return
+	}
+
+	var rec ExecRecord
+	rest := strings.TrimSpace(args)
+	if other, ok := r.store.ExecRecord(fields[0]); ok && other.ChatID == chatID {
+		rec = other
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, fields[0]))
+	} else if recs := r.store.ExecRecords(chatID, 1); len(recs) == 1 {
+		rec = recs[0]
+	} else {
+		r.sender.SendText(ctx, chatID, "当前聊天还没有执行记录。")
+		return
+	}
+	word, comment, _ := strings.Cut(rest, " ")
+	rating, ok := parseRating(word)
+	if !ok {
+		comment = rest
+	}
+	comment = truncateRunes(strings.TrimSpace(comment), maxFeedbackRunes)
+	if rating == "" && comment == "" {
+		r.sender.SendText(ctx, chatID, usage)
+		return
+	}
+
+	user := userIDFrom(ctx)
+	r.store.UpdateExecRecord(rec.ID, func(e *ExecRecord) {
+		if rating != "" {
+			e.Rating = rating
+		}
+		if comment != "" {
+			e.Feedback = comment
+		}
+		e.FeedbackBy = user
+		e.FeedbackAt = time.Now()
+	})
+	r.save()
+	slog.InfoContext(ctx, "feedback: recorded", "chat_id", chatID, "exec_id", rec.ID, "rating", rating, "comment_chars", len(comment))
+
+	msg := fmt.Sprintf("✓ 已记录对执行 %s 的反馈", rec.ID)
+	if rating != "" {
+		msg += " " + ratingEmoji(rating)
+	}
+	if rating == ratingDown && comment == "" {
+		msg += fmt.Sprintf("\n可以补充原因，帮助改进: /feedback %s <说明>", rec.ID)
+	}
+	r.sender.SendText(ctx, chatID, msg)
+}
+
+// feedbackTally counts ratings.
+type feedbackTally struct {
+	Up, Down int
+}
+
+func (t feedbackTally) String() string {
+	s := fmt.Sprintf("👍 %d · 👎 %d", t.Up, t.Down)
+	if n := t.Up + t.Down; n > 0 {
+		s += fmt.Sprintf("（好评率 %d%%）", t.Up*100/n)
+	}
+	return s
+}
+
+func (t *feedbackTally) add(rating string) {
+	switch rating {
+	case ratingUp:
+		t.Up++
+	case ratingDown:
+		t.Down++
+	}
+}
+
+// feedbackSummary aggregates the rated executions among recs: overall, by
+// label (unlabeled ones under "未标记") and the downvoted ones, newest
+// first.
+type feedbackSummary struct {
+	Total     feedbackTally
+	ByLabel   map[string]*feedbackTally
+	Downvoted []ExecRecord
+}
+
+func summarizeFeedback(recs []ExecRecord) feedbackSummary {
+	s := feedbackSummary{ByLabel: make(map[string]*feedbackTally)}
+	for _, rec := range recs {
+		if rec.Rating == "" {
+			continue
+		}
+		s.Total.add(rec.Rating)
+		labels := rec.Labels
+		if len(labels) == 0 {
+			labels = []string{"未标记"}
+		}
+		for _, l := range labels {
+			if s.ByLabel[l] == nil {
+				s.ByLabel[l] = &feedbackTally{}
+			}
+			s.ByLabel[l].add(rec.Rating)
+		}
+		if rec.Rating == ratingDown {
+			s.Downvoted = append(s.Downvoted, rec)
+		}
+	}
+	return s
+}
+
+// Markdown renders the summary: totals, by label, and the downvoted
+// requests with their comments.
+func (s feedbackSummary) Markdown() string {
+	if s.Total.Up+s.Total.Down == 0 {
+		return "（无）\n"
+	}
+	var sb strings.Builder
+	sb.WriteString(s.Total.String() + "\n")
+	labels := make([]string, 0, len(s.ByLabel))
+	for l := range s.ByLabel {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		a, b := s.ByLabel[labels[i]], s.ByLabel[labels[j]]
+		if a.Up+a.Down != b.Up+b.Down {
+			return a.Up+a.Down > b.Up+b.Down
+		}
+		return labels[i] < labels[j]
+	})
+	if len(labels) > 1 || labels[0] != "未标记" {
+		sb.WriteString("\n按标签:\n")
+		for _, l := range labels {
+			fmt.Fprintf(&sb, "- %s: %s\n", l, s.ByLabel[l])
+		}
+	}
+	if len(s.Downvoted) > 0 {
+		sb.WriteString("\n差评的请求:\n")
+		for i, rec := range s.Downvoted {
+			if i == maxReportDownvotes {
+				fmt.Fprintf(&sb, "- ……另有 %d 条\n", len(s.Downvoted)-maxReportDownvotes)
+				break
+			}
+			line := fmt.Sprintf("- 「%s」", truncateRunes(strings.Join(strings.Fields(rec.Prompt), " "), 60))
+			if rec.Feedback != "" {
+				line += "：" + truncateRunes(strings.Join(strings.Fields(rec.Feedback), " "), 120)
+			}
+			sb.WriteString(line + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// feedbackStats shows the feedback of all chats over the last days.
+func (r *Router) feedbackStats(ctx context.Context, chatID string, args []string) {
+	days := defaultFeedbackDays
+	if len(args) == 1 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			r.sender.SendText(ctx, chatID, "用法: /feedback stats [天数]")
+			return
+		}
+		days = n
+	} else if len(args) > 1 {
+		r.sender.SendText(ctx, chatID, "用法: /feedback stats [天数]")
+		return
+	}
+	since := time.Now().AddDate(0, 0, -days)
+	var recs []ExecRecord
+	for _, rec := range r.store.ExecRecords("", 0) {
+		if !rec.StartedAt.Before(since) {
+			recs = append(recs, rec)
+		}
+	}
+	s := summarizeFeedback(recs)
+	if s.Total.Up+s.Total.Down == 0 {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("最近 %d 天没有收到反馈。", days))
+		return
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("用户反馈（最近 %d 天）", days), Content: s.Markdown() + "\n用 `/label` 给执行加标签，可按类型比较好评率。"})
+}
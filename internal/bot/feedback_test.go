@@ -0,0 +1,144 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRouterExecClaude_FeedbackButtons(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "claude")
+	os.WriteFile(script, []byte("#!/bin/sh\necho '{\"type\":\"result\",\"result\":\"done\",\"session_id\":\"s1\"}'\n"), 0755)
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	sender := &cardSpySender{}
+	r := NewRouter(context.Background(), NewClaudeExecutor(script, "sonnet", 10*time.Second), store, sender, map[string]bool{"user1": true}, dir, nil)
+
+	r.Route(context.Background(), "chat1", "user1", "hello")
+	recs := r.store.ExecRecords("chat1", 1)
+	if len(sender.cards) != 1 || len(recs) != 1 {
+		t.Fatalf("expected one result card and record, got %+v %+v", sender.cards, recs)
+	}
+	buttons := sender.cards[0].Buttons
+	if len(buttons) != 2 || buttons[0].Command != "/feedback "+recs[0].ID+" up" || buttons[1].Command != "/feedback "+recs[0].ID+" down" {
+		t.Fatalf("unexpected buttons %+v", buttons)
+	}
+
+	r.SetFeedbackButtons(false)
+	r.Route(context.Background(), "chat1", "user1", "again")
+	if got := sender.cards[len(sender.cards)-1].Buttons; len(got) != 0 {
+		t.Fatalf("expected no buttons when disabled, got %+v", got)
+	}
+}
+
+func TestRouterFeedback(t *testing.T) {
+	r, sender := newTestRouter(t)
+	ctx := context.Background()
+	r.Route(ctx, "chat1", "user1", "/feedback up")
+	if sender.LastMessage() != "当前聊天还没有执行记录。" {
+		t.Fatalf("expected no records, got %q", sender.LastMessage())
+	}
+
+	now := time.Now()
+	r.store.AddExecRecord(ExecRecord{ID: "e1", ChatID: "chat1", Prompt: "fix the login bug", StartedAt: now.Add(-time.Hour)})
+	r.store.AddExecRecord(ExecRecord{ID: "e2", ChatID: "chat1", Prompt: "write tests", StartedAt: now})
+	r.store.AddExecRecord(ExecRecord{ID: "o1", ChatID: "chat2", Prompt: "other", StartedAt: now})
+
+	r.Route(ctx, "chat1", "user1", "/feedback 👍")
+	if rec, _ := r.store.ExecRecord("e2"); rec.Rating != ratingUp || rec.FeedbackBy != "user1" || rec.FeedbackAt.IsZero() {
+		t.Fatalf("expected the latest execution rated, got %+v", rec)
+	}
+	if msg := sender.LastMessage(); msg != "✓ 已记录对执行 e2 的反馈 👍" {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/feedback e1 down")
+	if !strings.Contains(sender.LastMessage(), "/feedback e1 <说明>") {
+		t.Fatalf("expected a prompt for a reason, got %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "user1", "/feedback e1 changed the wrong file")
+	if rec, _ := r.store.ExecRecord("e1"); rec.Rating != ratingDown || rec.Feedback != "changed the wrong file" {
+		t.Fatalf("expected the comment added to the rating, got %+v", rec)
+	}
+
+	// Another chat's execution ID is not accepted; the text is a comment on
+	// this chat's latest execution.
+	r.Route(ctx, "chat1", "user1", "/feedback o1 down")
+	if rec, _ := r.store.ExecRecord("o1"); rec.Rating != "" {
+		t.Fatalf("expected another chat's record untouched, got %+v", rec)
+	}
+	if rec, _ := r.store.ExecRecord("e2"); rec.Rating != ratingUp || rec.Feedback != "o1 down" {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/feedback stats")
+	msg := sender.LastMessage()
+	for _, want := range []string{"用户反馈（最近 30 天）", "👍 1 · 👎 1（好评率 50%）", "「fix the login bug」：changed the wrong file"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("stats missing %q:\n%s", want, msg)
+		}
+	}
+	r.Route(ctx, "chat1", "user1", "/feedback stats x")
+	if !strings.HasPrefix(sender.LastMessage(), "用法: /feedback stats") {
+		t.Fatalf("expected usage, got %q", sender.LastMessage())
+	}
+}
+
+func TestFeedbackSummary_ByLabel(t *testing.T) {
+	s := summarizeFeedback([]ExecRecord{
+		{Prompt: "a", Rating: ratingUp, Labels: []string{"refactor"}},
+		{Prompt: "b", Rating: ratingDown, Labels: []string{"refactor"}},
+		{Prompt: "c", Rating: ratingUp, Labels: []string{"refactor", "tests"}},
+		{Prompt: "d"},
+	})
+	md := s.Markdown()
+	for _, want := range []string{"👍 2 · 👎 1（好评率 66%）", "- refactor: 👍 2 · 👎 1", "- tests: 👍 1 · 👎 0（好评率 100%）", "- 「b」"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("summary missing %q:\n%s", want, md)
+		}
+	}
+	if strings.Index(md, "refactor") > strings.Index(md, "tests") {
+		t.Errorf("expected the busiest label first:\n%s", md)
+	}
+	if got := summarizeFeedback(nil).Markdown(); got != "（无）\n" {
+		t.Fatalf("unexpected empty summary %q", got)
+	}
+}
+
+func TestRouterAuditCSV_Feedback(t *testing.T) {
+	r, _ := newTestRouter(t)
+	sender := &fileSpySender{}
+	r.sender = sender
+	r.store.AddExecRecord(ExecRecord{ID: "e1", ChatID: "chat1", Prompt: "p", StartedAt: time.Now(), Rating: ratingDown, Feedback: "too slow"})
+	r.Route(context.Background(), "chat1", "user1", "/audit csv")
+	var data string
+	for name, d := range sender.files {
+		if strings.HasPrefix(name, "audit-") {
+			data = string(d)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(data), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], ",rating,feedback,template") || !strings.HasSuffix(lines[1], ",down,too slow,") {
+		t.Fatalf("unexpected csv %q", data)
+	}
+}
+
+func TestCollectWeeklyStats_Feedback(t *testing.T) {
+	r, _, now := newReportRouter(t, "claude")
+	r.store.UpdateExecRecord("e1", func(e *ExecRecord) { e.Rating = ratingUp })
+	r.store.UpdateExecRecord("e2", func(e *ExecRecord) { e.Rating, e.Feedback = ratingDown, "timed out again" })
+	r.store.UpdateExecRecord("old", func(e *ExecRecord) { e.Rating = ratingDown })
+	st := r.collectWeeklyStats(now)
+	if st.Feedback.Total != (feedbackTally{Up: 1, Down: 1}) || st.Repos[0].Feedback != (feedbackTally{Up: 1, Down: 1}) {
+		t.Fatalf("unexpected feedback %+v %+v", st.Feedback.Total, st.Repos[0].Feedback)
+	}
+	md := st.Markdown()
+	for _, want := range []string{"提交 2 个，👍 1 · 👎 1（好评率 50%）", "## 用户反馈\n👍 1 · 👎 1", "：timed out again"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected %q in report:\n%s", want, md)
+		}
+	}
+}
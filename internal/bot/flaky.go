@@ -0,0 +1,214 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxTestHistory is how many recent results are kept per test.
+	maxTestHistory = 20
+	// flakyWindow is how many recent results flakiness is judged on.
+	flakyWindow = 10
+)
+
+// goTestEvent is one line of `go test -json` output.
+type goTestEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Output  string
+}
+
+// goTestArgs builds `go test -json` arguments: only tests matching run
+// when it is set, skipping the tests named in skip.
+func goTestArgs(run string, skip []string, pkgs ...string) []string {
+	args := []string{"test", "-json"}
+	if run != "" {
+		args = append(args, "-run", run)
+	}
+	if len(skip) > 0 {
+		args = append(args, "-skip", testNamesPattern(skip))
+	}
+	return append(args, pkgs...)
+}
+
+// testNamesPattern is the -run/-skip pattern matching exactly the
+// top-level tests named.
+func testNamesPattern(names []string) string {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = regexp.QuoteMeta(n)
+	}
+	return "^(" + strings.Join(quoted, "|") + ")$"
+}
+
+// runGoTests runs `go` with args (from goTestArgs) in workDir. It returns
+// the output as plain `go test` would print it (as with -v when verbose)
+// and the result of each top-level test that ran, keyed "pkg.TestName".
+func runGoTests(ctx context.Context, workDir string, args []string, verbose bool) (output string, results map[string]bool, err error) {
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = workDir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	output, results = renderGoTestJSON(stdout.String(), verbose)
+	return strings.TrimSpace(cleanTerminal(stderr.String() + output)), results, err
+}
+
+// renderGoTestJSON turns `go test -json` output back into text: package
+// lines plus the output of failed tests, or everything when verbose.
+func renderGoTestJSON(stream string, verbose bool) (string, map[string]bool) {
+	results := make(map[string]bool)
+	buffered := make(map[string][]string)
+	var sb strings.Builder
+	for _, line := range strings.Split(stream, "\n") {
+		var ev goTestEvent
+		if line == "" {
+			continue
+		}
+		if json.Unmarshal([]byte(line), &ev) != nil || ev.Action == "" {
+			sb.WriteString(line + "\n")
+			continue
+		}
+		top, _, _ := strings.Cut(ev.Test, "/")
+		key := ev.Package + "." + top
+		switch {
+		case ev.Action == "output" && ev.Test == "":
+			if verbose || strings.TrimSpace(ev.Output) != "PASS" {
+				sb.WriteString(ev.Output)
+			}
+		case ev.Action == "output":
+			if verbose {
+				sb.WriteString(ev.Output)
+			} else if !strings.HasPrefix(ev.Output, "=== ") {
+				buffered[key] = append(buffered[key], ev.Output)
+			}
+		case (ev.Action == "pass" || ev.Action == "fail") && ev.Test == top && top != "":
+			results[key] = ev.Action == "pass"
+			if ev.Action == "fail" {
+				sb.WriteString(strings.Join(buffered[key], ""))
+			}
+			delete(buffered, key)
+		}
+	}
+	return sb.String(), results
+}
+
+// isFlaky reports whether a test's history ("P"/"F" per run, oldest
+// first) flipped between passing and failing at least twice recently.
+func isFlaky(history string) bool {
+	if len(history) > flakyWindow {
+		history = history[len(history)-flakyWindow:]
+	}
+	flips := 0
+	for i := 1; i < len(history); i++ {
+		if history[i] != history[i-1] {
+			flips++
+		}
+	}
+	return flips >= 2
+}
+
+// testHealthNote runs the quarantined tests of repo on their own, records
+// every test result of the run in the repo's history and returns card
+// markdown reporting the quarantined results and the tests that look
+// flaky. The quarantined run never fails the main result.
+func (r *Router) testHealthNote(ctx context.Context, repo, workDir string, results map[string]bool, quarantined []string) string {
+	var sb strings.Builder
+	if len(quarantined) > 0 {
+		_, qResults, _ := runGoTests(ctx, workDir, goTestArgs(testNamesPattern(quarantined), nil, "./..."), false)
+		sb.WriteString("\n\n**隔离的测试（单独运行，不计入结果）:**")
+		if len(qResults) == 0 {
+			sb.WriteString(" 均未运行（测试已不存在？）")
+		}
+		for _, key := range sortedKeys(qResults) {
+			mark := "✓"
+			if !qResults[key] {
+				mark = "✗"
+			}
+			fmt.Fprintf(&sb, "\n- %s `%s`", mark, key)
+			results[key] = qResults[key]
+		}
+	}
+	if len(results) == 0 {
+		return sb.String()
+	}
+
+	r.store.RecordTestResults(repo, results)
+	r.save()
+	history := r.store.TestHistory(repo)
+	isQuarantined := make(map[string]bool)
+	for _, name := range quarantined {
+		isQuarantined[name] = true
+	}
+	var flaky []string
+	for _, key := range sortedKeys(results) {
+		name := key[strings.LastIndex(key, ".")+1:]
+		if isFlaky(history[key]) && !isQuarantined[name] {
+			h := history[key]
+			if len(h) > flakyWindow {
+				h = h[len(h)-flakyWindow:]
+			}
+			flaky = append(flaky, fmt.Sprintf("- `%s` 最近 %d 次: %s", key, len(h), strings.NewReplacer("P", "✓", "F", "✗").Replace(h)))
+		}
+	}
+	if len(flaky) > 0 {
+		sb.WriteString("\n\n**⚠️ 不稳定的测试（结果反复变化）:**\n" + strings.Join(flaky, "\n"))
+		sb.WriteString("\n使用 `/test quarantine add <测试名>` 隔离，之后单独运行，不影响主结果。")
+	}
+	return sb.String()
+}
+
+// cmdTestQuarantine shows or edits the quarantine list of the current
+// repository: top-level Go tests /test runs separately from the rest.
+func (r *Router) cmdTestQuarantine(ctx context.Context, chatID, workDir, args string) {
+	repo := repoRoot(workDir)
+	names := r.store.QuarantinedTests(repo)
+	sub, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	tests := strings.Fields(rest)
+	switch {
+	case sub == "":
+		if len(names) == 0 {
+			r.sender.SendText(ctx, chatID, "当前仓库没有隔离的测试。\n用法: /test quarantine add|rm <测试名>...")
+			return
+		}
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("隔离的测试（%s）:\n%s", repo, strings.Join(names, "\n")))
+		return
+	case (sub == "add" || sub == "rm") && len(tests) > 0:
+	default:
+		r.sender.SendText(ctx, chatID, "用法: /test quarantine [add|rm <测试名>...]\n隔离的测试不随 /test 主结果运行，而是单独运行并报告，失败不影响主结果。")
+		return
+	}
+
+	set := make(map[string]bool)
+	for _, n := range names {
+		set[n] = true
+	}
+	for _, t := range tests {
+		// Accept "pkg.TestName" as shown in the flaky report.
+		t = t[strings.LastIndex(t, ".")+1:]
+		set[t] = sub == "add"
+	}
+	names = names[:0]
+	for n, on := range set {
+		if on {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	r.store.SetQuarantinedTests(repo, names)
+	r.save()
+	if len(names) == 0 {
+		r.sender.SendText(ctx, chatID, "✓ 已清空隔离列表。")
+		return
+	}
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 隔离的测试: %s", strings.Join(names, ", ")))
+}
@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderGoTestJSON(t *testing.T) {
+	stream := `{"Action":"run","Package":"m/a","Test":"TestOK"}
+{"Action":"output","Package":"m/a","Test":"TestOK","Output":"=== RUN   TestOK\n"}
+{"Action":"output","Package":"m/a","Test":"TestOK","Output":"--- PASS: TestOK (0.00s)\n"}
+{"Action":"pass","Package":"m/a","Test":"TestOK"}
+{"Action":"output","Package":"m/a","Test":"TestBad/sub","Output":"    bad_test.go:9: boom\n"}
+{"Action":"fail","Package":"m/a","Test":"TestBad/sub"}
+{"Action":"output","Package":"m/a","Test":"TestBad","Output":"--- FAIL: TestBad (0.00s)\n"}
+{"Action":"fail","Package":"m/a","Test":"TestBad"}
+{"Action":"output","Package":"m/a","Output":"FAIL\n"}
+{"Action":"output","Package":"m/a","Output":"FAIL\tm/a\t0.010s\n"}
+{"Action":"fail","Package":"m/a"}`
+	out, results := renderGoTestJSON(stream, false)
+	want := "    bad_test.go:9: boom\n--- FAIL: TestBad (0.00s)\nFAIL\nFAIL\tm/a\t0.010s\n"
+	if out != want {
+		t.Fatalf("output = %q, want %q", out, want)
+	}
+	if len(results) != 2 || !results["m/a.TestOK"] || results["m/a.TestBad"] {
+		t.Fatalf("results = %v", results)
+	}
+	if verbose, _ := renderGoTestJSON(stream, true); !strings.Contains(verbose, "--- PASS: TestOK") {
+		t.Fatalf("verbose output = %q", verbose)
+	}
+}
+
+func TestIsFlaky(t *testing.T) {
+	for h, want := range map[string]bool{
+		"":                     false,
+		"PPPP":                 false,
+		"PPFF":                 false,
+		"PFP":                  true,
+		"FFPPPPPPPPPPPPF":      false, // the early flip is outside the window
+		"PPPPPPPPPPPPPPPPPFPF": true,
+	} {
+		if got := isFlaky(h); got != want {
+			t.Errorf("isFlaky(%q) = %v, want %v", h, got, want)
+		}
+	}
+}
+
+func TestStoreTestHistory(t *testing.T) {
+	s, _ := NewStore(filepath.Join(t.TempDir(), "state.json"))
+	for i := 0; i < maxTestHistory+5; i++ {
+		s.RecordTestResults("/repo", map[string]bool{"m.TestA": i%2 == 0})
+	}
+	if h := s.TestHistory("/repo")["m.TestA"]; len(h) != maxTestHistory || !strings.HasSuffix(h, "PFP") {
+		t.Fatalf("history = %q", h)
+	}
+	s.SetQuarantinedTests("/repo", []string{"TestA"})
+	if q := s.QuarantinedTests("/repo"); len(q) != 1 || q[0] != "TestA" {
+		t.Fatalf("quarantine = %v", q)
+	}
+	s.SetQuarantinedTests("/repo", nil)
+	if q := s.QuarantinedTests("/repo"); len(q) != 0 {
+		t.Fatalf("quarantine after clear = %v", q)
+	}
+}
+
+func TestRouterTest_FlakyAndQuarantine(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module flakypkg\n\ngo 1.21\n"), 0644)
+	// TestFlaky fails whenever the marker file exists; TestStable always passes.
+	marker := filepath.Join(dir, "fail-marker")
+	os.WriteFile(filepath.Join(dir, "x_test.go"), []byte(`package flakypkg
+
+import (
+	"os"
+	"testing"
+)
+
+func TestStable(t *testing.T) {}
+
+func TestFlaky(t *testing.T) {
+	if _, err := os.Stat(`+"`"+marker+"`"+`); err == nil {
+		t.Fatal("flaked")
+	}
+}
+`), 0644)
+
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	sender := &cardSpySender{}
+	ex := NewClaudeExecutor("claude", "sonnet", 10*time.Second)
+	r := NewRouter(context.Background(), ex, store, sender, map[string]bool{"user1": true}, dir, nil)
+	ctx := context.Background()
+
+	for _, fail := range []bool{false, true, false} {
+		if fail {
+			os.WriteFile(marker, nil, 0644)
+		} else {
+			os.Remove(marker)
+		}
+		r.Route(ctx, "chat1", "user1", "/test")
+	}
+	last := sender.cards[len(sender.cards)-1]
+	if !strings.Contains(last.Content, "不稳定的测试") || !strings.Contains(last.Content, "flakypkg.TestFlaky") || strings.Contains(last.Content, "flakypkg.TestStable") {
+		t.Fatalf("flaky report = %q", last.Content)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/test quarantine add flakypkg.TestFlaky")
+	os.WriteFile(marker, nil, 0644)
+	r.Route(ctx, "chat1", "user1", "/test")
+	last = sender.cards[len(sender.cards)-1]
+	if last.Template != "green" {
+		t.Fatalf("quarantined failure should not fail the run: %+v", last)
+	}
+	if !strings.Contains(last.Content, "✗ `flakypkg.TestFlaky`") || strings.Contains(last.Content, "不稳定的测试") {
+		t.Fatalf("quarantine report = %q", last.Content)
+	}
+}
@@ -0,0 +1,313 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxFocusFiles is how many relevant files are suggested for a prompt.
+	maxFocusFiles = 8
+	// maxFocusScanFiles bounds how many files are searched per prompt.
+	maxFocusScanFiles = 5000
+	// maxFocusFileSize skips files too large to be worth searching.
+	maxFocusFileSize = 1 << 20
+	// maxFocusKeywords bounds how many prompt keywords are searched for.
+	maxFocusKeywords = 12
+	// pendingFocusTTL is how long a file selection waits for an answer.
+	pendingFocusTTL = time.Hour
+)
+
+var focusWordRe = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]{2,}`)
+
+// focusStopwords are common words that say nothing about which files a
+// prompt is about.
+var focusStopwords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "this": true, "that": true,
+	"from": true, "into": true, "are": true, "was": true, "but": true, "not": true,
+	"all": true, "any": true, "can": true, "how": true, "why": true, "what": true,
+	"when": true, "where": true, "which": true, "should": true, "would": true,
+	"could": true, "please": true, "add": true, "fix": true, "make": true,
+	"use": true, "using": true, "update": true, "change": true, "remove": true,
+	"code": true, "file": true, "files": true, "function": true, "bug": true,
+	"test": true, "tests": true, "new": true, "also": true, "does": true,
+	"there": true, "them": true, "then": true, "than": true, "have": true,
+	"has": true, "will": true, "just": true, "like": true, "some": true,
+}
+
+// focusKeywords extracts the identifiers in prompt worth searching for,
+// lower-cased and in order of first appearance.
+func focusKeywords(prompt string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, w := range focusWordRe.FindAllString(prompt, -1) {
+		w = strings.ToLower(w)
+		if focusStopwords[w] || seen[w] {
+			continue
+		}
+		seen[w] = true
+		out = append(out, w)
+		if len(out) == maxFocusKeywords {
+			break
+		}
+	}
+	return out
+}
+
+// focusCandidates lists the files under workDir to search: the tracked and
+// untracked-but-not-ignored files of a git repository, or otherwise every
+// file outside hidden, node_modules and vendor directories.
+func focusCandidates(workDir string) []string {
+	if out, err := runGitOutput(workDir, "ls-files", "--cached", "--others", "--exclude-standard"); err == nil {
+		if out == "" {
+			return nil
+		}
+		files := strings.Split(out, "\n")
+		if len(files) > maxFocusScanFiles {
+			files = files[:maxFocusScanFiles]
+		}
+		return files
+	}
+	var files []string
+	filepath.Walk(workDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		name := info.Name()
+		if info.IsDir() {
+			if p != workDir && (strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, _ := filepath.Rel(workDir, p)
+		files = append(files, rel)
+		if len(files) == maxFocusScanFiles {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return files
+}
+
+// focusFile is a file suggested as relevant to a prompt.
+type focusFile struct {
+	Path    string   // relative to the workdir
+	Matches []string // the prompt keywords it contains
+	score   int
+}
+
+// relevantFiles ranks the files under workDir by how many of the prompt's
+// keywords they mention, weighting matches in the path. It returns at most
+// maxFocusFiles files, best first.
+func relevantFiles(workDir, prompt string) []focusFile {
+	keywords := focusKeywords(prompt)
+	if len(keywords) == 0 || workDir == "" {
+		return nil
+	}
+	var ranked []focusFile
+	for _, rel := range focusCandidates(workDir) {
+		full := filepath.Join(workDir, rel)
+		info, err := os.Stat(full)
+		if err != nil || !info.Mode().IsRegular() || info.Size() > maxFocusFileSize {
+			continue
+		}
+		data, err := os.ReadFile(full)
+		if err != nil || bytes.IndexByte(data, 0) >= 0 {
+			continue
+		}
+		content := bytes.ToLower(data)
+		path := strings.ToLower(rel)
+		f := focusFile{Path: rel}
+		for _, kw := range keywords {
+			hits := bytes.Count(content, []byte(kw))
+			inPath := strings.Contains(path, kw)
+			if hits == 0 && !inPath {
+				continue
+			}
+			f.Matches = append(f.Matches, kw)
+			f.score += 10
+			if inPath {
+				f.score += 5
+			}
+			if hits > 5 {
+				hits = 5
+			}
+			f.score += hits
+		}
+		if f.score > 0 {
+			ranked = append(ranked, f)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return ranked[i].Path < ranked[j].Path
+	})
+	if len(ranked) > maxFocusFiles {
+		ranked = ranked[:maxFocusFiles]
+	}
+	return ranked
+}
+
+// focusPrompt appends the selected files to prompt as a starting point
+// for Claude.
+func focusPrompt(prompt string, files []focusFile) string {
+	if len(files) == 0 {
+		return prompt
+	}
+	var sb strings.Builder
+	sb.WriteString(prompt)
+	sb.WriteString("\n\n[devbot 相关文件] 以下文件可能与本任务相关，可以先从这些文件开始查看：\n")
+	for _, f := range files {
+		fmt.Fprintf(&sb, "- %s\n", f.Path)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// pendingFocus is a prompt waiting for the user to review its suggested
+// files.
+type pendingFocus struct {
+	chatID  string
+	prompt  string
+	files   []focusFile
+	created time.Time
+}
+
+// submitFocused suggests relevant files for a prompt when the chat has
+// /focus on, and waits for the user to prune and send them. Otherwise, or
+// when nothing relevant is found, the prompt is submitted directly.
+func (r *Router) submitFocused(ctx context.Context, chatID, prompt string) {
+	session := r.getSession(chatID)
+	if !session.Focus {
+		r.submitChecked(ctx, chatID, prompt, execOptions{})
+		return
+	}
+	workDir, _, _, _ := r.store.SessionExecParams(chatID)
+	files := relevantFiles(workDir, prompt)
+	if len(files) == 0 {
+		r.submitChecked(ctx, chatID, prompt, execOptions{})
+		return
+	}
+	id := newExecID()
+	p := &pendingFocus{chatID: chatID, prompt: prompt, files: files, created: time.Now()}
+	r.mu.Lock()
+	for k, old := range r.pendingFocus {
+		if time.Since(old.created) > pendingFocusTTL {
+			delete(r.pendingFocus, k)
+		}
+	}
+	r.pendingFocus[id] = p
+	r.mu.Unlock()
+	slog.InfoContext(ctx, "router: prompt awaiting file selection", "exec_id", id, "chat_id", chatID, "files", len(files))
+	r.sendFocusCard(ctx, id, chatID, prompt, files)
+}
+
+// sendFocusCard shows the files suggested for a waiting prompt, with a
+// button to drop each.
+func (r *Router) sendFocusCard(ctx context.Context, id, chatID, prompt string, files []focusFile) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**Prompt:** %s\n\n", truncateRunes(strings.Join(strings.Fields(prompt), " "), 100))
+	if len(files) == 0 {
+		sb.WriteString("已移除全部文件。\n")
+	}
+	for i, f := range files {
+		fmt.Fprintf(&sb, "%d. `%s` — %s\n", i+1, f.Path, strings.Join(f.Matches, ", "))
+	}
+	fmt.Fprintf(&sb, "\n发送时会把这些文件告诉 Claude。`/focus drop %s <序号>` 移除文件，`/focus go %s` 发送，`/focus skip %s` 不附文件直接发送，`/focus cancel %s` 取消。", id, id, id, id)
+	var buttons []CardButton
+	for i := range files {
+		buttons = append(buttons, CardButton{Text: fmt.Sprintf("移除 %d", i+1), Command: fmt.Sprintf("/focus drop %s %d", id, i+1)})
+	}
+	buttons = append(buttons,
+		CardButton{Text: "发送", Command: "/focus go " + id, Type: "primary"},
+		CardButton{Text: "不附文件发送", Command: "/focus skip " + id},
+		CardButton{Text: "取消", Command: "/focus cancel " + id},
+	)
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: "🔎 相关文件", Content: sb.String(), Buttons: buttons})
+}
+
+// cmdFocus answers /focus: "on" and "off" toggle file suggestions for the
+// chat; go, skip, drop and cancel answer a suggestion card.
+func (r *Router) cmdFocus(ctx context.Context, chatID, args string) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		state := "关闭"
+		if r.getSession(chatID).Focus {
+			state = "开启"
+		}
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("相关文件检索: %s\n用法: /focus on|off\n开启后每条 prompt 执行前会先按关键词检索工作目录，列出可能相关的文件供确认，再随 prompt 告诉 Claude。", state))
+		return
+	}
+	switch fields[0] {
+	case "on", "off":
+		on := fields[0] == "on"
+		r.getSession(chatID) // ensure session exists
+		r.store.UpdateSession(chatID, func(s *Session) {
+			s.Focus = on
+		})
+		r.save()
+		if on {
+			r.sender.SendText(ctx, chatID, "✓ 已开启相关文件检索：执行前会先列出可能相关的文件供确认。")
+		} else {
+			r.sender.SendText(ctx, chatID, "✓ 已关闭相关文件检索。")
+		}
+		return
+	case "go", "skip", "cancel", "drop":
+	default:
+		r.sender.SendText(ctx, chatID, "用法: /focus on|off")
+		return
+	}
+	if len(fields) < 2 {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("用法: /focus %s <ID>", fields[0]))
+		return
+	}
+	id := fields[1]
+	r.mu.Lock()
+	p := r.pendingFocus[id]
+	if p == nil || p.chatID != chatID {
+		r.mu.Unlock()
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("没有等待确认的文件列表: %s（可能已发送、取消或过期）", id))
+		return
+	}
+	if fields[0] == "drop" {
+		n := 0
+		if len(fields) > 2 {
+			n, _ = strconv.Atoi(fields[2])
+		}
+		if n < 1 || n > len(p.files) {
+			r.mu.Unlock()
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("无效的序号，应为 1-%d", len(p.files)))
+			return
+		}
+		p.files = append(p.files[:n-1:n-1], p.files[n:]...)
+		files := append([]focusFile(nil), p.files...)
+		r.mu.Unlock()
+		r.sendFocusCard(ctx, id, chatID, p.prompt, files)
+		return
+	}
+	delete(r.pendingFocus, id)
+	r.mu.Unlock()
+
+	switch fields[0] {
+	case "cancel":
+		r.sender.SendText(ctx, chatID, "已取消。")
+	case "skip":
+		r.submitChecked(ctx, chatID, p.prompt, execOptions{})
+	default:
+		r.submitChecked(ctx, chatID, focusPrompt(p.prompt, p.files), execOptions{})
+	}
+}
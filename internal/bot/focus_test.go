@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFocusKeywords(t *testing.T) {
+	got := focusKeywords("Please fix the retry bug in handleWebhook and the Retry counter; 修复 ok")
+	if strings.Join(got, ",") != "retry,handlewebhook,counter" {
+		t.Fatalf("unexpected keywords %v", got)
+	}
+}
+
+func TestRelevantFiles(t *testing.T) {
+	workDir := t.TempDir()
+	os.MkdirAll(filepath.Join(workDir, "webhook"), 0755)
+	os.MkdirAll(filepath.Join(workDir, "node_modules", "x"), 0755)
+	os.WriteFile(filepath.Join(workDir, "webhook", "handler.go"), []byte("func handleWebhook() { retry() }\n"), 0644)
+	os.WriteFile(filepath.Join(workDir, "retry.go"), []byte("func retry() {}\n"), 0644)
+	os.WriteFile(filepath.Join(workDir, "main.go"), []byte("func main() {}\n"), 0644)
+	os.WriteFile(filepath.Join(workDir, "node_modules", "x", "retry.js"), []byte("retry webhook"), 0644)
+	os.WriteFile(filepath.Join(workDir, "blob.bin"), []byte("retry\x00webhook"), 0644)
+
+	got := relevantFiles(workDir, "make handleWebhook retry on webhook errors")
+	var desc []string
+	for _, f := range got {
+		desc = append(desc, f.Path+"="+strings.Join(f.Matches, "+"))
+	}
+	if strings.Join(desc, ",") != "webhook/handler.go=handlewebhook+retry+webhook,retry.go=retry" {
+		t.Fatalf("unexpected files %v", desc)
+	}
+	if got := relevantFiles(workDir, "修复这个问题"); got != nil {
+		t.Fatalf("expected no files without keywords, got %+v", got)
+	}
+}
+
+// newFocusRouter returns a router with /focus on whose claude records each
+// prompt it runs in the file ran.
+func newFocusRouter(t *testing.T) (*Router, *cardSpySender, string) {
+	t.Helper()
+	dir := t.TempDir()
+	ran := filepath.Join(dir, "ran")
+	claude := filepath.Join(dir, "claude")
+	os.WriteFile(claude, []byte(`#!/bin/sh
+printf '%s\n' "$(cat)" >> `+ran+`
+echo '{"type":"result","result":"ok","session_id":"s1"}'
+`), 0755)
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	sender := &cardSpySender{}
+	r := NewRouter(context.Background(), NewClaudeExecutor(claude, "sonnet", 10*time.Second), store, sender, map[string]bool{"user1": true}, dir, nil)
+	os.WriteFile(filepath.Join(dir, "billing.go"), []byte("func invoice() {}\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "invoice_test.go"), []byte("func TestInvoice() {}\n"), 0644)
+	r.Route(context.Background(), "chat1", "user1", "/focus on")
+	return r, sender, ran
+}
+
+func TestRouterFocus(t *testing.T) {
+	r, sender, ran := newFocusRouter(t)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "explain invoice rounding")
+	if len(sender.cards) == 0 || fileExists(ran) {
+		t.Fatal("expected a file card before running the prompt")
+	}
+	card := sender.cards[len(sender.cards)-1]
+	if !strings.Contains(card.Content, "1. `invoice_test.go`") || !strings.Contains(card.Content, "2. `billing.go`") || len(card.Buttons) != 5 {
+		t.Fatalf("unexpected card %+v", card)
+	}
+	id := regexp.MustCompile(`/focus go (\w+)`).FindStringSubmatch(card.Content)[1]
+
+	r.Route(ctx, "chat1", "user1", "/focus drop "+id+" 1")
+	card = sender.cards[len(sender.cards)-1]
+	if strings.Contains(card.Content, "invoice_test.go") || len(card.Buttons) != 4 {
+		t.Fatalf("expected file dropped, got %+v", card)
+	}
+	r.Route(ctx, "chat1", "user1", "/focus go "+id)
+	data, _ := os.ReadFile(ran)
+	if !strings.Contains(string(data), "explain invoice rounding\n\n[devbot 相关文件]") || !strings.Contains(string(data), "- billing.go") || strings.Contains(string(data), "invoice_test.go") {
+		t.Fatalf("unexpected prompt %q", data)
+	}
+	r.Route(ctx, "chat1", "user1", "/focus go "+id)
+	if msg := sender.texts[len(sender.texts)-1]; !strings.Contains(msg, "没有等待确认的文件列表") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/focus off")
+	r.Route(ctx, "chat1", "user1", "invoice again")
+	if data, _ := os.ReadFile(ran); !strings.Contains(string(data), "invoice again") {
+		t.Fatalf("expected prompt to run directly, got %q", data)
+	}
+}
+
+func TestRouterFocusSkipAndCancel(t *testing.T) {
+	r, sender, ran := newFocusRouter(t)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "rename invoice")
+	id := regexp.MustCompile(`/focus go (\w+)`).FindStringSubmatch(sender.cards[len(sender.cards)-1].Content)[1]
+	r.Route(ctx, "chat1", "user1", "/focus cancel "+id)
+	if fileExists(ran) || sender.texts[len(sender.texts)-1] != "已取消。" {
+		t.Fatal("expected cancelled prompt not to run")
+	}
+
+	r.Route(ctx, "chat1", "user1", "rename invoice")
+	id = regexp.MustCompile(`/focus go (\w+)`).FindStringSubmatch(sender.cards[len(sender.cards)-1].Content)[1]
+	r.Route(ctx, "chat1", "user1", "/focus skip "+id)
+	if data, _ := os.ReadFile(ran); string(data) != "rename invoice\n" {
+		t.Fatalf("expected prompt without files, got %q", data)
+	}
+}
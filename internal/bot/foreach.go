@@ -0,0 +1,290 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// maxForeachDirs bounds how many directories one /foreach visits.
+	maxForeachDirs = 50
+	// foreachTimeout bounds each native command /foreach runs.
+	foreachTimeout = 5 * time.Minute
+)
+
+// foreachCommands are the native commands /foreach can run; anything not
+// starting with "/" is sent to Claude as a prompt.
+var foreachCommands = map[string]bool{"/test": true, "/exec": true, "/git": true, "/pull": true}
+
+// foreachResult is the outcome of one /foreach step.
+type foreachResult struct {
+	Dir     string
+	Output  string
+	Err     error
+	Elapsed time.Duration
+}
+
+// foreachTargets resolves a comma-separated list of directory globs,
+// relative to root, to the matching project directories. Hidden
+// directories, root itself and paths outside it are skipped.
+func foreachTargets(root, spec string) ([]string, error) {
+	seen := make(map[string]bool)
+	var dirs []string
+	for _, pattern := range strings.Split(spec, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(root, pattern)
+		}
+		matches, err := filepath.Glob(filepath.Clean(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("无效的模式 %q: %v", pattern, err)
+		}
+		for _, m := range matches {
+			if info, err := os.Stat(m); err != nil || !info.IsDir() {
+				continue
+			}
+			if seen[m] || m == root || !underRoot(root, m) || strings.HasPrefix(filepath.Base(m), ".") {
+				continue
+			}
+			seen[m] = true
+			dirs = append(dirs, m)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// testCommand picks the test command for the project in dir.
+func testCommand(dir string) []string {
+	switch {
+	case fileExists(filepath.Join(dir, "go.mod")):
+		return []string{"go", "test", "./..."}
+	case fileExists(filepath.Join(dir, "package.json")):
+		return []string{"npm", "test"}
+	case fileExists(filepath.Join(dir, "Cargo.toml")):
+		return []string{"cargo", "test"}
+	case fileExists(filepath.Join(dir, "Makefile")):
+		return []string{"make", "test"}
+	}
+	return nil
+}
+
+func (r *Router) cmdForeach(ctx context.Context, chatID, args string) {
+	spec, command, _ := strings.Cut(args, " ")
+	command = strings.TrimSpace(command)
+	if spec == "" || command == "" {
+		r.sender.SendText(ctx, chatID, "用法: /foreach <目录模式> <命令或 prompt>\n目录模式相对于根目录，可用逗号分隔多个（如 services/* 或 api,web）\n支持的命令: /test /exec /git /pull，其他内容作为 prompt 发送给 Claude\n示例: /foreach services/* /test")
+		return
+	}
+	if strings.HasPrefix(command, "/") {
+		name := strings.ToLower(strings.Fields(command)[0])
+		if !foreachCommands[name] {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("/foreach 不支持 %s，可用: /test /exec /git /pull，或直接写 prompt。", name))
+			return
+		}
+		// The inner command needs the role it needs on its own, so /foreach
+		// cannot get around an admin-only /exec.
+		if r.commandDenied(ctx, chatID, userIDFrom(ctx), name) {
+			return
+		}
+	}
+	root := r.store.WorkRoot()
+	dirs, err := foreachTargets(root, spec)
+	if err != nil {
+		r.sender.SendText(ctx, chatID, err.Error())
+		return
+	}
+	if len(dirs) == 0 {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("根目录 %s 下没有匹配 %s 的目录。", root, spec))
+		return
+	}
+	if len(dirs) > maxForeachDirs {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("匹配到 %d 个目录，超过上限 %d，请缩小范围。", len(dirs), maxForeachDirs))
+		return
+	}
+
+	id := newExecID()
+	if r.queue == nil {
+		r.runForeach(ctx, chatID, id, args, dirs, command)
+		return
+	}
+	r.setQueued(ExecRecord{ID: id, ChatID: chatID, Prompt: "/foreach " + args, StartedAt: time.Now()})
+	pos, err := r.queue.EnqueueTask(chatID, QueueEntry{ID: id}, func() {
+		r.runForeach(r.ctx, chatID, id, args, dirs, command)
+	})
+	if err != nil {
+		r.clearQueued(id)
+		r.sender.SendText(ctx, chatID, "队列已满，请稍后再试。")
+		return
+	}
+	if pos > 1 {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("已排队（第 %d 位）", pos), Content: "当前有任务正在执行，请稍候...", Template: "blue"})
+	}
+}
+
+// runForeach runs command in each of dirs in turn and posts a summary card,
+// failures first.
+func (r *Router) runForeach(ctx context.Context, chatID, id, args string, dirs []string, command string) {
+	r.clearQueued(id)
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("在 %d 个目录中依次执行 %s ...", len(dirs), truncateRunes(command, 60)))
+	_, _, permMode, model := r.store.SessionExecParams(chatID)
+	r.setActive(ExecRecord{ID: id, ChatID: chatID, Prompt: "/foreach " + args, StartedAt: time.Now(), Model: model, PermissionMode: permMode})
+	defer r.clearActive(id)
+
+	var results []foreachResult
+	for _, dir := range dirs {
+		if ctx.Err() != nil {
+			break
+		}
+		start := time.Now()
+		out, err := r.foreachStep(ctx, chatID, dir, command, permMode, model)
+		res := foreachResult{Dir: dir, Output: strings.TrimSpace(out), Err: err, Elapsed: time.Since(start)}
+		slog.WarnContext(ctx, "router: foreach failed", "chat_id", chatID, "dir", dir, "err", err)
+		results = append(results, res)
+	}
+	r.sender.SendCard(ctx, chatID, foreachCard(r.store.WorkRoot(), command, results, len(dirs)))
+}
+
+// foreachStep runs one /foreach command in dir and returns its output.
+func (r *Router) foreachStep(ctx context.Context, chatID, dir, command, permMode, model string) (string, error) {
+	if !strings.HasPrefix(command, "/") {
+		return r.foreachPrompt(ctx, chatID, dir, command, permMode, model)
+	}
+	name, rest, _ := strings.Cut(command, " ")
+	rest = strings.TrimSpace(rest)
+	var argv []string
+	switch strings.ToLower(name) {
+	case "/test":
+		argv = testCommand(dir)
+		if argv == nil {
+			return "", errors.New("未识别的项目类型（需要 go.mod、package.json、Cargo.toml 或 Makefile）")
+		}
+		if rest != "" && argv[0] == "go" {
+			argv = append(argv, "-run", rest)
+		}
+	case "/exec":
+		if rest == "" {
+			return "", errors.New("缺少命令")
+		}
+		if name, ok := r.shellTouchesReferenceDir(dir, rest); ok {
+			return "", fmt.Errorf("命令涉及只读参考目录 %s", name)
+		}
+		if paths := shellDeletions(rest); len(paths) > 0 {
+			r.trashDeletion(ctx, chatID, dir, "exec", paths)
+		}
+		argv = []string{"sh", "-c", rest}
+	case "/git":
+		if rest == "" {
+			return "", errors.New("缺少 git 命令")
+		}
+		argv = append([]string{"git"}, strings.Fields(rest)...)
+	case "/pull":
+		argv = append([]string{"git", "pull"}, strings.Fields(rest)...)
+	}
+	return runInDir(ctx, dir, foreachTimeout, argv...)
+}
+
+// runInDir runs argv in dir with a timeout and returns its combined output,
+// cleaned of terminal escapes.
+func runInDir(ctx context.Context, dir string, timeout time.Duration, argv ...string) (string, error) {
+	execCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(execCtx, argv[0], argv[1:]...)
+	cmd.Dir = dir
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	if execCtx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("超时（%s）", timeout)
+	}
+	return cleanTerminal(out.String()), err
+}
+
+// foreachPrompt runs prompt in dir in a fresh Claude session, recording it
+// in the chat's history like any other execution.
+func (r *Router) foreachPrompt(ctx context.Context, chatID, dir, prompt, permMode, model string) (string, error) {
+	ctx = withDeleteGuard(ctx, func(paths []string, command string) bool {
+		if permMode != "yolo" && !r.confirmDelete(ctx, chatID, paths, command) {
+			return false
+		}
+		r.trashDeletion(ctx, chatID, dir, "claude", paths)
+		return true
+	})
+	rec := ExecRecord{
+		ID:             newExecID(),
+		ChatID:         chatID,
+		Prompt:         prompt,
+		WorkDir:        dir,
+		StartedAt:      time.Now(),
+		Model:          model,
+		PermissionMode: permMode,
+		GitHead:        gitHead(dir),
+	}
+	result, err := r.executor.ExecStream(ctx, prompt, dir, "", permMode, model, nil)
+	rec.Duration = time.Since(rec.StartedAt)
+	rec.SessionID = result.SessionID
+	rec.setResultMeta(result)
+	if err != nil {
+		rec.Error = err.Error()
+	} else {
+		rec.Output = result.Output
+	}
+	r.addExecRecord("foreach", rec)
+	r.save()
+	return result.Output, err
+}
+
+// foreachCard summarizes a /foreach run: failures with the tail of their
+// output first, then the directories that succeeded.
+func foreachCard(root, command string, results []foreachResult, total int) CardMsg {
+	var failed, passed []foreachResult
+	for _, res := range results {
+		if res.Err != nil {
+			failed = append(failed, res)
+		} else {
+			passed = append(passed, res)
+		}
+	}
+	name := func(dir string) string {
+		if rel, err := filepath.Rel(root, dir); err == nil {
+			return rel
+		}
+		return dir
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**命令:** `%s`\n\n", truncateRunes(command, 100))
+	for _, res := range failed {
+		fmt.Fprintf(&sb, "❌ **%s**（%s）: %v\n", name(res.Dir), res.Elapsed.Truncate(time.Millisecond), res.Err)
+		if res.Output != "" {
+			fmt.Fprintf(&sb, "```\n%s\n```\n", truncateTail(res.Output, 800))
+		}
+	}
+	for _, res := range passed {
+		fmt.Fprintf(&sb, "✅ %s（%s）", name(res.Dir), res.Elapsed.Truncate(time.Millisecond))
+		if !strings.HasPrefix(command, "/") && res.Output != "" {
+			fmt.Fprintf(&sb, ": %s", truncateRunes(strings.Join(strings.Fields(res.Output), " "), 150))
+		}
+		sb.WriteString("\n")
+	}
+	if skipped := total - len(results); skipped > 0 {
+		fmt.Fprintf(&sb, "\n⚠️ 已取消，%d 个目录未执行\n", skipped)
+	}
+	card := CardMsg{Title: fmt.Sprintf("foreach: %d/%d 成功", len(passed), total), Content: sb.String(), Template: "green"}
+	if len(failed) > 0 || len(results) < total {
+		card.Template = "red"
+	}
+	return card
+}
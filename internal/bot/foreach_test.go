@@ -0,0 +1,105 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestForeachTargets(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"services/a", "services/b", "services/.hidden", "web"} {
+		os.MkdirAll(filepath.Join(root, d), 0755)
+	}
+	os.WriteFile(filepath.Join(root, "services", "x.txt"), []byte("x"), 0644)
+
+	dirs, err := foreachTargets(root, "web, services/*,../*,web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range dirs {
+		rel, _ := filepath.Rel(root, d)
+		got = append(got, rel)
+	}
+	if strings.Join(got, ",") != "services/a,services/b,web" {
+		t.Fatalf("unexpected targets %v", got)
+	}
+}
+
+func TestTestCommand(t *testing.T) {
+	dir := t.TempDir()
+	if testCommand(dir) != nil {
+		t.Fatal("expected no test command for an empty dir")
+	}
+	os.WriteFile(filepath.Join(dir, "package.json"), []byte("{}"), 0644)
+	if got := strings.Join(testCommand(dir), " "); got != "npm test" {
+		t.Fatalf("got %q", got)
+	}
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module x\n"), 0644)
+	if got := strings.Join(testCommand(dir), " "); got != "go test ./..." {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestRouterForeach_Exec(t *testing.T) {
+	r, sender := newTestRouter(t)
+	root := r.store.WorkRoot()
+	os.MkdirAll(filepath.Join(root, "services", "api"), 0755)
+	os.MkdirAll(filepath.Join(root, "services", "web"), 0755)
+	os.WriteFile(filepath.Join(root, "services", "api", "ok"), []byte("x"), 0644)
+
+	r.Route(context.Background(), "chat1", "user1", "/foreach services/* /exec test -f ok && echo fine || (echo missing; exit 1)")
+	msg := sender.LastMessage()
+	if !strings.HasPrefix(msg, "foreach: 1/2 成功") {
+		t.Fatalf("unexpected card %q", msg)
+	}
+	fail, pass := strings.Index(msg, "❌ **services/web**"), strings.Index(msg, "✅ services/api")
+	if fail < 0 || pass < 0 || fail > pass || !strings.Contains(msg, "missing") {
+		t.Fatalf("expected failure listed first with output, got %q", msg)
+	}
+}
+
+func TestRouterForeach_Usage(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/foreach")
+	if !strings.Contains(sender.LastMessage(), "用法") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/foreach * /deploy")
+	if !strings.Contains(sender.LastMessage(), "不支持 /deploy") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/foreach nothing-here/* /test")
+	if !strings.Contains(sender.LastMessage(), "没有匹配") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+}
+
+func TestRouterForeach_Prompt(t *testing.T) {
+	dir := t.TempDir()
+	claude := filepath.Join(dir, "claude")
+	os.WriteFile(claude, []byte(`#!/bin/sh
+printf '{"type":"result","result":"checked %s","session_id":"s1"}\n' "$(basename "$PWD")"
+`), 0755)
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	sender := &syncSpySender{}
+	r := NewRouter(context.Background(), NewClaudeExecutor(claude, "sonnet", 10*time.Second), store, sender, map[string]bool{"user1": true}, dir, nil)
+	os.MkdirAll(filepath.Join(dir, "repos", "one"), 0755)
+	os.MkdirAll(filepath.Join(dir, "repos", "two"), 0755)
+
+	r.Route(context.Background(), "chat1", "user1", "/foreach repos/* check the README")
+	msg := sender.LastMessage()
+	if !strings.HasPrefix(msg, "foreach: 2/2 成功") || !strings.Contains(msg, "repos/one") || !strings.Contains(msg, "checked two") {
+		t.Fatalf("unexpected card %q", msg)
+	}
+	if recs := r.store.ExecRecords("chat1", 0); len(recs) != 2 || recs[0].WorkDir != filepath.Join(dir, "repos", "two") {
+		t.Fatalf("expected a record per directory, got %+v", recs)
+	}
+	if s := r.getSession("chat1"); s.ClaudeSessionID != "" {
+		t.Fatalf("expected chat session untouched, got %q", s.ClaudeSessionID)
+	}
+}
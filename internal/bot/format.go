@@ -0,0 +1,157 @@
+package bot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// formatTimeout bounds one formatter run.
+const formatTimeout = 2 * time.Minute
+
+// defaultFormatters are the formatters by file extension, each a list of
+// alternatives: the first whose program is installed, in the repository's
+// node_modules/.bin (where prettier usually is) or on PATH, is used.
+var defaultFormatters = map[string][]string{
+	".go":  {"goimports -w", "gofmt -w"},
+	".py":  {"black -q"},
+	".rs":  {"rustfmt"},
+	".js":  {"prettier --write"},
+	".jsx": {"prettier --write"},
+	".mjs": {"prettier --write"},
+	".cjs": {"prettier --write"},
+	".ts":  {"prettier --write"},
+	".tsx": {"prettier --write"},
+	".css": {"prettier --write"},
+	".vue": {"prettier --write"},
+}
+
+// SetFormatting enables formatting the files each execution changed, with
+// overrides replacing the default formatter of an extension.
+func (r *Router) SetFormatting(enabled bool, overrides map[string]string) {
+	r.formatAfterExec = enabled
+	r.formatters = overrides
+}
+
+// formatterFor returns the formatter command for files with ext in root, or
+// "" if none is configured or installed.
+func (r *Router) formatterFor(root, ext string) string {
+	if command, ok := r.formatters[ext]; ok {
+		return command
+	}
+	for _, command := range defaultFormatters[ext] {
+		program, args, _ := strings.Cut(command, " ")
+		// Formatters run in root, so the local one is named relative to it.
+		if local := filepath.Join("node_modules", ".bin", program); fileExists(filepath.Join(root, local)) {
+			return local + " " + args
+		}
+		if _, err := exec.LookPath(program); err == nil {
+			return command
+		}
+	}
+	return ""
+}
+
+// changedFileHashes returns the content hashes of root's modified and
+// untracked files by path relative to root, or nil outside a repository.
+func changedFileHashes(root string) map[string]string {
+	out, err := runGitOutput(root, "ls-files", "--modified", "--others", "--exclude-standard")
+	if err != nil {
+		return nil
+	}
+	hashes := make(map[string]string)
+	for _, rel := range strings.Split(out, "\n") {
+		// Unusual names are quoted by git; leave them alone.
+		if rel == "" || strings.HasPrefix(rel, `"`) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(root, rel))
+		if err != nil {
+			continue
+		}
+		sum := sha256.Sum256(data)
+		hashes[rel] = hex.EncodeToString(sum[:])
+	}
+	return hashes
+}
+
+// formatCheck is the state of a repository's changed files before an
+// execution, so only the files the execution touched are formatted.
+type formatCheck struct {
+	r      *Router
+	root   string
+	before map[string]string
+}
+
+// formatBefore records the changed files of workDir's repository when
+// formatting is enabled, or returns nil.
+func (r *Router) formatBefore(workDir string) *formatCheck {
+	if !r.formatAfterExec || workDir == "" {
+		return nil
+	}
+	root := repoRoot(workDir)
+	before := changedFileHashes(root)
+	if before == nil {
+		return nil
+	}
+	return &formatCheck{r: r, root: root, before: before}
+}
+
+// run formats the files changed since formatBefore and returns a note for
+// the result card, "" when nothing needed formatting.
+func (c *formatCheck) run(ctx context.Context) string {
+	if c == nil {
+		return ""
+	}
+	after := changedFileHashes(c.root)
+	byCommand := make(map[string][]string)
+	for rel, hash := range after {
+		if c.before[rel] == hash {
+			continue
+		}
+		if command := c.r.formatterFor(c.root, filepath.Ext(rel)); command != "" {
+			byCommand[command] = append(byCommand[command], rel)
+		}
+	}
+	commands := make([]string, 0, len(byCommand))
+	for command := range byCommand {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+
+	var notes []string
+	for _, command := range commands {
+		files := byCommand[command]
+		sort.Strings(files)
+		argv := append([]string{"sh", "-c", command + ` "$@"`, "sh"}, files...)
+		out, err := runInDir(ctx, c.root, formatTimeout, argv...)
+		if err != nil {
+			slog.WarnContext(ctx, "format: command failed", "command", command, "root", c.root, "err", err)
+			note := fmt.Sprintf("⚠️ 格式化失败: `%s`（%v）", command, err)
+			if out = strings.TrimSpace(out); out != "" {
+				note += "\n```\n" + truncateRunes(out, 1000) + "\n```"
+			}
+			notes = append(notes, note)
+			continue
+		}
+		formatted := changedFileHashes(c.root)
+		var changed []string
+		for _, rel := range files {
+			if formatted[rel] != after[rel] {
+				changed = append(changed, "`"+rel+"`")
+			}
+		}
+		if len(changed) > 0 {
+			notes = append(notes, fmt.Sprintf("🧹 已格式化 %d 个文件（%s）: %s", len(changed), filepath.Base(strings.Fields(command)[0]), strings.Join(changed, ", ")))
+		}
+	}
+	return strings.Join(notes, "\n")
+}
@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatAfterExec_FormatsChangedFiles(t *testing.T) {
+	claude := filepath.Join(t.TempDir(), "claude")
+	os.WriteFile(claude, []byte(`#!/bin/sh
+echo "bad  spacing" > new.txt
+echo "bad  spacing" > notes.md
+echo '{"type":"result","result":"wrote files","session_id":"s1"}'
+`), 0755)
+	r, sender := newAckRouter(t, claude)
+	root := r.store.WorkRoot()
+	initGitRepo(t, root)
+	// Changed before the execution and left alone by it.
+	os.WriteFile(filepath.Join(root, "old.txt"), []byte("bad  spacing\n"), 0644)
+	r.SetFormatting(true, map[string]string{".txt": "sed -i 's/bad  spacing/good spacing/'"})
+
+	r.Route(context.Background(), "chat1", "user1", "write the files")
+	var card string
+	for _, m := range sender.messages {
+		if strings.Contains(m, "wrote files") {
+			card = m
+		}
+	}
+	if !strings.Contains(card, "🧹 已格式化 1 个文件（sed）: `new.txt`") {
+		t.Fatalf("result card = %q (messages %q)", card, sender.messages)
+	}
+	for name, want := range map[string]string{"new.txt": "good spacing\n", "old.txt": "bad  spacing\n", "notes.md": "bad  spacing\n"} {
+		if data, _ := os.ReadFile(filepath.Join(root, name)); string(data) != want {
+			t.Errorf("%s = %q, want %q", name, data, want)
+		}
+	}
+}
+
+func TestFormatAfterExec_ReportsFailure(t *testing.T) {
+	claude := filepath.Join(t.TempDir(), "claude")
+	os.WriteFile(claude, []byte(`#!/bin/sh
+echo x > a.txt
+echo '{"type":"result","result":"done","session_id":"s1"}'
+`), 0755)
+	r, sender := newAckRouter(t, claude)
+	initGitRepo(t, r.store.WorkRoot())
+	r.SetFormatting(true, map[string]string{".txt": "echo 'syntax error' >&2; false"})
+
+	r.Route(context.Background(), "chat1", "user1", "go")
+	if !strings.Contains(strings.Join(sender.messages, "\n"), "⚠️ 格式化失败: `echo 'syntax error' >&2; false`（exit status 1）\n```\nsyntax error\n```") {
+		t.Fatalf("messages = %q", sender.messages)
+	}
+}
+
+func TestFormatAfterExec_Disabled(t *testing.T) {
+	r, _ := newTestRouter(t)
+	if r.formatBefore(r.store.WorkRoot()) != nil {
+		t.Fatal("formatting should be off by default")
+	}
+}
+
+func TestFormatterFor(t *testing.T) {
+	r, _ := newTestRouter(t)
+	root := t.TempDir()
+	r.SetFormatting(true, map[string]string{".py": "ruff format"})
+	if got := r.formatterFor(root, ".py"); got != "ruff format" {
+		t.Errorf("override = %q", got)
+	}
+	if got := r.formatterFor(root, ".txt"); got != "" {
+		t.Errorf(".txt = %q", got)
+	}
+	os.MkdirAll(filepath.Join(root, "node_modules", ".bin"), 0755)
+	os.WriteFile(filepath.Join(root, "node_modules", ".bin", "prettier"), []byte("#!/bin/sh\n"), 0755)
+	if got := r.formatterFor(root, ".ts"); got != "node_modules/.bin/prettier --write" {
+		t.Errorf(".ts = %q", got)
+	}
+	if _, err := exec.LookPath("gofmt"); err == nil {
+		if got := r.formatterFor(root, ".go"); got != "goimports -w" && got != "gofmt -w" {
+			t.Errorf(".go = %q", got)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ForwardedMessage is one message of a merged forward (合并转发): the
+// rendered chat message plus what is needed to fetch its attachments.
+type ForwardedMessage struct {
+	ChatMessage
+	MessageID string
+	Type      string
+	// Content is the raw message content JSON.
+	Content string
+}
+
+// ForwardFile is a file carried by a merged forward.
+type ForwardFile struct {
+	Name string
+	Data []byte
+}
+
+// Forward is a merged forward unpacked by the handler: its messages,
+// oldest first, with attachments already downloaded.
+type Forward struct {
+	Messages []ChatMessage
+	Images   []ImageAttachment
+	Files    []ForwardFile
+}
+
+// forwardPrompt asks Claude to summarize a forwarded conversation and keep
+// it as context for the requests that follow in the session.
+func forwardPrompt(transcript string, files []string) string {
+	var sb strings.Builder
+	sb.WriteString("The user forwarded the chat conversation below to you (oldest first). " +
+		"Summarize it in the same language as the conversation: what it is about, the problem or request, what is known so far, decisions made and open questions. " +
+		"If it asks for something to be done, say how you would go about it, but do not modify any files now; keep this context in mind for the requests that follow.\n\n")
+	sb.WriteString(transcript)
+	sb.WriteString("\n")
+	if len(files) > 0 {
+		sb.WriteString("\nFiles from the conversation, saved locally:\n")
+		for _, f := range files {
+			sb.WriteString("- " + f + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// RouteForward saves the attachments of a merged forward and has Claude
+// summarize the forwarded conversation in the current session, so that a
+// discussion can be handed to the bot in one go.
+func (r *Router) RouteForward(ctx context.Context, chatID, userID string, fwd Forward) {
+	if !r.allowedUsers[userID] || r.promptDenied(ctx, chatID, userID) {
+		return
+	}
+	ctx = withLogFields(ctx, "chat_id", chatID, "user_id", userID)
+
+	transcript, count := chatTranscript(fwd.Messages, true)
+	if count == 0 && len(fwd.Images) == 0 && len(fwd.Files) == 0 {
+		r.sender.SendText(ctx, chatID, "转发的聊天记录中没有可处理的内容。")
+		return
+	}
+	session := r.getSession(chatID)
+
+	var images []string
+	if len(fwd.Images) > 0 {
+		dir, err := r.uploadDir(chatID, session.WorkDir, true)
+		if err != nil {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("Failed to create image directory: %v", err))
+			return
+		}
+		for _, img := range fwd.Images {
+			path := filepath.Join(dir, filepath.Base(img.FileName))
+			if err := os.WriteFile(path, img.Data, 0644); err != nil {
+				slog.WarnContext(ctx, "router: failed to save forwarded image", "file", img.FileName, "err", err)
+				continue
+			}
+			images = append(images, path)
+		}
+	}
+	var files []string
+	if len(fwd.Files) > 0 {
+		dir, err := r.uploadDir(chatID, session.WorkDir, false)
+		if err != nil {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("Failed to save file: %v", err))
+			return
+		}
+		for _, f := range fwd.Files {
+			// Use Base to prevent path traversal
+			path := filepath.Join(dir, filepath.Base(f.Name))
+			if err := os.WriteFile(path, f.Data, 0644); err != nil {
+				slog.WarnContext(ctx, "router: failed to save forwarded file", "file", f.Name, "err", err)
+				continue
+			}
+			files = append(files, fmt.Sprintf("%s: %s", filepath.Base(f.Name), path))
+		}
+	}
+
+	slog.InfoContext(ctx, "router: merged forward", "messages", count, "images", len(images), "files", len(files))
+	note := fmt.Sprintf("收到合并转发的 %d 条消息", count)
+	if len(images) > 0 {
+		note += fmt.Sprintf("、%d 张图片", len(images))
+	}
+	if len(files) > 0 {
+		note += fmt.Sprintf("、%d 个文件", len(files))
+	}
+	r.sender.SendText(ctx, chatID, note+"，正在总结，总结会作为当前会话的上下文。")
+	r.submitChecked(ctx, chatID, forwardPrompt(transcript, files), execOptions{Images: images})
+}
@@ -0,0 +1,131 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
+)
+
+// forwardSender is a fakeSender that can read merged forwards.
+type forwardSender struct {
+	fakeSender
+	msgs []ForwardedMessage
+	err  error
+}
+
+func (f *forwardSender) ForwardedMessages(_ context.Context, _ string) ([]ForwardedMessage, error) {
+	return f.msgs, f.err
+}
+
+func forwardEvent(t *testing.T) *larkim.P2MessageReceiveV1 {
+	t.Helper()
+	raw := makeEventWithMsgID("user", "user1", "oc_chat", "p2p", "merge_forward", `{"content":"Merged and Forwarded Message"}`, "msg_fwd", nil)
+	var evt larkim.P2MessageReceiveV1
+	json.Unmarshal(raw, &evt)
+	return &evt
+}
+
+func TestHandleMessage_MergeForward(t *testing.T) {
+	at := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local)
+	sender := &forwardSender{msgs: []ForwardedMessage{
+		{ChatMessage: ChatMessage{SenderID: "u1", Time: at, Text: "the deploy is failing"}, MessageID: "m1", Type: "text"},
+		{ChatMessage: ChatMessage{SenderID: "u2", Time: at, Text: "[图片]"}, MessageID: "m2", Type: "image", Content: `{"image_key":"img_1"}`},
+		{ChatMessage: ChatMessage{SenderID: "u2", Time: at, Text: "[文件]"}, MessageID: "m3", Type: "file", Content: `{"file_key":"f_1","file_name":"deploy.log"}`},
+	}}
+	dl := &fakeDownloader{imageData: []byte("png"), fileData: []byte("log line")}
+	router := &fakeRouter{}
+	h := NewHandler(router, dl, sender, true, "bot_id", nil)
+	h.HandleMessage(context.Background(), forwardEvent(t))
+
+	fwd := router.forward
+	if fwd == nil {
+		t.Fatal("expected the merged forward to be routed")
+	}
+	if len(fwd.Messages) != 3 || fwd.Messages[0].Text != "the deploy is failing" {
+		t.Fatalf("unexpected messages: %+v", fwd.Messages)
+	}
+	if len(fwd.Images) != 1 || fwd.Messages[1].Text != "[图片 img_1.png]" {
+		t.Fatalf("expected the image to be downloaded, got %+v / %q", fwd.Images, fwd.Messages[1].Text)
+	}
+	if len(fwd.Files) != 1 || fwd.Files[0].Name != "deploy.log" || string(fwd.Files[0].Data) != "log line" || fwd.Messages[2].Text != "[文件 deploy.log]" {
+		t.Fatalf("expected the file to be downloaded, got %+v / %q", fwd.Files, fwd.Messages[2].Text)
+	}
+}
+
+func TestHandleMessage_MergeForwardUnsupported(t *testing.T) {
+	router := &fakeRouter{}
+	sender := &fakeSender{}
+	h := NewHandler(router, nil, sender, true, "bot_id", nil)
+	h.HandleMessage(context.Background(), forwardEvent(t))
+	if router.called || len(sender.messages) != 1 || !strings.Contains(sender.messages[0], "无法读取合并转发") {
+		t.Fatalf("expected a notice, got routed=%v %v", router.called, sender.messages)
+	}
+
+	fs := &forwardSender{err: errors.New("no permission")}
+	h = NewHandler(router, nil, fs, true, "bot_id", nil)
+	h.HandleMessage(context.Background(), forwardEvent(t))
+	if router.called || len(fs.messages) != 1 || !strings.Contains(fs.messages[0], "no permission") {
+		t.Fatalf("expected the read error, got routed=%v %v", router.called, fs.messages)
+	}
+}
+
+func TestChatTranscript_WithBots(t *testing.T) {
+	msgs := []ChatMessage{
+		{SenderID: "u1", Text: "is prod down?"},
+		{SenderID: "bot", FromBot: true, Text: "3 alerts firing"},
+		{SenderID: "u2", Text: "/status"},
+	}
+	got, n := chatTranscript(msgs, true)
+	if n != 2 || !strings.Contains(got, "成员1: is prod down?") || !strings.Contains(got, "机器人: 3 alerts firing") {
+		t.Fatalf("unexpected transcript (%d): %q", n, got)
+	}
+	if _, n := catchupTranscript(msgs); n != 1 {
+		t.Fatalf("expected catchup to leave bot messages out, got %d", n)
+	}
+}
+
+func TestRouteForward(t *testing.T) {
+	dir := t.TempDir()
+	promptFile := filepath.Join(dir, "prompt.txt")
+	script := filepath.Join(dir, "claude")
+	os.WriteFile(script, []byte("#!/bin/sh\ncat > "+promptFile+"\necho '{\"type\":\"result\",\"result\":\"summary\",\"session_id\":\"s1\"}'\n"), 0755)
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	sender := &spySender{}
+	r := NewRouter(context.Background(), NewClaudeExecutor(script, "sonnet", 10*time.Second), store, sender, map[string]bool{"user1": true}, dir, nil)
+	ctx := context.Background()
+
+	r.RouteForward(ctx, "chat1", "user1", Forward{Messages: []ChatMessage{{SenderID: "u1", Text: "/help"}}})
+	if !strings.Contains(sender.LastMessage(), "没有可处理的内容") {
+		t.Fatalf("expected empty notice, got %q", sender.LastMessage())
+	}
+
+	r.RouteForward(ctx, "chat1", "user1", Forward{
+		Messages: []ChatMessage{{SenderID: "u1", Text: "the deploy is failing"}, {SenderID: "u2", Text: "[文件 deploy.log]"}},
+		Files:    []ForwardFile{{Name: "../deploy.log", Data: []byte("log line")}},
+	})
+	if data, err := os.ReadFile(filepath.Join(dir, "deploy.log")); err != nil || string(data) != "log line" {
+		t.Fatalf("expected the file in the workdir: %q, %v", data, err)
+	}
+	found := false
+	for _, m := range sender.messages {
+		if strings.Contains(m, "收到合并转发的 2 条消息、1 个文件") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected a receipt notice, got %v", sender.messages)
+	}
+	prompt, _ := os.ReadFile(promptFile)
+	for _, want := range []string{"forwarded the chat conversation", "成员1: the deploy is failing", "- deploy.log: " + filepath.Join(dir, "deploy.log")} {
+		if !strings.Contains(string(prompt), want) {
+			t.Errorf("expected %q in prompt:\n%s", want, prompt)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package bot
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// maxGetFiles bounds how many files one /get archives.
+	maxGetFiles = 500
+	// maxGetSize bounds the total size of the files one /get archives
+	// unless larger files can go to Drive (see fileLimit).
+	maxGetSize = maxUploadSize
+	// maxGetImageSize is the largest image /get posts inline; larger ones
+	// are sent as files.
+	maxGetImageSize = 10 << 20
+)
+
+// getMatch is a workdir file matched by /get.
+type getMatch struct {
+	rel  string // slash-separated, relative to the workdir
+	path string
+	size int64
+}
+
+// globMatch reports whether the slash-separated path rel matches pattern.
+// Besides path.Match syntax, a "**" segment matches any number of
+// directories, and a pattern without "/" matches the file name at any
+// depth.
+func globMatch(pattern, rel string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pat, parts []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pat[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], parts[0]); !ok {
+			return false
+		}
+		pat, parts = pat[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// findGetFiles returns the regular files under workDir matching any of
+// patterns, skipping .git. Symlinks are not followed.
+func findGetFiles(workDir string, patterns []string) ([]getMatch, error) {
+	var matches []getMatch
+	err := filepath.Walk(workDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(workDir, p)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		for _, pat := range patterns {
+			if globMatch(pat, rel) {
+				matches = append(matches, getMatch{rel: rel, path: p, size: info.Size()})
+				break
+			}
+		}
+		if len(matches) > maxGetFiles {
+			return fmt.Errorf("匹配的文件超过 %d 个，请缩小范围", maxGetFiles)
+		}
+		return nil
+	})
+	return matches, err
+}
+
+// zipFiles archives matches, keeping their workdir-relative paths.
+func zipFiles(matches []getMatch) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, m := range matches {
+		data, err := os.ReadFile(m.path)
+		if err != nil {
+			return nil, err
+		}
+		w, err := zw.Create(m.rel)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (r *Router) cmdGet(ctx context.Context, chatID, args string) {
+	patterns := strings.Fields(args)
+	if len(patterns) == 0 {
+		r.sender.SendText(ctx, chatID, "用法: /get <文件或通配符>...\n示例: /get report.pdf\n示例: /get dist/*.js\n示例: /get **/*.log coverage/**\n单个文件直接发送（图片直接显示），多个文件打包为 zip。")
+		return
+	}
+	for _, p := range patterns {
+		if filepath.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") || strings.Contains(p, "/../") {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("只能获取工作目录内的文件: %s", p))
+			return
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("无效的通配符: %s", p))
+			return
+		}
+	}
+	if _, ok := r.sender.(FileSender); !ok {
+		r.sender.SendText(ctx, chatID, "当前通道不支持发送文件。")
+		return
+	}
+
+	workDir := r.getSession(chatID).WorkDir
+	for i, p := range patterns {
+		patterns[i] = strings.TrimPrefix(path.Clean(p), "./")
+	}
+	matches, err := findGetFiles(workDir, patterns)
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("查找文件失败: %v", err))
+		return
+	}
+	if len(matches) == 0 {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("没有匹配的文件: %s", strings.Join(patterns, " ")))
+		return
+	}
+	var total int64
+	for _, m := range matches {
+		total += m.size
+	}
+	if limit := r.fileLimit(); total > limit {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("匹配的 %d 个文件共 %s，超过 %s 上限，请缩小范围。", len(matches), formatSize(total), formatSize(limit)))
+		return
+	}
+
+	if len(matches) == 1 {
+		m := matches[0]
+		data, err := os.ReadFile(m.path)
+		if err == nil {
+			is, inline := r.sender.(ImageSender)
+			if inline && isImageFile(m.rel) && m.size <= maxGetImageSize {
+				err = is.SendImage(ctx, chatID, path.Base(m.rel), data)
+			} else {
+				err = r.deliverFile(ctx, chatID, path.Base(m.rel), data)
+			}
+		}
+		if err != nil {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("发送 %s 失败: %v", m.rel, err))
+		}
+		return
+	}
+
+	data, err := zipFiles(matches)
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("打包文件失败: %v", err))
+		return
+	}
+	name := fmt.Sprintf("%s-%s.zip", filepath.Base(workDir), time.Now().Format("20060102-150405"))
+	if err := r.deliverFile(ctx, chatID, name, data); err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("发送 %s 失败: %v", name, err))
+		return
+	}
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已发送 %s（%d 个文件，%s，压缩后 %s）", name, len(matches), formatSize(total), formatSize(int64(len(data)))))
+}
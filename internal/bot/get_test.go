@@ -0,0 +1,142 @@
+package bot
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern, rel string
+		want         bool
+	}{
+		{"*.log", "app.log", true},
+		{"*.log", "logs/deep/app.log", true},
+		{"dist/*.js", "dist/app.js", true},
+		{"dist/*.js", "dist/sub/app.js", false},
+		{"dist/**", "dist/sub/app.js", true},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "internal/bot/get.go", true},
+		{"internal/**/get.go", "internal/bot/get.go", true},
+		{"internal/**/get.go", "internal/get.go", true},
+		{"report.pdf", "out/report.pdf", true},
+		{"out/report.pdf", "report.pdf", false},
+	}
+	for _, c := range cases {
+		if got := globMatch(c.pattern, c.rel); got != c.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", c.pattern, c.rel, got, c.want)
+		}
+	}
+}
+
+func newGetRouter(t *testing.T) (*Router, *fileSpySender, string) {
+	t.Helper()
+	r, _ := newTestRouter(t)
+	sender := &fileSpySender{}
+	r.sender = sender
+	dir := r.getSession("chat1").WorkDir
+	os.MkdirAll(filepath.Join(dir, "dist", "sub"), 0755)
+	os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+	os.WriteFile(filepath.Join(dir, "dist", "app.js"), []byte("app"), 0644)
+	os.WriteFile(filepath.Join(dir, "dist", "sub", "lib.js"), []byte("lib"), 0644)
+	os.WriteFile(filepath.Join(dir, ".git", "config.js"), []byte("git"), 0644)
+	return r, sender, dir
+}
+
+func TestRouterGet_SingleFile(t *testing.T) {
+	r, sender, _ := newGetRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/get dist/app.js")
+	if string(sender.files["app.js"]) != "app" || len(sender.files) != 1 {
+		t.Fatalf("expected app.js sent directly, got %v", sender.files)
+	}
+}
+
+// imageSpySender also records images posted inline.
+type imageSpySender struct {
+	fileSpySender
+	images map[string][]byte
+}
+
+func (s *imageSpySender) SendImage(_ context.Context, _, fileName string, data []byte) error {
+	if s.images == nil {
+		s.images = make(map[string][]byte)
+	}
+	s.images[fileName] = data
+	return nil
+}
+
+func TestRouterGet_Image(t *testing.T) {
+	r, _, dir := newGetRouter(t)
+	sender := &imageSpySender{}
+	r.sender = sender
+	os.WriteFile(filepath.Join(dir, "dist", "shot.png"), []byte("png"), 0644)
+
+	r.Route(context.Background(), "chat1", "user1", "/get dist/shot.png")
+	if string(sender.images["shot.png"]) != "png" || len(sender.files) != 0 {
+		t.Fatalf("expected shot.png posted as image, got images=%v files=%v", sender.images, sender.files)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/get dist/app.js")
+	if string(sender.files["app.js"]) != "app" || len(sender.images) != 1 {
+		t.Fatalf("expected app.js sent as file, got images=%v files=%v", sender.images, sender.files)
+	}
+}
+
+func TestRouterGet_Zip(t *testing.T) {
+	r, sender, dir := newGetRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/get *.js")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "2 个文件") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	var data []byte
+	for name, d := range sender.files {
+		if !strings.HasPrefix(name, filepath.Base(dir)+"-") || !strings.HasSuffix(name, ".zip") {
+			t.Fatalf("unexpected file name %q", name)
+		}
+		data = d
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "dist/app.js,dist/sub/lib.js" {
+		t.Fatalf("unexpected zip entries %v", names)
+	}
+}
+
+func TestRouterGet_Rejects(t *testing.T) {
+	r, sender, _ := newGetRouter(t)
+	for cmd, want := range map[string]string{
+		"/get":             "用法",
+		"/get ../x":        "只能获取工作目录内的文件",
+		"/get /etc/passwd": "只能获取工作目录内的文件",
+		"/get [":           "无效的通配符",
+		"/get *.pdf":       "没有匹配的文件",
+	} {
+		r.Route(context.Background(), "chat1", "user1", cmd)
+		if msg := sender.LastMessage(); !strings.Contains(msg, want) {
+			t.Errorf("%s: expected %q, got %q", cmd, want, msg)
+		}
+	}
+	if len(sender.files) != 0 {
+		t.Fatalf("expected no files sent, got %v", sender.files)
+	}
+}
+
+func TestRouterGet_NoFileSender(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/get README.md")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "不支持发送文件") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+}
@@ -0,0 +1,50 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// requireForge tells the chat how to set up the forge CLI and returns
+// false when it is not installed.
+func (r *Router) requireForge(ctx context.Context, chatID, forge string) bool {
+	if _, err := exec.LookPath(forge); err == nil {
+		return true
+	}
+	content := "安装 GitHub CLI（https://cli.github.com）并运行 `gh auth login` 后即可使用 /pr、/prs 和 /issue。"
+	if forge == "glab" {
+		content = "安装 GitLab CLI（https://gitlab.com/gitlab-org/cli）并运行 `glab auth login` 后即可使用 /prs 和 /pr view。"
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("未找到 %s 命令行工具", forge), Content: content, Template: "red"})
+	return false
+}
+
+// runForge runs the forge CLI in workDir with a timeout.
+func runForge(ctx context.Context, workDir, forge string, args ...string) (string, error) {
+	execCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(execCtx, forge, args...)
+	cmd.Dir = workDir
+	out, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if err != nil && output == "" {
+		output = err.Error()
+	}
+	return output, err
+}
+
+// ghJSON runs gh in workDir and decodes its --json output into v.
+func ghJSON(ctx context.Context, workDir string, v interface{}, args ...string) (string, error) {
+	output, err := runForge(ctx, workDir, "gh", args...)
+	if err != nil {
+		return output, err
+	}
+	if err := json.Unmarshal([]byte(output), v); err != nil {
+		return fmt.Sprintf("无法解析 gh 输出: %v", err), err
+	}
+	return output, nil
+}
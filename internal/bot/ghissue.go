@@ -0,0 +1,295 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ghIssueFields are the `gh issue list --json` fields the list shows.
+	ghIssueFields = "number,title,url,state,author,labels,assignees,comments,updatedAt"
+	// ghIssueViewFields adds what only /issue view shows.
+	ghIssueViewFields = ghIssueFields + ",body,createdAt"
+	// issueContextExecs is how many recent executions of the chat go into
+	// the prompt drafting an issue body.
+	issueContextExecs = 5
+)
+
+// ghIssue is an issue as printed by `gh issue ... --json`.
+type ghIssue struct {
+	Number    int
+	Title     string
+	URL       string
+	State     string
+	Author    struct{ Login string }
+	Labels    []struct{ Name string }
+	Assignees []struct{ Login string }
+	Comments  []struct {
+		Author    struct{ Login string }
+		Body      string
+		CreatedAt time.Time
+	}
+	UpdatedAt time.Time
+	CreatedAt time.Time
+	Body      string
+}
+
+// labelList renders the issue's labels as inline code, or "".
+func (is ghIssue) labelList() string {
+	names := make([]string, len(is.Labels))
+	for i, l := range is.Labels {
+		names[i] = "`" + l.Name + "`"
+	}
+	return strings.Join(names, " ")
+}
+
+// assigneeList renders the issue's assignees as @logins, or "".
+func (is ghIssue) assigneeList() string {
+	logins := make([]string, len(is.Assignees))
+	for i, a := range is.Assignees {
+		logins[i] = "@" + a.Login
+	}
+	return strings.Join(logins, " ")
+}
+
+// issueListLine renders one issue of the /issue list card.
+func issueListLine(is ghIssue) string {
+	meta := []string{"@" + is.Author.Login}
+	if is.State != "" && is.State != "OPEN" {
+		meta = append(meta, strings.ToLower(is.State))
+	}
+	if labels := is.labelList(); labels != "" {
+		meta = append(meta, labels)
+	}
+	if len(is.Comments) > 0 {
+		meta = append(meta, fmt.Sprintf("💬 %d", len(is.Comments)))
+	}
+	if assignees := is.assigneeList(); assignees != "" {
+		meta = append(meta, "指派 "+assignees)
+	}
+	return fmt.Sprintf("- [#%d](%s) %s\n  %s", is.Number, is.URL, is.Title, strings.Join(meta, " · "))
+}
+
+// issueWorkDir returns the directory gh runs in for chatID.
+func (r *Router) issueWorkDir(chatID string) string {
+	workDir := r.getSession(chatID).WorkDir
+	if workDir == "" {
+		workDir = r.store.WorkRoot()
+	}
+	return workDir
+}
+
+// cmdIssueList lists the repository's issues as a card. "all" includes
+// closed ones, anything else is passed to gh (e.g. --label bug).
+func (r *Router) cmdIssueList(ctx context.Context, chatID, args string) {
+	if !r.requireForge(ctx, chatID, "gh") {
+		return
+	}
+	ghArgs := []string{"issue", "list", "--limit", "20", "--json", ghIssueFields}
+	if args == "all" {
+		ghArgs = append(ghArgs, "--state", "all")
+	} else if args != "" {
+		ghArgs = append(ghArgs, strings.Fields(args)...)
+	}
+	var issues []ghIssue
+	if output, err := ghJSON(ctx, r.issueWorkDir(chatID), &issues, ghArgs...); err != nil {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "获取 Issues 出错", Content: output, Template: "red"})
+		return
+	}
+	if len(issues) == 0 {
+		r.sender.SendText(ctx, chatID, "没有开放中的 Issue。")
+		return
+	}
+	lines := make([]string, len(issues))
+	for i, is := range issues {
+		lines[i] = issueListLine(is)
+	}
+	content := strings.Join(lines, "\n") + "\n\n`/issue view <编号>` 查看详情"
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("Issues（%d）", len(issues)), Content: content})
+}
+
+// cmdIssueView shows one issue as a card: state, labels, assignees, the
+// start of its description and its latest comments.
+func (r *Router) cmdIssueView(ctx context.Context, chatID, arg string) {
+	n, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+	if err != nil || n <= 0 {
+		r.sender.SendText(ctx, chatID, "用法: /issue view <编号>\n示例: /issue view 42")
+		return
+	}
+	if !r.requireForge(ctx, chatID, "gh") {
+		return
+	}
+	var is ghIssue
+	if output, err := ghJSON(ctx, r.issueWorkDir(chatID), &is, "issue", "view", strconv.Itoa(n), "--json", ghIssueViewFields); err != nil {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("获取 Issue #%d 出错", n), Content: output, Template: "red"})
+		return
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**状态:** %s  **作者:** @%s\n", strings.ToLower(is.State), is.Author.Login)
+	if labels := is.labelList(); labels != "" {
+		fmt.Fprintf(&sb, "**标签:** %s\n", labels)
+	}
+	if assignees := is.assigneeList(); assignees != "" {
+		fmt.Fprintf(&sb, "**指派:** %s\n", assignees)
+	}
+	if !is.UpdatedAt.IsZero() {
+		fmt.Fprintf(&sb, "**更新于:** %s\n", is.UpdatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	if body := strings.TrimSpace(is.Body); body != "" {
+		sb.WriteString("\n" + truncateRunes(body, 1500) + "\n")
+	}
+	if len(is.Comments) > 0 {
+		fmt.Fprintf(&sb, "\n**评论（%d）**\n", len(is.Comments))
+		comments := is.Comments
+		if len(comments) > 3 {
+			fmt.Fprintf(&sb, "（仅显示最近 3 条）\n")
+			comments = comments[len(comments)-3:]
+		}
+		for _, c := range comments {
+			fmt.Fprintf(&sb, "- @%s %s: %s\n", c.Author.Login, c.CreatedAt.Local().Format("01-02 15:04"), truncateRunes(strings.Join(strings.Fields(c.Body), " "), 300))
+		}
+	}
+	fmt.Fprintf(&sb, "\n[在 GitHub 上查看](%s)", is.URL)
+
+	tpl := "blue"
+	if is.State == "CLOSED" {
+		tpl = "grey"
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("Issue #%d %s", is.Number, is.Title), Content: sb.String(), Template: tpl})
+}
+
+// issueDraftPrompt asks Claude for the body of an issue titled title from
+// the chat's recent executions (newest first) and the state of the
+// repository.
+func issueDraftPrompt(title string, recs []ExecRecord, branch, commits, diffStat string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Write the body of a GitHub issue titled %q, in Markdown and in the same language as the title. Describe the problem or task, what is known so far (errors, relevant files, what was tried) and, if it is clear, the expected outcome. Use only the context below; do not invent details and do not change any files. Reply with the issue body only, without the title.\n", title)
+	if len(recs) > 0 {
+		sb.WriteString("\nRecent requests in this chat, oldest first:\n")
+		for i := len(recs) - 1; i >= 0; i-- {
+			rec := recs[i]
+			fmt.Fprintf(&sb, "\n### Request\n%s\n", truncateRunes(strings.TrimSpace(rec.Prompt), 1000))
+			if rec.Error != "" {
+				fmt.Fprintf(&sb, "Failed with:\n```\n%s\n```\n", truncateRunes(strings.TrimSpace(rec.Error), 1500))
+			} else if rec.Output != "" {
+				fmt.Fprintf(&sb, "Response:\n%s\n", truncateRunes(strings.TrimSpace(rec.Output), 1500))
+			}
+		}
+	}
+	if branch != "" {
+		fmt.Fprintf(&sb, "\nCurrent branch: %s\n", branch)
+	}
+	if commits != "" {
+		fmt.Fprintf(&sb, "\nRecent commits:\n%s\n", commits)
+	}
+	if diffStat != "" {
+		fmt.Fprintf(&sb, "\nUncommitted changes:\n%s\n", diffStat)
+	}
+	return sb.String()
+}
+
+// cmdIssueCreate queues drafting the body of a new issue with Claude from
+// the chat's recent context and filing it with gh.
+func (r *Router) cmdIssueCreate(ctx context.Context, chatID, title string) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		r.sender.SendText(ctx, chatID, "用法: /issue create <标题>\nClaude 根据当前聊天最近的请求、输出和仓库状态撰写正文，再用 gh 创建 issue。")
+		return
+	}
+	if !r.requireForge(ctx, chatID, "gh") {
+		return
+	}
+	workDir := r.issueWorkDir(chatID)
+	var recs []ExecRecord
+	for _, rec := range r.store.ExecRecords(chatID, 0) {
+		if rec.WorkDir == workDir && len(recs) < issueContextExecs {
+			recs = append(recs, rec)
+		}
+	}
+	var commits, diffStat string
+	if gitHead(workDir) != "" {
+		commits, _ = runGitOutput(workDir, "log", "--oneline", "-5")
+		diffStat, _ = runGitOutput(workDir, "diff", "HEAD", "--stat")
+	}
+	prompt := r.secrets.Redact(issueDraftPrompt(title, recs, gitBranch(workDir), commits, diffStat))
+
+	id := newExecID()
+	if r.queue == nil {
+		r.runIssueCreate(ctx, chatID, id, title, prompt)
+		return
+	}
+	r.setQueued(ExecRecord{ID: id, ChatID: chatID, Prompt: "/issue create " + title, StartedAt: time.Now()})
+	pos, err := r.queue.EnqueueTask(chatID, QueueEntry{ID: id}, func() {
+		r.runIssueCreate(r.ctx, chatID, id, title, prompt)
+	})
+	if err != nil {
+		r.clearQueued(id)
+		r.sender.SendText(ctx, chatID, "队列已满，请稍后再试。")
+		return
+	}
+	if pos > 1 {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("已排队（第 %d 位）", pos), Content: "当前有任务正在执行，请稍候...", Template: "blue"})
+	}
+}
+
+// runIssueCreate drafts the issue body in a fresh session in safe mode and
+// files the issue.
+func (r *Router) runIssueCreate(ctx context.Context, chatID, id, title, prompt string) {
+	r.clearQueued(id)
+	r.sender.SendText(ctx, chatID, "撰写 issue 正文中...")
+
+	_, _, _, model := r.store.SessionExecParams(chatID)
+	workDir := r.issueWorkDir(chatID)
+	startTime := time.Now()
+	rec := ExecRecord{
+		ID:             id,
+		ChatID:         chatID,
+		Prompt:         "/issue create " + title,
+		WorkDir:        workDir,
+		StartedAt:      startTime,
+		Model:          model,
+		PermissionMode: "safe",
+		GitHead:        gitHead(workDir),
+	}
+	r.setActive(rec)
+	defer r.clearActive(id)
+
+	result, err := r.executor.ExecStream(ctx, prompt, workDir, "", "safe", model, nil)
+	rec.Duration = time.Since(startTime)
+	rec.SessionID = result.SessionID
+	rec.setResultMeta(result)
+	body := strings.TrimSpace(result.Output)
+	if err == nil && body == "" {
+		err = fmt.Errorf("Claude 没有返回正文")
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	} else {
+		rec.Output = body
+	}
+	r.addExecRecord("issue", rec)
+	r.save()
+	if rec.Error != "" {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "撰写 issue 正文出错", Content: rec.Error, Template: "red"})
+		return
+	}
+
+	body = r.secrets.Redact(body)
+	out, err := runInDir(ctx, workDir, issueTimeout, "gh", "issue", "create", "--title", title, "--body", body)
+	if err != nil {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "创建 issue 失败", Content: fmt.Sprintf("%v\n\n```\n%s\n```\n\n**草稿正文:**\n%s", err, truncateRunes(strings.TrimSpace(out), 2000), truncateRunes(body, 2000)), Template: "red"})
+		return
+	}
+	link := issueURL(out)
+	slog.InfoContext(ctx, "issue: created", "chat_id", chatID, "url", link)
+	r.sender.SendCard(ctx, chatID, CardMsg{
+		Title:    "📌 已创建 issue: " + title,
+		Content:  link + "\n\n" + truncateRunes(body, 1500),
+		Template: "green",
+	})
+}
@@ -0,0 +1,107 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeIssueGH puts a gh on PATH that answers `issue list`, `issue view` and
+// `issue create` and records its arguments in the returned file.
+func fakeIssueGH(t *testing.T) string {
+	t.Helper()
+	bin := t.TempDir()
+	args := filepath.Join(bin, "args")
+	list := `[{"number":7,"title":"Login retries forever","url":"https://github.com/acme/app/issues/7","state":"OPEN","author":{"login":"alice"},"labels":[{"name":"bug"}],"assignees":[{"login":"bob"}],"comments":[{"body":"seen it too"}]},` +
+		`{"number":8,"title":"Dark mode","url":"https://github.com/acme/app/issues/8","state":"OPEN","author":{"login":"carol"}}]`
+	view := `{"number":7,"title":"Login retries forever","url":"https://github.com/acme/app/issues/7","state":"OPEN","author":{"login":"alice"},"labels":[{"name":"bug"}],"body":"Steps: log in with a wrong password.","comments":[{"author":{"login":"bob"},"body":"seen   it  too","createdAt":"2026-10-01T10:00:00Z"}]}`
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + args + "\ncase \"$2\" in\nlist) echo '" + list + "' ;;\nview) echo '" + view + "' ;;\ncreate) echo https://github.com/acme/app/issues/9 ;;\nesac\n"
+	os.WriteFile(filepath.Join(bin, "gh"), []byte(script), 0755)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return args
+}
+
+func TestRouterIssueList_Card(t *testing.T) {
+	args := fakeIssueGH(t)
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/issue list --label bug")
+
+	msg := sender.LastMessage()
+	for _, want := range []string{"Issues（2）", "[#7](https://github.com/acme/app/issues/7) Login retries forever", "@alice", "`bug`", "💬 1", "指派 @bob", "/issue view"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("/issue list card missing %q:\n%s", want, msg)
+		}
+	}
+	if data, _ := os.ReadFile(args); !strings.HasSuffix(string(data), "--label\nbug\n") {
+		t.Fatalf("expected args passed to gh, got %q", data)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/issues")
+	if !strings.Contains(sender.LastMessage(), "Issues（2）") {
+		t.Fatalf("expected /issues to show the same card, got %q", sender.LastMessage())
+	}
+}
+
+func TestRouterIssueView(t *testing.T) {
+	args := fakeIssueGH(t)
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/issue view #7")
+
+	msg := sender.LastMessage()
+	for _, want := range []string{"Issue #7 Login retries forever", "**状态:** open", "`bug`", "Steps: log in", "评论（1）", "@bob", "seen it too", "issues/7"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("/issue view card missing %q:\n%s", want, msg)
+		}
+	}
+	if data, _ := os.ReadFile(args); !strings.HasPrefix(string(data), "issue\nview\n7\n--json\n") {
+		t.Fatalf("unexpected gh args %q", data)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/issue view latest")
+	if !strings.HasPrefix(sender.LastMessage(), "用法: /issue view") {
+		t.Fatalf("expected usage, got %q", sender.LastMessage())
+	}
+}
+
+func TestRouterIssueCreate_DraftsBody(t *testing.T) {
+	args := fakeIssueGH(t)
+	dir := t.TempDir()
+	prompts := filepath.Join(dir, "prompt")
+	claude := filepath.Join(dir, "claude")
+	os.WriteFile(claude, []byte("#!/bin/sh\ncat > "+prompts+"\necho '{\"type\":\"result\",\"result\":\"Login keeps retrying after a wrong password.\",\"session_id\":\"s9\"}'\n"), 0755)
+	r, sender := newAckRouter(t, claude)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "/issue create")
+	if !strings.HasPrefix(sender.LastMessage(), "用法: /issue create") {
+		t.Fatalf("expected usage, got %q", sender.LastMessage())
+	}
+
+	r.Route(ctx, "chat1", "user1", "why does login retry forever?")
+	r.Route(ctx, "chat1", "user1", "/issue create Login retries forever")
+	msg := sender.LastMessage()
+	if !strings.Contains(msg, "已创建 issue: Login retries forever") || !strings.Contains(msg, "issues/9") || !strings.Contains(msg, "Login keeps retrying") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	prompt, _ := os.ReadFile(prompts)
+	if !strings.Contains(string(prompt), `titled "Login retries forever"`) || !strings.Contains(string(prompt), "why does login retry forever?") {
+		t.Fatalf("expected the recent request in the draft prompt, got %q", prompt)
+	}
+	data, _ := os.ReadFile(args)
+	if got := string(data); !strings.HasPrefix(got, "issue\ncreate\n--title\nLogin retries forever\n--body\nLogin keeps retrying") {
+		t.Fatalf("unexpected gh arguments %q", got)
+	}
+	if recs := r.store.ExecRecords("chat1", 1); len(recs) != 1 || recs[0].Prompt != "/issue create Login retries forever" {
+		t.Fatalf("expected the draft recorded, got %+v", recs)
+	}
+}
+
+func TestRouterIssueList_NoGH(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/issue list")
+	if !strings.Contains(sender.LastMessage(), "未找到 gh 命令行工具") {
+		t.Fatalf("expected a missing gh message, got %q", sender.LastMessage())
+	}
+}
@@ -0,0 +1,377 @@
+package bot
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// githubWebhookSecret names the secret GitHub signs webhook deliveries
+	// with; the receiver is disabled without it.
+	githubWebhookSecret = "github_webhook_secret"
+	// githubWebhookPath is where the web server accepts GitHub webhooks.
+	githubWebhookPath = "/github/webhook"
+	// maxGitHubBody bounds the size of webhook payloads; push payloads
+	// carrying many commits are far larger than REST API requests.
+	maxGitHubBody = 5 << 20
+	// maxPushCommits is how many commits a push card lists.
+	maxPushCommits = 5
+)
+
+// githubEventKinds are the kinds /watch repo can subscribe to.
+var githubEventKinds = []string{"push", "pr", "ci"}
+
+var githubRepoRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`)
+
+// githubPayload holds the fields of the push, pull_request, workflow_run
+// and status events the cards show.
+type githubPayload struct {
+	Action     string `json:"action"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Sender struct {
+		Login string `json:"login"`
+	} `json:"sender"`
+
+	// push
+	Ref     string `json:"ref"`
+	Deleted bool   `json:"deleted"`
+	Forced  bool   `json:"forced"`
+	Compare string `json:"compare"`
+	Pusher  struct {
+		Name string `json:"name"`
+	} `json:"pusher"`
+	Commits []struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+		URL     string `json:"url"`
+		Author  struct {
+			Name string `json:"name"`
+		} `json:"author"`
+	} `json:"commits"`
+
+	// pull_request
+	PullRequest struct {
+		Number  int    `json:"number"`
+		Title   string `json:"title"`
+		Body    string `json:"body"`
+		HTMLURL string `json:"html_url"`
+		Merged  bool   `json:"merged"`
+		User    struct {
+			Login string `json:"login"`
+		} `json:"user"`
+		Head struct {
+			Ref string `json:"ref"`
+		} `json:"head"`
+		Base struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+	} `json:"pull_request"`
+
+	// workflow_run
+	WorkflowRun struct {
+		Name       string `json:"name"`
+		HeadBranch string `json:"head_branch"`
+		HeadSHA    string `json:"head_sha"`
+		Conclusion string `json:"conclusion"`
+		HTMLURL    string `json:"html_url"`
+	} `json:"workflow_run"`
+
+	// status
+	State       string `json:"state"`
+	Context     string `json:"context"`
+	Description string `json:"description"`
+	TargetURL   string `json:"target_url"`
+	SHA         string `json:"sha"`
+	Branches    []struct {
+		Name string `json:"name"`
+	} `json:"branches"`
+}
+
+// validGitHubSignature reports whether signature, the X-Hub-Signature-256
+// header, is the HMAC-SHA256 of body under secret.
+func validGitHubSignature(secret string, body []byte, signature string) bool {
+	sum, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sum)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// handleGitHub accepts a GitHub webhook delivery and forwards it to the
+// chats subscribed to its repository.
+func (w *WebServer) handleGitHub(rw http.ResponseWriter, req *http.Request) {
+	secret, ok := w.router.secrets.Get(githubWebhookSecret)
+	if !ok {
+		http.NotFound(rw, req)
+		return
+	}
+	if req.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(rw, req.Body, maxGitHubBody))
+	if err != nil {
+		http.Error(rw, "payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !validGitHubSignature(secret, body, req.Header.Get("X-Hub-Signature-256")) {
+		http.Error(rw, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	event := req.Header.Get("X-GitHub-Event")
+	if event == "ping" {
+		rw.Write([]byte("pong"))
+		return
+	}
+	var p githubPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		http.Error(rw, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	w.router.handleGitHubEvent(req.Context(), event, &p)
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// handleGitHubEvent sends the card for a webhook event to the chats
+// subscribed to its repository and kind. Events without a card are
+// ignored.
+func (r *Router) handleGitHubEvent(ctx context.Context, event string, p *githubPayload) {
+	kind, card, ok := githubEventCard(event, p)
+	if !ok {
+		return
+	}
+	repo := strings.ToLower(p.Repository.FullName)
+	for _, sub := range r.store.RepoSubscriptions("") {
+		if sub.Repo == repo && sub.wants(kind) {
+			slog.Info("github: event forwarded", "event", event, "repo", repo, "chat_id", sub.ChatID)
+			r.sender.SendCard(ctx, sub.ChatID, card)
+		}
+	}
+}
+
+// githubEventCard renders a webhook event as a card and returns the kind
+// of event subscriptions filter it by.
+func githubEventCard(event string, p *githubPayload) (kind string, card CardMsg, ok bool) {
+	repo := p.Repository.FullName
+	switch event {
+	case "push":
+		if p.Deleted {
+			return "", CardMsg{}, false
+		}
+		return "push", pushCard(repo, p), true
+	case "pull_request":
+		pr := p.PullRequest
+		title := fmt.Sprintf("#%d %s", pr.Number, pr.Title)
+		switch {
+		case p.Action == "opened" || p.Action == "reopened" || p.Action == "ready_for_review":
+			card = CardMsg{Title: fmt.Sprintf("🔀 %s: %s 打开了 PR %s", repo, pr.User.Login, title), Template: "blue"}
+		case p.Action == "closed" && pr.Merged:
+			card = CardMsg{Title: fmt.Sprintf("✅ %s: %s 合并了 PR %s", repo, p.Sender.Login, title), Template: "green"}
+		case p.Action == "closed":
+			card = CardMsg{Title: fmt.Sprintf("🚫 %s: %s 关闭了 PR %s", repo, p.Sender.Login, title), Template: "grey"}
+		default:
+			return "", CardMsg{}, false
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "**作者:** %s\n**分支:** %s → %s\n", pr.User.Login, pr.Head.Ref, pr.Base.Ref)
+		if body := strings.TrimSpace(pr.Body); body != "" && p.Action != "closed" {
+			fmt.Fprintf(&sb, "\n%s\n", truncateRunes(body, 300))
+		}
+		fmt.Fprintf(&sb, "\n[查看 PR](%s)", pr.HTMLURL)
+		card.Content = sb.String()
+		return "pr", card, true
+	case "workflow_run":
+		run := p.WorkflowRun
+		if p.Action != "completed" {
+			return "", CardMsg{}, false
+		}
+		title, template, ok := ciResult(run.Conclusion)
+		if !ok {
+			return "", CardMsg{}, false
+		}
+		return "ci", CardMsg{
+			Title:    fmt.Sprintf("%s %s: %s %s", title, repo, run.Name, run.HeadBranch),
+			Content:  fmt.Sprintf("**提交:** `%s`\n**结果:** %s\n\n[查看运行](%s)", shortHash(run.HeadSHA), run.Conclusion, run.HTMLURL),
+			Template: template,
+		}, true
+	case "status":
+		title, template, ok := ciResult(p.State)
+		if !ok {
+			return "", CardMsg{}, false
+		}
+		var branches []string
+		for _, b := range p.Branches {
+			branches = append(branches, b.Name)
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "**提交:** `%s`", shortHash(p.SHA))
+		if len(branches) > 0 {
+			fmt.Fprintf(&sb, "（%s）", strings.Join(branches, ", "))
+		}
+		if p.Description != "" {
+			fmt.Fprintf(&sb, "\n**说明:** %s", p.Description)
+		}
+		if p.TargetURL != "" {
+			fmt.Fprintf(&sb, "\n\n[查看详情](%s)", p.TargetURL)
+		}
+		return "ci", CardMsg{Title: fmt.Sprintf("%s %s: %s", title, repo, p.Context), Content: sb.String(), Template: template}, true
+	}
+	return "", CardMsg{}, false
+}
+
+// ciResult maps a workflow conclusion or commit status to a card title
+// prefix and color; pending and skipped results have no card.
+func ciResult(state string) (title, template string, ok bool) {
+	switch state {
+	case "success":
+		return "✅ CI 通过", "green", true
+	case "failure", "error", "timed_out", "startup_failure":
+		return "❌ CI 失败", "red", true
+	case "cancelled":
+		return "⏹ CI 已取消", "grey", true
+	}
+	return "", "", false
+}
+
+func pushCard(repo string, p *githubPayload) CardMsg {
+	pusher := p.Pusher.Name
+	if pusher == "" {
+		pusher = p.Sender.Login
+	}
+	var title string
+	if tag, ok := strings.CutPrefix(p.Ref, "refs/tags/"); ok {
+		title = fmt.Sprintf("🏷 %s: %s 推送了标签 %s", repo, pusher, tag)
+	} else {
+		title = fmt.Sprintf("📦 %s: %s 推送了 %d 个提交到 %s", repo, pusher, len(p.Commits), strings.TrimPrefix(p.Ref, "refs/heads/"))
+	}
+	if p.Forced {
+		title += "（强制推送）"
+	}
+	var sb strings.Builder
+	for i, c := range p.Commits {
+		if i == maxPushCommits {
+			fmt.Fprintf(&sb, "…还有 %d 个提交\n", len(p.Commits)-maxPushCommits)
+			break
+		}
+		msg, _, _ := strings.Cut(c.Message, "\n")
+		fmt.Fprintf(&sb, "- [`%s`](%s) %s — %s\n", shortHash(c.ID), c.URL, truncateRunes(msg, 80), c.Author.Name)
+	}
+	if p.Compare != "" {
+		fmt.Fprintf(&sb, "\n[查看差异](%s)", p.Compare)
+	}
+	return CardMsg{Title: title, Content: strings.TrimSpace(sb.String()), Template: "blue"}
+}
+
+// normalizeGitHubRepo turns "owner/name", a github.com URL or a clone URL
+// into lower-case "owner/name".
+func normalizeGitHubRepo(s string) (string, bool) {
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "/"), ".git")
+	for _, prefix := range []string{"https://github.com/", "http://github.com/", "git@github.com:", "github.com/"} {
+		s = strings.TrimPrefix(s, prefix)
+	}
+	if !githubRepoRe.MatchString(s) {
+		return "", false
+	}
+	return strings.ToLower(s), true
+}
+
+// cmdWatchRepo implements /watch repo: subscribing the chat to the GitHub
+// webhook events of a repository.
+func (r *Router) cmdWatchRepo(ctx context.Context, chatID, args string) {
+	usage := "用法:\n/watch repo <owner/name> [push,pr,ci]  订阅仓库的 GitHub 事件（默认全部）\n/watch repo list  查看订阅\n/watch repo rm <owner/name>  取消订阅"
+	fields := strings.Fields(args)
+	if len(fields) == 0 || fields[0] == "list" {
+		r.listRepoSubscriptions(ctx, chatID)
+		return
+	}
+	if fields[0] == "rm" {
+		if len(fields) != 2 {
+			r.sender.SendText(ctx, chatID, usage)
+			return
+		}
+		repo, _ := normalizeGitHubRepo(fields[1])
+		if !r.store.RemoveRepoSubscription(chatID, repo) {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("本聊天没有订阅 %s。", fields[1]))
+			return
+		}
+		r.save()
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已取消订阅 %s", repo))
+		return
+	}
+	if len(fields) > 2 {
+		r.sender.SendText(ctx, chatID, usage)
+		return
+	}
+	repo, ok := normalizeGitHubRepo(fields[0])
+	if !ok {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("无效的仓库: %s，应为 owner/name。", fields[0]))
+		return
+	}
+	var events []string
+	if len(fields) == 2 {
+		for _, e := range strings.Split(fields[1], ",") {
+			if !containsWord(githubEventKinds, e) {
+				r.sender.SendText(ctx, chatID, fmt.Sprintf("未知的事件类型: %s（可选 %s）", e, strings.Join(githubEventKinds, ", ")))
+				return
+			}
+			if !containsWord(events, e) {
+				events = append(events, e)
+			}
+		}
+	}
+	r.store.SetRepoSubscription(RepoSubscription{ChatID: chatID, Repo: repo, Events: events, CreatedAt: time.Now()})
+	r.save()
+	msg := fmt.Sprintf("✓ 已订阅 %s 的 %s 事件。\n\n在 GitHub 仓库 Settings → Webhooks 中添加 %s，Content type 选 application/json，Secret 与密钥 %s 一致。",
+		repo, formatEventKinds(events), r.githubWebhookURL(), githubWebhookSecret)
+	if _, ok := r.secrets.Get(githubWebhookSecret); !ok {
+		msg += fmt.Sprintf("\n\n⚠️ 尚未配置密钥 %s，devbot 暂不接收 GitHub webhook。", githubWebhookSecret)
+	}
+	r.sender.SendText(ctx, chatID, msg)
+}
+
+func (r *Router) listRepoSubscriptions(ctx context.Context, chatID string) {
+	subs := r.store.RepoSubscriptions(chatID)
+	if len(subs) == 0 {
+		r.sender.SendText(ctx, chatID, "本聊天没有订阅 GitHub 仓库。使用 /watch repo <owner/name> 订阅。")
+		return
+	}
+	var sb strings.Builder
+	for _, sub := range subs {
+		fmt.Fprintf(&sb, "- `%s` %s（%s 订阅）\n", sub.Repo, formatEventKinds(sub.Events), sub.CreatedAt.Format("2006-01-02"))
+	}
+	fmt.Fprintf(&sb, "\nWebhook 地址: %s", r.githubWebhookURL())
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("GitHub 仓库订阅（%d）", len(subs)), Content: sb.String()})
+}
+
+// githubWebhookURL is the payload URL to configure on GitHub.
+func (r *Router) githubWebhookURL() string {
+	if r.guestURL != "" {
+		return r.guestURL + githubWebhookPath
+	}
+	return "<devbot Web 地址>" + githubWebhookPath
+}
+
+func formatEventKinds(events []string) string {
+	if len(events) == 0 {
+		return "全部"
+	}
+	return strings.Join(events, ", ")
+}
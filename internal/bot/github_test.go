@@ -0,0 +1,185 @@
+package bot
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// chatSpySender records which chat each card went to.
+type chatSpySender struct {
+	spySender
+	cardChats []string
+}
+
+func (s *chatSpySender) SendCard(ctx context.Context, chatID string, card CardMsg) error {
+	s.cardChats = append(s.cardChats, chatID)
+	return s.spySender.SendCard(ctx, chatID, card)
+}
+
+func githubRequest(w *WebServer, event, secret, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, githubWebhookPath, strings.NewReader(body))
+	req.Header.Set("X-GitHub-Event", event)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, req)
+	return rec
+}
+
+const pushPayload = `{
+	"ref": "refs/heads/main",
+	"compare": "https://github.com/Acme/Widget/compare/a...b",
+	"repository": {"full_name": "Acme/Widget"},
+	"pusher": {"name": "alice"},
+	"commits": [
+		{"id": "0123456789abcdef", "message": "Fix the frobnicator\n\nLong body", "url": "https://github.com/Acme/Widget/commit/0123456", "author": {"name": "Alice"}},
+		{"id": "fedcba9876543210", "message": "Add tests", "url": "https://github.com/Acme/Widget/commit/fedcba9", "author": {"name": "Bob"}}
+	]
+}`
+
+func TestWatchRepo_Subscribe(t *testing.T) {
+	r, spy := newTestRouter(t)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "/watch repo https://github.com/Acme/Widget.git push,ci")
+	if msg := spy.LastMessage(); !strings.Contains(msg, "已订阅 acme/widget 的 push, ci 事件") || !strings.Contains(msg, "尚未配置密钥") {
+		t.Fatalf("subscribe reply = %q", msg)
+	}
+	subs := r.store.RepoSubscriptions("chat1")
+	if len(subs) != 1 || subs[0].Repo != "acme/widget" || strings.Join(subs[0].Events, ",") != "push,ci" {
+		t.Fatalf("subscriptions = %+v", subs)
+	}
+
+	// Subscribing again replaces the event filter.
+	r.Route(ctx, "chat1", "user1", "/watch repo acme/widget")
+	if subs := r.store.RepoSubscriptions("chat1"); len(subs) != 1 || len(subs[0].Events) != 0 {
+		t.Fatalf("resubscribed = %+v", subs)
+	}
+	r.Route(ctx, "chat1", "user1", "/watch repo list")
+	if msg := spy.LastMessage(); !strings.Contains(msg, "`acme/widget` 全部") {
+		t.Fatalf("list = %q", msg)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/watch repo acme/widget deploy")
+	if msg := spy.LastMessage(); !strings.Contains(msg, "未知的事件类型: deploy") {
+		t.Fatalf("bad event reply = %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "/watch repo not-a-repo")
+	if msg := spy.LastMessage(); !strings.Contains(msg, "无效的仓库") {
+		t.Fatalf("bad repo reply = %q", msg)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/watch repo rm Acme/Widget")
+	if msg := spy.LastMessage(); !strings.Contains(msg, "已取消订阅 acme/widget") {
+		t.Fatalf("rm reply = %q", msg)
+	}
+	if subs := r.store.RepoSubscriptions(""); len(subs) != 0 {
+		t.Fatalf("subscriptions after rm = %+v", subs)
+	}
+}
+
+func TestGitHubWebhook_RoutesToSubscribedChats(t *testing.T) {
+	t.Setenv("DEVBOT_SECRET_GITHUB_WEBHOOK_SECRET", "s3cret")
+	r, _ := newTestRouter(t)
+	spy := &chatSpySender{}
+	r.sender = spy
+	r.store.SetRepoSubscription(RepoSubscription{ChatID: "chat1", Repo: "acme/widget"})
+	r.store.SetRepoSubscription(RepoSubscription{ChatID: "chat2", Repo: "acme/widget", Events: []string{"ci"}})
+	r.store.SetRepoSubscription(RepoSubscription{ChatID: "chat3", Repo: "acme/other"})
+	w := NewWebServer(r, "dash")
+
+	if rec := githubRequest(w, "push", "s3cret", pushPayload); rec.Code != http.StatusNoContent {
+		t.Fatalf("push status = %d: %s", rec.Code, rec.Body)
+	}
+	if strings.Join(spy.cardChats, ",") != "chat1" {
+		t.Fatalf("push went to %v", spy.cardChats)
+	}
+	msg := spy.LastMessage()
+	for _, want := range []string{"Acme/Widget: alice 推送了 2 个提交到 main", "[`0123456`](https://github.com/Acme/Widget/commit/0123456) Fix the frobnicator — Alice", "查看差异"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("push card missing %q:\n%s", want, msg)
+		}
+	}
+	if strings.Contains(msg, "Long body") {
+		t.Errorf("push card includes commit body:\n%s", msg)
+	}
+
+	spy.cardChats = nil
+	run := `{"action":"completed","repository":{"full_name":"acme/widget"},"workflow_run":{"name":"test","head_branch":"main","head_sha":"0123456789","conclusion":"failure","html_url":"https://github.com/acme/widget/actions/runs/1"}}`
+	if rec := githubRequest(w, "workflow_run", "s3cret", run); rec.Code != http.StatusNoContent {
+		t.Fatalf("workflow_run status = %d", rec.Code)
+	}
+	if strings.Join(spy.cardChats, ",") != "chat1,chat2" {
+		t.Fatalf("workflow_run went to %v", spy.cardChats)
+	}
+	if msg := spy.LastMessage(); !strings.Contains(msg, "❌ CI 失败 acme/widget: test main") {
+		t.Errorf("workflow_run card = %q", msg)
+	}
+}
+
+func TestGitHubWebhook_RejectsBadSignature(t *testing.T) {
+	t.Setenv("DEVBOT_SECRET_GITHUB_WEBHOOK_SECRET", "s3cret")
+	r, spy := newTestRouter(t)
+	r.store.SetRepoSubscription(RepoSubscription{ChatID: "chat1", Repo: "acme/widget"})
+	w := NewWebServer(r, "dash")
+
+	if rec := githubRequest(w, "push", "wrong", pushPayload); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodPost, githubWebhookPath, strings.NewReader(pushPayload))
+	req.Header.Set("X-GitHub-Event", "push")
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unsigned status = %d, want 401", rec.Code)
+	}
+	if len(spy.messages) != 0 {
+		t.Fatalf("sent %v", spy.messages)
+	}
+	if rec := githubRequest(w, "ping", "s3cret", `{"zen":"hi"}`); rec.Code != http.StatusOK || rec.Body.String() != "pong" {
+		t.Fatalf("ping = %d %q", rec.Code, rec.Body)
+	}
+}
+
+func TestGitHubWebhook_DisabledWithoutSecret(t *testing.T) {
+	r, _ := newTestRouter(t)
+	w := NewWebServer(r, "dash")
+	if rec := githubRequest(w, "push", "", pushPayload); rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestGitHubEventCard(t *testing.T) {
+	cases := []struct {
+		event, payload string
+		kind, title    string
+	}{
+		{"pull_request", `{"action":"opened","repository":{"full_name":"a/b"},"pull_request":{"number":7,"title":"Add X","html_url":"u","user":{"login":"carol"},"head":{"ref":"x"},"base":{"ref":"main"}}}`, "pr", "🔀 a/b: carol 打开了 PR #7 Add X"},
+		{"pull_request", `{"action":"closed","repository":{"full_name":"a/b"},"sender":{"login":"dave"},"pull_request":{"number":7,"title":"Add X","merged":true}}`, "pr", "✅ a/b: dave 合并了 PR #7 Add X"},
+		{"pull_request", `{"action":"labeled","repository":{"full_name":"a/b"}}`, "", ""},
+		{"status", `{"state":"success","context":"ci/jenkins","sha":"abcdef123456","repository":{"full_name":"a/b"},"branches":[{"name":"main"}]}`, "ci", "✅ CI 通过 a/b: ci/jenkins"},
+		{"status", `{"state":"pending","context":"ci/jenkins","repository":{"full_name":"a/b"}}`, "", ""},
+		{"workflow_run", `{"action":"requested","repository":{"full_name":"a/b"}}`, "", ""},
+		{"push", `{"ref":"refs/heads/gone","deleted":true,"repository":{"full_name":"a/b"}}`, "", ""},
+		{"push", `{"ref":"refs/tags/v1.2.0","forced":false,"pusher":{"name":"eve"},"repository":{"full_name":"a/b"}}`, "push", "🏷 a/b: eve 推送了标签 v1.2.0"},
+		{"issues", `{"action":"opened","repository":{"full_name":"a/b"}}`, "", ""},
+	}
+	for _, c := range cases {
+		var p githubPayload
+		if err := json.Unmarshal([]byte(c.payload), &p); err != nil {
+			t.Fatal(err)
+		}
+		kind, card, ok := githubEventCard(c.event, &p)
+		if ok != (c.kind != "") || kind != c.kind || card.Title != c.title {
+			t.Errorf("%s %s = %q %q %v, want %q %q", c.event, c.payload, kind, card.Title, ok, c.kind, c.title)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultGuestExpiry is how long a /guest link stays valid unless the
+	// command gives a duration; maxGuestExpiry caps it.
+	defaultGuestExpiry = 72 * time.Hour
+	maxGuestExpiry     = 30 * 24 * time.Hour
+)
+
+// SetGuestURL sets the public base URL of the web server that /guest links
+// point to, e.g. "https://devbot.example.com". /guest is refused when unset.
+func (r *Router) SetGuestURL(url string) {
+	r.guestURL = strings.TrimRight(url, "/")
+}
+
+// parseGuestExpiry parses a /guest duration: hours such as "24h", days
+// such as "7d", or any Go duration.
+func parseGuestExpiry(s string) (time.Duration, bool) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		return time.Duration(n) * 24 * time.Hour, err == nil && n > 0
+	}
+	d, err := time.ParseDuration(s)
+	return d, err == nil && d > 0
+}
+
+func (r *Router) guestLinkURL(g GuestLink) string {
+	return r.guestURL + "/guest/" + g.Token
+}
+
+// cmdGuest creates, lists and revokes read-only web links to execution
+// results for people without access to the chat.
+func (r *Router) cmdGuest(ctx context.Context, chatID, args string) {
+	if r.guestURL == "" {
+		r.sender.SendText(ctx, chatID, "未配置访客链接，请在配置中设置 web_addr 和 public_url（外部可访问的网页地址）。")
+		return
+	}
+	usage := fmt.Sprintf("用法: /guest [执行ID] [有效期]\n       /guest list\n       /guest rm <ID>\n为执行结果生成只读网页链接，无需飞书或机器人权限即可查看。不写执行 ID 时使用最近一次执行；有效期如 24h、7d，默认 %d 小时，最长 %d 天。", int(defaultGuestExpiry.Hours()), int(maxGuestExpiry.Hours()/24))
+	fields := strings.Fields(args)
+	now := time.Now()
+	if len(fields) > 0 && fields[0] == "list" {
+		links := r.store.GuestLinks(chatID, now)
+		if len(links) == 0 {
+			r.sender.SendText(ctx, chatID, "当前聊天没有有效的访客链接。")
+			return
+		}
+		var sb strings.Builder
+		for _, g := range links {
+			fmt.Fprintf(&sb, "- `%s` 执行 `%s`（%s 过期）\n  %s\n", g.ID, g.ExecID, g.ExpiresAt.Format("01-02 15:04"), r.guestLinkURL(g))
+		}
+		sb.WriteString("\n`/guest rm <ID>` 提前撤销")
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("访客链接（%d）", len(links)), Content: sb.String()})
+		return
+	}
+	if len(fields) > 0 && fields[0] == "rm" {
+		if len(fields) != 2 {
+			r.sender.SendText(ctx, chatID, "用法: /guest rm <ID>")
+			return
+		}
+		if !r.store.RemoveGuestLink(chatID, fields[1]) {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("找不到访客链接: %s", fields[1]))
+			return
+		}
+		r.save()
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已撤销访客链接 %s", fields[1]))
+		return
+	}
+	if len(fields) > 2 {
+		r.sender.SendText(ctx, chatID, usage)
+		return
+	}
+
+	execID, expiry := "", defaultGuestExpiry
+	for _, f := range fields {
+		// Exec IDs are hex, so one could read as a number of days.
+		_, isExec := r.store.ExecRecord(f)
+		if d, ok := parseGuestExpiry(f); ok && !isExec {
+			if d > maxGuestExpiry {
+				d = maxGuestExpiry
+			}
+			expiry = d
+			continue
+		}
+		if execID != "" {
+			r.sender.SendText(ctx, chatID, usage)
+			return
+		}
+		execID = f
+	}
+	var rec ExecRecord
+	if execID == "" {
+		recs := r.store.ExecRecords(chatID, 1)
+		if len(recs) == 0 {
+			r.sender.SendText(ctx, chatID, "当前聊天还没有执行记录。")
+			return
+		}
+		rec = recs[0]
+	} else {
+		var ok bool
+		rec, ok = r.store.ExecRecord(execID)
+		if !ok || rec.ChatID != chatID {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("找不到执行记录: %s", execID))
+			return
+		}
+	}
+
+	g := GuestLink{ID: newExecID(), Token: newHookToken(), ChatID: chatID, ExecID: rec.ID, CreatedAt: now, ExpiresAt: now.Add(expiry)}
+	r.store.AddGuestLink(g)
+	r.save()
+	slog.InfoContext(ctx, "guest: link created", "chat_id", chatID, "guest", g.ID, "exec_id", rec.ID)
+	r.sender.SendCard(ctx, chatID, CardMsg{
+		Title:    "🔗 访客链接",
+		Content:  fmt.Sprintf("%s\n\n**内容:** %s\n**过期:** %s\n\n任何拿到链接的人都能查看这次执行的结果（只读）；已隐藏配置文件中的密钥。`/guest rm %s` 提前撤销。", r.guestLinkURL(g), truncateRunes(strings.Join(strings.Fields(rec.Prompt), " "), 60), g.ExpiresAt.Format("2006-01-02 15:04"), g.ID),
+		Template: "green",
+	})
+}
+
+// guestPage is what the guest result page shows; text is redacted.
+type guestPage struct {
+	Prompt    string
+	Output    string
+	Error     string
+	Project   string
+	Model     string
+	StartedAt time.Time
+	Duration  time.Duration
+	ExpiresAt time.Time
+}
+
+// handleGuest serves GET /guest/{token}: the result page of one execution,
+// readable by anyone with an unexpired link.
+func (w *WebServer) handleGuest(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r := w.router
+	g, ok := r.store.GuestLinkByToken(strings.TrimPrefix(req.URL.Path, "/guest/"), time.Now())
+	if !ok {
+		http.Error(rw, "链接无效或已过期", http.StatusNotFound)
+		return
+	}
+	rec, ok := r.store.ExecRecord(g.ExecID)
+	if !ok {
+		http.Error(rw, "执行记录已不存在", http.StatusNotFound)
+		return
+	}
+	page := guestPage{
+		Prompt:    r.secrets.Redact(strings.TrimSpace(rec.Prompt)),
+		Output:    r.secrets.Redact(strings.TrimSpace(rec.Output)),
+		Error:     r.secrets.Redact(rec.Error),
+		Model:     rec.Model,
+		StartedAt: rec.StartedAt,
+		Duration:  rec.Duration,
+		ExpiresAt: g.ExpiresAt,
+	}
+	if rec.WorkDir != "" {
+		page.Project = filepath.Base(rec.WorkDir)
+	}
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Referrer-Policy", "no-referrer")
+	rw.Header().Set("X-Robots-Tag", "noindex")
+	if err := guestTemplate.Execute(rw, page); err != nil {
+		slog.Warn("web: render guest page", "err", err)
+	}
+}
+
+var guestTemplate = template.Must(template.New("guest").Funcs(template.FuncMap{
+	"clock": func(t time.Time) string { return t.Format("2006-01-02 15:04") },
+	"dur":   func(d time.Duration) string { return d.Truncate(time.Second).String() },
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>DevBot 执行结果</title>
+<style>
+body{font-family:sans-serif;margin:24px auto;max-width:960px;padding:0 16px;color:#1f2329}
+pre{white-space:pre-wrap;word-break:break-word;background:#f5f6f7;padding:12px;border-radius:6px;font-size:13px}
+.meta{color:#646a73;font-size:13px}.err{color:#d83931}
+</style></head><body>
+<h1>执行结果</h1>
+<p class="meta">{{clock .StartedAt}}{{if .Project}} · 项目 {{.Project}}{{end}}{{if .Model}} · {{.Model}}{{end}} · 耗时 {{dur .Duration}} · 链接 {{clock .ExpiresAt}} 过期</p>
+<h2>Prompt</h2>
+<pre>{{.Prompt}}</pre>
+{{if .Error}}<h2 class="err">错误</h2>
+<pre>{{.Error}}</pre>{{end}}
+{{if .Output}}<h2>输出</h2>
+<pre>{{.Output}}</pre>{{end}}
+</body></html>
+`))
@@ -0,0 +1,100 @@
+package bot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseGuestExpiry(t *testing.T) {
+	for s, want := range map[string]time.Duration{"24h": 24 * time.Hour, "7d": 7 * 24 * time.Hour, "90m": 90 * time.Minute} {
+		if d, ok := parseGuestExpiry(s); !ok || d != want {
+			t.Errorf("parseGuestExpiry(%q) = %v, %v", s, d, ok)
+		}
+	}
+	for _, s := range []string{"abc", "0d", "-1h", "e1"} {
+		if _, ok := parseGuestExpiry(s); ok {
+			t.Errorf("expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestRouterGuestLink(t *testing.T) {
+	r, sender := newTestRouter(t)
+	ctx := context.Background()
+	r.Route(ctx, "chat1", "user1", "/guest")
+	if !strings.Contains(sender.LastMessage(), "public_url") {
+		t.Fatalf("expected not configured message, got %q", sender.LastMessage())
+	}
+
+	path := filepath.Join(t.TempDir(), "secrets.yaml")
+	os.WriteFile(path, []byte("db_password: hunter22\n"), 0600)
+	secrets, _ := LoadSecrets(path)
+	r.SetSecrets(secrets)
+	r.SetGuestURL("https://devbot.example.com/")
+	r.store.AddExecRecord(ExecRecord{ID: "e1", ChatID: "chat1", Prompt: "deploy <api>", Output: "connected with hunter22", WorkDir: "/src/api", StartedAt: time.Now()})
+	r.store.AddExecRecord(ExecRecord{ID: "e2", ChatID: "chat2", Prompt: "other", StartedAt: time.Now()})
+
+	r.Route(ctx, "chat1", "user1", "/guest e2")
+	if !strings.Contains(sender.LastMessage(), "找不到执行记录") {
+		t.Fatalf("expected another chat's record to be refused, got %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "user1", "/guest 2d")
+	m := regexp.MustCompile(`https://devbot\.example\.com/guest/(\w+)`).FindStringSubmatch(sender.LastMessage())
+	if m == nil {
+		t.Fatalf("expected guest link, got %q", sender.LastMessage())
+	}
+	links := r.store.GuestLinks("chat1", time.Now())
+	if len(links) != 1 || links[0].ExecID != "e1" || links[0].ExpiresAt.Sub(links[0].CreatedAt) != 48*time.Hour {
+		t.Fatalf("unexpected links %+v", links)
+	}
+
+	web := NewWebServer(r, "secret")
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		web.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	res := get("/guest/" + m[1])
+	body := res.Body.String()
+	if res.Code != http.StatusOK || !strings.Contains(body, "deploy &lt;api&gt;") || !strings.Contains(body, "connected with [已隐藏]") || !strings.Contains(body, "项目 api") {
+		t.Fatalf("unexpected page %d %q", res.Code, body)
+	}
+	if res := get("/guest/wrong"); res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown token, got %d", res.Code)
+	}
+	if res := get("/"); res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the dashboard to still need its token, got %d", res.Code)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/guest list")
+	if !strings.Contains(sender.LastMessage(), links[0].ID) {
+		t.Fatalf("unexpected list %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "user1", "/guest rm "+links[0].ID)
+	if res := get("/guest/" + m[1]); res.Code != http.StatusNotFound {
+		t.Fatalf("expected revoked link to 404, got %d", res.Code)
+	}
+}
+
+func TestStoreGuestLinkExpiry(t *testing.T) {
+	store, _ := NewStore(filepath.Join(t.TempDir(), "state.json"))
+	now := time.Now()
+	store.AddGuestLink(GuestLink{ID: "g1", Token: "t1", ChatID: "c", CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)})
+	if _, ok := store.GuestLinkByToken("t1", now); ok {
+		t.Fatal("expected expired link to be rejected")
+	}
+	store.AddGuestLink(GuestLink{ID: "g2", Token: "t2", ChatID: "c", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	if _, ok := store.GuestLinkByToken("t2", now); !ok {
+		t.Fatal("expected valid link")
+	}
+	if store.RemoveGuestLink("c", "g1") {
+		t.Fatal("expected expired link to be dropped when adding")
+	}
+}
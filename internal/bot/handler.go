@@ -5,11 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"regexp"
 	"strings"
 
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
 	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
 )
 
@@ -19,6 +20,51 @@ type Sender interface {
 	SendCard(ctx context.Context, chatID string, card CardMsg) error
 }
 
+// Reactor is implemented by senders that can add emoji reactions to
+// messages. AddReaction returns the reaction's ID for RemoveReaction.
+type Reactor interface {
+	AddReaction(ctx context.Context, messageID, emojiType string) (string, error)
+	RemoveReaction(ctx context.Context, messageID, reactionID string) error
+}
+
+// FileSender is implemented by senders that can post file attachments.
+// Callers fall back to text when the sender does not support it.
+type FileSender interface {
+	SendFile(ctx context.Context, chatID, fileName string, data []byte) error
+}
+
+// ImageSender is implemented by senders that can post images shown inline
+// in the chat; callers fall back to FileSender when it is not supported.
+type ImageSender interface {
+	SendImage(ctx context.Context, chatID, fileName string, data []byte) error
+}
+
+// DriveUploader is implemented by senders that can upload a file to cloud
+// storage and share it with a chat, for files the chat does not accept.
+// UploadToDrive returns the file's link.
+type DriveUploader interface {
+	UploadToDrive(ctx context.Context, chatID, fileName string, data []byte) (string, error)
+}
+
+// HistoryReader is implemented by senders that can read a chat's recent
+// messages, returned oldest first (see /catchup).
+type HistoryReader interface {
+	RecentMessages(ctx context.Context, chatID string, n int) ([]ChatMessage, error)
+}
+
+// ForwardReader is implemented by senders that can read the messages held
+// in a merged forward (合并转发), returned oldest first.
+type ForwardReader interface {
+	ForwardedMessages(ctx context.Context, messageID string) ([]ForwardedMessage, error)
+}
+
+// Pinner is implemented by senders that can pin a card to the top of a
+// chat (see /incident). PinCard returns the ID of the pinned message.
+type Pinner interface {
+	PinCard(ctx context.Context, chatID string, card CardMsg) (string, error)
+	Unpin(ctx context.Context, messageID string) error
+}
+
 type ImageAttachment struct {
 	Data     []byte
 	FileName string
@@ -30,6 +76,7 @@ type MessageRouter interface {
 	RouteFile(ctx context.Context, chatID, userID, fileName string, fileData []byte)
 	RouteDocShare(ctx context.Context, chatID, userID, docID string)
 	RouteTextWithImages(ctx context.Context, chatID, userID, text string, images []ImageAttachment)
+	RouteForward(ctx context.Context, chatID, userID string, fwd Forward)
 }
 
 // Downloader downloads images and files from Feishu.
@@ -45,7 +92,14 @@ type Downloader interface {
 const maxImageSize = 10 << 20 // 10 MB
 const maxFileSize = 50 << 20  // 50 MB
 
-var feishuDocURLPattern = regexp.MustCompile(`https?://[a-zA-Z0-9.-]*feishu\.cn/docx/([a-zA-Z0-9]+)`)
+// maxForwardImages and maxForwardFiles bound the attachments downloaded
+// from one merged forward; later ones are only named in the transcript.
+const (
+	maxForwardImages = 5
+	maxForwardFiles  = 5
+)
+
+var feishuDocURLPattern = regexp.MustCompile(`https?://[a-zA-Z0-9.-]*feishu\.cn/(docx|wiki)/([a-zA-Z0-9]+)`)
 
 type Handler struct {
 	router       MessageRouter
@@ -142,8 +196,9 @@ func (h *Handler) HandleMessage(ctx context.Context, evt *larkim.P2MessageReceiv
 	chatID := env.Event.Message.ChatID
 	userID := h.resolveUserID(env)
 	messageID := env.Event.Message.MessageID
+	ctx = withMessageID(ctx, messageID)
 
-	log.Printf("handler: received %s from user=%s chat=%s", env.Event.Message.MessageType, userID, chatID)
+	slog.InfoContext(ctx, "handler: received", "type", env.Event.Message.MessageType, "user_id", userID, "chat_id", chatID)
 
 	switch env.Event.Message.MessageType {
 	case "text":
@@ -181,6 +236,9 @@ func (h *Handler) HandleMessage(ctx context.Context, evt *larkim.P2MessageReceiv
 
 	case "file":
 		h.handleFile(ctx, chatID, userID, messageID, env.Event.Message.Content)
+
+	case "merge_forward":
+		h.handleMergeForward(ctx, chatID, userID, messageID)
 	}
 
 	return nil
@@ -189,20 +247,20 @@ func (h *Handler) HandleMessage(ctx context.Context, evt *larkim.P2MessageReceiv
 func (h *Handler) handleImage(ctx context.Context, chatID, userID, messageID, rawContent string) {
 	var content imageContent
 	if err := json.Unmarshal([]byte(rawContent), &content); err != nil {
-		log.Printf("handler: failed to parse image content: %v", err)
+		slog.WarnContext(ctx, "handler: failed to parse image content", "err", err)
 		return
 	}
 	if content.ImageKey == "" {
 		return
 	}
 	if h.downloader == nil {
-		log.Println("handler: downloader not configured, cannot download image")
+		slog.WarnContext(ctx, "handler: downloader not configured, cannot download image")
 		return
 	}
 
 	reader, err := h.downloader.DownloadImage(ctx, messageID, content.ImageKey)
 	if err != nil {
-		log.Printf("handler: failed to download image %s: %v", content.ImageKey, err)
+		slog.WarnContext(ctx, "handler: failed to download image", "image_key", content.ImageKey, "err", err)
 		if h.sender != nil {
 			h.sender.SendText(ctx, chatID, fmt.Sprintf("Failed to download image: %v", err))
 		}
@@ -212,11 +270,11 @@ func (h *Handler) handleImage(ctx context.Context, chatID, userID, messageID, ra
 
 	data, err := io.ReadAll(io.LimitReader(reader, maxImageSize+1))
 	if err != nil {
-		log.Printf("handler: failed to read image data: %v", err)
+		slog.WarnContext(ctx, "handler: failed to read image data", "err", err)
 		return
 	}
 	if len(data) > maxImageSize {
-		log.Printf("handler: image %s exceeds max size (%d bytes)", content.ImageKey, maxImageSize)
+		slog.WarnContext(ctx, "handler: image exceeds max size", "image_key", content.ImageKey, "max_bytes", maxImageSize)
 		if h.sender != nil {
 			h.sender.SendText(ctx, chatID, fmt.Sprintf("Image too large (max %d MB)", maxImageSize>>20))
 		}
@@ -238,20 +296,20 @@ func (h *Handler) handleImage(ctx context.Context, chatID, userID, messageID, ra
 func (h *Handler) handleFile(ctx context.Context, chatID, userID, messageID, rawContent string) {
 	var content fileContent
 	if err := json.Unmarshal([]byte(rawContent), &content); err != nil {
-		log.Printf("handler: failed to parse file content: %v", err)
+		slog.WarnContext(ctx, "handler: failed to parse file content", "err", err)
 		return
 	}
 	if content.FileKey == "" {
 		return
 	}
 	if h.downloader == nil {
-		log.Println("handler: downloader not configured, cannot download file")
+		slog.WarnContext(ctx, "handler: downloader not configured, cannot download file")
 		return
 	}
 
 	reader, serverName, err := h.downloader.DownloadFile(ctx, messageID, content.FileKey)
 	if err != nil {
-		log.Printf("handler: failed to download file %s: %v", content.FileKey, err)
+		slog.WarnContext(ctx, "handler: failed to download file", "file_key", content.FileKey, "err", err)
 		if h.sender != nil {
 			h.sender.SendText(ctx, chatID, fmt.Sprintf("Failed to download file: %v", err))
 		}
@@ -261,11 +319,11 @@ func (h *Handler) handleFile(ctx context.Context, chatID, userID, messageID, raw
 
 	data, err := io.ReadAll(io.LimitReader(reader, maxFileSize+1))
 	if err != nil {
-		log.Printf("handler: failed to read file data: %v", err)
+		slog.WarnContext(ctx, "handler: failed to read file data", "err", err)
 		return
 	}
 	if len(data) > maxFileSize {
-		log.Printf("handler: file %s exceeds max size (%d bytes)", content.FileKey, maxFileSize)
+		slog.WarnContext(ctx, "handler: file exceeds max size", "file_key", content.FileKey, "max_bytes", maxFileSize)
 		if h.sender != nil {
 			h.sender.SendText(ctx, chatID, fmt.Sprintf("File too large (max %d MB)", maxFileSize>>20))
 		}
@@ -297,6 +355,27 @@ func (h *Handler) resolveUserID(env eventEnvelope) string {
 	return openID // fallback to open_id (router will log unauthorized)
 }
 
+// HandleCardAction runs the command carried by a clicked card button as if
+// the clicking user had sent it.
+func (h *Handler) HandleCardAction(ctx context.Context, event *callback.CardActionTriggerEvent) (*callback.CardActionTriggerResponse, error) {
+	if event == nil || event.Event == nil || event.Event.Action == nil || event.Event.Context == nil || event.Event.Operator == nil {
+		return nil, nil
+	}
+	command, _ := event.Event.Action.Value["command"].(string)
+	chatID := event.Event.Context.OpenChatID
+	if command == "" || chatID == "" {
+		return nil, nil
+	}
+	op := event.Event.Operator
+	userID := op.OpenID
+	if !h.allowedUsers[userID] && op.UserID != nil && h.allowedUsers[*op.UserID] {
+		userID = *op.UserID
+	}
+	slog.InfoContext(ctx, "handler: card action", "command", command, "user_id", userID, "chat_id", chatID)
+	h.router.Route(ctx, chatID, userID, command)
+	return &callback.CardActionTriggerResponse{Toast: &callback.Toast{Type: "info", Content: "已提交 " + command}}, nil
+}
+
 func (h *Handler) isMentioned(env eventEnvelope) bool {
 	for _, m := range env.Event.Message.Mentions {
 		if m.ID.OpenID == h.botID {
@@ -317,7 +396,7 @@ func (h *Handler) cleanMentions(text string, env eventEnvelope) string {
 func (h *Handler) handlePost(ctx context.Context, chatID, userID, messageID string, env eventEnvelope) {
 	var pc postContent
 	if err := json.Unmarshal([]byte(env.Event.Message.Content), &pc); err != nil {
-		log.Printf("handler: failed to parse post content: %v", err)
+		slog.WarnContext(ctx, "handler: failed to parse post content", "err", err)
 		return
 	}
 
@@ -372,24 +451,24 @@ func (h *Handler) handlePost(ctx context.Context, chatID, userID, messageID stri
 // downloadPostImageData downloads an image from a post message and returns the data.
 func (h *Handler) downloadPostImageData(ctx context.Context, chatID, messageID, imageKey string) *ImageAttachment {
 	if h.downloader == nil {
-		log.Println("handler: downloader not configured, cannot download image")
+		slog.WarnContext(ctx, "handler: downloader not configured, cannot download image")
 		return nil
 	}
 
 	reader, err := h.downloader.DownloadImage(ctx, messageID, imageKey)
 	if err != nil {
-		log.Printf("handler: failed to download post image %s: %v", imageKey, err)
+		slog.WarnContext(ctx, "handler: failed to download post image", "image_key", imageKey, "err", err)
 		return nil
 	}
 	defer reader.Close()
 
 	data, err := io.ReadAll(io.LimitReader(reader, maxImageSize+1))
 	if err != nil {
-		log.Printf("handler: failed to read post image data: %v", err)
+		slog.WarnContext(ctx, "handler: failed to read post image data", "err", err)
 		return nil
 	}
 	if len(data) > maxImageSize {
-		log.Printf("handler: post image %s exceeds max size", imageKey)
+		slog.WarnContext(ctx, "handler: post image exceeds max size", "image_key", imageKey)
 		return nil
 	}
 
@@ -406,11 +485,88 @@ func (h *Handler) downloadPostImageData(ctx context.Context, chatID, messageID,
 	return &ImageAttachment{Data: data, FileName: imageKey + ext}
 }
 
-// extractDocID finds the first Feishu doc URL in text and returns the document ID.
+// handleMergeForward unpacks a merged forward: its messages, with the
+// images and files they carry downloaded, are routed as one input.
+func (h *Handler) handleMergeForward(ctx context.Context, chatID, userID, messageID string) {
+	fr, ok := h.sender.(ForwardReader)
+	if !ok {
+		slog.WarnContext(ctx, "handler: sender cannot read merged forwards")
+		if h.sender != nil {
+			h.sender.SendText(ctx, chatID, "当前环境无法读取合并转发的消息。")
+		}
+		return
+	}
+	msgs, err := fr.ForwardedMessages(ctx, messageID)
+	if err != nil {
+		slog.WarnContext(ctx, "handler: failed to read merged forward", "err", err)
+		h.sender.SendText(ctx, chatID, fmt.Sprintf("读取合并转发的消息失败: %v", err))
+		return
+	}
+
+	var fwd Forward
+	for _, m := range msgs {
+		msg := m.ChatMessage
+		switch m.Type {
+		case "image":
+			var content imageContent
+			if json.Unmarshal([]byte(m.Content), &content) != nil || content.ImageKey == "" || len(fwd.Images) == maxForwardImages {
+				break
+			}
+			if att := h.downloadPostImageData(ctx, chatID, m.MessageID, content.ImageKey); att != nil {
+				fwd.Images = append(fwd.Images, *att)
+				msg.Text = fmt.Sprintf("[图片 %s]", att.FileName)
+			}
+		case "file":
+			var content fileContent
+			if json.Unmarshal([]byte(m.Content), &content) != nil || content.FileKey == "" {
+				break
+			}
+			msg.Text = fmt.Sprintf("[文件 %s]", content.FileName)
+			if len(fwd.Files) == maxForwardFiles {
+				break
+			}
+			if file := h.downloadForwardFile(ctx, m.MessageID, content); file != nil {
+				fwd.Files = append(fwd.Files, *file)
+			}
+		}
+		fwd.Messages = append(fwd.Messages, msg)
+	}
+	h.router.RouteForward(ctx, chatID, userID, fwd)
+}
+
+// downloadForwardFile downloads a file from a message of a merged forward.
+func (h *Handler) downloadForwardFile(ctx context.Context, messageID string, content fileContent) *ForwardFile {
+	if h.downloader == nil {
+		slog.WarnContext(ctx, "handler: downloader not configured, cannot download file")
+		return nil
+	}
+	reader, serverName, err := h.downloader.DownloadFile(ctx, messageID, content.FileKey)
+	if err != nil {
+		slog.WarnContext(ctx, "handler: failed to download forwarded file", "file_key", content.FileKey, "err", err)
+		return nil
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(io.LimitReader(reader, maxFileSize+1))
+	if err != nil || len(data) > maxFileSize {
+		slog.WarnContext(ctx, "handler: forwarded file unreadable or too large", "file_key", content.FileKey, "err", err)
+		return nil
+	}
+	name := content.FileName
+	if name == "" {
+		name = serverName
+	}
+	return &ForwardFile{Name: name, Data: data}
+}
+
+// extractDocID finds the first Feishu doc or wiki URL in text and returns
+// the document ID, "wiki:TOKEN" for wiki pages (see ParseDocID).
 func extractDocID(text string) string {
 	m := feishuDocURLPattern.FindStringSubmatch(text)
-	if len(m) >= 2 {
-		return m[1]
+	if len(m) < 3 {
+		return ""
+	}
+	if m[1] == "wiki" {
+		return wikiPrefix + m[2]
 	}
-	return ""
+	return m[2]
 }
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
 	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
 )
 
@@ -23,6 +24,7 @@ type fakeRouter struct {
 	fileName  string
 	docID     string
 	images    []ImageAttachment
+	forward   *Forward
 }
 
 func (f *fakeRouter) Route(_ context.Context, chatID, userID, text string) {
@@ -63,6 +65,13 @@ func (f *fakeRouter) RouteTextWithImages(_ context.Context, chatID, userID, text
 	f.images = images
 }
 
+func (f *fakeRouter) RouteForward(_ context.Context, chatID, userID string, fwd Forward) {
+	f.called = true
+	f.chatID = chatID
+	f.userID = userID
+	f.forward = &fwd
+}
+
 // errReadCloser is an io.ReadCloser whose Read always fails.
 type errReadCloser struct{}
 
@@ -1136,7 +1145,8 @@ func TestExtractDocID(t *testing.T) {
 		{"https://feishu.cn/docx/XYZ789?query=1", "XYZ789"},
 		{"check this https://test.feishu.cn/docx/DOC456 out", "DOC456"},
 		{"no url here", ""},
-		{"https://abc.feishu.cn/wiki/something", ""},
+		{"https://abc.feishu.cn/wiki/something", "wiki:something"},
+		{"https://abc.feishu.cn/drive/folder/FLD1", ""},
 		{"", ""},
 	}
 	for _, tt := range tests {
@@ -1146,3 +1156,29 @@ func TestExtractDocID(t *testing.T) {
 		}
 	}
 }
+
+func TestHandleCardAction_RoutesCommand(t *testing.T) {
+	uid := "user1"
+	evt := &callback.CardActionTriggerEvent{Event: &callback.CardActionTriggerRequest{
+		Operator: &callback.Operator{OpenID: "ou_1", UserID: &uid},
+		Action:   &callback.CallBackAction{Value: map[string]interface{}{"command": "/confirm"}},
+		Context:  &callback.Context{OpenChatID: "oc_chat"},
+	}}
+	router := &fakeRouter{}
+	h := NewHandler(router, nil, nil, true, "bot_id", map[string]bool{"user1": true})
+	resp, err := h.HandleCardAction(context.Background(), evt)
+	if err != nil || resp == nil || resp.Toast == nil {
+		t.Fatalf("expected toast response, got %+v %v", resp, err)
+	}
+	if router.chatID != "oc_chat" || router.userID != "user1" || router.text != "/confirm" {
+		t.Fatalf("unexpected route %+v", router)
+	}
+
+	router = &fakeRouter{}
+	h = NewHandler(router, nil, nil, true, "bot_id", nil)
+	evt.Event.Action.Value = map[string]interface{}{}
+	h.HandleCardAction(context.Background(), evt)
+	if router.called {
+		t.Fatal("expected action without command to be ignored")
+	}
+}
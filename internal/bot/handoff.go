@@ -0,0 +1,119 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// maxHandoffPrompts is how many of the session's recent prompts the
+// handoff card lists.
+const maxHandoffPrompts = 5
+
+// cmdHandoff transfers the chat's current Claude session, with its workdir,
+// model and permission mode, to another chat, e.g. the private chat of the
+// engineer taking over in another timezone. The source chat starts a fresh
+// session so the two chats do not resume the same one.
+func (r *Router) cmdHandoff(ctx context.Context, chatID, args string) {
+	target, note, _ := strings.Cut(strings.TrimSpace(args), " ")
+	note = strings.TrimSpace(note)
+	if target == "" {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("用法: /handoff <聊天 ID> [备注]\n把当前会话（工作目录、Claude 会话、模型和权限模式）交接到另一个聊天，由对方继续同一个会话。\n\n本聊天 ID: %s（接手的人在自己的聊天中发送 /handoff 查看其 ID）", chatID))
+		return
+	}
+	if target == chatID {
+		r.sender.SendText(ctx, chatID, "不能交接给当前聊天。")
+		return
+	}
+	if _, ok := r.store.Sessions()[target]; !ok {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("未知的聊天 %s：接手的人需要先在该聊天中和机器人对话（例如发送 /handoff 查看聊天 ID）。", target))
+		return
+	}
+	for _, rec := range r.ActiveExecs() {
+		if rec.ChatID == chatID {
+			r.sender.SendText(ctx, chatID, "当前聊天有任务正在执行，请等待完成或 /kill 后再交接。")
+			return
+		}
+	}
+	src := r.getSession(chatID)
+	sessionID := src.ClaudeSessionID
+	if sessionID == "" {
+		r.sender.SendText(ctx, chatID, "当前没有可交接的会话，请先发送消息给 Claude。")
+		return
+	}
+
+	r.store.UpdateSession(target, func(s *Session) {
+		if s.ClaudeSessionID != "" {
+			s.History = append(s.History, s.ClaudeSessionID)
+		}
+		s.ClaudeSessionID = sessionID
+		s.WorkDir = src.WorkDir
+		s.Model = src.Model
+		s.PermissionMode = src.PermissionMode
+		s.Focus = src.Focus
+		s.LastPrompt = src.LastPrompt
+		s.LastOutput = src.LastOutput
+		if s.DirSessions == nil {
+			s.DirSessions = make(map[string]string)
+		}
+		s.DirSessions[src.WorkDir] = sessionID
+		if summary := src.Summaries[sessionID]; summary != "" {
+			if s.Summaries == nil {
+				s.Summaries = make(map[string]string)
+			}
+			s.Summaries[sessionID] = summary
+		}
+	})
+	r.store.UpdateSession(chatID, func(s *Session) {
+		s.History = append(s.History, sessionID)
+		s.ClaudeSessionID = ""
+		s.LastOutput = ""
+		if s.DirSessions[s.WorkDir] == sessionID {
+			delete(s.DirSessions, s.WorkDir)
+		}
+	})
+	r.save()
+	from := orDash(userIDFrom(ctx))
+	slog.InfoContext(ctx, "router: session handed off", "from_user", from, "session_id", sessionID, "chat_id", chatID, "to_chat", target)
+
+	r.sender.SendCard(ctx, target, CardMsg{
+		Title:    "🤝 会话交接: " + from,
+		Content:  handoffSummary(src, chatID, from, note, r.sessionPrompts(chatID, sessionID)),
+		Template: "blue",
+		Buttons:  []CardButton{{Text: "查看最后输出", Command: "/last", Type: "primary"}},
+	})
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已将会话 %s 交接到聊天 %s。本聊天已开启新对话，原会话保存在历史中；请不要与对方同时继续同一个会话。", sessionID, target))
+}
+
+// handoffSummary renders what the receiving chat needs to pick the session
+// up.
+func handoffSummary(src Session, fromChat, from, note string, prompts []string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**来自:** %s（聊天 %s）\n", from, fromChat)
+	if note != "" {
+		fmt.Fprintf(&sb, "**备注:** %s\n", note)
+	}
+	mode := src.PermissionMode
+	if mode == "" {
+		mode = "safe"
+	}
+	fmt.Fprintf(&sb, "**目录:** %s\n**会话:** %s\n**模型:** %s · **模式:** %s\n", src.WorkDir, src.ClaudeSessionID, orDash(src.Model), mode)
+	if summary := src.Summaries[src.ClaudeSessionID]; summary != "" {
+		fmt.Fprintf(&sb, "\n**摘要:** %s\n", summary)
+	}
+	if n := len(prompts); n > 0 {
+		if n > maxHandoffPrompts {
+			prompts = prompts[n-maxHandoffPrompts:]
+		}
+		sb.WriteString("\n**最近的请求:**\n")
+		for _, p := range prompts {
+			fmt.Fprintf(&sb, "- %s\n", truncateRunes(strings.Join(strings.Fields(p), " "), 80))
+		}
+	}
+	if out := strings.TrimSpace(src.LastOutput); out != "" {
+		fmt.Fprintf(&sb, "\n**最后输出:**\n%s\n", truncateRunes(out, 500))
+	}
+	sb.WriteString("\n直接发送消息即可继续这个会话，Claude 保留了之前的计划和上下文。")
+	return sb.String()
+}
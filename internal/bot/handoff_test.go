@@ -0,0 +1,89 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandoff_TransfersSession(t *testing.T) {
+	r, _ := newTestRouter(t)
+	sender := &chatSpySender{}
+	r.sender = sender
+	ctx := context.Background()
+	workDir := r.store.WorkRoot()
+
+	r.getSession("chat1")
+	r.store.UpdateSession("chat1", func(s *Session) {
+		s.ClaudeSessionID = "s1"
+		s.WorkDir = workDir
+		s.Model = "opus"
+		s.PermissionMode = "yolo"
+		s.LastOutput = "migrated half of the tables"
+		s.DirSessions = map[string]string{workDir: "s1"}
+		s.Summaries = map[string]string{"s1": "Database migration"}
+	})
+	r.store.AddExecRecord(ExecRecord{ID: "e1", ChatID: "chat1", SessionID: "s1", Prompt: "migrate the users table", StartedAt: time.Now()})
+	r.getSession("chat2")
+	r.store.UpdateSession("chat2", func(s *Session) { s.ClaudeSessionID = "s2" })
+
+	r.Route(ctx, "chat1", "user1", "/handoff chat2 continue with the orders table")
+	if strings.Join(sender.cardChats, ",") != "chat2" {
+		t.Fatalf("cards went to %v", sender.cardChats)
+	}
+	card := sender.messages[0]
+	for _, want := range []string{"会话交接: user1", "**来自:** user1（聊天 chat1）", "**备注:** continue with the orders table", "**会话:** s1", "**模型:** opus · **模式:** yolo", "**摘要:** Database migration", "- migrate the users table", "migrated half of the tables"} {
+		if !strings.Contains(card, want) {
+			t.Errorf("handoff card missing %q:\n%s", want, card)
+		}
+	}
+	if msg := sender.LastMessage(); !strings.Contains(msg, "已将会话 s1 交接到聊天 chat2") {
+		t.Fatalf("source reply = %q", msg)
+	}
+
+	dst := r.getSession("chat2")
+	if dst.ClaudeSessionID != "s1" || dst.WorkDir != workDir || dst.Model != "opus" || dst.PermissionMode != "yolo" || dst.DirSessions[workDir] != "s1" || dst.LastOutput == "" {
+		t.Fatalf("target session = %+v", dst)
+	}
+	if len(dst.History) != 1 || dst.History[0] != "s2" {
+		t.Fatalf("target history = %v", dst.History)
+	}
+	src := r.getSession("chat1")
+	if src.ClaudeSessionID != "" || src.DirSessions[workDir] != "" || len(src.History) != 1 || src.History[0] != "s1" {
+		t.Fatalf("source session = %+v", src)
+	}
+}
+
+func TestHandoff_Refusals(t *testing.T) {
+	r, spy := newTestRouter(t)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "/handoff")
+	if msg := spy.LastMessage(); !strings.Contains(msg, "本聊天 ID: chat1") {
+		t.Fatalf("usage = %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "/handoff chat1")
+	if msg := spy.LastMessage(); msg != "不能交接给当前聊天。" {
+		t.Fatalf("self = %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "/handoff chat9")
+	if msg := spy.LastMessage(); !strings.Contains(msg, "未知的聊天 chat9") {
+		t.Fatalf("unknown = %q", msg)
+	}
+	r.getSession("chat2")
+	r.Route(ctx, "chat1", "user1", "/handoff chat2")
+	if msg := spy.LastMessage(); !strings.Contains(msg, "当前没有可交接的会话") {
+		t.Fatalf("no session = %q", msg)
+	}
+
+	r.store.UpdateSession("chat1", func(s *Session) { s.ClaudeSessionID = "s1" })
+	r.setActive(ExecRecord{ID: "run1", ChatID: "chat1"})
+	r.Route(ctx, "chat1", "user1", "/handoff chat2")
+	if msg := spy.LastMessage(); !strings.Contains(msg, "有任务正在执行") {
+		t.Fatalf("busy = %q", msg)
+	}
+	if r.getSession("chat2").ClaudeSessionID != "" {
+		t.Fatal("session handed off while busy")
+	}
+}
@@ -0,0 +1,265 @@
+package bot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// gitHookNames are the hooks installed by /hooks install: they run after a
+// pull or merge and after switching branches.
+var gitHookNames = []string{"post-merge", "post-checkout"}
+
+// gitHookMarker identifies hook scripts written by devbot, so that they can
+// be replaced or removed without touching hooks installed by anyone else.
+const gitHookMarker = "# devbot-hook"
+
+// maxHookCommits bounds the commits listed in a repository change card.
+const maxHookCommits = 10
+
+// SetHookURL sets the base URL of the web server that installed git hooks
+// notify, e.g. "http://127.0.0.1:8080". /hooks install is refused when unset.
+func (r *Router) SetHookURL(url string) {
+	r.hookURL = strings.TrimRight(url, "/")
+}
+
+// newHookToken returns a random secret authenticating one hook installation.
+func newHookToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return newExecID() + newExecID()
+	}
+	return hex.EncodeToString(b)
+}
+
+// gitHooksDir returns the hooks directory of the repository containing
+// workDir, honouring core.hooksPath.
+func gitHooksDir(workDir string) (string, error) {
+	out, err := runGitOutput(workDir, "rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return "", fmt.Errorf("不是 git 仓库: %s", workDir)
+	}
+	if !filepath.IsAbs(out) {
+		out = filepath.Join(workDir, out)
+	}
+	return out, nil
+}
+
+// gitHookScript renders the hook that reports event to url. It never fails
+// the git command: the request runs in the background and errors are
+// discarded.
+func gitHookScript(event, url, token string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "#!/bin/sh\n%s: notifies devbot when the repository changes outside the bot.\n", gitHookMarker)
+	sb.WriteString("# Installed by /hooks install; remove with /hooks uninstall.\n")
+	sb.WriteString("command -v curl >/dev/null 2>&1 || exit 0\n")
+	if event == "post-checkout" {
+		// Only branch checkouts ($3 = 1) move HEAD; file checkouts do not.
+		sb.WriteString("[ \"$3\" = 1 ] || exit 0\nold=$1\n")
+	} else {
+		sb.WriteString("old=$(git rev-parse -q --verify ORIG_HEAD)\n")
+	}
+	sb.WriteString("new=$(git rev-parse -q --verify HEAD)\n")
+	fmt.Fprintf(&sb, "curl -fsS -m 5 -o /dev/null -H 'Authorization: Bearer %s' \\\n", token)
+	fmt.Fprintf(&sb, "\t--data-urlencode event=%s --data-urlencode \"old=$old\" --data-urlencode \"new=$new\" \\\n", event)
+	fmt.Fprintf(&sb, "\t'%s' >/dev/null 2>&1 &\nexit 0\n", url)
+	return sb.String()
+}
+
+// isDevbotHook reports whether the hook at path was written by devbot.
+func isDevbotHook(path string) bool {
+	data, err := os.ReadFile(path)
+	return err == nil && strings.Contains(string(data), gitHookMarker)
+}
+
+// installGitHooks writes the hooks of hook into the repository at workDir.
+// Existing hooks not written by devbot are left alone and reported as an
+// error before anything is written.
+func installGitHooks(workDir, baseURL string, hook RepoHook) error {
+	dir, err := gitHooksDir(workDir)
+	if err != nil {
+		return err
+	}
+	for _, name := range gitHookNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil && !isDevbotHook(path) {
+			return fmt.Errorf("已存在其他 %s hook: %s", name, path)
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	url := baseURL + "/hooks/" + hook.ID
+	for _, name := range gitHookNames {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(gitHookScript(name, url, hook.Token)), 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uninstallGitHooks removes the devbot hooks from the repository at
+// workDir and returns how many were removed.
+func uninstallGitHooks(workDir string) (int, error) {
+	dir, err := gitHooksDir(workDir)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, name := range gitHookNames {
+		path := filepath.Join(dir, name)
+		if !isDevbotHook(path) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (r *Router) cmdHooks(ctx context.Context, chatID, args string) {
+	usage := "用法:\n/hooks  查看已安装的 git hook\n/hooks install  在当前仓库安装 post-merge/post-checkout hook，仓库在 bot 之外变更时通知本聊天\n/hooks uninstall  从当前仓库移除 hook"
+
+	switch args {
+	case "", "list":
+		r.listHooks(ctx, chatID)
+		return
+	case "install", "uninstall":
+	default:
+		r.sender.SendText(ctx, chatID, usage)
+		return
+	}
+
+	session := r.getSession(chatID)
+	root, err := runGitOutput(session.WorkDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("当前目录不是 git 仓库: %s", session.WorkDir))
+		return
+	}
+
+	if args == "uninstall" {
+		n, err := uninstallGitHooks(root)
+		if err != nil {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("移除 hook 失败: %v", err))
+			return
+		}
+		_, ok := r.store.RemoveHook(chatID, root)
+		if ok {
+			r.save()
+		}
+		if n == 0 && !ok {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("%s 中没有 devbot 安装的 hook。", root))
+			return
+		}
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已从 %s 移除 %d 个 hook", root, n))
+		return
+	}
+
+	if r.hookURL == "" {
+		r.sender.SendText(ctx, chatID, "git hook 需要 bot 的 Web 服务接收通知，请先配置 web_addr（或 hook_url）。")
+		return
+	}
+	// Reinstalling rotates the token; the hook ID stays stable per chat and repo.
+	hook := RepoHook{ID: newExecID(), ChatID: chatID, Repo: root, Token: newHookToken(), CreatedAt: time.Now()}
+	for _, h := range r.store.Hooks(chatID) {
+		if h.Repo == root {
+			hook.ID = h.ID
+		}
+	}
+	if err := installGitHooks(root, r.hookURL, hook); err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("安装 hook 失败: %v", err))
+		return
+	}
+	r.store.AddHook(hook)
+	r.save()
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已在 %s 安装 %s hook，仓库在 bot 之外拉取或切换分支时会通知本聊天", root, strings.Join(gitHookNames, "/")))
+}
+
+func (r *Router) listHooks(ctx context.Context, chatID string) {
+	hooks := r.store.Hooks(chatID)
+	if len(hooks) == 0 {
+		r.sender.SendText(ctx, chatID, "当前没有安装 git hook。使用 /hooks install 在当前仓库安装。")
+		return
+	}
+	var sb strings.Builder
+	for _, h := range hooks {
+		fmt.Fprintf(&sb, "`%s` %s · 安装于 %s\n", h.ID, h.Repo, h.CreatedAt.Format("2006-01-02 15:04"))
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("Git Hooks（%d）", len(hooks)), Content: strings.TrimSpace(sb.String())})
+}
+
+// handleRepoHook processes a notification from an installed git hook: it
+// refreshes the knowledge cache for the new HEAD and, unless the chat's own
+// execution caused the change, posts the new commits and the working tree
+// status to the chat.
+func (r *Router) handleRepoHook(ctx context.Context, hook RepoHook, event, oldHead, newHead string) {
+	if newHead == "" {
+		newHead, _ = runGitOutput(hook.Repo, "rev-parse", "HEAD")
+	}
+	if r.cache != nil && newHead != "" {
+		r.cache.Observe(hook.Repo, newHead)
+	}
+	if newHead == "" || oldHead == newHead || r.chatBusy(hook.ChatID) {
+		return
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**事件:** %s\n**HEAD:** %s → %s", event, shortHash(oldHead), shortHash(newHead))
+	if oldHead != "" {
+		if log, err := runGitOutput(hook.Repo, "log", "--oneline", "--no-decorate", fmt.Sprintf("-%d", maxHookCommits+1), oldHead+".."+newHead); err == nil && log != "" {
+			lines := strings.Split(log, "\n")
+			more := len(lines) > maxHookCommits
+			if more {
+				lines = lines[:maxHookCommits]
+			}
+			sb.WriteString("\n\n**新提交:**\n")
+			for _, l := range lines {
+				fmt.Fprintf(&sb, "- %s\n", l)
+			}
+			if more {
+				sb.WriteString("- …\n")
+			}
+		}
+	}
+	if status, err := runGitOutput(hook.Repo, "status", "--porcelain"); err == nil {
+		if status == "" {
+			sb.WriteString("\n**工作区:** 干净")
+		} else {
+			fmt.Fprintf(&sb, "\n**工作区:** %d 个未提交的变更", len(strings.Split(status, "\n")))
+		}
+	}
+	r.sender.SendCard(ctx, hook.ChatID, CardMsg{
+		Title:    fmt.Sprintf("仓库已在外部更新: %s", filepath.Base(hook.Repo)),
+		Content:  strings.TrimSpace(sb.String()),
+		Template: "blue",
+	})
+}
+
+// handleHook serves POST /hooks/{id} for the git hooks installed by
+// /hooks install. Each installation authenticates with its own token.
+func (w *WebServer) handleHook(rw http.ResponseWriter, req *http.Request) {
+	hook, ok := w.router.store.Hook(strings.TrimPrefix(req.URL.Path, "/hooks/"))
+	if !ok || !tokenMatches(req, hook.Token) {
+		http.Error(rw, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if req.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	req.Body = http.MaxBytesReader(rw, req.Body, maxAPIBody)
+	if err := req.ParseForm(); err != nil {
+		http.Error(rw, "invalid form", http.StatusBadRequest)
+		return
+	}
+	w.router.handleRepoHook(req.Context(), hook, req.PostForm.Get("event"), req.PostForm.Get("old"), req.PostForm.Get("new"))
+	rw.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,206 @@
+package bot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitHookScript(t *testing.T) {
+	merge := gitHookScript("post-merge", "http://127.0.0.1:8080/hooks/h1", "tok")
+	for _, want := range []string{"#!/bin/sh\n" + gitHookMarker, "ORIG_HEAD", "Bearer tok", "event=post-merge", "'http://127.0.0.1:8080/hooks/h1' >/dev/null 2>&1 &", "exit 0\n"} {
+		if !strings.Contains(merge, want) {
+			t.Fatalf("expected %q in post-merge hook:\n%s", want, merge)
+		}
+	}
+	checkout := gitHookScript("post-checkout", "http://x/hooks/h1", "tok")
+	if !strings.Contains(checkout, `[ "$3" = 1 ] || exit 0`) || strings.Contains(checkout, "ORIG_HEAD") {
+		t.Fatalf("expected post-checkout to only report branch checkouts:\n%s", checkout)
+	}
+}
+
+func TestRouterHooks_InstallAndUninstall(t *testing.T) {
+	r, sender, repo, _ := newCacheRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/hooks install")
+	if !strings.Contains(sender.LastMessage(), "web_addr") {
+		t.Fatalf("expected web server hint without hook URL, got %q", sender.LastMessage())
+	}
+
+	r.SetHookURL("http://127.0.0.1:8080/")
+	r.Route(context.Background(), "chat1", "user1", "/hooks install")
+	hooks := r.store.Hooks("chat1")
+	if len(hooks) != 1 || hooks[0].Repo != repo || hooks[0].Token == "" {
+		t.Fatalf("expected stored hook, got %+v", hooks)
+	}
+	for _, name := range gitHookNames {
+		path := filepath.Join(repo, ".git", "hooks", name)
+		info, err := os.Stat(path)
+		if err != nil || info.Mode()&0111 == 0 {
+			t.Fatalf("expected executable %s hook: %v", name, err)
+		}
+		data, _ := os.ReadFile(path)
+		if !strings.Contains(string(data), "'http://127.0.0.1:8080/hooks/"+hooks[0].ID+"'") || !strings.Contains(string(data), hooks[0].Token) {
+			t.Fatalf("unexpected %s hook:\n%s", name, data)
+		}
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/hooks install")
+	again := r.store.Hooks("chat1")
+	if len(again) != 1 || again[0].ID != hooks[0].ID || again[0].Token == hooks[0].Token {
+		t.Fatalf("expected reinstall to keep the ID and rotate the token, got %+v", again)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/hooks")
+	if !strings.HasPrefix(sender.LastMessage(), "Git Hooks（1）") || !strings.Contains(sender.LastMessage(), repo) {
+		t.Fatalf("unexpected hook list %q", sender.LastMessage())
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/hooks uninstall")
+	if !strings.Contains(sender.LastMessage(), "移除 2 个 hook") || len(r.store.Hooks("")) != 0 {
+		t.Fatalf("expected hooks to be removed, got %q", sender.LastMessage())
+	}
+	if _, err := os.Stat(filepath.Join(repo, ".git", "hooks", "post-merge")); !os.IsNotExist(err) {
+		t.Fatalf("expected hook file to be deleted, got %v", err)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/hooks uninstall")
+	if !strings.Contains(sender.LastMessage(), "没有 devbot 安装的 hook") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+}
+
+func TestRouterHooks_KeepsForeignHooks(t *testing.T) {
+	r, sender, repo, _ := newCacheRouter(t)
+	r.SetHookURL("http://127.0.0.1:8080")
+	foreign := filepath.Join(repo, ".git", "hooks", "post-checkout")
+	os.WriteFile(foreign, []byte("#!/bin/sh\nmake deps\n"), 0755)
+
+	r.Route(context.Background(), "chat1", "user1", "/hooks install")
+	if !strings.Contains(sender.LastMessage(), "已存在其他 post-checkout hook") {
+		t.Fatalf("expected refusal, got %q", sender.LastMessage())
+	}
+	if _, err := os.Stat(filepath.Join(repo, ".git", "hooks", "post-merge")); !os.IsNotExist(err) {
+		t.Fatal("expected nothing to be installed")
+	}
+	r.Route(context.Background(), "chat1", "user1", "/hooks uninstall")
+	if data, _ := os.ReadFile(foreign); string(data) != "#!/bin/sh\nmake deps\n" {
+		t.Fatalf("expected foreign hook to be untouched, got %q", data)
+	}
+}
+
+func TestRouterHooks_NotARepo(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.SetHookURL("http://127.0.0.1:8080")
+	r.Route(context.Background(), "chat1", "user1", "/hooks install")
+	if !strings.Contains(sender.LastMessage(), "不是 git 仓库") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/hooks foo")
+	if !strings.HasPrefix(sender.LastMessage(), "用法:") {
+		t.Fatalf("expected usage, got %q", sender.LastMessage())
+	}
+}
+
+func hookRequest(w *WebServer, method, id, token string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/hooks/"+id, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestWebServer_Hook(t *testing.T) {
+	r, sender, repo, _ := newCacheRouter(t)
+	git := func(args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=t", "-c", "user.email=t@t"}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	oldHead := git("rev-parse", "HEAD")
+	r.cachedKnowledge(repo, cacheRepoMap, buildRepoMap)
+	os.WriteFile(filepath.Join(repo, "new.go"), []byte("package main\n"), 0644)
+	git("add", ".")
+	git("commit", "-m", "add new.go")
+	newHead := git("rev-parse", "HEAD")
+
+	r.store.AddHook(RepoHook{ID: "h1", ChatID: "chat1", Repo: repo, Token: "hooktok"})
+	w := NewWebServer(r, "dash")
+	form := url.Values{"event": {"post-merge"}, "old": {oldHead}, "new": {newHead}}
+
+	if rec := hookRequest(w, http.MethodPost, "h1", "dash", form); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected dashboard token to be rejected, got %d", rec.Code)
+	}
+	if rec := hookRequest(w, http.MethodPost, "nope", "hooktok", form); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected unknown hook to be rejected, got %d", rec.Code)
+	}
+	if rec := hookRequest(w, http.MethodGet, "h1", "hooktok", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for GET, got %d", rec.Code)
+	}
+
+	rec := hookRequest(w, http.MethodPost, "h1", "hooktok", form)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	msg := sender.LastMessage()
+	for _, want := range []string{"仓库已在外部更新: repo", "post-merge", shortHash(oldHead) + " → " + shortHash(newHead), "add new.go", "**工作区:** 干净"} {
+		if !strings.Contains(msg, want) {
+			t.Fatalf("expected %q in card, got %q", want, msg)
+		}
+	}
+	if status, _, _ := r.cache.Status(); len(status) != 0 {
+		t.Fatalf("expected stale cache to be dropped, got %+v", status)
+	}
+
+	// A pull made by the chat's own execution is not reported.
+	n := len(sender.messages)
+	r.setActive(ExecRecord{ID: "busy", ChatID: "chat1"})
+	hookRequest(w, http.MethodPost, "h1", "hooktok", form)
+	r.clearActive("busy")
+	// Branch checkouts that leave HEAD unchanged are not reported either.
+	hookRequest(w, http.MethodPost, "h1", "hooktok", url.Values{"event": {"post-checkout"}, "old": {newHead}, "new": {newHead}})
+	if len(sender.messages) != n {
+		t.Fatalf("expected no further cards, got %v", sender.messages[n:])
+	}
+}
+
+func TestGitHook_NotifiesOnMerge(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+	r, _, repo, _ := newCacheRouter(t)
+	sender := &syncSpySender{}
+	r.sender = sender
+	srv := httptest.NewServer(NewWebServer(r, "dash"))
+	t.Cleanup(srv.Close)
+	r.SetHookURL(srv.URL)
+	r.Route(context.Background(), "chat1", "user1", "/hooks install")
+
+	git := func(args ...string) {
+		if out, err := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=t", "-c", "user.email=t@t"}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("checkout", "-q", "-b", "feature")
+	os.WriteFile(filepath.Join(repo, "feature.go"), []byte("package main\n"), 0644)
+	git("add", ".")
+	git("commit", "-q", "-m", "teammate change")
+	git("checkout", "-q", "-")
+	git("merge", "-q", "--ff-only", "feature")
+
+	waitFor(t, func() bool {
+		for _, m := range sender.Messages() {
+			if strings.HasPrefix(m, "仓库已在外部更新") && strings.Contains(m, "post-merge") && strings.Contains(m, "teammate change") {
+				return true
+			}
+		}
+		return false
+	})
+}
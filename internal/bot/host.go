@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPsRows bounds the processes /ps lists.
+const maxPsRows = 30
+
+// SetAdmins sets the users with the admin role (see roles.go).
+func (r *Router) SetAdmins(ids map[string]bool) {
+	r.admins = ids
+}
+
+// psRow is one line of `ps` output.
+type psRow struct {
+	line string
+	cpu  float64
+}
+
+// parsePs splits `ps -eo pid,ppid,user,%cpu,%mem,etime,args` output into
+// its header and rows matching pattern (case-insensitive; empty matches
+// all), busiest first.
+func parsePs(out, pattern string) (header string, rows []psRow) {
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	if len(lines) == 0 {
+		return "", nil
+	}
+	header = lines[0]
+	pattern = strings.ToLower(pattern)
+	for _, l := range lines[1:] {
+		fields := strings.Fields(l)
+		if len(fields) < 7 {
+			continue
+		}
+		if pattern != "" && !strings.Contains(strings.ToLower(strings.Join(fields[6:], " ")), pattern) {
+			continue
+		}
+		cpu, _ := strconv.ParseFloat(fields[3], 64)
+		rows = append(rows, psRow{line: l, cpu: cpu})
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].cpu > rows[j].cpu })
+	return header, rows
+}
+
+func (r *Router) cmdPs(ctx context.Context, chatID, args string) {
+	execCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(execCtx, "ps", "-eo", "pid,ppid,user,%cpu,%mem,etime,args").Output()
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("运行 ps 失败: %v", err))
+		return
+	}
+	header, rows := parsePs(string(out), args)
+	if len(rows) == 0 {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("没有匹配 %q 的进程。", args))
+		return
+	}
+
+	title := fmt.Sprintf("进程（%d 个）", len(rows))
+	if args != "" {
+		title = fmt.Sprintf("进程: %s（%d 个匹配）", args, len(rows))
+	}
+	var sb strings.Builder
+	sb.WriteString(header + "\n")
+	for i, row := range rows {
+		if i == maxPsRows {
+			fmt.Fprintf(&sb, "... 另有 %d 个\n", len(rows)-maxPsRows)
+			break
+		}
+		sb.WriteString(truncateRunes(row.line, 160) + "\n")
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: "```\n" + strings.TrimRight(sb.String(), "\n") + "\n```"})
+}
+
+// portListeners returns what listens on port, using lsof where available
+// and ss otherwise.
+func portListeners(ctx context.Context, port int) (tool, out string, err error) {
+	p := strconv.Itoa(port)
+	candidates := []struct {
+		name string
+		args []string
+	}{
+		{"lsof", []string{"-nP", "-i", ":" + p}},
+		{"ss", []string{"-tulpn", "sport = :" + p}},
+	}
+	for _, c := range candidates {
+		if _, err := exec.LookPath(c.name); err != nil {
+			continue
+		}
+		b, err := exec.CommandContext(ctx, c.name, c.args...).CombinedOutput()
+		// lsof exits 1 when nothing matches.
+		if err != nil && c.name == "lsof" && len(strings.TrimSpace(string(b))) == 0 {
+			err = nil
+		}
+		return c.name, strings.TrimSpace(string(b)), err
+	}
+	return "", "", fmt.Errorf("未找到 lsof 或 ss")
+}
+
+func (r *Router) cmdPort(ctx context.Context, chatID, args string) {
+	port, err := strconv.Atoi(strings.TrimSpace(args))
+	if err != nil || port < 1 || port > 65535 {
+		r.sender.SendText(ctx, chatID, "用法: /port <端口>\n示例: /port 8080")
+		return
+	}
+	execCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	tool, out, err := portListeners(execCtx, port)
+	if err != nil {
+		if out != "" {
+			err = fmt.Errorf("%v: %s", err, truncateForDisplay(out, 500))
+		}
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("查询端口 %d 失败: %v", port, err))
+		return
+	}
+
+	var sb strings.Builder
+	// ss prints only a header when nothing matches.
+	if lines := strings.Split(out, "\n"); out == "" || (tool == "ss" && len(lines) == 1) {
+		fmt.Fprintf(&sb, "没有进程使用端口 %d。\n", port)
+	} else {
+		fmt.Fprintf(&sb, "```\n%s\n```\n", truncateForDisplay(out, 3000))
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), time.Second)
+	if err == nil {
+		conn.Close()
+		sb.WriteString("**本机 TCP 连接:** 成功")
+	} else {
+		sb.WriteString("**本机 TCP 连接:** 失败（无服务接受连接）")
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("端口 %d（%s）", port, tool), Content: sb.String()})
+}
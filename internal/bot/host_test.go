@@ -0,0 +1,103 @@
+package bot
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const psOutput = `  PID  PPID USER     %CPU %MEM     ELAPSED COMMAND
+    1     0 root      0.0  0.1  3-01:02:03 /sbin/init
+  812     1 app       2.5  1.2       10:11 /usr/bin/node server.js --port 3000
+  900     1 app      45.0  8.0       01:00 /srv/api/bin/api -config /etc/api.yaml
+  901   900 app       0.1  0.2       00:59 /srv/api/bin/api-worker
+`
+
+// fakeCommand puts an executable name running script on PATH, ahead of
+// any real one.
+func fakeCommand(t *testing.T, name, script string) {
+	t.Helper()
+	bin := t.TempDir()
+	os.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"+script), 0755)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestParsePs(t *testing.T) {
+	header, rows := parsePs(psOutput, "API")
+	if !strings.Contains(header, "COMMAND") || len(rows) != 2 {
+		t.Fatalf("unexpected parse %q %v", header, rows)
+	}
+	if !strings.Contains(rows[0].line, "-config") || rows[0].cpu != 45 {
+		t.Fatalf("expected busiest process first, got %v", rows)
+	}
+	if _, rows := parsePs(psOutput, ""); len(rows) != 4 {
+		t.Fatalf("expected all processes, got %d", len(rows))
+	}
+	// The pattern matches the command line, not the user column.
+	if _, rows := parsePs(psOutput, "root"); len(rows) != 0 {
+		t.Fatalf("unexpected match %v", rows)
+	}
+}
+
+func TestRouterPs_AdminOnly(t *testing.T) {
+	r, sender := newTestRouter(t)
+	fakeCommand(t, "ps", "cat <<'EOF'\n"+psOutput+"EOF\n")
+
+	r.Route(context.Background(), "chat1", "user1", "/ps node")
+	if sender.LastMessage() != "/ps 仅限管理员使用（admin_user_ids）。" {
+		t.Fatalf("expected admin gate, got %q", sender.LastMessage())
+	}
+
+	r.SetAdmins(map[string]bool{"user1": true})
+	r.Route(context.Background(), "chat1", "user1", "/PS node")
+	msg := sender.LastMessage()
+	if !strings.HasPrefix(msg, "进程: node（1 个匹配）") || !strings.Contains(msg, "server.js --port 3000") || strings.Contains(msg, "/sbin/init") {
+		t.Fatalf("unexpected ps card %q", msg)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/ps nginx")
+	if !strings.Contains(sender.LastMessage(), "没有匹配") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+}
+
+func TestRouterPort(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.SetAdmins(map[string]bool{"user1": true})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+	fakeCommand(t, "lsof", "echo \"COMMAND PID USER FD TYPE DEVICE SIZE/OFF NODE NAME\"\necho \"api 900 app 3u IPv4 0t0 TCP 127.0.0.1$3 (LISTEN)\"\n")
+
+	r.Route(context.Background(), "chat1", "user1", "/port "+port)
+	msg := sender.LastMessage()
+	if !strings.HasPrefix(msg, "端口 "+port+"（lsof）") || !strings.Contains(msg, "127.0.0.1:"+port+" (LISTEN)") || !strings.Contains(msg, "**本机 TCP 连接:** 成功") {
+		t.Fatalf("unexpected port card %q", msg)
+	}
+
+	ln.Close()
+	// Only ss is available, and it reports nothing but its header.
+	bin := t.TempDir()
+	os.WriteFile(filepath.Join(bin, "ss"), []byte("#!/bin/sh\necho \"Netid State Recv-Q Send-Q Local Address:Port Peer Address:Port Process\"\n"), 0755)
+	t.Setenv("PATH", bin)
+	r.Route(context.Background(), "chat1", "user1", "/port "+port)
+	msg = sender.LastMessage()
+	if !strings.HasPrefix(msg, "端口 "+port+"（ss）") || !strings.Contains(msg, "没有进程使用端口") || !strings.Contains(msg, "失败") {
+		t.Fatalf("unexpected port card %q", msg)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	r.Route(context.Background(), "chat1", "user1", "/port "+port)
+	if !strings.Contains(sender.LastMessage(), "未找到 lsof 或 ss") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/port 70000")
+	if !strings.HasPrefix(sender.LastMessage(), "用法:") {
+		t.Fatalf("expected usage, got %q", sender.LastMessage())
+	}
+}
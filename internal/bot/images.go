@@ -0,0 +1,95 @@
+package bot
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// maxInlineImageBytes is the largest image sent to Claude as input; larger
+// ones are passed by path.
+const maxInlineImageBytes = 5 << 20
+
+// imagePromptDefault is the prompt for images sent without text.
+const imagePromptDefault = "用户发来了图片，请描述或处理这张图片。"
+
+type imagesKey struct{}
+
+// withImages attaches image files to the prompt run with ctx.
+func withImages(ctx context.Context, paths []string) context.Context {
+	if len(paths) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, imagesKey{}, paths)
+}
+
+// imagesFrom returns the images set by withImages.
+func imagesFrom(ctx context.Context) []string {
+	paths, _ := ctx.Value(imagesKey{}).([]string)
+	return paths
+}
+
+// imagePathPrompt is the prompt for executors that cannot take images as
+// input: it tells Claude where they were saved so it can read them itself.
+func imagePathPrompt(prompt string, paths []string) string {
+	if len(paths) == 0 {
+		return prompt
+	}
+	return prompt + "\n\n附带图片路径: " + strings.Join(paths, ", ")
+}
+
+// imageInputMessage builds the stream-json user message carrying prompt and
+// the images in paths. Images that cannot be sent inline (unreadable, too
+// large or not a format Claude accepts) are returned in rest.
+func imageInputMessage(prompt string, paths []string) (line []byte, rest []string) {
+	var images []map[string]any
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil || len(data) > maxInlineImageBytes {
+			rest = append(rest, p)
+			continue
+		}
+		mediaType := http.DetectContentType(data)
+		switch mediaType {
+		case "image/jpeg", "image/png", "image/gif", "image/webp":
+		default:
+			rest = append(rest, p)
+			continue
+		}
+		images = append(images, map[string]any{
+			"type":   "image",
+			"source": map[string]string{"type": "base64", "media_type": mediaType, "data": base64.StdEncoding.EncodeToString(data)},
+		})
+	}
+	if len(images) == 0 {
+		return nil, rest
+	}
+	content := append([]map[string]any{{"type": "text", "text": imagePathPrompt(prompt, rest)}}, images...)
+	line, _ = json.Marshal(map[string]any{
+		"type":    "user",
+		"message": map[string]any{"role": "user", "content": content},
+	})
+	return append(line, '\n'), rest
+}
+
+// imageInput reports whether the CLI takes stream-json input, which is how
+// images are sent. Older versions only see the images by path. The answer
+// is cached.
+func (c *ClaudeExecutor) imageInput() bool {
+	c.imageInputOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, c.claudePath, "--help").CombinedOutput()
+		c.imageInputOK = err == nil && strings.Contains(string(out), "--input-format")
+		if !c.imageInputOK {
+			slog.Info("claude: CLI does not support --input-format, images are passed by path")
+		}
+	})
+	return c.imageInputOK
+}
@@ -0,0 +1,105 @@
+package bot
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testPNG = []byte("\x89PNG\r\n\x1a\nfake-image-data")
+
+// fakeImageClaude writes a fake CLI to dir that records its arguments and
+// stdin there; with inputFormat its --help lists --input-format.
+func fakeImageClaude(t *testing.T, dir string, inputFormat bool) string {
+	t.Helper()
+	help := "  --output-format <format>"
+	if inputFormat {
+		help += "\n  --input-format <format>"
+	}
+	claude := filepath.Join(dir, "claude")
+	os.WriteFile(claude, []byte(`#!/bin/sh
+if [ "$1" = "--help" ]; then
+  echo "`+help+`"
+  exit 0
+fi
+echo "$@" > "`+dir+`/args"
+cat > "`+dir+`/stdin"
+echo '{"type":"result","result":"looked","session_id":"s1"}'
+`), 0755)
+	return claude
+}
+
+func TestClaudeExecutor_SendsImagesAsInput(t *testing.T) {
+	dir := t.TempDir()
+	c := NewClaudeExecutor(fakeImageClaude(t, dir, true), "sonnet", 10*time.Second)
+	png := filepath.Join(dir, "shot.png")
+	os.WriteFile(png, testPNG, 0644)
+	notes := filepath.Join(dir, "notes.txt")
+	os.WriteFile(notes, []byte("not an image"), 0644)
+
+	ctx := withImages(context.Background(), []string{png, notes})
+	result, err := c.ExecStream(ctx, "what is wrong here?", dir, "", "", "", nil)
+	if err != nil || result.Output != "looked" {
+		t.Fatalf("ExecStream = %+v, %v", result, err)
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	if !strings.Contains(string(args), "--input-format stream-json") || strings.Contains(string(args), "what is wrong") {
+		t.Fatalf("args = %q", args)
+	}
+	stdin, _ := os.ReadFile(filepath.Join(dir, "stdin"))
+	for _, want := range []string{
+		`"type":"user"`,
+		`"text":"what is wrong here?\n\n附带图片路径: ` + notes + `"`,
+		`"media_type":"image/png"`,
+		base64.StdEncoding.EncodeToString(testPNG),
+	} {
+		if !strings.Contains(string(stdin), want) {
+			t.Errorf("stdin missing %q:\n%s", want, stdin)
+		}
+	}
+}
+
+func TestClaudeExecutor_ImagesByPathWithoutInputFormat(t *testing.T) {
+	dir := t.TempDir()
+	c := NewClaudeExecutor(fakeImageClaude(t, dir, false), "sonnet", 10*time.Second)
+	png := filepath.Join(dir, "shot.png")
+	os.WriteFile(png, testPNG, 0644)
+
+	if _, err := c.ExecStream(withImages(context.Background(), []string{png}), "describe", dir, "", "", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	if strings.Contains(string(args), "describe") || strings.Contains(string(args), "--input-format") {
+		t.Fatalf("args = %q", args)
+	}
+	if stdin, _ := os.ReadFile(filepath.Join(dir, "stdin")); string(stdin) != "describe\n\n附带图片路径: "+png {
+		t.Fatalf("stdin = %q", stdin)
+	}
+}
+
+func TestRouterRouteImage_SendsImageToClaude(t *testing.T) {
+	dir := t.TempDir()
+	r, sender := newAckRouter(t, fakeImageClaude(t, dir, true))
+	r.SetQueue(NewMessageQueue())
+	ctx := context.Background()
+
+	r.RouteImage(ctx, "chat1", "user1", testPNG, "a.png")
+	r.RouteImage(ctx, "chat1", "user1", testPNG, "b.png")
+	r.queue.Shutdown()
+
+	// Both run: prompts with images are never dropped as duplicates.
+	if n := len(r.store.ExecRecords("chat1", 0)); n != 2 {
+		t.Fatalf("expected 2 executions, got %d: %q", n, sender.messages)
+	}
+	stdin, _ := os.ReadFile(filepath.Join(dir, "stdin"))
+	if !strings.Contains(string(stdin), imagePromptDefault) || !strings.Contains(string(stdin), base64.StdEncoding.EncodeToString(testPNG)) {
+		t.Fatalf("stdin = %q", stdin)
+	}
+	if rec := r.store.ExecRecords("chat1", 1)[0]; rec.Prompt != imagePromptDefault {
+		t.Fatalf("recorded prompt = %q", rec.Prompt)
+	}
+}
@@ -0,0 +1,241 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// During an incident progress cards start after incidentProgressDelay
+	// and follow every incidentProgressInterval, instead of 5s and 10s.
+	incidentProgressDelay    = time.Second
+	incidentProgressInterval = 5 * time.Second
+	maxIncidentTitleRunes    = 80
+	// maxIncidentList is how many past incidents /incident list shows.
+	maxIncidentList = 10
+)
+
+// inIncident reports whether chatID has an open incident.
+func (r *Router) inIncident(chatID string) bool {
+	_, ok := r.store.OpenIncident(chatID)
+	return ok
+}
+
+// noteIncident adds a message sent to the chat to the timeline of its open
+// incident. /incident commands are left out; start and end have their own
+// entries.
+func (r *Router) noteIncident(chatID, userID, text string, session Session) {
+	if cmdText, ok := commandText(session, text); ok && strings.EqualFold(strings.SplitN(cmdText, " ", 2)[0], "/incident") {
+		return
+	}
+	if r.store.AddIncidentEvent(chatID, IncidentEvent{At: time.Now(), UserID: userID, Text: text}) {
+		r.save()
+	}
+}
+
+// cmdIncident implements /incident start|end|list.
+func (r *Router) cmdIncident(ctx context.Context, chatID, args string) {
+	usage := "用法:\n/incident start <标题>  开始事故：置顶事故卡片，切换为详细通知，之后的执行都标记为此事故\n/incident end  结束事故并生成时间线文档\n/incident  查看进行中的事故\n/incident list  查看最近的事故"
+	sub, rest, _ := strings.Cut(args, " ")
+	rest = strings.TrimSpace(rest)
+	switch sub {
+	case "":
+		inc, ok := r.store.OpenIncident(chatID)
+		if !ok {
+			r.sender.SendText(ctx, chatID, "当前没有进行中的事故。\n\n"+usage)
+			return
+		}
+		execs := r.incidentExecs(inc)
+		r.sender.SendCard(ctx, chatID, CardMsg{
+			Title: "🚨 事故进行中: " + inc.Title,
+			Content: fmt.Sprintf("**ID:** %s\n**开始:** %s（已持续 %s）\n**消息:** %d 条 · **执行:** %d 次\n\n`/incident end` 结束并生成时间线文档。",
+				inc.ID, inc.StartedAt.Format("01-02 15:04"), time.Since(inc.StartedAt).Truncate(time.Minute), len(inc.Timeline), len(execs)),
+			Template: "red",
+		})
+	case "start":
+		r.startIncident(ctx, chatID, rest)
+	case "end":
+		r.endIncident(ctx, chatID)
+	case "list":
+		r.listIncidents(ctx, chatID)
+	default:
+		r.sender.SendText(ctx, chatID, usage)
+	}
+}
+
+func (r *Router) startIncident(ctx context.Context, chatID, title string) {
+	title = strings.Join(strings.Fields(title), " ")
+	if title == "" {
+		r.sender.SendText(ctx, chatID, "用法: /incident start <标题>\n示例: /incident start 支付接口 502")
+		return
+	}
+	title = truncateRunes(title, maxIncidentTitleRunes)
+	inc := Incident{ID: newExecID(), ChatID: chatID, Title: title, StartedBy: userIDFrom(ctx), StartedAt: time.Now()}
+	if !r.store.StartIncident(inc) {
+		open, _ := r.store.OpenIncident(chatID)
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("本聊天已有进行中的事故「%s」（%s），请先 /incident end。", open.Title, open.ID))
+		return
+	}
+	r.save()
+	slog.InfoContext(ctx, "incident: started", "incident", inc.ID, "title", title, "chat_id", chatID)
+
+	card := CardMsg{
+		Title: "🚨 事故进行中: " + title,
+		Content: fmt.Sprintf("**ID:** %s\n**发起人:** %s\n**开始:** %s\n\n本聊天已切换为详细通知：执行进度每 %s 更新一次，确认和完成都以消息发送。之后的执行记录都标记为此事故，可在 /history 和 /audit 中查看。\n\n结束后发送 `/incident end` 生成时间线文档。",
+			inc.ID, orDash(inc.StartedBy), inc.StartedAt.Format("2006-01-02 15:04"), incidentProgressInterval),
+		Template: "red",
+		Buttons:  []CardButton{{Text: "结束事故", Command: "/incident end", Type: "danger"}},
+	}
+	if p, ok := r.sender.(Pinner); ok {
+		id, err := p.PinCard(ctx, chatID, card)
+		if id != "" {
+			r.store.UpdateIncident(inc.ID, func(i *Incident) { i.PinnedID = id })
+			r.save()
+		}
+		if err == nil {
+			return
+		}
+		slog.WarnContext(ctx, "incident: pin card failed", "chat_id", chatID, "err", err)
+		if id != "" {
+			// Posted but not pinned: the card is in the chat already.
+			return
+		}
+	}
+	r.sender.SendCard(ctx, chatID, card)
+}
+
+// incidentExecs returns the executions tagged with inc, oldest first.
+func (r *Router) incidentExecs(inc Incident) []ExecRecord {
+	var out []ExecRecord
+	for _, rec := range r.store.ExecRecords(inc.ChatID, 0) {
+		if rec.Incident == inc.ID {
+			out = append(out, rec)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].StartedAt.Before(out[j].StartedAt) })
+	return out
+}
+
+func (r *Router) endIncident(ctx context.Context, chatID string) {
+	inc, ok := r.store.OpenIncident(chatID)
+	if !ok {
+		r.sender.SendText(ctx, chatID, "当前没有进行中的事故。")
+		return
+	}
+	inc.EndedAt = time.Now()
+	r.store.UpdateIncident(inc.ID, func(i *Incident) { i.EndedAt = inc.EndedAt })
+	r.save()
+	slog.InfoContext(ctx, "incident: ended", "incident", inc.ID, "chat_id", chatID)
+
+	if p, ok := r.sender.(Pinner); ok && inc.PinnedID != "" {
+		if err := p.Unpin(ctx, inc.PinnedID); err != nil {
+			slog.WarnContext(ctx, "incident: unpin failed", "chat_id", chatID, "err", err)
+		}
+	}
+
+	execs := r.incidentExecs(inc)
+	timeline := incidentTimeline(inc, execs)
+	failures := 0
+	for _, rec := range execs {
+		if rec.Error != "" {
+			failures++
+		}
+	}
+	summary := fmt.Sprintf("**持续:** %s（%s ~ %s）\n**消息:** %d 条 · **执行:** %d 次（失败 %d 次）",
+		inc.EndedAt.Sub(inc.StartedAt).Truncate(time.Second), inc.StartedAt.Format("01-02 15:04"), inc.EndedAt.Format("01-02 15:04"), len(inc.Timeline), len(execs), failures)
+
+	if r.docSyncer != nil {
+		title := fmt.Sprintf("事故时间线 %s %s", inc.StartedAt.Format("2006-01-02"), inc.Title)
+		_, docURL, err := r.docSyncer.CreateAndPushDoc(ctx, title, timeline)
+		if err == nil {
+			r.store.UpdateIncident(inc.ID, func(i *Incident) { i.DocURL = docURL })
+			r.save()
+			r.sender.SendCard(ctx, chatID, CardMsg{
+				Title:    "✅ 事故已结束: " + inc.Title,
+				Content:  fmt.Sprintf("%s\n**时间线:** [%s](%s)", summary, docURL, docURL),
+				Template: "green",
+			})
+			return
+		}
+		slog.WarnContext(ctx, "incident: create timeline doc failed", "chat_id", chatID, "err", err)
+		summary += fmt.Sprintf("\n\n⚠️ 创建飞书文档失败（%v），时间线以文件发送。", err)
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: "✅ 事故已结束: " + inc.Title, Content: summary, Template: "green"})
+	r.sendFile(ctx, chatID, fmt.Sprintf("incident-%s.md", inc.ID), []byte(timeline))
+}
+
+// incidentTimeline renders everything said and run during inc, in order.
+func incidentTimeline(inc Incident, execs []ExecRecord) string {
+	type entry struct {
+		at   time.Time
+		text string
+	}
+	entries := []entry{{inc.StartedAt, fmt.Sprintf("🚨 %s 开始事故: %s", orDash(inc.StartedBy), inc.Title)}}
+	for _, ev := range inc.Timeline {
+		entries = append(entries, entry{ev.At, fmt.Sprintf("%s: %s", orDash(ev.UserID), strings.Join(strings.Fields(ev.Text), " "))})
+	}
+	failures := 0
+	for _, rec := range execs {
+		text := fmt.Sprintf("✓ 执行 %s（%s）: %s", rec.ID, rec.Duration.Truncate(time.Second), truncateRunes(strings.Join(strings.Fields(rec.Prompt), " "), 200))
+		if rec.Error != "" {
+			failures++
+			text = fmt.Sprintf("✗ 执行 %s（%s）: %s\n    错误: %s", rec.ID, rec.Duration.Truncate(time.Second), truncateRunes(strings.Join(strings.Fields(rec.Prompt), " "), 200), truncateRunes(rec.Error, 200))
+		} else if out := strings.TrimSpace(rec.Output); out != "" {
+			text += "\n    结果: " + truncateRunes(strings.Join(strings.Fields(out), " "), 300)
+		}
+		entries = append(entries, entry{rec.StartedAt, text})
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].at.Before(entries[j].at) })
+	if !inc.EndedAt.IsZero() {
+		entries = append(entries, entry{inc.EndedAt, "✅ 事故结束"})
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "事故: %s\n", inc.Title)
+	fmt.Fprintf(&sb, "ID: %s\n", inc.ID)
+	fmt.Fprintf(&sb, "发起人: %s\n", orDash(inc.StartedBy))
+	fmt.Fprintf(&sb, "开始: %s\n", inc.StartedAt.Format("2006-01-02 15:04:05"))
+	if !inc.EndedAt.IsZero() {
+		fmt.Fprintf(&sb, "结束: %s\n", inc.EndedAt.Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(&sb, "持续: %s\n", inc.EndedAt.Sub(inc.StartedAt).Truncate(time.Second))
+	}
+	fmt.Fprintf(&sb, "消息: %d 条\n执行: %d 次（失败 %d 次）\n\n时间线\n", len(inc.Timeline), len(execs), failures)
+	layout := "15:04:05"
+	if inc.EndedAt.Sub(inc.StartedAt) >= 24*time.Hour || inc.EndedAt.YearDay() != inc.StartedAt.YearDay() {
+		layout = "01-02 15:04:05"
+	}
+	for _, e := range entries {
+		fmt.Fprintf(&sb, "%s %s\n", e.at.Format(layout), e.text)
+	}
+	return sb.String()
+}
+
+func (r *Router) listIncidents(ctx context.Context, chatID string) {
+	incidents := r.store.Incidents(chatID)
+	if len(incidents) == 0 {
+		r.sender.SendText(ctx, chatID, "本聊天没有事故记录。")
+		return
+	}
+	var sb strings.Builder
+	for i, inc := range incidents {
+		if i == maxIncidentList {
+			fmt.Fprintf(&sb, "……另有 %d 个\n", len(incidents)-maxIncidentList)
+			break
+		}
+		state := "进行中"
+		if !inc.EndedAt.IsZero() {
+			state = "持续 " + inc.EndedAt.Sub(inc.StartedAt).Truncate(time.Minute).String()
+		}
+		fmt.Fprintf(&sb, "- `%s` %s · %s · %s", inc.ID, inc.StartedAt.Format("01-02 15:04"), inc.Title, state)
+		if inc.DocURL != "" {
+			fmt.Fprintf(&sb, " · [时间线](%s)", inc.DocURL)
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n`/history` 和 `/audit` 中以 🚨 标出事故期间的执行。")
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("事故记录（%d）", len(incidents)), Content: sb.String()})
+}
@@ -0,0 +1,179 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type pinSpySender struct {
+	spySender
+	pinned   []string
+	unpinned []string
+	pinErr   error
+}
+
+func (s *pinSpySender) PinCard(_ context.Context, _ string, card CardMsg) (string, error) {
+	s.pinned = append(s.pinned, card.Title)
+	return "om_pin", s.pinErr
+}
+
+func (s *pinSpySender) Unpin(_ context.Context, messageID string) error {
+	s.unpinned = append(s.unpinned, messageID)
+	return nil
+}
+
+func TestIncident_TagsExecutionsAndWritesTimeline(t *testing.T) {
+	claude := filepath.Join(t.TempDir(), "claude")
+	os.WriteFile(claude, []byte(`#!/bin/sh
+echo '{"type":"result","result":"restarted the worker","session_id":"s1"}'
+`), 0755)
+	r, sender := newAckRouter(t, claude)
+	doc := &fakeDocPusher{returnDocID: "doc1", returnDocURL: "https://feishu.cn/docx/doc1"}
+	r.docSyncer = doc
+	ctx := withMessageID(context.Background(), "om_1")
+
+	r.Route(ctx, "chat1", "user1", "/ack react")
+	r.Route(ctx, "chat1", "user1", "before the incident")
+	r.Route(ctx, "chat1", "user1", "/incident start 支付接口   502")
+	inc, ok := r.store.OpenIncident("chat1")
+	if !ok || inc.Title != "支付接口 502" || inc.StartedBy != "user1" {
+		t.Fatalf("open incident = %+v, %v", inc, ok)
+	}
+	if msg := sender.LastMessage(); !strings.Contains(msg, "🚨 事故进行中: 支付接口 502") {
+		t.Fatalf("start card = %q", msg)
+	}
+
+	// Reactions give way to text acknowledgements during the incident.
+	sender.messages, sender.reactions = nil, nil
+	r.Route(ctx, "chat1", "user1", "restart the payment worker")
+	if len(sender.reactions) != 0 || sender.messages[0] != "执行中..." || !strings.HasPrefix(sender.LastMessage(), "✓ 完成") {
+		t.Fatalf("incident acknowledgements = %q %v", sender.messages, sender.reactions)
+	}
+	r.Route(ctx, "chat1", "user1", "/pwd")
+	r.Route(ctx, "chat1", "user1", "/incident")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "**执行:** 1 次") {
+		t.Fatalf("status = %q", msg)
+	}
+
+	records := r.store.ExecRecords("chat1", 0)
+	if len(records) != 2 || records[0].Incident != inc.ID || records[1].Incident != "" {
+		t.Fatalf("records = %+v", records)
+	}
+	r.Route(ctx, "chat1", "user1", "/history")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "🚨 "+inc.ID) {
+		t.Fatalf("history = %q", msg)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/incident end")
+	if _, ok := r.store.OpenIncident("chat1"); ok {
+		t.Fatal("incident still open")
+	}
+	if msg := sender.LastMessage(); !strings.Contains(msg, "事故已结束: 支付接口 502") || !strings.Contains(msg, "https://feishu.cn/docx/doc1") {
+		t.Fatalf("end card = %q", msg)
+	}
+	if !strings.HasPrefix(doc.createdTitle, "事故时间线 ") || !strings.HasSuffix(doc.createdTitle, " 支付接口 502") {
+		t.Errorf("doc title = %q", doc.createdTitle)
+	}
+	for _, want := range []string{
+		"user1 开始事故: 支付接口 502",
+		"user1: restart the payment worker",
+		"✓ 执行 " + records[0].ID,
+		"结果: restarted the worker",
+		"user1: /pwd",
+		"执行: 1 次（失败 0 次）",
+		"✅ 事故结束",
+	} {
+		if !strings.Contains(doc.createdContent, want) {
+			t.Errorf("timeline missing %q:\n%s", want, doc.createdContent)
+		}
+	}
+	for _, unwanted := range []string{"before the incident", "/incident"} {
+		if strings.Contains(doc.createdContent, unwanted) {
+			t.Errorf("timeline includes %q:\n%s", unwanted, doc.createdContent)
+		}
+	}
+	if incs := r.store.Incidents("chat1"); len(incs) != 1 || incs[0].DocURL != "https://feishu.cn/docx/doc1" {
+		t.Fatalf("incidents = %+v", incs)
+	}
+
+	// Later executions are no longer tagged and use reactions again.
+	sender.reactions = nil
+	r.Route(ctx, "chat1", "user1", "after the incident")
+	if len(sender.reactions) == 0 || r.store.ExecRecords("chat1", 1)[0].Incident != "" {
+		t.Fatalf("after the incident: reactions %v, record %+v", sender.reactions, r.store.ExecRecords("chat1", 1)[0])
+	}
+	r.Route(ctx, "chat1", "user1", "/incident end")
+	if msg := sender.LastMessage(); msg != "当前没有进行中的事故。" {
+		t.Fatalf("second end = %q", msg)
+	}
+}
+
+func TestIncident_PinsCardAndFallsBackToFile(t *testing.T) {
+	r, _ := newTestRouter(t)
+	sender := &pinSpySender{}
+	r.sender = sender
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "/incident start db down")
+	if len(sender.pinned) != 1 || len(sender.messages) != 0 {
+		t.Fatalf("pinned %v, messages %q", sender.pinned, sender.messages)
+	}
+	r.Route(ctx, "chat1", "user1", "/incident start again")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "已有进行中的事故「db down」") {
+		t.Fatalf("second start = %q", msg)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/incident end")
+	if strings.Join(sender.unpinned, ",") != "om_pin" {
+		t.Fatalf("unpinned %v", sender.unpinned)
+	}
+	// Without doc sync the timeline is sent as a file (text here).
+	if msg := sender.LastMessage(); !strings.HasPrefix(msg, "incident-") || !strings.Contains(msg, "事故: db down") || strings.Contains(msg, "start again") {
+		t.Fatalf("timeline = %q", msg)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/incident list")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "db down") || !strings.Contains(msg, "持续") {
+		t.Fatalf("list = %q", msg)
+	}
+}
+
+func TestIncident_PinFailureKeepsPostedCard(t *testing.T) {
+	r, _ := newTestRouter(t)
+	sender := &pinSpySender{pinErr: errors.New("no permission")}
+	r.sender = sender
+	r.Route(context.Background(), "chat1", "user1", "/incident start outage")
+	// The card was posted before pinning failed, so it is not sent twice.
+	if len(sender.messages) != 0 {
+		t.Fatalf("messages = %q", sender.messages)
+	}
+	if inc, _ := r.store.OpenIncident("chat1"); inc.PinnedID != "om_pin" {
+		t.Fatalf("pinned ID = %q", inc.PinnedID)
+	}
+}
+
+func TestIncidentTimeline_Failures(t *testing.T) {
+	start := time.Date(2026, 3, 1, 23, 50, 0, 0, time.Local)
+	inc := Incident{ID: "i1", Title: "t", StartedAt: start, EndedAt: start.Add(20 * time.Minute),
+		Timeline: []IncidentEvent{{At: start.Add(5 * time.Minute), UserID: "u2", Text: "any\nidea?"}}}
+	execs := []ExecRecord{{ID: "e1", Prompt: "check logs", Error: "exit status 1", StartedAt: start.Add(time.Minute), Duration: 3 * time.Second}}
+	got := incidentTimeline(inc, execs)
+	for _, want := range []string{
+		"03-01 23:51:00 ✗ 执行 e1（3s）: check logs\n    错误: exit status 1",
+		"03-01 23:55:00 u2: any idea?",
+		"03-02 00:10:00 ✅ 事故结束",
+		"执行: 1 次（失败 1 次）",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("timeline missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Index(got, "✗ 执行 e1") > strings.Index(got, "u2: any idea?") {
+		t.Errorf("timeline out of order:\n%s", got)
+	}
+}
@@ -0,0 +1,208 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"devbot/internal/version"
+)
+
+const (
+	// issueTimeout bounds `gh issue create`.
+	issueTimeout = time.Minute
+	// maxIssueErrorRunes caps each error quoted in an issue body.
+	maxIssueErrorRunes = 4000
+)
+
+// SetIssueConfig enables issues for repeated failures: once the same prompt
+// has failed after times in a chat within window, devbot offers to file a
+// GitHub issue, or files it right away when auto is set. after <= 0
+// disables it; /issue works either way.
+func (r *Router) SetIssueConfig(after int, window time.Duration, auto bool) {
+	r.issueAfter = after
+	r.issueWindow = window
+	r.issueAuto = auto
+}
+
+// failureKey is what makes two prompts "the same" for counting failures.
+func failureKey(prompt string) string {
+	return strings.ToLower(strings.Join(strings.Fields(prompt), " "))
+}
+
+// sameFailures returns the chat's failed executions of rec's prompt that
+// started within the issue window before rec, newest first, including rec.
+func (r *Router) sameFailures(chatID string, rec ExecRecord) []ExecRecord {
+	key := failureKey(rec.Prompt)
+	since := rec.StartedAt.Add(-r.issueWindow)
+	var out []ExecRecord
+	for _, other := range r.store.ExecRecords(chatID, 0) {
+		if other.Error == "" || other.StartedAt.Before(since) || other.StartedAt.After(rec.StartedAt) || failureKey(other.Prompt) != key {
+			continue
+		}
+		out = append(out, other)
+	}
+	return out
+}
+
+// checkRepeatedFailure runs after a failed execution: when its prompt has
+// failed issueAfter times in the window, it offers (or files) an issue; when
+// an earlier failure already has one, it links that instead.
+func (r *Router) checkRepeatedFailure(ctx context.Context, chatID string, rec ExecRecord) {
+	if r.issueAfter <= 0 {
+		return
+	}
+	fails := r.sameFailures(chatID, rec)
+	for _, f := range fails {
+		if f.Issue != "" {
+			r.store.UpdateExecRecord(rec.ID, func(e *ExecRecord) { e.Issue = f.Issue })
+			r.save()
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("这个问题已记录在 %s", f.Issue))
+			return
+		}
+	}
+	if len(fails) != r.issueAfter {
+		return
+	}
+	if r.issueAuto {
+		r.fileIssue(ctx, chatID, rec)
+		return
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{
+		Title:    fmt.Sprintf("🔁 同一个请求已失败 %d 次", len(fails)),
+		Content:  fmt.Sprintf("最近 %s 内「%s」失败了 %d 次。要在项目仓库中创建 GitHub issue 跟踪吗？issue 会包含 prompt、错误输出和环境信息（已隐藏密钥）。\n\n回复 `/issue %s` 创建。", formatWindow(r.issueWindow), truncateRunes(strings.Join(strings.Fields(rec.Prompt), " "), 60), len(fails), rec.ID),
+		Template: "orange",
+		Buttons:  []CardButton{{Text: "创建 issue", Command: "/issue " + rec.ID, Type: "primary"}},
+	})
+}
+
+func formatWindow(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%d 小时", int(d.Hours()))
+	}
+	return fmt.Sprintf("%d 分钟", int(d.Minutes()))
+}
+
+// issueBody renders the issue for rec and the other failures of its prompt.
+func (r *Router) issueBody(rec ExecRecord, fails []ExecRecord) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "在飞书聊天中通过 devbot 执行以下请求时失败了 %d 次。\n\n", len(fails))
+	fmt.Fprintf(&sb, "## Prompt\n\n```\n%s\n```\n\n", strings.TrimSpace(rec.Prompt))
+	sb.WriteString("## 错误输出\n\n")
+	for _, f := range fails {
+		fmt.Fprintf(&sb, "### %s · `%s`\n\n```\n%s\n```\n\n", f.StartedAt.Format("2006-01-02 15:04:05"), f.ID, truncateRunes(strings.TrimSpace(f.Error), maxIssueErrorRunes))
+	}
+	sb.WriteString("## 环境\n\n")
+	if rec.WorkDir != "" {
+		fmt.Fprintf(&sb, "- 项目: `%s`\n", filepath.Base(rec.WorkDir))
+	}
+	if rec.GitHead != "" {
+		fmt.Fprintf(&sb, "- 提交: `%s`\n", rec.GitHead)
+	}
+	if rec.Model != "" {
+		fmt.Fprintf(&sb, "- 模型: `%s`\n", rec.Model)
+	}
+	if rec.PermissionMode != "" {
+		fmt.Fprintf(&sb, "- 权限模式: `%s`\n", rec.PermissionMode)
+	}
+	fmt.Fprintf(&sb, "- devbot: `%s`（%s）\n", version.Version, version.Commit)
+	fmt.Fprintf(&sb, "- 系统: `%s/%s`\n", runtime.GOOS, runtime.GOARCH)
+	return r.secrets.Redact(sb.String())
+}
+
+// fileIssue creates a GitHub issue for rec's repeated failure with gh in
+// the project directory and links it on every failure it covers.
+func (r *Router) fileIssue(ctx context.Context, chatID string, rec ExecRecord) {
+	if rec.WorkDir == "" {
+		r.sender.SendText(ctx, chatID, "这次执行没有项目目录，无法确定要在哪个仓库创建 issue。")
+		return
+	}
+	fails := r.sameFailures(chatID, rec)
+	if len(fails) == 0 {
+		fails = []ExecRecord{rec}
+	}
+	title := "devbot: " + truncateRunes(strings.Join(strings.Fields(rec.Prompt), " "), 60) + " 重复失败"
+	out, err := runInDir(ctx, rec.WorkDir, issueTimeout, "gh", "issue", "create", "--title", title, "--body", r.issueBody(rec, fails))
+	if err != nil {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "创建 issue 失败", Content: fmt.Sprintf("%v\n\n```\n%s\n```", err, truncateRunes(strings.TrimSpace(out), 2000)), Template: "red"})
+		return
+	}
+	link := issueURL(out)
+	for _, f := range fails {
+		r.store.UpdateExecRecord(f.ID, func(e *ExecRecord) { e.Issue = link })
+	}
+	r.save()
+	slog.InfoContext(ctx, "issue: filed", "chat_id", chatID, "url", link, "exec_id", rec.ID, "failures", len(fails))
+	r.sender.SendCard(ctx, chatID, CardMsg{
+		Title:    "📌 已创建 issue",
+		Content:  fmt.Sprintf("%s\n\n**请求:** %s\n**失败:** %d 次", link, truncateRunes(strings.Join(strings.Fields(rec.Prompt), " "), 60), len(fails)),
+		Template: "green",
+	})
+}
+
+// issueURL picks the issue URL gh prints last.
+func issueURL(out string) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if l := strings.TrimSpace(lines[i]); strings.HasPrefix(l, "http") {
+			return l
+		}
+	}
+	return strings.TrimSpace(out)
+}
+
+// cmdIssue lists, shows or creates GitHub issues, or files one for a
+// failed execution: the given one or the chat's most recent failure.
+func (r *Router) cmdIssue(ctx context.Context, chatID, args string) {
+	sub, rest, _ := strings.Cut(args, " ")
+	switch sub {
+	case "list":
+		r.cmdIssueList(ctx, chatID, strings.TrimSpace(rest))
+		return
+	case "view":
+		r.cmdIssueView(ctx, chatID, strings.TrimSpace(rest))
+		return
+	case "create":
+		r.cmdIssueCreate(ctx, chatID, rest)
+		return
+	}
+	fields := strings.Fields(args)
+	if len(fields) > 1 {
+		r.sender.SendText(ctx, chatID, "用法:\n/issue list [all|参数]  查看 Issue 列表\n/issue view <编号>  查看 Issue 详情\n/issue create <标题>  由 Claude 根据最近的上下文撰写正文并创建 issue\n/issue [执行ID]  为失败的执行（默认最近一次失败）在项目仓库中创建 GitHub issue，包含 prompt、错误输出和环境信息。")
+		return
+	}
+	var rec ExecRecord
+	if len(fields) == 1 {
+		var ok bool
+		rec, ok = r.store.ExecRecord(fields[0])
+		if !ok || rec.ChatID != chatID {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("找不到执行记录: %s", fields[0]))
+			return
+		}
+		if rec.Error == "" {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("执行 %s 没有失败，无需创建 issue。", rec.ID))
+			return
+		}
+	} else {
+		found := false
+		for _, other := range r.store.ExecRecords(chatID, 0) {
+			if other.Error != "" {
+				rec, found = other, true
+				break
+			}
+		}
+		if !found {
+			r.sender.SendText(ctx, chatID, "当前聊天没有失败的执行记录。")
+			return
+		}
+	}
+	if rec.Issue != "" {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("这个问题已记录在 %s", rec.Issue))
+		return
+	}
+	r.fileIssue(ctx, chatID, rec)
+}
@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeGH puts a gh on PATH that records its arguments in the returned file
+// and prints an issue URL.
+func fakeGH(t *testing.T) string {
+	t.Helper()
+	bin := t.TempDir()
+	args := filepath.Join(bin, "args")
+	os.WriteFile(filepath.Join(bin, "gh"), []byte("#!/bin/sh\nprintf '%s\\n' \"$@\" > "+args+"\necho 'Creating issue in acme/app'\necho https://github.com/acme/app/issues/7\n"), 0755)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return args
+}
+
+func TestRouterRepeatedFailureOffersIssue(t *testing.T) {
+	args := fakeGH(t)
+	claude := filepath.Join(t.TempDir(), "claude")
+	os.WriteFile(claude, []byte("#!/bin/sh\necho 'build exploded' >&2\nexit 1\n"), 0755)
+	r, sender := newAckRouter(t, claude)
+	r.SetIssueConfig(2, time.Hour, false)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "fix the build")
+	if strings.Contains(sender.LastMessage(), "创建 issue") {
+		t.Fatalf("expected no offer after one failure, got %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "user1", "Fix  the build")
+	offer := sender.LastMessage()
+	if !strings.Contains(offer, "失败了 2 次") || !strings.Contains(offer, "/issue ") {
+		t.Fatalf("expected an issue offer, got %q", offer)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/issue")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "https://github.com/acme/app/issues/7") || !strings.Contains(msg, "2 次") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	data, _ := os.ReadFile(args)
+	if got := string(data); !strings.HasPrefix(got, "issue\ncreate\n--title\n") || !strings.Contains(got, "build exploded") || !strings.Contains(got, "## 环境") {
+		t.Fatalf("unexpected gh arguments %q", got)
+	}
+	for _, rec := range r.store.ExecRecords("chat1", 0) {
+		if rec.Issue != "https://github.com/acme/app/issues/7" {
+			t.Fatalf("expected every failure linked, got %+v", rec)
+		}
+	}
+
+	// Later failures link the existing issue instead of offering again.
+	r.Route(ctx, "chat1", "user1", "fix the build")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "已记录在 https://github.com/acme/app/issues/7") {
+		t.Fatalf("expected the existing issue linked, got %q", msg)
+	}
+}
+
+func TestRouterRepeatedFailureAutoIssue(t *testing.T) {
+	fakeGH(t)
+	claude := filepath.Join(t.TempDir(), "claude")
+	os.WriteFile(claude, []byte("#!/bin/sh\nexit 1\n"), 0755)
+	r, sender := newAckRouter(t, claude)
+	r.SetIssueConfig(1, time.Hour, true)
+
+	r.Route(context.Background(), "chat1", "user1", "deploy")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "已创建 issue") {
+		t.Fatalf("expected the issue filed automatically, got %q", msg)
+	}
+}
+
+func TestRouterIssueCommand(t *testing.T) {
+	r, sender := newTestRouter(t)
+	ctx := context.Background()
+	r.Route(ctx, "chat1", "user1", "/issue")
+	if !strings.Contains(sender.LastMessage(), "没有失败的执行") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+	r.store.AddExecRecord(ExecRecord{ID: "ok1", ChatID: "chat1", Prompt: "fine", StartedAt: time.Now()})
+	r.Route(ctx, "chat1", "user1", "/issue ok1")
+	if !strings.Contains(sender.LastMessage(), "没有失败") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+	r.store.AddExecRecord(ExecRecord{ID: "bad1", ChatID: "chat2", Prompt: "x", Error: "boom", StartedAt: time.Now()})
+	r.Route(ctx, "chat1", "user1", "/issue bad1")
+	if !strings.Contains(sender.LastMessage(), "找不到执行记录") {
+		t.Fatalf("expected another chat's record refused, got %q", sender.LastMessage())
+	}
+}
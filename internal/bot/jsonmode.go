@@ -0,0 +1,305 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// defaultJSONRetries is how many times /json sends an invalid payload back
+// to Claude for correction before giving up.
+const defaultJSONRetries = 2
+
+// maxJSONSummaryKeys bounds the fields listed in the /json summary card.
+const maxJSONSummaryKeys = 20
+
+// SetJSONSchema sets the JSON Schema that /json results must satisfy.
+// An empty schema disables validation beyond well-formedness.
+func (r *Router) SetJSONSchema(schema string) error {
+	if strings.TrimSpace(schema) == "" {
+		r.jsonSchema, r.jsonSchemaText = nil, ""
+		return nil
+	}
+	compiled, err := jsonschema.CompileString("devbot-json-schema.json", schema)
+	if err != nil {
+		return fmt.Errorf("compile json schema: %w", err)
+	}
+	r.jsonSchema, r.jsonSchemaText = compiled, schema
+	return nil
+}
+
+// SetJSONRetries sets how many correction rounds /json attempts after an
+// invalid payload. Negative values are treated as 0.
+func (r *Router) SetJSONRetries(n int) {
+	if n < 0 {
+		n = 0
+	}
+	r.jsonRetries = n
+}
+
+func (r *Router) cmdJSON(ctx context.Context, chatID, args string) {
+	if args == "" {
+		r.sender.SendText(ctx, chatID, "用法: /json <prompt>\n要求 Claude 只输出 JSON；结果会校验（含配置的 schema），失败时自动重试，并以文件形式附上原始 JSON。")
+		return
+	}
+	r.getSession(chatID) // ensure session exists
+	id := newExecID()
+	if r.queue == nil {
+		r.runJSON(ctx, chatID, id, args)
+		return
+	}
+	r.setQueued(ExecRecord{ID: id, ChatID: chatID, Prompt: args, StartedAt: time.Now()})
+	pos, err := r.queue.EnqueueTask(chatID, QueueEntry{ID: id}, func() {
+		r.runJSON(r.ctx, chatID, id, args)
+	})
+	if err != nil {
+		r.clearQueued(id)
+		r.sender.SendText(ctx, chatID, "队列已满，请稍后再试。")
+		return
+	}
+	if pos > 1 {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("已排队（第 %d 位）", pos), Content: "当前有任务正在执行，请稍候...", Template: "blue"})
+	}
+}
+
+// runJSON runs prompt in the chat's session with instructions to answer
+// with a single JSON value. Output that is not valid JSON (or violates the
+// configured schema) is sent back in the same session with the validation
+// error, up to r.jsonRetries times.
+func (r *Router) runJSON(ctx context.Context, chatID, id, prompt string) {
+	r.clearQueued(id)
+	r.sender.SendText(ctx, chatID, "执行中（JSON 模式）...")
+
+	workDir, sessionID, permMode, model := r.store.SessionExecParams(chatID)
+	workDir, sessionID = r.checkResume(ctx, chatID, workDir, sessionID)
+	if permMode == "" {
+		permMode = "safe"
+	}
+	startTime := time.Now()
+	rec := ExecRecord{
+		ID:             id,
+		ChatID:         chatID,
+		Prompt:         prompt,
+		WorkDir:        workDir,
+		SessionID:      sessionID,
+		StartedAt:      startTime,
+		Model:          model,
+		PermissionMode: permMode,
+		GitHead:        gitHead(workDir),
+	}
+	r.setActive(rec)
+	defer r.clearActive(id)
+
+	var (
+		result  ExecResult
+		payload []byte
+		verr    error
+		err     error
+	)
+	if dir, err := r.scratchDir(chatID); err == nil {
+		ctx = withScratchDir(ctx, dir)
+	}
+	ctx = r.withReferenceDirs(ctx)
+	expanded, atts, problems := expandAttachments(workDir, prompt)
+	if notice := attachmentNotice(atts, problems); notice != "" {
+		r.sender.SendText(ctx, chatID, notice)
+	}
+	next := r.jsonPrompt(expanded)
+	runCtx, stop := r.killable(ctx, id)
+	defer stop()
+	attempts := 0
+	for attempts <= r.jsonRetries {
+		attempts++
+		result, err = r.executor.ExecStream(runCtx, next, workDir, sessionID, permMode, model, nil)
+		if err != nil {
+			break
+		}
+		r.updateSessionResult(chatID, result)
+		if result.SessionID != "" {
+			sessionID = result.SessionID
+		}
+		payload, verr = r.parseJSONOutput(result.Output)
+		if verr == nil {
+			break
+		}
+		next = fmt.Sprintf("上一次的输出不是符合要求的 JSON：%v\n请只输出修正后的 JSON，不要包含任何其他文字或代码块标记。", verr)
+	}
+
+	elapsed := time.Since(startTime).Truncate(time.Second)
+	rec.Duration = time.Since(startTime)
+	rec.SessionID = sessionID
+	rec.setResultMeta(result)
+	switch {
+	case err != nil:
+		rec.Error = err.Error()
+	case verr != nil:
+		rec.Error = "invalid json: " + verr.Error()
+		rec.Output = result.Output
+	default:
+		rec.Output = string(payload)
+	}
+	r.addExecRecord("json", rec)
+	r.save()
+
+	if err != nil && runCtx.Err() != nil && ctx.Err() == nil {
+		return // stopped by /kill <id>
+	}
+	if err != nil {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("执行出错（%s）", elapsed), Content: err.Error(), Template: "red", Receipt: id})
+		return
+	}
+	if verr != nil {
+		r.sender.SendCard(ctx, chatID, CardMsg{
+			Title:    fmt.Sprintf("JSON 校验失败（已尝试 %d 次）", attempts),
+			Content:  fmt.Sprintf("**错误:** %v\n\n**最后一次输出:**\n%s", verr, truncateForDisplay(strings.TrimSpace(result.Output), 3000)),
+			Template: "red",
+			Receipt:  id,
+		})
+		return
+	}
+
+	var pretty bytes.Buffer
+	if json.Indent(&pretty, payload, "", "  ") != nil {
+		pretty.Reset()
+		pretty.Write(payload)
+	}
+	pretty.WriteByte('\n')
+
+	title := "JSON 结果"
+	if attempts > 1 {
+		title = fmt.Sprintf("JSON 结果（第 %d 次尝试通过校验）", attempts)
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: summarizeJSON(payload), Template: "green", Receipt: id})
+	r.sendFile(ctx, chatID, fmt.Sprintf("result-%s.json", id), pretty.Bytes())
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 完成（耗时 %s）", elapsed))
+}
+
+// jsonPrompt wraps prompt with the structured-output instructions.
+func (r *Router) jsonPrompt(prompt string) string {
+	var sb strings.Builder
+	sb.WriteString(prompt)
+	sb.WriteString("\n\n---\n请只输出一个合法的 JSON 值作为最终回复，不要包含解释文字或 Markdown 代码块标记。")
+	if r.jsonSchemaText != "" {
+		sb.WriteString("\n输出必须符合以下 JSON Schema：\n")
+		sb.WriteString(strings.TrimSpace(r.jsonSchemaText))
+	}
+	return sb.String()
+}
+
+// parseJSONOutput extracts the JSON payload from Claude's output (tolerating
+// a surrounding code fence) and validates it against the configured schema.
+// It returns the compacted payload.
+func (r *Router) parseJSONOutput(output string) ([]byte, error) {
+	raw := stripCodeFence(strings.TrimSpace(output))
+	if raw == "" {
+		return nil, errors.New("empty output")
+	}
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected content after the JSON value")
+	}
+	if r.jsonSchema != nil {
+		if err := r.jsonSchema.Validate(v); err != nil {
+			return nil, err
+		}
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(raw)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// stripCodeFence removes a Markdown code fence wrapped around s, if any.
+func stripCodeFence(s string) string {
+	if !strings.HasPrefix(s, "```") || !strings.HasSuffix(s, "```") || len(s) < 6 {
+		return s
+	}
+	s = strings.TrimSuffix(s, "```")
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	} else {
+		s = strings.TrimPrefix(s, "```")
+	}
+	return strings.TrimSpace(s)
+}
+
+// summarizeJSON describes the shape of a JSON payload for the result card:
+// the fields of an object, or the length of an array, with short previews.
+func summarizeJSON(payload []byte) string {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return "（无法解析）"
+	}
+	var sb strings.Builder
+	switch val := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(&sb, "**对象**，%d 个字段:\n", len(keys))
+		for i, k := range keys {
+			if i == maxJSONSummaryKeys {
+				fmt.Fprintf(&sb, "- …（还有 %d 个字段）\n", len(keys)-i)
+				break
+			}
+			fmt.Fprintf(&sb, "- `%s`: %s\n", k, jsonPreview(val[k]))
+		}
+	case []interface{}:
+		fmt.Fprintf(&sb, "**数组**，%d 个元素", len(val))
+		if len(val) > 0 {
+			fmt.Fprintf(&sb, "\n- 第 1 个: %s", jsonPreview(val[0]))
+		}
+	default:
+		fmt.Fprintf(&sb, "**值:** %s", jsonPreview(val))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// jsonPreview renders a decoded JSON value briefly: scalars inline,
+// containers by their size.
+func jsonPreview(v interface{}) string {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return fmt.Sprintf("对象（%d 个字段）", len(val))
+	case []interface{}:
+		return fmt.Sprintf("数组（%d 个元素）", len(val))
+	case string:
+		return fmt.Sprintf("%q", truncateRunes(val, 60))
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// sendFile posts data as a file attachment (see deliverFile), or as a code
+// block when that fails and the file fits in messages.
+func (r *Router) sendFile(ctx context.Context, chatID, fileName string, data []byte) {
+	err := r.deliverFile(ctx, chatID, fileName, data)
+	if err == nil {
+		return
+	}
+	if len(data) > maxUploadSize {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("发送 %s 失败: %v", fileName, err))
+		return
+	}
+	r.sender.SendTextChunked(ctx, chatID, fmt.Sprintf("%s:\n```\n%s```", fileName, data))
+}
@@ -0,0 +1,208 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fileSpySender struct {
+	spySender
+	files map[string][]byte
+}
+
+func (s *fileSpySender) SendFile(_ context.Context, _, fileName string, data []byte) error {
+	if s.files == nil {
+		s.files = make(map[string][]byte)
+	}
+	s.files[fileName] = data
+	return nil
+}
+
+// newJSONRouter returns a router whose claude script prints outputs[i] as
+// the result of the i-th run (the last one repeats) and logs its prompts.
+func newJSONRouter(t *testing.T, sender Sender, outputs ...string) (*Router, string) {
+	t.Helper()
+	dir := t.TempDir()
+	for i, out := range outputs {
+		os.WriteFile(filepath.Join(dir, fmt.Sprintf("out%d", i+1)), []byte(out), 0644)
+	}
+	script := fmt.Sprintf(`#!/bin/sh
+n=$(cat %[1]s/count 2>/dev/null || echo 0)
+n=$((n+1))
+echo $n > %[1]s/count
+printf '%%s\n---END---\n' "$* $(cat)" >> %[1]s/prompts
+f=%[1]s/out$n
+[ -f "$f" ] || f=%[1]s/out%[2]d
+printf '{"type":"result","result":%%s,"session_id":"s1"}\n' "$(cat "$f")"
+`, dir, len(outputs))
+	claude := filepath.Join(dir, "claude")
+	os.WriteFile(claude, []byte(script), 0755)
+
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	r := NewRouter(context.Background(), NewClaudeExecutor(claude, "sonnet", 10*time.Second), store, sender, map[string]bool{"user1": true}, dir, nil)
+	return r, filepath.Join(dir, "prompts")
+}
+
+// jsonString quotes s as a JSON string for embedding in a result event.
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func TestRouterJSON_ValidOutput(t *testing.T) {
+	sender := &fileSpySender{}
+	r, prompts := newJSONRouter(t, sender, jsonString("```json\n{\"passed\": 3, \"failed\": [\"a\"]}\n```"))
+	r.Route(context.Background(), "chat1", "user1", "/json run the tests")
+
+	recs := r.store.ExecRecords("chat1", 0)
+	if len(recs) != 1 || recs[0].Error != "" || recs[0].Output != `{"passed":3,"failed":["a"]}` {
+		t.Fatalf("expected compacted payload in record, got %+v", recs)
+	}
+	data, ok := sender.files["result-"+recs[0].ID+".json"]
+	if !ok || !strings.Contains(string(data), "\"passed\": 3") {
+		t.Fatalf("expected indented raw payload file, got %v", sender.files)
+	}
+	var summary string
+	for _, m := range sender.messages {
+		if strings.HasPrefix(m, "JSON 结果") {
+			summary = m
+		}
+	}
+	if !strings.Contains(summary, "`failed`: 数组（1 个元素）") || !strings.Contains(summary, "`passed`: 3") {
+		t.Fatalf("expected field summary card, got %q", summary)
+	}
+	logged, _ := os.ReadFile(prompts)
+	if !strings.Contains(string(logged), "run the tests") || !strings.Contains(string(logged), "合法的 JSON") {
+		t.Fatalf("expected prompt to carry JSON instructions, got %q", logged)
+	}
+	if sess := r.getSession("chat1"); sess.ClaudeSessionID != "s1" {
+		t.Fatalf("expected session to be updated, got %q", sess.ClaudeSessionID)
+	}
+}
+
+func TestRouterJSON_RetriesInvalidOutput(t *testing.T) {
+	sender := &fileSpySender{}
+	r, prompts := newJSONRouter(t, sender, jsonString("Here you go: {oops"), jsonString(`{"ok": true}`))
+	r.Route(context.Background(), "chat1", "user1", "/json summarize")
+
+	recs := r.store.ExecRecords("chat1", 0)
+	if len(recs) != 1 || recs[0].Error != "" || recs[0].Output != `{"ok":true}` {
+		t.Fatalf("expected success after retry, got %+v", recs)
+	}
+	logged, _ := os.ReadFile(prompts)
+	runs := strings.Split(strings.TrimSuffix(string(logged), "---END---\n"), "---END---\n")
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 runs, got %d: %q", len(runs), logged)
+	}
+	if !strings.Contains(runs[1], "--resume s1") || !strings.Contains(runs[1], "不是符合要求的 JSON") {
+		t.Fatalf("expected correction prompt in the same session, got %q", runs[1])
+	}
+	found := false
+	for _, m := range sender.messages {
+		if strings.HasPrefix(m, "JSON 结果（第 2 次尝试通过校验）") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected summary to mention the retry, got %v", sender.messages)
+	}
+}
+
+func TestRouterJSON_SchemaViolationGivesUp(t *testing.T) {
+	sender := &fileSpySender{}
+	r, prompts := newJSONRouter(t, sender, jsonString(`{"passed": "three"}`))
+	if err := r.SetJSONSchema(`{"type":"object","required":["passed"],"properties":{"passed":{"type":"integer"}}}`); err != nil {
+		t.Fatal(err)
+	}
+	r.SetJSONRetries(1)
+	r.Route(context.Background(), "chat1", "user1", "/json count tests")
+
+	recs := r.store.ExecRecords("chat1", 0)
+	if len(recs) != 1 || !strings.HasPrefix(recs[0].Error, "invalid json:") {
+		t.Fatalf("expected invalid json error, got %+v", recs)
+	}
+	if !strings.HasPrefix(sender.LastMessage(), "JSON 校验失败（已尝试 2 次）") {
+		t.Fatalf("expected failure card, got %q", sender.LastMessage())
+	}
+	if len(sender.files) != 0 {
+		t.Fatalf("expected no file for invalid output, got %v", sender.files)
+	}
+	logged, _ := os.ReadFile(prompts)
+	if !strings.Contains(string(logged), `"required":["passed"]`) {
+		t.Fatalf("expected schema in the prompt, got %q", logged)
+	}
+}
+
+func TestRouterJSON_FallsBackToTextWithoutFileSender(t *testing.T) {
+	sender := &spySender{}
+	r, _ := newJSONRouter(t, sender, jsonString(`[1, 2]`))
+	r.Route(context.Background(), "chat1", "user1", "/json list")
+
+	var block string
+	for _, m := range sender.messages {
+		if strings.HasPrefix(m, "result-") {
+			block = m
+		}
+	}
+	if !strings.Contains(block, "```\n[\n  1,\n  2\n]\n```") {
+		t.Fatalf("expected payload as code block, got %v", sender.messages)
+	}
+}
+
+func TestRouterJSON_Usage(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/json")
+	if !strings.Contains(sender.LastMessage(), "用法: /json") {
+		t.Fatalf("expected usage, got %q", sender.LastMessage())
+	}
+}
+
+func TestRouterSetJSONSchema_Invalid(t *testing.T) {
+	r, _ := newTestRouter(t)
+	if err := r.SetJSONSchema(`{"type": 5}`); err == nil {
+		t.Fatal("expected error for invalid schema")
+	}
+	if err := r.SetJSONSchema(""); err != nil || r.jsonSchema != nil {
+		t.Fatalf("expected empty schema to disable validation, got %v", err)
+	}
+}
+
+func TestParseJSONOutput(t *testing.T) {
+	r, _ := newTestRouter(t)
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{`{"a": 1}`, `{"a":1}`, true},
+		{"```json\n{\"a\": 1}\n```", `{"a":1}`, true},
+		{"```\n[true]\n```", `[true]`, true},
+		{`"just a string"`, `"just a string"`, true},
+		{`{"a": 1} trailing`, "", false},
+		{`Sure! {"a": 1}`, "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, err := r.parseJSONOutput(tt.in)
+		if (err == nil) != tt.ok || string(got) != tt.want {
+			t.Errorf("parseJSONOutput(%q) = %q, %v; want %q, ok=%v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSummarizeJSON(t *testing.T) {
+	if got := summarizeJSON([]byte(`{"b":"x","a":null}`)); got != "**对象**，2 个字段:\n- `a`: null\n- `b`: \"x\"" {
+		t.Fatalf("unexpected object summary %q", got)
+	}
+	if got := summarizeJSON([]byte(`[{"k":1}]`)); got != "**数组**，1 个元素\n- 第 1 个: 对象（1 个字段）" {
+		t.Fatalf("unexpected array summary %q", got)
+	}
+	if got := summarizeJSON([]byte(`42`)); got != "**值:** 42" {
+		t.Fatalf("unexpected scalar summary %q", got)
+	}
+}
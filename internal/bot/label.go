@@ -0,0 +1,217 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxLabelRunes bounds one execution label.
+	maxLabelRunes = 32
+	// defaultHistoryLimit is how many executions /history lists.
+	defaultHistoryLimit = 20
+)
+
+// normalizeLabel lower-cases label and reports whether it is usable: one
+// word without ":" or ",", so it can be written as label:<name>.
+func normalizeLabel(label string) (string, bool) {
+	label = strings.ToLower(strings.TrimSpace(label))
+	n := len([]rune(label))
+	if n == 0 || n > maxLabelRunes || strings.ContainsAny(label, ":, \t\n") {
+		return "", false
+	}
+	return label, true
+}
+
+func hasLabel(rec ExecRecord, label string) bool {
+	for _, l := range rec.Labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// cmdLabel tags an execution (the chat's latest by default) with a label,
+// removes one, or lists the chat's labels.
+func (r *Router) cmdLabel(ctx context.Context, chatID, args string) {
+	usage := "用法: /label <标签> [执行ID]\n       /label rm <标签> [执行ID]\n       /label  列出当前聊天用过的标签\n给执行记录加标签（默认最近一次执行），之后可用 /history label:<标签> 查看同一标签下的所有执行。"
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		counts := make(map[string]int)
+		for _, rec := range r.store.ExecRecords(chatID, 0) {
+			for _, l := range rec.Labels {
+				counts[l]++
+			}
+		}
+		if len(counts) == 0 {
+			r.sender.SendText(ctx, chatID, "当前聊天还没有标签。\n\n"+usage)
+			return
+		}
+		labels := make([]string, 0, len(counts))
+		for l := range counts {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+		var sb strings.Builder
+		for _, l := range labels {
+			fmt.Fprintf(&sb, "- `%s` %d 次执行\n", l, counts[l])
+		}
+		sb.WriteString("\n`/history label:<标签>` 查看")
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("标签（%d）", len(labels)), Content: sb.String()})
+		return
+	}
+
+	remove := fields[0] == "rm"
+	if remove {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 || len(fields) > 2 {
+		r.sender.SendText(ctx, chatID, usage)
+		return
+	}
+	label, ok := normalizeLabel(fields[0])
+	if !ok {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("标签应为不含空格、冒号和逗号的单个词（最多 %d 个字符）。", maxLabelRunes))
+		return
+	}
+	var rec ExecRecord
+	if len(fields) == 2 {
+		rec, ok = r.store.ExecRecord(fields[1])
+		if !ok || rec.ChatID != chatID {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("找不到执行记录: %s", fields[1]))
+			return
+		}
+	} else {
+		recs := r.store.ExecRecords(chatID, 1)
+		if len(recs) == 0 {
+			r.sender.SendText(ctx, chatID, "当前聊天还没有执行记录。")
+			return
+		}
+		rec = recs[0]
+	}
+
+	if remove {
+		if !hasLabel(rec, label) {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("执行 %s 没有标签 %s", rec.ID, label))
+			return
+		}
+		r.store.UpdateExecRecord(rec.ID, func(e *ExecRecord) {
+			kept := e.Labels[:0]
+			for _, l := range e.Labels {
+				if l != label {
+					kept = append(kept, l)
+				}
+			}
+			e.Labels = kept
+		})
+		r.save()
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已从执行 %s 移除标签 %s", rec.ID, label))
+		return
+	}
+	if !hasLabel(rec, label) {
+		r.store.UpdateExecRecord(rec.ID, func(e *ExecRecord) {
+			e.Labels = append(e.Labels, label)
+		})
+		r.save()
+	}
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 执行 %s（%s）已加标签 %s", rec.ID, truncateRunes(strings.Join(strings.Fields(rec.Prompt), " "), 40), label))
+}
+
+// historyQuery is a parsed /history filter: every label and every keyword
+// must match.
+type historyQuery struct {
+	labels   []string
+	keywords []string
+	limit    int
+}
+
+func parseHistoryQuery(args string) (historyQuery, bool) {
+	q := historyQuery{limit: defaultHistoryLimit}
+	for _, f := range strings.Fields(args) {
+		if l, ok := strings.CutPrefix(f, "label:"); ok {
+			label, valid := normalizeLabel(l)
+			if !valid {
+				return historyQuery{}, false
+			}
+			q.labels = append(q.labels, label)
+			continue
+		}
+		if n, err := strconv.Atoi(f); err == nil && n > 0 {
+			q.limit = n
+			continue
+		}
+		q.keywords = append(q.keywords, strings.ToLower(f))
+	}
+	return q, true
+}
+
+func (q historyQuery) matches(rec ExecRecord) bool {
+	for _, l := range q.labels {
+		if !hasLabel(rec, l) {
+			return false
+		}
+	}
+	text := strings.ToLower(rec.Prompt)
+	for _, k := range q.keywords {
+		if !strings.Contains(text, k) {
+			return false
+		}
+	}
+	return true
+}
+
+// cmdHistory lists the chat's executions, newest first, filtered by labels
+// and prompt keywords.
+func (r *Router) cmdHistory(ctx context.Context, chatID, args string) {
+	q, ok := parseHistoryQuery(args)
+	if !ok {
+		r.sender.SendText(ctx, chatID, "用法: /history [label:<标签>]... [关键词]... [条数]\n列出当前聊天的执行记录（默认最近 20 条），可按标签和 prompt 关键词筛选。")
+		return
+	}
+	var matched []ExecRecord
+	total := 0
+	for _, rec := range r.store.ExecRecords(chatID, 0) {
+		if !q.matches(rec) {
+			continue
+		}
+		total++
+		if len(matched) < q.limit {
+			matched = append(matched, rec)
+		}
+	}
+	if total == 0 {
+		r.sender.SendText(ctx, chatID, "没有符合条件的执行记录。")
+		return
+	}
+	var sb strings.Builder
+	var span time.Duration
+	for _, rec := range matched {
+		mark := "✓"
+		if rec.Error != "" {
+			mark = "✗"
+		}
+		span += rec.Duration
+		fmt.Fprintf(&sb, "%s `%s` %s · %s · %s", mark, rec.ID, rec.StartedAt.Format("01-02 15:04"), rec.Duration.Truncate(time.Second), truncateRunes(strings.Join(strings.Fields(rec.Prompt), " "), 40))
+		if len(rec.Labels) > 0 {
+			fmt.Fprintf(&sb, " 🏷 %s", strings.Join(rec.Labels, ", "))
+		}
+		if rec.Incident != "" {
+			fmt.Fprintf(&sb, " 🚨 %s", rec.Incident)
+		}
+		sb.WriteString("\n")
+	}
+	if total > len(matched) {
+		fmt.Fprintf(&sb, "……另有 %d 条，在命令末尾加条数查看更多\n", total-len(matched))
+	}
+	fmt.Fprintf(&sb, "\n共耗时 %s · `/share <执行ID>` 或 `/guest <执行ID>` 分享单次结果", span.Truncate(time.Second))
+	title := fmt.Sprintf("执行历史（%d 条）", total)
+	if len(q.labels) > 0 {
+		title = fmt.Sprintf("标签 %s（%d 条）", strings.Join(q.labels, " + "), total)
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: sb.String()})
+}
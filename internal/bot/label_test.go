@@ -0,0 +1,75 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseHistoryQuery(t *testing.T) {
+	q, ok := parseHistoryQuery("label:Deploy-Prep nginx 5")
+	if !ok || len(q.labels) != 1 || q.labels[0] != "deploy-prep" || len(q.keywords) != 1 || q.keywords[0] != "nginx" || q.limit != 5 {
+		t.Fatalf("unexpected query %+v %v", q, ok)
+	}
+	if _, ok := parseHistoryQuery("label:"); ok {
+		t.Fatal("expected empty label to be rejected")
+	}
+	if q, _ := parseHistoryQuery(""); q.limit != defaultHistoryLimit {
+		t.Fatalf("expected default limit, got %d", q.limit)
+	}
+}
+
+func TestRouterLabelHistory(t *testing.T) {
+	r, sender := newTestRouter(t)
+	ctx := context.Background()
+	day := time.Date(2026, 10, 1, 9, 0, 0, 0, time.Local)
+	r.store.AddExecRecord(ExecRecord{ID: "e1", ChatID: "chat1", Prompt: "update nginx config", StartedAt: day})
+	r.store.AddExecRecord(ExecRecord{ID: "e2", ChatID: "chat1", Prompt: "write release notes", StartedAt: day.Add(24 * time.Hour)})
+	r.store.AddExecRecord(ExecRecord{ID: "e3", ChatID: "chat2", Prompt: "other chat", StartedAt: day})
+	r.store.AddExecRecord(ExecRecord{ID: "e4", ChatID: "chat1", Prompt: "run smoke tests", Error: "timeout", StartedAt: day.Add(48 * time.Hour)})
+
+	r.Route(ctx, "chat1", "user1", "/label Deploy-Prep")
+	r.Route(ctx, "chat1", "user1", "/label deploy-prep e1")
+	r.Route(ctx, "chat1", "user1", "/label deploy-prep e1")
+	if rec, _ := r.store.ExecRecord("e1"); len(rec.Labels) != 1 || rec.Labels[0] != "deploy-prep" {
+		t.Fatalf("expected one label on e1, got %v", rec.Labels)
+	}
+	if rec, _ := r.store.ExecRecord("e4"); len(rec.Labels) != 1 {
+		t.Fatalf("expected the latest execution labelled, got %v", rec.Labels)
+	}
+	r.Route(ctx, "chat1", "user1", "/label deploy-prep e3")
+	if !strings.Contains(sender.LastMessage(), "找不到执行记录") {
+		t.Fatalf("expected another chat's record to be refused, got %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "user1", "/label bad:label")
+	if !strings.Contains(sender.LastMessage(), "冒号") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+
+	r.Route(ctx, "chat1", "user1", "/history label:deploy-prep")
+	msg := sender.LastMessage()
+	if !strings.Contains(msg, "标签 deploy-prep（2 条）") || !strings.Contains(msg, "`e1`") || !strings.Contains(msg, "`e4`") || strings.Contains(msg, "`e2`") {
+		t.Fatalf("unexpected history %q", msg)
+	}
+	if strings.Index(msg, "`e4`") > strings.Index(msg, "`e1`") {
+		t.Fatalf("expected newest first, got %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "/history label:deploy-prep nginx")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "（1 条）") || !strings.Contains(msg, "`e1`") {
+		t.Fatalf("unexpected filtered history %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "/history 1")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "执行历史（3 条）") || !strings.Contains(msg, "另有 2 条") {
+		t.Fatalf("unexpected limited history %q", msg)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/label rm deploy-prep e1")
+	if rec, _ := r.store.ExecRecord("e1"); len(rec.Labels) != 0 {
+		t.Fatalf("expected label removed, got %v", rec.Labels)
+	}
+	r.Route(ctx, "chat1", "user1", "/label")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "`deploy-prep` 1 次执行") {
+		t.Fatalf("unexpected label list %q", msg)
+	}
+}
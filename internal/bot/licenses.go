@@ -0,0 +1,370 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// licenseScanTimeout bounds each license tool run.
+const licenseScanTimeout = 5 * time.Minute
+
+// licenseDep is one dependency and its declared license.
+type licenseDep struct {
+	Name    string
+	Version string
+	License string // SPDX ID or expression; "" if unknown
+	URL     string
+}
+
+// licenseTool inventories the dependency licenses of one ecosystem.
+type licenseTool struct {
+	Name  string
+	Args  func(dir string) []string // nil if the tool does not apply
+	Parse func(out []byte) ([]licenseDep, error)
+}
+
+var licenseTools = []licenseTool{
+	{
+		Name: "go-licenses",
+		Args: func(dir string) []string {
+			if !fileExists(filepath.Join(dir, "go.mod")) {
+				return nil
+			}
+			return []string{"go-licenses", "report", "./..."}
+		},
+		Parse: parseGoLicenses,
+	},
+	{
+		Name: "license-checker",
+		Args: func(dir string) []string {
+			if !fileExists(filepath.Join(dir, "package.json")) {
+				return nil
+			}
+			return []string{"license-checker", "--json"}
+		},
+		Parse: parseLicenseChecker,
+	},
+}
+
+// parseGoLicenses parses the CSV of "go-licenses report": module, license
+// URL and license name per line.
+func parseGoLicenses(out []byte) ([]licenseDep, error) {
+	r := csv.NewReader(bytes.NewReader(out))
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var deps []licenseDep
+	for _, row := range rows {
+		if len(row) < 3 || row[0] == "" {
+			continue
+		}
+		lic := strings.TrimSpace(row[2])
+		if strings.EqualFold(lic, "Unknown") {
+			lic = ""
+		}
+		deps = append(deps, licenseDep{Name: row[0], License: lic, URL: row[1]})
+	}
+	return deps, nil
+}
+
+// parseLicenseChecker parses "license-checker --json", keyed by
+// name@version; licenses is a string or a list.
+func parseLicenseChecker(out []byte) ([]licenseDep, error) {
+	var report map[string]struct {
+		Licenses   json.RawMessage `json:"licenses"`
+		Repository string          `json:"repository"`
+	}
+	if err := json.Unmarshal(out, &report); err != nil {
+		return nil, err
+	}
+	var deps []licenseDep
+	for key, v := range report {
+		name, version := key, ""
+		if i := strings.LastIndexByte(key, '@'); i > 0 {
+			name, version = key[:i], key[i+1:]
+		}
+		var lic string
+		var list []string
+		if json.Unmarshal(v.Licenses, &lic) != nil && json.Unmarshal(v.Licenses, &list) == nil {
+			lic = strings.Join(list, " AND ")
+		}
+		// license-checker marks guesses from the license text with "*".
+		lic = strings.TrimSuffix(strings.TrimSpace(lic), "*")
+		if strings.EqualFold(lic, "UNKNOWN") {
+			lic = ""
+		}
+		deps = append(deps, licenseDep{Name: name, Version: version, License: lic, URL: v.Repository})
+	}
+	return deps, nil
+}
+
+// licenseDenied reports whether license violates the deny list. For an
+// "A OR B" expression the dependency can be used under any alternative, so
+// it only violates the policy when every alternative is denied; for
+// "A AND B" any denied part is a violation.
+func licenseDenied(license string, deny map[string]bool) bool {
+	if license == "" || len(deny) == 0 {
+		return false
+	}
+	expr := strings.Trim(strings.TrimSpace(license), "()")
+	if alts := splitLicenseExpr(expr, " OR "); len(alts) > 1 {
+		for _, alt := range alts {
+			if !licenseDenied(alt, deny) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, part := range splitLicenseExpr(expr, " AND ") {
+		if deny[strings.ToLower(strings.Trim(strings.TrimSpace(part), "()"))] {
+			return true
+		}
+	}
+	return false
+}
+
+func splitLicenseExpr(expr, op string) []string {
+	return strings.Split(strings.ReplaceAll(expr, strings.ToLower(op), op), op)
+}
+
+// SetLicensePolicy sets the licenses /licenses flags as violations (SPDX
+// IDs, case-insensitive) and whether violations block /pr.
+func (r *Router) SetLicensePolicy(deny []string, blockPR bool) {
+	r.licenseDeny = make(map[string]bool, len(deny))
+	for _, l := range deny {
+		if l = strings.ToLower(strings.TrimSpace(l)); l != "" {
+			r.licenseDeny[l] = true
+		}
+	}
+	r.licenseBlockPR = blockPR
+}
+
+// licenseReport is the outcome of inventorying a project's licenses.
+type licenseReport struct {
+	Deps       []licenseDep
+	Violations []licenseDep
+	Unknown    []licenseDep
+	Notes      []string // per tool: ran, skipped or failed
+	Ran        bool     // at least one tool produced an inventory
+	Incomplete bool     // an applicable tool was missing or failed
+}
+
+// inventoryLicenses runs the applicable license tools in dir and applies
+// the deny list.
+func (r *Router) inventoryLicenses(ctx context.Context, dir string) licenseReport {
+	var rep licenseReport
+	for _, tool := range licenseTools {
+		args := tool.Args(dir)
+		if args == nil {
+			continue
+		}
+		if _, err := exec.LookPath(args[0]); err != nil {
+			rep.Notes = append(rep.Notes, fmt.Sprintf("%s（未安装，跳过）", tool.Name))
+			rep.Incomplete = true
+			continue
+		}
+		execCtx, cancel := context.WithTimeout(ctx, licenseScanTimeout)
+		cmd := exec.CommandContext(execCtx, args[0], args[1:]...)
+		cmd.Dir = dir
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		// go-licenses exits non-zero on warnings about unknown licenses
+		// while still printing the report, so only empty or unparsable
+		// output counts as a failure.
+		runErr := cmd.Run()
+		cancel()
+		deps, err := tool.Parse(stdout.Bytes())
+		if err != nil || (len(deps) == 0 && runErr != nil) {
+			msg := strings.TrimSpace(stderr.String())
+			if msg == "" && runErr != nil {
+				msg = runErr.Error()
+			} else if msg == "" {
+				msg = err.Error()
+			}
+			rep.Notes = append(rep.Notes, fmt.Sprintf("%s（失败: %s）", tool.Name, truncateRunes(msg, 200)))
+			rep.Incomplete = true
+			continue
+		}
+		rep.Ran = true
+		rep.Notes = append(rep.Notes, fmt.Sprintf("%s ✓ %d 个依赖", tool.Name, len(deps)))
+		rep.Deps = append(rep.Deps, deps...)
+	}
+	sort.Slice(rep.Deps, func(i, j int) bool { return rep.Deps[i].Name < rep.Deps[j].Name })
+	for _, d := range rep.Deps {
+		switch {
+		case d.License == "":
+			rep.Unknown = append(rep.Unknown, d)
+		case licenseDenied(d.License, r.licenseDeny):
+			rep.Violations = append(rep.Violations, d)
+		}
+	}
+	return rep
+}
+
+func (d licenseDep) label() string {
+	if d.Version != "" {
+		return d.Name + "@" + d.Version
+	}
+	return d.Name
+}
+
+// formatLicenseReport renders the license counts, violations and unknown
+// licenses of rep.
+func (r *Router) formatLicenseReport(rep licenseReport) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**工具:** %s\n", strings.Join(rep.Notes, "，"))
+	if len(r.licenseDeny) > 0 {
+		deny := make([]string, 0, len(r.licenseDeny))
+		for l := range r.licenseDeny {
+			deny = append(deny, l)
+		}
+		sort.Strings(deny)
+		fmt.Fprintf(&sb, "**禁止:** %s\n", strings.Join(deny, ", "))
+	}
+
+	counts := make(map[string]int)
+	for _, d := range rep.Deps {
+		lic := d.License
+		if lic == "" {
+			lic = "未知"
+		}
+		counts[lic]++
+	}
+	names := make([]string, 0, len(counts))
+	for l := range counts {
+		names = append(names, l)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	fmt.Fprintf(&sb, "\n**许可证分布（%d 个依赖）:**\n", len(rep.Deps))
+	for _, l := range names {
+		fmt.Fprintf(&sb, "- %s: %d\n", l, counts[l])
+	}
+	if len(rep.Violations) > 0 {
+		fmt.Fprintf(&sb, "\n**❌ 违规（%d）:**\n", len(rep.Violations))
+		for _, d := range rep.Violations {
+			fmt.Fprintf(&sb, "- `%s` %s\n", d.label(), d.License)
+		}
+	}
+	if len(rep.Unknown) > 0 {
+		fmt.Fprintf(&sb, "\n**⚠️ 无法识别（%d）:**\n", len(rep.Unknown))
+		for i, d := range rep.Unknown {
+			if i == 20 {
+				fmt.Fprintf(&sb, "- …还有 %d 个\n", len(rep.Unknown)-20)
+				break
+			}
+			fmt.Fprintf(&sb, "- `%s`\n", d.label())
+		}
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// renderNotice renders a NOTICE file listing the third-party dependencies
+// and their licenses.
+func renderNotice(project string, deps []licenseDep) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s\n\nThis product includes the following third-party software:\n", project)
+	for _, d := range deps {
+		lic := d.License
+		if lic == "" {
+			lic = "Unknown"
+		}
+		fmt.Fprintf(&sb, "\n%s\n  License: %s\n", d.label(), lic)
+		if d.URL != "" {
+			fmt.Fprintf(&sb, "  Source: %s\n", d.URL)
+		}
+	}
+	return sb.String()
+}
+
+func (r *Router) cmdLicenses(ctx context.Context, chatID, args string) {
+	if args != "" && args != "notice" {
+		r.sender.SendText(ctx, chatID, "用法:\n/licenses  盘点依赖许可证（go-licenses、license-checker）并按策略检查\n/licenses notice  盘点后在项目根目录生成 NOTICE 文件")
+		return
+	}
+	session := r.getSession(chatID)
+	dir := session.WorkDir
+	if dir == "" {
+		dir = r.store.WorkRoot()
+	}
+
+	r.sender.SendText(ctx, chatID, "盘点依赖许可证中...")
+	rep := r.inventoryLicenses(ctx, dir)
+	if len(rep.Notes) == 0 {
+		r.sender.SendText(ctx, chatID, "未识别到可盘点的项目类型（支持 Go: go-licenses、Node: license-checker）。")
+		return
+	}
+	if !rep.Ran {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "许可证盘点未能运行", Content: fmt.Sprintf("**工具:** %s", strings.Join(rep.Notes, "，")), Template: "red"})
+		return
+	}
+
+	content := r.formatLicenseReport(rep)
+	if args == "notice" {
+		path := filepath.Join(dir, "NOTICE")
+		if err := os.WriteFile(path, []byte(renderNotice(filepath.Base(dir), rep.Deps)), 0644); err != nil {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("写入 NOTICE 失败: %v", err))
+			return
+		}
+		content += fmt.Sprintf("\n\n✓ 已生成 %s（%d 个依赖）", path, len(rep.Deps))
+	}
+	title, tpl := "✓ 依赖许可证合规", "green"
+	switch {
+	case len(rep.Violations) > 0:
+		title, tpl = fmt.Sprintf("依赖许可证: %d 项违规", len(rep.Violations)), "red"
+	case len(rep.Unknown) > 0:
+		title, tpl = fmt.Sprintf("依赖许可证: %d 个无法识别", len(rep.Unknown)), "orange"
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: content, Template: tpl})
+}
+
+// licenseGate checks the licenses of dir before /pr when the policy blocks
+// PRs. It reports whether the PR may be created; when it may not, the
+// reason has been posted to the chat. It fails closed: an inventory that
+// could not run completely blocks the PR too, and dependencies whose
+// license could not be identified are reported without blocking it.
+func (r *Router) licenseGate(ctx context.Context, chatID, dir string) bool {
+	if !r.licenseBlockPR || len(r.licenseDeny) == 0 {
+		return true
+	}
+	rep := r.inventoryLicenses(ctx, dir)
+	switch {
+	case len(rep.Violations) > 0:
+		r.sender.SendCard(ctx, chatID, CardMsg{
+			Title:    "已阻止创建 PR：依赖许可证违规",
+			Content:  r.formatLicenseReport(rep) + "\n\n请移除或替换违规依赖后再创建 PR。",
+			Template: "red",
+		})
+		return false
+	case rep.Incomplete:
+		r.sender.SendCard(ctx, chatID, CardMsg{
+			Title:    "已阻止创建 PR：许可证盘点未能完成",
+			Content:  fmt.Sprintf("**工具:** %s\n\n开启了 license_block_pr，无法确认依赖许可证时不创建 PR。请安装或修复盘点工具后重试（/licenses 查看详情）。", strings.Join(rep.Notes, "，")),
+			Template: "red",
+		})
+		return false
+	case len(rep.Unknown) > 0:
+		r.sender.SendCard(ctx, chatID, CardMsg{
+			Title:    fmt.Sprintf("⚠️ 依赖许可证: %d 个无法识别", len(rep.Unknown)),
+			Content:  r.formatLicenseReport(rep) + "\n\n这些依赖的许可证无法识别，未计入违规，PR 仍会创建，请人工确认。",
+			Template: "orange",
+		})
+	}
+	return true
+}
@@ -0,0 +1,166 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const goLicensesReport = `github.com/spf13/cobra,https://github.com/spf13/cobra/blob/v1.8.0/LICENSE.txt,Apache-2.0
+github.com/some/gpl,https://github.com/some/gpl/blob/master/COPYING,GPL-3.0
+golang.org/x/sys,https://cs.opensource.google/go/x/sys/+/v0.15.0:LICENSE,BSD-3-Clause
+github.com/mystery/pkg,Unknown,Unknown
+`
+
+func TestParseGoLicenses(t *testing.T) {
+	deps, err := parseGoLicenses([]byte(goLicensesReport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deps) != 4 || deps[0].Name != "github.com/spf13/cobra" || deps[0].License != "Apache-2.0" || deps[3].License != "" {
+		t.Fatalf("unexpected deps %+v", deps)
+	}
+}
+
+func TestParseLicenseChecker(t *testing.T) {
+	out := `{
+	  "left-pad@1.3.0": {"licenses": "WTFPL", "repository": "https://github.com/stevemao/left-pad"},
+	  "@scope/pkg@2.0.0": {"licenses": ["MIT", "Apache-2.0"]},
+	  "guessed@1.0.0": {"licenses": "BSD*"},
+	  "mystery@0.1.0": {"licenses": "UNKNOWN"}
+	}`
+	deps, err := parseLicenseChecker([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]licenseDep)
+	for _, d := range deps {
+		got[d.Name] = d
+	}
+	if d := got["@scope/pkg"]; d.Version != "2.0.0" || d.License != "MIT AND Apache-2.0" {
+		t.Fatalf("unexpected scoped package %+v", d)
+	}
+	if got["guessed"].License != "BSD" || got["mystery"].License != "" || got["left-pad"].URL == "" {
+		t.Fatalf("unexpected deps %+v", deps)
+	}
+}
+
+func TestLicenseDenied(t *testing.T) {
+	deny := map[string]bool{"gpl-3.0": true, "agpl-3.0": true}
+	tests := []struct {
+		license string
+		want    bool
+	}{
+		{"MIT", false},
+		{"GPL-3.0", true},
+		{"gpl-3.0", true},
+		{"(MIT OR GPL-3.0)", false},
+		{"GPL-3.0 or AGPL-3.0", true},
+		{"MIT AND GPL-3.0", true},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := licenseDenied(tt.license, deny); got != tt.want {
+			t.Errorf("licenseDenied(%q) = %v, want %v", tt.license, got, tt.want)
+		}
+	}
+	if licenseDenied("GPL-3.0", nil) {
+		t.Error("expected no violations without a policy")
+	}
+}
+
+func TestRenderNotice(t *testing.T) {
+	got := renderNotice("devbot", []licenseDep{
+		{Name: "a", Version: "1.0", License: "MIT", URL: "https://example.com/a"},
+		{Name: "b"},
+	})
+	want := "devbot\n\nThis product includes the following third-party software:\n\na@1.0\n  License: MIT\n  Source: https://example.com/a\n\nb\n  License: Unknown\n"
+	if got != want {
+		t.Fatalf("unexpected NOTICE:\n%s", got)
+	}
+}
+
+func newLicenseRouter(t *testing.T) (*Router, *spySender, string) {
+	t.Helper()
+	r, sender := newTestRouter(t)
+	dir := r.getSession("chat1").WorkDir
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module x\n"), 0644)
+	out := fakeScanner(t, "go-licenses")
+	os.WriteFile(out, []byte(goLicensesReport), 0644)
+	return r, sender, dir
+}
+
+func TestRouterLicenses(t *testing.T) {
+	r, sender, dir := newLicenseRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/licenses")
+	msg := sender.LastMessage()
+	if !strings.HasPrefix(msg, "依赖许可证: 1 个无法识别") || !strings.Contains(msg, "go-licenses ✓ 4 个依赖") || !strings.Contains(msg, "- GPL-3.0: 1") {
+		t.Fatalf("expected inventory without policy violations, got %q", msg)
+	}
+
+	r.SetLicensePolicy([]string{" GPL-3.0 ", "AGPL-3.0"}, false)
+	r.Route(context.Background(), "chat1", "user1", "/licenses notice")
+	msg = sender.LastMessage()
+	if !strings.HasPrefix(msg, "依赖许可证: 1 项违规") || !strings.Contains(msg, "`github.com/some/gpl` GPL-3.0") || !strings.Contains(msg, "**禁止:** agpl-3.0, gpl-3.0") {
+		t.Fatalf("expected violation, got %q", msg)
+	}
+	notice, err := os.ReadFile(filepath.Join(dir, "NOTICE"))
+	if err != nil || !strings.Contains(string(notice), "golang.org/x/sys\n  License: BSD-3-Clause") {
+		t.Fatalf("expected NOTICE file, got %q, %v", notice, err)
+	}
+	if !strings.Contains(msg, "已生成") {
+		t.Fatalf("expected NOTICE confirmation, got %q", msg)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/licenses foo")
+	if !strings.HasPrefix(sender.LastMessage(), "用法:") {
+		t.Fatalf("expected usage, got %q", sender.LastMessage())
+	}
+}
+
+func TestRouterLicenses_NoTools(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/licenses")
+	if !strings.Contains(sender.LastMessage(), "未识别到可盘点的项目类型") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+	os.WriteFile(filepath.Join(r.getSession("chat1").WorkDir, "package.json"), []byte("{}"), 0644)
+	t.Setenv("PATH", t.TempDir())
+	r.Route(context.Background(), "chat1", "user1", "/licenses")
+	if msg := sender.LastMessage(); !strings.HasPrefix(msg, "许可证盘点未能运行") || !strings.Contains(msg, "license-checker（未安装，跳过）") {
+		t.Fatalf("expected missing tool card, got %q", msg)
+	}
+}
+
+func TestRouterPR_BlockedByLicenses(t *testing.T) {
+	r, sender, _ := newLicenseRouter(t)
+	r.SetLicensePolicy([]string{"GPL-3.0"}, true)
+	r.Route(context.Background(), "chat1", "user1", "/pr my change")
+	if msg := sender.LastMessage(); !strings.HasPrefix(msg, "已阻止创建 PR") || !strings.Contains(msg, "github.com/some/gpl") {
+		t.Fatalf("expected PR to be blocked, got %q", msg)
+	}
+
+	// Unidentified licenses are reported but do not block.
+	os.WriteFile(fakeScanner(t, "go-licenses"), []byte("github.com/mystery/pkg,Unknown,Unknown\n"), 0644)
+	sender.messages = nil
+	r.Route(context.Background(), "chat1", "user1", "/pr my change")
+	if msg := strings.Join(sender.messages, "\n"); !strings.Contains(msg, "1 个无法识别") || strings.Contains(msg, "已阻止创建 PR") {
+		t.Fatalf("expected a warning only, got %q", msg)
+	}
+
+	// An inventory that cannot run blocks the PR.
+	t.Setenv("PATH", t.TempDir())
+	r.Route(context.Background(), "chat1", "user1", "/pr my change")
+	if msg := sender.LastMessage(); !strings.HasPrefix(msg, "已阻止创建 PR：许可证盘点未能完成") || !strings.Contains(msg, "go-licenses（未安装，跳过）") {
+		t.Fatalf("expected PR to be blocked, got %q", msg)
+	}
+
+	// Without blocking, /pr goes ahead (and fails here without gh or a repo).
+	r.SetLicensePolicy([]string{"GPL-3.0"}, false)
+	r.Route(context.Background(), "chat1", "user1", "/pr my change")
+	if msg := sender.LastMessage(); strings.HasPrefix(msg, "已阻止创建 PR") {
+		t.Fatalf("expected PR not to be blocked, got %q", msg)
+	}
+}
@@ -0,0 +1,137 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// logLevel is the level of the logger set up by SetupLogging; /loglevel
+// changes it at runtime.
+var logLevel = new(slog.LevelVar)
+
+// logLevels are the levels log_level and /loglevel accept.
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// parseLogLevel parses a log_level value; "" is info.
+func parseLogLevel(s string) (slog.Level, error) {
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	level, ok := logLevels[strings.ToLower(s)]
+	if !ok {
+		return 0, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", s)
+	}
+	return level, nil
+}
+
+// SetupLogging makes the default logger, including the standard log
+// package, write to w at level, as JSON lines when format is "json" and
+// as key=value text otherwise. Records logged with a context carry its
+// chat, user, command and execution fields (see withLogFields).
+func SetupLogging(w io.Writer, level, format string) error {
+	l, err := parseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	logLevel.Set(l)
+	opts := &slog.HandlerOptions{Level: logLevel}
+	var h slog.Handler
+	if format == "json" {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+	slog.SetDefault(slog.New(contextHandler{h}))
+	return nil
+}
+
+type logFieldsKey struct{}
+
+// withLogFields adds fields (key, value pairs such as "chat_id", chatID)
+// to the records logged with ctx and the contexts derived from it. Keys
+// must be strings.
+func withLogFields(ctx context.Context, args ...any) context.Context {
+	prev, _ := ctx.Value(logFieldsKey{}).([]any)
+	fields := make([]any, 0, len(prev)+len(args))
+	fields = append(append(fields, prev...), args...)
+	return context.WithValue(ctx, logFieldsKey{}, fields)
+}
+
+// copyLogFields carries the log fields of from over to ctx, for work that
+// outlives the request, such as queued executions run on the router's
+// context.
+func copyLogFields(ctx, from context.Context) context.Context {
+	fields, _ := from.Value(logFieldsKey{}).([]any)
+	if len(fields) == 0 {
+		return ctx
+	}
+	return withLogFields(ctx, fields...)
+}
+
+// contextHandler adds the fields set by withLogFields to each record,
+// except those the record sets itself; the latest value of a field wins.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if ctx == nil {
+		return h.Handler.Handle(ctx, rec)
+	}
+	fields, _ := ctx.Value(logFieldsKey{}).([]any)
+	if len(fields) == 0 {
+		return h.Handler.Handle(ctx, rec)
+	}
+	seen := make(map[string]bool)
+	rec.Attrs(func(a slog.Attr) bool {
+		seen[a.Key] = true
+		return true
+	})
+	var attrs []slog.Attr
+	for i := len(fields) - 2; i >= 0; i -= 2 {
+		key, _ := fields[i].(string)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		attrs = append(attrs, slog.Any(key, fields[i+1]))
+	}
+	for i := len(attrs) - 1; i >= 0; i-- {
+		rec.AddAttrs(attrs[i])
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// cmdLogLevel shows or changes the log level until the next restart.
+func (r *Router) cmdLogLevel(ctx context.Context, chatID, args string) {
+	current := strings.ToLower(logLevel.Level().String())
+	args = strings.TrimSpace(args)
+	if args == "" {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("当前日志级别: %s\n用法: /loglevel debug|info|warn|error（重启后恢复为配置的 log_level）", current))
+		return
+	}
+	level, err := parseLogLevel(args)
+	if err != nil {
+		r.sender.SendText(ctx, chatID, "用法: /loglevel debug|info|warn|error")
+		return
+	}
+	logLevel.Set(level)
+	slog.WarnContext(ctx, "log level changed", "from", current, "to", strings.ToLower(level.String()))
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 日志级别: %s → %s（重启后恢复为配置的 log_level）", current, strings.ToLower(level.String())))
+}
@@ -0,0 +1,137 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// captureLogs sends the default logger to a buffer as JSON lines at level
+// until the test ends.
+func captureLogs(t *testing.T, level string) *bytes.Buffer {
+	t.Helper()
+	prev, prevLevel := slog.Default(), logLevel.Level()
+	t.Cleanup(func() {
+		slog.SetDefault(prev)
+		logLevel.Set(prevLevel)
+	})
+	var buf bytes.Buffer
+	if err := SetupLogging(&buf, level, "json"); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var m map[string]any
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("invalid JSON log line %q: %v", line, err)
+		}
+		lines = append(lines, m)
+	}
+	return lines
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for in, want := range map[string]slog.Level{"": slog.LevelInfo, "debug": slog.LevelDebug, "WARN": slog.LevelWarn, "error": slog.LevelError} {
+		if got, err := parseLogLevel(in); err != nil || got != want {
+			t.Errorf("parseLogLevel(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := parseLogLevel("verbose"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+	if err := SetupLogging(&bytes.Buffer{}, "verbose", "text"); err == nil {
+		t.Error("SetupLogging accepted an unknown level")
+	}
+}
+
+func TestLogFields(t *testing.T) {
+	buf := captureLogs(t, "info")
+
+	ctx := withLogFields(context.Background(), "chat_id", "chat1", "user_id", "u1")
+	ctx = withLogFields(ctx, "command", "/status", "chat_id", "chat2")
+	slog.InfoContext(ctx, "hello", "user_id", "explicit")
+	slog.DebugContext(ctx, "hidden")
+	queued := copyLogFields(context.Background(), ctx)
+	slog.WarnContext(queued, "queued")
+
+	lines := logLines(t, buf)
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %s", len(lines), buf)
+	}
+	first := lines[0]
+	if first["msg"] != "hello" || first["level"] != "INFO" || first["chat_id"] != "chat2" || first["user_id"] != "explicit" || first["command"] != "/status" {
+		t.Errorf("unexpected record %v", first)
+	}
+	if strings.Count(buf.String(), `"chat_id"`) != 2 {
+		t.Errorf("duplicated fields: %s", buf)
+	}
+	if lines[1]["msg"] != "queued" || lines[1]["chat_id"] != "chat2" || lines[1]["command"] != "/status" {
+		t.Errorf("fields not copied: %v", lines[1])
+	}
+}
+
+func TestRouteLogFields(t *testing.T) {
+	buf := captureLogs(t, "info")
+	r, _ := newRolesRouter(t)
+
+	r.Route(context.Background(), "chat1", "op", "/pwd")
+	var found bool
+	for _, line := range logLines(t, buf) {
+		if line["msg"] == "router: command" {
+			found = true
+			if line["chat_id"] != "chat1" || line["user_id"] != "op" || line["command"] != "/pwd" {
+				t.Errorf("unexpected record %v", line)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("command not logged: %s", buf)
+	}
+}
+
+func TestCmdLogLevel(t *testing.T) {
+	buf := captureLogs(t, "info")
+	r, sender := newRolesRouter(t)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "op", "/loglevel debug")
+	if msg := sender.LastMessage(); msg != "/loglevel 仅限管理员使用（admin_user_ids）。" {
+		t.Fatalf("operator changed the log level: %q", msg)
+	}
+	if logLevel.Level() != slog.LevelInfo {
+		t.Fatalf("level changed to %v", logLevel.Level())
+	}
+
+	r.SetAdmins(map[string]bool{"admin": true})
+	r.Route(ctx, "chat1", "admin", "/loglevel")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "当前日志级别: info") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	r.Route(ctx, "chat1", "admin", "/loglevel verbose")
+	if msg := sender.LastMessage(); !strings.HasPrefix(msg, "用法") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	r.Route(ctx, "chat1", "admin", "/loglevel debug")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "info → debug") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	if logLevel.Level() != slog.LevelDebug {
+		t.Fatalf("level not changed: %v", logLevel.Level())
+	}
+	buf.Reset()
+	slog.Debug("now visible")
+	if !strings.Contains(buf.String(), "now visible") {
+		t.Fatalf("debug record dropped: %s", buf)
+	}
+}
@@ -0,0 +1,133 @@
+package bot
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// defaultMaxPromptChars is the prompt size trimming starts at when
+	// max_prompt_chars is not configured.
+	defaultMaxPromptChars = 30000
+	// maxTrimmedLineChars caps single lines (minified files, base64 blobs)
+	// of a trimmed prompt.
+	maxTrimmedLineChars = 500
+	// errorContextLines is how many lines around an error line are kept.
+	errorContextLines = 2
+)
+
+// errorLineRe matches log lines worth keeping when a prompt is trimmed.
+var errorLineRe = regexp.MustCompile(`(?i)\b(error|err|fail(ed|ure)?|fatal|panic|exception|traceback|caused by|undefined|denied|timeout|timed out)\b|错误|失败|异常`)
+
+// SetMaxPromptChars sets the size, in characters, above which a prompt
+// typed in the chat is trimmed before it is sent to Claude (<= 0 turns
+// trimming off).
+func (r *Router) SetMaxPromptChars(n int) {
+	r.maxPromptChars = n
+}
+
+// trimmedPrompt describes what trimPrompt left out.
+type trimmedPrompt struct {
+	text          string
+	omittedLines  int
+	omittedChars  int
+	errorLines    int
+	originalChars int
+}
+
+// trimPrompt shrinks text, typically a question with a huge pasted log,
+// to about max characters. It keeps the opening lines (where the question
+// usually is), the lines that look like errors with a little context, and
+// as much of the tail as fits, marking every gap. ok is false when text
+// already fits or max <= 0 (no limit).
+func trimPrompt(text string, max int) (trimmedPrompt, bool) {
+	total := utf8.RuneCountInString(text)
+	if max <= 0 || total <= max {
+		return trimmedPrompt{}, false
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = truncateRunes(line, maxTrimmedLineChars)
+	}
+	size := func(i int) int { return utf8.RuneCountInString(lines[i]) + 1 }
+
+	keep := make([]bool, len(lines))
+	headBudget, errBudget := max/10, max*4/10
+	head := 0
+	for used := 0; head < len(lines) && used+size(head) <= headBudget; head++ {
+		used += size(head)
+		keep[head] = true
+	}
+	// The question may be longer than the head budget; never cut the first line.
+	if head == 0 && len(lines) > 0 {
+		keep[0] = true
+		head = 1
+	}
+
+	// Errors near the end are usually the relevant ones, so collect them
+	// from the bottom up.
+	tailBudget := max - headBudget - errBudget
+	tail := len(lines)
+	for used := 0; tail > head && used+size(tail-1) <= tailBudget; tail-- {
+		used += size(tail - 1)
+		keep[tail-1] = true
+	}
+	errLines, used := 0, 0
+	for i := tail - 1; i >= head; i-- {
+		if !errorLineRe.MatchString(lines[i]) {
+			continue
+		}
+		var add []int
+		for j := i - errorContextLines; j <= i+errorContextLines; j++ {
+			if j >= head && j < tail && !keep[j] {
+				add = append(add, j)
+			}
+		}
+		cost := 0
+		for _, j := range add {
+			cost += size(j)
+		}
+		if used+cost > errBudget {
+			break
+		}
+		used += cost
+		for _, j := range add {
+			keep[j] = true
+		}
+		errLines++
+	}
+
+	var sb strings.Builder
+	res := trimmedPrompt{errorLines: errLines, originalChars: total}
+	gap := 0
+	flush := func() {
+		if gap > 0 {
+			fmt.Fprintf(&sb, "[... %d lines omitted ...]\n", gap)
+			res.omittedLines += gap
+			gap = 0
+		}
+	}
+	for i, line := range lines {
+		if !keep[i] {
+			gap++
+			continue
+		}
+		flush()
+		sb.WriteString(line + "\n")
+	}
+	flush()
+	res.text = strings.TrimSuffix(sb.String(), "\n")
+	res.omittedChars = total - utf8.RuneCountInString(res.text)
+	if res.omittedChars < 0 {
+		res.omittedChars = 0
+	}
+	res.text = fmt.Sprintf("[Note: this message was %d characters long and was trimmed automatically. Kept: the beginning, lines that look like errors with %d lines of context, and the end. Ask for the omitted parts if you need them.]\n\n%s", total, errorContextLines, res.text)
+	return res, true
+}
+
+// trimPromptNote tells the chat how a prompt was trimmed.
+func trimPromptNote(t trimmedPrompt, max int) string {
+	return fmt.Sprintf("✂️ 消息过长（%d 字，上限 %d），已保留开头、%d 处错误相关行和末尾后发送给 Claude，省略 %d 行（约 %d 字）。", t.originalChars, max, t.errorLines, t.omittedLines, t.omittedChars)
+}
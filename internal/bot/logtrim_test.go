@@ -0,0 +1,90 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// pastedLog is a question followed by a long build log with one error in
+// the middle.
+func pastedLog(lines int) string {
+	var sb strings.Builder
+	sb.WriteString("why does the build fail?\n")
+	for i := 0; i < lines; i++ {
+		if i == lines/2 {
+			sb.WriteString("main.go:12: undefined: fooBar\n")
+			continue
+		}
+		fmt.Fprintf(&sb, "step %05d compiling package number %d ok\n", i, i)
+	}
+	sb.WriteString("exit status 2")
+	return sb.String()
+}
+
+func TestTrimPrompt_Short(t *testing.T) {
+	if _, ok := trimPrompt("hello", 1000); ok {
+		t.Fatal("expected a short prompt to be left alone")
+	}
+}
+
+func TestTrimPrompt_KeepsQuestionErrorsAndTail(t *testing.T) {
+	text := pastedLog(5000)
+	got, ok := trimPrompt(text, 5000)
+	if !ok {
+		t.Fatal("expected the prompt to be trimmed")
+	}
+	if n := utf8.RuneCountInString(got.text); n > 5500 {
+		t.Fatalf("trimmed prompt too long: %d chars", n)
+	}
+	for _, want := range []string{"why does the build fail?", "main.go:12: undefined: fooBar", "step 02499", "exit status 2", "lines omitted ...]", "trimmed automatically"} {
+		if !strings.Contains(got.text, want) {
+			t.Errorf("trimmed prompt missing %q", want)
+		}
+	}
+	if strings.Contains(got.text, "step 01000 ") {
+		t.Error("expected the middle of the log to be omitted")
+	}
+	if got.errorLines != 1 || got.omittedLines == 0 || got.originalChars != utf8.RuneCountInString(text) {
+		t.Fatalf("unexpected trim stats %+v", got)
+	}
+}
+
+func TestTrimPrompt_LongLines(t *testing.T) {
+	text := "explain this\n" + strings.Repeat("x", 20000) + "\nend"
+	got, ok := trimPrompt(text, 2000)
+	if !ok || utf8.RuneCountInString(got.text) > 2000 || !strings.Contains(got.text, "explain this") || !strings.Contains(got.text, "end") {
+		t.Fatalf("unexpected trim of a long line: %q", got.text)
+	}
+}
+
+func TestHandlePrompt_TrimsPastedLog(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.SetMaxPromptChars(5000)
+	r.Route(context.Background(), "chat1", "user1", pastedLog(5000))
+
+	msgs := strings.Join(sender.messages, "\n")
+	if !strings.Contains(msgs, "✂️ 消息过长") {
+		t.Fatalf("expected a trim note, got %q", msgs)
+	}
+	last := r.getSession("chat1").LastPrompt
+	if !strings.Contains(last, "lines omitted") || utf8.RuneCountInString(last) > 5500 {
+		t.Fatalf("expected the trimmed prompt to be recorded, got %d chars", utf8.RuneCountInString(last))
+	}
+}
+
+func TestHandlePrompt_TrimmingOff(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.SetMaxPromptChars(0)
+	text := pastedLog(5000)
+	r.Route(context.Background(), "chat1", "user1", text)
+
+	if msgs := strings.Join(sender.messages, "\n"); strings.Contains(msgs, "✂️ 消息过长") {
+		t.Fatalf("expected no trimming, got %q", msgs)
+	}
+	if r.getSession("chat1").LastPrompt != text {
+		t.Fatal("expected the prompt to be sent as typed")
+	}
+}
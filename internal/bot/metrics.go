@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// execKindNames are how /status names the kinds of execution.
+var execKindNames = map[string]string{
+	"prompt":  "对话",
+	"repro":   "/repro",
+	"foreach": "/foreach",
+	"json":    "/json",
+	"review":  "/review-local",
+	"report":  "/report week",
+	"issue":   "/issue create",
+}
+
+// ExecStats aggregates the executions of one scope since startup.
+type ExecStats struct {
+	Count     int
+	Failures  int
+	Total     time.Duration
+	Last      time.Duration
+	LastAt    time.Time
+	LastError string
+	ErrorAt   time.Time
+}
+
+// metricsScope selects executions by chat and kind; "" matches all.
+type metricsScope struct {
+	chatID string
+	kind   string
+}
+
+// ExecMetrics counts executions per chat and per kind, so one chat's
+// /status is not skewed by the runs of another. It is safe for concurrent
+// use.
+type ExecMetrics struct {
+	mu     sync.Mutex
+	scopes map[metricsScope]*ExecStats
+}
+
+func NewExecMetrics() *ExecMetrics {
+	return &ExecMetrics{scopes: make(map[metricsScope]*ExecStats)}
+}
+
+// Record adds one finished execution; errText is "" when it succeeded.
+func (m *ExecMetrics) Record(chatID, kind string, at time.Time, d time.Duration, errText string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, scope := range []metricsScope{{}, {chatID: chatID}, {kind: kind}, {chatID, kind}} {
+		s := m.scopes[scope]
+		if s == nil {
+			s = &ExecStats{}
+			m.scopes[scope] = s
+		}
+		s.Count++
+		s.Total += d
+		s.Last = d
+		s.LastAt = at
+		if errText != "" {
+			s.Failures++
+			s.LastError = errText
+			s.ErrorAt = at
+		}
+	}
+}
+
+// Stats returns the executions of chatID ("" = all chats) of kind ("" =
+// all kinds).
+func (m *ExecMetrics) Stats(chatID, kind string) ExecStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s := m.scopes[metricsScope{chatID, kind}]; s != nil {
+		return *s
+	}
+	return ExecStats{}
+}
+
+// Kinds returns the kinds of execution chatID ("" = any chat) has run,
+// sorted.
+func (m *ExecMetrics) Kinds(chatID string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var kinds []string
+	for scope := range m.scopes {
+		if scope.chatID == chatID && scope.kind != "" {
+			kinds = append(kinds, scope.kind)
+		}
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// transcriptKinds are the execution kinds that are turns of the chat's
+// Claude session, kept in its transcript for /export.
+var transcriptKinds = map[string]bool{"prompt": true, "json": true}
+
+// addExecRecord saves a finished execution to the history and counts it in
+// the metrics under kind. Executions during an /incident are tagged with
+// it, and conversation turns are added to their session's transcript.
+func (r *Router) addExecRecord(kind string, rec ExecRecord) {
+	if inc, ok := r.store.OpenIncident(rec.ChatID); ok {
+		rec.Incident = inc.ID
+	}
+	rec.Output = r.redactFor(rec.ChatID, rec.Output)
+	rec.Error = r.redactFor(rec.ChatID, rec.Error)
+	r.store.AddExecRecord(rec)
+	r.metrics.Record(rec.ChatID, kind, rec.StartedAt.Add(rec.Duration), rec.Duration, rec.Error)
+	if transcriptKinds[kind] && rec.SessionID != "" {
+		turn := Turn{ExecID: rec.ID, At: rec.StartedAt, Prompt: rec.Prompt, Output: rec.Output, Error: rec.Error, Duration: rec.Duration, WorkDir: rec.WorkDir, Model: rec.Model}
+		if err := r.store.AppendTurn(rec.SessionID, turn); err != nil {
+			slog.Warn("router: append transcript turn failed", "session_id", rec.SessionID, "exec_id", rec.ID, "err", err)
+		}
+	}
+}
+
+// formatExecKinds renders the per-kind counts of chatID for /status, e.g.
+// "对话 3 · /review-local 1（失败 1）".
+func (r *Router) formatExecKinds(chatID string) string {
+	var parts []string
+	for _, kind := range r.metrics.Kinds(chatID) {
+		s := r.metrics.Stats(chatID, kind)
+		name := execKindNames[kind]
+		if name == "" {
+			name = kind
+		}
+		part := fmt.Sprintf("%s %d", name, s.Count)
+		if s.Failures > 0 {
+			part += fmt.Sprintf("（失败 %d）", s.Failures)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " · ")
+}
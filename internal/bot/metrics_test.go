@@ -0,0 +1,79 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExecMetrics(t *testing.T) {
+	m := NewExecMetrics()
+	now := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			chat := "chat1"
+			if i%2 == 1 {
+				chat = "chat2"
+			}
+			m.Record(chat, "prompt", now, time.Second, "")
+		}(i)
+	}
+	wg.Wait()
+	m.Record("chat2", "review", now, 3*time.Second, "boom")
+
+	if s := m.Stats("chat1", ""); s.Count != 10 || s.Failures != 0 || s.Total != 10*time.Second {
+		t.Fatalf("unexpected chat1 stats %+v", s)
+	}
+	if s := m.Stats("chat2", ""); s.Count != 11 || s.Failures != 1 || s.LastError != "boom" || s.Last != 3*time.Second {
+		t.Fatalf("unexpected chat2 stats %+v", s)
+	}
+	if s := m.Stats("", ""); s.Count != 21 || s.Failures != 1 {
+		t.Fatalf("unexpected global stats %+v", s)
+	}
+	if s := m.Stats("", "review"); s.Count != 1 {
+		t.Fatalf("unexpected review stats %+v", s)
+	}
+	if got := strings.Join(m.Kinds("chat2"), ","); got != "prompt,review" {
+		t.Fatalf("unexpected kinds %q", got)
+	}
+	if got := strings.Join(m.Kinds("chat1"), ","); got != "prompt" {
+		t.Fatalf("unexpected kinds %q", got)
+	}
+}
+
+func TestRouterStatus_PerChat(t *testing.T) {
+	claude := filepath.Join(t.TempDir(), "claude")
+	os.WriteFile(claude, []byte(`#!/bin/sh
+case "$(cat)" in
+*fail*) echo 'it broke' >&2; exit 1 ;;
+esac
+echo '{"type":"result","result":"ok","session_id":"s1"}'
+`), 0755)
+	r, sender := newAckRouter(t, claude)
+	ctx := context.Background()
+	r.Route(ctx, "chat1", "user1", "hello")
+	r.Route(ctx, "chat2", "user1", "hello")
+	r.Route(ctx, "chat2", "user1", "please fail")
+
+	r.Route(ctx, "chat1", "user1", "/status")
+	msg := sender.LastMessage()
+	if !strings.Contains(msg, "执行次数:** 1（全局 3）") || strings.Contains(msg, "上次错误") || !strings.Contains(msg, "对话 1") {
+		t.Fatalf("expected chat1's own numbers, got %q", msg)
+	}
+	r.Route(ctx, "chat2", "user1", "/status")
+	msg = sender.LastMessage()
+	if !strings.Contains(msg, "执行次数:** 2（全局 3）") || !strings.Contains(msg, "上次错误:**") || !strings.Contains(msg, "对话 2（失败 1）") {
+		t.Fatalf("expected chat2's numbers with its error, got %q", msg)
+	}
+	r.Route(ctx, "chat3", "user1", "/status")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "执行次数:** 0（全局 3）") || !strings.Contains(msg, "上次耗时:** -（全局") {
+		t.Fatalf("expected no local executions, got %q", msg)
+	}
+}
@@ -0,0 +1,184 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxSessionNameRunes bounds a /save name.
+const maxSessionNameRunes = 40
+
+// checkSessionName rejects names /load could not tell apart from other
+// arguments: empty ones, ones with spaces, bare numbers (the /switch
+// indexes) and "rm".
+func checkSessionName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("名称不能为空")
+	case strings.ContainsAny(name, " \t\n`"):
+		return fmt.Errorf("名称不能包含空格或反引号: %s", name)
+	case utf8.RuneCountInString(name) > maxSessionNameRunes:
+		return fmt.Errorf("名称太长（最多 %d 字）: %s", maxSessionNameRunes, name)
+	case name == "rm":
+		return fmt.Errorf("rm 是保留字，请换一个名称")
+	}
+	if _, err := strconv.Atoi(name); err == nil {
+		return fmt.Errorf("名称不能是纯数字（与 /switch 的序号冲突）: %s", name)
+	}
+	return nil
+}
+
+// cmdSave names the current Claude session, remembering its workdir and
+// model, lists the named sessions, or forgets a name.
+func (r *Router) cmdSave(ctx context.Context, chatID, args string) {
+	session := r.getSession(chatID)
+	fields := strings.Fields(args)
+	switch {
+	case len(fields) == 0:
+		r.listNamedSessions(ctx, chatID, session)
+		return
+	case fields[0] == "rm":
+		if len(fields) != 2 {
+			r.sender.SendText(ctx, chatID, "用法: /save rm <名称>")
+			return
+		}
+		if _, ok := session.NamedSessions[fields[1]]; !ok {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("没有名为 %s 的会话。", fields[1]))
+			return
+		}
+		r.store.UpdateSession(chatID, func(s *Session) {
+			delete(s.NamedSessions, fields[1])
+		})
+		r.save()
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已删除名称 %s（会话本身仍在 /sessions 中）", fields[1]))
+		return
+	case len(fields) > 1:
+		r.sender.SendText(ctx, chatID, "用法: /save <名称>（名称不能包含空格）")
+		return
+	}
+	name := fields[0]
+	if err := checkSessionName(name); err != nil {
+		r.sender.SendText(ctx, chatID, err.Error())
+		return
+	}
+	if session.ClaudeSessionID == "" {
+		r.sender.SendText(ctx, chatID, "当前没有 Claude 会话可以保存，先发送一条消息开始会话。")
+		return
+	}
+	prev, existed := session.NamedSessions[name]
+	r.store.UpdateSession(chatID, func(s *Session) {
+		if s.NamedSessions == nil {
+			s.NamedSessions = make(map[string]NamedSession)
+		}
+		s.NamedSessions[name] = NamedSession{
+			SessionID: s.ClaudeSessionID,
+			WorkDir:   s.WorkDir,
+			Model:     s.Model,
+			SavedAt:   time.Now(),
+		}
+	})
+	r.save()
+	msg := fmt.Sprintf("✓ 已将当前会话保存为 %s（%s）\n工作目录: %s\n之后可用 /load %s 恢复。", name, session.ClaudeSessionID, orDash(session.WorkDir), name)
+	if existed && prev.SessionID != session.ClaudeSessionID {
+		msg += fmt.Sprintf("\n（原来名为 %s 的会话 %s 不再有这个名称）", name, prev.SessionID)
+	}
+	r.sender.SendText(ctx, chatID, msg)
+}
+
+func (r *Router) listNamedSessions(ctx context.Context, chatID string, session Session) {
+	if len(session.NamedSessions) == 0 {
+		r.sender.SendText(ctx, chatID, "还没有命名的会话。\n用法: /save <名称> 给当前会话命名，/load <名称> 恢复，/rename <旧名称> <新名称> 重命名，/save rm <名称> 删除名称。")
+		return
+	}
+	var sb strings.Builder
+	for _, name := range sortedKeys(session.NamedSessions) {
+		ns := session.NamedSessions[name]
+		current := ""
+		if ns.SessionID == session.ClaudeSessionID {
+			current = "（当前）"
+		}
+		fmt.Fprintf(&sb, "- **%s**%s `%s`\n  %s · %s · 保存于 %s\n", name, current, ns.SessionID, orDash(ns.WorkDir), orDash(ns.Model), ns.SavedAt.Format("01-02 15:04"))
+	}
+	sb.WriteString("\n`/load <名称>` 恢复，`/rename <旧名称> <新名称>` 重命名，`/save rm <名称>` 删除名称。")
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("命名的会话（%d）", len(session.NamedSessions)), Content: sb.String()})
+}
+
+// cmdLoad makes a named session current again, in its workdir and with its
+// model. The session it replaces stays in the history, as with /switch.
+func (r *Router) cmdLoad(ctx context.Context, chatID, args string) {
+	name := strings.TrimSpace(args)
+	session := r.getSession(chatID)
+	if name == "" {
+		r.listNamedSessions(ctx, chatID, session)
+		return
+	}
+	ns, ok := session.NamedSessions[name]
+	if !ok {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("没有名为 %s 的会话，用 /save 查看已命名的会话。", name))
+		return
+	}
+	workDir := ns.WorkDir
+	var warning string
+	if workDir != "" {
+		if info, err := os.Stat(workDir); err != nil || !info.IsDir() || !underRoot(r.store.WorkRoot(), workDir) {
+			warning = fmt.Sprintf("\n⚠️ 原工作目录 %s 已不存在或不在工作根目录下，保持当前目录。", workDir)
+			workDir = ""
+		}
+	}
+	r.store.UpdateSession(chatID, func(s *Session) {
+		if workDir != "" && workDir != s.WorkDir {
+			// Keep the current directory's session, as /cd does.
+			if s.DirSessions == nil {
+				s.DirSessions = make(map[string]string)
+			}
+			if s.ClaudeSessionID != "" && s.WorkDir != "" {
+				s.DirSessions[s.WorkDir] = s.ClaudeSessionID
+			}
+			s.WorkDir = workDir
+		}
+		makeCurrent(s, ns.SessionID)
+		if s.DirSessions != nil && s.WorkDir != "" {
+			s.DirSessions[s.WorkDir] = ns.SessionID
+		}
+		if ns.Model != "" {
+			s.Model = ns.Model
+		}
+	})
+	r.save()
+	s := r.getSession(chatID)
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已恢复会话 %s（%s）\n工作目录: %s\n模型: %s%s", name, ns.SessionID, orDash(s.WorkDir), orDash(s.Model), warning))
+}
+
+// cmdRename renames a named session.
+func (r *Router) cmdRename(ctx context.Context, chatID, args string) {
+	fields := strings.Fields(args)
+	if len(fields) != 2 {
+		r.sender.SendText(ctx, chatID, "用法: /rename <旧名称> <新名称>")
+		return
+	}
+	from, to := fields[0], fields[1]
+	session := r.getSession(chatID)
+	if _, ok := session.NamedSessions[from]; !ok {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("没有名为 %s 的会话。", from))
+		return
+	}
+	if err := checkSessionName(to); err != nil {
+		r.sender.SendText(ctx, chatID, err.Error())
+		return
+	}
+	if _, taken := session.NamedSessions[to]; taken {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("名称 %s 已被使用，请先 /save rm %s。", to, to))
+		return
+	}
+	r.store.UpdateSession(chatID, func(s *Session) {
+		s.NamedSessions[to] = s.NamedSessions[from]
+		delete(s.NamedSessions, from)
+	})
+	r.save()
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已将会话 %s 重命名为 %s", from, to))
+}
@@ -0,0 +1,90 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNamedSessions(t *testing.T) {
+	r, sender := newTestRouter(t)
+	ctx := context.Background()
+	root := r.store.WorkRoot()
+	project1 := filepath.Join(root, "project1")
+
+	r.Route(ctx, "chat1", "user1", "/save fix-login-bug")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "没有 Claude 会话") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/cd project1")
+	r.getSession("chat1")
+	r.store.UpdateSession("chat1", func(s *Session) {
+		s.ClaudeSessionID = "sess-login"
+		s.Model = "opus"
+	})
+	r.Route(ctx, "chat1", "user1", "/save fix-login-bug")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "已将当前会话保存为 fix-login-bug（sess-login）") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	for _, bad := range []string{"/save 3", "/save rm", "/save a b"} {
+		r.Route(ctx, "chat1", "user1", bad)
+		if msg := sender.LastMessage(); strings.HasPrefix(msg, "✓") {
+			t.Errorf("%s accepted: %q", bad, msg)
+		}
+	}
+
+	// Move on to another directory, session and model.
+	r.Route(ctx, "chat1", "user1", "/cd project2")
+	r.store.UpdateSession("chat1", func(s *Session) {
+		s.ClaudeSessionID = "sess-other"
+		s.Model = "sonnet"
+	})
+	r.Route(ctx, "chat1", "user1", "/sessions")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "**fix-login-bug** `project1` `sess-login`  → `/load fix-login-bug`") {
+		t.Fatalf("expected the name in /sessions, got %q", msg)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/load fix-login-bug")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "已恢复会话 fix-login-bug") || !strings.Contains(msg, "模型: opus") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	s := r.getSession("chat1")
+	if s.ClaudeSessionID != "sess-login" || s.WorkDir != project1 || s.Model != "opus" {
+		t.Fatalf("session not restored: %+v", s)
+	}
+	if s.DirSessions[filepath.Join(root, "project2")] != "sess-other" || s.History[len(s.History)-1] != "sess-other" {
+		t.Fatalf("previous session lost: %+v", s)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/rename fix-login-bug login")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "重命名为 login") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "/load fix-login-bug")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "没有名为 fix-login-bug") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "/save")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "**login**（当前） `sess-login`") || !strings.Contains(msg, "opus") {
+		t.Fatalf("unexpected list %q", msg)
+	}
+
+	// A workdir that is gone keeps the current one.
+	os.RemoveAll(project1)
+	r.Route(ctx, "chat1", "user1", "/cd project2")
+	r.Route(ctx, "chat1", "user1", "/load login")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "已不存在") || r.getSession("chat1").WorkDir != filepath.Join(root, "project2") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/save rm login")
+	if len(r.getSession("chat1").NamedSessions) != 0 {
+		t.Fatal("name not removed")
+	}
+	if len(r.getSession("chat2").NamedSessions) != 0 {
+		t.Fatal("names are per chat")
+	}
+}
@@ -0,0 +1,155 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultOutputLimit is how many characters of command output a card
+	// shows unless the chat sets its own limit.
+	defaultOutputLimit = 4000
+	// minOutputLimit and maxOutputLimit bound /output limit; the maximum
+	// keeps cards under the card size limit.
+	minOutputLimit = 500
+	maxOutputLimit = 25000
+	// maxFullOutputs is how many truncated outputs are kept for /output.
+	maxFullOutputs = 50
+)
+
+// fullOutput is the complete text of an output shown truncated.
+type fullOutput struct {
+	id      string
+	chatID  string
+	name    string
+	text    string
+	created time.Time
+}
+
+// outputLimit returns the number of characters of output the chat's cards
+// show.
+func (r *Router) outputLimit(chatID string) int {
+	if n := r.getSession(chatID).OutputLimit; n > 0 {
+		return n
+	}
+	return defaultOutputLimit
+}
+
+// fitOutput trims text to the chat's output limit, keeping its end when
+// tail is set (logs, test output) and its start otherwise. When it has to
+// cut, the full text is kept for /output and returned so the caller can
+// attach it with sendFullOutput after its card; what starts the notice,
+// e.g. "输出过长".
+func (r *Router) fitOutput(chatID, name, text string, tail bool, what string) (string, *fullOutput) {
+	limit := r.outputLimit(chatID)
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text, nil
+	}
+	full := &fullOutput{id: newExecID(), chatID: chatID, name: name, text: text, created: time.Now()}
+	r.mu.Lock()
+	r.fullOutputs = append(r.fullOutputs, full)
+	if n := len(r.fullOutputs); n > maxFullOutputs {
+		r.fullOutputs = append([]*fullOutput(nil), r.fullOutputs[n-maxFullOutputs:]...)
+	}
+	r.mu.Unlock()
+
+	where := fmt.Sprintf("完整内容: `/output %s`", full.id)
+	if _, ok := r.sender.(FileSender); ok {
+		where = fmt.Sprintf("完整内容见附件 %s，或 `/output %s`", full.fileName(), full.id)
+	}
+	if tail {
+		return fmt.Sprintf("（%s，仅显示末尾部分（%d 字符）；%s）\n\n", what, limit, where) + string(runes[len(runes)-limit:]), full
+	}
+	return fmt.Sprintf("（%s，仅显示开头部分（%d 字符）；%s）\n\n", what, limit, where) + string(runes[:limit]), full
+}
+
+func (f *fullOutput) fileName() string {
+	return fmt.Sprintf("%s-%s.txt", f.name, f.id)
+}
+
+// sendFullOutput attaches an output cut by fitOutput as a .txt file when
+// the sender supports files (see deliverFile); otherwise it stays available
+// via /output. A failed upload is reported rather than dropped.
+func (r *Router) sendFullOutput(ctx context.Context, chatID string, full *fullOutput) {
+	if full == nil {
+		return
+	}
+	if _, ok := r.sender.(FileSender); !ok {
+		return
+	}
+	if err := r.deliverFile(ctx, chatID, full.fileName(), []byte(full.text)); err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("完整输出 %s 发送失败: %v\n可稍后用 `/output %s` 重试。", full.fileName(), err, full.id))
+	}
+}
+
+// cmdOutput answers /output: with an ID it sends that full output, or the
+// output of that execution, as a file, "limit" sets the chat's output limit, and without arguments it
+// shows the limit and the outputs kept.
+func (r *Router) cmdOutput(ctx context.Context, chatID, args string) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		r.mu.Lock()
+		var kept []*fullOutput
+		for _, f := range r.fullOutputs {
+			if f.chatID == chatID {
+				kept = append(kept, f)
+			}
+		}
+		r.mu.Unlock()
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "**输出上限:** %d 字符（默认 %d）\n", r.outputLimit(chatID), defaultOutputLimit)
+		if len(kept) > 0 {
+			sb.WriteString("\n**被截断的输出:**\n")
+			for i := len(kept) - 1; i >= 0 && i >= len(kept)-10; i-- {
+				f := kept[i]
+				fmt.Fprintf(&sb, "- `%s` %s · %s · %s\n", f.id, f.created.Format("01-02 15:04"), f.name, formatSize(int64(len(f.text))))
+			}
+		}
+		sb.WriteString("\n`/output limit <字符数>|default` 修改上限，`/output <ID>` 获取完整输出，`/output <执行ID>` 获取某次执行的输出")
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "输出设置", Content: sb.String()})
+		return
+	}
+	if fields[0] == "limit" {
+		if len(fields) != 2 {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("用法: /output limit <字符数>|default\n卡片中显示的命令输出上限，范围 %d-%d，默认 %d。", minOutputLimit, maxOutputLimit, defaultOutputLimit))
+			return
+		}
+		n := 0
+		if fields[1] != "default" {
+			var err error
+			n, err = strconv.Atoi(fields[1])
+			if err != nil || n < minOutputLimit || n > maxOutputLimit {
+				r.sender.SendText(ctx, chatID, fmt.Sprintf("输出上限应为 %d-%d 之间的数字，或 default。", minOutputLimit, maxOutputLimit))
+				return
+			}
+		}
+		r.getSession(chatID) // ensure session exists
+		r.store.UpdateSession(chatID, func(s *Session) {
+			s.OutputLimit = n
+		})
+		r.save()
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 输出上限已设为 %d 字符，超出部分会以文件附上。", r.outputLimit(chatID)))
+		return
+	}
+
+	r.mu.Lock()
+	var full *fullOutput
+	for _, f := range r.fullOutputs {
+		if f.id == fields[0] && f.chatID == chatID {
+			full = f
+		}
+	}
+	r.mu.Unlock()
+	if full == nil {
+		if r.execOutput(ctx, chatID, fields[0]) {
+			return
+		}
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("找不到输出: %s（仅保留最近 %d 条被截断的输出，重启后清空）", fields[0], maxFullOutputs))
+		return
+	}
+	r.sendFile(ctx, chatID, full.fileName(), []byte(full.text))
+}
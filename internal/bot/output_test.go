@@ -0,0 +1,72 @@
+package bot
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFitOutput(t *testing.T) {
+	r, _ := newTestRouter(t)
+	if text, full := r.fitOutput("chat1", "exec", "short", true, "输出过长"); text != "short" || full != nil {
+		t.Fatalf("expected short output unchanged, got %q %v", text, full)
+	}
+	long := strings.Repeat("a", defaultOutputLimit) + "TAIL"
+	text, full := r.fitOutput("chat1", "exec", long, true, "输出过长")
+	if full == nil || full.text != long || !strings.HasSuffix(text, "TAIL") || !strings.Contains(text, "（输出过长，仅显示末尾部分（4000 字符）；完整内容: `/output "+full.id+"`）") {
+		t.Fatalf("unexpected tail truncation %q", text[:120])
+	}
+	text, _ = r.fitOutput("chat1", "grep", "HEAD"+long, false, "结果过多")
+	if !strings.Contains(text, "仅显示开头部分（4000 字符）") || !strings.Contains(text, "\n\nHEAD") || strings.HasSuffix(text, "TAIL") {
+		t.Fatalf("unexpected head truncation %q", text[:120])
+	}
+}
+
+func TestRouterOutputLimit(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	sender := &fileSpySender{}
+	r := NewRouter(context.Background(), NewClaudeExecutor("claude", "sonnet", 10*time.Second), store, sender, map[string]bool{"user1": true}, dir, nil)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "/output limit 100")
+	if !strings.Contains(sender.LastMessage(), "500-25000") {
+		t.Fatalf("expected range error, got %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "user1", "/output limit 500")
+	if r.outputLimit("chat1") != 500 {
+		t.Fatalf("expected limit 500, got %d", r.outputLimit("chat1"))
+	}
+
+	r.Route(ctx, "chat1", "user1", "/exec seq 1 2000")
+	card := sender.messages[len(sender.messages)-1]
+	if !strings.Contains(card, "仅显示末尾部分（500 字符）") || !strings.Contains(card, "1999\n2000") {
+		t.Fatalf("unexpected card %q", card[:200])
+	}
+	id := regexp.MustCompile("/output (\\w+)").FindStringSubmatch(card)[1]
+	data := sender.files["exec-"+id+".txt"]
+	if !strings.HasPrefix(string(data), "1\n2\n3\n") || !strings.HasSuffix(strings.TrimSpace(string(data)), "2000") {
+		t.Fatalf("expected full output attached, got %d bytes", len(data))
+	}
+
+	sender.files = nil
+	r.Route(ctx, "chat1", "user1", "/output "+id)
+	if len(sender.files["exec-"+id+".txt"]) != len(data) {
+		t.Fatal("expected /output to resend the full output")
+	}
+	r.Route(ctx, "chat2", "user1", "/output "+id)
+	if !strings.Contains(sender.LastMessage(), "找不到输出") {
+		t.Fatalf("expected other chats not to see the output, got %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "user1", "/output")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "500 字符") || !strings.Contains(msg, id) {
+		t.Fatalf("unexpected status %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "/output limit default")
+	if r.outputLimit("chat1") != defaultOutputLimit {
+		t.Fatalf("expected default limit, got %d", r.outputLimit("chat1"))
+	}
+}
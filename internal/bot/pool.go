@@ -0,0 +1,282 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// pingTimeout bounds a single backend health check.
+const pingTimeout = 5 * time.Second
+
+// pinger is implemented by executors that can be health-checked
+// (RemoteExecutor). Members without it are always considered healthy.
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type poolMember struct {
+	name     string
+	exec     Executor
+	roots    []string
+	inflight int
+	healthy  bool
+	lastErr  string
+}
+
+// serves reports whether the member has the repository at workDir.
+// A member without roots serves every directory.
+func (m *poolMember) serves(workDir string) bool {
+	if len(m.roots) == 0 {
+		return true
+	}
+	for _, root := range m.roots {
+		if underRoot(root, workDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExecutorPool dispatches each execution to the least-loaded healthy member
+// that serves the working directory. Members are the local ClaudeExecutor
+// and/or RemoteExecutors; remote members are health-checked by Run, and a
+// run whose backend is unreachable fails over to the next candidate.
+type ExecutorPool struct {
+	model string
+
+	mu               sync.Mutex
+	members          []*poolMember
+	running          int
+	execCount        int
+	lastExecDuration time.Duration
+}
+
+// NewExecutorPool creates an empty pool. model is the default reported to
+// the Router for sessions without their own model.
+func NewExecutorPool(model string) *ExecutorPool {
+	return &ExecutorPool{model: model}
+}
+
+// Add registers a backend. roots limits it to work directories under those
+// paths; nil means it serves every directory.
+func (p *ExecutorPool) Add(name string, exec Executor, roots []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.members = append(p.members, &poolMember{name: name, exec: exec, roots: roots, healthy: true})
+}
+
+// pick returns the least-loaded healthy member serving workDir, skipping
+// those in tried. Ties go to the member registered first.
+func (p *ExecutorPool) pick(workDir string, tried map[*poolMember]bool) (*poolMember, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var best *poolMember
+	serving := 0
+	for _, m := range p.members {
+		if !m.serves(workDir) {
+			continue
+		}
+		serving++
+		if !m.healthy || tried[m] {
+			continue
+		}
+		if best == nil || m.inflight < best.inflight {
+			best = m
+		}
+	}
+	if best == nil {
+		if serving == 0 {
+			return nil, fmt.Errorf("no executor serves %s", workDir)
+		}
+		return nil, fmt.Errorf("no healthy executor for %s", workDir)
+	}
+	best.inflight++
+	return best, nil
+}
+
+func (p *ExecutorPool) release(m *poolMember, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m.inflight--
+	if err != nil {
+		m.healthy = false
+		m.lastErr = err.Error()
+	}
+}
+
+func (p *ExecutorPool) ExecStream(ctx context.Context, prompt, workDir, sessionID, permissionMode, model string, onProgress func(text string)) (ExecResult, error) {
+	p.mu.Lock()
+	p.running++
+	p.mu.Unlock()
+	start := time.Now()
+	defer func() {
+		p.mu.Lock()
+		p.running--
+		p.execCount++
+		p.lastExecDuration = time.Since(start)
+		p.mu.Unlock()
+	}()
+
+	tried := make(map[*poolMember]bool)
+	for {
+		m, err := p.pick(workDir, tried)
+		if err != nil {
+			return ExecResult{}, err
+		}
+		tried[m] = true
+
+		progressed := false
+		result, err := m.exec.ExecStream(ctx, prompt, workDir, sessionID, permissionMode, model, func(text string) {
+			progressed = true
+			if onProgress != nil {
+				onProgress(text)
+			}
+		})
+		// Only fail over when the backend could not be reached at all;
+		// anything else may have already run the prompt.
+		if err != nil && !progressed && status.Code(err) == codes.Unavailable {
+			slog.WarnContext(ctx, "pool: executor unavailable, failing over", "executor", m.name, "err", err)
+			p.release(m, err)
+			continue
+		}
+		p.release(m, nil)
+		return result, err
+	}
+}
+
+// Kill kills the running process on every busy member.
+func (p *ExecutorPool) Kill() error {
+	p.mu.Lock()
+	var busy []*poolMember
+	for _, m := range p.members {
+		if m.inflight > 0 {
+			busy = append(busy, m)
+		}
+	}
+	p.mu.Unlock()
+
+	if len(busy) == 0 {
+		return fmt.Errorf("no running process")
+	}
+	var errs []string
+	for _, m := range busy {
+		if err := m.exec.Kill(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", m.name, err))
+		}
+	}
+	if len(errs) == len(busy) {
+		return fmt.Errorf("kill failed: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (p *ExecutorPool) IsRunning() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.running > 0
+}
+
+func (p *ExecutorPool) Model() string {
+	return p.model
+}
+
+// WaitIdle blocks until no execution is in flight or the timeout expires.
+func (p *ExecutorPool) WaitIdle(timeout time.Duration) bool {
+	return waitIdle(p.IsRunning, timeout)
+}
+
+func (p *ExecutorPool) ExecCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.execCount
+}
+
+func (p *ExecutorPool) LastExecDuration() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastExecDuration
+}
+
+// LocalPaths is true only when every member runs locally, since a work
+// directory may be served by any of them.
+func (p *ExecutorPool) LocalPaths() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, m := range p.members {
+		if !m.exec.LocalPaths() {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckHealth pings every member that supports it and updates its health.
+func (p *ExecutorPool) CheckHealth(ctx context.Context) {
+	p.mu.Lock()
+	members := append([]*poolMember(nil), p.members...)
+	p.mu.Unlock()
+
+	for _, m := range members {
+		pg, ok := m.exec.(pinger)
+		if !ok {
+			continue
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+		err := pg.Ping(pingCtx)
+		cancel()
+
+		p.mu.Lock()
+		if was := m.healthy; was != (err == nil) {
+			if err != nil {
+				slog.Warn("pool: executor unhealthy", "executor", m.name, "err", err)
+			} else {
+				slog.Info("pool: executor healthy again", "executor", m.name)
+			}
+		}
+		m.healthy = err == nil
+		m.lastErr = ""
+		if err != nil {
+			m.lastErr = err.Error()
+		}
+		p.mu.Unlock()
+	}
+}
+
+// Run health-checks the members every interval until ctx is cancelled.
+func (p *ExecutorPool) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.CheckHealth(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Summary returns one markdown line per member for /status.
+func (p *ExecutorPool) Summary() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var b strings.Builder
+	for _, m := range p.members {
+		state := "✓ 在线"
+		if !m.healthy {
+			state = "✗ 离线"
+		}
+		fmt.Fprintf(&b, "\n- `%s` %s · 执行中 %d", m.name, state, m.inflight)
+		if len(m.roots) > 0 {
+			fmt.Fprintf(&b, " · %s", strings.Join(m.roots, ", "))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,227 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// stubExecutor is a scriptable Executor for pool tests.
+type stubExecutor struct {
+	mu      sync.Mutex
+	calls   int
+	block   chan struct{} // if non-nil, ExecStream waits for it to close
+	err     error
+	pingErr error
+	killed  bool
+	remote  bool
+}
+
+func (s *stubExecutor) ExecStream(ctx context.Context, prompt, workDir, sessionID, permissionMode, model string, onProgress func(text string)) (ExecResult, error) {
+	s.mu.Lock()
+	s.calls++
+	block, err := s.block, s.err
+	s.mu.Unlock()
+	if block != nil {
+		<-block
+	}
+	if err != nil {
+		return ExecResult{}, err
+	}
+	return ExecResult{Output: "ok " + prompt}, nil
+}
+
+func (s *stubExecutor) Kill() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.killed = true
+	return nil
+}
+
+func (s *stubExecutor) IsRunning() bool                     { return false }
+func (s *stubExecutor) Model() string                       { return "sonnet" }
+func (s *stubExecutor) WaitIdle(timeout time.Duration) bool { return true }
+func (s *stubExecutor) ExecCount() int                      { return 0 }
+func (s *stubExecutor) LastExecDuration() time.Duration     { return 0 }
+func (s *stubExecutor) LocalPaths() bool                    { return !s.remote }
+
+func (s *stubExecutor) Ping(ctx context.Context) error { return s.pingErr }
+
+func (s *stubExecutor) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func TestExecutorPool_LeastLoaded(t *testing.T) {
+	busy := &stubExecutor{block: make(chan struct{})}
+	idle := &stubExecutor{}
+	pool := NewExecutorPool("sonnet")
+	pool.Add("a", busy, nil)
+	pool.Add("b", idle, nil)
+
+	done := make(chan struct{})
+	go func() {
+		pool.ExecStream(context.Background(), "first", "/src/app", "", "", "", nil)
+		close(done)
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for busy.callCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if _, err := pool.ExecStream(context.Background(), "second", "/src/app", "", "", "", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if idle.callCount() != 1 || busy.callCount() != 1 {
+		t.Fatalf("expected second run on idle backend, got busy=%d idle=%d", busy.callCount(), idle.callCount())
+	}
+	if !pool.IsRunning() {
+		t.Fatalf("expected pool to report running while first run is in flight")
+	}
+	close(busy.block)
+	<-done
+	if pool.ExecCount() != 2 || pool.IsRunning() {
+		t.Fatalf("expected 2 finished runs, got count=%d running=%v", pool.ExecCount(), pool.IsRunning())
+	}
+}
+
+func TestExecutorPool_Roots(t *testing.T) {
+	web := &stubExecutor{}
+	ml := &stubExecutor{}
+	pool := NewExecutorPool("sonnet")
+	pool.Add("web", web, []string{"/src/web"})
+	pool.Add("ml", ml, []string{"/src/ml"})
+
+	pool.ExecStream(context.Background(), "x", "/src/ml/train", "", "", "", nil)
+	if ml.callCount() != 1 || web.callCount() != 0 {
+		t.Fatalf("expected run on the backend with the repo, got web=%d ml=%d", web.callCount(), ml.callCount())
+	}
+
+	_, err := pool.ExecStream(context.Background(), "x", "/src/other", "", "", "", nil)
+	if err == nil || !strings.Contains(err.Error(), "no executor serves") {
+		t.Fatalf("expected no-executor error, got %v", err)
+	}
+}
+
+func TestExecutorPool_FailoverOnUnavailable(t *testing.T) {
+	down := &stubExecutor{err: status.Error(codes.Unavailable, "connection refused")}
+	up := &stubExecutor{}
+	pool := NewExecutorPool("sonnet")
+	pool.Add("down", down, nil)
+	pool.Add("up", up, nil)
+
+	result, err := pool.ExecStream(context.Background(), "x", "/src", "", "", "", nil)
+	if err != nil || result.Output != "ok x" {
+		t.Fatalf("expected failover to succeed, got %+v, %v", result, err)
+	}
+	if !strings.Contains(pool.Summary(), "`down` ✗ 离线") {
+		t.Fatalf("expected unavailable backend marked offline, got %q", pool.Summary())
+	}
+
+	// The unhealthy backend is skipped until a health check succeeds.
+	pool.ExecStream(context.Background(), "y", "/src", "", "", "", nil)
+	if down.callCount() != 1 {
+		t.Fatalf("expected offline backend to be skipped, got %d calls", down.callCount())
+	}
+	pool.CheckHealth(context.Background())
+	if !strings.Contains(pool.Summary(), "`down` ✓ 在线") {
+		t.Fatalf("expected backend healthy after ping, got %q", pool.Summary())
+	}
+}
+
+func TestExecutorPool_NoFailoverOnClaudeError(t *testing.T) {
+	failing := &stubExecutor{err: errors.New("claude error: boom")}
+	other := &stubExecutor{}
+	pool := NewExecutorPool("sonnet")
+	pool.Add("a", failing, nil)
+	pool.Add("b", other, nil)
+
+	if _, err := pool.ExecStream(context.Background(), "x", "/src", "", "", "", nil); err == nil {
+		t.Fatalf("expected claude error to be returned")
+	}
+	if other.callCount() != 0 {
+		t.Fatalf("expected no retry for non-transport errors")
+	}
+}
+
+func TestExecutorPool_HealthCheckSkipsDown(t *testing.T) {
+	a := &stubExecutor{pingErr: errors.New("down")}
+	b := &stubExecutor{}
+	pool := NewExecutorPool("sonnet")
+	pool.Add("a", a, nil)
+	pool.Add("b", b, nil)
+	pool.CheckHealth(context.Background())
+
+	pool.ExecStream(context.Background(), "x", "/src", "", "", "", nil)
+	if a.callCount() != 0 || b.callCount() != 1 {
+		t.Fatalf("expected run on healthy backend, got a=%d b=%d", a.callCount(), b.callCount())
+	}
+
+	b.pingErr = errors.New("down")
+	pool.CheckHealth(context.Background())
+	_, err := pool.ExecStream(context.Background(), "x", "/src", "", "", "", nil)
+	if err == nil || !strings.Contains(err.Error(), "no healthy executor") {
+		t.Fatalf("expected no-healthy error, got %v", err)
+	}
+}
+
+func TestExecutorPool_Kill(t *testing.T) {
+	busy := &stubExecutor{block: make(chan struct{})}
+	idle := &stubExecutor{}
+	pool := NewExecutorPool("sonnet")
+	pool.Add("a", busy, nil)
+	pool.Add("b", idle, nil)
+
+	if err := pool.Kill(); err == nil {
+		t.Fatalf("expected error with nothing running")
+	}
+	go pool.ExecStream(context.Background(), "x", "/src", "", "", "", nil)
+	deadline := time.Now().Add(2 * time.Second)
+	for busy.callCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := pool.Kill(); err != nil {
+		t.Fatalf("Kill: %v", err)
+	}
+	if !busy.killed || idle.killed {
+		t.Fatalf("expected only the busy backend killed")
+	}
+	close(busy.block)
+}
+
+func TestExecutorPool_RemoteFailoverToLocal(t *testing.T) {
+	remote, err := NewRemoteExecutor("127.0.0.1:1", "secret", "sonnet", ExecutorTLS{Insecure: true})
+	if err != nil {
+		t.Fatalf("NewRemoteExecutor: %v", err)
+	}
+	defer remote.Close()
+	local := &stubExecutor{}
+	pool := NewExecutorPool("sonnet")
+	pool.Add("remote", remote, nil)
+	pool.Add("local", local, nil)
+
+	result, err := pool.ExecStream(context.Background(), "x", "/src", "", "", "", nil)
+	if err != nil || result.Output != "ok x" {
+		t.Fatalf("expected failover from unreachable remote, got %+v, %v", result, err)
+	}
+}
+
+func TestRouterStatus_ShowsPool(t *testing.T) {
+	r, sender := newTestRouter(t)
+	pool := NewExecutorPool("sonnet")
+	pool.Add("gpu-1", &stubExecutor{}, []string{"/src/ml"})
+	r.executor = pool
+
+	r.Route(context.Background(), "chat1", "user1", "/status")
+	msg := sender.LastMessage()
+	if !strings.Contains(msg, "执行后端") || !strings.Contains(msg, "`gpu-1` ✓ 在线") || !strings.Contains(msg, "/src/ml") {
+		t.Fatalf("expected pool members in /status, got %q", msg)
+	}
+}
@@ -5,4 +5,25 @@ type CardMsg struct {
 	Title    string
 	Content  string // Markdown formatted content
 	Template string // Header color: blue/green/red/purple (defaults to blue)
+	Buttons  []CardButton
+	Details  *CardDetails // collapsed panel below Content
+	// Receipt is the ID of the execution the card belongs to, shown in
+	// its footer so the run can be named in /kill, /output, /trace, /repro
+	// and /feedback.
+	Receipt string
+}
+
+// CardDetails is a collapsed card panel for supporting information that
+// would otherwise crowd the main content.
+type CardDetails struct {
+	Title   string
+	Content string // Markdown formatted content
+}
+
+// CardButton is a card button that, when clicked, runs Command as if the
+// clicking user had sent it.
+type CardButton struct {
+	Text    string
+	Command string
+	Type    string // default/primary/danger (defaults to default)
 }
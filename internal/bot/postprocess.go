@@ -0,0 +1,208 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// outputProcessor rewrites Claude's final output for a chat before it is
+// sent. workDir is the directory the execution ran in.
+type outputProcessor func(ctx context.Context, r *Router, workDir, text string) (string, error)
+
+// outputProcessors are the steps output_processors may list, by name.
+var outputProcessors = map[string]outputProcessor{
+	"redact":       redactOutput,
+	"fix_markdown": fixMarkdownOutput,
+	"local_links":  localLinksOutput,
+	"translate":    translateOutput,
+}
+
+// SetOutputProcessors sets the post-processing pipeline applied to Claude's
+// output, in order; perChat replaces it for the chats listed (an empty
+// list turns it off there).
+func (r *Router) SetOutputProcessors(names []string, perChat map[string][]string) {
+	r.outputProcessors = names
+	r.chatOutputProcessors = perChat
+}
+
+// SetRepoBrowserURL sets the URL template local_links turns paths into;
+// {repo} is the project directory under the work root, {path} the file
+// inside it and {branch} the project's current branch.
+func (r *Router) SetRepoBrowserURL(tmpl string) {
+	r.repoBrowserURL = tmpl
+}
+
+// SetTranslateLanguage sets the language the translate step translates
+// output into.
+func (r *Router) SetTranslateLanguage(lang string) {
+	r.translateTo = lang
+}
+
+// outputProcessorsFor returns the pipeline configured for chatID.
+func (r *Router) outputProcessorsFor(chatID string) []string {
+	if names, ok := r.chatOutputProcessors[chatID]; ok {
+		return names
+	}
+	return r.outputProcessors
+}
+
+// postProcess runs text through chatID's output pipeline. A failing step
+// is logged and skipped, so the output is still sent.
+func (r *Router) postProcess(ctx context.Context, chatID, workDir, text string) string {
+	for _, name := range r.outputProcessorsFor(chatID) {
+		out, err := outputProcessors[name](ctx, r, workDir, text)
+		if err != nil {
+			slog.WarnContext(ctx, "router: output processor failed", "processor", name, "chat_id", chatID, "err", err)
+			continue
+		}
+		text = out
+	}
+	return text
+}
+
+// redactFor hides configured secrets in text when chatID's pipeline has
+// the redact step. Progress cards and the output kept for /output, /trace,
+// /share and transcripts go through it too, not only the result card.
+func (r *Router) redactFor(chatID, text string) string {
+	for _, name := range r.outputProcessorsFor(chatID) {
+		if name == "redact" {
+			return r.secrets.Redact(text)
+		}
+	}
+	return text
+}
+
+// redactOutput hides the values of configured secrets.
+func redactOutput(_ context.Context, r *Router, _, text string) (string, error) {
+	return r.secrets.Redact(text), nil
+}
+
+var mdHeadingLineRe = regexp.MustCompile(`^#{1,6}\s+(.+?)\s*#*\s*$`)
+
+// fixMarkdownOutput adapts Markdown to what Feishu cards render: headings,
+// which cards do not support, become bold lines, and an unclosed code
+// fence is closed so the rest of the card is not swallowed by it.
+func fixMarkdownOutput(_ context.Context, _ *Router, _, text string) (string, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	open := false
+	text = mapOutsideFences(text, &open, func(line string) string {
+		if m := mdHeadingLineRe.FindStringSubmatch(line); m != nil {
+			return "**" + strings.Trim(m[1], "*") + "**"
+		}
+		return line
+	})
+	if open {
+		text += "\n```"
+	}
+	return text, nil
+}
+
+// fileMentionRe matches a file path with an extension, absolute or relative
+// to the workdir, optionally followed by :line and wrapped in backticks.
+// The leading group keeps it from matching inside URLs and words.
+var fileMentionRe = regexp.MustCompile("(^|[\\s(（，：])(`?)(/?[\\w.@+-]+(?:/[\\w.@+-]+)*\\.[A-Za-z]\\w*)(?::(\\d+))?(`?)")
+
+// localLinksOutput turns mentions of files in projects under the work root
+// (absolute, or relative to workDir and existing) into links to the
+// repository browser. {branch} in the template is the project's current
+// branch, or its commit when detached.
+func localLinksOutput(_ context.Context, r *Router, workDir, text string) (string, error) {
+	root := r.store.WorkRoot()
+	if r.repoBrowserURL == "" || root == "" {
+		return text, nil
+	}
+	branches := make(map[string]string)
+	branchOf := func(repo string) string {
+		if b, ok := branches[repo]; ok {
+			return b
+		}
+		dir := filepath.Join(root, repo)
+		b := gitBranch(dir)
+		if b == "" {
+			b = gitHead(dir)
+		}
+		if b == "" {
+			b = "HEAD"
+		}
+		branches[repo] = b
+		return b
+	}
+	return mapOutsideFences(text, new(bool), func(line string) string {
+		return fileMentionRe.ReplaceAllStringFunc(line, func(m string) string {
+			sub := fileMentionRe.FindStringSubmatch(m)
+			lead, open, ref, lineNo, closing := sub[1], sub[2], sub[3], sub[4], sub[5]
+			if open != closing {
+				// Part of a longer code span; a link would not render there.
+				return m
+			}
+			abs, label := ref, ""
+			if !filepath.IsAbs(ref) {
+				if workDir == "" {
+					return m
+				}
+				abs = filepath.Join(workDir, ref)
+				if info, err := os.Stat(abs); err != nil || info.IsDir() {
+					return m
+				}
+				label = ref
+			}
+			rel, err := filepath.Rel(root, abs)
+			if err != nil || !underRoot(root, abs) {
+				return m
+			}
+			repo, path, ok := strings.Cut(filepath.ToSlash(rel), "/")
+			if !ok {
+				return m
+			}
+			if label == "" {
+				label = repo + "/" + path
+			}
+			url := strings.NewReplacer("{repo}", repo, "{path}", path, "{branch}", branchOf(repo)).Replace(r.repoBrowserURL)
+			if lineNo != "" {
+				url += "#L" + lineNo
+				label += ":" + lineNo
+			}
+			return fmt.Sprintf("%s[%s](%s)", lead, label, url)
+		})
+	}), nil
+}
+
+// translateOutput has Claude translate the output into the configured
+// language, in a fresh session and safe mode.
+func translateOutput(ctx context.Context, r *Router, workDir, text string) (string, error) {
+	if r.translateTo == "" || strings.TrimSpace(text) == "" {
+		return text, nil
+	}
+	prompt := fmt.Sprintf("Translate the following text into %s. Keep the Markdown formatting, code blocks, file paths, commands and identifiers unchanged. Reply with the translation only.\n\n%s", r.translateTo, text)
+	result, err := r.executor.ExecStream(ctx, prompt, workDir, "", "safe", r.summaryModel, nil)
+	if err != nil {
+		return "", err
+	}
+	out := strings.TrimSpace(result.Output)
+	if out == "" {
+		return "", fmt.Errorf("empty translation")
+	}
+	return out, nil
+}
+
+// mapOutsideFences applies fn to each line of text outside ``` code
+// fences. *open tracks whether a fence is open, starting from its value,
+// and is left set if text ends inside one.
+func mapOutsideFences(text string, open *bool, fn func(line string) string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			*open = !*open
+			continue
+		}
+		if !*open {
+			lines[i] = fn(line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFixMarkdownOutput(t *testing.T) {
+	in := "## Summary\nDone.\n```go\n# not a heading\nfunc f() {}"
+	got, _ := fixMarkdownOutput(context.Background(), nil, "", in)
+	want := "**Summary**\nDone.\n```go\n# not a heading\nfunc f() {}\n```"
+	if got != want {
+		t.Fatalf("fixMarkdownOutput = %q, want %q", got, want)
+	}
+}
+
+func TestLocalLinksOutput(t *testing.T) {
+	r, _ := newTestRouter(t)
+	root := r.store.WorkRoot()
+	r.SetRepoBrowserURL("https://github.com/acme/{repo}/blob/main/{path}")
+	in := "Fixed " + filepath.Join(root, "shop", "internal", "cart.go") + ":42 and /etc/hosts.txt\n```\n" + filepath.Join(root, "shop", "a.go") + "\n```"
+	got, _ := localLinksOutput(context.Background(), r, "", in)
+	want := "Fixed [shop/internal/cart.go:42](https://github.com/acme/shop/blob/main/internal/cart.go#L42) and /etc/hosts.txt\n```\n" + filepath.Join(root, "shop", "a.go") + "\n```"
+	if got != want {
+		t.Fatalf("localLinksOutput = %q, want %q", got, want)
+	}
+}
+
+func TestLocalLinksOutput_RelativePathsAndBranch(t *testing.T) {
+	r, _ := newTestRouter(t)
+	repo := filepath.Join(r.store.WorkRoot(), "project1")
+	initGitRepo(t, repo)
+	os.MkdirAll(filepath.Join(repo, "internal", "bot"), 0755)
+	os.WriteFile(filepath.Join(repo, "internal", "bot", "router.go"), []byte("package bot\n"), 0644)
+	runGitOutput(repo, "add", "-A")
+	runGitOutput(repo, "commit", "-qm", "init")
+	runGitOutput(repo, "checkout", "-q", "-b", "feature/x")
+	r.SetRepoBrowserURL("https://github.com/acme/{repo}/blob/{branch}/{path}")
+
+	in := "See `internal/bot/router.go:123`, internal/bot/missing.go and `go test internal/bot/router.go`."
+	got, _ := localLinksOutput(context.Background(), r, repo, in)
+	want := "See [internal/bot/router.go:123](https://github.com/acme/project1/blob/feature/x/internal/bot/router.go#L123), internal/bot/missing.go and `go test internal/bot/router.go`."
+	if got != want {
+		t.Fatalf("localLinksOutput = %q, want %q", got, want)
+	}
+}
+
+func TestPostProcess_PipelineAndOverrides(t *testing.T) {
+	r, _ := newTestRouter(t)
+	r.SetSecrets(&Secrets{values: map[string]string{"token": "s3cr3t-value"}})
+	r.SetOutputProcessors([]string{"redact", "fix_markdown"}, map[string][]string{"raw": {}})
+
+	if got := r.postProcess(context.Background(), "chat1", "", "# Key\ns3cr3t-value"); got != "**Key**\n[已隐藏]" {
+		t.Fatalf("default pipeline = %q", got)
+	}
+	if got := r.postProcess(context.Background(), "raw", "", "# Key"); got != "# Key" {
+		t.Fatalf("chat override = %q", got)
+	}
+}
+
+func TestPostProcess_FailingStepSkipped(t *testing.T) {
+	r, _ := newTestRouter(t)
+	r.executor = &stubExecutor{err: errors.New("rate limited")}
+	r.SetTranslateLanguage("English")
+	r.SetOutputProcessors([]string{"translate", "fix_markdown"}, nil)
+	if got := r.postProcess(context.Background(), "chat1", "", "# 完成"); got != "**完成**" {
+		t.Fatalf("postProcess = %q", got)
+	}
+}
+
+func TestExecClaude_RedactsProgressAndRecords(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "claude")
+	// Incidents shorten the progress delay to a second.
+	os.WriteFile(script, []byte(`#!/bin/sh
+sleep 1.2
+echo '{"type":"assistant","message":{"content":[{"type":"text","text":"token s3cr3t-value"}]}}'
+echo '{"type":"result","result":"token s3cr3t-value","session_id":"s1"}'
+`), 0755)
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	sender := &spySender{}
+	r := NewRouter(context.Background(), NewClaudeExecutor(script, "sonnet", 10*time.Second), store, sender, map[string]bool{"user1": true}, dir, nil)
+	r.SetSecrets(&Secrets{values: map[string]string{"token": "s3cr3t-value"}})
+	r.SetOutputProcessors([]string{"redact", "fix_markdown"}, nil)
+	ctx := context.Background()
+	r.Route(ctx, "chat1", "user1", "/incident start outage")
+	r.Route(ctx, "chat1", "user1", "show the token")
+
+	shown := 0
+	for _, m := range sender.messages {
+		if strings.Contains(m, "s3cr3t-value") {
+			t.Fatalf("secret reached the chat: %q", m)
+		}
+		if strings.Contains(m, "token [已隐藏]") {
+			shown++
+		}
+	}
+	if shown != 1 {
+		t.Fatalf("expected the output once, in the progress card, got %d: %v", shown, sender.messages)
+	}
+	recs := store.ExecRecords("chat1", 1)
+	if len(recs) != 1 || recs[0].Output != "token [已隐藏]" {
+		t.Fatalf("expected a redacted record, got %+v", recs)
+	}
+	if out := r.getSession("chat1").LastOutput; out != "token [已隐藏]" {
+		t.Fatalf("expected redacted LastOutput, got %q", out)
+	}
+	if turns, _ := store.Turns("s1"); len(turns) != 1 || strings.Contains(turns[0].Output, "s3cr3t") {
+		t.Fatalf("expected a redacted transcript, got %+v", turns)
+	}
+}
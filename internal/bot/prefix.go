@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// maxPrefixRunes bounds a custom command prefix.
+const maxPrefixRunes = 3
+
+// commandText rewrites text to the "/command args" form handleCommand
+// expects, using the chat's command settings: a custom prefix such as "!"
+// stands in for "/", and in bare-word chats a known command works without
+// any prefix. "/" always works, so card buttons and /prefix itself keep
+// working. It reports false for text that is not a command: "//" escapes a
+// leading slash, and text starting with a path such as /etc/hosts is a
+// prompt.
+func commandText(s Session, text string) (string, bool) {
+	if strings.HasPrefix(text, "//") {
+		return text[1:], false
+	}
+	if strings.HasPrefix(text, "/") {
+		return text, !looksLikePath(strings.Fields(text)[0])
+	}
+	if p := s.CommandPrefix; p != "" && strings.HasPrefix(text, p) && len(text) > len(p) {
+		return "/" + strings.TrimPrefix(text, p), true
+	}
+	if s.BareCommands {
+		name := strings.ToLower(strings.Fields(text)[0])
+		for _, cmd := range knownCommands {
+			if cmd == "/"+name {
+				return "/" + text, true
+			}
+		}
+	}
+	return text, false
+}
+
+// looksLikePath reports whether word, the first word of a message starting
+// with "/", is a path rather than a command: command names never contain
+// another slash or a dot.
+func looksLikePath(word string) bool {
+	for _, cmd := range knownCommands {
+		if strings.EqualFold(word, cmd) {
+			return false
+		}
+	}
+	return strings.ContainsAny(word[1:], "/.~")
+}
+
+// validPrefix reports whether p can be used as a command prefix: a few
+// punctuation characters, so it cannot collide with words, @ references or
+// mentions.
+func validPrefix(p string) bool {
+	runes := []rune(p)
+	if len(runes) == 0 || len(runes) > maxPrefixRunes || strings.Contains(p, "@") {
+		return false
+	}
+	for _, c := range runes {
+		if !unicode.IsPunct(c) && !unicode.IsSymbol(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// cmdPrefix shows or changes how commands are recognized in the chat.
+func (r *Router) cmdPrefix(ctx context.Context, chatID, args string) {
+	fields := strings.Fields(args)
+	s := r.getSession(chatID)
+	if len(fields) == 0 {
+		prefix := "/"
+		if s.CommandPrefix != "" {
+			prefix = s.CommandPrefix + " 或 /"
+		}
+		bare := "关闭"
+		if s.BareCommands {
+			bare = "开启（非命令的消息不会发给 Claude）"
+		}
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("命令前缀: %s\n无前缀命令: %s\n\n用法:\n/prefix <前缀>  使用其他前缀，如 /prefix !（/ 始终可用）\n/prefix default  恢复为 /\n/prefix bare on|off  命令专用聊天：不带前缀也能执行命令，其他消息只提示不发给 Claude", prefix, bare))
+		return
+	}
+
+	if fields[0] == "bare" {
+		if len(fields) != 2 || (fields[1] != "on" && fields[1] != "off") {
+			r.sender.SendText(ctx, chatID, "用法: /prefix bare on|off")
+			return
+		}
+		on := fields[1] == "on"
+		r.store.UpdateSession(chatID, func(s *Session) {
+			s.BareCommands = on
+		})
+		r.save()
+		if on {
+			r.sender.SendText(ctx, chatID, "✓ 已开启命令专用模式：直接发送 status、diff 等即可执行命令，其他消息不会发给 Claude。")
+		} else {
+			r.sender.SendText(ctx, chatID, "✓ 已关闭命令专用模式，普通消息会发给 Claude。")
+		}
+		return
+	}
+
+	prefix := fields[0]
+	if prefix == "default" || prefix == "/" {
+		prefix = ""
+	} else if len(fields) != 1 || !validPrefix(prefix) {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("前缀应为 1-%d 个标点符号（不含 @），如 ! 或 .", maxPrefixRunes))
+		return
+	}
+	r.store.UpdateSession(chatID, func(s *Session) {
+		s.CommandPrefix = prefix
+	})
+	r.save()
+	if prefix == "" {
+		r.sender.SendText(ctx, chatID, "✓ 命令前缀已恢复为 /")
+		return
+	}
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 命令前缀已设为 %s，如 %sstatus（/ 仍然可用）", prefix, prefix))
+}
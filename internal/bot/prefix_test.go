@@ -0,0 +1,109 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCommandText(t *testing.T) {
+	cases := []struct {
+		s     Session
+		in    string
+		want  string
+		isCmd bool
+	}{
+		{Session{}, "/status", "/status", true},
+		{Session{}, "!status", "!status", false},
+		{Session{}, "//usr/bin 下有什么", "/usr/bin 下有什么", false},
+		{Session{}, "//status", "/status", false},
+		{Session{}, "/etc/hosts 里加一行", "/etc/hosts 里加一行", false},
+		{Session{}, "/tmp/x.log\nerror", "/tmp/x.log\nerror", false},
+		{Session{}, "/.bashrc", "/.bashrc", false},
+		{Session{}, "/review-local", "/review-local", true},
+		{Session{}, "/nosuchcmd", "/nosuchcmd", true},
+		{Session{CommandPrefix: "!"}, "!diff --stat", "/diff --stat", true},
+		{Session{CommandPrefix: "!"}, "/diff", "/diff", true},
+		{Session{CommandPrefix: "!"}, "!", "!", false},
+		{Session{BareCommands: true}, "Status", "/Status", true},
+		{Session{BareCommands: true}, "log 5", "/log 5", true},
+		{Session{BareCommands: true}, "fix the bug", "fix the bug", false},
+	}
+	for _, c := range cases {
+		got, ok := commandText(c.s, c.in)
+		if got != c.want || ok != c.isCmd {
+			t.Errorf("commandText(%+v, %q) = %q, %v; want %q, %v", c.s, c.in, got, ok, c.want, c.isCmd)
+		}
+	}
+}
+
+func TestValidPrefix(t *testing.T) {
+	for p, want := range map[string]bool{"!": true, ".": true, "!!": true, "$": true, "@": false, "a": false, "!!!!": false, "": false, "! ": false} {
+		if got := validPrefix(p); got != want {
+			t.Errorf("validPrefix(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestRouterPrefix(t *testing.T) {
+	r, sender := newTestRouter(t)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "/prefix abc")
+	if !strings.Contains(sender.LastMessage(), "标点符号") {
+		t.Fatalf("expected invalid prefix message, got %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "user1", "/prefix !")
+	r.Route(ctx, "chat1", "user1", "!pwd")
+	if !strings.Contains(sender.LastMessage(), r.store.WorkRoot()) {
+		t.Fatalf("expected !pwd to run /pwd, got %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat2", "user1", "!pwd")
+	if strings.Contains(sender.LastMessage(), r.store.WorkRoot()) {
+		t.Fatal("expected the prefix to be per chat")
+	}
+
+	r.Route(ctx, "chat1", "user1", "/prefix bare on")
+	r.Route(ctx, "chat1", "user1", "pwd")
+	if !strings.Contains(sender.LastMessage(), r.store.WorkRoot()) {
+		t.Fatalf("expected bare pwd to run /pwd, got %q", sender.LastMessage())
+	}
+	n := len(sender.messages)
+	r.Route(ctx, "chat1", "user1", "please refactor this")
+	if len(sender.messages) != n+1 || !strings.Contains(sender.LastMessage(), "命令专用聊天") {
+		t.Fatalf("expected a hint instead of a prompt, got %q", sender.messages[n:])
+	}
+
+	r.Route(ctx, "chat1", "user1", "prefix")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "命令前缀: ! 或 /") || !strings.Contains(msg, "无前缀命令: 开启") {
+		t.Fatalf("unexpected status %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "prefix bare off")
+	r.Route(ctx, "chat1", "user1", "!prefix default")
+	if s := r.getSession("chat1"); s.CommandPrefix != "" || s.BareCommands {
+		t.Fatalf("expected defaults restored, got %+v", s)
+	}
+}
+
+func TestRouterSayAndPaths(t *testing.T) {
+	r, sender := newTestRouter(t)
+	ctx := context.Background()
+	for text, want := range map[string]string{
+		"/etc/hosts 里有什么":      "/etc/hosts 里有什么",
+		"//status 是什么意思":       "/status 是什么意思",
+		"/say /status 是什么意思":   "/status 是什么意思",
+		"//etc/hosts 不是命令也能转义": "/etc/hosts 不是命令也能转义",
+	} {
+		r.Route(ctx, "chat1", "user1", text)
+		if strings.Contains(sender.LastMessage(), "未知命令") {
+			t.Fatalf("expected %q to be a prompt, got %q", text, sender.LastMessage())
+		}
+		if got := r.getSession("chat1").LastPrompt; got != want {
+			t.Errorf("%q: expected prompt %q, got %q", text, want, got)
+		}
+	}
+	r.Route(ctx, "chat1", "user1", "/say")
+	if !strings.Contains(sender.LastMessage(), "用法: /say") {
+		t.Fatalf("unexpected usage %q", sender.LastMessage())
+	}
+}
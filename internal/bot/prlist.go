@@ -0,0 +1,263 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ghPRFields are the `gh pr list/view --json` fields the PR cards show.
+const ghPRFields = "number,title,url,state,isDraft,author,headRefName,baseRefName,reviewDecision,statusCheckRollup,updatedAt"
+
+// ghPRViewFields adds what only the /pr view card shows.
+const ghPRViewFields = ghPRFields + ",body,additions,deletions,changedFiles,mergeable"
+
+// ghPR is a pull request as printed by `gh pr ... --json`.
+type ghPR struct {
+	Number         int
+	Title          string
+	URL            string
+	State          string
+	IsDraft        bool
+	Author         struct{ Login string }
+	HeadRefName    string
+	BaseRefName    string
+	ReviewDecision string
+	// StatusCheckRollup mixes check runs (Status, Conclusion) and commit
+	// statuses (State).
+	StatusCheckRollup []struct {
+		Name       string
+		Context    string
+		Status     string
+		Conclusion string
+		State      string
+	}
+	UpdatedAt    time.Time
+	Body         string
+	Additions    int
+	Deletions    int
+	ChangedFiles int
+	Mergeable    string
+}
+
+// ciSummary condenses a PR's checks: failures first, then pending, else
+// how many passed. failed names the failing checks.
+func (pr ghPR) ciSummary() (summary string, failed []string) {
+	if len(pr.StatusCheckRollup) == 0 {
+		return "", nil
+	}
+	passed, pending := 0, 0
+	for _, c := range pr.StatusCheckRollup {
+		name := c.Name
+		if name == "" {
+			name = c.Context
+		}
+		result := c.Conclusion
+		if result == "" {
+			result = c.State
+		}
+		switch {
+		case c.Status != "" && c.Status != "COMPLETED", result == "PENDING", result == "EXPECTED":
+			pending++
+		case result == "SUCCESS", result == "NEUTRAL", result == "SKIPPED":
+			passed++
+		default:
+			failed = append(failed, name)
+		}
+	}
+	total := len(pr.StatusCheckRollup)
+	switch {
+	case len(failed) > 0:
+		return fmt.Sprintf("❌ CI %d/%d 失败", len(failed), total), failed
+	case pending > 0:
+		return fmt.Sprintf("⏳ CI %d/%d 进行中", pending, total), nil
+	}
+	return fmt.Sprintf("✅ CI %d/%d", passed, total), nil
+}
+
+// reviewLabel describes a PR's review decision, or "" when there is none.
+func reviewLabel(decision string) string {
+	switch decision {
+	case "APPROVED":
+		return "✅ 已批准"
+	case "CHANGES_REQUESTED":
+		return "🔁 需修改"
+	case "REVIEW_REQUIRED":
+		return "👀 待评审"
+	}
+	return ""
+}
+
+// prListLine renders one PR of the /prs card.
+func prListLine(pr ghPR) string {
+	meta := []string{"@" + pr.Author.Login, "`" + pr.HeadRefName + "`"}
+	if pr.State != "" && pr.State != "OPEN" {
+		meta = append(meta, strings.ToLower(pr.State))
+	}
+	if pr.IsDraft {
+		meta = append(meta, "草稿")
+	}
+	if ci, _ := pr.ciSummary(); ci != "" {
+		meta = append(meta, ci)
+	}
+	if review := reviewLabel(pr.ReviewDecision); review != "" {
+		meta = append(meta, review)
+	}
+	return fmt.Sprintf("- [#%d](%s) %s\n  %s", pr.Number, pr.URL, pr.Title, strings.Join(meta, " · "))
+}
+
+// prForge returns the CLI managing pull requests of the repository in
+// workDir: "glab" for GitLab remotes, "gh" otherwise.
+func prForge(workDir string) string {
+	if url, err := runGitOutput(workDir, "remote", "get-url", "origin"); err == nil && strings.Contains(strings.ToLower(url), "gitlab") {
+		return "glab"
+	}
+	return "gh"
+}
+
+// cmdPRList lists the repository's pull requests with their CI and review
+// status without going through Claude. "all" includes closed ones,
+// "status" shows `gh pr status`, anything else is passed to gh.
+func (r *Router) cmdPRList(ctx context.Context, chatID, args string) {
+	workDir := r.getSession(chatID).WorkDir
+	if workDir == "" {
+		workDir = r.store.WorkRoot()
+	}
+	forge := prForge(workDir)
+	if !r.requireForge(ctx, chatID, forge) {
+		return
+	}
+
+	if forge == "glab" {
+		glabArgs := []string{"mr", "list"}
+		if args == "all" {
+			glabArgs = append(glabArgs, "--all")
+		} else if args != "" {
+			glabArgs = append(glabArgs, strings.Fields(args)...)
+		}
+		output, err := runForge(ctx, workDir, forge, glabArgs...)
+		if err != nil {
+			r.sender.SendCard(ctx, chatID, CardMsg{Title: "获取 MR 列表出错", Content: output, Template: "red"})
+			return
+		}
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "Merge Requests", Content: "```\n" + orDash(output) + "\n```"})
+		return
+	}
+
+	if args == "status" {
+		output, err := runForge(ctx, workDir, forge, "pr", "status")
+		if err != nil {
+			r.sender.SendCard(ctx, chatID, CardMsg{Title: "获取 PR 状态出错", Content: output, Template: "red"})
+			return
+		}
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "PR 状态", Content: "```\n" + output + "\n```"})
+		return
+	}
+
+	ghArgs := []string{"pr", "list", "--limit", "20", "--json", ghPRFields}
+	if args == "all" {
+		ghArgs = append(ghArgs, "--state", "all")
+	} else if args != "" {
+		ghArgs = append(ghArgs, strings.Fields(args)...)
+	}
+	var prs []ghPR
+	if output, err := ghJSON(ctx, workDir, &prs, ghArgs...); err != nil {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "获取 PR 列表出错", Content: output, Template: "red"})
+		return
+	}
+	if len(prs) == 0 {
+		r.sender.SendText(ctx, chatID, "没有开放中的 Pull Request。")
+		return
+	}
+	lines := make([]string, len(prs))
+	failing := 0
+	for i, pr := range prs {
+		lines[i] = prListLine(pr)
+		if _, failed := pr.ciSummary(); len(failed) > 0 {
+			failing++
+		}
+	}
+	content := strings.Join(lines, "\n") + "\n\n`/pr view <编号>` 查看详情"
+	tpl := "blue"
+	if failing > 0 {
+		tpl = "orange"
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("Pull Requests（%d）", len(prs)), Content: content, Template: tpl})
+}
+
+// cmdPRView shows one pull request as a card: state, branches, size,
+// checks, review decision and the start of its description.
+func (r *Router) cmdPRView(ctx context.Context, chatID, arg string) {
+	n, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+	if err != nil || n <= 0 {
+		r.sender.SendText(ctx, chatID, "用法: /pr view <编号>\n示例: /pr view 42")
+		return
+	}
+	workDir := r.getSession(chatID).WorkDir
+	if workDir == "" {
+		workDir = r.store.WorkRoot()
+	}
+	forge := prForge(workDir)
+	if !r.requireForge(ctx, chatID, forge) {
+		return
+	}
+	if forge == "glab" {
+		output, err := runForge(ctx, workDir, forge, "mr", "view", strconv.Itoa(n))
+		if err != nil {
+			r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("获取 MR !%d 出错", n), Content: output, Template: "red"})
+			return
+		}
+		shown, full := r.fitOutput(chatID, "mr", output, false, "内容过长")
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("MR !%d", n), Content: shown})
+		r.sendFullOutput(ctx, chatID, full)
+		return
+	}
+
+	var pr ghPR
+	if output, err := ghJSON(ctx, workDir, &pr, "pr", "view", strconv.Itoa(n), "--json", ghPRViewFields); err != nil {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("获取 PR #%d 出错", n), Content: output, Template: "red"})
+		return
+	}
+
+	var sb strings.Builder
+	state := strings.ToLower(pr.State)
+	if pr.IsDraft {
+		state += "（草稿）"
+	}
+	fmt.Fprintf(&sb, "**状态:** %s  **作者:** @%s\n", state, pr.Author.Login)
+	fmt.Fprintf(&sb, "**分支:** `%s` → `%s`\n", pr.HeadRefName, pr.BaseRefName)
+	fmt.Fprintf(&sb, "**变更:** %d 个文件，+%d −%d\n", pr.ChangedFiles, pr.Additions, pr.Deletions)
+	ci, failed := pr.ciSummary()
+	if ci != "" {
+		fmt.Fprintf(&sb, "**检查:** %s\n", ci)
+		for _, name := range failed {
+			fmt.Fprintf(&sb, "- ❌ %s\n", name)
+		}
+	}
+	if review := reviewLabel(pr.ReviewDecision); review != "" {
+		fmt.Fprintf(&sb, "**评审:** %s\n", review)
+	}
+	if pr.Mergeable == "CONFLICTING" {
+		sb.WriteString("**合并:** ⚠️ 存在冲突\n")
+	}
+	if !pr.UpdatedAt.IsZero() {
+		fmt.Fprintf(&sb, "**更新于:** %s\n", pr.UpdatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	if body := strings.TrimSpace(pr.Body); body != "" {
+		sb.WriteString("\n" + truncateRunes(body, 1500) + "\n")
+	}
+	fmt.Fprintf(&sb, "\n[在 GitHub 上查看](%s)", pr.URL)
+
+	tpl := "blue"
+	switch {
+	case pr.State == "MERGED":
+		tpl = "purple"
+	case pr.State == "CLOSED":
+		tpl = "grey"
+	case len(failed) > 0 || pr.Mergeable == "CONFLICTING":
+		tpl = "orange"
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("PR #%d %s", pr.Number, pr.Title), Content: sb.String(), Template: tpl})
+}
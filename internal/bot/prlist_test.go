@@ -0,0 +1,66 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakePRGH puts a gh on PATH that answers `pr list` and `pr view` with
+// canned JSON and records its arguments in the returned file.
+func fakePRGH(t *testing.T) string {
+	t.Helper()
+	bin := t.TempDir()
+	args := filepath.Join(bin, "args")
+	list := `[{"number":12,"title":"Fix login retry","url":"https://github.com/acme/app/pull/12","state":"OPEN","author":{"login":"alice"},"headRefName":"fix-login","reviewDecision":"APPROVED","statusCheckRollup":[{"name":"test","status":"COMPLETED","conclusion":"SUCCESS"},{"context":"lint","state":"SUCCESS"}]},` +
+		`{"number":13,"title":"WIP cache","url":"https://github.com/acme/app/pull/13","state":"OPEN","isDraft":true,"author":{"login":"bob"},"headRefName":"cache","statusCheckRollup":[{"name":"test","status":"COMPLETED","conclusion":"FAILURE"},{"name":"e2e","status":"IN_PROGRESS"}]}]`
+	view := `{"number":13,"title":"WIP cache","url":"https://github.com/acme/app/pull/13","state":"OPEN","isDraft":true,"author":{"login":"bob"},"headRefName":"cache","baseRefName":"main","additions":40,"deletions":3,"changedFiles":2,"mergeable":"CONFLICTING","body":"Adds a cache.","statusCheckRollup":[{"name":"test","status":"COMPLETED","conclusion":"FAILURE"}]}`
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + args + "\ncase \"$2\" in\nlist) echo '" + list + "' ;;\nview) echo '" + view + "' ;;\nesac\n"
+	os.WriteFile(filepath.Join(bin, "gh"), []byte(script), 0755)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return args
+}
+
+func TestRouterPRList_Card(t *testing.T) {
+	fakePRGH(t)
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/prs")
+
+	msg := sender.LastMessage()
+	for _, want := range []string{"Pull Requests（2）", "[#12](https://github.com/acme/app/pull/12) Fix login retry", "@alice", "✅ CI 2/2", "✅ 已批准", "草稿", "❌ CI 1/2 失败"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("/prs card missing %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestRouterPRView(t *testing.T) {
+	args := fakePRGH(t)
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/pr view #13")
+
+	msg := sender.LastMessage()
+	for _, want := range []string{"PR #13 WIP cache", "open（草稿）", "`cache` → `main`", "2 个文件，+40 −3", "- ❌ test", "存在冲突", "Adds a cache."} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("/pr view card missing %q:\n%s", want, msg)
+		}
+	}
+	if data, _ := os.ReadFile(args); !strings.HasPrefix(string(data), "pr\nview\n13\n--json\n") {
+		t.Fatalf("unexpected gh args %q", data)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/pr view latest")
+	if !strings.HasPrefix(sender.LastMessage(), "用法: /pr view") {
+		t.Fatalf("expected usage, got %q", sender.LastMessage())
+	}
+}
+
+func TestRouterPRList_NoGH(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/prs")
+	if !strings.Contains(sender.LastMessage(), "未找到 gh 命令行工具") {
+		t.Fatalf("expected a missing gh message, got %q", sender.LastMessage())
+	}
+}
@@ -0,0 +1,258 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxProtectSnapshot caps how many bytes of protected files are kept in
+// memory during an execution; files beyond it are only detected, not
+// restored.
+const maxProtectSnapshot = 32 << 20
+
+// protectMatch reports whether the slash-separated repository path rel
+// matches a /protect glob: "dir/" covers everything under a directory of
+// that name, a glob without a slash matches file names at any depth, and
+// any other glob matches the whole path.
+func protectMatch(pattern, rel string) bool {
+	if dir, ok := strings.CutSuffix(pattern, "/"); ok {
+		if strings.Contains(dir, "/") {
+			return strings.HasPrefix(rel, dir+"/")
+		}
+		parts := strings.Split(rel, "/")
+		for _, p := range parts[:len(parts)-1] {
+			if ok, _ := path.Match(dir, p); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	ok, _ := path.Match(strings.TrimPrefix(pattern, "/"), rel)
+	return ok
+}
+
+// protectedFiles lists the tracked and untracked files of root matching
+// any of patterns.
+func protectedFiles(root string, patterns []string) []string {
+	out, err := runGitOutput(root, "ls-files", "-co", "--exclude-standard")
+	if err != nil || out == "" {
+		return nil
+	}
+	var files []string
+	for _, rel := range strings.Split(out, "\n") {
+		for _, p := range patterns {
+			if protectMatch(p, rel) {
+				files = append(files, rel)
+				break
+			}
+		}
+	}
+	return files
+}
+
+// protectGuard holds the protected files of a repository as they were
+// before an execution.
+type protectGuard struct {
+	root     string
+	patterns []string
+	files    map[string]protectedFile
+}
+
+// protectedFile is a snapshot of one protected file; kept is false when it
+// was too large to hold in memory.
+type protectedFile struct {
+	data []byte
+	size int64
+	mode os.FileMode
+	kept bool
+}
+
+// protectBefore snapshots workDir's repository's protected files, or
+// returns nil when the repository has no /protect globs.
+func (r *Router) protectBefore(workDir string) *protectGuard {
+	if workDir == "" {
+		return nil
+	}
+	root := repoRoot(workDir)
+	patterns := r.protectedPatterns(root)
+	if len(patterns) == 0 {
+		return nil
+	}
+	g := &protectGuard{root: root, patterns: patterns, files: make(map[string]protectedFile)}
+	var total int64
+	for _, rel := range protectedFiles(root, patterns) {
+		info, err := os.Lstat(filepath.Join(root, rel))
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		f := protectedFile{size: info.Size(), mode: info.Mode().Perm()}
+		if total+info.Size() <= maxProtectSnapshot {
+			if f.data, err = os.ReadFile(filepath.Join(root, rel)); err == nil {
+				f.kept = true
+				total += int64(len(f.data))
+			}
+		}
+		g.files[rel] = f
+	}
+	return g
+}
+
+// restore puts back every protected file the execution changed, removes
+// protected files it created and returns a warning listing them, or "" when
+// nothing protected was touched.
+func (g *protectGuard) restore() string {
+	if g == nil {
+		return ""
+	}
+	var restored, removed, failed []string
+	for _, rel := range protectedFiles(g.root, g.patterns) {
+		if _, existed := g.files[rel]; existed {
+			continue
+		}
+		if err := os.Remove(filepath.Join(g.root, rel)); err != nil {
+			failed = append(failed, rel)
+			continue
+		}
+		removed = append(removed, rel)
+	}
+	for rel, before := range g.files {
+		full := filepath.Join(g.root, rel)
+		current, err := os.ReadFile(full)
+		switch {
+		case err == nil && before.kept && bytes.Equal(current, before.data):
+			continue
+		case err == nil && !before.kept && int64(len(current)) == before.size:
+			// Too large to keep: only a size change is noticed.
+			continue
+		case err != nil && !os.IsNotExist(err), !before.kept:
+			failed = append(failed, rel)
+			continue
+		}
+		os.MkdirAll(filepath.Dir(full), 0755)
+		if err := os.WriteFile(full, before.data, before.mode); err != nil {
+			failed = append(failed, rel)
+			continue
+		}
+		restored = append(restored, rel)
+	}
+	if len(restored)+len(removed)+len(failed) == 0 {
+		return ""
+	}
+	slog.Info("protect: restored", "root", g.root, "restored", restored, "removed", removed, "failed", failed)
+	var sb strings.Builder
+	sb.WriteString("Claude 修改了受保护的文件，已自动撤销：\n")
+	for _, list := range []struct {
+		label string
+		files []string
+	}{{"已恢复", restored}, {"已删除新建的文件", removed}, {"⚠️ 无法自动恢复，请手动检查", failed}} {
+		if len(list.files) == 0 {
+			continue
+		}
+		sort.Strings(list.files)
+		fmt.Fprintf(&sb, "\n**%s:**\n", list.label)
+		for _, f := range list.files {
+			fmt.Fprintf(&sb, "- `%s`\n", f)
+		}
+	}
+	sb.WriteString("\n如需修改这些文件，请自己修改或先用 `/protect rm` 移除规则。")
+	return sb.String()
+}
+
+// protectedPatterns returns the /protect globs of root followed by those
+// its .devbot.yaml adds.
+func (r *Router) protectedPatterns(root string) []string {
+	patterns := r.store.ProtectedPatterns(root)
+	cfg, _, _ := r.repoConfig(root)
+	for _, p := range cfg.Protect {
+		if patternIndex(patterns, p) < 0 {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+func patternIndex(patterns []string, p string) int {
+	for i, q := range patterns {
+		if q == p {
+			return i
+		}
+	}
+	return -1
+}
+
+// cmdProtect lists, adds and removes the protected globs of the current
+// repository.
+func (r *Router) cmdProtect(ctx context.Context, chatID, args string) {
+	session := r.getSession(chatID)
+	dir := session.WorkDir
+	if dir == "" {
+		dir = r.store.WorkRoot()
+	}
+	root := repoRoot(dir)
+	patterns := r.store.ProtectedPatterns(root)
+	cfg, _, _ := r.repoConfig(root)
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		all := r.protectedPatterns(root)
+		if len(all) == 0 {
+			r.sender.SendText(ctx, chatID, "当前仓库没有受保护的文件。\n用法: /protect add <模式>...  如 /protect add migrations/ *.lock .github/workflows/\n       /protect rm <模式>...\nClaude 执行后若修改了受保护的文件，会自动恢复并提醒。")
+			return
+		}
+		var sb strings.Builder
+		for _, p := range all {
+			fmt.Fprintf(&sb, "- `%s`", p)
+			if patternIndex(patterns, p) < 0 {
+				sb.WriteString("（" + repoConfigFile + "）")
+			}
+			sb.WriteString("\n")
+		}
+		if files := protectedFiles(root, all); len(files) > 0 {
+			fmt.Fprintf(&sb, "\n当前匹配 %d 个文件", len(files))
+		}
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("🛡 受保护的文件（%d 条规则）", len(all)), Content: sb.String()})
+		return
+	}
+	if len(fields) < 2 || (fields[0] != "add" && fields[0] != "rm") {
+		r.sender.SendText(ctx, chatID, "用法: /protect [add|rm <模式>...]")
+		return
+	}
+	switch fields[0] {
+	case "add":
+		for _, p := range fields[1:] {
+			if _, err := path.Match(strings.TrimSuffix(p, "/"), ""); err != nil {
+				r.sender.SendText(ctx, chatID, fmt.Sprintf("无效的模式: %s", p))
+				return
+			}
+			if patternIndex(patterns, p) < 0 {
+				patterns = append(patterns, p)
+			}
+		}
+	case "rm":
+		for _, p := range fields[1:] {
+			i := patternIndex(patterns, p)
+			if i < 0 && patternIndex(cfg.Protect, p) >= 0 {
+				r.sender.SendText(ctx, chatID, fmt.Sprintf("规则 %s 来自仓库的 %s，请修改该文件。", p, repoConfigFile))
+				return
+			}
+			if i < 0 {
+				r.sender.SendText(ctx, chatID, fmt.Sprintf("没有这条规则: %s", p))
+				return
+			}
+			patterns = append(patterns[:i], patterns[i+1:]...)
+		}
+	}
+	r.store.SetProtectedPatterns(root, patterns)
+	r.save()
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ %s 现在有 %d 条保护规则", root, len(patterns)))
+}
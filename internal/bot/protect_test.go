@@ -0,0 +1,74 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProtectMatch(t *testing.T) {
+	tests := []struct {
+		pattern, rel string
+		want         bool
+	}{
+		{"migrations/", "migrations/001.sql", true},
+		{"migrations/", "db/migrations/001.sql", true},
+		{"migrations/", "migrations.go", false},
+		{".github/workflows/", ".github/workflows/ci.yml", true},
+		{".github/workflows/", "sub/.github/workflows/ci.yml", false},
+		{"*.lock", "Cargo.lock", true},
+		{"*.lock", "web/yarn.lock", true},
+		{"go.sum", "tools/go.sum", true},
+		{"cmd/*.go", "cmd/main.go", true},
+		{"cmd/*.go", "cmd/sub/main.go", false},
+		{"/cmd/*.go", "cmd/main.go", true},
+	}
+	for _, tt := range tests {
+		if got := protectMatch(tt.pattern, tt.rel); got != tt.want {
+			t.Errorf("protectMatch(%q, %q) = %v, want %v", tt.pattern, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestRouterProtectRestoresFiles(t *testing.T) {
+	r, sender, repo := newVerifyRouter(t, "echo tampered >> go.sum\nmkdir -p migrations && echo 'DROP TABLE users;' > migrations/002.sql\necho '// edited' >> main.go")
+	ctx := context.Background()
+	os.WriteFile(filepath.Join(repo, "go.sum"), []byte("original\n"), 0644)
+
+	r.Route(ctx, "chat1", "user1", "/protect add go.sum migrations/")
+	r.Route(ctx, "chat1", "user1", "/protect")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "`go.sum`") || !strings.Contains(msg, "`migrations/`") || !strings.Contains(msg, "匹配 1 个文件") {
+		t.Fatalf("unexpected rule list %q", msg)
+	}
+
+	r.Route(ctx, "chat1", "user1", "update deps")
+	if data, _ := os.ReadFile(filepath.Join(repo, "go.sum")); string(data) != "original\n" {
+		t.Fatalf("expected go.sum restored, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "migrations", "002.sql")); !os.IsNotExist(err) {
+		t.Fatalf("expected the new migration removed, got %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(repo, "main.go")); !strings.Contains(string(data), "// edited") {
+		t.Fatal("expected unprotected edits kept")
+	}
+	var warning string
+	for _, m := range sender.messages {
+		if strings.Contains(m, "受保护") {
+			warning = m
+		}
+	}
+	if !strings.Contains(warning, "`go.sum`") || !strings.Contains(warning, "`migrations/002.sql`") {
+		t.Fatalf("expected a warning listing both files, got %q", sender.messages)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/protect rm go.sum migrations/")
+	if got := r.store.ProtectedPatterns(repo); len(got) != 0 {
+		t.Fatalf("expected rules removed, got %v", got)
+	}
+	r.Route(ctx, "chat1", "user1", "/protect rm go.sum")
+	if !strings.Contains(sender.LastMessage(), "没有这条规则") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package bot
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// startPty is only implemented on Linux, where devbot is deployed.
+func startPty(cmd *exec.Cmd) (*os.File, error) {
+	return nil, errors.New("pty shells are only supported on Linux")
+}
+
+// kill ends the shell process.
+func (sh *shellSession) kill() {
+	sh.cmd.Process.Kill()
+}
@@ -1,79 +1,306 @@
 package bot
 
 import (
+	"errors"
 	"fmt"
 	"sync"
-	"sync/atomic"
 )
 
+// maxQueuedPerChat bounds the number of tasks waiting in one chat's queue.
+const maxQueuedPerChat = 100
+
+// QueueEntry describes a task waiting in a chat's queue.
+type QueueEntry struct {
+	ID     string
+	Urgent bool
+}
+
+type queuedTask struct {
+	QueueEntry
+	run func()
+}
+
+// chatQueue holds one chat's waiting tasks. Urgent tasks run before normal
+// ones; each class is FIFO. Running tasks are never preempted.
+type chatQueue struct {
+	urgent  []queuedTask
+	normal  []queuedTask
+	running int
+}
+
+func (c *chatQueue) waiting() int {
+	return len(c.urgent) + len(c.normal)
+}
+
+// pending counts waiting tasks plus the running ones.
+func (c *chatQueue) pending() int {
+	return c.waiting() + c.running
+}
+
+func (c *chatQueue) pop() queuedTask {
+	var t queuedTask
+	if len(c.urgent) > 0 {
+		t, c.urgent = c.urgent[0], c.urgent[1:]
+	} else {
+		t, c.normal = c.normal[0], c.normal[1:]
+	}
+	return t
+}
+
+// MessageQueue schedules tasks from all chats onto a shared worker pool.
+// Chats are served round-robin (chats with urgent work first), so one chat
+// with a long backlog cannot starve the others. Each chat runs at most
+// perChat tasks at once (1 by default, which keeps a chat's tasks in order);
+// workers bounds the tasks running across all chats (0 = unlimited).
 type MessageQueue struct {
-	mu     sync.Mutex
-	queues map[string]chan func()
-	counts map[string]*int32
-	wg     sync.WaitGroup
+	mu         sync.Mutex
+	queues     map[string]*chatQueue
+	ring       []string // chat IDs in round-robin order
+	next       int      // ring index to start the next scan from
+	running    int
+	workers    int
+	perChat    int
+	chatLimits map[string]int
+	draining   bool
+	wg         sync.WaitGroup
 }
 
 func NewMessageQueue() *MessageQueue {
 	return &MessageQueue{
-		queues: make(map[string]chan func()),
-		counts: make(map[string]*int32),
+		queues:  make(map[string]*chatQueue),
+		perChat: 1,
+	}
+}
+
+// SetLimits configures the worker pool: workers bounds the tasks running
+// across all chats (0 = unlimited), perChat bounds each chat's in-flight
+// tasks (values < 1 mean 1), and chatLimits overrides perChat for
+// individual chats.
+func (q *MessageQueue) SetLimits(workers, perChat int, chatLimits map[string]int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if perChat < 1 {
+		perChat = 1
+	}
+	q.workers = workers
+	q.perChat = perChat
+	q.chatLimits = chatLimits
+	q.dispatchLocked()
+}
+
+func (q *MessageQueue) chatLimit(chatID string) int {
+	if n, ok := q.chatLimits[chatID]; ok && n > 0 {
+		return n
 	}
+	return q.perChat
 }
 
 func (q *MessageQueue) Enqueue(chatID string, task func()) error {
+	_, err := q.EnqueueTask(chatID, QueueEntry{}, task)
+	return err
+}
+
+// EnqueueTask queues task for chatID and returns its position within the
+// chat counting the running task (1 means nothing is ahead of it). Urgent
+// entries go ahead of every normal entry but behind earlier urgent ones.
+func (q *MessageQueue) EnqueueTask(chatID string, entry QueueEntry, task func()) (int, error) {
 	q.mu.Lock()
-	ch, ok := q.queues[chatID]
-	cnt := q.counts[chatID]
+	defer q.mu.Unlock()
+	if q.draining {
+		return 0, errors.New("queue is shutting down")
+	}
+	cq, ok := q.queues[chatID]
 	if !ok {
-		ch = make(chan func(), 100)
-		cnt = new(int32)
-		q.counts[chatID] = cnt
-		q.queues[chatID] = ch
-		q.wg.Add(1)
-		go q.worker(cnt, ch)
-	}
-	q.mu.Unlock()
-
-	atomic.AddInt32(cnt, 1)
-	select {
-	case ch <- task:
-		return nil
-	default:
-		atomic.AddInt32(cnt, -1)
-		return fmt.Errorf("queue full for chat %s", chatID)
+		cq = &chatQueue{}
+		q.queues[chatID] = cq
+		q.ring = append(q.ring, chatID)
+	}
+	if cq.waiting() >= maxQueuedPerChat {
+		return 0, fmt.Errorf("queue full for chat %s", chatID)
+	}
+
+	t := queuedTask{QueueEntry: entry, run: task}
+	var pos int
+	if entry.Urgent {
+		cq.urgent = append(cq.urgent, t)
+		pos = len(cq.urgent)
+	} else {
+		cq.normal = append(cq.normal, t)
+		pos = cq.waiting()
+	}
+	pos += cq.running
+
+	q.wg.Add(1)
+	q.dispatchLocked()
+	return pos, nil
+}
+
+// dispatchLocked starts waiting tasks while workers are free. Must be
+// called with q.mu held.
+func (q *MessageQueue) dispatchLocked() {
+	for q.workers <= 0 || q.running < q.workers {
+		chatID, cq := q.pickLocked()
+		if cq == nil {
+			return
+		}
+		t := cq.pop()
+		cq.running++
+		q.running++
+		go q.run(chatID, cq, t)
 	}
 }
 
-func (q *MessageQueue) worker(cnt *int32, ch chan func()) {
+// pickLocked returns the next chat in round-robin order that has waiting
+// work and is under its in-flight limit, preferring chats with urgent tasks.
+func (q *MessageQueue) pickLocked() (string, *chatQueue) {
+	for _, urgentOnly := range []bool{true, false} {
+		for i := 0; i < len(q.ring); i++ {
+			idx := (q.next + i) % len(q.ring)
+			chatID := q.ring[idx]
+			cq := q.queues[chatID]
+			if cq.running >= q.chatLimit(chatID) {
+				continue
+			}
+			if (urgentOnly && len(cq.urgent) > 0) || (!urgentOnly && cq.waiting() > 0) {
+				q.next = idx + 1
+				return chatID, cq
+			}
+		}
+	}
+	return "", nil
+}
+
+func (q *MessageQueue) run(chatID string, cq *chatQueue, t queuedTask) {
 	defer q.wg.Done()
-	for task := range ch {
-		task()
-		atomic.AddInt32(cnt, -1)
+	t.run()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	cq.running--
+	q.running--
+	if cq.pending() == 0 {
+		q.removeLocked(chatID)
+	}
+	q.dispatchLocked()
+}
+
+// removeLocked drops an idle chat from the round-robin ring.
+func (q *MessageQueue) removeLocked(chatID string) {
+	delete(q.queues, chatID)
+	for i, id := range q.ring {
+		if id == chatID {
+			q.ring = append(q.ring[:i], q.ring[i+1:]...)
+			if q.next > i {
+				q.next--
+			}
+			return
+		}
 	}
 }
 
 func (q *MessageQueue) PendingCount(chatID string) int {
 	q.mu.Lock()
-	cnt := q.counts[chatID]
-	q.mu.Unlock()
-	if cnt == nil {
+	defer q.mu.Unlock()
+	cq := q.queues[chatID]
+	if cq == nil {
 		return 0
 	}
-	return int(atomic.LoadInt32(cnt))
+	return cq.pending()
 }
 
-// Shutdown closes all channels and waits for workers to finish in-flight tasks.
-func (q *MessageQueue) Shutdown() {
+// Waiting lists the tasks waiting in chatID's queue in the order they will
+// run. Running tasks are not included.
+func (q *MessageQueue) Waiting(chatID string) []QueueEntry {
 	q.mu.Lock()
-	for _, ch := range q.queues {
-		close(ch)
+	defer q.mu.Unlock()
+	cq := q.queues[chatID]
+	if cq == nil {
+		return nil
+	}
+	out := make([]QueueEntry, 0, cq.waiting())
+	for _, t := range cq.urgent {
+		out = append(out, t.QueueEntry)
+	}
+	for _, t := range cq.normal {
+		out = append(out, t.QueueEntry)
 	}
-	q.mu.Unlock()
+	return out
+}
 
-	q.wg.Wait()
+// Remove takes the waiting task id out of chatID's queue, so it never
+// runs, and reports whether it was there. A task that has started is not
+// affected.
+func (q *MessageQueue) Remove(chatID, id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	cq := q.queues[chatID]
+	if cq == nil || id == "" {
+		return false
+	}
+	for _, list := range []*[]queuedTask{&cq.urgent, &cq.normal} {
+		for i, t := range *list {
+			if t.ID != id {
+				continue
+			}
+			*list = append((*list)[:i:i], (*list)[i+1:]...)
+			q.wg.Done()
+			if cq.pending() == 0 {
+				q.removeLocked(chatID)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// PoolStats reports the tasks running and waiting across all chats, and the
+// worker limit (0 = unlimited).
+func (q *MessageQueue) PoolStats() (running, waiting, workers int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, cq := range q.queues {
+		waiting += cq.waiting()
+	}
+	return q.running, waiting, q.workers
+}
 
+// Snapshot returns the pending task count (including running tasks) for
+// every chat that has work queued.
+func (q *MessageQueue) Snapshot() map[string]int {
 	q.mu.Lock()
-	q.queues = make(map[string]chan func())
-	q.counts = make(map[string]*int32)
-	q.mu.Unlock()
+	defer q.mu.Unlock()
+	out := make(map[string]int)
+	for chatID, cq := range q.queues {
+		if n := cq.pending(); n > 0 {
+			out[chatID] = n
+		}
+	}
+	return out
+}
+
+// Drain removes the tasks still waiting, by chat in the order they would
+// have run, and rejects new ones; running tasks are left to finish. It is
+// the first step of a shutdown that keeps the waiting work for the next
+// start (see Router.SuspendQueue).
+func (q *MessageQueue) Drain() map[string][]QueueEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.draining = true
+	out := make(map[string][]QueueEntry)
+	for chatID, cq := range q.queues {
+		for cq.waiting() > 0 {
+			out[chatID] = append(out[chatID], cq.pop().QueueEntry)
+			q.wg.Done()
+		}
+		if cq.pending() == 0 {
+			q.removeLocked(chatID)
+		}
+	}
+	return out
+}
+
+// Shutdown waits until every queued and running task has finished. The
+// queue stays usable afterwards.
+func (q *MessageQueue) Shutdown() {
+	q.wg.Wait()
 }
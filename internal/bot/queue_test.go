@@ -1,6 +1,7 @@
 package bot
 
 import (
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -174,3 +175,316 @@ func TestQueueEnqueueFull(t *testing.T) {
 
 	close(release)
 }
+
+func TestQueueUrgentJumpsAhead(t *testing.T) {
+	q := NewMessageQueue()
+	defer q.Shutdown()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	if err := q.Enqueue("chat1", func() {
+		close(started)
+		<-release
+	}); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	<-started
+
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) func() {
+		return func() {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+		}
+	}
+	positions := map[string]int{}
+	for _, e := range []QueueEntry{{ID: "n1"}, {ID: "n2"}, {ID: "u1", Urgent: true}, {ID: "u2", Urgent: true}} {
+		pos, err := q.EnqueueTask("chat1", e, record(e.ID))
+		if err != nil {
+			t.Fatalf("EnqueueTask failed: %v", err)
+		}
+		positions[e.ID] = pos
+	}
+	// Positions count the running task.
+	if positions["n1"] != 2 || positions["n2"] != 3 || positions["u1"] != 2 || positions["u2"] != 3 {
+		t.Fatalf("unexpected positions: %v", positions)
+	}
+
+	waiting := q.Waiting("chat1")
+	var ids []string
+	for _, e := range waiting {
+		ids = append(ids, e.ID)
+	}
+	if got := strings.Join(ids, ","); got != "u1,u2,n1,n2" {
+		t.Fatalf("expected waiting order u1,u2,n1,n2, got %s", got)
+	}
+	if !waiting[0].Urgent || waiting[2].Urgent {
+		t.Fatalf("expected urgent flags preserved: %+v", waiting)
+	}
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(order)
+		mu.Unlock()
+		if n == 4 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(order, ","); got != "u1,u2,n1,n2" {
+		t.Fatalf("expected urgent tasks to run first without preempting, got %s", got)
+	}
+}
+
+func TestQueueEnqueueTaskIdlePosition(t *testing.T) {
+	q := NewMessageQueue()
+	defer q.Shutdown()
+
+	done := make(chan struct{})
+	pos, err := q.EnqueueTask("chat1", QueueEntry{ID: "a", Urgent: true}, func() { close(done) })
+	if err != nil || pos != 1 {
+		t.Fatalf("expected position 1 on idle queue, got %d, %v", pos, err)
+	}
+	<-done
+	if w := q.Waiting("chat1"); len(w) != 0 {
+		t.Fatalf("expected nothing waiting, got %+v", w)
+	}
+}
+
+func TestQueueShutdownDrainsPending(t *testing.T) {
+	q := NewMessageQueue()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	q.Enqueue("chat1", func() {
+		close(started)
+		<-release
+	})
+	<-started
+	var ran int32
+	for i := 0; i < 3; i++ {
+		q.Enqueue("chat1", func() { atomic.AddInt32(&ran, 1) })
+	}
+	close(release)
+	q.Shutdown()
+	if atomic.LoadInt32(&ran) != 3 {
+		t.Fatalf("expected all queued tasks to run before Shutdown returns, got %d", ran)
+	}
+}
+
+// waitFor polls cond until it holds or the deadline passes.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestQueueRoundRobinAcrossChats(t *testing.T) {
+	q := NewMessageQueue()
+	q.SetLimits(1, 1, nil)
+	defer q.Shutdown()
+
+	// Hold the single worker so everything below queues up.
+	started := make(chan struct{})
+	release := make(chan struct{})
+	q.Enqueue("busy", func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) func() {
+		return func() {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+		}
+	}
+	for i := 0; i < 5; i++ {
+		q.Enqueue("busy", record("busy"))
+	}
+	q.Enqueue("quiet", record("quiet"))
+	q.Enqueue("other", record("other"))
+
+	close(release)
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(order) == 7
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	// The chats that enqueued one task each run before busy's backlog
+	// instead of waiting behind all of it.
+	if got := strings.Join(order, ","); got != "quiet,other,busy,busy,busy,busy,busy" {
+		t.Fatalf("expected round-robin across chats, got %s", got)
+	}
+}
+
+func TestQueueWorkerLimit(t *testing.T) {
+	q := NewMessageQueue()
+	q.SetLimits(2, 1, nil)
+	defer q.Shutdown()
+
+	var running, peak int32
+	release := make(chan struct{})
+	for _, chat := range []string{"a", "b", "c", "d"} {
+		q.Enqueue(chat, func() {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			<-release
+			atomic.AddInt32(&running, -1)
+		})
+	}
+	waitFor(t, func() bool { return atomic.LoadInt32(&running) == 2 })
+	if r, w, workers := q.PoolStats(); r != 2 || w != 2 || workers != 2 {
+		t.Fatalf("expected 2 running / 2 waiting / 2 workers, got %d/%d/%d", r, w, workers)
+	}
+	close(release)
+	q.Shutdown()
+	if peak != 2 {
+		t.Fatalf("expected at most 2 concurrent tasks, peak was %d", peak)
+	}
+}
+
+func TestQueueChatLimitOverride(t *testing.T) {
+	q := NewMessageQueue()
+	q.SetLimits(0, 1, map[string]int{"parallel": 3})
+	defer q.Shutdown()
+
+	var running int32
+	release := make(chan struct{})
+	block := func() {
+		atomic.AddInt32(&running, 1)
+		<-release
+	}
+	for i := 0; i < 3; i++ {
+		q.Enqueue("parallel", block)
+	}
+	q.Enqueue("serial", block)
+	q.Enqueue("serial", block)
+
+	waitFor(t, func() bool { return atomic.LoadInt32(&running) == 4 })
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&running); n != 4 {
+		t.Fatalf("expected 3 parallel + 1 serial running, got %d", n)
+	}
+	if n := q.PendingCount("serial"); n != 2 {
+		t.Fatalf("expected serial chat to have 1 running + 1 waiting, got %d", n)
+	}
+	close(release)
+}
+
+func TestQueueUrgentFirstAcrossChats(t *testing.T) {
+	q := NewMessageQueue()
+	q.SetLimits(1, 1, nil)
+	defer q.Shutdown()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	q.Enqueue("a", func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	var mu sync.Mutex
+	var order []string
+	q.Enqueue("b", func() { mu.Lock(); order = append(order, "b"); mu.Unlock() })
+	q.EnqueueTask("c", QueueEntry{ID: "u", Urgent: true}, func() { mu.Lock(); order = append(order, "c-urgent"); mu.Unlock() })
+
+	close(release)
+	waitFor(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(order) == 2 })
+	if order[0] != "c-urgent" {
+		t.Fatalf("expected urgent task from another chat to run first, got %v", order)
+	}
+}
+
+func TestQueueDrain(t *testing.T) {
+	q := NewMessageQueue()
+	started := make(chan struct{})
+	done := make(chan struct{})
+	q.EnqueueTask("chat1", QueueEntry{ID: "running"}, func() {
+		close(started)
+		<-done
+	})
+	<-started
+	ran := make(chan string, 3)
+	q.EnqueueTask("chat1", QueueEntry{ID: "a"}, func() { ran <- "a" })
+	q.EnqueueTask("chat1", QueueEntry{ID: "b", Urgent: true}, func() { ran <- "b" })
+
+	drained := q.Drain()
+	if got := drained["chat1"]; len(got) != 2 || got[0].ID != "b" || !got[0].Urgent || got[1].ID != "a" {
+		t.Fatalf("unexpected drained tasks %+v", drained)
+	}
+	if _, err := q.EnqueueTask("chat2", QueueEntry{ID: "c"}, func() { ran <- "c" }); err == nil {
+		t.Fatal("expected new tasks to be rejected while draining")
+	}
+	if n := q.PendingCount("chat1"); n != 1 {
+		t.Fatalf("expected only the running task left, got %d", n)
+	}
+
+	close(done)
+	q.Shutdown()
+	close(ran)
+	for id := range ran {
+		t.Errorf("drained task %s ran", id)
+	}
+}
+
+func TestQueueRemove(t *testing.T) {
+	q := NewMessageQueue()
+	started := make(chan struct{})
+	done := make(chan struct{})
+	q.EnqueueTask("chat1", QueueEntry{ID: "running"}, func() {
+		close(started)
+		<-done
+	})
+	<-started
+	ran := make(chan string, 3)
+	q.EnqueueTask("chat1", QueueEntry{ID: "a"}, func() { ran <- "a" })
+	q.EnqueueTask("chat1", QueueEntry{ID: "b", Urgent: true}, func() { ran <- "b" })
+	q.EnqueueTask("chat1", QueueEntry{ID: "c"}, func() { ran <- "c" })
+
+	if q.Remove("chat1", "running") {
+		t.Fatal("a running task cannot be removed")
+	}
+	if !q.Remove("chat1", "b") || !q.Remove("chat1", "a") {
+		t.Fatal("expected waiting tasks to be removed")
+	}
+	if q.Remove("chat1", "a") || q.Remove("chat2", "c") {
+		t.Fatal("expected unknown tasks not to be removed")
+	}
+	if got := q.Waiting("chat1"); len(got) != 1 || got[0].ID != "c" {
+		t.Fatalf("unexpected waiting tasks %+v", got)
+	}
+
+	close(done)
+	q.Shutdown()
+	close(ran)
+	var got []string
+	for id := range ran {
+		got = append(got, id)
+	}
+	if len(got) != 1 || got[0] != "c" {
+		t.Fatalf("expected only c to run, got %v", got)
+	}
+}
@@ -0,0 +1,159 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// receiptLine is the footer of a card that belongs to an execution.
+func receiptLine(id string) string {
+	return "执行 ID: " + id
+}
+
+// killable returns a context for running execution id that /kill <id>
+// cancels without touching the chat's other runs. The caller must call
+// the returned cancel when the run ends; clearActive forgets it.
+func (r *Router) killable(ctx context.Context, id string) (context.Context, context.CancelFunc) {
+	runCtx, cancel := context.WithCancel(ctx)
+	r.mu.Lock()
+	r.kills[id] = cancel
+	r.mu.Unlock()
+	return runCtx, cancel
+}
+
+// killExec answers /kill <id>: it stops that execution if it is running,
+// takes it out of the queue if it is waiting, and otherwise says where the
+// ID stands. Admins may stop other chats' executions too.
+func (r *Router) killExec(ctx context.Context, chatID, id string) {
+	r.mu.Lock()
+	active, running := r.active[id]
+	kill := r.kills[id]
+	_, waiting := r.queued[id]
+	r.mu.Unlock()
+	running = running && r.canManageExec(ctx, chatID, active.ChatID)
+	switch {
+	case running && kill != nil:
+		kill()
+		// A run paused for a deletion only notices once it is denied.
+		r.resolveDelete(active.ChatID, false)
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已终止执行 %s。", id))
+		if active.ChatID != chatID {
+			r.sender.SendText(ctx, active.ChatID, fmt.Sprintf("执行 %s 已被管理员终止。", id))
+		}
+	case running:
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("执行 %s 不能单独终止，请使用 /kill 终止当前任务。", id))
+	case waiting:
+		r.dequeueExec(ctx, chatID, id)
+	default:
+		if rec, ok := r.store.ExecRecord(id); ok && r.canManageExec(ctx, chatID, rec.ChatID) {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("执行 %s 已结束，无需终止。", id))
+			return
+		}
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("未找到执行: %s", id))
+	}
+}
+
+// execOutput answers /output <id> for an execution ID: the whole output
+// (or error) of that run, as a file.
+func (r *Router) execOutput(ctx context.Context, chatID, id string) bool {
+	rec, ok := r.store.ExecRecord(id)
+	if !ok || rec.ChatID != chatID {
+		return false
+	}
+	text := rec.Output
+	if rec.Error != "" {
+		text = strings.TrimSpace(rec.Output + "\n\n错误: " + rec.Error)
+	}
+	if text == "" {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("执行 %s 没有输出。", id))
+		return true
+	}
+	r.sendFile(ctx, chatID, fmt.Sprintf("output-%s.txt", id), []byte(text))
+	return true
+}
+
+// cmdTrace shows everything recorded about one execution of the chat,
+// whether it is waiting, running or done.
+func (r *Router) cmdTrace(ctx context.Context, chatID, args string) {
+	id := strings.TrimSpace(args)
+	if id == "" {
+		r.sender.SendText(ctx, chatID, "用法: /trace <执行ID>\n查看一次执行的详情。执行 ID 显示在结果卡片底部，也可用 /history 查找。")
+		return
+	}
+	r.mu.Lock()
+	active, running := r.active[id]
+	queued, waiting := r.queued[id]
+	r.mu.Unlock()
+	running = running && active.ChatID == chatID
+	waiting = waiting && queued.ChatID == chatID
+
+	var rec ExecRecord
+	var status string
+	switch {
+	case running:
+		rec = active
+		status = fmt.Sprintf("⏳ 执行中（已 %s）", time.Since(rec.StartedAt).Truncate(time.Second))
+	case waiting:
+		rec = queued
+		status = fmt.Sprintf("🕒 排队中（已等待 %s）", time.Since(rec.StartedAt).Truncate(time.Second))
+	default:
+		stored, ok := r.store.ExecRecord(id)
+		if !ok || stored.ChatID != chatID {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("未找到执行: %s", id))
+			return
+		}
+		rec = stored
+		status = fmt.Sprintf("✓ 完成（耗时 %s）", rec.Duration.Truncate(time.Second))
+		if rec.Error != "" {
+			status = fmt.Sprintf("✗ 出错（耗时 %s）", rec.Duration.Truncate(time.Second))
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**状态:** %s\n", status)
+	fmt.Fprintf(&sb, "**开始:** %s\n", rec.StartedAt.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&sb, "**工作目录:** %s\n", orDash(rec.WorkDir))
+	fmt.Fprintf(&sb, "**会话:** %s\n", orDash(rec.SessionID))
+	fmt.Fprintf(&sb, "**模型:** %s · **模式:** %s · **CLI:** %s\n", orDash(rec.Model), orDash(rec.PermissionMode), orDash(rec.CLIVersion))
+	if rec.GitHead != "" {
+		fmt.Fprintf(&sb, "**提交:** `%s`\n", shortHash(rec.GitHead))
+	}
+	if rec.Urgent {
+		sb.WriteString("**紧急:** 是\n")
+	}
+	if rec.ReproOf != "" {
+		fmt.Fprintf(&sb, "**复现自:** `%s`\n", rec.ReproOf)
+	}
+	if rec.Template != "" {
+		fmt.Fprintf(&sb, "**模板:** %s\n", rec.Template)
+	}
+	if len(rec.Labels) > 0 {
+		fmt.Fprintf(&sb, "**标签:** %s\n", strings.Join(rec.Labels, ", "))
+	}
+	if rec.Rating != "" || rec.Feedback != "" {
+		feedback := rec.Feedback
+		if rec.Rating != "" {
+			feedback = strings.TrimSpace(ratingEmoji(rec.Rating) + " " + feedback)
+		}
+		fmt.Fprintf(&sb, "**反馈:** %s\n", feedback)
+	}
+	fmt.Fprintf(&sb, "\n**Prompt:**\n%s\n", truncateRunes(rec.Prompt, 500))
+	if rec.Error != "" {
+		fmt.Fprintf(&sb, "\n**错误:**\n%s\n", truncateRunes(rec.Error, 500))
+	} else if rec.Output != "" {
+		fmt.Fprintf(&sb, "\n**输出:** %d 字符（`/output %s` 获取全文）\n", len([]rune(rec.Output)), id)
+	}
+	switch {
+	case waiting:
+		// Nothing to do with it until it starts.
+	case running:
+		fmt.Fprintf(&sb, "\n`/kill %s` 终止", id)
+	case rec.GitHead != "":
+		fmt.Fprintf(&sb, "\n`/repro %s` 复现 · `/feedback %s up|down` 评价", id, id)
+	default:
+		fmt.Fprintf(&sb, "\n`/feedback %s up|down` 评价", id)
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: "执行详情 " + id, Content: sb.String(), Receipt: id})
+}
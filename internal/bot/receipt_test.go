@@ -0,0 +1,155 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildCardBody_Receipt(t *testing.T) {
+	body := buildCardBody(CardMsg{Content: "done", Receipt: "ab12cd34"})
+	elements := body["elements"].([]map[string]interface{})
+	last := elements[len(elements)-1]
+	if last["tag"] != "note" {
+		t.Fatalf("expected a note element last, got %v", elements)
+	}
+	note := last["elements"].([]map[string]interface{})
+	if note[0]["content"] != "执行 ID: ab12cd34" {
+		t.Fatalf("unexpected receipt: %v", note)
+	}
+
+	body = buildCardBody(CardMsg{Content: "plain"})
+	if n := len(body["elements"].([]map[string]interface{})); n != 1 {
+		t.Fatalf("expected no note without a receipt, got %d elements", n)
+	}
+}
+
+func TestExecClaude_CardsCarryReceipt(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "claude")
+	os.WriteFile(script, []byte("#!/bin/sh\necho '{\"type\":\"result\",\"result\":\"all good\",\"session_id\":\"s1\"}'\n"), 0755)
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	sender := &cardSpySender{}
+	r := NewRouter(context.Background(), NewClaudeExecutor(script, "sonnet", 10*time.Second), store, sender, map[string]bool{"user1": true}, dir, nil)
+
+	r.Route(context.Background(), "chat1", "user1", "hello")
+
+	recs := store.ExecRecords("chat1", 1)
+	if len(recs) != 1 {
+		t.Fatalf("expected an exec record, got %d", len(recs))
+	}
+	if len(sender.cards) == 0 {
+		t.Fatal("expected a result card")
+	}
+	if got := sender.cards[0].Receipt; got != recs[0].ID {
+		t.Fatalf("expected receipt %q on the result card, got %q", recs[0].ID, got)
+	}
+}
+
+func TestKill_ByID(t *testing.T) {
+	dir := t.TempDir()
+	readyPath := filepath.Join(dir, "ready")
+	script := filepath.Join(dir, "claude")
+	os.WriteFile(script, []byte(fmt.Sprintf("#!/bin/sh\ntouch %s\nexec sleep 10000\n", readyPath)), 0755)
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	snd := &syncSpySender{}
+	r := NewRouter(context.Background(), NewClaudeExecutor(script, "sonnet", 60*time.Second), store, snd, map[string]bool{"user1": true}, dir, nil)
+
+	ctx := context.Background()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.Route(ctx, "chat1", "user1", "run a long task")
+	}()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(readyPath); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	active := r.ActiveExecs()
+	if len(active) != 1 {
+		t.Fatalf("expected one running execution, got %v", active)
+	}
+	id := active[0].ID
+
+	// Another chat cannot stop it.
+	r.Route(ctx, "chat2", "user1", "/kill "+id)
+	if msgs := snd.Messages(); !strings.Contains(msgs[len(msgs)-1], "未找到执行") {
+		t.Fatalf("expected other chat to be refused, got %v", msgs)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/kill "+id)
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the run to end after /kill <id>")
+	}
+	msgs := strings.Join(snd.Messages(), "\n")
+	if !strings.Contains(msgs, "已终止执行 "+id) {
+		t.Fatalf("expected kill confirmation, got %q", msgs)
+	}
+	if strings.Contains(msgs, "执行出错") {
+		t.Fatalf("a killed run should not report an error card, got %q", msgs)
+	}
+	rec, ok := store.ExecRecord(id)
+	if !ok || !strings.HasPrefix(rec.Error, "killed") {
+		t.Fatalf("expected a killed record, got %+v", rec)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/kill "+id)
+	if msgs := snd.Messages(); !strings.Contains(msgs[len(msgs)-1], "已结束") {
+		t.Fatalf("expected finished notice, got %v", msgs)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	r, sender := newTestRouter(t)
+	ctx := context.Background()
+	r.store.AddExecRecord(ExecRecord{ID: "ab12", ChatID: "chat1", Prompt: "fix the build", Output: "fixed", StartedAt: time.Now(), Duration: 3 * time.Second, Model: "opus", GitHead: "0123456789abcdef", Rating: ratingUp})
+	r.store.AddExecRecord(ExecRecord{ID: "cd34", ChatID: "chat2", Prompt: "secret", StartedAt: time.Now()})
+
+	r.Route(ctx, "chat1", "user1", "/trace ab12")
+	msg := sender.LastMessage()
+	for _, want := range []string{"执行详情 ab12", "✓ 完成（耗时 3s）", "opus", "0123456", "fix the build", "👍", "/output ab12", "/repro ab12"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected %q in trace, got %q", want, msg)
+		}
+	}
+
+	r.Route(ctx, "chat1", "user1", "/trace cd34")
+	if !strings.Contains(sender.LastMessage(), "未找到执行") {
+		t.Fatalf("expected another chat's record to be hidden, got %q", sender.LastMessage())
+	}
+
+	r.setQueued(ExecRecord{ID: "ef56", ChatID: "chat1", Prompt: "later", StartedAt: time.Now()})
+	r.Route(ctx, "chat1", "user1", "/trace ef56")
+	if !strings.Contains(sender.LastMessage(), "排队中") {
+		t.Fatalf("expected queued status, got %q", sender.LastMessage())
+	}
+}
+
+func TestOutput_ExecID(t *testing.T) {
+	r, sender := newTestRouter(t)
+	ctx := context.Background()
+	r.store.AddExecRecord(ExecRecord{ID: "ab12", ChatID: "chat1", Prompt: "p", Output: "the whole answer", StartedAt: time.Now()})
+	r.store.AddExecRecord(ExecRecord{ID: "cd34", ChatID: "chat1", Prompt: "p", Error: "exit status 1", StartedAt: time.Now()})
+
+	r.Route(ctx, "chat1", "user1", "/output ab12")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "output-ab12.txt") || !strings.Contains(msg, "the whole answer") {
+		t.Fatalf("expected the execution output, got %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "/output cd34")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "exit status 1") {
+		t.Fatalf("expected the execution error, got %q", msg)
+	}
+	r.Route(ctx, "chat2", "user1", "/output ab12")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "找不到输出") {
+		t.Fatalf("expected another chat to be refused, got %q", msg)
+	}
+}
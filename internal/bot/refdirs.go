@@ -0,0 +1,175 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// SetReferenceDirs sets the reference directories, by name, that /file,
+// /head, /tail, /grep --ref and Claude may read. They may live outside the
+// work root. Writes are refused by path (see referenceDirArgs and
+// shellTouchesReferenceDir), which does not stop every way a shell command
+// can reach a directory; only a read-only mount makes them truly read-only.
+func (r *Router) SetReferenceDirs(dirs map[string]string) {
+	r.refDirs = make(map[string]string, len(dirs))
+	for name, dir := range dirs {
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = real
+		}
+		r.refDirs[name] = filepath.Clean(dir)
+	}
+}
+
+// referenceDirOf returns the name of the reference directory containing
+// path, if any.
+func (r *Router) referenceDirOf(path string) (string, bool) {
+	for name, dir := range r.refDirs {
+		if underRoot(dir, path) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// referencePath resolves query to a file in a reference directory: an
+// absolute path inside one, or "<name>/<path>". A symlink leading out of
+// the directory is not followed.
+func (r *Router) referencePath(query string) string {
+	var path string
+	if filepath.IsAbs(query) {
+		path = filepath.Clean(query)
+	} else {
+		name, rest, _ := strings.Cut(filepath.ToSlash(query), "/")
+		dir, ok := r.refDirs[name]
+		if !ok {
+			return ""
+		}
+		path = filepath.Join(dir, rest)
+	}
+	if _, ok := r.referenceDirOf(path); !ok {
+		return ""
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return ""
+	}
+	if _, ok := r.referenceDirOf(real); !ok {
+		return ""
+	}
+	return path
+}
+
+// readablePath resolves a path given to a read-only command: a file in
+// workDir, then one in a reference directory, then a fuzzy match in
+// workDir.
+func (r *Router) readablePath(workDir, query string) string {
+	if !filepath.IsAbs(query) {
+		if exact := filepath.Join(workDir, query); fileExists(exact) {
+			return filepath.Clean(exact)
+		}
+	}
+	if path := r.referencePath(query); path != "" {
+		return path
+	}
+	return findFile(workDir, query)
+}
+
+// shellTouchesReferenceDir returns the name of a reference directory a
+// shell command run in dir would touch: dir is inside one, or the command
+// names one's path. /exec, /shell and /foreach refuse such commands.
+func (r *Router) shellTouchesReferenceDir(dir, command string) (string, bool) {
+	if name, ok := r.referenceDirOf(dir); ok {
+		return name, true
+	}
+	for _, name := range sortedKeys(r.refDirs) {
+		if strings.Contains(command, r.refDirs[name]) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// grepReferenceDirs runs /grep over every reference directory, naming
+// matches "<name>/<path>:<line>:<text>".
+func (r *Router) grepReferenceDirs(ctx context.Context, pattern string) string {
+	var out []string
+	for _, name := range sortedKeys(r.refDirs) {
+		for _, line := range strings.Split(grepIn(ctx, r.refDirs[name], pattern), "\n") {
+			if line != "" {
+				out = append(out, name+"/"+strings.TrimPrefix(line, "./"))
+			}
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+type referenceDirsKey struct{}
+
+// withReferenceDirs tells the local Claude executor to give the CLI read
+// access to the router's reference directories while denying its editing
+// tools there.
+func (r *Router) withReferenceDirs(ctx context.Context) context.Context {
+	if len(r.refDirs) == 0 {
+		return ctx
+	}
+	dirs := make([]string, 0, len(r.refDirs))
+	for _, name := range sortedKeys(r.refDirs) {
+		dirs = append(dirs, r.refDirs[name])
+	}
+	return withReferenceDirPaths(ctx, dirs)
+}
+
+// withReferenceDirPaths sets the reference directories directly; the
+// execution backend uses it for the ones the frontend sends.
+func withReferenceDirPaths(ctx context.Context, dirs []string) context.Context {
+	if len(dirs) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, referenceDirsKey{}, dirs)
+}
+
+// referenceDirsFrom returns the reference directories set on ctx.
+func referenceDirsFrom(ctx context.Context) []string {
+	dirs, _ := ctx.Value(referenceDirsKey{}).([]string)
+	return dirs
+}
+
+// referenceDirArgs returns the claude CLI arguments for the reference
+// directories set by withReferenceDirs: --add-dir for each, and
+// --disallowedTools rules that keep the file editing tools out of them and
+// deny Bash commands naming them, so Claude reads them with Read, Grep and
+// Glob. Permission deny rules apply in every mode, including yolo.
+func referenceDirArgs(ctx context.Context) []string {
+	dirs := referenceDirsFrom(ctx)
+	if len(dirs) == 0 {
+		return nil
+	}
+	var args, rules []string
+	for _, dir := range dirs {
+		args = append(args, "--add-dir", dir)
+		// "//" marks an absolute path in permission rules.
+		pattern := "/" + filepath.ToSlash(dir) + "/**"
+		for _, tool := range []string{"Edit", "Write", "MultiEdit", "NotebookEdit"} {
+			rules = append(rules, fmt.Sprintf("%s(%s)", tool, pattern))
+		}
+		rules = append(rules, fmt.Sprintf("Bash(*%s*)", filepath.ToSlash(dir)))
+	}
+	return append(append(args, "--disallowedTools"), rules...)
+}
+
+// withReferenceContext tells a new Claude session about the reference
+// directories.
+func (r *Router) withReferenceContext(prompt string) string {
+	if len(r.refDirs) == 0 {
+		return prompt
+	}
+	var sb strings.Builder
+	sb.WriteString("[devbot 只读参考目录]\n")
+	for _, name := range sortedKeys(r.refDirs) {
+		fmt.Fprintf(&sb, "- %s: %s\n", name, r.refDirs[name])
+	}
+	sb.WriteString("这些目录可以用 Read、Grep、Glob 读取和搜索，但不要修改其中的任何文件（编辑工具和涉及这些路径的 Bash 命令会被拒绝）。\n[/devbot 只读参考目录]\n\n")
+	return sb.String() + prompt
+}
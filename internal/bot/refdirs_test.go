@@ -0,0 +1,132 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newRefDirRouter returns a test router with a "proto" reference directory
+// outside its work root holding api.proto.
+func newRefDirRouter(t *testing.T) (*Router, *spySender, string) {
+	t.Helper()
+	r, sender := newTestRouter(t)
+	proto := t.TempDir()
+	os.WriteFile(filepath.Join(proto, "api.proto"), []byte("syntax = \"proto3\";\nmessage User {}\n"), 0644)
+	r.SetReferenceDirs(map[string]string{"proto": proto})
+	return r, sender, r.refDirs["proto"]
+}
+
+func TestRouterFile_ReferenceDir(t *testing.T) {
+	r, sender, proto := newRefDirRouter(t)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "/file proto/api.proto")
+	if !strings.Contains(sender.LastMessage(), "message User") {
+		t.Fatalf("expected the reference file, got %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "user1", "/file "+filepath.Join(proto, "api.proto")+":1-1")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "proto3") || strings.Contains(msg, "message User") {
+		t.Fatalf("expected line 1 by absolute path, got %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "/head proto/api.proto 1")
+	if !strings.Contains(sender.LastMessage(), "proto3") {
+		t.Fatalf("expected /head to read the reference file, got %q", sender.LastMessage())
+	}
+
+	// A symlink leading out of the reference directory is not followed.
+	secret := filepath.Join(t.TempDir(), "secret.txt")
+	os.WriteFile(secret, []byte("top secret"), 0644)
+	os.Symlink(secret, filepath.Join(proto, "leak.txt"))
+	r.Route(ctx, "chat1", "user1", "/file proto/leak.txt")
+	if !strings.Contains(sender.LastMessage(), "文件不存在") {
+		t.Fatalf("expected the escaping symlink refused, got %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "user1", "/file "+secret)
+	if !strings.Contains(sender.LastMessage(), "文件不存在") {
+		t.Fatalf("expected an absolute path outside the reference dirs refused, got %q", sender.LastMessage())
+	}
+}
+
+func TestRouterGrep_ReferenceDirs(t *testing.T) {
+	r, sender, _ := newRefDirRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/grep --ref message User")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "proto/api.proto:2:message User {}") {
+		t.Fatalf("expected a match named by reference dir, got %q", msg)
+	}
+
+	r2, sender2 := newTestRouter(t)
+	r2.Route(context.Background(), "chat1", "user1", "/grep --ref message")
+	if !strings.Contains(sender2.LastMessage(), "没有配置只读参考目录") {
+		t.Fatalf("unexpected reply %q", sender2.LastMessage())
+	}
+}
+
+func TestRouterWrite_RefusesReferenceDir(t *testing.T) {
+	r, sender := newTestRouter(t)
+	shared := filepath.Join(r.store.WorkRoot(), "shared")
+	os.MkdirAll(shared, 0755)
+	r.SetReferenceDirs(map[string]string{"shared": shared})
+
+	r.Route(context.Background(), "chat1", "user1", "/write shared/a.txt\nhello")
+	if !strings.Contains(sender.LastMessage(), "只读参考目录 shared") {
+		t.Fatalf("expected the write refused, got %q", sender.LastMessage())
+	}
+	if _, err := os.Stat(filepath.Join(shared, "a.txt")); err == nil {
+		t.Fatal("file written into a reference directory")
+	}
+}
+
+func TestRouterExec_RefusesReferenceDir(t *testing.T) {
+	r, sender, proto := newRefDirRouter(t)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "/exec rm -rf "+proto+"/api.proto")
+	if !strings.Contains(sender.LastMessage(), "只读参考目录 proto") {
+		t.Fatalf("expected /exec refused, got %q", sender.LastMessage())
+	}
+	os.MkdirAll(filepath.Join(r.store.WorkRoot(), "svc"), 0755)
+	r.Route(ctx, "chat1", "user1", "/foreach svc /exec rm "+proto+"/api.proto")
+	if !strings.Contains(sender.LastMessage(), "只读参考目录 proto") {
+		t.Fatalf("expected /foreach refused, got %q", sender.LastMessage())
+	}
+	if !fileExists(filepath.Join(proto, "api.proto")) {
+		t.Fatal("a reference file was removed")
+	}
+}
+
+func TestReferenceDirArgs(t *testing.T) {
+	if args := referenceDirArgs(context.Background()); args != nil {
+		t.Fatalf("expected no args without reference dirs, got %v", args)
+	}
+	r := &Router{}
+	r.SetReferenceDirs(map[string]string{"proto": "/srv/proto"})
+	got := strings.Join(referenceDirArgs(r.withReferenceDirs(context.Background())), " ")
+	want := "--add-dir /srv/proto --disallowedTools Edit(//srv/proto/**) Write(//srv/proto/**) MultiEdit(//srv/proto/**) NotebookEdit(//srv/proto/**) Bash(*/srv/proto*)"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestRouterPrompt_ReferenceDirs(t *testing.T) {
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	claude := filepath.Join(dir, "claude")
+	os.WriteFile(claude, []byte("#!/bin/sh\nprintf '%s\\n---\\n%s' \"$*\" \"$(cat)\" > "+argsFile+"\necho '{\"type\":\"result\",\"result\":\"ok\",\"session_id\":\"s1\"}'\n"), 0755)
+	r, _ := newAckRouter(t, claude)
+	proto := t.TempDir()
+	r.SetReferenceDirs(map[string]string{"proto": proto})
+	proto = r.refDirs["proto"]
+
+	r.Route(context.Background(), "chat1", "user1", "read the user message definition")
+	data, _ := os.ReadFile(argsFile)
+	got := string(data)
+	if !strings.Contains(got, "--add-dir "+proto) || !strings.Contains(got, "Write(/"+proto+"/**)") {
+		t.Fatalf("expected reference dir args, got %q", got)
+	}
+	if !strings.Contains(got, "[devbot 只读参考目录]\n- proto: "+proto) {
+		t.Fatalf("expected the reference dirs in the prompt, got %q", got)
+	}
+}
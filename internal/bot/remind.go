@@ -0,0 +1,328 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// reminderCheckInterval is how often due reminders are looked for.
+	reminderCheckInterval = 30 * time.Second
+	// reminderEventLength is how long the calendar events of reminders are.
+	reminderEventLength = 15 * time.Minute
+	// reminderLate is how overdue a reminder must be, e.g. after the bot
+	// was down, to be marked as late when it fires.
+	reminderLate = 5 * time.Minute
+	// defaultRemindHour is the time of reminders given only a day.
+	defaultRemindHour = 9
+)
+
+var (
+	remindDateRe  = regexp.MustCompile(`^(?:(\d{4})-)?(\d{1,2})-(\d{1,2})$`)
+	remindClockRe = regexp.MustCompile(`^(上午|早上|中午|下午|晚上)?(\d{1,2})(?::(\d{2})|点(?:(半)|(\d{1,2})分?)?)?(am|pm)?$`)
+	remindAfterRe = regexp.MustCompile(`^(\d+)(m|mins?|minutes?|分钟|h|hours?|小时|d|days?|天)$`)
+)
+
+// remindDays are the day words a reminder time may start with.
+var remindDays = []struct {
+	word   string
+	offset int
+}{{"today", 0}, {"今天", 0}, {"tomorrow", 1}, {"明天", 1}, {"后天", 2}}
+
+// SetCalendar makes /remind add its reminders to the shared calendar
+// calendarID.
+func (r *Router) SetCalendar(cal Calendar, calendarID string) {
+	r.calendar = cal
+	r.calendarID = calendarID
+}
+
+// parseRemindAfter parses relative times such as "in 30m", "2h later",
+// "2小时后" and "in 1h30m".
+func parseRemindAfter(s string) (time.Duration, bool) {
+	s = strings.TrimSpace(strings.TrimPrefix(s, "in "))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "later"), "后")
+	s = strings.ReplaceAll(s, " ", "")
+	if m := remindAfterRe.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		switch m[2] {
+		case "h", "hour", "hours", "小时":
+			return time.Duration(n) * time.Hour, true
+		case "d", "day", "days", "天":
+			return time.Duration(n) * 24 * time.Hour, true
+		}
+		return time.Duration(n) * time.Minute, true
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d, true
+	}
+	return 0, false
+}
+
+// parseRemindClock parses a time of day such as "10am", "3:30pm", "15:04",
+// "10点", "下午3点半".
+func parseRemindClock(s string) (hour, minute int, ok bool) {
+	m := remindClockRe.FindStringSubmatch(s)
+	if m == nil || (m[1] == "" && m[3] == "" && m[6] == "" && !strings.Contains(s, "点")) {
+		return 0, 0, false
+	}
+	hour, _ = strconv.Atoi(m[2])
+	switch {
+	case m[3] != "":
+		minute, _ = strconv.Atoi(m[3])
+	case m[4] != "":
+		minute = 30
+	case m[5] != "":
+		minute, _ = strconv.Atoi(m[5])
+	}
+	switch {
+	case (m[6] == "pm" || m[1] == "下午" || m[1] == "晚上") && hour < 12:
+		hour += 12
+	case m[1] == "中午" && hour < 11:
+		hour += 12
+	case m[6] == "am" && hour == 12:
+		hour = 0
+	}
+	if hour > 23 || minute > 59 {
+		return 0, 0, false
+	}
+	return hour, minute, true
+}
+
+// parseRemindTime parses when a reminder is due, relative to now: a
+// relative time ("in 30m", "2小时后"), a day ("tomorrow", "明天",
+// "2026-03-01", "03-01") at 9:00 or at a time of day, or a time of day
+// alone, which means its next occurrence.
+func parseRemindTime(expr string, now time.Time) (time.Time, error) {
+	s := strings.ToLower(strings.Join(strings.Fields(expr), " "))
+	if s == "" {
+		return time.Time{}, errors.New("缺少时间")
+	}
+	if d, ok := parseRemindAfter(s); ok {
+		return now.Add(d), nil
+	}
+	year, month, day := now.Date()
+	// noYear is set for "03-01", which means its next occurrence.
+	noYear, hasDay := false, false
+	rest := s
+	for _, d := range remindDays {
+		if after, ok := strings.CutPrefix(s, d.word); ok {
+			year, month, day = now.AddDate(0, 0, d.offset).Date()
+			rest, hasDay = after, true
+			break
+		}
+	}
+	if !hasDay {
+		first, after, _ := strings.Cut(s, " ")
+		if m := remindDateRe.FindStringSubmatch(first); m != nil {
+			if m[1] != "" {
+				year, _ = strconv.Atoi(m[1])
+			} else {
+				noYear = true
+			}
+			mon, _ := strconv.Atoi(m[2])
+			month = time.Month(mon)
+			day, _ = strconv.Atoi(m[3])
+			rest, hasDay = after, true
+		}
+	}
+	hour, minute := defaultRemindHour, 0
+	if rest = strings.ReplaceAll(rest, " ", ""); rest != "" {
+		var ok bool
+		if hour, minute, ok = parseRemindClock(rest); !ok {
+			return time.Time{}, fmt.Errorf("无法识别的时间: %s", expr)
+		}
+	} else if !hasDay {
+		return time.Time{}, fmt.Errorf("无法识别的时间: %s", expr)
+	}
+	at := time.Date(year, month, day, hour, minute, 0, 0, now.Location())
+	if at.Day() != day || at.Month() != month {
+		return time.Time{}, fmt.Errorf("无效的日期: %s", expr)
+	}
+	switch {
+	case !hasDay && !at.After(now):
+		at = at.AddDate(0, 0, 1)
+	case noYear && at.Before(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())):
+		at = at.AddDate(1, 0, 0)
+	}
+	if !at.After(now) {
+		return time.Time{}, fmt.Errorf("%s 已经过去了", formatRemindTime(at))
+	}
+	return at, nil
+}
+
+// splitRemind separates a reminder's text from its time: the text is the
+// quoted part when there is one, and otherwise what follows the longest
+// run of leading words that reads as a time.
+func splitRemind(args string, now time.Time) (string, time.Time, error) {
+	if start := strings.IndexAny(args, "\"“"); start >= 0 {
+		_, size := utf8.DecodeRuneInString(args[start:])
+		rest := args[start+size:]
+		end := strings.IndexAny(rest, "\"”")
+		if end < 0 {
+			return "", time.Time{}, errors.New("引号没有闭合")
+		}
+		_, closeSize := utf8.DecodeRuneInString(rest[end:])
+		at, err := parseRemindTime(args[:start]+" "+rest[end+closeSize:], now)
+		return strings.TrimSpace(rest[:end]), at, err
+	}
+	fields := strings.Fields(args)
+	n := len(fields) - 1
+	if n > 4 {
+		n = 4
+	}
+	for ; n >= 1; n-- {
+		if at, err := parseRemindTime(strings.Join(fields[:n], " "), now); err == nil {
+			return strings.Join(fields[n:], " "), at, nil
+		}
+	}
+	return "", time.Time{}, errors.New("无法识别提醒时间")
+}
+
+// formatRemindTime renders a reminder time as "03-01（周日）10:00".
+func formatRemindTime(t time.Time) string {
+	return fmt.Sprintf("%s（周%s）%s", t.Format("01-02"), []string{"日", "一", "二", "三", "四", "五", "六"}[t.Weekday()], t.Format("15:04"))
+}
+
+const remindUsage = "用法: /remind \"<内容>\" <时间>  如 /remind \"review PR 42\" tomorrow 10am\n" +
+	"       /remind <时间> <内容>  如 /remind 明天10点 看 PR 42\n" +
+	"       /remind -run \"<prompt>\" <时间>  到时让 Claude 执行 prompt\n" +
+	"       /remind list | rm <ID>\n" +
+	"时间: 10am、15:30、下午3点半、明天 10点、2026-03-01 14:00、in 30m、2小时后"
+
+// cmdRemind sets, lists and cancels the chat's reminders and scheduled
+// runs.
+func (r *Router) cmdRemind(ctx context.Context, chatID, args string) {
+	args = strings.TrimSpace(args)
+	fields := strings.Fields(args)
+	if len(fields) == 0 || fields[0] == "list" {
+		r.remindList(ctx, chatID)
+		return
+	}
+	if fields[0] == "rm" {
+		if len(fields) != 2 {
+			r.sender.SendText(ctx, chatID, "用法: /remind rm <ID>")
+			return
+		}
+		rem, ok := r.store.RemoveReminder(chatID, fields[1])
+		if !ok {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("没有提醒 %s", fields[1]))
+			return
+		}
+		r.save()
+		if rem.EventID != "" && r.calendar != nil {
+			if err := r.calendar.DeleteEvent(ctx, r.calendarID, rem.EventID); err != nil {
+				slog.Warn("remind: delete event failed", "event", rem.EventID, "err", err)
+			}
+		}
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已取消提醒 %s", rem.ID))
+		return
+	}
+	run := false
+	if after, ok := strings.CutPrefix(args, "-run "); ok {
+		run, args = true, strings.TrimSpace(after)
+	}
+	now := time.Now()
+	text, at, err := splitRemind(args, now)
+	if err == nil && text == "" {
+		err = errors.New("缺少提醒内容")
+	}
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("%v\n%s", err, remindUsage))
+		return
+	}
+	rem := Reminder{ID: newExecID(), ChatID: chatID, Text: text, Run: run, At: at, CreatedAt: now}
+	kind, action := "提醒", "提醒"
+	if run {
+		kind, action = "定时任务", "执行"
+	}
+	reply := fmt.Sprintf("✓ 已设置%s `%s`: %s\n%s", kind, rem.ID, formatRemindTime(at), text)
+	if r.calendar != nil {
+		summary := "⏰ " + text
+		if run {
+			summary = "🤖 devbot 定时任务: " + text
+		}
+		ev := CalendarEvent{
+			Summary:     truncateRunes(summary, 100),
+			Description: fmt.Sprintf("由 devbot /remind 创建，到时会在聊天中%s。\n\n%s", action, text),
+			Start:       at,
+			End:         at.Add(reminderEventLength),
+		}
+		if rem.EventID, err = r.calendar.CreateEvent(ctx, r.calendarID, ev); err != nil {
+			slog.WarnContext(ctx, "remind: create event failed", "err", err)
+			reply += fmt.Sprintf("\n⚠️ 未能添加到日历: %v", err)
+		} else {
+			reply += "\n📅 已添加到共享日历"
+		}
+	}
+	r.store.AddReminder(rem)
+	r.save()
+	r.sender.SendText(ctx, chatID, reply)
+}
+
+func (r *Router) remindList(ctx context.Context, chatID string) {
+	reminders := r.store.Reminders(chatID)
+	if len(reminders) == 0 {
+		r.sender.SendText(ctx, chatID, "没有待发送的提醒。\n"+remindUsage)
+		return
+	}
+	var sb strings.Builder
+	for _, rem := range reminders {
+		fmt.Fprintf(&sb, "- `%s` %s  %s", rem.ID, formatRemindTime(rem.At), truncateRunes(rem.Text, 80))
+		if rem.Run {
+			sb.WriteString("（定时任务）")
+		}
+		if rem.EventID != "" {
+			sb.WriteString(" 📅")
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n取消: /remind rm <ID>")
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("⏰ 提醒（%d）", len(reminders)), Content: sb.String()})
+}
+
+// StartReminders fires due reminders now, which catches up on those missed
+// while the bot was down, and then every reminderCheckInterval until ctx
+// is done.
+func (r *Router) StartReminders(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(reminderCheckInterval)
+		defer ticker.Stop()
+		for {
+			r.fireReminders(ctx, time.Now())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// fireReminders posts the reminders due at now and queues the scheduled
+// runs among them.
+func (r *Router) fireReminders(ctx context.Context, now time.Time) {
+	due := r.store.TakeDueReminders(now)
+	if len(due) == 0 {
+		return
+	}
+	r.save()
+	for _, rem := range due {
+		late := ""
+		if now.Sub(rem.At) > reminderLate {
+			late = fmt.Sprintf("\n（原定 %s，机器人当时不在线）", formatRemindTime(rem.At))
+		}
+		if rem.Run {
+			r.sender.SendText(ctx, rem.ChatID, fmt.Sprintf("⏰ 定时任务 %s: %s%s", rem.ID, rem.Text, late))
+			r.execClaudeQueued(ctx, rem.ChatID, rem.Text)
+			continue
+		}
+		r.sender.SendCard(ctx, rem.ChatID, CardMsg{Title: "⏰ 提醒", Content: rem.Text + late, Template: "blue"})
+	}
+}
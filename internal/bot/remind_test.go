@@ -0,0 +1,173 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCalendar records the events /remind creates and deletes.
+type fakeCalendar struct {
+	created []CalendarEvent
+	deleted []string
+	err     error
+}
+
+func (c *fakeCalendar) CreateEvent(_ context.Context, calendarID string, ev CalendarEvent) (string, error) {
+	if c.err != nil {
+		return "", c.err
+	}
+	c.created = append(c.created, ev)
+	return fmt.Sprintf("%s-ev%d", calendarID, len(c.created)), nil
+}
+
+func (c *fakeCalendar) DeleteEvent(_ context.Context, _, eventID string) error {
+	c.deleted = append(c.deleted, eventID)
+	return nil
+}
+
+func TestParseRemindTime(t *testing.T) {
+	now := time.Date(2026, 3, 2, 14, 0, 0, 0, time.Local) // a Monday
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, time.Local)
+	}
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"tomorrow 10am", at(3, 3, 10, 0)},
+		{"Tomorrow 3:30pm", at(3, 3, 15, 30)},
+		{"明天10点", at(3, 3, 10, 0)},
+		{"明天 下午3点半", at(3, 3, 15, 30)},
+		{"后天", at(3, 4, 9, 0)},
+		{"today 18:00", at(3, 2, 18, 0)},
+		{"16:45", at(3, 2, 16, 45)},
+		{"10am", at(3, 3, 10, 0)},
+		{"12am", at(3, 3, 0, 0)},
+		{"中午12点", at(3, 3, 12, 0)},
+		{"晚上8点20分", at(3, 2, 20, 20)},
+		{"2026-03-10 09:15", at(3, 10, 9, 15)},
+		{"03-10", at(3, 10, 9, 0)},
+		{"01-05 10am", time.Date(2027, 1, 5, 10, 0, 0, 0, time.Local)},
+		{"in 30m", now.Add(30 * time.Minute)},
+		{"in 2 hours", now.Add(2 * time.Hour)},
+		{"2小时后", now.Add(2 * time.Hour)},
+		{"3天后", now.Add(72 * time.Hour)},
+		{"in 1h30m", now.Add(90 * time.Minute)},
+	}
+	for _, c := range cases {
+		got, err := parseRemindTime(c.expr, now)
+		if err != nil || !got.Equal(c.want) {
+			t.Errorf("parseRemindTime(%q) = %v, %v; want %v", c.expr, got, err, c.want)
+		}
+	}
+	for _, expr := range []string{"", "soon", "10", "today 9am", "2026-02-30", "2025-12-01 10:00", "25:00", "review"} {
+		if got, err := parseRemindTime(expr, now); err == nil {
+			t.Errorf("parseRemindTime(%q) = %v, want an error", expr, got)
+		}
+	}
+}
+
+func TestSplitRemind(t *testing.T) {
+	now := time.Date(2026, 3, 2, 14, 0, 0, 0, time.Local)
+	tomorrow10 := time.Date(2026, 3, 3, 10, 0, 0, 0, time.Local)
+	for _, args := range []string{`"review PR 42" tomorrow 10am`, `tomorrow 10am "review PR 42"`, `“review PR 42” 明天10点`, `tomorrow 10am review PR 42`, `明天 10点 review PR 42`} {
+		text, at, err := splitRemind(args, now)
+		if err != nil || text != "review PR 42" || !at.Equal(tomorrow10) {
+			t.Errorf("splitRemind(%q) = %q, %v, %v", args, text, at, err)
+		}
+	}
+	if _, _, err := splitRemind(`"review PR 42 tomorrow`, now); err == nil {
+		t.Error("expected an unclosed quote rejected")
+	}
+	if _, _, err := splitRemind(`review PR 42`, now); err == nil {
+		t.Error("expected a reminder without a time rejected")
+	}
+}
+
+func TestRouterRemind(t *testing.T) {
+	r, sender := newTestRouter(t)
+	cal := &fakeCalendar{}
+	r.SetCalendar(cal, "cal1")
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", `/remind "review PR 42" tomorrow 10am`)
+	reminders := r.store.Reminders("chat1")
+	if len(reminders) != 1 || reminders[0].Text != "review PR 42" || reminders[0].Run || reminders[0].EventID != "cal1-ev1" {
+		t.Fatalf("unexpected reminders %+v", reminders)
+	}
+	if !strings.Contains(sender.LastMessage(), "已设置提醒") || !strings.Contains(sender.LastMessage(), "已添加到共享日历") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+	ev := cal.created[0]
+	if ev.Summary != "⏰ review PR 42" || !ev.Start.Equal(reminders[0].At) || ev.End.Sub(ev.Start) != reminderEventLength {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+
+	cal.err = errors.New("no permission")
+	r.Route(ctx, "chat1", "user1", `/remind -run "run the nightly checks" in 2h`)
+	if !strings.Contains(sender.LastMessage(), "已设置定时任务") || !strings.Contains(sender.LastMessage(), "未能添加到日历") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+	reminders = r.store.Reminders("chat1")
+	if len(reminders) != 2 || !reminders[0].Run || reminders[0].EventID != "" {
+		t.Fatalf("expected the scheduled run first, got %+v", reminders)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/remind list")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "提醒（2）") || !strings.Contains(msg, "（定时任务）") || !strings.Contains(msg, "review PR 42 📅") {
+		t.Fatalf("unexpected list %q", msg)
+	}
+	if r.store.Reminders("chat2") != nil {
+		t.Fatal("expected reminders scoped to their chat")
+	}
+
+	id := reminders[1].ID
+	r.Route(ctx, "chat1", "user1", "/remind rm "+id)
+	if len(r.store.Reminders("chat1")) != 1 || len(cal.deleted) != 1 || cal.deleted[0] != "cal1-ev1" {
+		t.Fatalf("expected the reminder and its event removed, got %v", cal.deleted)
+	}
+	r.Route(ctx, "chat1", "user1", "/remind rm "+id)
+	if !strings.Contains(sender.LastMessage(), "没有提醒") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "user1", "/remind review PR 42")
+	if !strings.Contains(sender.LastMessage(), "无法识别提醒时间") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+}
+
+func TestRouterFireReminders(t *testing.T) {
+	claude := filepath.Join(t.TempDir(), "claude")
+	os.WriteFile(claude, []byte(`#!/bin/sh
+echo '{"type":"result","result":"checks passed","session_id":"s1"}'
+`), 0755)
+	r, sender := newAckRouter(t, claude)
+	ctx := context.Background()
+	now := time.Now()
+	r.store.AddReminder(Reminder{ID: "r1", ChatID: "chat1", Text: "standup", At: now.Add(-time.Minute)})
+	r.store.AddReminder(Reminder{ID: "r2", ChatID: "chat1", Text: "run checks", Run: true, At: now.Add(-time.Hour)})
+	r.store.AddReminder(Reminder{ID: "r3", ChatID: "chat1", Text: "later", At: now.Add(time.Hour)})
+
+	r.fireReminders(ctx, now)
+	all := strings.Join(sender.messages, "\n")
+	if !strings.Contains(all, "⏰ 定时任务 r2: run checks\n（原定") || !strings.Contains(all, "checks passed") {
+		t.Fatalf("expected the overdue run marked late and executed, got %q", sender.messages)
+	}
+	if !strings.HasSuffix(all, "⏰ 提醒\n\nstandup") {
+		t.Fatalf("expected the reminder posted last, got %q", sender.messages)
+	}
+	if left := r.store.Reminders("chat1"); len(left) != 1 || left[0].ID != "r3" {
+		t.Fatalf("expected only the future reminder kept, got %+v", left)
+	}
+	n := len(sender.messages)
+	r.fireReminders(ctx, now)
+	if len(sender.messages) != n {
+		t.Fatal("expected reminders to fire once")
+	}
+}
@@ -0,0 +1,278 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// repoConfigFile is the per-repository configuration read from the root of
+// the repository a chat works in.
+const repoConfigFile = ".devbot.yaml"
+
+// repoCommandTimeout bounds /test, /lint and /run commands from
+// .devbot.yaml.
+const repoCommandTimeout = 10 * time.Minute
+
+// RepoConfig is a repository's .devbot.yaml. It is read from the
+// committed tree (HEAD), never from uncommitted edits, so it is reviewed
+// with the code and repository owners control how the bot treats their
+// repository:
+//
+//	test: make test             # /test runs this instead of go test
+//	lint: golangci-lint run     # /lint runs this instead of go vet
+//	protect: [migrations/, go.sum]
+//	docs:
+//	  docs/design.md: doccnXXXX # bound like /doc bind
+//	commands:
+//	  deploy-staging: make deploy ENV=staging   # /run deploy-staging
+type RepoConfig struct {
+	Test     string            `yaml:"test"`
+	Lint     string            `yaml:"lint"`
+	Protect  []string          `yaml:"protect"`
+	Docs     map[string]string `yaml:"docs"`
+	Commands map[string]string `yaml:"commands"`
+}
+
+var repoCommandName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// parseRepoConfig parses and checks a .devbot.yaml.
+func parseRepoConfig(data []byte) (RepoConfig, error) {
+	var cfg RepoConfig
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return RepoConfig{}, err
+	}
+	for _, p := range cfg.Protect {
+		if _, err := path.Match(strings.TrimSuffix(p, "/"), ""); err != nil || p == "" {
+			return RepoConfig{}, fmt.Errorf("protect: invalid pattern %q", p)
+		}
+	}
+	for rel := range cfg.Docs {
+		if filepath.IsAbs(rel) || !filepath.IsLocal(rel) {
+			return RepoConfig{}, fmt.Errorf("docs: %q must be a path inside the repository", rel)
+		}
+	}
+	for name, command := range cfg.Commands {
+		if !repoCommandName.MatchString(name) {
+			return RepoConfig{}, fmt.Errorf("commands: invalid name %q", name)
+		}
+		if strings.TrimSpace(command) == "" {
+			return RepoConfig{}, fmt.Errorf("commands: %s has no command", name)
+		}
+	}
+	return cfg, nil
+}
+
+// repoConfigEntry caches a repository's .devbot.yaml for one commit.
+type repoConfigEntry struct {
+	head string
+	cfg  RepoConfig
+	err  error
+}
+
+// repoConfig returns the .devbot.yaml committed at HEAD of workDir's
+// repository and the repository root. Changes in the working tree, by
+// Claude or /write, take no effect until they are committed. The file is
+// read again for every new HEAD; its doc bindings are then applied. A
+// missing or invalid file yields an empty config (and the error, for
+// invalid ones).
+func (r *Router) repoConfig(workDir string) (RepoConfig, string, error) {
+	root := repoRoot(workDir)
+	if root == "" {
+		return RepoConfig{}, "", nil
+	}
+	head, err := runGitOutput(root, "rev-parse", "HEAD")
+	if err != nil {
+		return RepoConfig{}, root, nil
+	}
+	r.mu.Lock()
+	e := r.repoConfigs[root]
+	r.mu.Unlock()
+	if e != nil && e.head == head {
+		return e.cfg, root, e.err
+	}
+
+	e = &repoConfigEntry{head: head}
+	data, err := runGitOutput(root, "show", head+":"+repoConfigFile)
+	if err == nil {
+		e.cfg, err = parseRepoConfig([]byte(data))
+	} else {
+		// Not committed (or deleted) at HEAD.
+		err = nil
+	}
+	if err != nil {
+		e.err = fmt.Errorf("%s: %w", repoConfigFile, err)
+		slog.Warn("repoconfig: invalid", "root", root, "err", err)
+	} else if r.applyRepoDocs(root, e.cfg.Docs) {
+		r.save()
+	}
+	r.mu.Lock()
+	r.repoConfigs[root] = e
+	r.mu.Unlock()
+	return e.cfg, root, e.err
+}
+
+// applyRepoDocs binds the documents a .devbot.yaml declares, overriding
+// bindings made in the chat, and reports whether any binding changed.
+func (r *Router) applyRepoDocs(root string, docs map[string]string) bool {
+	bindings := r.store.DocBindings()
+	changed := false
+	for rel, docID := range docs {
+		file := filepath.Join(root, rel)
+		if bindings[file] != docID {
+			r.store.SetDocBinding(file, docID)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// repoConfigNote summarizes the .devbot.yaml of workDir's repository for
+// the /cd reply; "" when there is none.
+func (r *Router) repoConfigNote(workDir string) string {
+	cfg, _, err := r.repoConfig(workDir)
+	if err != nil {
+		return fmt.Sprintf("⚠️ %v（已忽略）", err)
+	}
+	var parts []string
+	if cfg.Test != "" {
+		parts = append(parts, "测试命令")
+	}
+	if cfg.Lint != "" {
+		parts = append(parts, "lint 命令")
+	}
+	if n := len(cfg.Protect); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d 条保护规则", n))
+	}
+	if n := len(cfg.Docs); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d 个文档绑定", n))
+	}
+	if n := len(cfg.Commands); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d 个自定义命令（/run 查看）", n))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "已加载 " + repoConfigFile + ": " + strings.Join(parts, "、")
+}
+
+// shellQuote quotes s as a single sh word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// repoCommandLine appends the user's arguments, each quoted, to a command
+// from .devbot.yaml, so they cannot add commands of their own.
+func repoCommandLine(command, args string) string {
+	for _, arg := range strings.Fields(args) {
+		command += " " + shellQuote(arg)
+	}
+	return command
+}
+
+// repoCommandDenied reports whether the user in ctx may not run cmd, a
+// command defined in .devbot.yaml: those run arbitrary shell, so they need
+// the same role as /exec. It tells the chat so.
+func (r *Router) repoCommandDenied(ctx context.Context, chatID, cmd string) bool {
+	userID := userIDFrom(ctx)
+	if r.userRole(userID) >= r.requiredRole("/exec") {
+		return false
+	}
+	slog.WarnContext(ctx, "router: repo command denied", "command", cmd, "user_id", userID)
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("%s 执行的是 %s 中定义的命令，仅限管理员使用（admin_user_ids）。", cmd, repoConfigFile))
+	return true
+}
+
+// runRepoCommand runs a .devbot.yaml command line in root and shows the
+// outcome as a card titled after label.
+func (r *Router) runRepoCommand(ctx context.Context, chatID, root, label, command string) {
+	start := time.Now()
+	out, err := runInDir(ctx, root, repoCommandTimeout, "sh", "-c", command)
+	elapsed := time.Since(start).Truncate(time.Second)
+	out, full := r.fitOutput(chatID, "run", strings.TrimSpace(out), true, "输出过长")
+	if out == "" {
+		out = "（无输出）"
+	}
+	card := CardMsg{Title: fmt.Sprintf("%s 通过（%s）", label, elapsed), Template: "green"}
+	if err != nil {
+		slog.WarnContext(ctx, "repoconfig: command failed", "command", command, "root", root, "err", err)
+		card.Title, card.Template = fmt.Sprintf("%s 失败（%s）", label, elapsed), "red"
+	}
+	card.Content = fmt.Sprintf("`%s`\n```\n%s\n```", command, out)
+	r.sender.SendCard(ctx, chatID, card)
+	r.sendFullOutput(ctx, chatID, full)
+}
+
+// cmdLint runs the repository's lint command from .devbot.yaml, or go vet
+// in Go modules.
+func (r *Router) cmdLint(ctx context.Context, chatID, args string) {
+	workDir := r.getSession(chatID).WorkDir
+	if workDir == "" {
+		workDir = r.store.WorkRoot()
+	}
+	cfg, root, err := r.repoConfig(workDir)
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("⚠️ %v", err))
+		return
+	}
+	switch {
+	case cfg.Lint != "":
+		if r.repoCommandDenied(ctx, chatID, "/lint") {
+			return
+		}
+		r.runRepoCommand(ctx, chatID, root, "lint", repoCommandLine(cfg.Lint, args))
+	case fileExists(filepath.Join(workDir, "go.mod")):
+		if strings.TrimSpace(args) == "" {
+			args = "./..."
+		}
+		r.runRepoCommand(ctx, chatID, workDir, "go vet", repoCommandLine("go vet", args))
+	default:
+		r.sender.SendText(ctx, chatID, "当前仓库没有配置 lint 命令。\n在仓库根目录的 .devbot.yaml 中添加，如:\nlint: golangci-lint run")
+	}
+}
+
+// cmdRun lists or runs the custom commands of the repository's
+// .devbot.yaml.
+func (r *Router) cmdRun(ctx context.Context, chatID, args string) {
+	workDir := r.getSession(chatID).WorkDir
+	if workDir == "" {
+		workDir = r.store.WorkRoot()
+	}
+	cfg, root, err := r.repoConfig(workDir)
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("⚠️ %v", err))
+		return
+	}
+	name, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	if name == "" {
+		if len(cfg.Commands) == 0 {
+			r.sender.SendText(ctx, chatID, "当前仓库没有自定义命令。\n在仓库根目录的 .devbot.yaml 中添加，如:\ncommands:\n  deploy-staging: make deploy ENV=staging")
+			return
+		}
+		var sb strings.Builder
+		for _, n := range sortedKeys(cfg.Commands) {
+			fmt.Fprintf(&sb, "- `/run %s` — `%s`\n", n, cfg.Commands[n])
+		}
+		sb.WriteString("\n命令在仓库根目录执行，附加的参数逐个加引号后追加到命令末尾。")
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "自定义命令（" + repoConfigFile + "）", Content: sb.String()})
+		return
+	}
+	command, ok := cfg.Commands[name]
+	if !ok {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("没有自定义命令: %s（/run 查看可用命令）", name))
+		return
+	}
+	r.runRepoCommand(ctx, chatID, root, name, repoCommandLine(command, rest))
+}
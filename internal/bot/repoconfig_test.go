@@ -0,0 +1,152 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRepoConfig(t *testing.T) {
+	cfg, err := parseRepoConfig([]byte("test: make test\nlint: make lint\nprotect: [migrations/, go.sum]\ndocs:\n  docs/design.md: doccn1\ncommands:\n  deploy-staging: make deploy ENV=staging\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Test != "make test" || cfg.Lint != "make lint" || len(cfg.Protect) != 2 || cfg.Docs["docs/design.md"] != "doccn1" || cfg.Commands["deploy-staging"] == "" {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	if _, err := parseRepoConfig(nil); err != nil {
+		t.Fatalf("empty file: %v", err)
+	}
+	for _, bad := range []string{
+		"tests: make test\n",
+		"protect: ['[']\n",
+		"docs:\n  ../outside.md: doccn1\n",
+		"docs:\n  /etc/passwd: doccn1\n",
+		"commands:\n  'rm -rf': ls\n",
+		"commands:\n  empty: ''\n",
+	} {
+		if _, err := parseRepoConfig([]byte(bad)); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+// newRepoConfigRouter returns a router whose chat works in a repository
+// with the given .devbot.yaml committed, and the repository's git runner.
+func newRepoConfigRouter(t *testing.T, config string) (*Router, *spySender, string, func(args ...string)) {
+	t.Helper()
+	r, sender := newTestRouter(t)
+	repo := filepath.Join(r.store.WorkRoot(), "repo")
+	git := initTestRepo(t, repo, map[string]string{"main.go": "package main\n", repoConfigFile: config})
+	r.Route(context.Background(), "chat1", "user1", "/cd repo")
+	return r, sender, repo, git
+}
+
+func TestRepoConfig_CdAndCommands(t *testing.T) {
+	r, sender, repo, _ := newRepoConfigRouter(t, "test: echo testing\nlint: echo linting\nprotect: [secrets/]\ndocs:\n  README.md: doccn42\ncommands:\n  greet: echo hello\n  fail: exit 3\n")
+	ctx := context.Background()
+	if msg := sender.LastMessage(); !strings.Contains(msg, "已加载 .devbot.yaml: 测试命令、lint 命令、1 条保护规则、1 个文档绑定、2 个自定义命令") {
+		t.Fatalf("unexpected /cd reply %q", msg)
+	}
+	if got := r.store.DocBindings()[filepath.Join(repo, "README.md")]; got != "doccn42" {
+		t.Fatalf("doc binding not applied: %q", got)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/test pkg")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "测试 通过") || !strings.Contains(msg, "testing pkg") {
+		t.Fatalf("unexpected /test reply %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "/lint")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "lint 通过") || !strings.Contains(msg, "linting") {
+		t.Fatalf("unexpected /lint reply %q", msg)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/run")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "`/run greet` — `echo hello`") || !strings.Contains(msg, "/run fail") {
+		t.Fatalf("unexpected /run list %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "/run greet world; touch injected")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "greet 通过") || !strings.Contains(msg, "hello world; touch injected") {
+		t.Fatalf("unexpected /run reply %q", msg)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "injected")); err == nil {
+		t.Fatal("arguments ran as a command")
+	}
+	r.Route(ctx, "chat1", "user1", "/run fail")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "fail 失败") {
+		t.Fatalf("unexpected /run reply %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "/run nope")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "没有自定义命令: nope") {
+		t.Fatalf("unexpected /run reply %q", msg)
+	}
+
+	// Protected globs from the file add to the chat's own.
+	r.Route(ctx, "chat1", "user1", "/protect add *.lock")
+	r.Route(ctx, "chat1", "user1", "/protect")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "2 条规则") || !strings.Contains(msg, "`secrets/`（.devbot.yaml）") || strings.Contains(msg, "`*.lock`（") {
+		t.Fatalf("unexpected /protect list %q", msg)
+	}
+	if got := r.protectedPatterns(repo); len(got) != 2 {
+		t.Fatalf("unexpected patterns %v", got)
+	}
+	r.Route(ctx, "chat1", "user1", "/protect rm secrets/")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "请修改该文件") {
+		t.Fatalf("unexpected /protect rm reply %q", msg)
+	}
+}
+
+func TestRepoConfig_ReloadsAndReportsErrors(t *testing.T) {
+	r, sender, repo, git := newRepoConfigRouter(t, "commands:\n  a: echo a\n")
+	ctx := context.Background()
+
+	// Uncommitted edits are ignored: only reviewed commands run.
+	os.WriteFile(filepath.Join(repo, repoConfigFile), []byte("commands:\n  b: echo b\n"), 0644)
+	r.Route(ctx, "chat1", "user1", "/run b")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "没有自定义命令: b") {
+		t.Fatalf("uncommitted change took effect: %q", msg)
+	}
+	git("commit", "-am", "add b")
+	r.Route(ctx, "chat1", "user1", "/run b")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "b 通过") {
+		t.Fatalf("committed change not reloaded: %q", msg)
+	}
+
+	os.WriteFile(filepath.Join(repo, repoConfigFile), []byte("command:\n  c: echo c\n"), 0644)
+	git("commit", "-am", "break config")
+	r.Route(ctx, "chat1", "user1", "/cd repo")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "⚠️ .devbot.yaml") || !strings.Contains(msg, "已忽略") {
+		t.Fatalf("unexpected /cd reply %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "/run")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "⚠️ .devbot.yaml") {
+		t.Fatalf("unexpected /run reply %q", msg)
+	}
+
+	git("rm", "-q", repoConfigFile)
+	git("commit", "-m", "drop config")
+	r.Route(ctx, "chat1", "user1", "/run")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "没有自定义命令") {
+		t.Fatalf("unexpected /run reply %q", msg)
+	}
+}
+
+func TestRepoConfig_CommandsNeedAdmin(t *testing.T) {
+	r, sender, _, _ := newRepoConfigRouter(t, "test: echo testing\nlint: echo linting\ncommands:\n  greet: echo hello\n")
+	r.SetAdmins(map[string]bool{"admin": true})
+	r.allowedUsers["admin"] = true
+	ctx := context.Background()
+
+	for _, cmd := range []string{"/test", "/lint", "/run greet"} {
+		r.Route(ctx, "chat1", "user1", cmd)
+		if msg := sender.LastMessage(); !strings.Contains(msg, "仅限管理员") {
+			t.Errorf("expected %s to be denied to an operator, got %q", cmd, msg)
+		}
+	}
+	r.Route(ctx, "chat1", "admin", "/run greet")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "greet 通过") {
+		t.Fatalf("expected an admin to run it, got %q", msg)
+	}
+}
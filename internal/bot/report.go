@@ -0,0 +1,223 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultAuditLimit is the number of executions /audit lists in chat.
+const defaultAuditLimit = 20
+
+// reportArgs holds the arguments shared by the reporting commands: an
+// optional count (days or records) and the csv flag.
+type reportArgs struct {
+	n   int
+	csv bool
+}
+
+// parseReportArgs accepts "[n] [csv|--csv]" in any order.
+func parseReportArgs(args string) (reportArgs, bool) {
+	var ra reportArgs
+	for _, f := range strings.Fields(args) {
+		switch strings.ToLower(f) {
+		case "csv", "--csv":
+			ra.csv = true
+			continue
+		}
+		n, err := strconv.Atoi(f)
+		if err != nil || n <= 0 || ra.n != 0 {
+			return reportArgs{}, false
+		}
+		ra.n = n
+	}
+	return ra, true
+}
+
+// usageRow is one chat's executions on one day.
+type usageRow struct {
+	Date     string
+	ChatID   string
+	Count    int
+	Errors   int
+	Duration time.Duration
+}
+
+// usageRows aggregates records from the last days calendar days by day and
+// chat, oldest day first and chats sorted within a day.
+func usageRows(records []ExecRecord, now time.Time, days int) []usageRow {
+	since := now.AddDate(0, 0, 1-days).Format("2006-01-02")
+	byKey := make(map[[2]string]*usageRow)
+	for _, rec := range records {
+		date := rec.StartedAt.Format("2006-01-02")
+		if date < since {
+			continue
+		}
+		key := [2]string{date, rec.ChatID}
+		row := byKey[key]
+		if row == nil {
+			row = &usageRow{Date: date, ChatID: rec.ChatID}
+			byKey[key] = row
+		}
+		row.Count++
+		if rec.Error != "" {
+			row.Errors++
+		}
+		row.Duration += rec.Duration
+	}
+	rows := make([]usageRow, 0, len(byKey))
+	for _, row := range byKey {
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Date != rows[j].Date {
+			return rows[i].Date < rows[j].Date
+		}
+		return rows[i].ChatID < rows[j].ChatID
+	})
+	return rows
+}
+
+func (r *Router) cmdUsage(ctx context.Context, chatID, args string) {
+	ra, ok := parseReportArgs(args)
+	if !ok {
+		r.sender.SendText(ctx, chatID, "用法: /usage [天数] [csv]\n统计最近 N 天（默认 14 天）各聊天的执行次数、失败次数和耗时；加 csv 以文件形式导出。")
+		return
+	}
+	days := ra.n
+	if days == 0 {
+		days = usageDays
+	}
+	now := time.Now()
+	rows := usageRows(r.store.ExecRecords("", 0), now, days)
+
+	if ra.csv {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"date", "chat_id", "executions", "errors", "duration_seconds"})
+		for _, row := range rows {
+			w.Write([]string{
+				row.Date,
+				row.ChatID,
+				strconv.Itoa(row.Count),
+				strconv.Itoa(row.Errors),
+				strconv.FormatFloat(row.Duration.Seconds(), 'f', 1, 64),
+			})
+		}
+		w.Flush()
+		r.sendFile(ctx, chatID, fmt.Sprintf("usage-%s.csv", now.Format("20060102")), buf.Bytes())
+		return
+	}
+
+	if len(rows) == 0 {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("最近 %d 天没有执行记录。", days))
+		return
+	}
+	var total, errs int
+	var dur time.Duration
+	daily := make(map[string]*usageRow)
+	var dates []string
+	chats := make(map[string]int)
+	for _, row := range rows {
+		total += row.Count
+		errs += row.Errors
+		dur += row.Duration
+		chats[row.ChatID] += row.Count
+		d := daily[row.Date]
+		if d == nil {
+			d = &usageRow{Date: row.Date}
+			daily[row.Date] = d
+			dates = append(dates, row.Date)
+		}
+		d.Count += row.Count
+		d.Errors += row.Errors
+		d.Duration += row.Duration
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**合计:** 执行 %d 次 · 失败 %d 次 · 耗时 %s · %d 个聊天\n\n**按天:**\n", total, errs, dur.Truncate(time.Second), len(chats))
+	for _, date := range dates {
+		d := daily[date]
+		fmt.Fprintf(&sb, "- %s  执行 %d · 失败 %d · %s\n", date, d.Count, d.Errors, d.Duration.Truncate(time.Second))
+	}
+	sb.WriteString("\n使用 `/usage csv` 导出按天、按聊天的明细。")
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("用量（最近 %d 天）", days), Content: sb.String()})
+}
+
+func (r *Router) cmdAudit(ctx context.Context, chatID, args string) {
+	ra, ok := parseReportArgs(args)
+	if !ok {
+		r.sender.SendText(ctx, chatID, "用法: /audit [条数] [csv]\n列出所有聊天最近的执行记录（默认 20 条）；加 csv 导出全部记录（含模型、模式、git 提交、用户反馈等）。")
+		return
+	}
+
+	if ra.csv {
+		records := r.store.ExecRecords("", ra.n)
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"started_at", "id", "chat_id", "status", "duration_seconds", "model", "cli_version", "permission_mode", "work_dir", "git_head", "urgent", "repro_of", "prompt", "error", "incident", "rating", "feedback", "template"})
+		for _, rec := range records {
+			status := ExecSucceeded
+			if rec.Error != "" {
+				status = ExecFailed
+			}
+			w.Write([]string{
+				rec.StartedAt.Format(time.RFC3339),
+				rec.ID,
+				rec.ChatID,
+				status,
+				strconv.FormatFloat(rec.Duration.Seconds(), 'f', 1, 64),
+				rec.Model,
+				rec.CLIVersion,
+				rec.PermissionMode,
+				rec.WorkDir,
+				rec.GitHead,
+				strconv.FormatBool(rec.Urgent),
+				rec.ReproOf,
+				rec.Prompt,
+				rec.Error,
+				rec.Incident,
+				rec.Rating,
+				rec.Feedback,
+				rec.Template,
+			})
+		}
+		w.Flush()
+		r.sendFile(ctx, chatID, fmt.Sprintf("audit-%s.csv", time.Now().Format("20060102")), buf.Bytes())
+		return
+	}
+
+	limit := ra.n
+	if limit == 0 {
+		limit = defaultAuditLimit
+	}
+	records := r.store.ExecRecords("", limit)
+	approvals := r.store.ApprovalRecords(limit)
+	if len(records) == 0 && len(approvals) == 0 {
+		r.sender.SendText(ctx, chatID, "暂无执行记录。")
+		return
+	}
+	var sb strings.Builder
+	for _, rec := range records {
+		mark := "✓"
+		if rec.Error != "" {
+			mark = "✗"
+		}
+		fmt.Fprintf(&sb, "%s `%s` %s · `%s` · %s · %s", mark, rec.ID, rec.StartedAt.Format("01-02 15:04"), rec.ChatID, rec.Duration.Truncate(time.Second), truncateRunes(rec.Prompt, 40))
+		if rec.Incident != "" {
+			fmt.Fprintf(&sb, " 🚨 %s", rec.Incident)
+		}
+		sb.WriteString("\n")
+	}
+	if len(approvals) > 0 {
+		sb.WriteString("\n**审批记录:**\n")
+		sb.WriteString(formatApprovalAudit(approvals))
+	}
+	sb.WriteString("\n使用 `/audit csv` 导出完整记录。")
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("执行审计（最近 %d 条）", len(records)), Content: sb.String()})
+}
@@ -0,0 +1,153 @@
+package bot
+
+import (
+	"context"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseReportArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want reportArgs
+		ok   bool
+	}{
+		{"", reportArgs{}, true},
+		{"csv", reportArgs{csv: true}, true},
+		{"--csv", reportArgs{csv: true}, true},
+		{"7", reportArgs{n: 7}, true},
+		{"CSV 30", reportArgs{n: 30, csv: true}, true},
+		{"30 --csv", reportArgs{n: 30, csv: true}, true},
+		{"0", reportArgs{}, false},
+		{"7 8", reportArgs{}, false},
+		{"xlsx", reportArgs{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseReportArgs(tt.in)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseReportArgs(%q) = %+v, %v; want %+v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestUsageRows(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+	records := []ExecRecord{
+		{ChatID: "b", StartedAt: now, Duration: 2 * time.Second},
+		{ChatID: "a", StartedAt: now, Duration: time.Second, Error: "boom"},
+		{ChatID: "a", StartedAt: now.Add(-time.Hour), Duration: 3 * time.Second},
+		{ChatID: "a", StartedAt: now.AddDate(0, 0, -1)},
+		{ChatID: "a", StartedAt: now.AddDate(0, 0, -7)}, // outside the window
+	}
+	rows := usageRows(records, now, 7)
+	want := []usageRow{
+		{Date: "2024-03-09", ChatID: "a", Count: 1},
+		{Date: "2024-03-10", ChatID: "a", Count: 2, Errors: 1, Duration: 4 * time.Second},
+		{Date: "2024-03-10", ChatID: "b", Count: 1, Duration: 2 * time.Second},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("expected %d rows, got %+v", len(want), rows)
+	}
+	for i := range want {
+		if rows[i] != want[i] {
+			t.Errorf("row %d = %+v, want %+v", i, rows[i], want[i])
+		}
+	}
+}
+
+func TestRouterUsage(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/usage")
+	if !strings.Contains(sender.LastMessage(), "最近 14 天没有执行记录") {
+		t.Fatalf("expected empty usage message, got %q", sender.LastMessage())
+	}
+
+	now := time.Now()
+	r.store.AddExecRecord(ExecRecord{ID: "e1", ChatID: "chat1", StartedAt: now, Duration: 90 * time.Second})
+	r.store.AddExecRecord(ExecRecord{ID: "e2", ChatID: "chat2", StartedAt: now, Error: "boom"})
+	r.Route(context.Background(), "chat1", "user1", "/usage 3")
+	msg := sender.LastMessage()
+	if !strings.HasPrefix(msg, "用量（最近 3 天）") || !strings.Contains(msg, "执行 2 次 · 失败 1 次 · 耗时 1m30s · 2 个聊天") {
+		t.Fatalf("unexpected usage card %q", msg)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/usage foo")
+	if !strings.Contains(sender.LastMessage(), "用法: /usage") {
+		t.Fatalf("expected usage help, got %q", sender.LastMessage())
+	}
+}
+
+func TestRouterUsageCSV(t *testing.T) {
+	r, _ := newTestRouter(t)
+	sender := &fileSpySender{}
+	r.sender = sender
+	now := time.Now()
+	r.store.AddExecRecord(ExecRecord{ID: "e1", ChatID: "chat1", StartedAt: now, Duration: 1500 * time.Millisecond})
+	r.store.AddExecRecord(ExecRecord{ID: "e2", ChatID: "chat1", StartedAt: now, Error: "boom"})
+
+	r.Route(context.Background(), "chat1", "user1", "/usage csv")
+	data, ok := sender.files["usage-"+now.Format("20060102")+".csv"]
+	if !ok {
+		t.Fatalf("expected usage CSV upload, got %v", sender.files)
+	}
+	rows, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v", err)
+	}
+	want := [][]string{
+		{"date", "chat_id", "executions", "errors", "duration_seconds"},
+		{now.Format("2006-01-02"), "chat1", "2", "1", "1.5"},
+	}
+	if len(rows) != len(want) || strings.Join(rows[0], ",") != strings.Join(want[0], ",") || strings.Join(rows[1], ",") != strings.Join(want[1], ",") {
+		t.Fatalf("unexpected CSV rows %v", rows)
+	}
+}
+
+func TestRouterAudit(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/audit")
+	if sender.LastMessage() != "暂无执行记录。" {
+		t.Fatalf("expected empty audit message, got %q", sender.LastMessage())
+	}
+
+	r.store.AddExecRecord(ExecRecord{ID: "e1", ChatID: "chat1", Prompt: "first", StartedAt: time.Now()})
+	r.store.AddExecRecord(ExecRecord{ID: "e2", ChatID: "chat2", Prompt: "second", StartedAt: time.Now(), Error: "boom"})
+	r.Route(context.Background(), "chat1", "user1", "/audit 1")
+	msg := sender.LastMessage()
+	if !strings.HasPrefix(msg, "执行审计（最近 1 条）") || !strings.Contains(msg, "✗ `e2`") || strings.Contains(msg, "`e1`") {
+		t.Fatalf("unexpected audit card %q", msg)
+	}
+}
+
+func TestRouterAuditCSV(t *testing.T) {
+	r, _ := newTestRouter(t)
+	sender := &fileSpySender{}
+	r.sender = sender
+	started := time.Date(2024, 3, 10, 9, 30, 0, 0, time.UTC)
+	r.store.AddExecRecord(ExecRecord{ID: "e1", ChatID: "chat1", Prompt: "fix it, \"now\"\nplease", StartedAt: started, Duration: 2 * time.Second, Model: "opus", PermissionMode: "safe", GitHead: "abc123"})
+	r.store.AddExecRecord(ExecRecord{ID: "e2", ChatID: "chat2", Prompt: "deploy", StartedAt: started, Error: "boom", Urgent: true, Incident: "inc1"})
+
+	r.Route(context.Background(), "chat1", "user1", "/audit --csv")
+	var data []byte
+	for name, d := range sender.files {
+		if strings.HasPrefix(name, "audit-") && strings.HasSuffix(name, ".csv") {
+			data = d
+		}
+	}
+	rows, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v", err)
+	}
+	if len(rows) != 3 || rows[0][0] != "started_at" {
+		t.Fatalf("expected header and 2 records, got %v", rows)
+	}
+	// Newest first.
+	if got := strings.Join(rows[1], "|"); got != "2024-03-10T09:30:00Z|e2|chat2|failed|0.0||||||true||deploy|boom|inc1|||" {
+		t.Fatalf("unexpected failed row %q", got)
+	}
+	if rows[2][1] != "e1" || rows[2][3] != "succeeded" || rows[2][5] != "opus" || rows[2][9] != "abc123" || rows[2][12] != "fix it, \"now\"\nplease" {
+		t.Fatalf("unexpected succeeded row %q", rows[2])
+	}
+}
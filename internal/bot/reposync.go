@@ -0,0 +1,243 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultRepoSyncIdle is how long a chat must be inactive before its
+	// next prompt refreshes the repository.
+	defaultRepoSyncIdle = time.Hour
+	// repoFetchTimeout bounds the fetch of a refresh.
+	repoFetchTimeout = 10 * time.Second
+)
+
+// Repository refresh modes (repo_sync and /sync).
+const (
+	repoSyncOff   = "off"
+	repoSyncFetch = "fetch" // fetch and warn when behind
+	repoSyncPull  = "pull"  // fetch and fast-forward when possible
+)
+
+func validRepoSyncMode(mode string) bool {
+	return mode == repoSyncOff || mode == repoSyncFetch || mode == repoSyncPull
+}
+
+// SetRepoSync sets the branch chats are expected to work on (empty = no
+// expectation) and how a chat's repository is refreshed when the chat
+// becomes active after being idle for idle (<= 0 uses the default).
+func (r *Router) SetRepoSync(defaultBranch, mode string, idle time.Duration) {
+	r.defaultBranch = defaultBranch
+	r.repoSyncMode = mode
+	r.repoSyncIdle = idle
+}
+
+// repoSyncFor returns the default branch and refresh mode of chatID: its
+// own settings, or the configured ones.
+func (r *Router) repoSyncFor(chatID string) (branch, mode string) {
+	s := r.getSession(chatID)
+	branch, mode = r.defaultBranch, r.repoSyncMode
+	if s.DefaultBranch != "" {
+		branch = s.DefaultBranch
+	}
+	if s.RepoSync != "" {
+		mode = s.RepoSync
+	}
+	if mode == "" {
+		mode = repoSyncOff
+	}
+	return branch, mode
+}
+
+// lastActivity returns when chatID last finished an execution or had its
+// repository refreshed, or the zero time.
+func (r *Router) lastActivity(chatID string) time.Time {
+	var last time.Time
+	if recs := r.store.ExecRecords(chatID, 1); len(recs) > 0 {
+		last = recs[0].StartedAt.Add(recs[0].Duration)
+	}
+	r.mu.Lock()
+	if t := r.repoSynced[chatID]; t.After(last) {
+		last = t
+	}
+	r.mu.Unlock()
+	return last
+}
+
+// syncIfIdle marks the chat's repository for a refresh before its next
+// run when the chat has been idle long enough and refreshing is on. The
+// fetch itself runs in the queued task (refreshIfDue), not on the message
+// path.
+func (r *Router) syncIfIdle(chatID string) {
+	_, mode := r.repoSyncFor(chatID)
+	if mode == repoSyncOff {
+		return
+	}
+	idle := r.repoSyncIdle
+	if idle <= 0 {
+		idle = defaultRepoSyncIdle
+	}
+	if time.Since(r.lastActivity(chatID)) < idle {
+		return
+	}
+	r.mu.Lock()
+	r.repoSynced[chatID] = time.Now()
+	r.repoSyncDue[chatID] = true
+	r.mu.Unlock()
+}
+
+// refreshIfDue runs the refresh syncIfIdle marked the chat for, telling
+// the chat only when something needs attention.
+func (r *Router) refreshIfDue(ctx context.Context, chatID string) {
+	r.mu.Lock()
+	due := r.repoSyncDue[chatID]
+	delete(r.repoSyncDue, chatID)
+	r.mu.Unlock()
+	if !due {
+		return
+	}
+	branch, mode := r.repoSyncFor(chatID)
+	if mode == repoSyncOff {
+		return
+	}
+	workDir := r.getSession(chatID).WorkDir
+	if _, err := os.Stat(workDir); err != nil || gitHead(workDir) == "" {
+		return
+	}
+	note, notable := refreshRepo(ctx, repoRoot(workDir), branch, mode)
+	if notable {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "🔄 仓库状态检查", Content: note, Template: "orange"})
+	}
+}
+
+// refreshRepo fetches repo and compares its branch with the upstream,
+// fast-forwarding a clean branch that is only behind in pull mode. It
+// returns a markdown report and whether it holds anything worth telling:
+// a fetch failure, new commits, or a branch other than the default one.
+func refreshRepo(ctx context.Context, repo, defaultBranch, mode string) (string, bool) {
+	var notes []string
+	notable := false
+	branch := gitBranch(repo)
+	if branch == "" {
+		branch = "HEAD"
+	}
+	if defaultBranch != "" && branch != defaultBranch {
+		notes = append(notes, fmt.Sprintf("⚠️ 当前在 `%s`，不是默认分支 `%s`；如需切换: `/branch %s`", branch, defaultBranch, defaultBranch))
+		notable = true
+	}
+
+	fetchCtx, cancel := context.WithTimeout(ctx, repoFetchTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(fetchCtx, "git", "-C", repo, "fetch", "--quiet", "--prune")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		slog.Warn("reposync: fetch failed", "repo", repo, "err", err)
+		notes = append(notes, fmt.Sprintf("❌ git fetch 失败，无法确认是否为最新: %s", truncateRunes(orDash(strings.TrimSpace(stderr.String())), 200)))
+		return strings.Join(notes, "\n"), true
+	}
+
+	upstream, err := runGitOutput(repo, "rev-parse", "--abbrev-ref", "@{u}")
+	if err != nil {
+		notes = append(notes, fmt.Sprintf("`%s` 没有上游分支，已跳过比较。", branch))
+		return strings.Join(notes, "\n"), notable
+	}
+	counts, err := runGitOutput(repo, "rev-list", "--left-right", "--count", "HEAD...@{u}")
+	fields := strings.Fields(counts)
+	if err != nil || len(fields) != 2 {
+		return strings.Join(notes, "\n"), notable
+	}
+	ahead, _ := strconv.Atoi(fields[0])
+	behind, _ := strconv.Atoi(fields[1])
+	switch {
+	case behind == 0:
+		notes = append(notes, fmt.Sprintf("✓ `%s` 已包含 `%s` 的全部提交。", branch, upstream))
+	case mode == repoSyncPull && ahead == 0 && worktreeClean(repo):
+		if out, err := runGitOutput(repo, "merge", "--ff-only", "--quiet", "@{u}"); err != nil {
+			notes = append(notes, fmt.Sprintf("❌ 快进到 `%s` 失败: %s", upstream, truncateRunes(out, 200)))
+		} else {
+			notes = append(notes, fmt.Sprintf("⬇️ 已快进 `%s` %d 个提交到 `%s`。", branch, behind, upstream))
+		}
+		notable = true
+	default:
+		msg := fmt.Sprintf("⚠️ `%s` 落后 `%s` %d 个提交", branch, upstream, behind)
+		if ahead > 0 {
+			msg += fmt.Sprintf("，且领先 %d 个（已分叉）", ahead)
+		} else if mode == repoSyncPull {
+			msg += "，工作区有未提交的变更，未自动快进"
+		}
+		notes = append(notes, msg+"。Claude 看到的可能是旧代码，可先 `/pull`。")
+		notable = true
+	}
+	return strings.Join(notes, "\n"), notable
+}
+
+// worktreeClean reports whether repo has no uncommitted changes to tracked
+// files.
+func worktreeClean(repo string) bool {
+	out, err := runGitOutput(repo, "status", "--porcelain", "--untracked-files=no")
+	return err == nil && out == ""
+}
+
+// cmdSync shows or changes the chat's default branch and refresh mode, or
+// refreshes the repository now.
+func (r *Router) cmdSync(ctx context.Context, chatID, args string) {
+	fields := strings.Fields(args)
+	usage := "用法: /sync [now|off|fetch|pull|default]\n       /sync branch <分支>|default\nfetch: 闲置后的第一条 prompt 前 git fetch，落后时提醒；pull: 并在工作区干净且未分叉时自动快进；off: 关闭。"
+	branch, mode := r.repoSyncFor(chatID)
+	switch {
+	case len(fields) == 0:
+		idle := r.repoSyncIdle
+		if idle <= 0 {
+			idle = defaultRepoSyncIdle
+		}
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("默认分支: %s\n闲置 %s 后自动检查: %s\n%s", orDash(branch), idle, mode, usage))
+	case fields[0] == "now" && len(fields) == 1:
+		workDir := r.getSession(chatID).WorkDir
+		if gitHead(workDir) == "" {
+			r.sender.SendText(ctx, chatID, "当前目录不是 git 仓库或暂无提交。")
+			return
+		}
+		if mode == repoSyncOff {
+			mode = repoSyncFetch
+		}
+		r.mu.Lock()
+		r.repoSynced[chatID] = time.Now()
+		r.mu.Unlock()
+		note, notable := refreshRepo(ctx, repoRoot(workDir), branch, mode)
+		tpl := "green"
+		if notable {
+			tpl = "orange"
+		}
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "🔄 仓库状态检查", Content: note, Template: tpl})
+	case fields[0] == "branch" && len(fields) == 2:
+		value := fields[1]
+		if value == "default" {
+			value = ""
+		}
+		r.store.UpdateSession(chatID, func(s *Session) { s.DefaultBranch = value })
+		r.save()
+		branch, _ = r.repoSyncFor(chatID)
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 默认分支: %s", orDash(branch)))
+	case len(fields) == 1 && (validRepoSyncMode(fields[0]) || fields[0] == "default"):
+		value := fields[0]
+		if value == "default" {
+			value = ""
+		}
+		r.store.UpdateSession(chatID, func(s *Session) { s.RepoSync = value })
+		r.save()
+		_, mode = r.repoSyncFor(chatID)
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 闲置后自动检查: %s", mode))
+	default:
+		r.sender.SendText(ctx, chatID, usage)
+	}
+}
@@ -0,0 +1,95 @@
+package bot
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// cloneBehind returns a clone of a new upstream repository that is one
+// commit behind it, and the clone's branch.
+func cloneBehind(t *testing.T) (clone, branch string) {
+	t.Helper()
+	dir := t.TempDir()
+	upstream := filepath.Join(dir, "upstream")
+	git := initTestRepo(t, upstream, map[string]string{"main.go": "package main\n"})
+	clone = filepath.Join(dir, "clone")
+	if out, err := exec.Command("git", "clone", "-q", upstream, clone).CombinedOutput(); err != nil {
+		t.Fatalf("git clone: %v\n%s", err, out)
+	}
+	git("commit", "--allow-empty", "-m", "upstream change")
+	return clone, gitBranch(clone)
+}
+
+func TestRefreshRepo_Fetch(t *testing.T) {
+	clone, branch := cloneBehind(t)
+	note, notable := refreshRepo(context.Background(), clone, "", repoSyncFetch)
+	if !notable || !strings.Contains(note, "落后 `origin/"+branch+"` 1 个提交") {
+		t.Fatalf("expected a behind warning, got %v %q", notable, note)
+	}
+	if note, notable := refreshRepo(context.Background(), clone, "release", repoSyncFetch); !notable || !strings.Contains(note, "不是默认分支 `release`") {
+		t.Fatalf("expected a default branch warning, got %q", note)
+	}
+}
+
+func TestRefreshRepo_PullFastForwards(t *testing.T) {
+	clone, branch := cloneBehind(t)
+	before := gitHead(clone)
+	note, notable := refreshRepo(context.Background(), clone, branch, repoSyncPull)
+	if !notable || !strings.Contains(note, "已快进") || gitHead(clone) == before {
+		t.Fatalf("expected a fast-forward, got %v %q", notable, note)
+	}
+	if note, notable := refreshRepo(context.Background(), clone, branch, repoSyncPull); notable || !strings.Contains(note, "已包含") {
+		t.Fatalf("expected an up-to-date repository, got %v %q", notable, note)
+	}
+}
+
+func TestRouterSyncIfIdle(t *testing.T) {
+	r, sender := newTestRouter(t)
+	clone, _ := cloneBehind(t)
+	r.SetRepoSync("", repoSyncFetch, 0)
+	r.getSession("chat1")
+	r.store.UpdateSession("chat1", func(s *Session) { s.WorkDir = clone })
+
+	r.syncIfIdle("chat1")
+	if len(sender.messages) != 0 {
+		t.Fatalf("expected no fetch on the message path, got %q", sender.LastMessage())
+	}
+	r.refreshIfDue(context.Background(), "chat1")
+	if msg := sender.LastMessage(); !strings.HasPrefix(msg, "🔄 仓库状态检查") || !strings.Contains(msg, "落后") {
+		t.Fatalf("expected a refresh warning, got %q", msg)
+	}
+	n := len(sender.messages)
+	r.syncIfIdle("chat1")
+	r.refreshIfDue(context.Background(), "chat1")
+	if len(sender.messages) != n {
+		t.Fatalf("expected no refresh right after the last one, got %q", sender.LastMessage())
+	}
+}
+
+func TestRouterSync_Settings(t *testing.T) {
+	r, sender := newTestRouter(t)
+	ctx := context.Background()
+	r.SetRepoSync("main", repoSyncOff, 0)
+
+	r.Route(ctx, "chat1", "user1", "/sync pull")
+	r.Route(ctx, "chat1", "user1", "/sync branch develop")
+	if branch, mode := r.repoSyncFor("chat1"); branch != "develop" || mode != repoSyncPull {
+		t.Fatalf("unexpected chat settings %q %q", branch, mode)
+	}
+	r.Route(ctx, "chat1", "user1", "/sync")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "默认分支: develop") || !strings.Contains(msg, "自动检查: pull") {
+		t.Fatalf("unexpected settings reply %q", msg)
+	}
+	r.Route(ctx, "chat1", "user1", "/sync default")
+	r.Route(ctx, "chat1", "user1", "/sync branch default")
+	if branch, mode := r.repoSyncFor("chat1"); branch != "main" || mode != repoSyncOff {
+		t.Fatalf("expected the configured settings back, got %q %q", branch, mode)
+	}
+	r.Route(ctx, "chat1", "user1", "/sync sometimes")
+	if !strings.HasPrefix(sender.LastMessage(), "用法:") {
+		t.Fatalf("expected usage, got %q", sender.LastMessage())
+	}
+}
@@ -0,0 +1,96 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// SuspendQueue takes the tasks still waiting in the queue out of it and
+// saves them in the state file for ResumeQueue, so a restart does not drop
+// them. Running tasks are left to finish. It returns the number of tasks
+// saved.
+func (r *Router) SuspendQueue() int {
+	if r.queue == nil {
+		return 0
+	}
+	drained := r.queue.Drain()
+	var tasks []PendingTask
+	for _, chatID := range sortedKeys(drained) {
+		for _, e := range drained[chatID] {
+			r.mu.Lock()
+			opts, resumable := r.queuedOpts[e.ID]
+			r.mu.Unlock()
+			rec := r.clearQueued(e.ID)
+			if rec.ID == "" {
+				continue // not tracked, nothing to tell the chat
+			}
+			tasks = append(tasks, PendingTask{
+				ID:        rec.ID,
+				ChatID:    chatID,
+				Prompt:    rec.Prompt,
+				Urgent:    rec.Urgent,
+				Images:    opts.Images,
+				Template:  opts.Template,
+				Resumable: resumable,
+				QueuedAt:  rec.StartedAt,
+			})
+		}
+	}
+	if len(tasks) == 0 {
+		return 0
+	}
+	r.store.AddPendingTasks(tasks)
+	r.save()
+	return len(tasks)
+}
+
+// ResumeQueue queues the prompts saved by the last SuspendQueue again,
+// under their original IDs, and tells each chat which of its tasks were
+// restored and which it has to send again.
+func (r *Router) ResumeQueue(ctx context.Context) {
+	tasks := r.store.TakePendingTasks()
+	if len(tasks) == 0 {
+		return
+	}
+	r.save()
+	byChat := make(map[string][]PendingTask)
+	for _, t := range tasks {
+		byChat[t.ChatID] = append(byChat[t.ChatID], t)
+	}
+	for _, chatID := range sortedKeys(byChat) {
+		var restored, lost []string
+		for _, t := range byChat[chatID] {
+			line := fmt.Sprintf("- `%s` %s", t.ID, truncateRunes(strings.Join(strings.Fields(t.Prompt), " "), 60))
+			if !t.Resumable {
+				lost = append(lost, line)
+				continue
+			}
+			opts := execOptions{ID: t.ID, Urgent: t.Urgent, Force: true, Images: t.Images, Template: t.Template}
+			if _, err := r.enqueueExec(ctx, chatID, t.Prompt, opts); err != nil {
+				slog.WarnContext(ctx, "router: restore queued task failed", "chat_id", chatID, "exec_id", t.ID, "err", err)
+				lost = append(lost, line)
+				continue
+			}
+			restored = append(restored, line)
+		}
+		slog.InfoContext(ctx, "router: restored queued tasks", "chat_id", chatID, "restored", len(restored), "lost", len(lost))
+
+		var sb strings.Builder
+		if len(restored) > 0 {
+			fmt.Fprintf(&sb, "devbot 重启前排队的 %d 个任务已重新加入队列：\n%s\n", len(restored), strings.Join(restored, "\n"))
+		}
+		if len(lost) > 0 {
+			if sb.Len() > 0 {
+				sb.WriteString("\n")
+			}
+			fmt.Fprintf(&sb, "以下任务无法自动恢复，请重新发送：\n%s\n", strings.Join(lost, "\n"))
+		}
+		card := CardMsg{Title: "🔄 已恢复重启前的排队任务", Content: strings.TrimSpace(sb.String()), Template: "blue"}
+		if len(restored) == 0 {
+			card.Title, card.Template = "⚠️ 重启前的排队任务未能恢复", "orange"
+		}
+		r.sender.SendCard(ctx, chatID, card)
+	}
+}
@@ -0,0 +1,94 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSuspendAndResumeQueue(t *testing.T) {
+	r, _, q := newTestRouterForExec(t)
+	ctx := context.Background()
+	started := make(chan struct{})
+	done := make(chan struct{})
+	q.Enqueue("chat1", func() {
+		close(started)
+		<-done
+	})
+	<-started
+
+	r.Route(ctx, "chat1", "user1", "fix the flaky test")
+	r.Route(ctx, "chat1", "user1", "/urgent deploy hotfix")
+	// A side task such as /review-local cannot be queued again.
+	r.setQueued(ExecRecord{ID: "rev1", ChatID: "chat1", Prompt: "/review-local", StartedAt: time.Now()})
+	q.EnqueueTask("chat1", QueueEntry{ID: "rev1"}, func() { t.Error("side task ran") })
+
+	if n := r.SuspendQueue(); n != 3 {
+		t.Fatalf("expected 3 suspended tasks, got %d", n)
+	}
+	if _, ok := r.queuedExec("rev1"); ok {
+		t.Fatal("suspended task still queued")
+	}
+	close(done)
+	q.Shutdown()
+
+	// The next start reads the tasks back from the state file.
+	store, err := NewStore(r.store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := &cardSpySender{}
+	r2 := NewRouter(ctx, r.executor, store, sender, map[string]bool{"user1": true}, r.store.WorkRoot(), nil)
+	q2 := NewMessageQueue()
+	r2.SetQueue(q2)
+	started2 := make(chan struct{})
+	done2 := make(chan struct{})
+	q2.Enqueue("chat1", func() {
+		close(started2)
+		<-done2
+	})
+	<-started2
+	defer func() {
+		q2.Drain()
+		close(done2)
+		q2.Shutdown()
+	}()
+
+	var tasks []PendingTask
+	for _, tk := range store.State().PendingTasks {
+		tasks = append(tasks, *tk)
+	}
+	if len(tasks) != 3 {
+		t.Fatalf("expected 3 saved tasks, got %+v", tasks)
+	}
+	r2.ResumeQueue(ctx)
+
+	waiting := q2.Waiting("chat1")
+	if len(waiting) != 2 || !waiting[0].Urgent {
+		t.Fatalf("unexpected restored queue %+v", waiting)
+	}
+	for _, tk := range tasks {
+		_, queued := r2.queuedExec(tk.ID)
+		if queued != tk.Resumable {
+			t.Errorf("task %s (%q): queued=%v", tk.ID, tk.Prompt, queued)
+		}
+	}
+	if len(sender.cards) != 1 {
+		t.Fatalf("expected one card, got %+v (texts %v)", sender.cards, sender.texts)
+	}
+	card := sender.cards[0]
+	if !strings.Contains(card.Content, "2 个任务已重新加入队列") || !strings.Contains(card.Content, "fix the flaky test") ||
+		!strings.Contains(card.Content, "请重新发送") || !strings.Contains(card.Content, "`rev1` /review-local") {
+		t.Fatalf("unexpected card %+v", card)
+	}
+	if left := store.TakePendingTasks(); len(left) != 0 {
+		t.Fatalf("pending tasks not cleared: %+v", left)
+	}
+
+	// Nothing saved: nothing to say.
+	r2.ResumeQueue(ctx)
+	if len(sender.cards) != 1 {
+		t.Fatalf("unexpected second card %+v", sender.cards)
+	}
+}
@@ -0,0 +1,144 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	// maxRetryDiffLines bounds each side of the output diff; longer outputs
+	// are only compared by size.
+	maxRetryDiffLines = 400
+	// maxRetryDiffShown is how many changed lines the retry card shows.
+	maxRetryDiffShown = 40
+)
+
+type retryKey struct{}
+
+// withRetryOf marks the prompt run with ctx as a /retry of an attempt that
+// produced prevOutput.
+func withRetryOf(ctx context.Context, prevOutput string) context.Context {
+	return context.WithValue(ctx, retryKey{}, prevOutput)
+}
+
+// retryOf returns the previous attempt's output set by withRetryOf.
+func retryOf(ctx context.Context) (prevOutput string, ok bool) {
+	prevOutput, ok = ctx.Value(retryKey{}).(string)
+	return prevOutput, ok
+}
+
+// treeSnapshot returns a commit capturing the tracked files of workDir as
+// they are now, without touching the tree or the stash list: the commit
+// `git stash create` makes for local changes, HEAD when there are none, or
+// "" outside a git repo.
+func treeSnapshot(workDir string) string {
+	if workDir == "" {
+		return ""
+	}
+	if out, err := runGitOutput(workDir, "stash", "create"); err == nil && out != "" {
+		return out
+	}
+	return gitHead(workDir)
+}
+
+// retryTreeDiff returns the --stat of what changed in workDir's tracked
+// files since the snapshot before, or "" if nothing did.
+func retryTreeDiff(workDir, before string) string {
+	if before == "" {
+		return ""
+	}
+	after := treeSnapshot(workDir)
+	if after == "" || after == before {
+		return ""
+	}
+	stat, err := runGitOutput(workDir, "diff", "--stat", before, after)
+	if err != nil {
+		return ""
+	}
+	return stat
+}
+
+// lineDiff compares two texts line by line and returns the lines only in
+// a prefixed "- " and the lines only in b prefixed "+ ", in order.
+func lineDiff(a, b string) []string {
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+	// lcs[i][j] is the longest common subsequence of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var out []string
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, "- "+x[i])
+			i++
+		default:
+			out = append(out, "+ "+y[j])
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		out = append(out, "- "+x[i])
+	}
+	for ; j < len(y); j++ {
+		out = append(out, "+ "+y[j])
+	}
+	return out
+}
+
+// retryDiffNote describes how a retry's output and tree changes differ
+// from the previous attempt, as card markdown.
+func retryDiffNote(prevOutput, output, treeStat string) string {
+	prevOutput, output = strings.TrimSpace(prevOutput), strings.TrimSpace(output)
+	var sb strings.Builder
+	switch {
+	case prevOutput == "":
+		sb.WriteString("上次尝试没有输出，无法比较结果。")
+	case prevOutput == output:
+		sb.WriteString("**结果：** 与上次相同。")
+	case strings.Count(prevOutput, "\n") >= maxRetryDiffLines || strings.Count(output, "\n") >= maxRetryDiffLines:
+		fmt.Fprintf(&sb, "**结果：** 已变化（%d → %d 字），内容过长，不逐行比较。", len([]rune(prevOutput)), len([]rune(output)))
+	default:
+		diff := lineDiff(prevOutput, output)
+		added, removed := 0, 0
+		for _, l := range diff {
+			if strings.HasPrefix(l, "+") {
+				added++
+			} else {
+				removed++
+			}
+		}
+		fmt.Fprintf(&sb, "**结果：** +%d / -%d 行\n", added, removed)
+		shown := diff
+		if len(shown) > maxRetryDiffShown {
+			shown = shown[:maxRetryDiffShown]
+		}
+		sb.WriteString("```diff\n" + strings.Join(shown, "\n") + "\n```")
+		if len(diff) > len(shown) {
+			fmt.Fprintf(&sb, "\n（另有 %d 行差异未显示）", len(diff)-len(shown))
+		}
+	}
+	if treeStat != "" {
+		sb.WriteString("\n\n**文件变更（相对重试前）：**\n```\n" + treeStat + "\n```")
+	} else {
+		sb.WriteString("\n\n**文件变更：** 本次重试没有改动已跟踪的文件。")
+	}
+	return sb.String()
+}
@@ -0,0 +1,70 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLineDiff(t *testing.T) {
+	got := lineDiff("a\nb\nc", "a\nc\nd")
+	want := []string{"- b", "+ d"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("lineDiff = %q, want %q", got, want)
+	}
+	if got := lineDiff("same", "same"); len(got) != 0 {
+		t.Fatalf("identical texts should have no diff, got %q", got)
+	}
+}
+
+func TestRetryDiffNote(t *testing.T) {
+	if note := retryDiffNote("x", "x", ""); !strings.Contains(note, "与上次相同") || !strings.Contains(note, "没有改动") {
+		t.Errorf("same output note = %q", note)
+	}
+	note := retryDiffNote("a\nb", "a\nc", " a.txt | 2 +-")
+	for _, want := range []string{"+1 / -1 行", "- b\n+ c", "a.txt | 2 +-"} {
+		if !strings.Contains(note, want) {
+			t.Errorf("note missing %q: %q", want, note)
+		}
+	}
+	if note := retryDiffNote("", "new", ""); !strings.Contains(note, "无法比较") {
+		t.Errorf("no previous output note = %q", note)
+	}
+}
+
+func TestRouterRetry_ShowsDiff(t *testing.T) {
+	claude := filepath.Join(t.TempDir(), "claude")
+	os.WriteFile(claude, []byte(`#!/bin/sh
+if grep -q first a.txt; then
+  echo second > a.txt
+  printf '%s\n' '{"type":"result","result":"step one\nresult B","session_id":"s1"}'
+else
+  echo first > a.txt
+  printf '%s\n' '{"type":"result","result":"step one\nresult A","session_id":"s1"}'
+fi
+`), 0755)
+	r, sender := newAckRouter(t, claude)
+	root := r.store.WorkRoot()
+	initGitRepo(t, root)
+	os.WriteFile(filepath.Join(root, "a.txt"), []byte("zero\n"), 0644)
+	for _, args := range [][]string{{"add", "a.txt"}, {"commit", "-q", "-m", "init"}} {
+		if out, err := exec.Command("git", append([]string{"-C", root}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v %s", args, err, out)
+		}
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "do it")
+	if strings.Contains(strings.Join(sender.messages, "\n"), "与上次尝试的差异") {
+		t.Fatal("a first attempt should not show a retry diff")
+	}
+	r.Route(context.Background(), "chat1", "user1", "/retry")
+	msg := sender.messages[len(sender.messages)-1]
+	for _, want := range []string{"与上次尝试的差异", "- result A\n+ result B", "a.txt"} {
+		if !strings.Contains(strings.Join(sender.messages, "\n"), want) {
+			t.Errorf("messages missing %q: %q (last %q)", want, sender.messages, msg)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxReviewDiff bounds the diff sent to Claude by /review-local; larger
+// diffs are cut and Claude is told to read the remaining files itself.
+const maxReviewDiff = 60000
+
+// reviewCategories lists the rubric of /review-local in display order.
+var reviewCategories = []struct{ key, label string }{
+	{"bug", "🐛 缺陷"},
+	{"security", "🔒 安全"},
+	{"style", "🎨 风格"},
+}
+
+// reviewFinding is one issue reported by /review-local.
+type reviewFinding struct {
+	Category string `json:"category"`
+	Severity string `json:"severity"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Issue    string `json:"issue"`
+	Fix      string `json:"fix"`
+}
+
+func (f reviewFinding) location() string {
+	if f.Line > 0 {
+		return fmt.Sprintf("%s:%d", f.File, f.Line)
+	}
+	return f.File
+}
+
+const reviewRubric = `请审查以下本地未提交的代码变更（提交前的自检），只关注变更引入的问题，按以下标准逐项检查：
+- bug：逻辑错误、边界条件、空值/错误处理遗漏、并发问题、资源泄漏
+- security：注入、路径穿越、敏感信息泄露、不安全的默认值、缺少权限校验
+- style：命名、重复代码、与周边代码风格不一致、缺少必要的测试或注释
+
+不要修改任何文件。只输出一个 JSON 对象，不要包含其他文字或代码块标记，格式如下：
+{"findings": [{"category": "bug|security|style", "severity": "high|medium|low", "file": "相对路径", "line": 行号, "issue": "问题描述", "fix": "具体的修复建议"}]}
+没有发现问题时输出 {"findings": []}。`
+
+// localChanges returns the uncommitted changes of the repository at
+// workDir as a diff against HEAD (or the index before the first commit),
+// plus the untracked files, which have no diff.
+func localChanges(workDir string) (diff string, untracked []string, err error) {
+	if _, err := runGitOutput(workDir, "rev-parse", "--verify", "-q", "HEAD"); err == nil {
+		diff, err = runGitOutput(workDir, "diff", "HEAD")
+		if err != nil {
+			return "", nil, err
+		}
+	} else {
+		cached, err := runGitOutput(workDir, "diff", "--cached")
+		if err != nil {
+			return "", nil, err
+		}
+		unstaged, _ := runGitOutput(workDir, "diff")
+		diff = strings.TrimSpace(cached + "\n" + unstaged)
+	}
+	if out, _ := runGitOutput(workDir, "ls-files", "--others", "--exclude-standard"); out != "" {
+		untracked = strings.Split(out, "\n")
+	}
+	return diff, untracked, nil
+}
+
+// reviewPrompt builds the /review-local prompt from rubric and the local
+// changes.
+func reviewPrompt(rubric, diff string, untracked []string) string {
+	var sb strings.Builder
+	sb.WriteString(rubric)
+	if diff != "" {
+		if runes := []rune(diff); len(runes) > maxReviewDiff {
+			diff = string(runes[:maxReviewDiff]) + "\n…（diff 过长已截断，请自行读取其余变更的文件）"
+		}
+		sb.WriteString("\n\n```diff\n" + diff + "\n```")
+	}
+	if len(untracked) > 0 {
+		sb.WriteString("\n\n新增的未跟踪文件（请读取后一并审查）：\n")
+		for _, f := range untracked {
+			sb.WriteString("- " + f + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// parseReviewFindings decodes the findings from Claude's review output,
+// which is either {"findings": [...]} or a bare array.
+func parseReviewFindings(output string) ([]reviewFinding, error) {
+	raw := stripCodeFence(strings.TrimSpace(output))
+	if raw == "" {
+		return nil, errors.New("empty output")
+	}
+	var findings []reviewFinding
+	if strings.HasPrefix(raw, "[") {
+		if err := json.Unmarshal([]byte(raw), &findings); err != nil {
+			return nil, err
+		}
+	} else {
+		var obj struct {
+			Findings *[]reviewFinding `json:"findings"`
+		}
+		if err := json.Unmarshal([]byte(raw), &obj); err != nil {
+			return nil, err
+		}
+		if obj.Findings == nil {
+			return nil, errors.New(`missing "findings"`)
+		}
+		findings = *obj.Findings
+	}
+	for i := range findings {
+		f := &findings[i]
+		f.Category = strings.ToLower(strings.TrimSpace(f.Category))
+		if f.Category != "bug" && f.Category != "security" {
+			f.Category = "style"
+		}
+		f.Severity = strings.ToLower(strings.TrimSpace(f.Severity))
+	}
+	return findings, nil
+}
+
+// formatReviewChecklist renders findings as a numbered checklist grouped by
+// category. Numbers refer to the order of findings, as used by
+// /review-local apply.
+func formatReviewChecklist(findings []reviewFinding) string {
+	var sb strings.Builder
+	for _, cat := range reviewCategories {
+		var idx []int
+		for i, f := range findings {
+			if f.Category == cat.key {
+				idx = append(idx, i)
+			}
+		}
+		if len(idx) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "**%s（%d）**\n", cat.label, len(idx))
+		for _, i := range idx {
+			f := findings[i]
+			sev := ""
+			if f.Severity != "" {
+				sev = "[" + f.Severity + "] "
+			}
+			fmt.Fprintf(&sb, "☐ %d. %s`%s` %s\n", i+1, sev, f.location(), f.Issue)
+			if f.Fix != "" {
+				fmt.Fprintf(&sb, "　　建议: %s\n", f.Fix)
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// parseFindingSelection parses "1,3 4" into zero-based indexes of n
+// findings; an empty selection or "all" selects everything.
+func parseFindingSelection(args string, n int) ([]int, error) {
+	args = strings.TrimSpace(args)
+	if args == "" || args == "all" {
+		all := make([]int, n)
+		for i := range all {
+			all[i] = i
+		}
+		return all, nil
+	}
+	seen := make(map[int]bool)
+	var out []int
+	for _, f := range strings.FieldsFunc(args, func(c rune) bool { return c == ',' || c == ' ' || c == '，' }) {
+		i, err := strconv.Atoi(f)
+		if err != nil || i < 1 || i > n {
+			return nil, fmt.Errorf("无效的编号: %s（共 %d 项）", f, n)
+		}
+		if !seen[i-1] {
+			seen[i-1] = true
+			out = append(out, i-1)
+		}
+	}
+	sort.Ints(out)
+	return out, nil
+}
+
+func (r *Router) cmdReviewLocal(ctx context.Context, chatID, args string) {
+	sub, rest, _ := strings.Cut(args, " ")
+	switch sub {
+	case "":
+	case "apply":
+		r.applyReviewFixes(ctx, chatID, rest)
+		return
+	default:
+		r.sender.SendText(ctx, chatID, "用法:\n/review-local  审查当前仓库未提交的变更（缺陷、安全、风格）\n/review-local apply [编号|all]  让 Claude 应用审查给出的修复建议，如 /review-local apply 1,3")
+		return
+	}
+
+	session := r.getSession(chatID)
+	diff, untracked, err := localChanges(session.WorkDir)
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("当前目录不是 git 仓库: %s", session.WorkDir))
+		return
+	}
+	if diff == "" && len(untracked) == 0 {
+		r.sender.SendText(ctx, chatID, "没有任何未提交的更改。")
+		return
+	}
+	template, rubric := r.pickTemplate(templateReview)
+	prompt := reviewPrompt(rubric, diff, untracked)
+
+	id := newExecID()
+	if r.queue == nil {
+		r.runReview(ctx, chatID, id, template, prompt)
+		return
+	}
+	r.setQueued(ExecRecord{ID: id, ChatID: chatID, Prompt: "/review-local", StartedAt: time.Now()})
+	pos, err := r.queue.EnqueueTask(chatID, QueueEntry{ID: id}, func() {
+		r.runReview(r.ctx, chatID, id, template, prompt)
+	})
+	if err != nil {
+		r.clearQueued(id)
+		r.sender.SendText(ctx, chatID, "队列已满，请稍后再试。")
+		return
+	}
+	if pos > 1 {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("已排队（第 %d 位）", pos), Content: "当前有任务正在执行，请稍候...", Template: "blue"})
+	}
+}
+
+// runReview runs the review in a fresh session in safe mode, so that it
+// neither edits files nor pollutes the chat's conversation, and posts the
+// findings as a checklist. The findings are kept for /review-local apply;
+// template names the rubric variant used.
+func (r *Router) runReview(ctx context.Context, chatID, id, template, prompt string) {
+	r.clearQueued(id)
+	r.sender.SendText(ctx, chatID, "审查本地变更中...")
+
+	workDir, _, _, model := r.store.SessionExecParams(chatID)
+	startTime := time.Now()
+	rec := ExecRecord{
+		ID:             id,
+		ChatID:         chatID,
+		Prompt:         "/review-local",
+		WorkDir:        workDir,
+		StartedAt:      startTime,
+		Model:          model,
+		PermissionMode: "safe",
+		GitHead:        gitHead(workDir),
+		Template:       template,
+	}
+	r.setActive(rec)
+	defer r.clearActive(id)
+
+	result, err := r.executor.ExecStream(ctx, prompt, workDir, "", "safe", model, nil)
+	rec.Duration = time.Since(startTime)
+	rec.SessionID = result.SessionID
+	rec.setResultMeta(result)
+	var findings []reviewFinding
+	if err != nil {
+		rec.Error = err.Error()
+	} else {
+		rec.Output = result.Output
+		findings, err = parseReviewFindings(result.Output)
+	}
+	r.addExecRecord("review", rec)
+	r.save()
+
+	elapsed := rec.Duration.Truncate(time.Second)
+	if rec.Error != "" {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("执行出错（%s）", elapsed), Content: rec.Error, Template: "red"})
+		return
+	}
+	var buttons []CardButton
+	if r.feedbackButtons {
+		buttons = feedbackButtons(id)
+	}
+	if err != nil {
+		// Not the requested format: show the review as prose.
+		r.setReview(chatID, nil)
+		shown, full := r.fitOutput(chatID, "review", strings.TrimSpace(result.Output), true, "内容过长")
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "本地审查结果", Content: shown, Template: "orange", Buttons: buttons})
+		r.sendFullOutput(ctx, chatID, full)
+		return
+	}
+	r.setReview(chatID, findings)
+
+	scope := ""
+	if stat, _ := runGitOutput(workDir, "diff", "HEAD", "--shortstat"); stat != "" {
+		scope = fmt.Sprintf("**范围:** %s\n\n", stat)
+	}
+	if len(findings) == 0 {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "✓ 本地审查通过", Content: scope + "未发现缺陷、安全或风格问题，可以 /commit 提交。", Template: "green", Buttons: buttons})
+		return
+	}
+	tpl := "orange"
+	for _, f := range findings {
+		if f.Category != "style" && f.Severity == "high" {
+			tpl = "red"
+		}
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{
+		Title:    fmt.Sprintf("本地审查: %d 项发现（%s）", len(findings), elapsed),
+		Content:  scope + formatReviewChecklist(findings) + "\n\n发送 /review-local apply 应用全部修复建议，或 /review-local apply 1,3 只应用部分。",
+		Template: tpl,
+		Buttons:  buttons,
+	})
+}
+
+func (r *Router) setReview(chatID string, findings []reviewFinding) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(findings) == 0 {
+		delete(r.reviews, chatID)
+		return
+	}
+	r.reviews[chatID] = findings
+}
+
+// takeReview returns and forgets the last review findings of chatID.
+func (r *Router) takeReview(chatID string) []reviewFinding {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	findings := r.reviews[chatID]
+	delete(r.reviews, chatID)
+	return findings
+}
+
+// applyReviewFixes queues a regular execution in the chat's session that
+// applies the selected fix suggestions of the last review.
+func (r *Router) applyReviewFixes(ctx context.Context, chatID, args string) {
+	r.mu.Lock()
+	findings := r.reviews[chatID]
+	r.mu.Unlock()
+	if len(findings) == 0 {
+		r.sender.SendText(ctx, chatID, "没有待应用的审查建议，请先执行 /review-local。")
+		return
+	}
+	idx, err := parseFindingSelection(args, len(findings))
+	if err != nil {
+		r.sender.SendText(ctx, chatID, err.Error())
+		return
+	}
+	r.takeReview(chatID)
+
+	var sb strings.Builder
+	sb.WriteString("请修复本地代码审查发现的以下问题，只修改与这些问题相关的代码，完成后简要说明每项的处理结果：\n")
+	for _, i := range idx {
+		f := findings[i]
+		fmt.Fprintf(&sb, "\n%d. [%s] %s — %s", i+1, f.Category, f.location(), f.Issue)
+		if f.Fix != "" {
+			fmt.Fprintf(&sb, "\n   建议: %s", f.Fix)
+		}
+	}
+	r.enqueueExec(ctx, chatID, sb.String(), execOptions{})
+}
@@ -0,0 +1,147 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseReviewFindings(t *testing.T) {
+	findings, err := parseReviewFindings("```json\n{\"findings\": [{\"category\": \"Security\", \"severity\": \"HIGH\", \"file\": \"a.go\", \"line\": 3, \"issue\": \"x\"}, {\"category\": \"perf\", \"file\": \"b.go\"}]}\n```")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(findings) != 2 || findings[0].Category != "security" || findings[0].Severity != "high" || findings[1].Category != "style" {
+		t.Fatalf("unexpected findings %+v", findings)
+	}
+	if findings, err := parseReviewFindings(`[{"category":"bug","file":"c.go"}]`); err != nil || len(findings) != 1 {
+		t.Fatalf("expected bare array to parse, got %+v, %v", findings, err)
+	}
+	if findings, err := parseReviewFindings(`{"findings": []}`); err != nil || len(findings) != 0 {
+		t.Fatalf("expected empty findings, got %+v, %v", findings, err)
+	}
+	for _, bad := range []string{"", "looks good to me", `{"ok": true}`} {
+		if _, err := parseReviewFindings(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestFormatReviewChecklist(t *testing.T) {
+	got := formatReviewChecklist([]reviewFinding{
+		{Category: "style", File: "a.go", Issue: "naming"},
+		{Category: "bug", Severity: "high", File: "b.go", Line: 12, Issue: "nil deref", Fix: "check err"},
+	})
+	want := "**🐛 缺陷（1）**\n☐ 2. [high] `b.go:12` nil deref\n　　建议: check err\n\n**🎨 风格（1）**\n☐ 1. `a.go` naming"
+	if got != want {
+		t.Fatalf("unexpected checklist:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestParseFindingSelection(t *testing.T) {
+	if got, err := parseFindingSelection("", 3); err != nil || len(got) != 3 {
+		t.Fatalf("expected all findings, got %v, %v", got, err)
+	}
+	if got, err := parseFindingSelection("3, 1，3", 3); err != nil || len(got) != 2 || got[0] != 0 || got[1] != 2 {
+		t.Fatalf("unexpected selection %v, %v", got, err)
+	}
+	for _, bad := range []string{"0", "4", "x"} {
+		if _, err := parseFindingSelection(bad, 3); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+// newReviewRouter returns a router whose claude script answers with outputs
+// (see newJSONRouter) and whose chat1 works in a git repository with an
+// uncommitted change and an untracked file.
+func newReviewRouter(t *testing.T, outputs ...string) (*Router, *spySender, string) {
+	t.Helper()
+	sender := &spySender{}
+	r, prompts := newJSONRouter(t, sender, outputs...)
+	repo := filepath.Join(t.TempDir(), "repo")
+	initTestRepo(t, repo, map[string]string{"main.go": "package main\n"})
+	os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n\nfunc unsafe() {}\n"), 0644)
+	os.WriteFile(filepath.Join(repo, "new.go"), []byte("package main\n"), 0644)
+	r.getSession("chat1")
+	r.store.UpdateSession("chat1", func(s *Session) { s.WorkDir = repo; s.ClaudeSessionID = "chat-session" })
+	return r, sender, prompts
+}
+
+func TestRouterReviewLocal_Findings(t *testing.T) {
+	findings := `{"findings": [{"category": "bug", "severity": "high", "file": "main.go", "line": 3, "issue": "unused function", "fix": "remove it"}, {"category": "style", "severity": "low", "file": "new.go", "issue": "empty file", "fix": "add a doc comment"}]}`
+	r, sender, prompts := newReviewRouter(t, jsonString(findings), jsonString("fixed"))
+
+	r.Route(context.Background(), "chat1", "user1", "/review-local")
+	msg := sender.LastMessage()
+	for _, want := range []string{"本地审查: 2 项发现", "1 file changed", "☐ 1. [high] `main.go:3` unused function", "建议: remove it", "☐ 2. [low] `new.go` empty file", "/review-local apply"} {
+		if !strings.Contains(msg, want) {
+			t.Fatalf("expected %q in card, got %q", want, msg)
+		}
+	}
+	logged, _ := os.ReadFile(prompts)
+	for _, want := range []string{"+func unsafe() {}", "- new.go", "不要修改任何文件"} {
+		if !strings.Contains(string(logged), want) {
+			t.Fatalf("expected %q in review prompt, got %s", want, logged)
+		}
+	}
+	if strings.Contains(string(logged), "--resume") {
+		t.Fatalf("expected review to run in a fresh session, got %s", logged)
+	}
+	if sess := r.getSession("chat1"); sess.ClaudeSessionID != "chat-session" {
+		t.Fatalf("expected chat session to be untouched, got %q", sess.ClaudeSessionID)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/review-local apply 5")
+	if !strings.Contains(sender.LastMessage(), "无效的编号: 5") {
+		t.Fatalf("expected invalid selection, got %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/review-local apply 2")
+	logged, _ = os.ReadFile(prompts)
+	runs := strings.Split(strings.TrimSuffix(string(logged), "---END---\n"), "---END---\n")
+	last := runs[len(runs)-1]
+	if !strings.Contains(last, "2. [style] new.go — empty file") || strings.Contains(last, "unused function") || !strings.Contains(last, "--resume chat-session") {
+		t.Fatalf("expected selected fix in the chat session, got %s", last)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/review-local apply")
+	if !strings.Contains(sender.LastMessage(), "没有待应用的审查建议") {
+		t.Fatalf("expected findings to be consumed, got %q", sender.LastMessage())
+	}
+}
+
+func TestRouterReviewLocal_Clean(t *testing.T) {
+	r, sender, _ := newReviewRouter(t, jsonString(`{"findings": []}`))
+	r.Route(context.Background(), "chat1", "user1", "/review-local")
+	if !strings.HasPrefix(sender.LastMessage(), "✓ 本地审查通过") {
+		t.Fatalf("expected passing review, got %q", sender.LastMessage())
+	}
+	recs := r.store.ExecRecords("chat1", 0)
+	if len(recs) != 1 || recs[0].Prompt != "/review-local" || recs[0].PermissionMode != "safe" {
+		t.Fatalf("expected review to be recorded, got %+v", recs)
+	}
+}
+
+func TestRouterReviewLocal_ProseFallback(t *testing.T) {
+	r, sender, _ := newReviewRouter(t, jsonString("Looks fine overall, but consider renaming unsafe()."))
+	r.Route(context.Background(), "chat1", "user1", "/review-local")
+	if !strings.Contains(sender.LastMessage(), "本地审查结果") || !strings.Contains(sender.LastMessage(), "renaming unsafe()") {
+		t.Fatalf("expected prose review, got %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/review-local apply")
+	if !strings.Contains(sender.LastMessage(), "没有待应用的审查建议") {
+		t.Fatalf("expected nothing to apply, got %q", sender.LastMessage())
+	}
+}
+
+func TestRouterReviewLocal_NoChanges(t *testing.T) {
+	r, sender, _ := newReviewRouter(t, jsonString(`{"findings": []}`))
+	repo := r.getSession("chat1").WorkDir
+	os.Remove(filepath.Join(repo, "new.go"))
+	os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n"), 0644)
+	r.Route(context.Background(), "chat1", "user1", "/review-local")
+	if sender.LastMessage() != "没有任何未提交的更改。" {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+}
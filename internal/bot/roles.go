@@ -0,0 +1,115 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// Role is what a user may do with the bot. Admins are admin_user_ids,
+// read-only users readonly_user_ids, and every other allowed user is an
+// operator.
+type Role int
+
+const (
+	RoleReadOnly Role = iota
+	RoleOperator
+	RoleAdmin
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleAdmin:
+		return "管理员"
+	case RoleOperator:
+		return "操作员"
+	default:
+		return "只读用户"
+	}
+}
+
+// The permission table. Commands not listed need an operator.
+var (
+	// readOnlyCommands only show state, so read-only users may run them.
+	readOnlyCommands = map[string]bool{"/help": true, "/status": true, "/last": true, "/log": true, "/file": true}
+	// hostCommands expose the bot host rather than a workdir and always
+	// need an admin.
+	hostCommands = map[string]bool{"/ps": true, "/port": true, "/admin": true, "/loglevel": true, "/tasks": true}
+	// elevatedCommands change where and how freely commands run, or run
+	// arbitrary shell (/run runs .devbot.yaml commands). They need an
+	// admin once admin_user_ids is configured; before that operators keep
+	// them, as they had before roles existed.
+	elevatedCommands = map[string]bool{"/root": true, "/yolo": true, "/exec": true, "/sh": true, "/shell": true, "/run": true}
+)
+
+// SetReadOnlyUsers sets the users limited to readOnlyCommands.
+func (r *Router) SetReadOnlyUsers(ids map[string]bool) {
+	r.readOnly = ids
+}
+
+// userRole returns userID's role.
+func (r *Router) userRole(userID string) Role {
+	switch {
+	case r.admins[userID]:
+		return RoleAdmin
+	case r.readOnly[userID]:
+		return RoleReadOnly
+	default:
+		return RoleOperator
+	}
+}
+
+// requiredRole returns the lowest role that may run cmd.
+func (r *Router) requiredRole(cmd string) Role {
+	switch {
+	case hostCommands[cmd]:
+		return RoleAdmin
+	case elevatedCommands[cmd]:
+		if len(r.admins) > 0 {
+			return RoleAdmin
+		}
+		return RoleOperator
+	case readOnlyCommands[cmd]:
+		return RoleReadOnly
+	default:
+		return RoleOperator
+	}
+}
+
+// commandDenied reports whether userID's role may not run cmd, telling the
+// chat so.
+func (r *Router) commandDenied(ctx context.Context, chatID, userID, cmd string) bool {
+	role, need := r.userRole(userID), r.requiredRole(cmd)
+	if role >= need {
+		return false
+	}
+	slog.WarnContext(ctx, "router: command denied", "command", cmd, "user_id", userID, "role", role)
+	if need == RoleAdmin {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("%s 仅限管理员使用（admin_user_ids）。", cmd))
+	} else {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("%s 不可用：你是只读用户，只能使用 %s。", cmd, readOnlyCommandList()))
+	}
+	return true
+}
+
+// promptDenied reports whether userID may not send prompts or uploads to
+// Claude, telling the chat so.
+func (r *Router) promptDenied(ctx context.Context, chatID, userID string) bool {
+	if r.userRole(userID) >= RoleOperator {
+		return false
+	}
+	slog.WarnContext(ctx, "router: prompt denied for read-only user", "user_id", userID)
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("你是只读用户，不能向 Claude 发送消息或文件，只能使用 %s。", readOnlyCommandList()))
+	return true
+}
+
+func readOnlyCommandList() string {
+	cmds := make([]string, 0, len(readOnlyCommands))
+	for c := range readOnlyCommands {
+		cmds = append(cmds, c)
+	}
+	sort.Strings(cmds)
+	return strings.Join(cmds, "、")
+}
@@ -0,0 +1,118 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newRolesRouter(t *testing.T) (*Router, *spySender) {
+	t.Helper()
+	dir := t.TempDir()
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	sender := &spySender{}
+	users := map[string]bool{"admin": true, "op": true, "viewer": true}
+	r := NewRouter(context.Background(), NewClaudeExecutor("/nonexistent_binary_for_test", "sonnet", 10*time.Second), store, sender, users, dir, nil)
+	r.SetReadOnlyUsers(map[string]bool{"viewer": true})
+	return r, sender
+}
+
+func TestRoles_ReadOnly(t *testing.T) {
+	r, sender := newRolesRouter(t)
+	ctx := context.Background()
+
+	for _, cmd := range []string{"/status", "/last", "/log", "/file state.json", "/help"} {
+		sender.messages = nil
+		r.Route(ctx, "chat1", "viewer", cmd)
+		if msg := sender.LastMessage(); strings.Contains(msg, "只读用户") {
+			t.Errorf("%s denied for a read-only user: %q", cmd, msg)
+		}
+	}
+	for _, cmd := range []string{"/diff", "/new", "/exec ls", "/git status", "/say hi"} {
+		r.Route(ctx, "chat1", "viewer", cmd)
+		want := strings.Fields(cmd)[0] + " 不可用：你是只读用户，只能使用 /file、/help、/last、/log、/status。"
+		if msg := sender.LastMessage(); msg != want {
+			t.Errorf("%s: got %q, want %q", cmd, msg, want)
+		}
+	}
+
+	r.Route(ctx, "chat1", "viewer", "fix the bug")
+	if msg := sender.LastMessage(); !strings.HasPrefix(msg, "你是只读用户，不能向 Claude 发送消息") {
+		t.Fatalf("prompt = %q", msg)
+	}
+	sender.messages = nil
+	r.RouteFile(ctx, "chat1", "viewer", "notes.txt", []byte("x"))
+	r.RouteImage(ctx, "chat1", "viewer", []byte("png"), "a.png")
+	if len(sender.messages) != 2 || !strings.HasPrefix(sender.messages[1], "你是只读用户") {
+		t.Fatalf("uploads = %q", sender.messages)
+	}
+	if fileExists(filepath.Join(r.store.WorkRoot(), "notes.txt")) {
+		t.Fatal("file from a read-only user was saved")
+	}
+}
+
+func TestRoles_ElevatedCommands(t *testing.T) {
+	r, sender := newRolesRouter(t)
+	ctx := context.Background()
+
+	// Without admins configured, operators keep /exec and /yolo.
+	r.Route(ctx, "chat1", "op", "/exec echo hi")
+	if msg := sender.LastMessage(); strings.Contains(msg, "仅限管理员") {
+		t.Fatalf("operator denied without admins: %q", msg)
+	}
+
+	r.SetAdmins(map[string]bool{"admin": true})
+	for _, cmd := range []string{"/exec echo hi", "/yolo", "/root /tmp", "/sh ls", "/ps"} {
+		r.Route(ctx, "chat1", "op", cmd)
+		want := strings.Fields(cmd)[0] + " 仅限管理员使用（admin_user_ids）。"
+		if msg := sender.LastMessage(); msg != want {
+			t.Errorf("%s: got %q, want %q", cmd, msg, want)
+		}
+	}
+	if r.getSession("chat1").PermissionMode == "yolo" {
+		t.Fatal("operator switched to yolo")
+	}
+	r.Route(ctx, "chat1", "op", "/pwd")
+	if msg := sender.LastMessage(); strings.Contains(msg, "仅限管理员") {
+		t.Fatalf("operator denied /pwd: %q", msg)
+	}
+
+	r.Route(ctx, "chat1", "admin", "/yolo")
+	if r.getSession("chat1").PermissionMode != "yolo" {
+		t.Fatalf("admin /yolo: %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "viewer", "/exec ls")
+	if msg := sender.LastMessage(); msg != "/exec 仅限管理员使用（admin_user_ids）。" {
+		t.Fatalf("read-only /exec = %q", msg)
+	}
+}
+
+func TestRoles_NoShellThroughForeachOrVerify(t *testing.T) {
+	r, sender := newRolesRouter(t)
+	r.SetAdmins(map[string]bool{"admin": true})
+	ctx := context.Background()
+	os.MkdirAll(filepath.Join(r.store.WorkRoot(), "svc"), 0755)
+
+	r.Route(ctx, "chat1", "op", "/foreach svc /exec touch pwned")
+	if msg := sender.LastMessage(); msg != "/exec 仅限管理员使用（admin_user_ids）。" {
+		t.Fatalf("/foreach /exec = %q", msg)
+	}
+	r.Route(ctx, "chat1", "op", "/verify touch pwned")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "仅限管理员") {
+		t.Fatalf("/verify <cmd> = %q", msg)
+	}
+	if _, ok := r.store.Verifier(repoRoot(r.store.WorkRoot())); ok {
+		t.Fatal("operator set a verification command")
+	}
+	if _, err := os.Stat(filepath.Join(r.store.WorkRoot(), "svc", "pwned")); err == nil {
+		t.Fatal("operator ran shell through /foreach")
+	}
+
+	r.Route(ctx, "chat1", "admin", "/verify true")
+	if _, ok := r.store.Verifier(repoRoot(r.store.WorkRoot())); !ok {
+		t.Fatalf("admin /verify: %q", sender.LastMessage())
+	}
+}
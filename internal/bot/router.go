@@ -3,40 +3,217 @@ package bot
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"devbot/internal/version"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
 )
 
 type Router struct {
-	executor     *ClaudeExecutor
+	executor     Executor
 	store        *Store
 	sender       Sender
 	allowedUsers map[string]bool
+	admins       map[string]bool // RoleAdmin users
+	readOnly     map[string]bool // RoleReadOnly users
 	startTime    time.Time
+	metrics      *ExecMetrics
 	queue        *MessageQueue
 	docSyncer    DocPusher
+	cache        *KnowledgeCache
+	watcher      *Watcher
+	hookURL      string
 	ctx          context.Context
-}
 
-func NewRouter(ctx context.Context, executor *ClaudeExecutor, store *Store, sender Sender, allowedUsers map[string]bool, workRoot string, docSyncer DocPusher) *Router {
+	// /licenses policy: denied licenses (lower-case SPDX IDs) and whether
+	// violations block /pr.
+	licenseDeny    map[string]bool
+	licenseBlockPR bool
+
+	// /buildbin: default GOOS/GOARCH targets and optional artifact store.
+	buildTargets []string
+	artifactDir  string
+
+	// /docker build: registry to push to, the user to log in as, and the
+	// secrets store holding its password.
+	dockerRegistry string
+	dockerUsername string
+	secrets        *Secrets
+
+	// /tail: named systemd/docker services.
+	tailServices map[string]string
+
+	// Read-only reference directories by name, possibly outside the root.
+	refDirs map[string]string
+
+	// 👍/👎 buttons under result cards (see /feedback).
+	feedbackButtons bool
+	// Variants of the bot's own prompts, by kind (see /experiments).
+	promptTemplates map[string][]PromptTemplate
+
+	// /db: configured connections and the row limit per query.
+	dbConns   []DBConnection
+	dbMaxRows int
+
+	// cleanRules are what /clean build removes in each project.
+	cleanRules []CleanRule
+
+	// formatAfterExec formats files changed by executions; formatters
+	// override the default formatter per extension.
+	formatAfterExec bool
+	formatters      map[string]string
+	// Output post-processing: the pipeline's step names, per-chat
+	// replacements, and the settings of the local_links and translate
+	// steps.
+	outputProcessors     []string
+	chatOutputProcessors map[string][]string
+	repoBrowserURL       string
+	translateTo          string
+	// testShards is how many go test processes /test splits packages across.
+	testShards int
+	// maxPromptChars is the size above which typed prompts are trimmed
+	// (<= 0: never).
+	maxPromptChars int
+	// Repository refresh on activity after idle (see /sync): the expected
+	// branch, the mode, the idle time and when each chat last refreshed
+	// (guarded by mu).
+	defaultBranch string
+	repoSyncMode  string
+	repoSyncIdle  time.Duration
+	repoSynced    map[string]time.Time
+	repoSyncDue   map[string]bool // chats to refresh before their next run
+	// Build cache warming: how often, for how many repositories, and the
+	// statistics /status shows (guarded by mu).
+	cacheWarmInterval time.Duration
+	cacheWarmRepos    int
+	buildCache        buildCacheStats
+
+	// /curl: allowed hosts, request timeout and shown response size.
+	curlHosts   []string
+	curlTimeout time.Duration
+	curlMaxBody int
+
+	// scratchRoot holds a scratch directory per chat for uploads and
+	// Claude's temporary files.
+	scratchRoot string
+
+	// trashRetention is how long files saved before a deletion are kept.
+	trashRetention time.Duration
+
+	// summaryModel summarizes sessions archived by /new ("" = off).
+	summaryModel string
+
+	// costConfirmTokens is the estimated prompt size that needs /confirm.
+	costConfirmTokens int
+
+	// /share: paste provider ("gist" or "paste"), its endpoint and how
+	// long shared results stay up.
+	shareProvider string
+	shareURL      string
+	shareExpiry   time.Duration
+
+	// reportFolder is the Feishu folder /report week writes to.
+	reportFolder string
+	// guestURL is the public web server URL /guest links point to.
+	guestURL string
+	// Repeated-failure issues: failures of one prompt within issueWindow
+	// that trigger an issue (0 = off), and whether to file it unasked.
+	issueAfter  int
+	issueWindow time.Duration
+	issueAuto   bool
+	// State backups: local directory, interval, copies kept and optional
+	// S3-compatible upload target.
+	backupDir      string
+	backupInterval time.Duration
+	backupKeep     int
+	backupS3URL    string
+	backupS3Region string
+	// calendar, when set, receives /remind reminders on calendarID.
+	calendar   Calendar
+	calendarID string
+	// approvalRules hold matching commands until approved.
+	approvalRules []approvalRule
+
+	// /json structured output: optional schema and how many times an
+	// invalid payload is sent back to Claude for correction.
+	jsonSchema     *jsonschema.Schema
+	jsonSchemaText string
+	jsonRetries    int
+
+	mu     sync.Mutex
+	active map[string]ExecRecord // in-flight executions keyed by exec ID
+	queued map[string]ExecRecord // executions waiting in the queue
+	// cancel funcs of the executions /kill <id> can stop, by exec ID
+	kills map[string]context.CancelFunc
+	// options of the queued prompts, to queue them again after a restart
+	queuedOpts map[string]execOptions
+	// .devbot.yaml of the repositories used, by root
+	repoConfigs map[string]*repoConfigEntry
+	// last /review-local findings per chat, for /review-local apply
+	reviews map[string][]reviewFinding
+	// running /tail follow per chat
+	tails map[string]*tailFollow
+	// running /shell session per chat
+	shells map[string]*shellSession
+	// deletions waiting for /confirm or /deny per chat
+	pendingDeletes map[string]*pendingDelete
+	// prompts waiting for cost confirmation, keyed by ID
+	pendingPrompts map[string]*pendingPrompt
+	// prompts waiting for the user to review suggested files, keyed by ID
+	pendingFocus map[string]*pendingFocus
+	// recent outputs shown truncated, oldest first, for /output
+	fullOutputs []*fullOutput
+	// commands waiting for approvers, keyed by ID
+	pendingApprovals map[string]*pendingApproval
+	// /write or /append waiting for content in the next message, per chat
+	pendingWrites map[string]*pendingWrite
+}
+
+func NewRouter(ctx context.Context, executor Executor, store *Store, sender Sender, allowedUsers map[string]bool, workRoot string, docSyncer DocPusher) *Router {
 	if store.WorkRoot() == "" {
 		store.SetWorkRoot(workRoot)
 	}
 	return &Router{
-		executor:     executor,
-		store:        store,
-		sender:       sender,
-		allowedUsers: allowedUsers,
-		startTime:    time.Now(),
-		docSyncer:    docSyncer,
-		ctx:          ctx,
+		executor:        executor,
+		store:           store,
+		sender:          sender,
+		allowedUsers:    allowedUsers,
+		startTime:       time.Now(),
+		metrics:         NewExecMetrics(),
+		docSyncer:       docSyncer,
+		ctx:             ctx,
+		jsonRetries:     defaultJSONRetries,
+		feedbackButtons: true,
+		active:          make(map[string]ExecRecord),
+		queued:          make(map[string]ExecRecord),
+		kills:           make(map[string]context.CancelFunc),
+		queuedOpts:      make(map[string]execOptions),
+		repoConfigs:     make(map[string]*repoConfigEntry),
+		reviews:         make(map[string][]reviewFinding),
+		tails:           make(map[string]*tailFollow),
+		shells:          make(map[string]*shellSession),
+		repoSynced:      make(map[string]time.Time),
+		maxPromptChars:  defaultMaxPromptChars,
+		repoSyncDue:     make(map[string]bool),
+
+		pendingDeletes: make(map[string]*pendingDelete),
+		pendingPrompts: make(map[string]*pendingPrompt),
+		pendingFocus:   make(map[string]*pendingFocus),
+
+		pendingApprovals: make(map[string]*pendingApproval),
+		pendingWrites:    make(map[string]*pendingWrite),
 	}
 }
 
@@ -44,30 +221,146 @@ func (r *Router) SetQueue(q *MessageQueue) {
 	r.queue = q
 }
 
+// ActiveExecs returns the executions currently running, oldest first.
+func (r *Router) ActiveExecs() []ExecRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]ExecRecord, 0, len(r.active))
+	for _, rec := range r.active {
+		out = append(out, rec)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.Before(out[j].StartedAt) })
+	return out
+}
+
+func (r *Router) setActive(rec ExecRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.active[rec.ID] = rec
+}
+
+func (r *Router) clearActive(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.active, id)
+	delete(r.kills, id)
+}
+
+func (r *Router) setQueued(rec ExecRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queued[rec.ID] = rec
+}
+
+// clearQueued removes id from the queued executions and returns its record.
+func (r *Router) clearQueued(id string) ExecRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec := r.queued[id]
+	delete(r.queued, id)
+	delete(r.queuedOpts, id)
+	return rec
+}
+
+// queuedExec returns the queued execution with the given ID.
+func (r *Router) queuedExec(id string) (ExecRecord, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.queued[id]
+	return rec, ok
+}
+
+// Execution states reported by LookupExec.
+const (
+	ExecQueued    = "queued"
+	ExecRunning   = "running"
+	ExecSucceeded = "succeeded"
+	ExecFailed    = "failed"
+)
+
+// LookupExec finds an execution by ID among queued, running and finished
+// executions and reports its state.
+func (r *Router) LookupExec(id string) (ExecRecord, string, bool) {
+	r.mu.Lock()
+	if rec, ok := r.queued[id]; ok {
+		r.mu.Unlock()
+		return rec, ExecQueued, true
+	}
+	if rec, ok := r.active[id]; ok {
+		r.mu.Unlock()
+		return rec, ExecRunning, true
+	}
+	r.mu.Unlock()
+	rec, ok := r.store.ExecRecord(id)
+	if !ok {
+		return ExecRecord{}, "", false
+	}
+	if rec.Error != "" {
+		return rec, ExecFailed, true
+	}
+	return rec, ExecSucceeded, true
+}
+
 func (r *Router) save() {
 	if err := r.store.Save(); err != nil {
-		log.Printf("router: failed to save state: %v", err)
+		slog.Warn("router: failed to save state", "err", err)
 	}
 }
 
 func (r *Router) Route(ctx context.Context, chatID, userID, text string) {
 	if !r.allowedUsers[userID] {
-		log.Printf("router: unauthorized user=%s, ignoring", userID)
+		slog.WarnContext(ctx, "router: unauthorized, ignoring", "user_id", userID)
 		return
 	}
+	ctx = withLogFields(ctx, "chat_id", chatID, "user_id", userID)
 
 	text = strings.TrimSpace(text)
 	if text == "" {
 		return
 	}
 
-	if strings.HasPrefix(text, "/") {
-		log.Printf("router: command %s from chat=%s", strings.SplitN(text, " ", 2)[0], chatID)
-		r.handleCommand(ctx, chatID, text)
+	session := r.getSession(chatID)
+	r.noteIncident(chatID, userID, text, session)
+	cmdText, isCommand := commandText(session, text)
+	if isCommand {
+		name := strings.SplitN(cmdText, " ", 2)[0]
+		ctx = withLogFields(ctx, "command", name)
+		slog.InfoContext(ctx, "router: command")
+		if r.commandDenied(ctx, chatID, userID, strings.ToLower(name)) {
+			return
+		}
+		if r.holdForApproval(ctx, chatID, userID, cmdText) {
+			return
+		}
+		r.handleCommand(withUserID(ctx, userID), chatID, cmdText)
+		return
+	}
+	if w := r.takePendingWrite(chatID, userID); w != nil {
+		name := "/write"
+		if w.append {
+			name = "/append"
+		}
+		if !r.commandDenied(ctx, chatID, userID, name) {
+			r.writeFile(ctx, chatID, *w, text)
+		}
+		return
+	}
+	if strings.HasPrefix(text, ">") && r.hasShell(chatID) {
+		if !r.commandDenied(ctx, chatID, userID, "/shell") && !r.holdForApproval(ctx, chatID, userID, text) {
+			r.shellInput(ctx, chatID, text)
+		}
+		return
+	}
+	if session.BareCommands {
+		r.sender.SendText(ctx, chatID, "这是命令专用聊天，消息不会发给 Claude。直接发送命令名（如 status、diff）执行命令，发送 help 查看全部命令；/say <内容> 发给 Claude；/prefix bare off 关闭此模式。")
+		return
+	}
+	if r.promptDenied(ctx, chatID, userID) {
 		return
 	}
 
-	r.handlePrompt(ctx, chatID, text)
+	// cmdText is the prompt with a leading "//" escape taken off.
+	r.handlePrompt(ctx, chatID, cmdText)
 }
 
 func (r *Router) handleCommand(ctx context.Context, chatID, text string) {
@@ -98,11 +391,37 @@ func (r *Router) handleCommand(ctx context.Context, chatID, text string) {
 	case "/new":
 		r.cmdNewSession(ctx, chatID)
 	case "/sessions":
-		r.cmdSessions(ctx, chatID)
+		r.cmdSessions(ctx, chatID, args)
+	case "/save":
+		r.cmdSave(ctx, chatID, args)
+	case "/load":
+		r.cmdLoad(ctx, chatID, args)
+	case "/rename":
+		r.cmdRename(ctx, chatID, args)
+	case "/export":
+		r.cmdExport(ctx, chatID, args)
 	case "/switch":
 		r.cmdSwitch(ctx, chatID, args)
+	case "/checkpoint":
+		r.cmdCheckpoint(ctx, chatID, args)
+	case "/checkpoints":
+		r.cmdCheckpoints(ctx, chatID)
+	case "/restore":
+		r.cmdRestore(ctx, chatID, args)
+	case "/handoff":
+		r.cmdHandoff(ctx, chatID, args)
 	case "/kill":
-		r.cmdKill(ctx, chatID)
+		r.cmdKill(ctx, chatID, args)
+	case "/trace":
+		r.cmdTrace(ctx, chatID, args)
+	case "/confirm":
+		r.cmdConfirm(ctx, chatID, args, true)
+	case "/deny":
+		r.cmdConfirm(ctx, chatID, args, false)
+	case "/approve":
+		r.cmdApprove(ctx, chatID, args, true)
+	case "/reject":
+		r.cmdApprove(ctx, chatID, args, false)
 	case "/model":
 		r.cmdModel(ctx, chatID, args)
 	case "/yolo":
@@ -113,16 +432,26 @@ func (r *Router) handleCommand(ctx context.Context, chatID, text string) {
 		r.cmdLast(ctx, chatID)
 	case "/summary":
 		r.cmdSummary(ctx, chatID)
+	case "/incident":
+		r.cmdIncident(ctx, chatID, args)
+	case "/catchup":
+		r.cmdCatchup(ctx, chatID, args)
 	case "/git":
 		r.cmdGit(ctx, chatID, args)
 	case "/diff":
 		r.cmdDiff(ctx, chatID)
+	case "/review-local":
+		r.cmdReviewLocal(ctx, chatID, args)
 	case "/commit":
 		r.cmdCommit(ctx, chatID, args)
 	case "/fetch":
 		r.cmdFetch(ctx, chatID, args)
 	case "/pull":
 		r.cmdPull(ctx, chatID, args)
+	case "/clone":
+		r.cmdClone(ctx, chatID, args)
+	case "/sync":
+		r.cmdSync(ctx, chatID, args)
 	case "/push":
 		r.cmdPush(ctx, chatID, args)
 	case "/undo":
@@ -136,7 +465,9 @@ func (r *Router) handleCommand(ctx context.Context, chatID, text string) {
 	case "/prs":
 		r.cmdPRList(ctx, chatID, args)
 	case "/issues":
-		r.cmdIssues(ctx, chatID, args)
+		r.cmdIssueList(ctx, chatID, args)
+	case "/issue":
+		r.cmdIssue(ctx, chatID, args)
 	case "/stash":
 		r.cmdStash(ctx, chatID, args)
 	case "/log":
@@ -148,9 +479,23 @@ func (r *Router) handleCommand(ctx context.Context, chatID, text string) {
 	case "/branch":
 		r.cmdBranch(ctx, chatID, args)
 	case "/cancel":
-		r.cmdKill(ctx, chatID)
+		r.cmdKill(ctx, chatID, args)
 	case "/retry":
 		r.cmdRetry(ctx, chatID)
+	case "/urgent":
+		r.cmdUrgent(ctx, chatID, args)
+	case "/force":
+		r.cmdForce(ctx, chatID, args)
+	case "/repro":
+		r.cmdRepro(ctx, chatID, args)
+	case "/json":
+		r.cmdJSON(ctx, chatID, args)
+	case "/queue":
+		r.cmdQueue(ctx, chatID)
+	case "/dequeue":
+		r.cmdDequeue(ctx, chatID, args)
+	case "/tasks":
+		r.cmdTasks(ctx, chatID)
 	case "/info":
 		r.cmdInfo(ctx, chatID)
 	case "/grep":
@@ -163,6 +508,82 @@ func (r *Router) handleCommand(ctx context.Context, chatID, text string) {
 		r.cmdFind(ctx, chatID, args)
 	case "/test":
 		r.cmdTest(ctx, chatID, args)
+	case "/sec":
+		r.cmdSec(ctx, chatID, args)
+	case "/lint":
+		r.cmdLint(ctx, chatID, args)
+	case "/run":
+		r.cmdRun(ctx, chatID, args)
+	case "/verify":
+		r.cmdVerify(ctx, chatID, args)
+	case "/protect":
+		r.cmdProtect(ctx, chatID, args)
+	case "/licenses":
+		r.cmdLicenses(ctx, chatID, args)
+	case "/buildbin":
+		r.cmdBuildBin(ctx, chatID, args)
+	case "/docker":
+		r.cmdDocker(ctx, chatID, args)
+	case "/shell":
+		r.cmdShell(ctx, chatID, args)
+	case "/tail":
+		r.cmdTail(ctx, chatID, args)
+	case "/head":
+		r.cmdHead(ctx, chatID, args)
+	case "/admin":
+		r.cmdAdmin(ctx, chatID, args)
+	case "/ps":
+		r.cmdPs(ctx, chatID, args)
+	case "/port":
+		r.cmdPort(ctx, chatID, args)
+	case "/db":
+		r.cmdDB(ctx, chatID, args)
+	case "/curl":
+		r.cmdCurl(ctx, chatID, args)
+	case "/scratch":
+		r.cmdScratch(ctx, chatID, args)
+	case "/get":
+		r.cmdGet(ctx, chatID, args)
+	case "/foreach":
+		r.cmdForeach(ctx, chatID, args)
+	case "/campaign":
+		r.cmdCampaign(ctx, chatID, args)
+	case "/about":
+		r.cmdAbout(ctx, chatID, args)
+	case "/focus":
+		r.cmdFocus(ctx, chatID, args)
+	case "/share":
+		r.cmdShare(ctx, chatID, args)
+	case "/remind":
+		r.cmdRemind(ctx, chatID, args)
+	case "/report":
+		r.cmdReport(ctx, chatID, args)
+	case "/output":
+		r.cmdOutput(ctx, chatID, args)
+	case "/ack":
+		r.cmdAck(ctx, chatID, args)
+	case "/prefix":
+		r.cmdPrefix(ctx, chatID, args)
+	case "/experiments":
+		r.cmdExperiments(ctx, chatID, args)
+	case "/loglevel":
+		r.cmdLogLevel(ctx, chatID, args)
+	case "/feedback":
+		r.cmdFeedback(ctx, chatID, args)
+	case "/label":
+		r.cmdLabel(ctx, chatID, args)
+	case "/history":
+		r.cmdHistory(ctx, chatID, args)
+	case "/guest":
+		r.cmdGuest(ctx, chatID, args)
+	case "/say":
+		if args == "" {
+			r.sender.SendText(ctx, chatID, "用法: /say <内容>\n原样发给 Claude，不当作命令解析（也可用 // 开头转义，如 //usr/bin 下有什么）。")
+			return
+		}
+		r.handlePrompt(ctx, chatID, args)
+	case "/trash":
+		r.cmdTrash(ctx, chatID, args)
 	case "/todo":
 		r.cmdTodo(ctx, chatID)
 	case "/recent":
@@ -175,17 +596,42 @@ func (r *Router) handleCommand(ctx context.Context, chatID, text string) {
 		r.cmdSize(ctx, chatID, args)
 	case "/stats":
 		r.cmdStats(ctx, chatID)
+	case "/cache":
+		r.cmdCache(ctx, chatID, args)
+	case "/watch":
+		r.cmdWatch(ctx, chatID, args)
+	case "/hooks":
+		r.cmdHooks(ctx, chatID, args)
+	case "/usage":
+		r.cmdUsage(ctx, chatID, args)
+	case "/audit":
+		r.cmdAudit(ctx, chatID, args)
 	case "/sh":
 		r.cmdSh(ctx, chatID, args)
 	case "/exec":
 		r.cmdExec(ctx, chatID, args)
 	case "/file":
 		r.cmdFile(ctx, chatID, args)
+	case "/write":
+		r.cmdWrite(ctx, chatID, args, false)
+	case "/append":
+		r.cmdWrite(ctx, chatID, args, true)
 	case "/doc":
 		r.cmdDoc(ctx, chatID, args)
 	default:
+		matches := completeCommand(cmd)
+		if len(matches) > 1 {
+			r.sender.SendCard(ctx, chatID, completionCard(cmd, matches))
+			return
+		}
 		msg := fmt.Sprintf("未知命令: %s\n\n使用 /help 查看所有可用命令。", cmd)
-		if suggestion := suggestCommand(cmd); suggestion != "" {
+		if len(matches) == 1 {
+			hint := "`" + matches[0] + "`"
+			if summary := commandSummary(matches[0]); summary != "" {
+				hint += "（" + summary + "）"
+			}
+			msg = fmt.Sprintf("未知命令: %s\n\n你是否想用 %s？\n\n使用 /help 查看完整命令列表。", cmd, hint)
+		} else if suggestion := suggestCommand(cmd); suggestion != "" {
 			msg = fmt.Sprintf("未知命令: %s\n\n你是否想用 `%s`？\n\n使用 /help 查看完整命令列表。", cmd, suggestion)
 		}
 		r.sender.SendText(ctx, chatID, msg)
@@ -196,72 +642,149 @@ func (r *Router) getSession(chatID string) Session {
 	return r.store.GetSession(chatID, r.store.WorkRoot(), r.executor.Model())
 }
 
+// helpText is the /help card; disambiguation hints reuse its one-line
+// descriptions.
+const helpText = "**🗺 导航:**\n" +
+	"`/info`  快速概览（目录、分支、变更、状态）\n" +
+	"`/root [path]`  查看/设置根工作目录\n" +
+	"`/cd <dir>`  切换项目目录（支持相对路径）\n" +
+	"`/pwd`  显示当前目录\n" +
+	"`/ls [dir]`  列出根目录下的项目（或指定子目录的文件）\n\n" +
+	"**🤖 Claude 对话:**\n" +
+	"`/status`  查看详细状态（含 git 信息）\n" +
+	"`/new`  开启新对话（保留当前会话到历史）\n" +
+	"`/kill [执行ID]`  终止正在执行的任务；带执行 ID 时只终止该次执行\n" +
+	"`/cancel`  同 /kill，终止当前任务\n" +
+	"`/trace <执行ID>`  查看一次执行的详情（状态、耗时、模型、提交、prompt、错误）；执行 ID 显示在相关卡片底部\n" +
+	"`/confirm` / `/deny`  允许或拒绝 Claude 暂停等待确认的删除操作（安全模式）\n" +
+	"`/confirm <ID>` / `/deny <ID>`  执行或取消因预计消耗较大而等待确认的 prompt\n" +
+	"`/approve [ID]` / `/reject <ID>`  批准或拒绝需要审批的命令；不带 ID 列出等待审批的命令\n" +
+	"`/checkpoint <说明>`  记录当前代码（git 提交）和 Claude 会话；`/checkpoints` 列出\n" +
+	"`/restore <序号>`  在工作树中检出检查点的提交并切换到当时的会话\n" +
+	"`/retry`  重试上一条发给 Claude 的消息并对比上次结果\n" +
+	"`/urgent <prompt>`  紧急任务：插到排队任务之前（不打断正在执行的任务）\n" +
+	"`/queue`  查看当前聊天的执行队列\n" +
+	"`/dequeue <执行ID>`  取消一个排队中的任务（`/kill <执行ID>` 对排队的任务也会取消）\n" +
+	"`/tasks`  查看所有聊天执行中和排队的任务（仅管理员，可 /kill 或 /dequeue 其他聊天的任务）\n" +
+	"`/force <prompt>`  即使相同请求已在排队也再执行一次\n" +
+	"`/repro <执行ID>`  在原提交的临时工作树中重放该次执行（排查不确定行为）\n" +
+	"`/json <prompt>`  要求 Claude 输出 JSON，校验后附上原始 JSON 文件（供脚本使用）\n" +
+	"`/last`  显示上次输出\n" +
+	"`/output limit <字符数>`  设置卡片显示的命令输出上限（超出部分以文件附上）；`/output <ID>` 获取被截断的完整输出或某次执行的完整输出\n" +
+	"`/ack react|text`  用表情回复代替「执行中...」和「完成」消息\n" +
+	"`/prefix <前缀>|default`  更换命令前缀（如 !）；`/prefix bare on|off`  命令专用聊天，命令可不带前缀\n" +
+	"`/label <标签> [执行ID]`  给执行记录加标签（默认最近一次）；`/label rm <标签> [执行ID]` 移除\n" +
+	"`/feedback [执行ID] up|down [说明]`  评价执行结果（默认最近一次，结果卡片下也有 👍/👎 按钮）；`/feedback stats [天数]` 查看好评率\n" +
+	"`/experiments [天数]`  比较 prompt_templates 中 /commit、/summary、/review-local 各模板变体的失败率、耗时和反馈\n" +
+	"`/history [label:<标签>] [关键词] [条数]`  按标签或关键词查看执行历史\n" +
+	"`/guest [执行ID] [有效期]`  生成执行结果的只读网页链接，供没有飞书或机器人权限的人查看；`/guest list|rm <ID>` 管理\n" +
+	"`/say <内容>`  把以 / 开头的内容原样发给 Claude（也可写成 `//内容`；/etc/hosts 这类路径开头的消息会自动发给 Claude）\n" +
+	"`/summary`  让 Claude 总结上次输出\n" +
+	"`/catchup [条数]`  总结聊天中最近的讨论并作为会话上下文\n" +
+	"`/incident start <标题>`  事故模式：置顶事故卡片、详细通知、执行标记事故；/incident end 生成时间线文档\n" +
+	"`/compact`  压缩当前对话上下文（节省 token，延长会话）\n" +
+	"`/model [name]`  查看/切换模型（haiku/sonnet/opus）\n" +
+	"`/yolo`  开启无限制模式（Claude 可执行所有操作）\n" +
+	"`/safe`  恢复安全模式\n\n" +
+	"**🔀 历史会话:**\n" +
+	"`/sessions [pick]`  查看历史会话列表（pick 以按钮选择）\n" +
+	"`/switch [id]`  切换到指定历史会话，不带参数时以按钮选择\n" +
+	"`/save [名称|rm 名称]`  给当前会话命名（记下工作目录和模型），不带参数时列出已命名的会话\n" +
+	"`/load <名称>`  恢复命名的会话，连同工作目录和模型\n" +
+	"`/rename <旧名称> <新名称>`  重命名已命名的会话\n" +
+	"`/export [会话] [doc]`  把会话的 prompt 和回复导出为 Markdown，保存到工作目录或（doc）推送为飞书文档\n" +
+	"`/handoff <聊天 ID> [备注]`  把当前会话交接到另一个聊天继续\n\n" +
+	"**🔧 Git:**\n" +
+	"`/diff`  查看当前变更\n" +
+	"`/log [n]`  查看提交历史（默认最近 20 条）\n" +
+	"`/show [commit]`  查看提交详情（默认最新提交 HEAD）\n" +
+	"`/blame <file>`  查看文件每行的最后修改者\n" +
+	"`/branch [name]`  查看分支列表或切换/创建分支\n" +
+	"`/review-local [apply [编号]]`  提交前自检：Claude 审查未提交的变更（缺陷、安全、风格），apply 应用修复建议\n" +
+	"`/commit [msg]`  提交（不填消息则 Claude 自动生成）\n" +
+	"`/fetch [args]`  从远程获取但不合并（即时响应，自动 prune）\n" +
+	"`/pull [args]`  从远程拉取，并更新子模块、下载 LFS 文件（即时响应）\n" +
+	"`/clone <url> [目录]`  克隆仓库到根目录下（含子模块和 LFS 文件）\n" +
+	"`/sync [now|off|fetch|pull|branch <分支>]`  设置默认分支和闲置后的自动 fetch/快进，`now` 立即检查\n" +
+	"`/push [args]`  推送到远程（即时响应）\n" +
+	"`/pr [title]`  创建 Pull Request（即时响应，使用 gh --fill 自动填充）\n" +
+	"`/prs [all|status]`  查看 PR 列表及 CI、评审状态（默认开放中，加 all 显示全部；GitLab 仓库使用 glab）\n" +
+	"`/pr view <编号>`  以卡片查看 PR 详情：分支、变更规模、检查结果、评审状态和描述\n" +
+	"`/issues [args]` / `/issue list [all|args]`  查看 Issue 列表（标签、评论数、指派人）\n" +
+	"`/issue view <编号>`  以卡片查看 Issue 详情和最近评论\n" +
+	"`/issue create <标题>`  Claude 根据最近的对话和仓库状态撰写正文后创建 Issue\n" +
+	"`/issue [执行ID]`  为失败的执行创建 GitHub issue\n" +
+	"`/undo`  ⚠️ 撤销所有未提交的更改（无变更时提示而非执行）\n" +
+	"`/stash [save <名称>|list|show|apply|pop|drop <n>]`  暂存、查看和恢复更改\n" +
+	"`/clean [-f]`  查看/清理未跟踪文件（默认预览，加 -f 确认删除）\n" +
+	"`/clean build [run]`  预览/清理当前项目的构建产物（clean_rules 配置的路径和命令），报告释放的空间\n" +
+	"`/remote`  查看当前 git 远程仓库列表\n" +
+	"`/tag [name]`  查看标签列表，或创建新标签\n" +
+	"`/git <args>`  执行任意 git 命令（即时响应）\n\n" +
+	"**📁 文件与搜索:**\n" +
+	"`/grep [--ref] <pattern>`  在代码中搜索关键词（内容搜索），--ref 搜索只读参考目录\n" +
+	"`/find <name>`  按文件名查找文件（支持通配符，如 *.go）\n" +
+	"`/test [pattern]`  运行项目测试（.devbot.yaml 的 test 命令优先，Go 即时执行，其他借助 Claude）\n" +
+	"`/test quarantine [add|rm <测试名>]`  隔离不稳定的 Go 测试，单独运行不影响结果\n" +
+	"`/sec [all|baseline]`  安全扫描（gosec、npm audit、pip-audit），只报告相对基线新增的问题\n" +
+	"`/lint [参数]`  运行仓库 .devbot.yaml 中的 lint 命令（Go 项目默认 go vet）\n" +
+	"`/run [名称] [参数]`  列出或运行仓库 .devbot.yaml 中的自定义命令\n" +
+	"`/verify [命令|run|off]`  设置仓库的校验命令，Claude 修改文件后自动运行\n" +
+	"`/protect [add|rm <模式>...]`  设置 Claude 不能修改的文件（如 migrations/、*.lock），改动会被自动恢复\n" +
+	"`/licenses [notice]`  盘点依赖许可证并按策略检查，notice 生成 NOTICE 文件\n" +
+	"`/buildbin [目标|all] [./包]`  按配置的 GOOS/GOARCH 构建 Go 二进制并发送到聊天，附大小和 sha256\n" +
+	"`/docker build [标签] [push]`  用 docker/podman 构建镜像，实时显示步骤，报告大小和 digest，可推送到配置的仓库\n" +
+	"`/tail <文件|服务> [行数]`  查看日志末尾；`/tail follow <文件|服务> [时长]` 定时推送新增日志，`/tail stop` 停止\n" +
+	"`/head <文件> [行数]`  查看文件开头（带行号，默认 50 行）\n" +
+	"`/shell start|stop|status`  在工作目录启动交互式 shell（pty），之后以 > 开头的消息作为输入，输出定时推送\n" +
+	"`/ps [关键词]`  查看机器人主机上的进程（管理员）\n" +
+	"`/port <端口>`  查看主机上占用该端口的进程（管理员）\n" +
+	"`/admin backup now|list`  立即备份状态文件或查看备份（管理员）\n" +
+	"`/loglevel [debug|info|warn|error]`  查看或临时调整日志级别（管理员）\n" +
+	"`/db query [@连接] <SQL>`  在项目配置的数据库上执行只读查询，结果以表格或 CSV 返回\n" +
+	"`/curl [方法] <URL> [请求体]`  直接发送 HTTP 请求（仅限 curl_hosts 中的主机）\n" +
+	"`/scratch [ls|clean]`  查看或清理会话临时目录（上传文件和临时文件，不在仓库中）\n" +
+	"`/get <通配符>...`  下载工作目录中的文件（多个文件打包为 zip）\n" +
+	"`/trash [list|restore <n>]`  查看或恢复机器人删除前备份的文件\n" +
+	"`/foreach <目录模式> <命令|prompt>`  在根目录下匹配的多个项目中依次执行 /test、/exec、/git、/pull 或 prompt，汇总结果\n" +
+	"`/campaign bump <模块>@<版本>`  在根目录下所有依赖该模块的仓库中建分支、升级、测试并创建 PR；`/campaign status [ID]` 查看进度\n" +
+	"`/about [set <说明>|clear|list]`  为当前仓库记录环境说明（部署、CI、构建方式等），新会话自动附上\n" +
+	"`/focus on|off`  执行前按关键词检索相关文件，确认（可移除）后随 prompt 告诉 Claude\n" +
+	"`/share [all|<执行ID>]`  把最近一次结果（或当前会话全部记录）上传到 Gist/Paste 并返回链接（有过期时间）；`/share list`、`/share rm <ID>` 管理\n" +
+	"`/todo`  搜索代码中的 TODO/FIXME/HACK/BUG 注释\n" +
+	"`/recent [n]`  列出最近修改的 n 个文件（默认 10 个）\n" +
+	"`/tree [dir]`  显示目录结构（最多 2 层深度，优先使用系统 tree 命令）\n" +
+	"`/size [path]`  查看文件或目录的磁盘占用大小\n" +
+	"`/stats`  项目统计：文件数、代码行数、文件类型分布、最近提交\n" +
+	"`/cache [status|clear [all]]`  查看/清除按提交缓存的仓库知识（项目结构、统计）\n" +
+	"`/watch <glob> <prompt>`  文件被外部修改时自动执行 prompt（/watch list|off|on|rm 管理）\n" +
+	"`/hooks [install|uninstall]`  在当前仓库安装 git hook，仓库在 bot 之外拉取或切换分支时通知本聊天\n" +
+	"`/usage [天数] [csv]`  各聊天每天的执行次数、失败次数和耗时（csv 导出文件）\n" +
+	"`/audit [条数] [csv]`  所有聊天的执行记录（csv 导出完整明细）\n" +
+	"`/remind \"内容\" <时间>`  提醒（如 tomorrow 10am、明天10点、in 30m）；-run 到时执行 prompt；list / rm <ID>\n" +
+	"`/report week`  周报：汇总最近 7 天的执行、各项目经机器人产生的提交、失败类型和文档同步，由 Claude 撰写总结并生成飞书文档\n" +
+	"`/debug`  分析上次输出中的错误并给出修复建议\n" +
+	"`/file <path>[:<行号>|:<起始>-<结束>]`  查看文件内容（显示行号，大文件自动截断，支持 :行号 跳转和行号范围）\n" +
+	"`/write <path>` + 换行 + 内容  直接写入文件（不经过 Claude）；只发路径时下一条消息作为内容\n" +
+	"`/append <path>` + 换行 + 内容  追加内容到文件末尾\n" +
+	"`/exec [--timeout 5m] [--env K=V] [--cwd 目录] <cmd>`  直接执行 Shell 命令（即时返回，无需 Claude，显示退出码）；`/exec !!` 重复上一条，`/exec history` 查看历史\n" +
+	"`/sh <cmd>`  通过 Claude 执行 Shell 命令（带 AI 解释）\n\n" +
+	"**📄 飞书文档同步:**\n" +
+	"`/doc push [--folder <token>] <path>`  将 Markdown 文件（或目录下的所有 Markdown 文件）推送到飞书文档\n" +
+	"`/doc pull <path>`  将飞书文档内容拉取到本地文件\n" +
+	"`/doc sync <path>`  双向同步：只有一边改动时自动推送或拉取，两边都改动时报告冲突\n" +
+	"`/doc bind <path> <url|id>`  绑定本地文件到飞书文档\n" +
+	"`/doc unbind <path>`  解除绑定\n" +
+	"`/doc list`  查看所有绑定关系\n\n" +
+	"**💬 其他:**\n" +
+	"`/ping`  检查机器人是否在线\n" +
+	"`/version`  显示版本信息（版本号、Commit、构建时间）\n" +
+	"`/help`  显示此帮助\n\n" +
+	"直接发送文字即可与 Claude 对话，也可发送图片或文件。\n" +
+	"消息中写 `@file:路径[#L起-止]` 或 `@diff[:引用]` 会附上文件内容或 git diff。"
+
 func (r *Router) cmdHelp(ctx context.Context, chatID string) {
-	md := "**🗺 导航:**\n" +
-		"`/info`  快速概览（目录、分支、变更、状态）\n" +
-		"`/root [path]`  查看/设置根工作目录\n" +
-		"`/cd <dir>`  切换项目目录（支持相对路径）\n" +
-		"`/pwd`  显示当前目录\n" +
-		"`/ls [dir]`  列出根目录下的项目（或指定子目录的文件）\n\n" +
-		"**🤖 Claude 对话:**\n" +
-		"`/status`  查看详细状态（含 git 信息）\n" +
-		"`/new`  开启新对话（保留当前会话到历史）\n" +
-		"`/kill`  终止正在执行的任务\n" +
-		"`/cancel`  同 /kill，终止当前任务\n" +
-		"`/retry`  重试上一条发给 Claude 的消息\n" +
-		"`/last`  显示上次输出\n" +
-		"`/summary`  让 Claude 总结上次输出\n" +
-		"`/compact`  压缩当前对话上下文（节省 token，延长会话）\n" +
-		"`/model [name]`  查看/切换模型（haiku/sonnet/opus）\n" +
-		"`/yolo`  开启无限制模式（Claude 可执行所有操作）\n" +
-		"`/safe`  恢复安全模式\n\n" +
-		"**🔀 历史会话:**\n" +
-		"`/sessions`  查看历史会话列表\n" +
-		"`/switch <id>`  切换到指定历史会话\n\n" +
-		"**🔧 Git:**\n" +
-		"`/diff`  查看当前变更\n" +
-		"`/log [n]`  查看提交历史（默认最近 20 条）\n" +
-		"`/show [commit]`  查看提交详情（默认最新提交 HEAD）\n" +
-		"`/blame <file>`  查看文件每行的最后修改者\n" +
-		"`/branch [name]`  查看分支列表或切换/创建分支\n" +
-		"`/commit [msg]`  提交（不填消息则 Claude 自动生成）\n" +
-		"`/fetch [args]`  从远程获取但不合并（即时响应，自动 prune）\n" +
-		"`/pull [args]`  从远程拉取（即时响应）\n" +
-		"`/push [args]`  推送到远程（即时响应）\n" +
-		"`/pr [title]`  创建 Pull Request（即时响应，使用 gh --fill 自动填充）\n" +
-		"`/prs [all]`  查看 PR 列表（默认开放中，加 all 显示全部）\n" +
-		"`/issues [args]`  查看 Issue 列表\n" +
-		"`/undo`  ⚠️ 撤销所有未提交的更改（无变更时提示而非执行）\n" +
-		"`/stash [pop]`  暂存/恢复更改\n" +
-		"`/clean [-f]`  查看/清理未跟踪文件（默认预览，加 -f 确认删除）\n" +
-		"`/remote`  查看当前 git 远程仓库列表\n" +
-		"`/tag [name]`  查看标签列表，或创建新标签\n" +
-		"`/git <args>`  执行任意 git 命令（即时响应）\n\n" +
-		"**📁 文件与搜索:**\n" +
-		"`/grep <pattern>`  在代码中搜索关键词（内容搜索）\n" +
-		"`/find <name>`  按文件名查找文件（支持通配符，如 *.go）\n" +
-		"`/test [pattern]`  运行项目测试（Go 即时执行，其他借助 Claude）\n" +
-		"`/todo`  搜索代码中的 TODO/FIXME/HACK/BUG 注释\n" +
-		"`/recent [n]`  列出最近修改的 n 个文件（默认 10 个）\n" +
-		"`/tree [dir]`  显示目录结构（最多 2 层深度，优先使用系统 tree 命令）\n" +
-		"`/size [path]`  查看文件或目录的磁盘占用大小\n" +
-		"`/stats`  项目统计：文件数、代码行数、文件类型分布、最近提交\n" +
-		"`/debug`  分析上次输出中的错误并给出修复建议\n" +
-		"`/file <path>[:<行号>]`  查看文件内容（显示行号，大文件自动截断，支持 :行号 跳转）\n" +
-		"`/exec <cmd>`  直接执行 Shell 命令（即时返回，无需 Claude）\n" +
-		"`/sh <cmd>`  通过 Claude 执行 Shell 命令（带 AI 解释）\n\n" +
-		"**📄 飞书文档同步:**\n" +
-		"`/doc push <path>`  将 Markdown 文件推送到飞书文档\n" +
-		"`/doc pull <path>`  将飞书文档内容拉取到本地文件\n" +
-		"`/doc bind <path> <url|id>`  绑定本地文件到飞书文档\n" +
-		"`/doc unbind <path>`  解除绑定\n" +
-		"`/doc list`  查看所有绑定关系\n\n" +
-		"**💬 其他:**\n" +
-		"`/ping`  检查机器人是否在线\n" +
-		"`/version`  显示版本信息（版本号、Commit、构建时间）\n" +
-		"`/help`  显示此帮助\n\n" +
-		"直接发送文字即可与 Claude 对话，也可发送图片或文件。"
-	r.sender.SendCard(ctx, chatID, CardMsg{Title: "DevBot 使用指南", Content: md})
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: "DevBot 使用指南", Content: helpText})
 }
 
 func (r *Router) cmdPing(ctx context.Context, chatID string) {
@@ -286,10 +809,14 @@ func (r *Router) cmdStatus(ctx context.Context, chatID string) {
 		queuePending = r.queue.PendingCount(chatID)
 	}
 
-	lastExec := r.executor.LastExecDuration().Truncate(time.Millisecond)
+	// Counts are this chat's, with all chats' in parentheses.
+	chatStats, allStats := r.metrics.Stats(chatID, ""), r.metrics.Stats("", "")
 	lastExecStr := "-"
-	if r.executor.ExecCount() > 0 {
-		lastExecStr = lastExec.String()
+	if chatStats.Count > 0 {
+		lastExecStr = chatStats.Last.Truncate(time.Millisecond).String()
+	}
+	if allStats.Count > 0 {
+		lastExecStr += fmt.Sprintf("（全局 %s）", allStats.Last.Truncate(time.Millisecond))
 	}
 
 	runningStr := "空闲"
@@ -309,7 +836,7 @@ func (r *Router) cmdStatus(ctx context.Context, chatID string) {
 	if changes == "" {
 		changes = "（非 git 目录）"
 	}
-	md := fmt.Sprintf("**工作目录:** `%s`\n**Git 分支:**  %s\n**工作区:**    %s\n**会话 ID:**   `%s`\n**模型:**      %s\n**模式:**      %s\n**状态:**      %s\n**执行次数:** %d\n**上次耗时:** %s\n**待执行队列:** %d\n**运行时长:** %s",
+	md := fmt.Sprintf("**工作目录:** `%s`\n**Git 分支:**  %s\n**工作区:**    %s\n**会话 ID:**   `%s`\n**模型:**      %s\n**模式:**      %s\n**状态:**      %s\n**执行次数:** %s\n**上次耗时:** %s\n**待执行队列:** %d\n**运行时长:** %s",
 		session.WorkDir,
 		branchStr,
 		changes,
@@ -317,11 +844,32 @@ func (r *Router) cmdStatus(ctx context.Context, chatID string) {
 		session.Model,
 		mode,
 		runningStr,
-		r.executor.ExecCount(),
+		fmt.Sprintf("%d（全局 %d）", chatStats.Count, allStats.Count),
 		lastExecStr,
 		queuePending,
 		uptime,
 	)
+	if kinds := r.formatExecKinds(chatID); kinds != "" {
+		md += "\n**按类型:** " + kinds
+	}
+	if chatStats.LastError != "" {
+		md += fmt.Sprintf("\n**上次错误:** %s（%s）", truncateRunes(strings.Join(strings.Fields(chatStats.LastError), " "), 100), chatStats.ErrorAt.Format("01-02 15:04"))
+	}
+	if pool, ok := r.executor.(*ExecutorPool); ok {
+		md += "\n**执行后端:**" + pool.Summary()
+	}
+	if branch != "" {
+		repo := repoRoot(session.WorkDir)
+		if line := submoduleSummary(repo); line != "" {
+			md += "\n**子模块:** " + line
+		}
+		if line := lfsSummary(repo); line != "" {
+			md += "\n**Git LFS:** " + line
+		}
+	}
+	if line := r.cacheStatusLine(); line != "" {
+		md += "\n**构建缓存:** " + line
+	}
 	r.sender.SendCard(ctx, chatID, CardMsg{Title: "当前状态", Content: md})
 }
 
@@ -504,14 +1052,17 @@ func (r *Router) cmdCd(ctx context.Context, chatID, args string) {
 	if branch := gitBranch(target); branch != "" {
 		msg += fmt.Sprintf("  （分支: %s）", branch)
 	}
+	if note := r.repoConfigNote(target); note != "" {
+		msg += "\n" + note
+	}
 	r.sender.SendText(ctx, chatID, msg)
 }
 
 func (r *Router) cmdNewSession(ctx context.Context, chatID string) {
 	r.getSession(chatID) // ensure session exists
-	var oldSessionID string
+	var oldSessionID, workDir, lastOutput string
 	r.store.UpdateSession(chatID, func(s *Session) {
-		oldSessionID = s.ClaudeSessionID
+		oldSessionID, workDir, lastOutput = s.ClaudeSessionID, s.WorkDir, s.LastOutput
 		if s.ClaudeSessionID != "" {
 			s.History = append(s.History, s.ClaudeSessionID)
 		}
@@ -520,53 +1071,187 @@ func (r *Router) cmdNewSession(ctx context.Context, chatID string) {
 	})
 	r.save()
 	if oldSessionID != "" {
+		r.summarizeSession(chatID, oldSessionID, workDir, lastOutput)
 		r.sender.SendText(ctx, chatID, fmt.Sprintf("已开启新对话。旧会话 %s 已保存到历史，可用 /sessions 查看或 /switch 恢复。", oldSessionID))
 	} else {
 		r.sender.SendText(ctx, chatID, "已开启新对话。")
 	}
 }
 
-func (r *Router) cmdSessions(ctx context.Context, chatID string) {
+func (r *Router) cmdSessions(ctx context.Context, chatID, args string) {
+	if args == "pick" {
+		r.sessionPicker(ctx, chatID)
+		return
+	}
 	session := r.getSession(chatID)
-	if len(session.History) == 0 && session.ClaudeSessionID == "" {
+	if len(session.History) == 0 && session.ClaudeSessionID == "" && len(session.NamedSessions) == 0 {
 		r.sender.SendText(ctx, chatID, "暂无历史会话。发送消息后会自动创建会话。")
 		return
 	}
-	// Build reverse map: sessionID -> workDir for context display
+	// Build reverse maps: sessionID -> workDir and name for context display
 	reverseDir := make(map[string]string)
 	for dir, sid := range session.DirSessions {
 		reverseDir[sid] = dir
 	}
+	names := make(map[string]string)
+	for _, name := range sortedKeys(session.NamedSessions) {
+		ns := session.NamedSessions[name]
+		if names[ns.SessionID] == "" {
+			names[ns.SessionID] = name
+		}
+		if ns.WorkDir != "" {
+			reverseDir[ns.SessionID] = ns.WorkDir
+		}
+	}
 	var lines []string
 	for i, id := range session.History {
 		dirHint := ""
 		if dir, ok := reverseDir[id]; ok && dir != "" {
 			dirHint = " `" + filepath.Base(dir) + "`"
 		}
-		lines = append(lines, fmt.Sprintf("  `%d`:%s `%s`  → `/switch %d`", i, dirHint, id, i))
+		if name := names[id]; name != "" {
+			lines = append(lines, fmt.Sprintf("  `%d`: **%s**%s `%s`  → `/load %s`", i, name, dirHint, id, name))
+		} else {
+			lines = append(lines, fmt.Sprintf("  `%d`:%s `%s`  → `/switch %d`", i, dirHint, id, i))
+		}
+		if summary := session.Summaries[id]; summary != "" {
+			lines = append(lines, "      "+truncateRunes(summary, 120))
+		}
 	}
 	if session.ClaudeSessionID != "" {
 		dirHint := ""
 		if dir, ok := reverseDir[session.ClaudeSessionID]; ok && dir != "" {
 			dirHint = " `" + filepath.Base(dir) + "`"
 		}
+		if name := names[session.ClaudeSessionID]; name != "" {
+			dirHint = " " + name + dirHint
+		}
 		lines = append(lines, fmt.Sprintf("\n**当前:%s** `%s`", dirHint, session.ClaudeSessionID))
 	}
+	// Named sessions kept only for another directory (see /cd) are not in
+	// the history.
+	shown := map[string]bool{session.ClaudeSessionID: true}
+	for _, id := range session.History {
+		shown[id] = true
+	}
+	for _, name := range sortedKeys(session.NamedSessions) {
+		ns := session.NamedSessions[name]
+		if shown[ns.SessionID] {
+			continue
+		}
+		shown[ns.SessionID] = true
+		dirHint := ""
+		if ns.WorkDir != "" {
+			dirHint = " `" + filepath.Base(ns.WorkDir) + "`"
+		}
+		lines = append(lines, fmt.Sprintf("  **%s**%s `%s`  → `/load %s`", name, dirHint, ns.SessionID, name))
+	}
+	if len(session.NamedSessions) == 0 {
+		lines = append(lines, "\n用 `/save <名称>` 给当前会话命名，之后 `/load <名称>` 恢复。")
+	}
 	r.sender.SendCard(ctx, chatID, CardMsg{Title: "历史会话", Content: strings.Join(lines, "\n")})
 }
 
+// maxSessionChoices bounds the sessions the /switch picker offers.
+const maxSessionChoices = 10
+
+// sessionInfo previews a Claude session from the chat's execution history.
+type sessionInfo struct {
+	ID      string
+	Index   int    // position in Session.History
+	Title   string // the session's summary, or else its first prompt
+	WorkDir string
+	LastAt  time.Time
+}
+
+// sessionInfos describes the chat's earlier sessions, most recently active
+// first; sessions with no recorded executions come last, newest first.
+func (r *Router) sessionInfos(chatID string, session Session) []sessionInfo {
+	recs := r.store.ExecRecords(chatID, 0) // newest first
+	var infos []sessionInfo
+	for i := len(session.History) - 1; i >= 0; i-- {
+		info := sessionInfo{ID: session.History[i], Index: i}
+		for _, rec := range recs {
+			if rec.SessionID != info.ID {
+				continue
+			}
+			if info.LastAt.IsZero() {
+				info.LastAt = rec.StartedAt
+				info.WorkDir = rec.WorkDir
+			}
+			info.Title = rec.Prompt
+		}
+		if summary := session.Summaries[info.ID]; summary != "" {
+			info.Title = summary
+		}
+		if info.WorkDir == "" {
+			for dir, sid := range session.DirSessions {
+				if sid == info.ID {
+					info.WorkDir = dir
+				}
+			}
+		}
+		infos = append(infos, info)
+	}
+	sort.SliceStable(infos, func(i, j int) bool { return infos[i].LastAt.After(infos[j].LastAt) })
+	return infos
+}
+
+// sessionPicker sends a card with one button per recent session.
+func (r *Router) sessionPicker(ctx context.Context, chatID string) {
+	session := r.getSession(chatID)
+	seen := map[string]bool{session.ClaudeSessionID: true}
+	var infos []sessionInfo
+	for _, info := range r.sessionInfos(chatID, session) {
+		if !seen[info.ID] && len(infos) < maxSessionChoices {
+			seen[info.ID] = true
+			infos = append(infos, info)
+		}
+	}
+	if len(infos) == 0 {
+		r.sender.SendText(ctx, chatID, "用法: /switch <序号或会话ID>\n\n使用 /sessions 查看可用会话列表。")
+		return
+	}
+
+	var sb strings.Builder
+	var buttons []CardButton
+	for _, info := range infos {
+		title := truncateRunes(strings.Join(strings.Fields(info.Title), " "), 60)
+		if title == "" {
+			title = "（无记录）"
+		}
+		fmt.Fprintf(&sb, "**%d.** %s\n", info.Index, title)
+		var meta []string
+		if info.WorkDir != "" {
+			meta = append(meta, "`"+filepath.Base(info.WorkDir)+"`")
+		}
+		if !info.LastAt.IsZero() {
+			meta = append(meta, info.LastAt.Format("01-02 15:04"))
+		}
+		meta = append(meta, shortHash(info.ID))
+		sb.WriteString(strings.Join(meta, " · ") + "\n")
+
+		label := truncateRunes(strings.Join(strings.Fields(info.Title), " "), 16)
+		if label == "" {
+			label = shortHash(info.ID)
+		}
+		buttons = append(buttons, CardButton{Text: fmt.Sprintf("%d. %s", info.Index, label), Command: "/switch " + info.ID})
+	}
+	sb.WriteString("\n点击按钮切换，或发送 `/switch <序号>`。")
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: "切换会话", Content: sb.String(), Buttons: buttons})
+}
+
 func (r *Router) cmdSwitch(ctx context.Context, chatID, args string) {
 	if args == "" {
-		r.sender.SendText(ctx, chatID, "用法: /switch <序号或会话ID>\n\n使用 /sessions 查看可用会话列表。")
+		r.sessionPicker(ctx, chatID)
 		return
 	}
 	r.getSession(chatID) // ensure session exists
 
-	// Support switching by index (from /sessions list)
+	// Support switching by index (from /sessions list). Picker buttons send
+	// the full ID, which may itself start with digits.
 	targetID := args
-	if idx, err := fmt.Sscanf(args, "%d", new(int)); err == nil && idx == 1 {
-		var idxVal int
-		fmt.Sscanf(args, "%d", &idxVal)
+	if idxVal, err := strconv.Atoi(args); err == nil {
 		session := r.getSession(chatID)
 		if idxVal >= 0 && idxVal < len(session.History) {
 			targetID = session.History[idxVal]
@@ -577,17 +1262,37 @@ func (r *Router) cmdSwitch(ctx context.Context, chatID, args string) {
 	}
 
 	r.store.UpdateSession(chatID, func(s *Session) {
-		if s.ClaudeSessionID != "" {
-			s.History = append(s.History, s.ClaudeSessionID)
-		}
-		s.ClaudeSessionID = targetID
-		s.LastOutput = ""
+		makeCurrent(s, targetID)
 	})
 	r.save()
 	r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已切换到会话: %s", targetID))
 }
 
-func (r *Router) cmdKill(ctx context.Context, chatID string) {
+// makeCurrent makes Claude session id the chat's current one, appending
+// the current session to the history unless it is already there. The
+// history is append-only, so the indexes /sessions, /switch <n> and
+// /export <n> use keep pointing at the same sessions.
+func makeCurrent(s *Session, id string) {
+	if s.ClaudeSessionID == id {
+		return
+	}
+	if s.ClaudeSessionID != "" && !containsWord(s.History, s.ClaudeSessionID) {
+		s.History = append(s.History, s.ClaudeSessionID)
+	}
+	s.ClaudeSessionID = id
+	s.LastOutput = ""
+}
+
+func (r *Router) cmdKill(ctx context.Context, chatID, args string) {
+	if id := strings.TrimSpace(args); id != "" {
+		r.killExec(ctx, chatID, id)
+		return
+	}
+	// A run paused for a deletion is killed when the deletion is denied.
+	if r.resolveDelete(chatID, false) {
+		r.sender.SendText(ctx, chatID, "✓ 任务已终止。")
+		return
+	}
 	if err := r.executor.Kill(); err != nil {
 		r.sender.SendText(ctx, chatID, "当前没有正在执行的任务。")
 		return
@@ -657,8 +1362,9 @@ func (r *Router) cmdSummary(ctx context.Context, chatID string) {
 		r.sender.SendText(ctx, chatID, "暂无可总结的输出，请先发送消息给 Claude。")
 		return
 	}
-	prompt := "Please summarize the following output concisely:\n\n" + truncateForDisplay(session.LastOutput, 4000)
-	r.execClaudeQueued(ctx, chatID, prompt)
+	template, instruction := r.pickTemplate(templateSummary)
+	prompt := instruction + "\n\n" + truncateForDisplay(session.LastOutput, 4000)
+	r.enqueueExec(ctx, chatID, prompt, execOptions{Template: template})
 }
 
 func (r *Router) cmdCommit(ctx context.Context, chatID, msg string) {
@@ -670,8 +1376,8 @@ func (r *Router) cmdCommit(ctx context.Context, chatID, msg string) {
 
 	if msg == "" {
 		// No message provided: use Claude to auto-generate a commit message
-		prompt := "Stage tracked file changes with `git add -u` (do NOT use `git add -A` to avoid staging untracked files), then write a concise commit message based on the changes (`git diff --cached`), and commit. Only show the final commit output, no explanation."
-		r.execClaudeQueued(ctx, chatID, prompt)
+		template, prompt := r.pickTemplate(templateCommit)
+		r.enqueueExec(ctx, chatID, prompt, execOptions{Template: template})
 		return
 	}
 
@@ -772,7 +1478,16 @@ func (r *Router) cmdPull(ctx context.Context, chatID, args string) {
 	if content == "" {
 		content = "（无输出）"
 	}
-	r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: "```\n" + content + "\n```", Template: tpl})
+	content = "```\n" + content + "\n```"
+	if err == nil {
+		if notes, failed := updateSubmodulesAndLFS(repoRoot(workDir)); len(notes) > 0 {
+			content += "\n" + strings.Join(notes, "\n")
+			if failed {
+				tpl = "orange"
+			}
+		}
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: content, Template: tpl})
 }
 
 func (r *Router) cmdPush(ctx context.Context, chatID, args string) {
@@ -821,6 +1536,10 @@ func (r *Router) cmdUndo(ctx context.Context, chatID string) {
 }
 
 func (r *Router) cmdClean(ctx context.Context, chatID, args string) {
+	if sub, rest, _ := strings.Cut(args, " "); sub == "build" {
+		r.cmdCleanBuild(ctx, chatID, rest)
+		return
+	}
 	session := r.getSession(chatID)
 	workDir := session.WorkDir
 	if workDir == "" {
@@ -828,7 +1547,16 @@ func (r *Router) cmdClean(ctx context.Context, chatID, args string) {
 	}
 	// Safety: always show dry-run first unless user explicitly passes "-f"
 	if args == "-f" || args == "--force" {
-		out, err := runGitOutput(workDir, "clean", "-fd")
+		if preview, err := runGitOutput(workDir, "clean", "-nd", "-e", trashDirName+"/"); err == nil {
+			var paths []string
+			for _, line := range strings.Split(preview, "\n") {
+				if p := strings.TrimPrefix(line, "Would remove "); p != line {
+					paths = append(paths, p)
+				}
+			}
+			r.trashDeletion(ctx, chatID, workDir, "clean", paths)
+		}
+		out, err := runGitOutput(workDir, "clean", "-fd", "-e", trashDirName+"/")
 		tpl := "green"
 		title := "git clean 完成"
 		if err != nil {
@@ -843,7 +1571,7 @@ func (r *Router) cmdClean(ctx context.Context, chatID, args string) {
 		return
 	}
 	// Default: dry-run to show what would be deleted
-	out, err := runGitOutput(workDir, "clean", "-nd")
+	out, err := runGitOutput(workDir, "clean", "-nd", "-e", trashDirName+"/")
 	if err != nil || out == "" {
 		r.sender.SendText(ctx, chatID, "没有需要清理的未跟踪文件。")
 		return
@@ -855,33 +1583,145 @@ func (r *Router) cmdClean(ctx context.Context, chatID, args string) {
 	})
 }
 
+// maxStashList bounds the stashes /stash list shows.
+const maxStashList = 20
+
+// stashRef turns a /stash index ("0", "stash@{0}") into a stash ref.
+func stashRef(arg string) (string, bool) {
+	arg = strings.TrimSpace(arg)
+	if arg == "" {
+		return "stash@{0}", true
+	}
+	if strings.HasPrefix(arg, "stash@{") && strings.HasSuffix(arg, "}") {
+		arg = arg[len("stash@{") : len(arg)-1]
+	}
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 0 {
+		return "", false
+	}
+	return fmt.Sprintf("stash@{%d}", n), true
+}
+
+// stashStat summarizes what a stash contains, including untracked files.
+func stashStat(workDir, ref string) string {
+	out, err := runGitOutput(workDir, "stash", "show", "--stat", "--include-untracked", ref)
+	if err != nil {
+		// git < 2.32 has no --include-untracked for show.
+		out, _ = runGitOutput(workDir, "stash", "show", "--stat", ref)
+	}
+	return strings.TrimSpace(out)
+}
+
 func (r *Router) cmdStash(ctx context.Context, chatID, args string) {
 	session := r.getSession(chatID)
 	workDir := session.WorkDir
 	if workDir == "" {
 		workDir = r.store.WorkRoot()
 	}
-	gitArgs := []string{"stash"}
-	if args != "" {
-		gitArgs = append(gitArgs, strings.Fields(args)...)
+	sub, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	rest = strings.TrimSpace(rest)
+	usage := "用法: /stash  暂存当前更改\n       /stash save <名称>  暂存更改（含未跟踪文件）并命名\n       /stash list  列出暂存及其内容\n       /stash show [n]  查看第 n 个暂存的变更\n       /stash apply [n] / pop [n]  恢复第 n 个暂存（pop 同时删除）\n       /stash drop <n>  删除第 n 个暂存"
+
+	switch sub {
+	case "list":
+		r.stashList(ctx, chatID, workDir)
+		return
+	case "show":
+		ref, ok := stashRef(rest)
+		if !ok {
+			r.sender.SendText(ctx, chatID, usage)
+			return
+		}
+		out, err := runGitOutput(workDir, "stash", "show", "-p", "--stat", ref)
+		if err != nil {
+			r.sender.SendCard(ctx, chatID, CardMsg{Title: "git stash show 出错", Content: out, Template: "red"})
+			return
+		}
+		shown, full := r.fitOutput(chatID, "stash", strings.TrimSpace(out), false, "内容过长")
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "git stash show " + ref, Content: "```diff\n" + shown + "\n```"})
+		r.sendFullOutput(ctx, chatID, full)
+		return
+	case "save":
+		if rest == "" {
+			r.sender.SendText(ctx, chatID, usage)
+			return
+		}
+		out, err := runGitOutput(workDir, "stash", "push", "--include-untracked", "-m", rest)
+		r.stashResult(ctx, chatID, "git stash save "+rest, out, err, "")
+		return
+	case "apply", "pop", "drop":
+		if sub == "drop" && rest == "" {
+			r.sender.SendText(ctx, chatID, "请指定要删除的暂存序号，例如 /stash drop 0（/stash list 查看）。")
+			return
+		}
+		ref, ok := stashRef(rest)
+		if !ok {
+			r.sender.SendText(ctx, chatID, usage)
+			return
+		}
+		// Read the contents first: pop and drop remove the stash.
+		stat := stashStat(workDir, ref)
+		out, err := runGitOutput(workDir, "stash", sub, ref)
+		r.stashResult(ctx, chatID, fmt.Sprintf("git stash %s %s", sub, ref), out, err, stat)
+		return
+	case "":
+		out, err := runGitOutput(workDir, "stash")
+		r.stashResult(ctx, chatID, "git stash", out, err, "")
+		return
 	}
-	output, err := runGitOutput(workDir, gitArgs...)
+	r.sender.SendText(ctx, chatID, usage)
+}
+
+// stashResult reports a stash command, with a --stat preview of the stash
+// it touched when given.
+func (r *Router) stashResult(ctx context.Context, chatID, title, output string, err error, stat string) {
 	tpl := "blue"
-	title := "git stash"
-	if args == "pop" || strings.HasPrefix(args, "pop ") {
-		title = "git stash pop"
-	}
 	if err != nil {
 		tpl = "red"
 		title += " 出错"
 	}
-	content := output
+	content := strings.TrimSpace(output)
 	if content == "" {
 		content = "（无暂存变更）"
 	}
+	if stat != "" && err == nil {
+		content += "\n\n**内容:**\n```\n" + truncateForDisplay(stat, 2000) + "\n```"
+	}
 	r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: content, Template: tpl})
 }
 
+// stashList sends the stashes with a one-line summary of each.
+func (r *Router) stashList(ctx context.Context, chatID, workDir string) {
+	out, err := runGitOutput(workDir, "stash", "list", "--format=%gd%x09%cr%x09%gs")
+	if err != nil {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "git stash list 出错", Content: out, Template: "red"})
+		return
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if strings.TrimSpace(out) == "" {
+		r.sender.SendText(ctx, chatID, "没有暂存。")
+		return
+	}
+	var sb strings.Builder
+	for i, line := range lines {
+		if i == maxStashList {
+			fmt.Fprintf(&sb, "... 另有 %d 个暂存\n", len(lines)-maxStashList)
+			break
+		}
+		parts := strings.SplitN(line, "\t", 3)
+		if len(parts) < 3 {
+			continue
+		}
+		fmt.Fprintf(&sb, "**%d.** %s · %s\n", i, parts[2], parts[1])
+		stat := strings.Split(stashStat(workDir, parts[0]), "\n")
+		if summary := strings.TrimSpace(stat[len(stat)-1]); summary != "" {
+			fmt.Fprintf(&sb, "    %s\n", summary)
+		}
+	}
+	sb.WriteString("\n使用 `/stash show <n>` 查看，`/stash apply <n>` 恢复。")
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("暂存列表（%d）", len(lines)), Content: sb.String()})
+}
+
 func (r *Router) cmdLog(ctx context.Context, chatID, args string) {
 	session := r.getSession(chatID)
 	workDir := session.WorkDir
@@ -920,14 +1760,13 @@ func (r *Router) cmdDiff(ctx context.Context, chatID string) {
 		combined += "**已暂存的更改:**\n```diff\n" + staged + "\n```"
 	}
 	combined = strings.TrimSpace(combined)
-	if runes := []rune(combined); len(runes) > 4000 {
-		combined = "（内容过长，仅显示末尾部分）\n\n" + string(runes[len(runes)-4000:])
-	}
 	if combined == "" {
 		r.sender.SendText(ctx, chatID, "没有任何未提交的更改。")
 		return
 	}
+	combined, full := r.fitOutput(chatID, "diff", combined, true, "内容过长")
 	r.sender.SendCard(ctx, chatID, CardMsg{Title: "git diff", Content: combined})
+	r.sendFullOutput(ctx, chatID, full)
 }
 
 func (r *Router) cmdShow(ctx context.Context, chatID, args string) {
@@ -952,12 +1791,10 @@ func (r *Router) cmdShow(ctx context.Context, chatID, args string) {
 		// show --stat output is a prefix of show, so just use full show
 		combined = diff
 	}
-	const maxOut = 4000
-	if runes := []rune(combined); len(runes) > maxOut {
-		combined = "（内容过长，仅显示开头部分）\n\n" + string(runes[:maxOut])
-	}
+	combined, full := r.fitOutput(chatID, "show", combined, false, "内容过长")
 	title := fmt.Sprintf("git show %s", ref)
-	r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: "```\n" + combined + "\n```"})
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: "```diff\n" + combined + "\n```"})
+	r.sendFullOutput(ctx, chatID, full)
 }
 
 func (r *Router) cmdBlame(ctx context.Context, chatID, args string) {
@@ -975,14 +1812,12 @@ func (r *Router) cmdBlame(ctx context.Context, chatID, args string) {
 		r.sender.SendText(ctx, chatID, fmt.Sprintf("无法查看 blame: %s\n%s", args, output))
 		return
 	}
-	const maxOut = 4000
-	if runes := []rune(output); len(runes) > maxOut {
-		output = fmt.Sprintf("（内容过长，仅显示前 %d 字符）\n\n", maxOut) + string(runes[:maxOut])
-	}
+	output, full := r.fitOutput(chatID, "blame", output, false, "内容过长")
 	r.sender.SendCard(ctx, chatID, CardMsg{
 		Title:   fmt.Sprintf("git blame %s", filepath.Base(args)),
 		Content: "```\n" + output + "\n```",
 	})
+	r.sendFullOutput(ctx, chatID, full)
 }
 
 func (r *Router) cmdBranch(ctx context.Context, chatID, args string) {
@@ -1030,79 +1865,327 @@ func (r *Router) cmdRetry(ctx context.Context, chatID string) {
 		return
 	}
 	r.sender.SendText(ctx, chatID, fmt.Sprintf("重试: %s", session.LastPrompt))
-	r.execClaudeQueued(ctx, chatID, session.LastPrompt)
+	r.enqueueExec(ctx, chatID, session.LastPrompt, execOptions{Retry: true, PrevOutput: session.LastOutput})
 }
 
-func (r *Router) cmdInfo(ctx context.Context, chatID string) {
-	session := r.getSession(chatID)
-	mode := session.PermissionMode
-	if mode == "" {
-		mode = "safe"
-	}
-	branch := gitBranch(session.WorkDir)
-	if branch == "" {
-		branch = "（非 git 目录）"
-	}
-	changes := gitStatusSummary(session.WorkDir)
-	if changes == "" {
-		changes = "（非 git 目录）"
+func (r *Router) cmdUrgent(ctx context.Context, chatID, args string) {
+	if args == "" {
+		r.sender.SendText(ctx, chatID, "用法: /urgent <prompt>\n紧急任务会插到排队任务之前执行，但不会打断正在执行的任务。")
+		return
 	}
-	runningStr := "空闲"
-	if r.executor.IsRunning() {
-		runningStr = "执行中..."
+	r.getSession(chatID) // ensure session exists
+	r.store.UpdateSession(chatID, func(s *Session) {
+		s.LastPrompt = args
+	})
+	r.submitChecked(ctx, chatID, args, execOptions{Urgent: true})
+}
+
+func (r *Router) cmdForce(ctx context.Context, chatID, args string) {
+	if args == "" {
+		r.sender.SendText(ctx, chatID, "用法: /force <prompt>\n即使相同的请求已在队列中也再执行一次。")
+		return
 	}
-	md := fmt.Sprintf("📂 `%s`\n🌿 %s | 📝 %s\n🤖 %s | 🔒 %s | ⚡ %s",
-		session.WorkDir, branch, changes, session.Model, mode, runningStr)
-	r.sender.SendCard(ctx, chatID, CardMsg{Title: "当前概览", Content: md})
+	r.getSession(chatID) // ensure session exists
+	r.store.UpdateSession(chatID, func(s *Session) {
+		s.LastPrompt = args
+	})
+	r.submitChecked(ctx, chatID, args, execOptions{Force: true})
 }
 
-func (r *Router) cmdGrep(ctx context.Context, chatID, args string) {
+func (r *Router) cmdRepro(ctx context.Context, chatID, args string) {
 	if args == "" {
-		r.sender.SendText(ctx, chatID, "用法: /grep <关键词>\n示例: /grep TODO\n示例: /grep func main")
+		r.sender.SendText(ctx, chatID, "用法: /repro <执行ID>\n在该次执行时的 git 提交上（临时工作树、全新会话）重放同一 prompt。")
 		return
 	}
-	session := r.getSession(chatID)
-	workDir := session.WorkDir
-	if workDir == "" {
-		workDir = r.store.WorkRoot()
+	orig, ok := r.store.ExecRecord(args)
+	if !ok || orig.ChatID != chatID {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("未找到执行记录: %s", args))
+		return
 	}
-
-	execCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
-	defer cancel()
-
-	cmd := exec.CommandContext(execCtx, "grep", "-rn",
-		"--include=*.go", "--include=*.ts", "--include=*.tsx", "--include=*.js",
-		"--include=*.jsx", "--include=*.py", "--include=*.java", "--include=*.rs",
-		"--include=*.c", "--include=*.cpp", "--include=*.h", "--include=*.rb",
-		"--include=*.sh", "--include=*.yaml", "--include=*.yml", "--include=*.json",
-		"--include=*.md", "--exclude-dir=.git", "--exclude-dir=node_modules",
-		"--exclude-dir=vendor", "--exclude-dir=dist", args, ".")
-	cmd.Dir = workDir
-	var outBuf bytes.Buffer
-	cmd.Stdout = &outBuf
-	cmd.Stderr = &outBuf
-	cmd.Run() // ignore exit code (grep exits 1 when no matches)
-
-	output := strings.TrimSpace(outBuf.String())
-	if output == "" {
-		r.sender.SendText(ctx, chatID, fmt.Sprintf("未找到包含 '%s' 的匹配项。", args))
+	if orig.GitHead == "" {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("执行 %s 没有记录 git 提交（工作目录不是 git 仓库或为旧记录），无法复现。", orig.ID))
 		return
 	}
-	matchLines := strings.Split(strings.TrimSpace(output), "\n")
-	matchCount := len(matchLines)
 
-	const maxOut = 4000
-	if runes := []rune(output); len(runes) > maxOut {
-		output = fmt.Sprintf("（结果过多，仅显示前 %d 字符）\n\n", maxOut) + string(runes[:maxOut])
+	id := newExecID()
+	if r.queue == nil {
+		r.runRepro(ctx, chatID, id, orig)
+		return
+	}
+	r.setQueued(ExecRecord{ID: id, ChatID: chatID, Prompt: orig.Prompt, ReproOf: orig.ID, StartedAt: time.Now()})
+	pos, err := r.queue.EnqueueTask(chatID, QueueEntry{ID: id}, func() {
+		r.runRepro(r.ctx, chatID, id, orig)
+	})
+	if err != nil {
+		r.clearQueued(id)
+		r.sender.SendText(ctx, chatID, "队列已满，请稍后再试。")
+		return
+	}
+	if pos > 1 {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("已排队（第 %d 位）", pos), Content: "当前有任务正在执行，请稍候...", Template: "blue", Receipt: id})
 	}
-	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("搜索: %s（%d 处）", args, matchCount), Content: "```\n" + output + "\n```"})
 }
 
-func (r *Router) cmdPR(ctx context.Context, chatID, args string) {
-	session := r.getSession(chatID)
-	workDir := session.WorkDir
-	if workDir == "" {
-		workDir = r.store.WorkRoot()
+// runRepro replays orig's prompt in a temporary detached worktree at
+// orig.GitHead, with a fresh Claude session and the original model and
+// permission mode, and reports the result next to the original metadata.
+// A yolo run is only replayed in yolo while the chat is still in yolo.
+func (r *Router) runRepro(ctx context.Context, chatID, id string, orig ExecRecord) {
+	r.clearQueued(id)
+	tmp, err := os.MkdirTemp("", "devbot-repro-")
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("创建临时目录失败: %v", err))
+		return
+	}
+	defer os.RemoveAll(tmp)
+	wt := filepath.Join(tmp, "worktree")
+	if out, err := runGitOutput(orig.WorkDir, "worktree", "add", "--detach", wt, orig.GitHead); err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("创建工作树失败: %s", out))
+		return
+	}
+	defer runGitOutput(orig.WorkDir, "worktree", "remove", "--force", wt)
+
+	model := orig.Model
+	if model == "" {
+		model = r.executor.Model()
+	}
+	mode := orig.PermissionMode
+	if mode == "" {
+		mode = "safe"
+	}
+	note := ""
+	if mode == "yolo" && r.getSession(chatID).PermissionMode != "yolo" {
+		mode = "safe"
+		note = "，原执行为 yolo 模式，当前聊天不是，按安全模式执行"
+	}
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("复现 %s：在提交 %s 上重新执行（全新会话，模型 %s%s）...", orig.ID, shortHash(orig.GitHead), model, note))
+
+	startTime := time.Now()
+	rec := ExecRecord{
+		ID:             id,
+		ChatID:         chatID,
+		Prompt:         orig.Prompt,
+		WorkDir:        wt,
+		StartedAt:      startTime,
+		Model:          model,
+		PermissionMode: mode,
+		GitHead:        orig.GitHead,
+		ReproOf:        orig.ID,
+	}
+	r.setActive(rec)
+	defer r.clearActive(id)
+
+	runCtx, stop := r.killable(ctx, id)
+	defer stop()
+	result, err := r.executor.ExecStream(runCtx, orig.Prompt, wt, "", mode, model, nil)
+	rec.Duration = time.Since(startTime)
+	rec.SessionID = result.SessionID
+	rec.setResultMeta(result)
+	if err != nil {
+		rec.Error = err.Error()
+	} else {
+		rec.Output = result.Output
+	}
+	r.addExecRecord("repro", rec)
+	r.save()
+
+	meta := fmt.Sprintf("**原执行:** `%s`（%s）\n**提交:** `%s`\n**模型:** %s → %s\n**CLI:** %s → %s\n**模式:** %s",
+		orig.ID, orig.StartedAt.Format("01-02 15:04"), shortHash(orig.GitHead),
+		orDash(orig.Model), orDash(rec.Model), orDash(orig.CLIVersion), orDash(rec.CLIVersion), mode)
+	if err != nil {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("复现出错 %s", id), Content: meta + "\n\n" + err.Error(), Template: "red", Receipt: id})
+		return
+	}
+	verdict := "输出与原执行**不同**"
+	if strings.TrimSpace(result.Output) == strings.TrimSpace(orig.Output) {
+		verdict = "输出与原执行一致"
+	}
+	shown, full := r.fitOutput(chatID, "repro", strings.TrimSpace(result.Output), true, "内容过长")
+	r.sender.SendCard(ctx, chatID, CardMsg{
+		Title:   fmt.Sprintf("复现结果 %s", id),
+		Content: meta + "\n**对比:** " + verdict + "\n\n" + shown,
+		Receipt: id,
+	})
+	r.sendFullOutput(ctx, chatID, full)
+}
+
+// shortHash abbreviates a commit hash for display.
+func shortHash(h string) string {
+	if len(h) > 7 {
+		return h[:7]
+	}
+	return h
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// normalizePrompt folds case, whitespace and trailing punctuation so that
+// impatient re-sends of the same prompt compare equal.
+func normalizePrompt(prompt string) string {
+	s := strings.ToLower(strings.Join(strings.Fields(prompt), " "))
+	return strings.TrimRight(s, " .!?~。！？～…")
+}
+
+// findQueuedDuplicate looks for a waiting execution in chatID with the same
+// normalized prompt and returns its ID and queue position (counting the
+// running task).
+func (r *Router) findQueuedDuplicate(chatID, prompt string) (string, int, bool) {
+	want := normalizePrompt(prompt)
+	waiting := r.queue.Waiting(chatID)
+	running := r.queue.PendingCount(chatID) - len(waiting)
+	for i, entry := range waiting {
+		rec, ok := r.queuedExec(entry.ID)
+		if ok && normalizePrompt(rec.Prompt) == want {
+			return entry.ID, running + i + 1, true
+		}
+	}
+	return "", 0, false
+}
+
+func (r *Router) cmdQueue(ctx context.Context, chatID string) {
+	var running []ExecRecord
+	for _, rec := range r.ActiveExecs() {
+		if rec.ChatID == chatID {
+			running = append(running, rec)
+		}
+	}
+	var waiting []QueueEntry
+	if r.queue != nil {
+		waiting = r.queue.Waiting(chatID)
+	}
+	if len(running) == 0 && len(waiting) == 0 {
+		r.sender.SendText(ctx, chatID, "队列为空。")
+		return
+	}
+
+	var sb strings.Builder
+	for _, rec := range running {
+		fmt.Fprintf(&sb, "**执行中:** `%s` %s（已运行 %s）\n", rec.ID, truncateRunes(rec.Prompt, 60), time.Since(rec.StartedAt).Truncate(time.Second))
+	}
+	if len(waiting) > 0 {
+		sb.WriteString("**等待中:**\n")
+	}
+	for i, entry := range waiting {
+		mark := ""
+		if entry.Urgent {
+			mark = "⚡ "
+		}
+		prompt := ""
+		if rec, ok := r.queuedExec(entry.ID); ok {
+			prompt = truncateRunes(rec.Prompt, 60)
+		}
+		fmt.Fprintf(&sb, "%d. %s`%s` %s\n", i+1, mark, entry.ID, prompt)
+	}
+	if r.queue != nil {
+		if running, total, workers := r.queue.PoolStats(); workers > 0 {
+			fmt.Fprintf(&sb, "\n全局: 执行中 %d / %d · 等待 %d\n", running, workers, total)
+		}
+	}
+	if len(waiting) > 0 {
+		sb.WriteString("\n`/dequeue <ID>` 取消排队的任务")
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("执行队列（等待 %d）", len(waiting)), Content: strings.TrimRight(sb.String(), "\n")})
+}
+
+func (r *Router) cmdInfo(ctx context.Context, chatID string) {
+	session := r.getSession(chatID)
+	mode := session.PermissionMode
+	if mode == "" {
+		mode = "safe"
+	}
+	branch := gitBranch(session.WorkDir)
+	if branch == "" {
+		branch = "（非 git 目录）"
+	}
+	changes := gitStatusSummary(session.WorkDir)
+	if changes == "" {
+		changes = "（非 git 目录）"
+	}
+	runningStr := "空闲"
+	if r.executor.IsRunning() {
+		runningStr = "执行中..."
+	}
+	md := fmt.Sprintf("📂 `%s`\n🌿 %s | 📝 %s\n🤖 %s | 🔒 %s | ⚡ %s",
+		session.WorkDir, branch, changes, session.Model, mode, runningStr)
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: "当前概览", Content: md})
+}
+
+func (r *Router) cmdGrep(ctx context.Context, chatID, args string) {
+	if args == "" {
+		r.sender.SendText(ctx, chatID, "用法: /grep [--ref] <关键词>\n示例: /grep TODO\n示例: /grep func main\n示例: /grep --ref message User  （搜索只读参考目录）")
+		return
+	}
+	session := r.getSession(chatID)
+	workDir := session.WorkDir
+	if workDir == "" {
+		workDir = r.store.WorkRoot()
+	}
+
+	var output string
+	if pattern, ok := strings.CutPrefix(args, "--ref "); ok {
+		if len(r.refDirs) == 0 {
+			r.sender.SendText(ctx, chatID, "没有配置只读参考目录（reference_dirs）。")
+			return
+		}
+		args = strings.TrimSpace(pattern)
+		output = r.grepReferenceDirs(ctx, args)
+	} else {
+		output = grepIn(ctx, workDir, args)
+	}
+	if output == "" {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("未找到包含 '%s' 的匹配项。", args))
+		return
+	}
+	matchLines := strings.Split(strings.TrimSpace(output), "\n")
+	matchCount := len(matchLines)
+
+	output, full := r.fitOutput(chatID, "grep", output, false, "结果过多")
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("搜索: %s（%d 处）", args, matchCount), Content: "```\n" + output + "\n```"})
+	r.sendFullOutput(ctx, chatID, full)
+}
+
+// grepIn searches the source files under dir for pattern, returning
+// "./<path>:<line>:<text>" lines.
+func grepIn(ctx context.Context, dir, pattern string) string {
+	execCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(execCtx, "grep", "-rn",
+		"--include=*.go", "--include=*.ts", "--include=*.tsx", "--include=*.js",
+		"--include=*.jsx", "--include=*.py", "--include=*.java", "--include=*.rs",
+		"--include=*.c", "--include=*.cpp", "--include=*.h", "--include=*.rb",
+		"--include=*.sh", "--include=*.yaml", "--include=*.yml", "--include=*.json",
+		"--include=*.md", "--include=*.proto", "--exclude-dir=.git", "--exclude-dir=node_modules",
+		"--exclude-dir=vendor", "--exclude-dir=dist", pattern, ".")
+	cmd.Dir = dir
+	var outBuf bytes.Buffer
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &outBuf
+	cmd.Run() // ignore exit code (grep exits 1 when no matches)
+	return strings.TrimSpace(outBuf.String())
+}
+
+func (r *Router) cmdPR(ctx context.Context, chatID, args string) {
+	session := r.getSession(chatID)
+	workDir := session.WorkDir
+	if workDir == "" {
+		workDir = r.store.WorkRoot()
+	}
+
+	if sub, rest, _ := strings.Cut(args, " "); sub == "view" {
+		r.cmdPRView(ctx, chatID, strings.TrimSpace(rest))
+		return
+	}
+	if !r.licenseGate(ctx, chatID, workDir) {
+		return
+	}
+	if !r.requireForge(ctx, chatID, "gh") {
+		return
 	}
 
 	// Use gh pr create --fill for instant PR creation (fills title/body from commits)
@@ -1192,27 +2275,33 @@ func (r *Router) cmdTest(ctx context.Context, chatID, args string) {
 	if workDir == "" {
 		workDir = r.store.WorkRoot()
 	}
+	if sub, rest, _ := strings.Cut(args, " "); sub == "quarantine" {
+		r.cmdTestQuarantine(ctx, chatID, workDir, rest)
+		return
+	}
+	if cfg, root, _ := r.repoConfig(workDir); cfg.Test != "" {
+		if r.repoCommandDenied(ctx, chatID, "/test") {
+			return
+		}
+		r.runRepoCommand(ctx, chatID, root, "测试", repoCommandLine(cfg.Test, args))
+		return
+	}
 
 	// Fast path: if go.mod exists, run go test directly (no Claude overhead)
 	if _, err := os.Stat(filepath.Join(workDir, "go.mod")); err == nil {
+		repo := repoRoot(workDir)
+		var quarantined []string
+		if args == "" {
+			quarantined = r.store.QuarantinedTests(repo)
+		}
+		if r.testShards > 1 && r.runShardedGoTest(ctx, chatID, workDir, args, quarantined) {
+			return
+		}
 		execCtx, cancel := context.WithTimeout(ctx, 120*time.Second)
 		defer cancel()
-		var cmdArgs []string
-		if args != "" {
-			cmdArgs = []string{"test", "./...", "-run", args, "-v"}
-		} else {
-			cmdArgs = []string{"test", "./..."}
-		}
-		cmd := exec.CommandContext(execCtx, "go", cmdArgs...)
-		cmd.Dir = workDir
-		var outBuf bytes.Buffer
-		cmd.Stdout = &outBuf
-		cmd.Stderr = &outBuf
-		runErr := cmd.Run()
-		output := strings.TrimSpace(outBuf.String())
-		if runes := []rune(output); len(runes) > 4000 {
-			output = "（输出过长，仅显示末尾部分）\n\n" + string(runes[len(runes)-4000:])
-		}
+		output, results, runErr := runGoTests(execCtx, workDir, goTestArgs(args, quarantined, "./..."), args != "")
+		r.recordTestCache(output)
+		output, full := r.fitOutput(chatID, "test", output, true, "输出过长")
 		if output == "" {
 			output = "（无输出）"
 		}
@@ -1222,7 +2311,9 @@ func (r *Router) cmdTest(ctx context.Context, chatID, args string) {
 			tpl = "red"
 			title = "go test 失败"
 		}
-		r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: "```\n" + output + "\n```", Template: tpl})
+		content := "```\n" + output + "\n```" + r.testHealthNote(execCtx, repo, workDir, results, quarantined)
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: content, Template: tpl})
+		r.sendFullOutput(ctx, chatID, full)
 		return
 	}
 
@@ -1265,17 +2356,14 @@ func (r *Router) cmdTodo(ctx context.Context, chatID string) {
 		return
 	}
 
-	const maxOut = 4000
-	if runes := []rune(output); len(runes) > maxOut {
-		output = fmt.Sprintf("（结果过多，仅显示前 %d 字符）\n\n", maxOut) + string(runes[:maxOut])
-	}
-
 	// Count items
 	lines := strings.Split(strings.TrimSpace(output), "\n")
+	output, full := r.fitOutput(chatID, "todo", output, false, "结果过多")
 	r.sender.SendCard(ctx, chatID, CardMsg{
 		Title:   fmt.Sprintf("待办事项 (%d 处)", len(lines)),
 		Content: "```\n" + output + "\n```",
 	})
+	r.sendFullOutput(ctx, chatID, full)
 }
 
 func (r *Router) cmdDebug(ctx context.Context, chatID string) {
@@ -1472,6 +2560,46 @@ func (r *Router) cmdStats(ctx context.Context, chatID string) {
 		workDir = r.store.WorkRoot()
 	}
 
+	// Stats of a clean checkout only depend on the commit, so they can be
+	// served from the knowledge cache.
+	var content string
+	var ok bool
+	if out, err := runGitOutput(workDir, "status", "--porcelain"); r.cache != nil && err == nil && out == "" {
+		content, ok = r.cachedKnowledge(workDir, statsCacheKind(workDir), func(string) (string, bool) {
+			return projectStats(workDir)
+		})
+	}
+	if !ok {
+		content, ok = projectStats(workDir)
+	}
+	if !ok {
+		r.sender.SendText(ctx, chatID, "当前目录无文件或目录不存在。")
+		return
+	}
+
+	// Last commit (not cached: the relative time keeps changing)
+	if lastCommit, err := runGitOutput(workDir, "log", "-1", "--pretty=format:%h %s (%ar)"); err == nil && lastCommit != "" {
+		content += fmt.Sprintf("\n\n**最近提交:** %s", lastCommit)
+	}
+
+	r.sender.SendCard(ctx, chatID, CardMsg{
+		Title:   fmt.Sprintf("项目统计: %s", filepath.Base(workDir)),
+		Content: content,
+	})
+}
+
+// statsCacheKind keys /stats results by the directory inside the repository.
+func statsCacheKind(workDir string) string {
+	if root, _, ok := repoState(workDir); ok {
+		if rel, err := filepath.Rel(root, workDir); err == nil && rel != "." {
+			return cacheStats + ":" + filepath.ToSlash(rel)
+		}
+	}
+	return cacheStats
+}
+
+// projectStats counts files and code lines by extension under workDir.
+func projectStats(workDir string) (string, bool) {
 	// Count files by extension
 	extCount := make(map[string]int)
 	extLines := make(map[string]int)
@@ -1510,8 +2638,7 @@ func (r *Router) cmdStats(ctx context.Context, chatID string) {
 	})
 
 	if totalFiles == 0 {
-		r.sender.SendText(ctx, chatID, "当前目录无文件或目录不存在。")
-		return
+		return "", false
 	}
 
 	// Build output: sort by count
@@ -1557,16 +2684,7 @@ func (r *Router) cmdStats(ctx context.Context, chatID string) {
 		}
 	}
 	sb.WriteString("```")
-
-	// Last commit
-	if lastCommit, err := runGitOutput(workDir, "log", "-1", "--pretty=format:%h %s (%ar)"); err == nil && lastCommit != "" {
-		sb.WriteString(fmt.Sprintf("\n\n**最近提交:** %s", lastCommit))
-	}
-
-	r.sender.SendCard(ctx, chatID, CardMsg{
-		Title:   fmt.Sprintf("项目统计: %s", filepath.Base(workDir)),
-		Content: sb.String(),
-	})
+	return sb.String(), true
 }
 
 func (r *Router) cmdRemote(ctx context.Context, chatID, args string) {
@@ -1623,79 +2741,6 @@ func (r *Router) cmdTag(ctx context.Context, chatID, args string) {
 	r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 标签已创建: %s", args))
 }
 
-func (r *Router) cmdPRList(ctx context.Context, chatID, args string) {
-	session := r.getSession(chatID)
-	workDir := session.WorkDir
-	if workDir == "" {
-		workDir = r.store.WorkRoot()
-	}
-
-	execCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
-
-	// Default: show open PRs; with "all", show all
-	ghArgs := []string{"pr", "list", "--limit", "20"}
-	if args == "all" {
-		ghArgs = append(ghArgs, "--state", "all")
-	} else if args != "" {
-		ghArgs = append(ghArgs, strings.Fields(args)...)
-	}
-
-	cmd := exec.CommandContext(execCtx, "gh", ghArgs...)
-	cmd.Dir = workDir
-	out, err := cmd.CombinedOutput()
-	output := strings.TrimSpace(string(out))
-
-	if err != nil {
-		content := output
-		if content == "" {
-			content = err.Error()
-		}
-		r.sender.SendCard(ctx, chatID, CardMsg{Title: "获取 PR 列表出错", Content: content, Template: "red"})
-		return
-	}
-	if output == "" {
-		r.sender.SendText(ctx, chatID, "没有开放中的 Pull Request。")
-		return
-	}
-	r.sender.SendCard(ctx, chatID, CardMsg{Title: "Pull Requests", Content: "```\n" + output + "\n```"})
-}
-
-func (r *Router) cmdIssues(ctx context.Context, chatID, args string) {
-	session := r.getSession(chatID)
-	workDir := session.WorkDir
-	if workDir == "" {
-		workDir = r.store.WorkRoot()
-	}
-
-	execCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
-
-	ghArgs := []string{"issue", "list", "--limit", "20"}
-	if args != "" {
-		ghArgs = append(ghArgs, strings.Fields(args)...)
-	}
-
-	cmd := exec.CommandContext(execCtx, "gh", ghArgs...)
-	cmd.Dir = workDir
-	out, err := cmd.CombinedOutput()
-	output := strings.TrimSpace(string(out))
-
-	if err != nil {
-		content := output
-		if content == "" {
-			content = err.Error()
-		}
-		r.sender.SendCard(ctx, chatID, CardMsg{Title: "获取 Issues 出错", Content: content, Template: "red"})
-		return
-	}
-	if output == "" {
-		r.sender.SendText(ctx, chatID, "没有开放中的 Issue。")
-		return
-	}
-	r.sender.SendCard(ctx, chatID, CardMsg{Title: "Issues", Content: "```\n" + output + "\n```"})
-}
-
 func (r *Router) cmdSh(ctx context.Context, chatID, args string) {
 	if args == "" {
 		r.sender.SendText(ctx, chatID, "用法: /sh <命令>\n示例: /sh ls -la\n示例: /sh cat README.md")
@@ -1710,7 +2755,29 @@ func (r *Router) cmdSh(ctx context.Context, chatID, args string) {
 // This is much faster than /sh for simple commands since it bypasses the LLM.
 func (r *Router) cmdExec(ctx context.Context, chatID, args string) {
 	if args == "" {
-		r.sender.SendText(ctx, chatID, "用法: /exec <命令>\n示例: /exec ls -la\n示例: /exec make build\n示例: /exec go test ./...")
+		r.sender.SendText(ctx, chatID, "用法: /exec [--timeout 5m] [--env KEY=VALUE]... [--cwd 子目录] <命令>\n示例: /exec ls -la\n示例: /exec --timeout 5m go test ./...\n示例: /exec --cwd web --env CI=1 npm run build | tail -20\n/exec !!  重复上一条命令，/exec !<序号>  重复历史中的命令，/exec history  查看历史\n默认超时 30 秒，最长 30 分钟；命令原样交给 sh 执行，管道和引号照常可用")
+		return
+	}
+	if args == "history" {
+		r.listExecHistory(ctx, chatID)
+		return
+	}
+	line, repeated, err := r.resolveExecHistory(chatID, args)
+	if err != nil {
+		r.sender.SendText(ctx, chatID, err.Error())
+		return
+	}
+	flags, err := parseExecFlags(line)
+	if err == nil && flags.command == "" {
+		err = fmt.Errorf("缺少要执行的命令")
+	}
+	if err != nil {
+		r.sender.SendText(ctx, chatID, err.Error())
+		return
+	}
+	// Route only saw "/exec !!"; the command it stands for needs the same
+	// approval as when it was typed.
+	if r.holdForApproval(ctx, chatID, userIDFrom(ctx), "/exec "+line) {
 		return
 	}
 	session := r.getSession(chatID)
@@ -1718,12 +2785,29 @@ func (r *Router) cmdExec(ctx context.Context, chatID, args string) {
 	if workDir == "" {
 		workDir = r.store.WorkRoot()
 	}
+	dir, err := execDir(workDir, flags.cwd)
+	if err != nil {
+		r.sender.SendText(ctx, chatID, err.Error())
+		return
+	}
+	if name, ok := r.shellTouchesReferenceDir(dir, flags.command); ok {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("命令涉及只读参考目录 %s，不能执行。", name))
+		return
+	}
+	r.recordExecHistory(chatID, line)
+
+	if paths := shellDeletions(flags.command); len(paths) > 0 {
+		r.trashDeletion(ctx, chatID, dir, "exec", paths)
+	}
 
-	execCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	execCtx, cancel := context.WithTimeout(ctx, flags.timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(execCtx, "sh", "-c", args)
-	cmd.Dir = workDir
+	cmd := exec.CommandContext(execCtx, "sh", "-c", flags.command)
+	cmd.Dir = dir
+	if len(flags.env) > 0 {
+		cmd.Env = append(os.Environ(), flags.env...)
+	}
 	var outBuf, errBuf bytes.Buffer
 	cmd.Stdout = &outBuf
 	cmd.Stderr = &errBuf
@@ -1740,12 +2824,19 @@ func (r *Router) cmdExec(ctx context.Context, chatID, args string) {
 		combined += errBuf.String()
 	}
 
-	const maxOut = 4000
-	if runes := []rune(combined); len(runes) > maxOut {
-		combined = "（输出过长，仅显示末尾部分）\n\n" + string(runes[len(runes)-maxOut:])
-	}
+	combined, full := r.fitOutput(chatID, "exec", cleanTerminal(combined), true, "输出过长")
 
-	title := fmt.Sprintf("$ %s  （耗时 %s）", args, elapsed)
+	var meta []string
+	if dir != workDir {
+		rel, _ := filepath.Rel(workDir, dir)
+		meta = append(meta, rel+"/")
+	}
+	var exitErr *exec.ExitError
+	if errors.As(runErr, &exitErr) && execCtx.Err() == nil {
+		meta = append(meta, fmt.Sprintf("退出码 %d", exitErr.ExitCode()))
+	}
+	meta = append(meta, "耗时 "+elapsed.String())
+	title := fmt.Sprintf("$ %s  （%s）", flags.command, strings.Join(meta, "，"))
 	if combined == "" {
 		combined = "（无输出）"
 	}
@@ -1753,16 +2844,30 @@ func (r *Router) cmdExec(ctx context.Context, chatID, args string) {
 	tpl := "blue"
 	if runErr != nil && execCtx.Err() == context.DeadlineExceeded {
 		tpl = "red"
-		combined = "⏱ 命令超时（30秒）\n\n" + combined
+		combined = fmt.Sprintf("⏱ 命令超时（%s），可用 --timeout 延长\n\n", flags.timeout) + combined
 	} else if runErr != nil {
 		tpl = "red"
+		if exitErr == nil {
+			combined = fmt.Sprintf("无法执行: %v\n\n", runErr) + combined
+		}
+	}
+	card := CardMsg{Title: title, Content: "```\n" + combined + "\n```", Template: tpl}
+	if repeated {
+		card.Content = fmt.Sprintf("重复执行: `%s`\n", line) + card.Content
 	}
-	r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: "```\n" + combined + "\n```", Template: tpl})
+	r.sender.SendCard(ctx, chatID, card)
+	r.sendFullOutput(ctx, chatID, full)
 }
 
 func (r *Router) cmdFile(ctx context.Context, chatID, args string) {
 	if args == "" {
-		r.sender.SendText(ctx, chatID, "用法: /file <文件路径>[:<行号>]\n示例: /file README.md\n示例: /file src/main.go:50")
+		r.sender.SendText(ctx, chatID, "用法: /file <文件路径>[:<行号>|:<起始行>-<结束行>]\n示例: /file README.md\n示例: /file src/main.go:50\n示例: /file logs/app.log:12000-12200")
+		return
+	}
+	if m := fileRangeRe.FindStringSubmatch(args); m != nil {
+		first, _ := strconv.Atoi(m[2])
+		last, _ := strconv.Atoi(m[3])
+		r.fileRange(ctx, chatID, m[1], first, last)
 		return
 	}
 	// Parse optional line hint: /file path:lineNum
@@ -1779,7 +2884,7 @@ func (r *Router) cmdFile(ctx context.Context, chatID, args string) {
 	}
 
 	session := r.getSession(chatID)
-	target := findFile(session.WorkDir, filePart)
+	target := r.readablePath(session.WorkDir, filePart)
 	if target == "" {
 		r.sender.SendText(ctx, chatID, fmt.Sprintf("文件不存在: %s", filePart))
 		return
@@ -1825,7 +2930,46 @@ func (r *Router) cmdFile(ctx context.Context, chatID, args string) {
 		title += "  " + subtitle
 	}
 
-	r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: "```\n" + output + "\n```"})
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: "```" + langForPath(target) + "\n" + output + "\n```"})
+}
+
+// fileRangeRe matches a /file argument with a line range: path:start-end.
+var fileRangeRe = regexp.MustCompile(`^(.+):(\d+)-(\d+)$`)
+
+// fileRange shows lines first..last of a file, reading it as a stream so
+// sections deep inside large logs can be inspected. Ranges longer than
+// maxTailLines are cut.
+func (r *Router) fileRange(ctx context.Context, chatID, query string, first, last int) {
+	if first < 1 || last < first {
+		r.sender.SendText(ctx, chatID, "行号范围无效，应为 <起始行>-<结束行>，且起始行 ≥ 1、不大于结束行。")
+		return
+	}
+	note := ""
+	if last-first+1 > maxTailLines {
+		last = first + maxTailLines - 1
+		note = fmt.Sprintf("\n\n范围超过 %d 行，只显示到第 %d 行。", maxTailLines, last)
+	}
+	target := r.readablePath(r.getSession(chatID).WorkDir, query)
+	if target == "" {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("文件不存在: %s", query))
+		return
+	}
+	lines, total, err := readLineRange(target, first, last)
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("读取文件出错: %v", err))
+		return
+	}
+	if len(lines) == 0 {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("%s 只有 %d 行。", query, total))
+		return
+	}
+	last = first + len(lines) - 1
+	output, full := r.fitOutput(chatID, "file", cleanTerminal(numberedLines(first, lines)), false, "内容过长")
+	r.sender.SendCard(ctx, chatID, CardMsg{
+		Title:   fmt.Sprintf("%s  （第 %d–%d 行，共 %d 行）", filepath.Base(target), first, last, total),
+		Content: "```" + langForPath(target) + "\n" + output + "\n```" + note,
+	})
+	r.sendFullOutput(ctx, chatID, full)
 }
 
 // gitBranch returns the current git branch name in workDir, or empty on error.
@@ -1852,7 +2996,7 @@ func gitStatusSummary(workDir string) string {
 		return ""
 	}
 	var out bytes.Buffer
-	cmd := exec.Command("git", "-C", workDir, "status", "--porcelain")
+	cmd := exec.Command("git", "-C", workDir, "status", "--porcelain=v2")
 	cmd.Stdout = &out
 	if err := cmd.Run(); err != nil {
 		return ""
@@ -1861,8 +3005,35 @@ func gitStatusSummary(workDir string) string {
 	if output == "" {
 		return "无变更"
 	}
-	lines := strings.Split(output, "\n")
-	return fmt.Sprintf("%d 个文件变更", len(lines))
+	// Changed entries carry a submodule state in their third field:
+	// "N..." for files, "S<c><m><u>" for submodules.
+	files, submodules := 0, 0
+	for _, line := range strings.Split(output, "\n") {
+		if fields := strings.Fields(line); len(fields) > 2 && fields[0] != "?" && fields[0] != "!" && strings.HasPrefix(fields[2], "S") {
+			submodules++
+		} else {
+			files++
+		}
+	}
+	switch {
+	case submodules == 0:
+		return fmt.Sprintf("%d 个文件变更", files)
+	case files == 0:
+		return fmt.Sprintf("%d 个子模块有变更", submodules)
+	}
+	return fmt.Sprintf("%d 个文件变更，%d 个子模块有变更", files, submodules)
+}
+
+// gitHead returns the commit checked out in workDir, or "" outside a git repo.
+func gitHead(workDir string) string {
+	if workDir == "" {
+		return ""
+	}
+	head, err := runGitOutput(workDir, "rev-parse", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return head
 }
 
 // runGitOutput runs a git command in workDir and returns combined stdout+stderr output.
@@ -1886,15 +3057,24 @@ func truncateForDisplay(text string, maxRunes int) string {
 	return "（内容过长，仅显示最新部分）\n\n" + string(runes[len(runes)-maxRunes:])
 }
 
+// truncateRunes shortens text to at most maxRunes runes, marking the cut with "…".
+func truncateRunes(text string, maxRunes int) string {
+	runes := []rune(text)
+	if len(runes) <= maxRunes {
+		return text
+	}
+	return string(runes[:maxRunes]) + "…"
+}
+
 // knownCommands is the authoritative list of all supported slash commands.
 var knownCommands = []string{
 	"/help", "/ping", "/version", "/status", "/info",
 	"/pwd", "/ls", "/root", "/cd",
-	"/new", "/sessions", "/switch", "/kill", "/cancel", "/retry",
-	"/last", "/summary", "/model", "/yolo", "/safe",
-	"/git", "/diff", "/log", "/show", "/blame", "/branch", "/commit", "/fetch", "/pull", "/push", "/pr", "/prs", "/issues",
+	"/new", "/sessions", "/switch", "/save", "/load", "/rename", "/export", "/checkpoint", "/checkpoints", "/restore", "/handoff", "/kill", "/cancel", "/trace", "/confirm", "/deny", "/approve", "/reject", "/retry", "/urgent", "/force", "/queue", "/dequeue", "/tasks", "/repro", "/json",
+	"/last", "/summary", "/catchup", "/incident", "/model", "/yolo", "/safe",
+	"/git", "/diff", "/log", "/show", "/blame", "/branch", "/review-local", "/commit", "/fetch", "/pull", "/clone", "/sync", "/push", "/pr", "/prs", "/issues", "/issue",
 	"/undo", "/stash", "/clean", "/remote", "/tag",
-	"/grep", "/find", "/test", "/todo", "/recent", "/tree", "/size", "/stats", "/debug", "/sh", "/exec", "/file", "/compact",
+	"/grep", "/find", "/test", "/lint", "/run", "/sec", "/verify", "/protect", "/licenses", "/buildbin", "/docker", "/tail", "/head", "/shell", "/ps", "/port", "/admin", "/loglevel", "/db", "/curl", "/scratch", "/get", "/trash", "/foreach", "/campaign", "/about", "/focus", "/share", "/remind", "/report", "/output", "/ack", "/prefix", "/say", "/guest", "/label", "/feedback", "/experiments", "/history", "/todo", "/recent", "/tree", "/size", "/stats", "/usage", "/audit", "/cache", "/watch", "/hooks", "/debug", "/sh", "/exec", "/file", "/write", "/append", "/compact",
 	"/doc",
 }
 
@@ -1913,6 +3093,57 @@ func suggestCommand(unknown string) string {
 	return best
 }
 
+// maxCompletions bounds the commands listed for an ambiguous prefix.
+const maxCompletions = 15
+
+// completeCommand returns the known commands that prefix abbreviates, in
+// alphabetical order.
+func completeCommand(prefix string) []string {
+	if len(prefix) < 2 {
+		return nil
+	}
+	var matches []string
+	for _, cmd := range knownCommands {
+		if strings.HasPrefix(cmd, prefix) && cmd != prefix {
+			matches = append(matches, cmd)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// commandSummary returns the description /help gives cmd, shortened, or
+// "" if it has none.
+func commandSummary(cmd string) string {
+	for _, line := range strings.Split(helpText, "\n") {
+		if !strings.HasPrefix(line, "`"+cmd+"`") && !strings.HasPrefix(line, "`"+cmd+" ") {
+			continue
+		}
+		if i := strings.Index(line, "`  "); i >= 0 {
+			return truncateRunes(strings.TrimSpace(line[i+3:]), 40)
+		}
+	}
+	return ""
+}
+
+// completionCard lists the commands an ambiguous prefix could mean.
+func completionCard(prefix string, matches []string) CardMsg {
+	var sb strings.Builder
+	for i, cmd := range matches {
+		if i == maxCompletions {
+			fmt.Fprintf(&sb, "……另有 %d 个\n", len(matches)-maxCompletions)
+			break
+		}
+		if summary := commandSummary(cmd); summary != "" {
+			fmt.Fprintf(&sb, "`%s` — %s\n", cmd, summary)
+		} else {
+			fmt.Fprintf(&sb, "`%s`\n", cmd)
+		}
+	}
+	sb.WriteString("\n使用 /help 查看完整命令列表。")
+	return CardMsg{Title: fmt.Sprintf("%s 可能是以下命令之一", prefix), Content: sb.String()}
+}
+
 // levenshtein computes the edit distance between strings a and b.
 func levenshtein(a, b string) int {
 	la, lb := len(a), len(b)
@@ -2045,6 +3276,8 @@ func (r *Router) cmdDoc(ctx context.Context, chatID, args string) {
 		r.cmdDocPush(ctx, chatID, subArgs)
 	case "pull":
 		r.cmdDocPull(ctx, chatID, subArgs)
+	case "sync":
+		r.cmdDocSync(ctx, chatID, subArgs)
 	case "bind":
 		r.cmdDocBind(ctx, chatID, subArgs)
 	case "unbind":
@@ -2052,9 +3285,9 @@ func (r *Router) cmdDoc(ctx context.Context, chatID, args string) {
 	case "list":
 		r.cmdDocList(ctx, chatID)
 	case "":
-		r.sender.SendText(ctx, chatID, "用法: /doc <子命令>\n\n子命令: push | pull | bind | unbind | list\n示例: /doc push README.md")
+		r.sender.SendText(ctx, chatID, "用法: /doc <子命令>\n\n子命令: push | pull | sync | bind | unbind | list\n示例: /doc push README.md")
 	default:
-		r.sender.SendText(ctx, chatID, fmt.Sprintf("未知的 doc 子命令: %s\n\n支持的子命令: push | pull | bind | unbind | list", sub))
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("未知的 doc 子命令: %s\n\n支持的子命令: push | pull | sync | bind | unbind | list", sub))
 	}
 }
 
@@ -2063,8 +3296,17 @@ func (r *Router) cmdDocPush(ctx context.Context, chatID, args string) {
 		r.sender.SendText(ctx, chatID, "飞书文档同步未配置，请联系管理员检查 API 配置。")
 		return
 	}
+	var folder string
+	if rest, ok := strings.CutPrefix(args, "--folder "); ok {
+		folder, args, _ = strings.Cut(strings.TrimSpace(rest), " ")
+		args = strings.TrimSpace(args)
+	}
 	if args == "" {
-		r.sender.SendText(ctx, chatID, "用法: /doc push <文件路径>\n示例: /doc push README.md")
+		r.sender.SendText(ctx, chatID, "用法: /doc push [--folder <文件夹token>] <文件或目录路径>\n示例: /doc push README.md\n推送目录时其中每个 Markdown 文件各推送为一个文档。")
+		return
+	}
+	if _, ok := r.docSyncer.(folderDocPusher); folder != "" && !ok {
+		r.sender.SendText(ctx, chatID, "当前文档服务不支持指定文件夹。")
 		return
 	}
 
@@ -2080,6 +3322,10 @@ func (r *Router) cmdDocPush(ctx context.Context, chatID, args string) {
 		r.sender.SendText(ctx, chatID, "不允许访问工作根目录以外的文件: "+root)
 		return
 	}
+	if info, err := os.Stat(filePath); err == nil && info.IsDir() {
+		r.pushDocDir(ctx, chatID, filePath, folder)
+		return
+	}
 
 	data, err := os.ReadFile(filePath)
 	if err != nil {
@@ -2087,20 +3333,22 @@ func (r *Router) cmdDocPush(ctx context.Context, chatID, args string) {
 		return
 	}
 
-	title := filepath.Base(filePath)
-	content := string(data)
-
-	docID, docURL, err := r.docSyncer.CreateAndPushDoc(ctx, title, content)
+	docID, docURL, updated, err := r.pushDocFile(ctx, chatID, filePath, filepath.Base(filePath), folder, data)
 	if err != nil {
-		r.sender.SendText(ctx, chatID, fmt.Sprintf("推送文档出错: %v", err))
+		if updated {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("更新文档 %s 出错: %v\n如该文档已删除，请先 /doc unbind %s 再推送。", docID, err, args))
+		} else {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("推送文档出错: %v", err))
+		}
 		return
 	}
 
-	r.store.SetDocBinding(filePath, docID)
-	r.save()
-
+	cardTitle := "✓ 文档已推送"
+	if updated {
+		cardTitle = "✓ 文档已更新"
+	}
 	md := fmt.Sprintf("**文档 ID:** %s\n**链接:** [%s](%s)", docID, docURL, docURL)
-	r.sender.SendCard(ctx, chatID, CardMsg{Title: "✓ 文档已推送", Content: md})
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: cardTitle, Content: md})
 }
 
 func (r *Router) cmdDocPull(ctx context.Context, chatID, args string) {
@@ -2132,7 +3380,7 @@ func (r *Router) cmdDocPull(ctx context.Context, chatID, args string) {
 		return
 	}
 
-	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+	if err := r.pullDocFile(chatID, filePath, docID, content); err != nil {
 		r.sender.SendText(ctx, chatID, fmt.Sprintf("写入文件出错: %v", err))
 		return
 	}
@@ -2201,15 +3449,15 @@ func (r *Router) cmdDocList(ctx context.Context, chatID string) {
 }
 
 func (r *Router) RouteImage(ctx context.Context, chatID, userID string, imageData []byte, fileName string) {
-	if !r.allowedUsers[userID] {
+	if !r.allowedUsers[userID] || r.promptDenied(ctx, chatID, userID) {
 		return
 	}
+	ctx = withLogFields(ctx, "chat_id", chatID, "user_id", userID)
 
 	session := r.getSession(chatID)
 
-	// Save image to work directory
-	imgDir := filepath.Join(session.WorkDir, ".devbot-images")
-	if err := os.MkdirAll(imgDir, 0755); err != nil {
+	imgDir, err := r.uploadDir(chatID, session.WorkDir, true)
+	if err != nil {
 		r.sender.SendText(ctx, chatID, fmt.Sprintf("Failed to create image directory: %v", err))
 		return
 	}
@@ -2220,20 +3468,19 @@ func (r *Router) RouteImage(ctx context.Context, chatID, userID string, imageDat
 	}
 
 	r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 图片已保存: %s", imgPath))
-	prompt := fmt.Sprintf("用户发来了一张图片，已保存到: %s。请描述或处理这张图片。", imgPath)
-	r.execClaudeQueued(ctx, chatID, prompt)
+	r.submitChecked(ctx, chatID, imagePromptDefault, execOptions{Images: []string{imgPath}})
 }
 
 func (r *Router) RouteTextWithImages(ctx context.Context, chatID, userID, text string, images []ImageAttachment) {
-	if !r.allowedUsers[userID] {
+	if !r.allowedUsers[userID] || r.promptDenied(ctx, chatID, userID) {
 		return
 	}
+	ctx = withLogFields(ctx, "chat_id", chatID, "user_id", userID)
 
 	session := r.getSession(chatID)
 
-	// Save all images to work directory
-	imgDir := filepath.Join(session.WorkDir, ".devbot-images")
-	if err := os.MkdirAll(imgDir, 0755); err != nil {
+	imgDir, err := r.uploadDir(chatID, session.WorkDir, true)
+	if err != nil {
 		r.sender.SendText(ctx, chatID, fmt.Sprintf("Failed to create image directory: %v", err))
 		return
 	}
@@ -2242,36 +3489,58 @@ func (r *Router) RouteTextWithImages(ctx context.Context, chatID, userID, text s
 	for _, img := range images {
 		imgPath := filepath.Join(imgDir, filepath.Base(img.FileName))
 		if err := os.WriteFile(imgPath, img.Data, 0644); err != nil {
-			log.Printf("router: failed to save image %s: %v", img.FileName, err)
+			slog.WarnContext(ctx, "router: failed to save image", "file", img.FileName, "err", err)
 			continue
 		}
 		savedPaths = append(savedPaths, imgPath)
 	}
 
-	// Build prompt combining text and image paths
-	var prompt string
-	if text != "" && len(savedPaths) > 0 {
-		prompt = text + "\n\n附带图片路径: " + strings.Join(savedPaths, ", ")
-	} else if text != "" {
-		prompt = text
-	} else if len(savedPaths) > 0 {
-		prompt = fmt.Sprintf("用户发来了一张图片，已保存到: %s。请描述或处理这张图片。", savedPaths[0])
-	} else {
-		return
+	prompt := text
+	if prompt == "" {
+		if len(savedPaths) == 0 {
+			return
+		}
+		prompt = imagePromptDefault
 	}
+	r.submitChecked(ctx, chatID, prompt, execOptions{Images: savedPaths})
+}
 
-	r.execClaudeQueued(ctx, chatID, prompt)
+// uploadDir returns the directory uploads from chatID are saved to: the
+// chat's scratch space when configured, otherwise the workdir. Images go
+// to a subdirectory of their own.
+func (r *Router) uploadDir(chatID, workDir string, images bool) (string, error) {
+	dir, err := r.scratchDir(chatID)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case dir != "" && images:
+		dir = filepath.Join(dir, "images")
+	case dir != "":
+		return dir, nil
+	case images:
+		dir = filepath.Join(workDir, ".devbot-images")
+	default:
+		return workDir, nil
+	}
+	return dir, os.MkdirAll(dir, 0755)
 }
 
 func (r *Router) RouteFile(ctx context.Context, chatID, userID, fileName string, fileData []byte) {
-	if !r.allowedUsers[userID] {
+	if !r.allowedUsers[userID] || r.promptDenied(ctx, chatID, userID) {
 		return
 	}
+	ctx = withLogFields(ctx, "chat_id", chatID, "user_id", userID)
 
 	session := r.getSession(chatID)
 
-	// Save file to work directory (use Base to prevent path traversal)
-	filePath := filepath.Join(session.WorkDir, filepath.Base(fileName))
+	dir, err := r.uploadDir(chatID, session.WorkDir, false)
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("Failed to save file: %v", err))
+		return
+	}
+	// Use Base to prevent path traversal
+	filePath := filepath.Join(dir, filepath.Base(fileName))
 	if err := os.WriteFile(filePath, fileData, 0644); err != nil {
 		r.sender.SendText(ctx, chatID, fmt.Sprintf("Failed to save file: %v", err))
 		return
@@ -2279,7 +3548,7 @@ func (r *Router) RouteFile(ctx context.Context, chatID, userID, fileName string,
 
 	r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 文件已保存: %s", filePath))
 	prompt := fmt.Sprintf("用户发来了文件 '%s'，已保存到: %s。请检查或处理这个文件。", fileName, filePath)
-	r.execClaudeQueued(ctx, chatID, prompt)
+	r.submitChecked(ctx, chatID, prompt, execOptions{})
 }
 
 func (r *Router) RouteDocShare(ctx context.Context, chatID, userID, docID string) {
@@ -2289,42 +3558,198 @@ func (r *Router) RouteDocShare(ctx context.Context, chatID, userID, docID string
 	r.sender.SendText(ctx, chatID, fmt.Sprintf("检测到飞书文档: %s\n\n- 使用 `/doc bind <本地路径> %s` 绑定到本地文件\n- 或使用 `/doc pull <路径>` 拉取内容（如已绑定）", docID, docID))
 }
 
+// handlePrompt queues a message typed in the chat, asking first when it
+// looks expensive. After a long idle the chat's repository is refreshed
+// before the run, and huge messages, usually pasted logs, are trimmed.
 func (r *Router) handlePrompt(ctx context.Context, chatID, text string) {
+	r.getSession(chatID) // ensure session exists
+	r.syncIfIdle(chatID)
+	if t, ok := trimPrompt(text, r.maxPromptChars); ok {
+		slog.InfoContext(ctx, "router: trimmed prompt", "chat_id", chatID, "chars", t.originalChars, "omitted_lines", t.omittedLines)
+		r.sender.SendText(ctx, chatID, trimPromptNote(t, r.maxPromptChars))
+		text = t.text
+	}
+	r.store.UpdateSession(chatID, func(s *Session) {
+		s.LastPrompt = text
+	})
+	r.submitFocused(ctx, chatID, text)
+}
+
+// SubmitPrompt records text as the chat's last prompt and queues it for Claude.
+// It returns the ID assigned to the execution, which can be looked up with
+// LookupExec while queued, while running, and after it finishes.
+func (r *Router) SubmitPrompt(ctx context.Context, chatID, text string) (string, error) {
 	r.getSession(chatID) // ensure session exists
 	// Save prompt before queuing so /retry is always available
 	r.store.UpdateSession(chatID, func(s *Session) {
 		s.LastPrompt = text
 	})
-	r.execClaudeQueued(ctx, chatID, text)
+	return r.enqueueExec(ctx, chatID, text, execOptions{})
 }
 
 func (r *Router) execClaudeQueued(ctx context.Context, chatID string, prompt string) {
-	if r.queue != nil {
-		pending := r.queue.PendingCount(chatID)
-		if pending > 0 {
-			r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("已排队（第 %d 位）", pending+1), Content: "当前有任务正在执行，请稍候...", Template: "blue"})
+	r.enqueueExec(ctx, chatID, prompt, execOptions{})
+}
+
+// execOptions adjusts how enqueueExec queues a prompt.
+type execOptions struct {
+	Urgent bool     // queue ahead of normal prompts
+	Force  bool     // queue even if the same prompt is already waiting
+	Images []string // image files sent to Claude with the prompt
+
+	Retry      bool   // a /retry: the result is compared with PrevOutput
+	PrevOutput string // output of the attempt being retried
+
+	Template string // prompt template variant the prompt was built from
+
+	ID string // execution ID to use instead of a new one (restored tasks)
+}
+
+// runContext returns ctx carrying the per-run settings of opts.
+func (opts execOptions) runContext(ctx context.Context) context.Context {
+	ctx = withImages(ctx, opts.Images)
+	ctx = withPromptTemplate(ctx, opts.Template)
+	if opts.Retry {
+		ctx = withRetryOf(ctx, opts.PrevOutput)
+	}
+	return ctx
+}
+
+// enqueueExec assigns an execution ID to prompt and queues it (or runs it
+// synchronously when no queue is configured). Urgent prompts are queued
+// ahead of normal ones. If the same prompt is already waiting in the chat's
+// queue it is not queued again unless forced; the waiting execution's ID is
+// returned instead.
+func (r *Router) enqueueExec(ctx context.Context, chatID, prompt string, opts execOptions) (string, error) {
+	id := opts.ID
+	if id == "" {
+		id = newExecID()
+	}
+	if r.queue == nil {
+		r.execClaude(opts.runContext(ctx), chatID, id, prompt)
+		return id, nil
+	}
+	// Prompts with images differ by the images, which the queue does not
+	// compare.
+	if !opts.Force && len(opts.Images) == 0 {
+		if dupID, pos, ok := r.findQueuedDuplicate(chatID, prompt); ok {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("相同的请求已在队列中（第 %d 位），不会重复执行。\n如需再执行一次，请使用 /force <prompt>。", pos))
+			return dupID, nil
 		}
-		if err := r.queue.Enqueue(chatID, func() {
-			r.execClaude(r.ctx, chatID, prompt)
-		}); err != nil {
-			r.sender.SendText(ctx, chatID, "队列已满，请稍后再试。")
+	}
+	urgent := opts.Urgent
+	r.setQueued(ExecRecord{ID: id, ChatID: chatID, Prompt: prompt, Urgent: urgent, StartedAt: time.Now()})
+	r.mu.Lock()
+	r.queuedOpts[id] = opts
+	r.mu.Unlock()
+	runCtx := opts.runContext(copyLogFields(withMessageID(r.ctx, messageIDFrom(ctx)), ctx))
+	pos, err := r.queue.EnqueueTask(chatID, QueueEntry{ID: id, Urgent: urgent}, func() {
+		r.execClaude(runCtx, chatID, id, prompt)
+	})
+	if err != nil {
+		r.clearQueued(id)
+		r.sender.SendText(ctx, chatID, "队列已满，请稍后再试。")
+		return "", err
+	}
+	// Restored tasks are announced together by ResumeQueue.
+	if pos > 1 && opts.ID == "" {
+		if urgent {
+			r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("⚡ 已插队（第 %d 位）", pos), Content: "紧急任务将在当前任务完成后优先执行。", Template: "orange", Receipt: id})
+		} else {
+			r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("已排队（第 %d 位）", pos), Content: "当前有任务正在执行，请稍候...", Template: "blue", Receipt: id})
 		}
-	} else {
-		r.execClaude(ctx, chatID, prompt)
 	}
+	return id, nil
 }
 
-func (r *Router) execClaude(ctx context.Context, chatID string, prompt string) {
-	r.sender.SendText(ctx, chatID, "执行中...")
+// checkResume makes sure the chat's session can be resumed in workDir
+// before a run: a workdir that no longer exists falls back to the work
+// root, and a session created in another workdir is not resumed. Either
+// way a fresh session is started and the chat is told why. It returns the
+// workdir and session ID to run with.
+func (r *Router) checkResume(ctx context.Context, chatID, workDir, sessionID string) (string, string) {
+	if info, err := os.Stat(workDir); workDir != "" && r.executor.LocalPaths() && (err != nil || !info.IsDir()) {
+		root := r.store.WorkRoot()
+		r.store.UpdateSession(chatID, func(s *Session) {
+			delete(s.DirSessions, s.WorkDir)
+			if s.ClaudeSessionID != "" {
+				s.History = append(s.History, s.ClaudeSessionID)
+			}
+			s.ClaudeSessionID = ""
+			s.WorkDir = root
+		})
+		r.save()
+		slog.WarnContext(ctx, "router: workdir missing, reset to root", "work_dir", workDir, "root", root, "chat_id", chatID)
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("⚠️ 工作目录 %s 已不存在，已切换到 %s 并开启新会话。", workDir, root))
+		return root, ""
+	}
+	if sessionID == "" {
+		return workDir, ""
+	}
+	// A session not tracked in DirSessions (e.g. switched to by ID) is left
+	// to the CLI.
+	var createdIn string
+	r.store.UpdateSession(chatID, func(s *Session) {
+		for dir, sid := range s.DirSessions {
+			if sid != sessionID {
+				continue
+			}
+			if dir == workDir {
+				createdIn = ""
+				return
+			}
+			createdIn = dir
+		}
+		if createdIn != "" {
+			s.History = append(s.History, s.ClaudeSessionID)
+			s.ClaudeSessionID = ""
+		}
+	})
+	if createdIn == "" {
+		return workDir, sessionID
+	}
+	r.save()
+	slog.InfoContext(ctx, "router: session belongs to another workdir, starting fresh", "session_id", sessionID, "created_in", createdIn, "work_dir", workDir, "chat_id", chatID)
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("⚠️ 会话 %s 创建于 %s，与当前工作目录 %s 不一致，已开启新会话（旧会话可用 /switch 恢复）。", shortHash(sessionID), createdIn, workDir))
+	return workDir, ""
+}
 
+func (r *Router) execClaude(ctx context.Context, chatID, execID, prompt string) {
+	ctx = withLogFields(ctx, "exec_id", execID)
+	ack := r.ackStart(ctx, chatID, "执行中...")
+	succeeded := false
+	defer func() { ack.finish(r.ctx, succeeded) }()
+
+	r.refreshIfDue(ctx, chatID)
 	workDir, sessionID, permMode, model := r.store.SessionExecParams(chatID)
+	workDir, sessionID = r.checkResume(ctx, chatID, workDir, sessionID)
 	if permMode == "" {
 		permMode = "safe"
 	}
 
 	startTime := time.Now()
+	rec := ExecRecord{
+		ID:             execID,
+		ChatID:         chatID,
+		Prompt:         prompt,
+		WorkDir:        workDir,
+		SessionID:      sessionID,
+		StartedAt:      startTime,
+		Model:          model,
+		PermissionMode: permMode,
+		GitHead:        gitHead(workDir),
+		Template:       promptTemplateFrom(ctx),
+	}
+	rec.Urgent = r.clearQueued(execID).Urgent
+	r.setActive(rec)
+	defer r.clearActive(rec.ID)
+
 	var lastSendTime time.Time
 	var lastProgressContent string
+	progressDelay, progressInterval := 5*time.Second, 10*time.Second
+	if r.inIncident(chatID) {
+		progressDelay, progressInterval = incidentProgressDelay, incidentProgressInterval
+	}
 
 	onProgress := func(text string) {
 		now := time.Now()
@@ -2332,42 +3757,183 @@ func (r *Router) execClaude(ctx context.Context, chatID string, prompt string) {
 		sinceLast := now.Sub(lastSendTime)
 
 		// Only send progress after 5 seconds, then every 10 seconds
-		if elapsed < 5*time.Second {
+		if elapsed < progressDelay {
 			return
 		}
-		if sinceLast < 10*time.Second {
+		if sinceLast < progressInterval {
 			return
 		}
 
 		lastSendTime = now
-		display := truncateForDisplay(strings.TrimSpace(text), 4000)
+		display := r.progressDisplay(chatID, text)
 		lastProgressContent = display
-		r.sender.SendCard(ctx, chatID, CardMsg{Content: display})
+		r.sender.SendCard(ctx, chatID, CardMsg{Content: display, Receipt: execID})
 	}
 
-	result, err := r.executor.ExecStream(ctx, prompt, workDir, sessionID, permMode, model, onProgress)
+	// @file and @diff references are expanded here, so the record keeps
+	// the prompt as written.
+	expanded, atts, problems := expandAttachments(workDir, prompt)
+	if notice := attachmentNotice(atts, problems); notice != "" {
+		r.sender.SendText(ctx, chatID, notice)
+	}
+	// A new Claude session starts with the chat's /about description and
+	// the cached repo map so it does not have to rediscover the project.
+	freshPrompt := func() string {
+		return r.withAboutContext(chatID, workDir, r.withReferenceContext(r.withRepoContext(workDir, expanded)))
+	}
+	execPrompt := expanded
+	if sessionID == "" {
+		execPrompt = freshPrompt()
+	}
+	defer r.observeHead(workDir)
+
+	if dir, err := r.scratchDir(chatID); err == nil {
+		ctx = withScratchDir(ctx, dir)
+	}
+	ctx = r.withReferenceDirs(ctx)
+	ctx = withDeleteGuard(ctx, func(paths []string, command string) bool {
+		if permMode != "yolo" && !r.confirmDelete(ctx, chatID, paths, command) {
+			return false
+		}
+		r.trashDeletion(ctx, chatID, workDir, "claude", paths)
+		return true
+	})
+	guard := r.protectBefore(workDir)
+	verify := r.verifyBefore(workDir)
+	format := r.formatBefore(workDir)
+	prevOutput, isRetry := retryOf(ctx)
+	var treeBefore string
+	if isRetry {
+		treeBefore = treeSnapshot(workDir)
+	}
+	runCtx, stop := r.killable(ctx, execID)
+	defer stop()
+	result, err := r.executor.ExecStream(runCtx, execPrompt, workDir, sessionID, permMode, model, onProgress)
 	elapsed := time.Since(startTime).Truncate(time.Second)
 	if err != nil {
 		// Auto-recover: if Claude session no longer exists, clear it and retry without --resume
 		if sessionID != "" && strings.Contains(err.Error(), "No conversation found with session ID") {
-			log.Printf("router: session %s not found, clearing and retrying without resume (chat=%s)", sessionID, chatID)
+			slog.WarnContext(ctx, "router: session not found, retrying without resume", "session_id", sessionID, "chat_id", chatID)
 			r.store.UpdateSession(chatID, func(s *Session) {
 				s.History = append(s.History, s.ClaudeSessionID)
 				s.ClaudeSessionID = ""
 			})
 			r.save()
-			result, err = r.executor.ExecStream(ctx, prompt, workDir, "", permMode, model, onProgress)
+			result, err = r.executor.ExecStream(runCtx, freshPrompt(), workDir, "", permMode, model, onProgress)
 			elapsed = time.Since(startTime).Truncate(time.Second)
 		}
 	}
+	// Protected files are put back before anything else looks at the tree.
+	if warning := guard.restore(); warning != "" {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "🛡 已撤销对受保护文件的修改", Content: warning, Template: "orange", Receipt: execID})
+	}
+	if err != nil && runCtx.Err() != nil && ctx.Err() == nil {
+		// Stopped by /kill <id>, which has already told the chat.
+		rec.Error = "killed: " + err.Error()
+		rec.Duration = time.Since(startTime)
+		r.addExecRecord("prompt", rec)
+		r.save()
+		return
+	}
+	if errors.Is(err, errDeletionRejected) {
+		// Keep the Claude session so the conversation can go on without
+		// the deletion.
+		result.Output = err.Error()
+		r.updateSessionResult(chatID, result)
+		rec.Error = err.Error()
+		rec.Duration = time.Since(startTime)
+		r.addExecRecord("prompt", rec)
+		r.save()
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("已停止（%s）", elapsed), Content: "删除操作未执行。可以继续对话，让 Claude 换一种方式完成任务。", Template: "orange", Receipt: execID})
+		return
+	}
 	if err != nil {
-		log.Printf("router: execClaude error chat=%s elapsed=%s: %v", chatID, elapsed, err)
-		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("执行出错（%s）", elapsed), Content: fmt.Sprintf("%v", err), Template: "red"})
+		slog.WarnContext(ctx, "router: execClaude error", "chat_id", chatID, "elapsed", elapsed, "err", err)
+		rec.Error = err.Error()
+		rec.Duration = time.Since(startTime)
+		r.addExecRecord("prompt", rec)
+		r.save()
+		card := CardMsg{Title: fmt.Sprintf("执行出错（%s）", elapsed), Content: fmt.Sprintf("%v", err), Template: "red", Receipt: execID}
+		if snapshot := r.envSnapshot(ctx, workDir); snapshot != "" {
+			card.Details = &CardDetails{Title: "环境信息", Content: snapshot}
+		}
+		r.sender.SendCard(ctx, chatID, card)
+		r.checkRepeatedFailure(ctx, chatID, rec)
+		return
+	}
+
+	r.updateSessionResult(chatID, result)
+	rec.Output = result.Output
+	rec.SessionID = result.SessionID
+	rec.Duration = time.Since(startTime)
+	rec.setResultMeta(result)
+	r.addExecRecord("prompt", rec)
+	r.save()
+
+	output := result.Output
+	if output == "" {
+		output = "（无输出）"
+	}
+	// The last progress card may already show the whole output; it went
+	// through redaction only, so compare before the rest of the pipeline.
+	shownInProgress := lastProgressContent != "" && r.progressDisplay(chatID, result.Output) == lastProgressContent
+	output = strings.TrimSpace(r.postProcess(ctx, chatID, workDir, output))
+	if result.IsPermissionDenial {
+		if !shownInProgress {
+			r.sender.SendCard(ctx, chatID, CardMsg{Title: "Claude 需要确认", Content: output + "\n\n使用 `/yolo` 开启无限制模式以跳过确认。", Template: "purple", Receipt: execID})
+		}
 		return
 	}
+	// Files Claude changed are formatted before verification, so neither
+	// the verifier nor the diff shows formatting problems. Verification
+	// runs only when Claude changed files; both outcomes go below the
+	// result.
+	note := format.run(ctx)
+	verifyNote, verified := verify.run(ctx)
+	if verifyNote != "" {
+		if note != "" {
+			note += "\n"
+		}
+		note += verifyNote
+	}
+	// Skip result card if identical to the last progress card
+	if !shownInProgress || note != "" {
+		card := CardMsg{Content: fenceCode(output), Receipt: execID}
+		if note != "" {
+			card.Content += "\n\n---\n" + note
+		}
+		if !verified {
+			card.Template = "orange"
+		}
+		if r.feedbackButtons {
+			card.Buttons = feedbackButtons(rec.ID)
+		}
+		r.sender.SendCard(ctx, chatID, card)
+	}
+	if isRetry {
+		r.sender.SendCard(ctx, chatID, CardMsg{
+			Title:   "🔁 与上次尝试的差异",
+			Content: retryDiffNote(prevOutput, output, retryTreeDiff(workDir, treeBefore)),
+			Receipt: execID,
+		})
+	}
+	succeeded = true
+	if !ack.reacting() {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 完成（耗时 %s）", elapsed))
+	}
+}
 
+// progressDisplay renders text for a progress card: redacted and trimmed
+// to what a card shows.
+func (r *Router) progressDisplay(chatID, text string) string {
+	return truncateForDisplay(strings.TrimSpace(r.redactFor(chatID, text)), 4000)
+}
+
+// updateSessionResult stores a successful run's output and Claude session
+// on the chat's session.
+func (r *Router) updateSessionResult(chatID string, result ExecResult) {
 	r.store.UpdateSession(chatID, func(s *Session) {
-		s.LastOutput = result.Output
+		s.LastOutput = r.redactFor(chatID, result.Output)
 		if result.SessionID != "" {
 			s.ClaudeSessionID = result.SessionID
 			// Keep dir→session map in sync
@@ -2379,22 +3945,4 @@ func (r *Router) execClaude(ctx context.Context, chatID string, prompt string) {
 			}
 		}
 	})
-	r.save()
-
-	output := result.Output
-	if output == "" {
-		output = "（无输出）"
-	}
-	output = strings.TrimSpace(output)
-	if result.IsPermissionDenial {
-		if output != lastProgressContent {
-			r.sender.SendCard(ctx, chatID, CardMsg{Title: "Claude 需要确认", Content: output + "\n\n使用 `/yolo` 开启无限制模式以跳过确认。", Template: "purple"})
-		}
-		return
-	}
-	// Skip result card if identical to the last progress card
-	if output != lastProgressContent {
-		r.sender.SendCard(ctx, chatID, CardMsg{Content: output})
-	}
-	r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 完成（耗时 %s）", elapsed))
 }
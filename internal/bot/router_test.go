@@ -667,6 +667,15 @@ func (s *syncSpySender) Messages() []string {
 	return cp
 }
 
+func (s *syncSpySender) LastMessage() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.messages) == 0 {
+		return ""
+	}
+	return s.messages[len(s.messages)-1]
+}
+
 func newTestRouterForExec(t *testing.T) (*Router, *syncSpySender, *MessageQueue) {
 	t.Helper()
 	dir := t.TempDir()
@@ -2059,6 +2068,31 @@ func TestRouterSwitch_ByValidIndex(t *testing.T) {
 	}
 }
 
+func TestRouterSwitch_KeepsIndexes(t *testing.T) {
+	r, _ := newTestRouter(t)
+	r.getSession("chat1")
+	r.store.UpdateSession("chat1", func(s *Session) {
+		s.ClaudeSessionID = "current"
+		s.History = []string{"sess-0", "sess-1", "sess-2"}
+	})
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "/switch 1")
+	r.Route(ctx, "chat1", "user1", "/switch 0")
+	sess := r.getSession("chat1")
+	if sess.ClaudeSessionID != "sess-0" {
+		t.Fatalf("expected sess-0 current, got %q", sess.ClaudeSessionID)
+	}
+	// Switching only appends, so every index still names the same session.
+	if strings.Join(sess.History, ",") != "sess-0,sess-1,sess-2,current" {
+		t.Fatalf("unexpected history %v", sess.History)
+	}
+	r.Route(ctx, "chat1", "user1", "/switch 2")
+	if got := r.getSession("chat1").ClaudeSessionID; got != "sess-2" {
+		t.Fatalf("/switch 2 = %q, want sess-2", got)
+	}
+}
+
 func TestRouterSwitch_ByOutOfRangeIndex(t *testing.T) {
 	r, sender := newTestRouter(t)
 	r.getSession("chat1")
@@ -2072,6 +2106,55 @@ func TestRouterSwitch_ByOutOfRangeIndex(t *testing.T) {
 	}
 }
 
+func TestRouterSwitch_Picker(t *testing.T) {
+	r, _ := newTestRouter(t)
+	sender := &cardSpySender{}
+	r.sender = sender
+	r.getSession("chat1")
+	r.store.UpdateSession("chat1", func(s *Session) {
+		s.ClaudeSessionID = "current"
+		s.History = []string{"1111-old", "2222-mid", "3333-new", "current"}
+	})
+	now := time.Now()
+	r.store.AddExecRecord(ExecRecord{ID: "e1", ChatID: "chat1", SessionID: "1111-old", Prompt: "fix the login bug", WorkDir: "/src/web", StartedAt: now.Add(-3 * time.Hour)})
+	r.store.AddExecRecord(ExecRecord{ID: "e2", ChatID: "chat1", SessionID: "1111-old", Prompt: "add a test", WorkDir: "/src/web", StartedAt: now.Add(-time.Minute)})
+	r.store.AddExecRecord(ExecRecord{ID: "e3", ChatID: "chat1", SessionID: "2222-mid", Prompt: "write docs", WorkDir: "/src/api", StartedAt: now.Add(-2 * time.Hour)})
+
+	r.Route(context.Background(), "chat1", "user1", "/switch")
+	if len(sender.cards) != 1 {
+		t.Fatalf("expected picker card, got %v", sender.texts)
+	}
+	card := sender.cards[0]
+	if len(card.Buttons) != 3 {
+		t.Fatalf("expected 3 buttons (current excluded), got %+v", card.Buttons)
+	}
+	// Most recently active first; the title is the session's first prompt.
+	if card.Buttons[0].Command != "/switch 1111-old" || !strings.Contains(card.Buttons[0].Text, "fix the login") {
+		t.Fatalf("unexpected first button %+v", card.Buttons[0])
+	}
+	if card.Buttons[1].Command != "/switch 2222-mid" || card.Buttons[2].Command != "/switch 3333-new" {
+		t.Fatalf("unexpected button order %+v", card.Buttons)
+	}
+	if !strings.Contains(card.Content, "`web`") || !strings.Contains(card.Content, "（无记录）") {
+		t.Fatalf("expected workdir and placeholder in previews, got %q", card.Content)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/sessions pick")
+	if len(sender.cards) != 2 || len(sender.cards[1].Buttons) != 3 {
+		t.Fatalf("expected /sessions pick to show the picker, got %+v", sender.cards)
+	}
+
+	// A clicked button sends the full ID, even one starting with digits.
+	r.Route(context.Background(), "chat1", "user1", card.Buttons[0].Command)
+	sess := r.getSession("chat1")
+	if sess.ClaudeSessionID != "1111-old" {
+		t.Fatalf("expected switch to 1111-old, got %q (%v)", sess.ClaudeSessionID, sender.texts)
+	}
+	if strings.Join(sess.History, ",") != "1111-old,2222-mid,3333-new,current" {
+		t.Fatalf("expected the history unchanged, got %v", sess.History)
+	}
+}
+
 // --- /log with count arg ---
 
 func TestRouterLog_WithCount(t *testing.T) {
@@ -3649,6 +3732,89 @@ func TestRouterStash_WithChanges(t *testing.T) {
 	}
 }
 
+// newStashRouter returns a router on a repo with a committed work.go.
+func newStashRouter(t *testing.T) (*Router, *cardSpySender, string) {
+	t.Helper()
+	dir := t.TempDir()
+	git := func(args ...string) {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v %s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	os.WriteFile(filepath.Join(dir, "work.go"), []byte("original"), 0644)
+	git("add", ".")
+	git("commit", "-q", "-m", "add file")
+
+	store, _ := NewStore(filepath.Join(t.TempDir(), "state.json"))
+	sender := &cardSpySender{}
+	ex := NewClaudeExecutor("claude", "sonnet", 10*time.Second)
+	r := NewRouter(context.Background(), ex, store, sender, map[string]bool{"user1": true}, dir, nil)
+	return r, sender, dir
+}
+
+func TestRouterStash_SaveListApplyDrop(t *testing.T) {
+	r, sender, dir := newStashRouter(t)
+	lastCard := func() CardMsg { return sender.cards[len(sender.cards)-1] }
+
+	os.WriteFile(filepath.Join(dir, "work.go"), []byte("first"), 0644)
+	r.Route(context.Background(), "chat1", "user1", "/stash save first try")
+	os.WriteFile(filepath.Join(dir, "work.go"), []byte("second"), 0644)
+	os.WriteFile(filepath.Join(dir, "new.go"), []byte("untracked"), 0644)
+	r.Route(context.Background(), "chat1", "user1", "/stash save second try")
+	if c := lastCard(); strings.Contains(c.Title, "出错") || fileExists(filepath.Join(dir, "new.go")) {
+		t.Fatalf("expected save to stash untracked files too, got %+v", c)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/stash list")
+	c := lastCard()
+	if c.Title != "暂存列表（2）" || !strings.Contains(c.Content, "**0.**") || !strings.Contains(c.Content, "second try") {
+		t.Fatalf("unexpected list %+v", c)
+	}
+	if !strings.Contains(c.Content, "**1.**") || !strings.Contains(c.Content, "1 file changed") {
+		t.Fatalf("expected stat summaries in list, got %q", c.Content)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/stash show 1")
+	if c := lastCard(); !strings.Contains(c.Content, "+first") {
+		t.Fatalf("expected patch of stash 1, got %+v", c)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/stash apply 1")
+	if c := lastCard(); c.Title != "git stash apply stash@{1}" || !strings.Contains(c.Content, "work.go") {
+		t.Fatalf("unexpected apply card %+v", c)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "work.go")); string(data) != "first" {
+		t.Fatalf("expected stash 1 applied, got %q", data)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/stash drop")
+	if !strings.Contains(sender.texts[len(sender.texts)-1], "请指定要删除的暂存序号") {
+		t.Fatalf("expected drop to require an index, got %v", sender.texts)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/stash drop stash@{0}")
+	if c := lastCard(); strings.Contains(c.Title, "出错") || !strings.Contains(c.Content, "new.go") {
+		t.Fatalf("expected drop with preview, got %+v", c)
+	}
+	out, _ := exec.Command("git", "-C", dir, "stash", "list").Output()
+	if n := strings.Count(string(out), "\n"); n != 1 || !strings.Contains(string(out), "first try") {
+		t.Fatalf("expected only the first stash left, got %q", out)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/stash apply x")
+	if !strings.HasPrefix(sender.texts[len(sender.texts)-1], "用法: /stash") {
+		t.Fatalf("expected usage, got %v", sender.texts)
+	}
+}
+
+func TestRouterStash_ListEmpty(t *testing.T) {
+	r, sender, _ := newStashRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/stash list")
+	if len(sender.texts) == 0 || sender.texts[len(sender.texts)-1] != "没有暂存。" {
+		t.Fatalf("unexpected reply %v %v", sender.texts, sender.cards)
+	}
+}
+
 func TestRouterPush_SuccessWithOutput(t *testing.T) {
 	// Push in a bare repo clone to simulate success with output
 	dir := t.TempDir()
@@ -4244,6 +4410,35 @@ func TestRouterFile_LargeFile_Truncated(t *testing.T) {
 	}
 }
 
+func TestRouterFile_LineRange(t *testing.T) {
+	r, sender := newTestRouter(t)
+	dir := r.getSession("chat1").WorkDir
+	var lines []string
+	for i := 1; i <= 2000; i++ {
+		lines = append(lines, fmt.Sprintf("line content %d", i))
+	}
+	os.WriteFile(filepath.Join(dir, "big.log"), []byte(strings.Join(lines, "\n")), 0644)
+
+	r.Route(context.Background(), "chat1", "user1", "/file big.log:1500-1502")
+	msg := sender.LastMessage()
+	if !strings.HasPrefix(msg, "big.log  （第 1500–1502 行，共 2000 行）") || !strings.Contains(msg, "1502  line content 1502") || strings.Contains(msg, "line content 1503") {
+		t.Fatalf("unexpected range card %q", msg)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/file big.log:1-900")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "第 1–500 行") || !strings.Contains(msg, "只显示到第 500 行") {
+		t.Fatalf("expected the range to be capped, got %q", msg[:80])
+	}
+	r.Route(context.Background(), "chat1", "user1", "/file big.log:3000-3010")
+	if !strings.Contains(sender.LastMessage(), "只有 2000 行") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/file big.log:20-10")
+	if !strings.Contains(sender.LastMessage(), "行号范围无效") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+}
+
 func TestRouterUndo_DefaultWorkDir(t *testing.T) {
 	// Session with WorkDir="" should fall back to WorkRoot
 	dir := t.TempDir()
@@ -4957,3 +5152,454 @@ func TestRouterIssues_DefaultWorkDir(t *testing.T) {
 		t.Fatal("expected some response from /issues with empty workDir")
 	}
 }
+
+func TestRouterExecClaude_RecordsHistory(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "claude")
+	os.WriteFile(script, []byte("#!/bin/sh\necho '{\"type\":\"result\",\"result\":\"done\",\"session_id\":\"s1\"}'\n"), 0755)
+
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	sender := &spySender{}
+	ex := NewClaudeExecutor(script, "sonnet", 10*time.Second)
+	r := NewRouter(context.Background(), ex, store, sender, map[string]bool{"user1": true}, dir, nil)
+
+	r.Route(context.Background(), "chat1", "user1", "hello")
+
+	recs := store.ExecRecords("chat1", 0)
+	if len(recs) != 1 {
+		t.Fatalf("expected 1 history record, got %d", len(recs))
+	}
+	rec := recs[0]
+	if rec.ID == "" || rec.Prompt != "hello" || rec.Output != "done" || rec.SessionID != "s1" || rec.Error != "" {
+		t.Fatalf("unexpected record: %+v", rec)
+	}
+	if len(r.ActiveExecs()) != 0 {
+		t.Fatalf("expected no active executions after completion")
+	}
+}
+
+func TestRouterExecClaude_RecordsFailure(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "claude")
+	os.WriteFile(script, []byte("#!/bin/sh\necho '{\"type\":\"result\",\"is_error\":true,\"result\":\"boom\"}'\n"), 0755)
+
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	sender := &spySender{}
+	ex := NewClaudeExecutor(script, "sonnet", 10*time.Second)
+	r := NewRouter(context.Background(), ex, store, sender, map[string]bool{"user1": true}, dir, nil)
+
+	r.Route(context.Background(), "chat1", "user1", "hello")
+
+	recs := store.ExecRecords("chat1", 0)
+	if len(recs) != 1 || !strings.Contains(recs[0].Error, "boom") {
+		t.Fatalf("expected failed record with error, got %+v", recs)
+	}
+}
+
+// --- /urgent and /queue ---
+
+func TestRouterUrgent_NoArgs(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/urgent")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "用法: /urgent") {
+		t.Fatalf("expected usage, got %q", msg)
+	}
+}
+
+func TestRouterUrgent_JumpsQueue(t *testing.T) {
+	r, sender, q := newTestRouterForExec(t)
+	defer q.Shutdown()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	q.Enqueue("chat1", func() {
+		close(started)
+		<-release
+	})
+	<-started
+	defer close(release)
+
+	r.Route(context.Background(), "chat1", "user1", "normal task")
+	r.Route(context.Background(), "chat1", "user1", "/urgent hotfix prod")
+
+	msgs := sender.Messages()
+	if !strings.Contains(msgs[len(msgs)-2], "已排队（第 2 位）") {
+		t.Fatalf("expected normal task at position 2, got %v", msgs)
+	}
+	if last := msgs[len(msgs)-1]; !strings.Contains(last, "⚡ 已插队（第 2 位）") {
+		t.Fatalf("expected urgent task to jump to position 2, got %q", last)
+	}
+	if sess := r.getSession("chat1"); sess.LastPrompt != "hotfix prod" {
+		t.Fatalf("expected urgent prompt saved for /retry, got %q", sess.LastPrompt)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/queue")
+	listing := sender.Messages()[len(sender.Messages())-1]
+	urgentAt := strings.Index(listing, "⚡")
+	normalAt := strings.Index(listing, "normal task")
+	if !strings.Contains(listing, "等待 2") || urgentAt < 0 || normalAt < 0 || urgentAt > normalAt || !strings.Contains(listing, "hotfix prod") {
+		t.Fatalf("expected urgent task listed first, got %q", listing)
+	}
+}
+
+func TestRouterQueue_Empty(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/queue")
+	if msg := sender.LastMessage(); msg != "队列为空。" {
+		t.Fatalf("expected empty queue message, got %q", msg)
+	}
+}
+
+func TestRouterQueue_ShowsRunning(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.setActive(ExecRecord{ID: "run1", ChatID: "chat1", Prompt: "build it", StartedAt: time.Now()})
+	r.setActive(ExecRecord{ID: "other", ChatID: "chat2", Prompt: "elsewhere", StartedAt: time.Now()})
+	r.Route(context.Background(), "chat1", "user1", "/queue")
+	msg := sender.LastMessage()
+	if !strings.Contains(msg, "执行中") || !strings.Contains(msg, "run1") || strings.Contains(msg, "elsewhere") {
+		t.Fatalf("expected only this chat's running task, got %q", msg)
+	}
+}
+
+func TestRouterQueue_ShowsPoolStats(t *testing.T) {
+	r, sender, q := newTestRouterForExec(t)
+	q.SetLimits(2, 1, nil)
+	defer q.Shutdown()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	q.Enqueue("chat1", func() {
+		close(started)
+		<-release
+	})
+	<-started
+	defer close(release)
+	q.EnqueueTask("chat1", QueueEntry{ID: "w1"}, func() {})
+
+	r.Route(context.Background(), "chat1", "user1", "/queue")
+	msgs := sender.Messages()
+	if last := msgs[len(msgs)-1]; !strings.Contains(last, "全局: 执行中 1 / 2 · 等待 1") {
+		t.Fatalf("expected pool stats in /queue, got %q", last)
+	}
+}
+
+// --- duplicate queued prompts ---
+
+// blockChatQueue occupies chatID's queue slot until the returned func is called.
+func blockChatQueue(t *testing.T, q *MessageQueue, chatID string) func() {
+	t.Helper()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	q.Enqueue(chatID, func() {
+		close(started)
+		<-release
+	})
+	<-started
+	return func() { close(release) }
+}
+
+func TestRouterPrompt_DuplicateCollapsed(t *testing.T) {
+	r, sender, q := newTestRouterForExec(t)
+	defer q.Shutdown()
+	release := blockChatQueue(t, q, "chat1")
+	defer release()
+
+	r.Route(context.Background(), "chat1", "user1", "other task")
+	first, _ := r.SubmitPrompt(context.Background(), "chat1", "Fix the login bug")
+	second, _ := r.SubmitPrompt(context.Background(), "chat1", "  fix the   LOGIN bug!! ")
+
+	if first != second {
+		t.Fatalf("expected duplicate to return the queued execution %q, got %q", first, second)
+	}
+	if n := len(q.Waiting("chat1")); n != 2 {
+		t.Fatalf("expected 2 waiting tasks after duplicate, got %d", n)
+	}
+	msgs := sender.Messages()
+	if last := msgs[len(msgs)-1]; !strings.Contains(last, "已在队列中（第 3 位）") || !strings.Contains(last, "/force") {
+		t.Fatalf("expected already-queued reply with position, got %q", last)
+	}
+}
+
+func TestRouterForce_QueuesDuplicate(t *testing.T) {
+	r, _, q := newTestRouterForExec(t)
+	defer q.Shutdown()
+	release := blockChatQueue(t, q, "chat1")
+	defer release()
+
+	r.Route(context.Background(), "chat1", "user1", "run the tests")
+	r.Route(context.Background(), "chat1", "user1", "/force run the tests")
+
+	if n := len(q.Waiting("chat1")); n != 2 {
+		t.Fatalf("expected /force to queue a second copy, got %d waiting", n)
+	}
+}
+
+func TestRouterForce_NoArgs(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/force")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "用法: /force") {
+		t.Fatalf("expected usage, got %q", msg)
+	}
+}
+
+func TestRouterPrompt_DifferentChatsNotDuplicates(t *testing.T) {
+	r, _, q := newTestRouterForExec(t)
+	defer q.Shutdown()
+	release1 := blockChatQueue(t, q, "chat1")
+	defer release1()
+	release2 := blockChatQueue(t, q, "chat2")
+	defer release2()
+
+	r.Route(context.Background(), "chat1", "user1", "deploy")
+	r.Route(context.Background(), "chat2", "user1", "deploy")
+	if len(q.Waiting("chat1")) != 1 || len(q.Waiting("chat2")) != 1 {
+		t.Fatalf("expected the same prompt in different chats to queue independently")
+	}
+}
+
+func TestNormalizePrompt(t *testing.T) {
+	tests := []struct{ a, b string }{
+		{"Fix bug", "fix   bug"},
+		{"修复登录问题", "修复登录问题！"},
+		{"run tests?", "Run tests"},
+	}
+	for _, tt := range tests {
+		if normalizePrompt(tt.a) != normalizePrompt(tt.b) {
+			t.Errorf("expected %q and %q to normalize equal", tt.a, tt.b)
+		}
+	}
+	if normalizePrompt("fix bug a") == normalizePrompt("fix bug b") {
+		t.Errorf("expected different prompts to stay distinct")
+	}
+}
+
+// --- reproducibility metadata and /repro ---
+
+// newReproRouter returns a router whose fake claude reports a model and CLI
+// version and echoes its working directory, running in a fresh git repo.
+func newReproRouter(t *testing.T) (*Router, *spySender, string) {
+	t.Helper()
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "repo")
+	os.Mkdir(repo, 0755)
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=t", "-c", "user.email=t@t"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init")
+	os.WriteFile(filepath.Join(repo, "a.txt"), []byte("v1"), 0644)
+	git("add", ".")
+	git("commit", "-m", "v1")
+
+	script := filepath.Join(dir, "claude")
+	os.WriteFile(script, []byte(`#!/bin/sh
+echo '{"type":"system","subtype":"init","model":"claude-sonnet-4-5-20250929","claude_code_version":"2.0.1"}'
+echo "{\"type\":\"result\",\"result\":\"content $(cat a.txt)\",\"session_id\":\"s1\"}"
+`), 0755)
+
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	sender := &spySender{}
+	r := NewRouter(context.Background(), NewClaudeExecutor(script, "sonnet", 10*time.Second), store, sender, map[string]bool{"user1": true}, dir, nil)
+	r.getSession("chat1")
+	r.store.UpdateSession("chat1", func(s *Session) { s.WorkDir = repo })
+	return r, sender, repo
+}
+
+func TestRouterExecClaude_RecordsReproMetadata(t *testing.T) {
+	r, _, repo := newReproRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "show the file")
+
+	recs := r.store.ExecRecords("chat1", 0)
+	if len(recs) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(recs))
+	}
+	rec := recs[0]
+	head, _ := runGitOutput(repo, "rev-parse", "HEAD")
+	if rec.GitHead != head || rec.Model != "claude-sonnet-4-5-20250929" || rec.CLIVersion != "2.0.1" || rec.PermissionMode != "safe" {
+		t.Fatalf("unexpected metadata: %+v", rec)
+	}
+}
+
+func TestRouterRepro_ReplaysAtOriginalCommit(t *testing.T) {
+	r, sender, repo := newReproRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "show the file")
+	orig := r.store.ExecRecords("chat1", 0)[0]
+
+	// Move the repo on; the repro must still see the original content.
+	os.WriteFile(filepath.Join(repo, "a.txt"), []byte("v2"), 0644)
+	exec.Command("git", "-C", repo, "-c", "user.name=t", "-c", "user.email=t@t", "commit", "-am", "v2").Run()
+
+	r.Route(context.Background(), "chat1", "user1", "/repro "+orig.ID)
+	msg := sender.LastMessage()
+	if !strings.Contains(msg, "复现结果") || !strings.Contains(msg, "content v1") || !strings.Contains(msg, "输出与原执行一致") {
+		t.Fatalf("expected repro at original commit, got %q", msg)
+	}
+
+	recs := r.store.ExecRecords("chat1", 0)
+	if len(recs) != 2 || recs[0].ReproOf != orig.ID || recs[0].GitHead != orig.GitHead {
+		t.Fatalf("expected repro recorded and linked to original, got %+v", recs[0])
+	}
+	if out, _ := runGitOutput(repo, "worktree", "list"); strings.Count(out, "\n") != 0 {
+		t.Fatalf("expected temporary worktree removed, got:\n%s", out)
+	}
+	if sess := r.getSession("chat1"); sess.WorkDir != repo {
+		t.Fatalf("repro must not change the chat's work dir, got %q", sess.WorkDir)
+	}
+}
+
+func TestRouterRepro_OtherChatAndYolo(t *testing.T) {
+	r, sender, _ := newReproRouter(t)
+	ctx := context.Background()
+	r.Route(ctx, "chat1", "user1", "/yolo")
+	r.Route(ctx, "chat1", "user1", "show the file")
+	orig := r.store.ExecRecords("chat1", 0)[0]
+	if orig.PermissionMode != "yolo" {
+		t.Fatalf("expected a yolo run, got %+v", orig)
+	}
+
+	r.Route(ctx, "chat2", "user1", "/repro "+orig.ID)
+	if msg := sender.LastMessage(); !strings.Contains(msg, "未找到执行记录") {
+		t.Fatalf("expected another chat's run refused, got %q", msg)
+	}
+	if recs := r.store.ExecRecords("chat2", 0); len(recs) != 0 {
+		t.Fatalf("expected nothing replayed in chat2, got %+v", recs)
+	}
+
+	// Back in safe mode, the yolo run is replayed in safe mode.
+	r.Route(ctx, "chat1", "user1", "/safe")
+	r.Route(ctx, "chat1", "user1", "/repro "+orig.ID)
+	if rec := r.store.ExecRecords("chat1", 0)[0]; rec.ReproOf != orig.ID || rec.PermissionMode != "safe" {
+		t.Fatalf("expected the repro capped at safe mode, got %+v", rec)
+	}
+	if !strings.Contains(strings.Join(sender.messages, "\n"), "按安全模式执行") {
+		t.Fatalf("expected the cap reported, got %q", sender.messages)
+	}
+}
+
+func TestRouterRepro_Errors(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/repro")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "用法: /repro") {
+		t.Fatalf("expected usage, got %q", msg)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/repro nope")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "未找到执行记录") {
+		t.Fatalf("expected not-found, got %q", msg)
+	}
+	r.store.AddExecRecord(ExecRecord{ID: "old1", ChatID: "chat1", Prompt: "x"})
+	r.Route(context.Background(), "chat1", "user1", "/repro old1")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "无法复现") {
+		t.Fatalf("expected no-commit error, got %q", msg)
+	}
+}
+
+func TestRouterCheckResume(t *testing.T) {
+	r, sender := newTestRouter(t)
+	ctx := context.Background()
+	root := r.store.WorkRoot()
+	dirA := filepath.Join(root, "project1")
+	dirB := filepath.Join(root, "project2")
+	r.getSession("chat1")
+	r.store.UpdateSession("chat1", func(s *Session) {
+		s.WorkDir = dirA
+		s.ClaudeSessionID = "sid-a"
+		s.DirSessions = map[string]string{dirA: "sid-a", dirB: "sid-b"}
+	})
+
+	// Matching and untracked sessions are resumed as-is.
+	if w, sid := r.checkResume(ctx, "chat1", dirA, "sid-a"); w != dirA || sid != "sid-a" {
+		t.Fatalf("expected resume in %s, got %s %s", dirA, w, sid)
+	}
+	if w, sid := r.checkResume(ctx, "chat1", dirA, "sid-x"); w != dirA || sid != "sid-x" {
+		t.Fatalf("expected untracked session resumed, got %s %s", w, sid)
+	}
+	if len(sender.messages) != 0 {
+		t.Fatalf("expected no notes, got %v", sender.messages)
+	}
+
+	// A session created in another workdir is not resumed.
+	r.store.UpdateSession("chat1", func(s *Session) { s.ClaudeSessionID = "sid-b" })
+	if w, sid := r.checkResume(ctx, "chat1", dirA, "sid-b"); w != dirA || sid != "" {
+		t.Fatalf("expected fresh session, got %s %s", w, sid)
+	}
+	if msg := sender.LastMessage(); !strings.Contains(msg, "创建于 "+dirB) {
+		t.Fatalf("unexpected note %q", msg)
+	}
+	if s := r.getSession("chat1"); s.ClaudeSessionID != "" || s.History[len(s.History)-1] != "sid-b" {
+		t.Fatalf("expected sid-b moved to history, got %+v", s)
+	}
+
+	// A missing workdir falls back to the work root.
+	os.RemoveAll(dirA)
+	r.store.UpdateSession("chat1", func(s *Session) { s.ClaudeSessionID = "sid-a" })
+	if w, sid := r.checkResume(ctx, "chat1", dirA, "sid-a"); w != root || sid != "" {
+		t.Fatalf("expected fresh session in root, got %s %s", w, sid)
+	}
+	if msg := sender.LastMessage(); !strings.Contains(msg, "已不存在") {
+		t.Fatalf("unexpected note %q", msg)
+	}
+	s := r.getSession("chat1")
+	if s.WorkDir != root || s.ClaudeSessionID != "" || s.DirSessions[dirA] != "" {
+		t.Fatalf("unexpected session %+v", s)
+	}
+}
+
+func TestRouterCheckResume_Pool(t *testing.T) {
+	r, sender := newTestRouter(t)
+	ctx := context.Background()
+	root := r.store.WorkRoot()
+	dir := "/srv/backend/app" // only exists on the backend
+	r.getSession("chat1")
+	r.store.UpdateSession("chat1", func(s *Session) {
+		s.WorkDir = dir
+		s.ClaudeSessionID = "sid-a"
+		s.DirSessions = map[string]string{dir: "sid-a"}
+	})
+
+	pool := NewExecutorPool("sonnet")
+	pool.Add("local", &stubExecutor{}, []string{root})
+	pool.Add("backend", &stubExecutor{remote: true}, []string{"/srv/backend"})
+	r.executor = pool
+	if w, sid := r.checkResume(ctx, "chat1", dir, "sid-a"); w != dir || sid != "sid-a" {
+		t.Fatalf("expected a backend workdir kept with a remote pool member, got %s %s", w, sid)
+	}
+	if len(sender.messages) != 0 {
+		t.Fatalf("expected no notes, got %v", sender.messages)
+	}
+
+	local := NewExecutorPool("sonnet")
+	local.Add("a", &stubExecutor{}, nil)
+	local.Add("b", &stubExecutor{}, nil)
+	r.executor = local
+	if w, sid := r.checkResume(ctx, "chat1", dir, "sid-a"); w != root || sid != "" {
+		t.Fatalf("expected a missing workdir reset with a local pool, got %s %s", w, sid)
+	}
+}
+
+func TestCompleteCommand(t *testing.T) {
+	got := completeCommand("/st")
+	if strings.Join(got, " ") != "/stash /stats /status" {
+		t.Fatalf("unexpected completions %v", got)
+	}
+	if completeCommand("/") != nil || completeCommand("/status") != nil {
+		t.Fatal("expected no completions for / or an exact command")
+	}
+	if s := commandSummary("/status"); s == "" {
+		t.Fatal("expected /status to have a summary from /help")
+	}
+}
+
+func TestRouterUnknownCommand_Prefix(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/st")
+	msg := sender.LastMessage()
+	if !strings.Contains(msg, "/st 可能是以下命令之一") || !strings.Contains(msg, "`/stash` — ") || !strings.Contains(msg, "`/status` — ") {
+		t.Fatalf("expected disambiguation list, got: %q", msg)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/vers")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "你是否想用 `/version`") {
+		t.Fatalf("expected single completion, got: %q", msg)
+	}
+}
@@ -0,0 +1,646 @@
+package bot
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// The executor service lets the chat frontend and the Claude execution
+// backend run on different machines:
+//
+//	service devbot.Executor {
+//	  rpc Exec(stream ExecRequest) returns (stream ExecEvent);
+//	  rpc Kill(Empty) returns (Empty);
+//	  rpc Ping(Empty) returns (Empty);
+//	}
+//
+// Messages are JSON-encoded (content-type application/grpc+json) so no
+// generated protobuf code is needed. Every call carries the shared token as
+// "authorization: Bearer <token>" metadata, over TLS unless plaintext was
+// explicitly allowed for a loopback address (ExecutorTLS). The first message on Exec
+// starts the run; when it asks for the deletion guard, the backend sends a
+// Confirm event for each deletion and the frontend answers it with a
+// ConfirmReply on the same stream.
+const (
+	executorService    = "devbot.Executor"
+	executorExecMethod = "/" + executorService + "/Exec"
+	executorKillMethod = "/" + executorService + "/Kill"
+	executorPingMethod = "/" + executorService + "/Ping"
+
+	executorDrainTimeout = 30 * time.Second
+
+	// maxRPCMessageBytes bounds an Exec request, which carries the
+	// uploaded images.
+	maxRPCMessageBytes = 64 << 20
+)
+
+type rpcExecRequest struct {
+	Prompt         string `json:"prompt"`
+	WorkDir        string `json:"workDir"`
+	SessionID      string `json:"sessionID,omitempty"`
+	PermissionMode string `json:"permissionMode,omitempty"`
+	Model          string `json:"model,omitempty"`
+	// Images carries the uploaded images themselves: they are saved on
+	// the frontend, where the backend cannot read them.
+	Images []rpcImage `json:"images,omitempty"`
+	// ScratchDir and ReferenceDirs are the run's scratch space and
+	// read-only reference directories (withScratchDir, withReferenceDirs),
+	// as paths on the backend. DeleteGuard asks the backend to gate
+	// deletions on the frontend's answers.
+	ScratchDir    string   `json:"scratchDir,omitempty"`
+	ReferenceDirs []string `json:"referenceDirs,omitempty"`
+	DeleteGuard   bool     `json:"deleteGuard,omitempty"`
+}
+
+type rpcImage struct {
+	Name string `json:"name"`
+	Data []byte `json:"data"`
+}
+
+// rpcConfirm asks the frontend to confirm a deletion; rpcConfirmReply is
+// the answer.
+type rpcConfirm struct {
+	ID      int      `json:"id"`
+	Paths   []string `json:"paths"`
+	Command string   `json:"command,omitempty"`
+}
+
+type rpcConfirmReply struct {
+	ID    int  `json:"id"`
+	Allow bool `json:"allow"`
+}
+
+// rpcExecEvent is one message on the Exec stream: any number of progress
+// and Confirm events followed by a single Done event carrying the result or
+// the error.
+type rpcExecEvent struct {
+	Progress           string      `json:"progress,omitempty"`
+	Confirm            *rpcConfirm `json:"confirm,omitempty"`
+	Done               bool        `json:"done,omitempty"`
+	Output             string      `json:"output,omitempty"`
+	SessionID          string      `json:"sessionID,omitempty"`
+	IsPermissionDenial bool        `json:"isPermissionDenial,omitempty"`
+	Model              string      `json:"model,omitempty"`
+	CLIVersion         string      `json:"cliVersion,omitempty"`
+	Error              string      `json:"error,omitempty"`
+}
+
+type rpcEmpty struct{}
+
+// rpcCodec encodes executor messages as JSON.
+type rpcCodec struct{}
+
+func (rpcCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (rpcCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (rpcCodec) Name() string                               { return "json" }
+
+// executorHandler is implemented by ExecutorServer; it is the HandlerType of
+// executorServiceDesc.
+type executorHandler interface {
+	exec(req *rpcExecRequest, stream grpc.ServerStream) error
+	kill(ctx context.Context) error
+}
+
+var executorServiceDesc = grpc.ServiceDesc{
+	ServiceName: executorService,
+	HandlerType: (*executorHandler)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Kill",
+			Handler:    unaryEmptyHandler(executorKillMethod, func(h executorHandler, ctx context.Context) error { return h.kill(ctx) }),
+		},
+		{
+			MethodName: "Ping",
+			Handler:    unaryEmptyHandler(executorPingMethod, func(executorHandler, context.Context) error { return nil }),
+		},
+	},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Exec",
+		ServerStreams: true,
+		ClientStreams: true,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			in := new(rpcExecRequest)
+			if err := stream.RecvMsg(in); err != nil {
+				return err
+			}
+			return srv.(executorHandler).exec(in, stream)
+		},
+	}},
+}
+
+// unaryEmptyHandler adapts an Empty -> Empty method to a grpc.MethodDesc handler.
+func unaryEmptyHandler(method string, call func(h executorHandler, ctx context.Context) error) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := new(rpcEmpty)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+			return &rpcEmpty{}, call(srv.(executorHandler), ctx)
+		}
+		if interceptor == nil {
+			return handler(ctx, in)
+		}
+		return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: method}, handler)
+	}
+}
+
+// ExecutorServer exposes a local Executor as the devbot.Executor gRPC service.
+type ExecutorServer struct {
+	executor       Executor
+	token          string
+	plaintext      bool
+	trashRetention time.Duration
+	srv            *grpc.Server
+}
+
+// NewExecutorServer creates a server running prompts on executor. Calls
+// without the matching token are rejected; an empty token rejects everything.
+// It serves TLS with cfg's certificate; cfg.Insecure serves plaintext, on
+// loopback addresses only.
+func NewExecutorServer(executor Executor, token string, cfg ExecutorTLS) (*ExecutorServer, error) {
+	s := &ExecutorServer{executor: executor, token: token, plaintext: cfg.Insecure}
+	creds := insecure.NewCredentials()
+	if !cfg.Insecure {
+		tlsCfg, err := serverTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsCfg)
+	}
+	s.srv = grpc.NewServer(
+		grpc.Creds(creds),
+		grpc.ForceServerCodec(rpcCodec{}),
+		grpc.MaxRecvMsgSize(maxRPCMessageBytes),
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := s.authorize(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := s.authorize(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	)
+	s.srv.RegisterService(&executorServiceDesc, s)
+	return s, nil
+}
+
+// serverTLSConfig loads the backend's certificate and, with a CA, requires
+// client certificates signed by it.
+func serverTLSConfig(cfg ExecutorTLS) (*tls.Config, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("executor tls: cert_file and key_file are required")
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("executor tls: %w", err)
+	}
+	tlsCfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		pool, err := loadCertPool(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsCfg, nil
+}
+
+// clientTLSConfig verifies the backend against cfg's CA, or the system
+// roots without one, and presents cfg's certificate when set.
+func clientTLSConfig(cfg ExecutorTLS) (*tls.Config, error) {
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		pool, err := loadCertPool(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("executor tls: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("executor tls: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("executor tls: no certificates in %s", file)
+	}
+	return pool, nil
+}
+
+// isLoopbackAddr reports whether addr ("host:port" or a bare host) only
+// reaches this machine. An empty host listens on every interface.
+func isLoopbackAddr(addr string) bool {
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// SetTrashRetention sets how long files backed up before a deletion are
+// kept on this host (0 = default).
+func (s *ExecutorServer) SetTrashRetention(d time.Duration) {
+	s.trashRetention = d
+}
+
+func (s *ExecutorServer) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var got string
+	if v := md.Get("authorization"); len(v) > 0 {
+		got = strings.TrimPrefix(v[0], "Bearer ")
+	}
+	if s.token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+		return status.Error(codes.Unauthenticated, "invalid executor token")
+	}
+	return nil
+}
+
+func (s *ExecutorServer) exec(req *rpcExecRequest, stream grpc.ServerStream) error {
+	slog.Info("executor: exec", "work_dir", req.WorkDir, "session_id", req.SessionID)
+	// Progress and deletion questions are sent from different goroutines.
+	var sendMu sync.Mutex
+	send := func(ev *rpcExecEvent) error {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		return stream.SendMsg(ev)
+	}
+	ctx, cleanup, err := s.runContext(stream.Context(), req, stream, send)
+	if err != nil {
+		return send(&rpcExecEvent{Done: true, Error: err.Error()})
+	}
+	defer cleanup()
+	result, err := s.executor.ExecStream(ctx, req.Prompt, req.WorkDir, req.SessionID, req.PermissionMode, req.Model, func(text string) {
+		if err := send(&rpcExecEvent{Progress: text}); err != nil {
+			slog.Warn("executor: send progress failed", "err", err)
+		}
+	})
+	done := rpcExecEvent{
+		Done:               true,
+		Output:             result.Output,
+		SessionID:          result.SessionID,
+		IsPermissionDenial: result.IsPermissionDenial,
+		Model:              result.Model,
+		CLIVersion:         result.CLIVersion,
+	}
+	if err != nil {
+		done.Error = err.Error()
+	}
+	return send(&done)
+}
+
+// runContext sets up on this host what the frontend set on its context:
+// the images, written to a temporary directory that cleanup removes, the
+// scratch and reference directories, and the deletion guard.
+func (s *ExecutorServer) runContext(ctx context.Context, req *rpcExecRequest, stream grpc.ServerStream, send func(*rpcExecEvent) error) (context.Context, func(), error) {
+	cleanup := func() {}
+	if len(req.Images) > 0 {
+		dir, err := os.MkdirTemp("", "devbot-images-")
+		if err != nil {
+			return ctx, cleanup, fmt.Errorf("save images: %w", err)
+		}
+		cleanup = func() { os.RemoveAll(dir) }
+		var paths []string
+		for i, img := range req.Images {
+			path := filepath.Join(dir, fmt.Sprintf("%d-%s", i, filepath.Base("/"+img.Name)))
+			if err := os.WriteFile(path, img.Data, 0600); err != nil {
+				cleanup()
+				return ctx, func() {}, fmt.Errorf("save images: %w", err)
+			}
+			paths = append(paths, path)
+		}
+		ctx = withImages(ctx, paths)
+	}
+	if req.ScratchDir != "" {
+		if err := os.MkdirAll(req.ScratchDir, 0700); err != nil {
+			cleanup()
+			return ctx, func() {}, fmt.Errorf("create scratch dir: %w", err)
+		}
+		ctx = withScratchDir(ctx, req.ScratchDir)
+	}
+	ctx = withReferenceDirPaths(ctx, req.ReferenceDirs)
+	if req.DeleteGuard {
+		ctx = withDeleteGuard(ctx, s.remoteGuard(ctx, req.WorkDir, stream, send))
+	}
+	return ctx, cleanup, nil
+}
+
+// remoteGuard is the deletion guard of a run on this host: it asks the
+// frontend with a Confirm event and waits for the answer on the stream.
+// Once a deletion is allowed it backs the files up in workDir, as the
+// frontend's guard does for local runs, since they are only here.
+func (s *ExecutorServer) remoteGuard(ctx context.Context, workDir string, stream grpc.ServerStream, send func(*rpcExecEvent) error) deleteGuard {
+	var mu sync.Mutex
+	next := 0
+	waiting := make(map[int]chan bool)
+	go func() {
+		for {
+			var reply rpcConfirmReply
+			if err := stream.RecvMsg(&reply); err != nil {
+				return
+			}
+			mu.Lock()
+			ch := waiting[reply.ID]
+			delete(waiting, reply.ID)
+			mu.Unlock()
+			if ch != nil {
+				ch <- reply.Allow
+			}
+		}
+	}()
+	return func(paths []string, command string) bool {
+		mu.Lock()
+		next++
+		id := next
+		ch := make(chan bool, 1)
+		waiting[id] = ch
+		mu.Unlock()
+		if err := send(&rpcExecEvent{Confirm: &rpcConfirm{ID: id, Paths: paths, Command: command}}); err != nil {
+			slog.Warn("executor: ask for deletion failed", "err", err)
+			return false
+		}
+		select {
+		case allow := <-ch:
+			if allow {
+				if _, err := saveTrash(workDir, "claude", paths, s.trashRetention); err != nil {
+					slog.Warn("trash: save failed", "err", err)
+				}
+			}
+			return allow
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func (s *ExecutorServer) kill(context.Context) error {
+	if err := s.executor.Kill(); err != nil {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return nil
+}
+
+// Serve accepts connections on lis until ctx is cancelled. Running
+// executions get executorDrainTimeout to finish before they are cancelled.
+// A plaintext server only serves on loopback addresses.
+func (s *ExecutorServer) Serve(ctx context.Context, lis net.Listener) error {
+	if s.plaintext && !isLoopbackAddr(lis.Addr().String()) {
+		lis.Close()
+		return fmt.Errorf("executor: plaintext is only allowed on a loopback address, not %s", lis.Addr())
+	}
+	go func() {
+		<-ctx.Done()
+		stopped := make(chan struct{})
+		go func() {
+			s.srv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(executorDrainTimeout):
+			s.srv.Stop()
+		}
+	}()
+	return s.srv.Serve(lis)
+}
+
+// ListenAndServe serves on addr until ctx is cancelled.
+func (s *ExecutorServer) ListenAndServe(ctx context.Context, addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	slog.Info("executor: listening", "addr", addr)
+	return s.Serve(ctx, lis)
+}
+
+// bearerToken attaches the executor token to every call. It is only sent
+// over TLS unless plaintext was allowed for a loopback backend.
+type bearerToken struct {
+	token     string
+	plaintext bool
+}
+
+func (t bearerToken) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+func (t bearerToken) RequireTransportSecurity() bool { return !t.plaintext }
+
+// RemoteExecutor runs prompts on an ExecutorServer. Running state and
+// counters reflect the calls made through this client.
+type RemoteExecutor struct {
+	conn             *grpc.ClientConn
+	model            string
+	mu               sync.Mutex
+	running          int
+	lastExecDuration time.Duration
+	execCount        int
+}
+
+// NewRemoteExecutor connects to the executor service at addr over TLS
+// configured by cfg; cfg.Insecure connects in plaintext, which is refused
+// unless addr is a loopback address. model is the default reported to the
+// Router for sessions without their own model.
+func NewRemoteExecutor(addr, token, model string, cfg ExecutorTLS) (*RemoteExecutor, error) {
+	creds := insecure.NewCredentials()
+	if cfg.Insecure {
+		if !isLoopbackAddr(addr) {
+			return nil, fmt.Errorf("connect executor %s: plaintext is only allowed on a loopback address", addr)
+		}
+	} else {
+		tlsCfg, err := clientTLSConfig(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("connect executor %s: %w", addr, err)
+		}
+		creds = credentials.NewTLS(tlsCfg)
+	}
+	conn, err := grpc.NewClient(addr,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithPerRPCCredentials(bearerToken{token: token, plaintext: cfg.Insecure}),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(rpcCodec{})),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("connect executor %s: %w", addr, err)
+	}
+	return &RemoteExecutor{conn: conn, model: model}, nil
+}
+
+// Close releases the underlying connection.
+func (e *RemoteExecutor) Close() error {
+	return e.conn.Close()
+}
+
+func (e *RemoteExecutor) ExecStream(ctx context.Context, prompt, workDir, sessionID, permissionMode, model string, onProgress func(text string)) (ExecResult, error) {
+	guard := deleteGuardFrom(ctx)
+	req := rpcExecRequest{
+		Prompt:         prompt,
+		WorkDir:        workDir,
+		SessionID:      sessionID,
+		PermissionMode: permissionMode,
+		Model:          model,
+		ScratchDir:     scratchDirFrom(ctx),
+		ReferenceDirs:  referenceDirsFrom(ctx),
+		DeleteGuard:    guard != nil,
+	}
+	// Images are saved on this host, so the backend gets their bytes.
+	for _, path := range imagesFrom(ctx) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return ExecResult{}, fmt.Errorf("read image: %w", err)
+		}
+		req.Images = append(req.Images, rpcImage{Name: filepath.Base(path), Data: data})
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := e.conn.NewStream(ctx, &executorServiceDesc.Streams[0], executorExecMethod)
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("executor rpc: %w", err)
+	}
+	if err := stream.SendMsg(&req); err != nil {
+		return ExecResult{}, fmt.Errorf("executor rpc: %w", err)
+	}
+	// With a deletion guard the stream stays open for the answers.
+	if guard == nil {
+		if err := stream.CloseSend(); err != nil {
+			return ExecResult{}, fmt.Errorf("executor rpc: %w", err)
+		}
+	}
+
+	e.mu.Lock()
+	e.running++
+	e.mu.Unlock()
+	start := time.Now()
+	defer func() {
+		e.mu.Lock()
+		e.running--
+		e.execCount++
+		e.lastExecDuration = time.Since(start)
+		e.mu.Unlock()
+	}()
+
+	for {
+		var ev rpcExecEvent
+		if err := stream.RecvMsg(&ev); err != nil {
+			if errors.Is(err, io.EOF) {
+				return ExecResult{}, fmt.Errorf("executor rpc: stream ended without result")
+			}
+			return ExecResult{}, fmt.Errorf("executor rpc: %w", err)
+		}
+		if ev.Confirm != nil {
+			allow := guard != nil && guard(ev.Confirm.Paths, ev.Confirm.Command)
+			if err := stream.SendMsg(&rpcConfirmReply{ID: ev.Confirm.ID, Allow: allow}); err != nil {
+				return ExecResult{}, fmt.Errorf("executor rpc: %w", err)
+			}
+			continue
+		}
+		if !ev.Done {
+			if ev.Progress != "" && onProgress != nil {
+				onProgress(ev.Progress)
+			}
+			continue
+		}
+		switch ev.Error {
+		case "":
+		case errDeletionRejected.Error():
+			return ExecResult{SessionID: ev.SessionID}, errDeletionRejected
+		default:
+			return ExecResult{SessionID: ev.SessionID}, errors.New(ev.Error)
+		}
+		return ExecResult{Output: ev.Output, SessionID: ev.SessionID, IsPermissionDenial: ev.IsPermissionDenial, Model: ev.Model, CLIVersion: ev.CLIVersion}, nil
+	}
+}
+
+// Kill asks the backend to kill its running Claude process.
+func (e *RemoteExecutor) Kill() error {
+	if !e.IsRunning() {
+		return fmt.Errorf("no running process")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := e.conn.Invoke(ctx, executorKillMethod, &rpcEmpty{}, &rpcEmpty{}); err != nil {
+		return fmt.Errorf("executor rpc: %w", err)
+	}
+	return nil
+}
+
+// Ping checks that the backend is reachable and accepts our token.
+func (e *RemoteExecutor) Ping(ctx context.Context) error {
+	if err := e.conn.Invoke(ctx, executorPingMethod, &rpcEmpty{}, &rpcEmpty{}); err != nil {
+		return fmt.Errorf("executor rpc: %w", err)
+	}
+	return nil
+}
+
+func (e *RemoteExecutor) IsRunning() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.running > 0
+}
+
+func (e *RemoteExecutor) Model() string {
+	return e.model
+}
+
+// WaitIdle blocks until no remote execution is in flight or the timeout expires.
+func (e *RemoteExecutor) WaitIdle(timeout time.Duration) bool {
+	return waitIdle(e.IsRunning, timeout)
+}
+
+func (e *RemoteExecutor) ExecCount() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.execCount
+}
+
+func (e *RemoteExecutor) LastExecDuration() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.lastExecDuration
+}
+
+// LocalPaths is false: work directories are paths on the backend.
+func (e *RemoteExecutor) LocalPaths() bool {
+	return false
+}
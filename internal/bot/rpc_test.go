@@ -0,0 +1,336 @@
+package bot
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTestExecutor serves a ClaudeExecutor running script over gRPC and
+// returns a RemoteExecutor connected with token.
+func startTestExecutor(t *testing.T, script, token string) *RemoteExecutor {
+	t.Helper()
+	dir := t.TempDir()
+	claude := filepath.Join(dir, "claude")
+	os.WriteFile(claude, []byte(script), 0755)
+	return serveTestExecutor(t, NewClaudeExecutor(claude, "sonnet", 10*time.Second), token)
+}
+
+// serveTestExecutor serves exec over gRPC and returns a RemoteExecutor
+// connected with token.
+func serveTestExecutor(t *testing.T, exec Executor, token string) *RemoteExecutor {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	srv, err := NewExecutorServer(exec, "secret", ExecutorTLS{Insecure: true})
+	if err != nil {
+		t.Fatalf("NewExecutorServer: %v", err)
+	}
+	go srv.Serve(ctx, lis)
+
+	remote, err := NewRemoteExecutor(lis.Addr().String(), token, "sonnet", ExecutorTLS{Insecure: true})
+	if err != nil {
+		t.Fatalf("NewRemoteExecutor: %v", err)
+	}
+	t.Cleanup(func() { remote.Close() })
+	return remote
+}
+
+func TestRemoteExecutor_StreamsProgressAndResult(t *testing.T) {
+	script := `#!/bin/sh
+echo '{"type":"system","subtype":"init","model":"claude-opus-4-1","claude_code_version":"2.0.1"}'
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"step 1"}]},"session_id":"s1"}'
+echo '{"type":"result","result":"remote done","session_id":"s1"}'
+`
+	remote := startTestExecutor(t, script, "secret")
+
+	var progress []string
+	result, err := remote.ExecStream(context.Background(), "hi", t.TempDir(), "", "", "", func(text string) {
+		progress = append(progress, text)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Output != "remote done" || result.SessionID != "s1" || result.Model != "claude-opus-4-1" || result.CLIVersion != "2.0.1" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if len(progress) != 1 || progress[0] != "step 1" {
+		t.Fatalf("expected streamed progress [step 1], got %v", progress)
+	}
+	if remote.ExecCount() != 1 || remote.IsRunning() {
+		t.Fatalf("expected 1 finished exec, got count=%d running=%v", remote.ExecCount(), remote.IsRunning())
+	}
+}
+
+func TestRemoteExecutor_ErrorKeepsMessageAndSession(t *testing.T) {
+	script := `#!/bin/sh
+echo '{"type":"result","is_error":true,"result":"No conversation found with session ID: old","session_id":"s2"}'
+`
+	remote := startTestExecutor(t, script, "secret")
+
+	result, err := remote.ExecStream(context.Background(), "hi", t.TempDir(), "old", "", "", nil)
+	if err == nil || !strings.Contains(err.Error(), "No conversation found with session ID") {
+		t.Fatalf("expected backend error to pass through, got %v", err)
+	}
+	if result.SessionID != "s2" {
+		t.Fatalf("expected session ID from error result, got %q", result.SessionID)
+	}
+}
+
+func TestRemoteExecutor_RejectsWrongToken(t *testing.T) {
+	remote := startTestExecutor(t, okClaudeScript, "wrong")
+
+	_, err := remote.ExecStream(context.Background(), "hi", t.TempDir(), "", "", "", nil)
+	if err == nil || !strings.Contains(err.Error(), "Unauthenticated") {
+		t.Fatalf("expected Unauthenticated error, got %v", err)
+	}
+}
+
+func TestRemoteExecutor_KillWhenIdle(t *testing.T) {
+	remote := startTestExecutor(t, okClaudeScript, "secret")
+	if err := remote.Kill(); err == nil {
+		t.Fatalf("expected error killing with nothing running")
+	}
+}
+
+func TestRemoteExecutor_Kill(t *testing.T) {
+	remote := startTestExecutor(t, "#!/bin/sh\nexec sleep 5\n", "secret")
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := remote.ExecStream(context.Background(), "hi", t.TempDir(), "", "", "", nil)
+		done <- err
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for !remote.IsRunning() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// The backend may not have started the process yet; retry briefly.
+	var err error
+	for time.Now().Before(deadline) {
+		if err = remote.Kill(); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Kill: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatalf("expected killed execution to fail")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("execution not killed")
+	}
+}
+
+func TestRouterExecClaude_RemoteExecutor(t *testing.T) {
+	remote := startTestExecutor(t, okClaudeScript, "secret")
+	dir := t.TempDir()
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	r := NewRouter(context.Background(), remote, store, &spySender{}, map[string]bool{"user1": true}, dir, nil)
+
+	r.Route(context.Background(), "chat1", "user1", "hello")
+
+	recs := store.ExecRecords("chat1", 0)
+	if len(recs) != 1 || recs[0].Output != "api done" || recs[0].Error != "" {
+		t.Fatalf("expected remote run recorded with output, got %+v", recs)
+	}
+	if sess := r.getSession("chat1"); sess.ClaudeSessionID != "s1" {
+		t.Fatalf("expected session from remote run, got %q", sess.ClaudeSessionID)
+	}
+}
+
+// ctxExecutor is a backend executor that reports what the run context
+// carries.
+type ctxExecutor struct {
+	stubExecutor
+	run func(ctx context.Context) (ExecResult, error)
+}
+
+func (c *ctxExecutor) ExecStream(ctx context.Context, prompt, workDir, sessionID, permissionMode, model string, onProgress func(text string)) (ExecResult, error) {
+	return c.run(ctx)
+}
+
+func TestRemoteExecutor_SendsImagesAndDirs(t *testing.T) {
+	local := t.TempDir()
+	image := filepath.Join(local, "shot.png")
+	os.WriteFile(image, []byte("png bytes"), 0644)
+	scratch := filepath.Join(t.TempDir(), "chat1")
+
+	var gotImage, gotScratch string
+	var gotRefs []string
+	remote := serveTestExecutor(t, &ctxExecutor{run: func(ctx context.Context) (ExecResult, error) {
+		if images := imagesFrom(ctx); len(images) == 1 && images[0] != image {
+			data, _ := os.ReadFile(images[0])
+			gotImage = string(data)
+		}
+		if fileExists(scratchDirFrom(ctx)) {
+			gotScratch = scratchDirFrom(ctx)
+		}
+		gotRefs = referenceDirsFrom(ctx)
+		return ExecResult{Output: "ok"}, nil
+	}}, "secret")
+
+	ctx := withImages(context.Background(), []string{image})
+	ctx = withScratchDir(ctx, scratch)
+	ctx = withReferenceDirPaths(ctx, []string{"/srv/shared/proto"})
+	if _, err := remote.ExecStream(ctx, "look", t.TempDir(), "", "", "", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotImage != "png bytes" {
+		t.Fatalf("expected the image bytes written on the backend, got %q", gotImage)
+	}
+	if gotScratch != scratch || strings.Join(gotRefs, ",") != "/srv/shared/proto" {
+		t.Fatalf("expected scratch and reference dirs on the backend, got %q %v", gotScratch, gotRefs)
+	}
+}
+
+func TestRemoteExecutor_DeletionGuard(t *testing.T) {
+	dir := t.TempDir()
+	claude, marker := deletionScript(t, dir)
+	remote := serveTestExecutor(t, NewClaudeExecutor(claude, "sonnet", 30*time.Second), "secret")
+	os.MkdirAll(filepath.Join(dir, "build"), 0755)
+	os.WriteFile(filepath.Join(dir, "build", "out.bin"), []byte("x"), 0644)
+
+	var asked, command string
+	guard := func(paths []string, cmd string) bool {
+		asked, command = strings.Join(paths, ","), cmd
+		return false
+	}
+	_, err := remote.ExecStream(withDeleteGuard(context.Background(), guard), "hi", dir, "", "safe", "", nil)
+	if !errors.Is(err, errDeletionRejected) || asked != "build" || command != "rm -rf build" {
+		t.Fatalf("expected the frontend asked and the run stopped, got %v %q %q", err, asked, command)
+	}
+	if fileExists(marker) || len(trashEntries(dir)) != 0 {
+		t.Fatal("expected nothing deleted or backed up")
+	}
+
+	guard = func([]string, string) bool { return true }
+	if _, err := remote.ExecStream(withDeleteGuard(context.Background(), guard), "hi", dir, "", "safe", "", nil); err != nil {
+		t.Fatalf("expected the run to finish after approval: %v", err)
+	}
+	if !fileExists(marker) {
+		t.Fatal("expected the deletion to run once allowed")
+	}
+	if e := trashEntries(dir); len(e) != 1 || strings.Join(e[0].Paths, ",") != "build" {
+		t.Fatalf("expected the backend to back the files up, got %+v", e)
+	}
+}
+
+// writeTestCerts writes a CA and a certificate for 127.0.0.1 signed by it.
+func writeTestCerts(t *testing.T) (caFile, certFile, keyFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	write := func(name, typ string, der []byte) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600)
+		return path
+	}
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "devbot test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "executor"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leaf, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return write("ca.pem", "CERTIFICATE", caDER), write("cert.pem", "CERTIFICATE", leafDER), write("key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+func TestRemoteExecutor_TLS(t *testing.T) {
+	caFile, certFile, keyFile := writeTestCerts(t)
+	srv, err := NewExecutorServer(&stubExecutor{}, "secret", ExecutorTLS{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("NewExecutorServer: %v", err)
+	}
+	lis, _ := net.Listen("tcp", "127.0.0.1:0")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Serve(ctx, lis)
+
+	remote, err := NewRemoteExecutor(lis.Addr().String(), "secret", "sonnet", ExecutorTLS{CAFile: caFile})
+	if err != nil {
+		t.Fatalf("NewRemoteExecutor: %v", err)
+	}
+	defer remote.Close()
+	if res, err := remote.ExecStream(context.Background(), "hi", t.TempDir(), "", "", "", nil); err != nil || res.Output != "ok hi" {
+		t.Fatalf("expected the run over TLS, got %+v %v", res, err)
+	}
+
+	// The test CA is not in the system roots.
+	untrusted, _ := NewRemoteExecutor(lis.Addr().String(), "secret", "sonnet", ExecutorTLS{})
+	defer untrusted.Close()
+	if _, err := untrusted.ExecStream(context.Background(), "hi", t.TempDir(), "", "", "", nil); err == nil {
+		t.Fatal("expected an unverified backend refused")
+	}
+	plain, _ := NewRemoteExecutor(lis.Addr().String(), "secret", "sonnet", ExecutorTLS{Insecure: true})
+	defer plain.Close()
+	if _, err := plain.ExecStream(context.Background(), "hi", t.TempDir(), "", "", "", nil); err == nil {
+		t.Fatal("expected plaintext refused by a TLS backend")
+	}
+}
+
+func TestExecutorPlaintextOnlyOnLoopback(t *testing.T) {
+	if _, err := NewRemoteExecutor("10.0.0.5:7070", "secret", "sonnet", ExecutorTLS{Insecure: true}); err == nil {
+		t.Fatal("expected plaintext to a remote address refused")
+	}
+	if _, err := NewExecutorServer(&stubExecutor{}, "secret", ExecutorTLS{}); err == nil {
+		t.Fatal("expected a TLS server without a certificate refused")
+	}
+	srv, _ := NewExecutorServer(&stubExecutor{}, "secret", ExecutorTLS{Insecure: true})
+	lis, err := net.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		t.Skipf("listen: %v", err)
+	}
+	if err := srv.Serve(context.Background(), lis); err == nil || !strings.Contains(err.Error(), "loopback") {
+		t.Fatalf("expected plaintext refused on every interface, got %v", err)
+	}
+	for addr, want := range map[string]bool{"127.0.0.1:7070": true, "localhost:7070": true, "[::1]:7070": true, ":7070": false, "backend:7070": false} {
+		if got := isLoopbackAddr(addr); got != want {
+			t.Errorf("isLoopbackAddr(%q) = %v, want %v", addr, got, want)
+		}
+	}
+	if !(bearerToken{token: "x"}).RequireTransportSecurity() {
+		t.Fatal("expected the token to require TLS")
+	}
+}
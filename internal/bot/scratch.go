@@ -0,0 +1,135 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxScratchList bounds the entries /scratch ls shows.
+const maxScratchList = 50
+
+type scratchKey struct{}
+
+// withScratchDir tells the local Claude executor to give the CLI access to
+// dir and to use it as TMPDIR.
+func withScratchDir(ctx context.Context, dir string) context.Context {
+	if dir == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, scratchKey{}, dir)
+}
+
+// scratchDirFrom returns the scratch directory set by withScratchDir.
+func scratchDirFrom(ctx context.Context) string {
+	dir, _ := ctx.Value(scratchKey{}).(string)
+	return dir
+}
+
+// SetScratchRoot sets the directory holding each chat's scratch space.
+// Without one, uploads are saved to the workdir as before.
+func (r *Router) SetScratchRoot(dir string) {
+	r.scratchRoot = dir
+}
+
+// scratchDir returns the chat's scratch directory, creating it, or "" if
+// no scratch root is configured.
+func (r *Router) scratchDir(chatID string) (string, error) {
+	if r.scratchRoot == "" {
+		return "", nil
+	}
+	name := strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(chatID)
+	dir := filepath.Join(r.scratchRoot, name)
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+func (r *Router) cmdScratch(ctx context.Context, chatID, args string) {
+	sub, name, _ := strings.Cut(strings.TrimSpace(args), " ")
+	name = strings.TrimSpace(name)
+	if r.scratchRoot == "" {
+		r.sender.SendText(ctx, chatID, "未配置临时目录（scratch_dir）。")
+		return
+	}
+	dir, err := r.scratchDir(chatID)
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("创建临时目录失败: %v", err))
+		return
+	}
+
+	switch sub {
+	case "", "ls":
+		r.listScratch(ctx, chatID, dir)
+	case "clean":
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("读取临时目录失败: %v", err))
+			return
+		}
+		removed := 0
+		for _, e := range entries {
+			if name != "" && e.Name() != filepath.Base(name) {
+				continue
+			}
+			if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+				r.sender.SendText(ctx, chatID, fmt.Sprintf("删除 %s 失败: %v", e.Name(), err))
+				return
+			}
+			removed++
+		}
+		if name != "" && removed == 0 {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("临时目录中没有 %s。", name))
+			return
+		}
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已清理临时目录（删除 %d 项）", removed))
+	default:
+		r.sender.SendText(ctx, chatID, "用法: /scratch [ls]\n       /scratch clean [文件名]\n上传的文件和 Claude 的临时文件保存在会话临时目录中，不会写入仓库。")
+	}
+}
+
+// listScratch sends the contents of the chat's scratch directory, newest
+// first.
+func (r *Router) listScratch(ctx context.Context, chatID, dir string) {
+	type entry struct {
+		name string
+		size int64
+		mod  time.Time
+	}
+	var entries []entry
+	var total int64
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		entries = append(entries, entry{rel, info.Size(), info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if len(entries) == 0 {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("临时目录为空: %s", dir))
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].mod.After(entries[j].mod) })
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**目录:** `%s`\n", dir)
+	for i, e := range entries {
+		if i == maxScratchList {
+			fmt.Fprintf(&sb, "... 另有 %d 个文件\n", len(entries)-maxScratchList)
+			break
+		}
+		fmt.Fprintf(&sb, "- `%s` %s · %s\n", e.name, formatSize(e.size), e.mod.Format("01-02 15:04"))
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{
+		Title:   fmt.Sprintf("临时目录（%d 个文件，%s）", len(entries), formatSize(total)),
+		Content: strings.TrimSpace(sb.String()),
+	})
+}
@@ -0,0 +1,132 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRouteFileSavesToScratch(t *testing.T) {
+	r, sender := newTestRouter(t)
+	root := filepath.Join(t.TempDir(), "scratch")
+	r.SetScratchRoot(root)
+	r.RouteFile(context.Background(), "chat1", "user1", "report.pdf", []byte("pdf"))
+
+	if len(sender.messages) == 0 || !strings.Contains(sender.messages[0], "文件已保存") {
+		t.Fatalf("expected save message, got: %v", sender.messages)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "chat1", "report.pdf"))
+	if err != nil || string(data) != "pdf" {
+		t.Fatalf("expected file in scratch dir: %q %v", data, err)
+	}
+	if fileExists(filepath.Join(r.getSession("chat1").WorkDir, "report.pdf")) {
+		t.Fatal("file should not be saved to the workdir")
+	}
+}
+
+func TestRouteImageSavesToScratch(t *testing.T) {
+	r, _ := newTestRouter(t)
+	root := filepath.Join(t.TempDir(), "scratch")
+	r.SetScratchRoot(root)
+	r.RouteImage(context.Background(), "chat1", "user1", []byte("png"), "shot.png")
+
+	if !fileExists(filepath.Join(root, "chat1", "images", "shot.png")) {
+		t.Fatal("expected image in scratch images dir")
+	}
+	if fileExists(filepath.Join(r.getSession("chat1").WorkDir, ".devbot-images")) {
+		t.Fatal("image dir should not be created in the workdir")
+	}
+}
+
+func TestScratchDirSanitizesChatID(t *testing.T) {
+	r, _ := newTestRouter(t)
+	root := t.TempDir()
+	r.SetScratchRoot(root)
+	dir, err := r.scratchDir("../x/y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !underRoot(root, dir) || filepath.Dir(dir) != root {
+		t.Fatalf("scratch dir escaped root: %s", dir)
+	}
+}
+
+func TestScratchNotConfigured(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/scratch")
+	if !strings.Contains(sender.LastMessage(), "未配置临时目录") {
+		t.Fatalf("unexpected reply: %q", sender.LastMessage())
+	}
+}
+
+func TestScratchListAndClean(t *testing.T) {
+	r, sender := newTestRouter(t)
+	root := t.TempDir()
+	r.SetScratchRoot(root)
+
+	r.Route(context.Background(), "chat1", "user1", "/scratch ls")
+	if !strings.Contains(sender.LastMessage(), "临时目录为空") {
+		t.Fatalf("expected empty listing, got: %q", sender.LastMessage())
+	}
+
+	dir := filepath.Join(root, "chat1")
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("aaa"), 0644)
+	os.MkdirAll(filepath.Join(dir, "images"), 0755)
+	os.WriteFile(filepath.Join(dir, "images", "b.png"), []byte("bb"), 0644)
+
+	r.Route(context.Background(), "chat1", "user1", "/scratch")
+	msg := sender.LastMessage()
+	if !strings.Contains(msg, "临时目录（2 个文件") || !strings.Contains(msg, "a.txt") || !strings.Contains(msg, filepath.Join("images", "b.png")) {
+		t.Fatalf("unexpected listing: %q", msg)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/scratch clean missing.txt")
+	if !strings.Contains(sender.LastMessage(), "临时目录中没有 missing.txt") {
+		t.Fatalf("unexpected reply: %q", sender.LastMessage())
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/scratch clean a.txt")
+	if !strings.Contains(sender.LastMessage(), "删除 1 项") || fileExists(filepath.Join(dir, "a.txt")) {
+		t.Fatalf("expected a.txt removed, got: %q", sender.LastMessage())
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/scratch clean")
+	entries, _ := os.ReadDir(dir)
+	if !strings.Contains(sender.LastMessage(), "✓ 已清理临时目录") || len(entries) != 0 {
+		t.Fatalf("expected scratch dir emptied, got: %q (%d left)", sender.LastMessage(), len(entries))
+	}
+}
+
+func TestClaudeExecUsesScratchDir(t *testing.T) {
+	dir := t.TempDir()
+	scratch := t.TempDir()
+	argsFile := filepath.Join(dir, "args.txt")
+	envFile := filepath.Join(dir, "env.txt")
+	script := filepath.Join(dir, "claude")
+	os.WriteFile(script, []byte(fmt.Sprintf("#!/bin/sh\necho \"$@\" > %s\necho \"$TMPDIR\" > %s\necho '{\"type\":\"result\",\"result\":\"ok\",\"session_id\":\"s1\"}'\n", argsFile, envFile)), 0755)
+
+	exec := NewClaudeExecutor(script, "sonnet", 30*time.Second)
+	if _, err := exec.Exec(withScratchDir(context.Background(), scratch), "hello", dir, "", "safe", "sonnet"); err != nil {
+		t.Fatalf("Exec error: %v", err)
+	}
+	args, _ := os.ReadFile(argsFile)
+	if !strings.Contains(string(args), "--add-dir "+scratch) {
+		t.Fatalf("expected --add-dir %s in args, got: %q", scratch, args)
+	}
+	env, _ := os.ReadFile(envFile)
+	if strings.TrimSpace(string(env)) != scratch {
+		t.Fatalf("expected TMPDIR=%s, got: %q", scratch, env)
+	}
+
+	if _, err := exec.Exec(context.Background(), "hello", dir, "", "safe", "sonnet"); err != nil {
+		t.Fatalf("Exec error: %v", err)
+	}
+	args, _ = os.ReadFile(argsFile)
+	if strings.Contains(string(args), "--add-dir") {
+		t.Fatalf("unexpected --add-dir without scratch dir: %q", args)
+	}
+}
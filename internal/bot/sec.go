@@ -0,0 +1,431 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// secScanTimeout bounds each scanner run of /sec.
+const secScanTimeout = 5 * time.Minute
+
+// maxSecListed bounds the findings listed in the /sec card.
+const maxSecListed = 30
+
+// secSeverities lists the normalized severities from most to least severe.
+var secSeverities = []struct{ key, label string }{
+	{"critical", "🔴 严重"},
+	{"high", "🟠 高危"},
+	{"medium", "🟡 中危"},
+	{"low", "🔵 低危"},
+	{"unknown", "⚪ 未分级"},
+}
+
+// secFinding is one issue reported by a security scanner.
+type secFinding struct {
+	Tool     string
+	Severity string
+	Rule     string // rule or advisory ID
+	Location string // file:line or package@version
+	Title    string
+	// Fingerprint identifies the finding across scans; it leaves out
+	// details that change without the issue changing, such as line numbers.
+	Fingerprint string
+}
+
+// secScanner runs one scanner in a project directory.
+type secScanner struct {
+	Name string
+	// Args returns the command line for dir, or nil if the scanner does not
+	// apply to the project.
+	Args  func(dir string) []string
+	Parse func(dir string, out []byte) ([]secFinding, error)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// secScanners are the scanners /sec runs when they apply and are installed.
+var secScanners = []secScanner{
+	{
+		Name: "gosec",
+		Args: func(dir string) []string {
+			if !fileExists(filepath.Join(dir, "go.mod")) {
+				return nil
+			}
+			return []string{"gosec", "-quiet", "-fmt=json", "./..."}
+		},
+		Parse: parseGosec,
+	},
+	{
+		Name: "npm audit",
+		Args: func(dir string) []string {
+			if !fileExists(filepath.Join(dir, "package-lock.json")) {
+				return nil
+			}
+			return []string{"npm", "audit", "--json"}
+		},
+		Parse: parseNpmAudit,
+	},
+	{
+		Name: "pip-audit",
+		Args: func(dir string) []string {
+			switch {
+			case fileExists(filepath.Join(dir, "requirements.txt")):
+				return []string{"pip-audit", "-f", "json", "-r", "requirements.txt"}
+			case fileExists(filepath.Join(dir, "pyproject.toml")):
+				return []string{"pip-audit", "-f", "json", "."}
+			}
+			return nil
+		},
+		Parse: parsePipAudit,
+	},
+}
+
+func normalizeSeverity(s string) string {
+	switch s = strings.ToLower(strings.TrimSpace(s)); s {
+	case "critical", "high", "medium", "low":
+		return s
+	case "moderate":
+		return "medium"
+	}
+	return "unknown"
+}
+
+var codeLinePrefix = regexp.MustCompile(`(?m)^\d+:\s?`)
+
+func parseGosec(dir string, out []byte) ([]secFinding, error) {
+	var report struct {
+		Issues []struct {
+			Severity string `json:"severity"`
+			RuleID   string `json:"rule_id"`
+			Details  string `json:"details"`
+			File     string `json:"file"`
+			Code     string `json:"code"`
+			Line     string `json:"line"`
+		} `json:"Issues"`
+	}
+	if err := json.Unmarshal(out, &report); err != nil {
+		return nil, err
+	}
+	var findings []secFinding
+	for _, is := range report.Issues {
+		file := is.File
+		if rel, err := filepath.Rel(dir, file); err == nil && !strings.HasPrefix(rel, "..") {
+			file = rel
+		}
+		code := strings.TrimSpace(codeLinePrefix.ReplaceAllString(is.Code, ""))
+		findings = append(findings, secFinding{
+			Tool:        "gosec",
+			Severity:    normalizeSeverity(is.Severity),
+			Rule:        is.RuleID,
+			Location:    file + ":" + is.Line,
+			Title:       is.Details,
+			Fingerprint: strings.Join([]string{"gosec", is.RuleID, file, code}, "|"),
+		})
+	}
+	return findings, nil
+}
+
+func parseNpmAudit(_ string, out []byte) ([]secFinding, error) {
+	var report struct {
+		Vulnerabilities map[string]struct {
+			Name     string            `json:"name"`
+			Severity string            `json:"severity"`
+			Range    string            `json:"range"`
+			Via      []json.RawMessage `json:"via"`
+		} `json:"vulnerabilities"`
+	}
+	if err := json.Unmarshal(out, &report); err != nil {
+		return nil, err
+	}
+	var findings []secFinding
+	for name, v := range report.Vulnerabilities {
+		// via lists advisories, or the names of vulnerable dependencies for
+		// packages that are only affected transitively.
+		var titles, ids []string
+		for _, raw := range v.Via {
+			var adv struct {
+				Title string `json:"title"`
+				URL   string `json:"url"`
+			}
+			if json.Unmarshal(raw, &adv) == nil && adv.Title != "" {
+				titles = append(titles, adv.Title)
+				id := adv.URL[strings.LastIndex(adv.URL, "/")+1:]
+				if id == "" {
+					id = adv.Title
+				}
+				ids = append(ids, id)
+			}
+		}
+		if len(titles) == 0 {
+			continue
+		}
+		findings = append(findings, secFinding{
+			Tool:        "npm audit",
+			Severity:    normalizeSeverity(v.Severity),
+			Rule:        strings.Join(ids, ","),
+			Location:    name + "@" + v.Range,
+			Title:       strings.Join(titles, "; "),
+			Fingerprint: strings.Join(append([]string{"npm", name}, ids...), "|"),
+		})
+	}
+	return findings, nil
+}
+
+func parsePipAudit(_ string, out []byte) ([]secFinding, error) {
+	type dependency struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+		Vulns   []struct {
+			ID          string   `json:"id"`
+			FixVersions []string `json:"fix_versions"`
+			Description string   `json:"description"`
+		} `json:"vulns"`
+	}
+	var deps []dependency
+	// Older pip-audit versions print a bare array.
+	if err := json.Unmarshal(out, &deps); err != nil {
+		var report struct {
+			Dependencies []dependency `json:"dependencies"`
+		}
+		if err := json.Unmarshal(out, &report); err != nil {
+			return nil, err
+		}
+		deps = report.Dependencies
+	}
+	var findings []secFinding
+	for _, d := range deps {
+		for _, v := range d.Vulns {
+			title := truncateRunes(strings.TrimSpace(v.Description), 120)
+			if len(v.FixVersions) > 0 {
+				title += "（修复版本: " + strings.Join(v.FixVersions, ", ") + "）"
+			}
+			findings = append(findings, secFinding{
+				Tool:        "pip-audit",
+				Severity:    "unknown", // pip-audit reports no severity
+				Rule:        v.ID,
+				Location:    d.Name + "@" + d.Version,
+				Title:       title,
+				Fingerprint: strings.Join([]string{"pip-audit", strings.ToLower(d.Name), v.ID}, "|"),
+			})
+		}
+	}
+	return findings, nil
+}
+
+// runSecScanners runs the applicable scanners in dir. notes describes, per
+// scanner, whether it ran, was skipped or failed.
+func runSecScanners(ctx context.Context, dir string) (findings []secFinding, notes []string) {
+	for _, sc := range secScanners {
+		args := sc.Args(dir)
+		if args == nil {
+			continue
+		}
+		if _, err := exec.LookPath(args[0]); err != nil {
+			notes = append(notes, fmt.Sprintf("%s（未安装，跳过）", sc.Name))
+			continue
+		}
+		execCtx, cancel := context.WithTimeout(ctx, secScanTimeout)
+		cmd := exec.CommandContext(execCtx, args[0], args[1:]...)
+		cmd.Dir = dir
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		// Scanners exit non-zero when they find issues, so the exit status
+		// only matters when the output cannot be parsed.
+		runErr := cmd.Run()
+		cancel()
+		found, err := sc.Parse(dir, stdout.Bytes())
+		if err != nil {
+			msg := strings.TrimSpace(stderr.String())
+			if msg == "" && runErr != nil {
+				msg = runErr.Error()
+			}
+			if msg == "" {
+				msg = err.Error()
+			}
+			notes = append(notes, fmt.Sprintf("%s（失败: %s）", sc.Name, truncateRunes(msg, 200)))
+			continue
+		}
+		notes = append(notes, fmt.Sprintf("%s ✓ %d 项", sc.Name, len(found)))
+		findings = append(findings, found...)
+	}
+	sortSecFindings(findings)
+	return findings, notes
+}
+
+func secSeverityRank(s string) int {
+	for i, sev := range secSeverities {
+		if sev.key == s {
+			return i
+		}
+	}
+	return len(secSeverities)
+}
+
+func sortSecFindings(findings []secFinding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if ra, rb := secSeverityRank(a.Severity), secSeverityRank(b.Severity); ra != rb {
+			return ra < rb
+		}
+		if a.Tool != b.Tool {
+			return a.Tool < b.Tool
+		}
+		return a.Location < b.Location
+	})
+}
+
+// formatSecFindings renders findings grouped by severity, listing at most
+// maxSecListed of them.
+func formatSecFindings(findings []secFinding) string {
+	var sb strings.Builder
+	listed := 0
+	for _, sev := range secSeverities {
+		var group []secFinding
+		for _, f := range findings {
+			if f.Severity == sev.key {
+				group = append(group, f)
+			}
+		}
+		if len(group) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "**%s（%d）**\n", sev.label, len(group))
+		for _, f := range group {
+			if listed == maxSecListed {
+				break
+			}
+			listed++
+			fmt.Fprintf(&sb, "- [%s %s] `%s` %s\n", f.Tool, f.Rule, f.Location, truncateRunes(f.Title, 150))
+		}
+		sb.WriteString("\n")
+	}
+	if len(findings) > listed {
+		fmt.Fprintf(&sb, "…还有 %d 项未列出\n", len(findings)-listed)
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// secSummary counts findings per severity, e.g. "高危 2 · 低危 1".
+func secSummary(findings []secFinding) string {
+	var parts []string
+	for _, sev := range secSeverities {
+		n := 0
+		for _, f := range findings {
+			if f.Severity == sev.key {
+				n++
+			}
+		}
+		if n > 0 {
+			label := sev.label[strings.IndexByte(sev.label, ' ')+1:]
+			parts = append(parts, fmt.Sprintf("%s %d", label, n))
+		}
+	}
+	return strings.Join(parts, " · ")
+}
+
+func (r *Router) cmdSec(ctx context.Context, chatID, args string) {
+	switch args {
+	case "", "all", "baseline":
+	default:
+		r.sender.SendText(ctx, chatID, "用法:\n/sec  运行安全扫描，只报告相对基线新增的问题（首次运行建立基线）\n/sec all  运行扫描并列出全部问题\n/sec baseline  运行扫描并把当前结果设为新的基线")
+		return
+	}
+	session := r.getSession(chatID)
+	dir := session.WorkDir
+	if dir == "" {
+		dir = r.store.WorkRoot()
+	}
+	repo := dir
+	if root, err := runGitOutput(dir, "rev-parse", "--show-toplevel"); err == nil && root != "" {
+		repo = root
+	}
+
+	r.sender.SendText(ctx, chatID, "安全扫描中...")
+	start := time.Now()
+	findings, notes := runSecScanners(ctx, dir)
+	elapsed := time.Since(start).Truncate(time.Second)
+	if len(notes) == 0 {
+		r.sender.SendText(ctx, chatID, "未识别到可扫描的项目类型（支持 Go: gosec、Node: npm audit、Python: pip-audit）。")
+		return
+	}
+	ran := false
+	for _, n := range notes {
+		if strings.Contains(n, "✓") {
+			ran = true
+		}
+	}
+	header := fmt.Sprintf("**扫描器:** %s\n**耗时:** %s\n", strings.Join(notes, "，"), elapsed)
+	if !ran {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "安全扫描未能运行", Content: header, Template: "red"})
+		return
+	}
+
+	current := make(map[string]bool, len(findings))
+	fingerprints := make([]string, 0, len(findings))
+	for _, f := range findings {
+		if !current[f.Fingerprint] {
+			current[f.Fingerprint] = true
+			fingerprints = append(fingerprints, f.Fingerprint)
+		}
+	}
+	base, hasBase := r.store.SecBaseline(repo)
+	if !hasBase || args == "baseline" {
+		r.store.SetSecBaseline(repo, SecBaseline{Fingerprints: fingerprints, CreatedAt: time.Now()})
+		r.save()
+		content := header + fmt.Sprintf("\n已建立基线：%d 项问题。之后的 /sec 只报告新增的问题。", len(fingerprints))
+		if len(findings) > 0 {
+			content += "\n" + secSummary(findings) + "\n\n" + formatSecFindings(findings)
+		}
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("安全扫描: 基线 %d 项", len(fingerprints)), Content: content, Template: "blue"})
+		return
+	}
+
+	inBase := make(map[string]bool, len(base.Fingerprints))
+	for _, fp := range base.Fingerprints {
+		inBase[fp] = true
+	}
+	var fresh []secFinding
+	for _, f := range findings {
+		if !inBase[f.Fingerprint] {
+			fresh = append(fresh, f)
+		}
+	}
+	fixed := 0
+	for fp := range inBase {
+		if !current[fp] {
+			fixed++
+		}
+	}
+	content := header + fmt.Sprintf("**基线:** %s 建立，%d 项；本次共 %d 项，新增 %d 项，已修复 %d 项",
+		base.CreatedAt.Format("2006-01-02 15:04"), len(base.Fingerprints), len(fingerprints), len(fresh), fixed)
+
+	listed := fresh
+	if args == "all" {
+		listed = findings
+	}
+	if len(listed) > 0 {
+		content += "\n" + secSummary(listed) + "\n\n" + formatSecFindings(listed)
+	}
+	if len(fresh) == 0 {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "✓ 安全扫描: 无新增问题", Content: content, Template: "green"})
+		return
+	}
+	tpl := "orange"
+	if secSeverityRank(fresh[0].Severity) <= 1 {
+		tpl = "red"
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("安全扫描: %d 项新增问题", len(fresh)), Content: content, Template: tpl})
+}
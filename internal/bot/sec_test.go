@@ -0,0 +1,150 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const gosecReport = `{"Issues": [
+ {"severity": "HIGH", "rule_id": "G101", "details": "Potential hardcoded credentials", "file": "%[1]s/config.go", "code": "12: password := \"hunter2\"\n", "line": "12"},
+ {"severity": "LOW", "rule_id": "G104", "details": "Errors unhandled.", "file": "%[1]s/main.go", "code": "7: f.Close()\n", "line": "7"}
+], "Stats": {}}`
+
+func TestParseGosec(t *testing.T) {
+	findings, err := parseGosec("/repo", []byte(fmt.Sprintf(gosecReport, "/repo")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 2 || findings[0].Severity != "high" || findings[0].Location != "config.go:12" || findings[0].Rule != "G101" {
+		t.Fatalf("unexpected findings %+v", findings)
+	}
+	// Moving the code must not change the fingerprint.
+	moved, _ := parseGosec("/repo", []byte(strings.Replace(fmt.Sprintf(gosecReport, "/repo"), "12: password", "40: password", 1)))
+	if moved[0].Fingerprint != findings[0].Fingerprint {
+		t.Fatalf("expected line-independent fingerprint, got %q vs %q", moved[0].Fingerprint, findings[0].Fingerprint)
+	}
+	if _, err := parseGosec("/repo", []byte("not json")); err == nil {
+		t.Fatal("expected error for invalid output")
+	}
+}
+
+func TestParseNpmAudit(t *testing.T) {
+	out := `{"vulnerabilities": {
+	  "lodash": {"name": "lodash", "severity": "moderate", "range": "<4.17.21", "via": [{"title": "Prototype Pollution", "url": "https://github.com/advisories/GHSA-p6mc"}]},
+	  "wrapper": {"name": "wrapper", "severity": "high", "range": "*", "via": ["lodash"]}
+	}}`
+	findings, err := parseNpmAudit("", []byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || findings[0].Severity != "medium" || findings[0].Rule != "GHSA-p6mc" || findings[0].Location != "lodash@<4.17.21" {
+		t.Fatalf("expected only the direct advisory, got %+v", findings)
+	}
+}
+
+func TestParsePipAudit(t *testing.T) {
+	for _, out := range []string{
+		`{"dependencies": [{"name": "Flask", "version": "0.5", "vulns": [{"id": "PYSEC-2019-179", "fix_versions": ["1.0"], "description": "DoS"}]}, {"name": "ok", "version": "1", "vulns": []}], "fixes": []}`,
+		`[{"name": "Flask", "version": "0.5", "vulns": [{"id": "PYSEC-2019-179", "fix_versions": ["1.0"], "description": "DoS"}]}]`,
+	} {
+		findings, err := parsePipAudit("", []byte(out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(findings) != 1 || findings[0].Severity != "unknown" || findings[0].Title != "DoS（修复版本: 1.0）" || findings[0].Fingerprint != "pip-audit|flask|PYSEC-2019-179" {
+			t.Fatalf("unexpected findings %+v", findings)
+		}
+	}
+}
+
+func TestFormatSecFindings(t *testing.T) {
+	findings := []secFinding{
+		{Tool: "gosec", Severity: "low", Rule: "G104", Location: "main.go:7", Title: "Errors unhandled."},
+		{Tool: "npm audit", Severity: "critical", Rule: "GHSA-1", Location: "x@1", Title: "RCE"},
+	}
+	sortSecFindings(findings)
+	got := formatSecFindings(findings)
+	want := "**🔴 严重（1）**\n- [npm audit GHSA-1] `x@1` RCE\n\n**🔵 低危（1）**\n- [gosec G104] `main.go:7` Errors unhandled."
+	if got != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+	if s := secSummary(findings); s != "严重 1 · 低危 1" {
+		t.Fatalf("unexpected summary %q", s)
+	}
+}
+
+// fakeScanner installs an executable named name on PATH that prints the
+// contents of the returned file.
+func fakeScanner(t *testing.T, name string) string {
+	t.Helper()
+	bin := t.TempDir()
+	out := filepath.Join(bin, name+".out")
+	os.WriteFile(filepath.Join(bin, name), []byte(fmt.Sprintf("#!/bin/sh\ncat %s\nexit 1\n", out)), 0755)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return out
+}
+
+func TestRouterSec_Baseline(t *testing.T) {
+	r, sender := newTestRouter(t)
+	dir := r.getSession("chat1").WorkDir
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module x\n"), 0644)
+	out := fakeScanner(t, "gosec")
+	os.WriteFile(out, []byte(fmt.Sprintf(gosecReport, dir)), 0644)
+
+	r.Route(context.Background(), "chat1", "user1", "/sec")
+	msg := sender.LastMessage()
+	if !strings.HasPrefix(msg, "安全扫描: 基线 2 项") || !strings.Contains(msg, "gosec ✓ 2 项") || !strings.Contains(msg, "G101") {
+		t.Fatalf("expected baseline card, got %q", msg)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/sec")
+	if msg := sender.LastMessage(); !strings.HasPrefix(msg, "✓ 安全扫描: 无新增问题") || strings.Contains(msg, "G101") {
+		t.Fatalf("expected no new findings, got %q", msg)
+	}
+
+	// G101 is fixed and a new issue appears.
+	os.WriteFile(out, []byte(fmt.Sprintf(`{"Issues": [
+	 {"severity": "LOW", "rule_id": "G104", "details": "Errors unhandled.", "file": "%[1]s/main.go", "code": "9: f.Close()\n", "line": "9"},
+	 {"severity": "MEDIUM", "rule_id": "G304", "details": "File path provided as taint input", "file": "%[1]s/load.go", "code": "3: os.Open(p)\n", "line": "3"}
+	]}`, dir)), 0644)
+	r.Route(context.Background(), "chat1", "user1", "/sec")
+	msg = sender.LastMessage()
+	if !strings.HasPrefix(msg, "安全扫描: 1 项新增问题") || !strings.Contains(msg, "新增 1 项，已修复 1 项") || !strings.Contains(msg, "G304") || strings.Contains(msg, "G104") {
+		t.Fatalf("expected only the new finding, got %q", msg)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/sec all")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "G104") || !strings.Contains(msg, "G304") {
+		t.Fatalf("expected all findings, got %q", msg)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/sec baseline")
+	r.Route(context.Background(), "chat1", "user1", "/sec")
+	if msg := sender.LastMessage(); !strings.HasPrefix(msg, "✓ 安全扫描: 无新增问题") {
+		t.Fatalf("expected reset baseline to accept the findings, got %q", msg)
+	}
+}
+
+func TestRouterSec_NoScanners(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/sec")
+	if !strings.Contains(sender.LastMessage(), "未识别到可扫描的项目类型") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+
+	dir := r.getSession("chat1").WorkDir
+	os.WriteFile(filepath.Join(dir, "requirements.txt"), []byte("flask==0.5\n"), 0644)
+	t.Setenv("PATH", t.TempDir())
+	r.Route(context.Background(), "chat1", "user1", "/sec")
+	if msg := sender.LastMessage(); !strings.HasPrefix(msg, "安全扫描未能运行") || !strings.Contains(msg, "pip-audit（未安装，跳过）") {
+		t.Fatalf("expected missing scanner card, got %q", msg)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/sec foo")
+	if !strings.HasPrefix(sender.LastMessage(), "用法:") {
+		t.Fatalf("expected usage, got %q", sender.LastMessage())
+	}
+}
@@ -0,0 +1,76 @@
+package bot
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Secrets holds credentials that must not live in the main config file,
+// such as registry passwords and database DSNs. They are read from a YAML
+// map of name to value that only the owner may read; a name missing from
+// the file falls back to the DEVBOT_SECRET_<NAME> environment variable.
+type Secrets struct {
+	values map[string]string
+}
+
+// LoadSecrets reads the secrets file at path. An empty path yields a store
+// backed by the environment only. Files readable by group or others are
+// refused.
+func LoadSecrets(path string) (*Secrets, error) {
+	s := &Secrets{values: make(map[string]string)}
+	if path == "" {
+		return s, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("secrets file %s must not be accessible by group or others (chmod 600)", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &s.values); err != nil {
+		return nil, fmt.Errorf("parse secrets file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Get returns the secret called name.
+func (s *Secrets) Get(name string) (string, bool) {
+	if s != nil {
+		if v, ok := s.values[name]; ok && v != "" {
+			return v, true
+		}
+	}
+	key := "DEVBOT_SECRET_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+	if v := os.Getenv(key); v != "" {
+		return v, true
+	}
+	return "", false
+}
+
+// Redact replaces the values of the secrets read from the file with a
+// placeholder, for text leaving the bot. Secrets that only exist in the
+// environment are not known here and stay as they are.
+func (s *Secrets) Redact(text string) string {
+	if s == nil {
+		return text
+	}
+	for _, v := range s.values {
+		if len(v) >= 4 {
+			text = strings.ReplaceAll(text, v, "[已隐藏]")
+		}
+	}
+	return text
+}
+
+// SetSecrets sets the secrets store used by commands that need credentials.
+func (r *Router) SetSecrets(s *Secrets) {
+	r.secrets = s
+}
@@ -0,0 +1,46 @@
+package bot
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadSecrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.yaml")
+	os.WriteFile(path, []byte("docker_password: hunter2\nprod-db: \"postgres://u:p@db/app\"\n"), 0600)
+	s, err := LoadSecrets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := s.Get("docker_password"); !ok || v != "hunter2" {
+		t.Fatalf("unexpected secret %q %v", v, ok)
+	}
+	if v, _ := s.Get("prod-db"); v != "postgres://u:p@db/app" {
+		t.Fatalf("unexpected secret %q", v)
+	}
+
+	t.Setenv("DEVBOT_SECRET_STAGING_DB", "from-env")
+	if v, ok := s.Get("staging-db"); !ok || v != "from-env" {
+		t.Fatalf("expected environment fallback, got %q %v", v, ok)
+	}
+	if _, ok := s.Get("missing"); ok {
+		t.Fatal("expected missing secret")
+	}
+	var none *Secrets
+	if v, _ := none.Get("staging-db"); v != "from-env" {
+		t.Fatalf("expected a nil store to use the environment, got %q", v)
+	}
+}
+
+func TestLoadSecrets_Permissions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.yaml")
+	os.WriteFile(path, []byte("a: b\n"), 0644)
+	if _, err := LoadSecrets(path); err == nil || !strings.Contains(err.Error(), "chmod 600") {
+		t.Fatalf("expected permission error, got %v", err)
+	}
+	if s, err := LoadSecrets(""); err != nil || s == nil {
+		t.Fatalf("expected empty store without a file, got %v", err)
+	}
+}
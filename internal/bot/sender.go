@@ -1,20 +1,30 @@
 package bot
 
 import (
+    "bytes"
     "context"
     "encoding/json"
-    "log"
+    "fmt"
+    "log/slog"
+    "path/filepath"
+    "sort"
+    "strconv"
     "strings"
+    "time"
     "unicode/utf8"
 
     lark "github.com/larksuite/oapi-sdk-go/v3"
     larkcore "github.com/larksuite/oapi-sdk-go/v3/core"
+    larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
 )
 
 const MaxMessageLen = 4000
 
 type LarkSender struct {
 	client *lark.Client
+	// driveFolder is the folder oversized files are uploaded to ("" = the
+	// app's root folder).
+	driveFolder string
 }
 
 func NewLarkSender(client *lark.Client) *LarkSender {
@@ -41,11 +51,11 @@ func (s *LarkSender) SendText(ctx context.Context, chatID, text string) error {
 		larkcore.AccessTokenTypeTenant,
 	)
 	if err != nil {
-		log.Printf("sender: SendText failed chat=%s: %v", chatID, err)
+		slog.WarnContext(ctx, "sender: SendText failed", "chat_id", chatID, "err", err)
 		return err
 	}
 	if resp != nil && resp.StatusCode != 200 {
-		log.Printf("sender: SendText non-200 chat=%s status=%d body=%s", chatID, resp.StatusCode, string(resp.RawBody))
+		slog.WarnContext(ctx, "sender: SendText non-200", "chat_id", chatID, "status", resp.StatusCode, "body", string(resp.RawBody))
 	} else if resp != nil {
 		// Check for API-level errors in response body
 		var codeErr struct {
@@ -53,7 +63,7 @@ func (s *LarkSender) SendText(ctx context.Context, chatID, text string) error {
 			Msg  string `json:"msg"`
 		}
 		if json.Unmarshal(resp.RawBody, &codeErr) == nil && codeErr.Code != 0 {
-			log.Printf("sender: SendText API error chat=%s code=%d msg=%s", chatID, codeErr.Code, codeErr.Msg)
+			slog.WarnContext(ctx, "sender: SendText API error", "chat_id", chatID, "code", codeErr.Code, "api_msg", codeErr.Msg)
 		}
 	}
 	return nil
@@ -117,6 +127,45 @@ func buildCardBody(card CardMsg) map[string]interface{} {
 			},
 		},
 	}
+	if card.Details != nil {
+		body["elements"] = append(body["elements"].([]map[string]interface{}), map[string]interface{}{
+			"tag":      "collapsible_panel",
+			"expanded": false,
+			"header": map[string]interface{}{
+				"title": map[string]interface{}{"tag": "plain_text", "content": card.Details.Title},
+			},
+			"elements": []map[string]interface{}{
+				{"tag": "markdown", "content": card.Details.Content},
+			},
+		})
+	}
+	if card.Receipt != "" {
+		body["elements"] = append(body["elements"].([]map[string]interface{}), map[string]interface{}{
+			"tag": "note",
+			"elements": []map[string]interface{}{
+				{"tag": "plain_text", "content": receiptLine(card.Receipt)},
+			},
+		})
+	}
+	if len(card.Buttons) > 0 {
+		var actions []map[string]interface{}
+		for _, b := range card.Buttons {
+			typ := b.Type
+			if typ == "" {
+				typ = "default"
+			}
+			actions = append(actions, map[string]interface{}{
+				"tag":   "button",
+				"text":  map[string]interface{}{"tag": "plain_text", "content": b.Text},
+				"type":  typ,
+				"value": map[string]interface{}{"command": b.Command},
+			})
+		}
+		body["elements"] = append(body["elements"].([]map[string]interface{}), map[string]interface{}{
+			"tag":     "action",
+			"actions": actions,
+		})
+	}
 	if card.Title != "" {
 		tmpl := card.Template
 		if tmpl == "" {
@@ -136,7 +185,7 @@ func buildCardBody(card CardMsg) map[string]interface{} {
 func (s *LarkSender) SendCard(ctx context.Context, chatID string, card CardMsg) error {
 	cardJSON, err := json.Marshal(buildCardBody(card))
 	if err != nil {
-		log.Printf("sender: failed to marshal card: %v", err)
+		slog.WarnContext(ctx, "sender: failed to marshal card", "err", err)
 		return err
 	}
 
@@ -146,6 +195,12 @@ func (s *LarkSender) SendCard(ctx context.Context, chatID string, card CardMsg)
 		if card.Title != "" {
 			fallback = card.Title + "\n\n" + card.Content
 		}
+		if card.Details != nil {
+			fallback += "\n\n" + card.Details.Title + "\n" + card.Details.Content
+		}
+		if card.Receipt != "" {
+			fallback += "\n\n" + receiptLine(card.Receipt)
+		}
 		return s.SendTextChunked(ctx, chatID, fallback)
 	}
 
@@ -162,19 +217,297 @@ func (s *LarkSender) SendCard(ctx context.Context, chatID string, card CardMsg)
 		larkcore.AccessTokenTypeTenant,
 	)
 	if err != nil {
-		log.Printf("sender: SendCard failed chat=%s: %v", chatID, err)
+		slog.WarnContext(ctx, "sender: SendCard failed", "chat_id", chatID, "err", err)
 		return err
 	}
 	if resp != nil && resp.StatusCode != 200 {
-		log.Printf("sender: SendCard non-200 chat=%s status=%d body=%s", chatID, resp.StatusCode, string(resp.RawBody))
+		slog.WarnContext(ctx, "sender: SendCard non-200", "chat_id", chatID, "status", resp.StatusCode, "body", string(resp.RawBody))
 	} else if resp != nil {
 		var codeErr struct {
 			Code int    `json:"code"`
 			Msg  string `json:"msg"`
 		}
 		if json.Unmarshal(resp.RawBody, &codeErr) == nil && codeErr.Code != 0 {
-			log.Printf("sender: SendCard API error chat=%s code=%d msg=%s", chatID, codeErr.Code, codeErr.Msg)
+			slog.WarnContext(ctx, "sender: SendCard API error", "chat_id", chatID, "code", codeErr.Code, "api_msg", codeErr.Msg)
 		}
 	}
 	return nil
 }
+
+// larkFileType returns the IM file type for fileName: the types Feishu
+// previews by extension, "stream" for anything else.
+func larkFileType(fileName string) string {
+	switch ext := strings.ToLower(filepath.Ext(fileName)); ext {
+	case ".pdf", ".doc", ".xls", ".ppt", ".mp4", ".opus":
+		return ext[1:]
+	case ".docx":
+		return "doc"
+	case ".xlsx", ".csv":
+		return "xls"
+	case ".pptx":
+		return "ppt"
+	}
+	return "stream"
+}
+
+// SendFile uploads data as a file and posts it to the chat.
+func (s *LarkSender) SendFile(ctx context.Context, chatID, fileName string, data []byte) error {
+	req := larkim.NewCreateFileReqBuilder().
+		Body(larkim.NewCreateFileReqBodyBuilder().
+			FileType(larkFileType(fileName)).
+			FileName(fileName).
+			File(bytes.NewReader(data)).
+			Build()).
+		Build()
+	resp, err := s.client.Im.File.Create(ctx, req)
+	if err != nil {
+		slog.WarnContext(ctx, "sender: file upload failed", "chat_id", chatID, "file", fileName, "err", err)
+		return fmt.Errorf("lark API error: %w", err)
+	}
+	if !resp.Success() || resp.Data == nil || resp.Data.FileKey == nil {
+		slog.WarnContext(ctx, "sender: file upload API error", "chat_id", chatID, "file", fileName, "code", resp.Code, "api_msg", resp.Msg)
+		return fmt.Errorf("lark API failed: code=%d msg=%s", resp.Code, resp.Msg)
+	}
+
+	content, _ := json.Marshal(map[string]string{"file_key": *resp.Data.FileKey})
+	body := map[string]interface{}{
+		"receive_id": chatID,
+		"msg_type":   "file",
+		"content":    string(content),
+	}
+	postResp, err := s.client.Post(
+		ctx,
+		"https://open.feishu.cn/open-apis/im/v1/messages?receive_id_type=chat_id",
+		body,
+		larkcore.AccessTokenTypeTenant,
+	)
+	if err != nil {
+		slog.WarnContext(ctx, "sender: SendFile failed", "chat_id", chatID, "err", err)
+		return err
+	}
+	if postResp != nil && postResp.StatusCode != 200 {
+		slog.WarnContext(ctx, "sender: SendFile non-200", "chat_id", chatID, "status", postResp.StatusCode, "body", string(postResp.RawBody))
+	}
+	return nil
+}
+
+// SendImage uploads data as an image and posts it to the chat, where it is
+// shown inline. fileName is only used in logs.
+func (s *LarkSender) SendImage(ctx context.Context, chatID, fileName string, data []byte) error {
+	req := larkim.NewCreateImageReqBuilder().
+		Body(larkim.NewCreateImageReqBodyBuilder().
+			ImageType("message").
+			Image(bytes.NewReader(data)).
+			Build()).
+		Build()
+	resp, err := s.client.Im.Image.Create(ctx, req)
+	if err != nil {
+		slog.WarnContext(ctx, "sender: image upload failed", "chat_id", chatID, "file", fileName, "err", err)
+		return fmt.Errorf("lark API error: %w", err)
+	}
+	if !resp.Success() || resp.Data == nil || resp.Data.ImageKey == nil {
+		slog.WarnContext(ctx, "sender: image upload API error", "chat_id", chatID, "file", fileName, "code", resp.Code, "api_msg", resp.Msg)
+		return fmt.Errorf("lark API failed: code=%d msg=%s", resp.Code, resp.Msg)
+	}
+
+	content, _ := json.Marshal(map[string]string{"image_key": *resp.Data.ImageKey})
+	body := map[string]interface{}{
+		"receive_id": chatID,
+		"msg_type":   "image",
+		"content":    string(content),
+	}
+	postResp, err := s.client.Post(
+		ctx,
+		"https://open.feishu.cn/open-apis/im/v1/messages?receive_id_type=chat_id",
+		body,
+		larkcore.AccessTokenTypeTenant,
+	)
+	if err != nil {
+		slog.WarnContext(ctx, "sender: SendImage failed", "chat_id", chatID, "err", err)
+		return err
+	}
+	if postResp != nil && postResp.StatusCode != 200 {
+		slog.WarnContext(ctx, "sender: SendImage non-200", "chat_id", chatID, "status", postResp.StatusCode, "body", string(postResp.RawBody))
+	}
+	return nil
+}
+
+// AddReaction adds an emoji reaction to a message and returns its ID.
+func (s *LarkSender) AddReaction(ctx context.Context, messageID, emojiType string) (string, error) {
+	req := larkim.NewCreateMessageReactionReqBuilder().
+		MessageId(messageID).
+		Body(larkim.NewCreateMessageReactionReqBodyBuilder().
+			ReactionType(larkim.NewEmojiBuilder().EmojiType(emojiType).Build()).
+			Build()).
+		Build()
+	resp, err := s.client.Im.MessageReaction.Create(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("lark API error: %w", err)
+	}
+	if !resp.Success() || resp.Data == nil || resp.Data.ReactionId == nil {
+		return "", fmt.Errorf("lark API failed: code=%d msg=%s", resp.Code, resp.Msg)
+	}
+	return *resp.Data.ReactionId, nil
+}
+
+// RemoveReaction deletes a reaction added by AddReaction.
+func (s *LarkSender) RemoveReaction(ctx context.Context, messageID, reactionID string) error {
+	req := larkim.NewDeleteMessageReactionReqBuilder().
+		MessageId(messageID).
+		ReactionId(reactionID).
+		Build()
+	resp, err := s.client.Im.MessageReaction.Delete(ctx, req)
+	if err != nil {
+		return fmt.Errorf("lark API error: %w", err)
+	}
+	if !resp.Success() {
+		return fmt.Errorf("lark API failed: code=%d msg=%s", resp.Code, resp.Msg)
+	}
+	return nil
+}
+
+// PinCard posts card to the chat and pins it, returning the message ID.
+func (s *LarkSender) PinCard(ctx context.Context, chatID string, card CardMsg) (string, error) {
+	cardJSON, err := json.Marshal(buildCardBody(card))
+	if err != nil {
+		return "", err
+	}
+	req := larkim.NewCreateMessageReqBuilder().
+		ReceiveIdType("chat_id").
+		Body(larkim.NewCreateMessageReqBodyBuilder().
+			ReceiveId(chatID).
+			MsgType("interactive").
+			Content(string(cardJSON)).
+			Build()).
+		Build()
+	resp, err := s.client.Im.Message.Create(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("lark API error: %w", err)
+	}
+	if !resp.Success() || resp.Data == nil || resp.Data.MessageId == nil {
+		return "", fmt.Errorf("lark API failed: code=%d msg=%s", resp.Code, resp.Msg)
+	}
+	messageID := *resp.Data.MessageId
+	pinReq := larkim.NewCreatePinReqBuilder().
+		Body(larkim.NewCreatePinReqBodyBuilder().MessageId(messageID).Build()).
+		Build()
+	pinResp, err := s.client.Im.Pin.Create(ctx, pinReq)
+	if err != nil {
+		return messageID, fmt.Errorf("lark API error: %w", err)
+	}
+	if !pinResp.Success() {
+		return messageID, fmt.Errorf("lark API failed: code=%d msg=%s", pinResp.Code, pinResp.Msg)
+	}
+	return messageID, nil
+}
+
+// Unpin removes the pin PinCard added.
+func (s *LarkSender) Unpin(ctx context.Context, messageID string) error {
+	resp, err := s.client.Im.Pin.Delete(ctx, larkim.NewDeletePinReqBuilder().MessageId(messageID).Build())
+	if err != nil {
+		return fmt.Errorf("lark API error: %w", err)
+	}
+	if !resp.Success() {
+		return fmt.Errorf("lark API failed: code=%d msg=%s", resp.Code, resp.Msg)
+	}
+	return nil
+}
+
+// RecentMessages reads the last n messages of a chat, oldest first. Mention
+// placeholders are replaced with the mentioned names.
+func (s *LarkSender) RecentMessages(ctx context.Context, chatID string, n int) ([]ChatMessage, error) {
+	var msgs []ChatMessage
+	pageToken := ""
+	for len(msgs) < n {
+		pageSize := n - len(msgs)
+		if pageSize > 50 {
+			pageSize = 50
+		}
+		builder := larkim.NewListMessageReqBuilder().
+			ContainerIdType("chat").
+			ContainerId(chatID).
+			SortType("ByCreateTimeDesc").
+			PageSize(pageSize)
+		if pageToken != "" {
+			builder.PageToken(pageToken)
+		}
+		resp, err := s.client.Im.Message.List(ctx, builder.Build())
+		if err != nil {
+			return nil, fmt.Errorf("lark API error: %w", err)
+		}
+		if !resp.Success() || resp.Data == nil {
+			return nil, fmt.Errorf("lark API failed: code=%d msg=%s", resp.Code, resp.Msg)
+		}
+		for _, m := range resp.Data.Items {
+			if len(msgs) == n {
+				break
+			}
+			if msg, ok := chatMessageFrom(m); ok {
+				msgs = append(msgs, msg.ChatMessage)
+			}
+		}
+		if resp.Data.HasMore == nil || !*resp.Data.HasMore || resp.Data.PageToken == nil {
+			break
+		}
+		pageToken = *resp.Data.PageToken
+	}
+	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	}
+	return msgs, nil
+}
+
+// ForwardedMessages reads the messages held in merged forward messageID,
+// oldest first. Nested merged forwards are left as a placeholder.
+func (s *LarkSender) ForwardedMessages(ctx context.Context, messageID string) ([]ForwardedMessage, error) {
+	resp, err := s.client.Im.Message.Get(ctx, larkim.NewGetMessageReqBuilder().MessageId(messageID).Build())
+	if err != nil {
+		return nil, fmt.Errorf("lark API error: %w", err)
+	}
+	if !resp.Success() || resp.Data == nil {
+		return nil, fmt.Errorf("lark API failed: code=%d msg=%s", resp.Code, resp.Msg)
+	}
+	var msgs []ForwardedMessage
+	for _, m := range resp.Data.Items {
+		// The items hold the merged forward itself and every message
+		// nested in it; keep only its direct children.
+		if m.UpperMessageId == nil || *m.UpperMessageId != messageID {
+			continue
+		}
+		if msg, ok := chatMessageFrom(m); ok {
+			msgs = append(msgs, msg)
+		}
+	}
+	sort.SliceStable(msgs, func(i, j int) bool { return msgs[i].Time.Before(msgs[j].Time) })
+	return msgs, nil
+}
+
+// chatMessageFrom converts a message read from the Lark API, reporting
+// false for deleted or empty ones.
+func chatMessageFrom(m *larkim.Message) (ForwardedMessage, bool) {
+	if m.Deleted != nil && *m.Deleted || m.Body == nil || m.Body.Content == nil || m.MsgType == nil {
+		return ForwardedMessage{}, false
+	}
+	text := messageText(*m.MsgType, *m.Body.Content)
+	for _, mention := range m.Mentions {
+		if mention.Key != nil && mention.Name != nil {
+			text = strings.ReplaceAll(text, *mention.Key, "@"+*mention.Name)
+		}
+	}
+	msg := ForwardedMessage{ChatMessage: ChatMessage{Text: text}, Type: *m.MsgType, Content: *m.Body.Content}
+	if m.MessageId != nil {
+		msg.MessageID = *m.MessageId
+	}
+	if m.Sender != nil {
+		msg.FromBot = m.Sender.SenderType != nil && *m.Sender.SenderType == "app"
+		if m.Sender.Id != nil {
+			msg.SenderID = *m.Sender.Id
+		}
+	}
+	if m.CreateTime != nil {
+		if ms, err := strconv.ParseInt(*m.CreateTime, 10, 64); err == nil {
+			msg.Time = time.UnixMilli(ms)
+		}
+	}
+	return msg, true
+}
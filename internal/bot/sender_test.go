@@ -139,3 +139,42 @@ func TestSplitMessage(t *testing.T) {
 		t.Fatalf("expected single chunk, got: %v", chunks)
 	}
 }
+
+func TestBuildCardBody_Buttons(t *testing.T) {
+	card := CardMsg{Content: "delete?", Buttons: []CardButton{{Text: "允许", Command: "/confirm", Type: "danger"}, {Text: "拒绝", Command: "/deny"}}}
+	data, _ := json.Marshal(buildCardBody(card))
+	jsonStr := string(data)
+	for _, want := range []string{`"tag":"action"`, `"type":"danger"`, `"type":"default"`, `"value":{"command":"/confirm"}`, `"value":{"command":"/deny"}`} {
+		if !strings.Contains(jsonStr, want) {
+			t.Fatalf("expected %s in card, got: %s", want, jsonStr)
+		}
+	}
+}
+
+func TestBuildCardBody_Details(t *testing.T) {
+	card := CardMsg{Content: "failed", Details: &CardDetails{Title: "环境信息", Content: "- **go**: go1.22"}}
+	data, _ := json.Marshal(buildCardBody(card))
+	jsonStr := string(data)
+	for _, want := range []string{`"tag":"collapsible_panel"`, `"expanded":false`, `"content":"环境信息"`, `"content":"- **go**: go1.22"`} {
+		if !strings.Contains(jsonStr, want) {
+			t.Fatalf("expected %s in card, got: %s", want, jsonStr)
+		}
+	}
+}
+
+func TestLarkFileType(t *testing.T) {
+	cases := map[string]string{
+		"report.PDF":  "pdf",
+		"notes.docx":  "doc",
+		"data.csv":    "xls",
+		"slides.pptx": "ppt",
+		"demo.mp4":    "mp4",
+		"app.zip":     "stream",
+		"Makefile":    "stream",
+	}
+	for name, want := range cases {
+		if got := larkFileType(name); got != want {
+			t.Errorf("larkFileType(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// maxSummaryPrompts bounds how many of a session's prompts go into its
+// summary request.
+const maxSummaryPrompts = 10
+
+// SetSessionSummaryModel sets the model used to summarize sessions archived
+// by /new; "" disables summaries.
+func (r *Router) SetSessionSummaryModel(model string) {
+	r.summaryModel = model
+}
+
+// summaryPrompt asks for a one-paragraph summary of a session from its
+// prompts (oldest first) and last output. It returns "" when there is
+// nothing to summarize.
+func summaryPrompt(prompts []string, lastOutput string) string {
+	if len(prompts) == 0 && strings.TrimSpace(lastOutput) == "" {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("Summarize in one short paragraph (at most 2 sentences, same language as the requests) what was accomplished in this coding session, so it can be recognized later in a session list. Reply with the summary only.\n")
+	if len(prompts) > 0 {
+		sb.WriteString("\nRequests:\n")
+		for _, p := range prompts {
+			fmt.Fprintf(&sb, "- %s\n", truncateRunes(strings.Join(strings.Fields(p), " "), 300))
+		}
+	}
+	if lastOutput != "" {
+		sb.WriteString("\nFinal response:\n")
+		sb.WriteString(truncateForDisplay(lastOutput, 4000))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// sessionPrompts returns the prompts recorded for a session, oldest first.
+func (r *Router) sessionPrompts(chatID, sessionID string) []string {
+	var prompts []string
+	for _, rec := range r.store.ExecRecords(chatID, 0) { // newest first
+		if rec.SessionID == sessionID && len(prompts) < maxSummaryPrompts {
+			prompts = append([]string{rec.Prompt}, prompts...)
+		}
+	}
+	return prompts
+}
+
+// summarizeSession generates a summary of an archived session in the
+// background and stores it with the session. It is a no-op unless a
+// summary model is configured.
+func (r *Router) summarizeSession(chatID, sessionID, workDir, lastOutput string) {
+	if r.summaryModel == "" || sessionID == "" {
+		return
+	}
+	prompt := summaryPrompt(r.sessionPrompts(chatID, sessionID), lastOutput)
+	if prompt == "" {
+		return
+	}
+	run := func() { r.runSessionSummary(r.ctx, chatID, sessionID, workDir, prompt) }
+	if r.queue == nil {
+		go run()
+		return
+	}
+	if _, err := r.queue.EnqueueTask(chatID, QueueEntry{ID: newExecID()}, run); err != nil {
+		slog.Warn("router: session summary not queued", "chat_id", chatID, "err", err)
+	}
+}
+
+// runSessionSummary asks the summary model, in a fresh session and safe
+// mode, to summarize the session and stores the result.
+func (r *Router) runSessionSummary(ctx context.Context, chatID, sessionID, workDir, prompt string) {
+	start := time.Now()
+	result, err := r.executor.ExecStream(ctx, prompt, workDir, "", "safe", r.summaryModel, nil)
+	if err != nil {
+		slog.WarnContext(ctx, "router: session summary failed", "chat_id", chatID, "session_id", sessionID, "err", err)
+		return
+	}
+	summary := truncateRunes(strings.Join(strings.Fields(result.Output), " "), 300)
+	if summary == "" {
+		return
+	}
+	r.store.UpdateSession(chatID, func(s *Session) {
+		if s.Summaries == nil {
+			s.Summaries = make(map[string]string)
+		}
+		s.Summaries[sessionID] = summary
+	})
+	r.save()
+	slog.InfoContext(ctx, "router: summarized session", "session_id", sessionID, "chat_id", chatID, "elapsed", time.Since(start).Truncate(time.Millisecond))
+}
@@ -0,0 +1,83 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummaryPrompt(t *testing.T) {
+	if got := summaryPrompt(nil, " \n"); got != "" {
+		t.Fatalf("expected empty prompt, got %q", got)
+	}
+	got := summaryPrompt([]string{"fix the\nlogin bug", "add tests"}, "All tests pass.")
+	for _, want := range []string{"- fix the login bug\n", "- add tests\n", "Final response:\nAll tests pass."} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in prompt, got %q", want, got)
+		}
+	}
+}
+
+// newSummaryRouter returns a router whose claude prints a fixed summary and
+// records its arguments in args.
+func newSummaryRouter(t *testing.T) (r *Router, sender *syncSpySender, args string) {
+	t.Helper()
+	dir := t.TempDir()
+	args = filepath.Join(dir, "args")
+	script := fmt.Sprintf(`#!/bin/sh
+echo "$@" "$(cat)" > %s
+printf '%%s\n' '{"type":"result","result":"修复了登录页的\n空指针问题。","session_id":"s-summary"}'
+`, args)
+	claude := filepath.Join(dir, "claude")
+	os.WriteFile(claude, []byte(script), 0755)
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	sender = &syncSpySender{}
+	r = NewRouter(context.Background(), NewClaudeExecutor(claude, "sonnet", 10*time.Second), store, sender, map[string]bool{"user1": true}, dir, nil)
+	r.getSession("chat1")
+	r.store.UpdateSession("chat1", func(s *Session) {
+		s.ClaudeSessionID = "s-old"
+		s.LastOutput = "Fixed the nil pointer on the login page."
+	})
+	r.store.AddExecRecord(ExecRecord{ID: "e1", ChatID: "chat1", Prompt: "fix login crash", SessionID: "s-old", StartedAt: time.Now()})
+	return r, sender, args
+}
+
+func TestRouterNewSession_Summary(t *testing.T) {
+	r, sender, args := newSummaryRouter(t)
+	r.SetSessionSummaryModel("haiku")
+
+	r.Route(context.Background(), "chat1", "user1", "/new")
+	waitFor(t, func() bool { return r.getSession("chat1").Summaries["s-old"] != "" })
+	if got := r.getSession("chat1").Summaries["s-old"]; got != "修复了登录页的 空指针问题。" {
+		t.Fatalf("unexpected summary %q", got)
+	}
+	data, _ := os.ReadFile(args)
+	if !strings.Contains(string(data), "--model haiku") || strings.Contains(string(data), "--resume") || !strings.Contains(string(data), "fix login crash") {
+		t.Fatalf("unexpected claude args %q", data)
+	}
+	if s := r.getSession("chat1"); s.ClaudeSessionID != "" {
+		t.Fatalf("expected summary run not to become the session, got %q", s.ClaudeSessionID)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/sessions")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "s-old") || !strings.Contains(msg, "修复了登录页的 空指针问题。") {
+		t.Fatalf("expected summary in /sessions, got %q", msg)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/switch")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "**0.** 修复了登录页的") {
+		t.Fatalf("expected summary in picker, got %q", msg)
+	}
+}
+
+func TestRouterNewSession_NoSummaryModel(t *testing.T) {
+	r, _, args := newSummaryRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/new")
+	time.Sleep(200 * time.Millisecond)
+	if fileExists(args) || len(r.getSession("chat1").Summaries) != 0 {
+		t.Fatal("expected no summary without a summary model")
+	}
+}
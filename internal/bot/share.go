@@ -0,0 +1,343 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultShareExpiry is how long shared results stay up by default.
+	defaultShareExpiry = 7 * 24 * time.Hour
+	// shareTimeout bounds each request to the paste service.
+	shareTimeout = 30 * time.Second
+	// maxShareBytes caps the size of one upload.
+	maxShareBytes = 1 << 20
+	// shareTokenSecret names the secret holding the GitHub token for gists.
+	shareTokenSecret = "share_token"
+	// defaultGistAPI is the GitHub API used for gists unless share_url is set.
+	defaultGistAPI = "https://api.github.com"
+)
+
+// SetShareConfig sets where /share uploads results: provider is "gist"
+// (GitHub Gist, url overriding the API base for GitHub Enterprise) or
+// "paste" (a 0x0.st-compatible service at url). An empty provider disables
+// /share; expiry <= 0 uses the default.
+func (r *Router) SetShareConfig(provider, url string, expiry time.Duration) {
+	if expiry <= 0 {
+		expiry = defaultShareExpiry
+	}
+	r.shareProvider = provider
+	r.shareURL = strings.TrimRight(url, "/")
+	r.shareExpiry = expiry
+}
+
+// StartShareExpiry deletes expired gists now and then hourly until ctx is
+// done. Paste services expire uploads themselves; their records are just
+// dropped.
+func (r *Router) StartShareExpiry(ctx context.Context) {
+	if r.shareProvider == "" {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			r.expireShares(ctx, time.Now())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (r *Router) expireShares(ctx context.Context, now time.Time) {
+	removed := false
+	for _, sh := range r.store.Shares("") {
+		if now.Before(sh.ExpiresAt) {
+			continue
+		}
+		if sh.Provider == "gist" {
+			if err := r.deleteShare(ctx, sh); err != nil {
+				slog.Warn("share: delete expired failed", "url", sh.URL, "err", err)
+				continue
+			}
+		}
+		r.store.RemoveShare(sh.ID)
+		removed = true
+	}
+	if removed {
+		r.save()
+	}
+}
+
+// shareDocument renders what /share uploads: the last result of the chat,
+// one execution by ID, or with "all" every execution of the current
+// session.
+func (r *Router) shareDocument(chatID, arg string) (string, string, error) {
+	var recs []ExecRecord
+	var title string
+	switch arg {
+	case "":
+		recs = r.store.ExecRecords(chatID, 1)
+		if len(recs) == 0 {
+			return "", "", errors.New("还没有可分享的执行结果")
+		}
+		title = truncateRunes(strings.Join(strings.Fields(recs[0].Prompt), " "), 60)
+	case "all":
+		session := r.getSession(chatID)
+		if session.ClaudeSessionID == "" {
+			return "", "", errors.New("当前没有会话，无法导出完整记录")
+		}
+		for _, rec := range r.store.ExecRecords(chatID, 0) {
+			if rec.SessionID == session.ClaudeSessionID {
+				recs = append([]ExecRecord{rec}, recs...)
+			}
+		}
+		if len(recs) == 0 {
+			return "", "", errors.New("当前会话还没有执行记录")
+		}
+		title = fmt.Sprintf("会话 %s（%d 轮）", shortHash(session.ClaudeSessionID), len(recs))
+	default:
+		rec, ok := r.store.ExecRecord(arg)
+		if !ok || rec.ChatID != chatID {
+			return "", "", fmt.Errorf("找不到执行记录: %s", arg)
+		}
+		recs = []ExecRecord{rec}
+		title = truncateRunes(strings.Join(strings.Fields(rec.Prompt), " "), 60)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# devbot: %s\n\n", title)
+	fmt.Fprintf(&sb, "导出时间: %s", time.Now().Format("2006-01-02 15:04"))
+	if dir := recs[0].WorkDir; dir != "" {
+		fmt.Fprintf(&sb, " · 项目: %s", filepath.Base(dir))
+	}
+	sb.WriteString("\n")
+	for _, rec := range recs {
+		fmt.Fprintf(&sb, "\n---\n\n## %s · %s\n\n", rec.StartedAt.Format("2006-01-02 15:04"), rec.ID)
+		fmt.Fprintf(&sb, "**Prompt**\n\n%s\n\n", strings.TrimSpace(rec.Prompt))
+		if rec.Error != "" {
+			fmt.Fprintf(&sb, "**错误**\n\n%s\n\n", strings.TrimSpace(rec.Error))
+		}
+		if out := strings.TrimSpace(rec.Output); out != "" {
+			fmt.Fprintf(&sb, "**输出**\n\n%s\n", out)
+		}
+	}
+	doc := r.secrets.Redact(sb.String())
+	if len(doc) > maxShareBytes {
+		doc = truncateRunes(doc, maxShareBytes/4) + "\n\n...（内容过长，已截断）\n"
+	}
+	return title, doc, nil
+}
+
+// uploadShare sends doc to the paste provider and returns its URL and the
+// reference needed to delete it.
+func (r *Router) uploadShare(ctx context.Context, name, title, doc string) (string, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, shareTimeout)
+	defer cancel()
+	switch r.shareProvider {
+	case "gist":
+		token, ok := r.secrets.Get(shareTokenSecret)
+		if !ok {
+			return "", "", fmt.Errorf("未配置 %s 密钥（GitHub token，需要 gist 权限）", shareTokenSecret)
+		}
+		body, _ := json.Marshal(map[string]interface{}{
+			"description": "devbot: " + title,
+			"public":      false,
+			"files":       map[string]interface{}{name: map[string]string{"content": doc}},
+		})
+		base := r.shareURL
+		if base == "" {
+			base = defaultGistAPI
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/gists", bytes.NewReader(body))
+		if err != nil {
+			return "", "", err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("Content-Type", "application/json")
+		data, _, err := doShareRequest(req)
+		if err != nil {
+			return "", "", err
+		}
+		var gist struct {
+			ID      string `json:"id"`
+			HTMLURL string `json:"html_url"`
+		}
+		if err := json.Unmarshal(data, &gist); err != nil || gist.HTMLURL == "" {
+			return "", "", fmt.Errorf("无法解析 Gist 响应: %s", truncateRunes(string(data), 200))
+		}
+		return gist.HTMLURL, gist.ID, nil
+	case "paste":
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("file", name)
+		io.WriteString(fw, doc)
+		mw.WriteField("expires", fmt.Sprint(int(r.shareExpiry.Hours())))
+		mw.WriteField("secret", "")
+		mw.Close()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.shareURL, &body)
+		if err != nil {
+			return "", "", err
+		}
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		data, header, err := doShareRequest(req)
+		if err != nil {
+			return "", "", err
+		}
+		link := strings.TrimSpace(string(data))
+		if u, err := url.Parse(link); err != nil || u.Scheme == "" {
+			return "", "", fmt.Errorf("无法解析上传结果: %s", truncateRunes(link, 200))
+		}
+		return link, header.Get("X-Token"), nil
+	}
+	return "", "", errors.New("未配置分享服务（share_provider）")
+}
+
+// deleteShare takes sh down from its paste service.
+func (r *Router) deleteShare(ctx context.Context, sh Share) error {
+	if sh.Ref == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, shareTimeout)
+	defer cancel()
+	var req *http.Request
+	var err error
+	if sh.Provider == "gist" {
+		token, ok := r.secrets.Get(shareTokenSecret)
+		if !ok {
+			return fmt.Errorf("未配置 %s 密钥", shareTokenSecret)
+		}
+		base := r.shareURL
+		if base == "" {
+			base = defaultGistAPI
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodDelete, base+"/gists/"+url.PathEscape(sh.Ref), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Accept", "application/vnd.github+json")
+	} else {
+		form := url.Values{"token": {sh.Ref}, "delete": {""}}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, sh.URL, strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	_, _, err = doShareRequest(req)
+	var status shareStatusError
+	if errors.As(err, &status) && status == http.StatusNotFound {
+		return nil // already gone
+	}
+	return err
+}
+
+// shareStatusError is an unexpected HTTP status from the paste service.
+type shareStatusError int
+
+func (e shareStatusError) Error() string {
+	return fmt.Sprintf("HTTP %d", int(e))
+}
+
+func doShareRequest(req *http.Request) ([]byte, http.Header, error) {
+	req.Header.Set("User-Agent", "devbot")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return data, resp.Header, fmt.Errorf("%w: %s", shareStatusError(resp.StatusCode), truncateRunes(strings.TrimSpace(string(data)), 200))
+	}
+	return data, resp.Header, nil
+}
+
+func (r *Router) cmdShare(ctx context.Context, chatID, args string) {
+	if r.shareProvider == "" {
+		r.sender.SendText(ctx, chatID, "未配置分享服务，请在配置中设置 share_provider（gist 或 paste）。")
+		return
+	}
+	fields := strings.Fields(args)
+	if len(fields) > 0 && fields[0] == "list" {
+		shares := r.store.Shares(chatID)
+		if len(shares) == 0 {
+			r.sender.SendText(ctx, chatID, "当前聊天没有有效的分享。")
+			return
+		}
+		var sb strings.Builder
+		for _, sh := range shares {
+			fmt.Fprintf(&sb, "- `%s` %s\n  %s（%s 过期）\n", sh.ID, sh.Title, sh.URL, sh.ExpiresAt.Format("01-02 15:04"))
+		}
+		sb.WriteString("\n`/share rm <ID>` 提前删除")
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("分享（%d）", len(shares)), Content: sb.String()})
+		return
+	}
+	if len(fields) > 0 && fields[0] == "rm" {
+		if len(fields) < 2 {
+			r.sender.SendText(ctx, chatID, "用法: /share rm <ID>")
+			return
+		}
+		for _, sh := range r.store.Shares(chatID) {
+			if sh.ID != fields[1] {
+				continue
+			}
+			if err := r.deleteShare(ctx, sh); err != nil {
+				r.sender.SendText(ctx, chatID, fmt.Sprintf("删除失败: %v", err))
+				return
+			}
+			r.store.RemoveShare(sh.ID)
+			r.save()
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已删除分享 %s", sh.URL))
+			return
+		}
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("找不到分享: %s", fields[1]))
+		return
+	}
+	if len(fields) > 1 {
+		r.sender.SendText(ctx, chatID, "用法: /share [all|<执行ID>|list|rm <ID>]")
+		return
+	}
+
+	arg := ""
+	if len(fields) == 1 {
+		arg = fields[0]
+	}
+	title, doc, err := r.shareDocument(chatID, arg)
+	if err != nil {
+		r.sender.SendText(ctx, chatID, err.Error())
+		return
+	}
+	id := newExecID()
+	link, ref, err := r.uploadShare(ctx, "devbot-"+id+".md", title, doc)
+	if err != nil {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "分享失败", Content: err.Error(), Template: "red"})
+		return
+	}
+	now := time.Now()
+	sh := Share{ID: id, ChatID: chatID, Provider: r.shareProvider, URL: link, Ref: ref, Title: title, CreatedAt: now, ExpiresAt: now.Add(r.shareExpiry)}
+	r.store.AddShare(sh)
+	r.save()
+	slog.InfoContext(ctx, "share: uploaded", "chat_id", chatID, "share", id, "url", link)
+	r.sender.SendCard(ctx, chatID, CardMsg{
+		Title:    "🔗 已分享",
+		Content:  fmt.Sprintf("%s\n\n**内容:** %s（%s）\n**过期:** %s\n\n任何拿到链接的人都能查看；已隐藏配置文件中的密钥。`/share rm %s` 提前删除。", link, title, formatSize(int64(len(doc))), sh.ExpiresAt.Format("2006-01-02 15:04"), id),
+		Template: "green",
+	})
+}
@@ -0,0 +1,170 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newShareRouter returns a router with a few execution records and a
+// secrets file holding share_token and a database password.
+func newShareRouter(t *testing.T) (*Router, *spySender) {
+	t.Helper()
+	r, sender := newTestRouter(t)
+	path := filepath.Join(t.TempDir(), "secrets.yaml")
+	os.WriteFile(path, []byte("share_token: gh-token\ndb_password: hunter22\n"), 0600)
+	secrets, err := LoadSecrets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetSecrets(secrets)
+	r.getSession("chat1")
+	r.store.UpdateSession("chat1", func(s *Session) { s.ClaudeSessionID = "sess-2" })
+	start := time.Date(2026, 10, 1, 9, 0, 0, 0, time.Local)
+	r.store.AddExecRecord(ExecRecord{ID: "e1", ChatID: "chat1", SessionID: "sess-1", Prompt: "old", Output: "old out", StartedAt: start})
+	r.store.AddExecRecord(ExecRecord{ID: "e2", ChatID: "chat1", SessionID: "sess-2", Prompt: "connect to db", Output: "used hunter22", WorkDir: "/src/api", StartedAt: start.Add(time.Minute)})
+	r.store.AddExecRecord(ExecRecord{ID: "e3", ChatID: "chat2", SessionID: "x", Prompt: "other chat", StartedAt: start})
+	r.store.AddExecRecord(ExecRecord{ID: "e4", ChatID: "chat1", SessionID: "sess-2", Prompt: "and now?", Error: "timeout", StartedAt: start.Add(2 * time.Minute)})
+	return r, sender
+}
+
+func TestShareDocument(t *testing.T) {
+	r, _ := newShareRouter(t)
+
+	title, doc, err := r.shareDocument("chat1", "")
+	if err != nil || title != "and now?" || !strings.Contains(doc, "**错误**\n\ntimeout") || strings.Contains(doc, "connect to db") {
+		t.Fatalf("unexpected last result %q %q %v", title, doc, err)
+	}
+	title, doc, err = r.shareDocument("chat1", "all")
+	if err != nil || !strings.Contains(title, "2 轮") || strings.Contains(doc, "old out") {
+		t.Fatalf("unexpected transcript %q %q %v", title, doc, err)
+	}
+	if i, j := strings.Index(doc, "connect to db"), strings.Index(doc, "and now?"); i < 0 || j < i {
+		t.Fatalf("expected oldest first, got %q", doc)
+	}
+	if strings.Contains(doc, "hunter22") || !strings.Contains(doc, "used [已隐藏]") || !strings.Contains(doc, "项目: api") {
+		t.Fatalf("expected secrets redacted, got %q", doc)
+	}
+	if _, doc, err := r.shareDocument("chat1", "e1"); err != nil || !strings.Contains(doc, "old out") {
+		t.Fatalf("unexpected record share %q %v", doc, err)
+	}
+	if _, _, err := r.shareDocument("chat1", "e3"); err == nil {
+		t.Fatal("expected another chat's record to be refused")
+	}
+	if _, _, err := r.shareDocument("chat9", ""); err == nil {
+		t.Fatal("expected error without records")
+	}
+}
+
+func TestRouterSharePaste(t *testing.T) {
+	var mu sync.Mutex
+	var deleted []string
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if req.URL.Path == "/abc.md" {
+			req.ParseForm()
+			if _, ok := req.PostForm["delete"]; ok {
+				deleted = append(deleted, req.PostForm.Get("token"))
+			}
+			return
+		}
+		file, header, err := req.FormFile("file")
+		if err != nil || req.FormValue("expires") != "48" || !strings.HasSuffix(header.Filename, ".md") {
+			http.Error(w, "bad upload", http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		if !strings.Contains(string(data), "and now?") {
+			http.Error(w, "wrong content", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("X-Token", "tok1")
+		io.WriteString(w, srv.URL+"/abc.md\n")
+	}))
+	defer srv.Close()
+
+	r, sender := newShareRouter(t)
+	ctx := context.Background()
+	r.Route(ctx, "chat1", "user1", "/share")
+	if !strings.Contains(sender.LastMessage(), "未配置分享服务") {
+		t.Fatalf("expected disabled message, got %q", sender.LastMessage())
+	}
+
+	r.SetShareConfig("paste", srv.URL, 48*time.Hour)
+	r.Route(ctx, "chat1", "user1", "/share")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "已分享") || !strings.Contains(msg, srv.URL+"/abc.md") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	shares := r.store.Shares("chat1")
+	if len(shares) != 1 || shares[0].Ref != "tok1" || shares[0].ExpiresAt.Sub(shares[0].CreatedAt) != 48*time.Hour {
+		t.Fatalf("unexpected shares %+v", shares)
+	}
+	r.Route(ctx, "chat1", "user1", "/share list")
+	if !strings.Contains(sender.LastMessage(), shares[0].ID) {
+		t.Fatalf("unexpected list %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "user1", "/share rm "+shares[0].ID)
+	if len(deleted) != 1 || deleted[0] != "tok1" || len(r.store.Shares("chat1")) != 0 {
+		t.Fatalf("expected paste deleted, got %v", deleted)
+	}
+}
+
+func TestRouterShareGist(t *testing.T) {
+	var mu sync.Mutex
+	var deleted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if req.Header.Get("Authorization") != "Bearer gh-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if req.Method == http.MethodDelete {
+			deleted = append(deleted, strings.TrimPrefix(req.URL.Path, "/gists/"))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		var body struct {
+			Public bool                         `json:"public"`
+			Files  map[string]map[string]string `json:"files"`
+		}
+		json.NewDecoder(req.Body).Decode(&body)
+		if req.URL.Path != "/gists" || body.Public || len(body.Files) != 1 {
+			http.Error(w, "bad gist", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"id":"g1","html_url":"https://gist.example.com/g1"}`)
+	}))
+	defer srv.Close()
+
+	r, sender := newShareRouter(t)
+	r.SetShareConfig("gist", srv.URL, 0)
+	r.Route(context.Background(), "chat1", "user1", "/share all")
+	if !strings.Contains(sender.LastMessage(), "https://gist.example.com/g1") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+	sh := r.store.Shares("chat1")[0]
+	if sh.Ref != "g1" || sh.ExpiresAt.Sub(sh.CreatedAt) != defaultShareExpiry {
+		t.Fatalf("unexpected share %+v", sh)
+	}
+
+	r.expireShares(context.Background(), time.Now())
+	if len(deleted) != 0 {
+		t.Fatal("expected unexpired gist to stay")
+	}
+	r.expireShares(context.Background(), sh.ExpiresAt.Add(time.Minute))
+	if len(deleted) != 1 || deleted[0] != "g1" || len(r.store.Shares("")) != 0 {
+		t.Fatalf("expected expired gist deleted, got %v", deleted)
+	}
+}
@@ -0,0 +1,229 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// shellIdleTimeout ends a /shell session nobody has typed into for this
+// long.
+const shellIdleTimeout = 30 * time.Minute
+
+// shellBatchInterval is how often a /shell session sends the output
+// collected since the last update.
+var shellBatchInterval = 2 * time.Second
+
+// shellSession is a running /shell: a shell on a pty fed by "> " messages.
+type shellSession struct {
+	cmd     *exec.Cmd
+	pty     *os.File
+	dir     string
+	started time.Time
+
+	mu       sync.Mutex
+	lastUsed time.Time
+	stopped  bool // ended by /shell stop
+}
+
+// shellInputs maps whole-line inputs to the control characters they stand
+// for, since chats cannot send them.
+var shellInputs = map[string]string{"^C": "\x03", "^D": "\x04", "^Z": "\x1a"}
+
+func (r *Router) cmdShell(ctx context.Context, chatID, args string) {
+	switch args {
+	case "start":
+		r.startShell(ctx, chatID)
+	case "stop":
+		if !r.stopShell(chatID) {
+			r.sender.SendText(ctx, chatID, "当前没有运行中的 shell。")
+		}
+	case "", "status":
+		r.mu.Lock()
+		sh := r.shells[chatID]
+		r.mu.Unlock()
+		if sh == nil {
+			r.sender.SendText(ctx, chatID, "当前没有运行中的 shell。/shell start 启动，之后以 > 开头的消息会作为输入发送给它。")
+			return
+		}
+		sh.mu.Lock()
+		idle := time.Since(sh.lastUsed).Round(time.Second)
+		sh.mu.Unlock()
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("shell 运行中（pid %d，目录 %s），已运行 %s，空闲 %s。", sh.cmd.Process.Pid, sh.dir, time.Since(sh.started).Round(time.Second), idle))
+	default:
+		r.sender.SendText(ctx, chatID, "用法: /shell start | stop | status\n启动后以 > 开头的消息作为输入发送（如 > ls -la），> ^C 发送中断，> ^D 发送 EOF；输出每 2 秒汇总发送一次，空闲 30 分钟自动结束。")
+	}
+}
+
+// startShell starts a shell on a pty in the chat's workdir.
+func (r *Router) startShell(ctx context.Context, chatID string) {
+	if r.hasShell(chatID) {
+		r.sender.SendText(ctx, chatID, "shell 已在运行，/shell stop 结束后再启动。")
+		return
+	}
+
+	dir := r.getSession(chatID).WorkDir
+	if name, ok := r.shellTouchesReferenceDir(dir, ""); ok {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("当前目录在只读参考目录 %s 中，不能启动 shell。", name))
+		return
+	}
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	cmd := exec.Command(shell)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "TERM=dumb", "PAGER=cat", "GIT_PAGER=cat")
+	pty, err := startPty(cmd)
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("启动 shell 失败: %v", err))
+		return
+	}
+	now := time.Now()
+	sh := &shellSession{cmd: cmd, pty: pty, dir: dir, started: now, lastUsed: now}
+	r.mu.Lock()
+	r.shells[chatID] = sh
+	r.mu.Unlock()
+
+	var mu sync.Mutex
+	var pending strings.Builder
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		buf := make([]byte, 4096)
+		for {
+			n, err := pty.Read(buf)
+			if n > 0 {
+				mu.Lock()
+				pending.Write(buf[:n])
+				mu.Unlock()
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	exited := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		// Reads on the master fail once the last slave is closed, but
+		// background jobs may keep it open; give them a moment.
+		select {
+		case <-readDone:
+		case <-time.After(time.Second):
+		}
+		pty.Close()
+		exited <- err
+	}()
+
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("已在 %s 启动 %s（pid %d）。以 > 开头的消息作为输入，/shell stop 结束。", dir, shell, cmd.Process.Pid))
+	go func() {
+		ticker := time.NewTicker(shellBatchInterval)
+		defer ticker.Stop()
+		flush := func() {
+			mu.Lock()
+			out := pending.String()
+			pending.Reset()
+			mu.Unlock()
+			out = strings.Trim(cleanTerminal(out), "\n")
+			if strings.TrimSpace(out) == "" {
+				return
+			}
+			r.sender.SendCard(r.ctx, chatID, CardMsg{Content: "```\n" + truncateTail(out, 3000) + "\n```"})
+		}
+		var reason string
+	loop:
+		for {
+			select {
+			case <-ticker.C:
+				flush()
+				sh.mu.Lock()
+				idle := time.Since(sh.lastUsed)
+				sh.mu.Unlock()
+				if idle > shellIdleTimeout {
+					reason = fmt.Sprintf("空闲超过 %s，", shellIdleTimeout)
+					sh.kill()
+				}
+			case err := <-exited:
+				<-readDone
+				flush()
+				if reason == "" {
+					reason = "进程已退出，"
+					if sh.cmd.ProcessState != nil {
+						reason = fmt.Sprintf("进程已退出（退出码 %d），", sh.cmd.ProcessState.ExitCode())
+					} else if err != nil {
+						reason = fmt.Sprintf("进程出错（%v），", err)
+					}
+				}
+				break loop
+			case <-r.ctx.Done():
+				sh.kill()
+				return
+			}
+		}
+		r.mu.Lock()
+		if r.shells[chatID] == sh {
+			delete(r.shells, chatID)
+		}
+		r.mu.Unlock()
+		sh.mu.Lock()
+		if sh.stopped {
+			reason = ""
+		}
+		sh.mu.Unlock()
+		r.sender.SendText(r.ctx, chatID, reason+"shell 已结束。")
+	}()
+}
+
+// stopShell kills the chat's shell, reporting whether one was running.
+func (r *Router) stopShell(chatID string) bool {
+	r.mu.Lock()
+	sh := r.shells[chatID]
+	r.mu.Unlock()
+	if sh == nil {
+		return false
+	}
+	sh.mu.Lock()
+	sh.stopped = true
+	sh.mu.Unlock()
+	sh.kill()
+	return true
+}
+
+// hasShell reports whether the chat has a running /shell.
+func (r *Router) hasShell(chatID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.shells[chatID] != nil
+}
+
+// shellInput feeds a "> " message to the chat's shell.
+func (r *Router) shellInput(ctx context.Context, chatID, text string) {
+	r.mu.Lock()
+	sh := r.shells[chatID]
+	r.mu.Unlock()
+	if sh == nil {
+		r.sender.SendText(ctx, chatID, "shell 已结束。")
+		return
+	}
+	line := strings.TrimPrefix(strings.TrimPrefix(text, ">"), " ")
+	if name, ok := r.shellTouchesReferenceDir("", line); ok {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("输入涉及只读参考目录 %s，未发送给 shell。", name))
+		return
+	}
+	input, ok := shellInputs[strings.TrimSpace(line)]
+	if !ok {
+		input = line + "\n"
+	}
+	sh.mu.Lock()
+	sh.lastUsed = time.Now()
+	sh.mu.Unlock()
+	if _, err := io.WriteString(sh.pty, input); err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("写入 shell 失败: %v", err))
+	}
+}
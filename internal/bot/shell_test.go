@@ -0,0 +1,80 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitForMessage waits until a message sent to sender contains want.
+func waitForMessage(t *testing.T, sender *syncSpySender, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, m := range sender.Messages() {
+			if strings.Contains(m, want) {
+				return
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("no message containing %q in %q", want, sender.Messages())
+}
+
+func TestRouterShell(t *testing.T) {
+	interval := shellBatchInterval
+	shellBatchInterval = 50 * time.Millisecond
+	t.Cleanup(func() { shellBatchInterval = interval })
+	t.Setenv("SHELL", "/bin/sh")
+
+	r, sender, _ := newTestRouterForExec(t)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "/shell start")
+	waitForMessage(t, sender, "启动 /bin/sh")
+	r.Route(ctx, "chat1", "user1", "/shell start")
+	waitForMessage(t, sender, "shell 已在运行")
+
+	// State survives between messages, unlike /exec.
+	r.Route(ctx, "chat1", "user1", "> X=6")
+	r.Route(ctx, "chat1", "user1", "> echo answer-$((X*7))")
+	waitForMessage(t, sender, "answer-42")
+
+	r.Route(ctx, "chat1", "user1", "/shell stop")
+	waitForMessage(t, sender, "shell 已结束。")
+	if r.hasShell("chat1") {
+		t.Fatal("shell still registered after /shell stop")
+	}
+	for _, m := range sender.Messages() {
+		if strings.Contains(m, "进程已退出") {
+			t.Fatalf("stopped shell reported as exited: %q", m)
+		}
+	}
+}
+
+func TestRouterShell_Exit(t *testing.T) {
+	interval := shellBatchInterval
+	shellBatchInterval = 50 * time.Millisecond
+	t.Cleanup(func() { shellBatchInterval = interval })
+	t.Setenv("SHELL", "/bin/sh")
+
+	r, sender, _ := newTestRouterForExec(t)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "/shell start")
+	r.Route(ctx, "chat1", "user1", "> exit 3")
+	waitForMessage(t, sender, "进程已退出（退出码 3），shell 已结束。")
+	if r.hasShell("chat1") {
+		t.Fatal("shell still registered after exit")
+	}
+}
+
+func TestRouterShell_Roles(t *testing.T) {
+	r, sender := newRolesRouter(t)
+	r.SetAdmins(map[string]bool{"admin": true})
+	r.Route(context.Background(), "chat1", "op", "/shell start")
+	if msg := sender.LastMessage(); msg != "/shell 仅限管理员使用（admin_user_ids）。" {
+		t.Fatalf("operator /shell start = %q", msg)
+	}
+}
@@ -0,0 +1,296 @@
+package bot
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultPruneDays is how old execution records and the /doc sync log must
+// be before `devbot state prune` removes them.
+const defaultPruneDays = 90
+
+// StateProblem is an inconsistency in the state file that
+// `devbot state repair` can fix.
+type StateProblem struct {
+	Kind   string
+	Detail string
+	fix    func(*State)
+}
+
+// FindStateProblems reports doc bindings to deleted files, sessions and
+// per-directory Claude sessions in deleted directories, and watches, hooks
+// and per-repository settings of deleted directories.
+func FindStateProblems(st *State) []StateProblem {
+	missing := func(path string) bool {
+		_, err := os.Stat(path)
+		return path != "" && os.IsNotExist(err)
+	}
+	var problems []StateProblem
+	for _, path := range sortedKeys(st.DocBindings) {
+		if missing(path) {
+			path := path
+			problems = append(problems, StateProblem{
+				Kind:   "文档绑定",
+				Detail: fmt.Sprintf("%s → %s（文件已不存在）", path, st.DocBindings[path]),
+				fix: func(st *State) {
+					delete(st.DocBindings, path)
+					delete(st.DocSyncStates, path)
+				},
+			})
+		}
+	}
+	chatIDs := make([]string, 0, len(st.Chats))
+	for id := range st.Chats {
+		chatIDs = append(chatIDs, id)
+	}
+	sort.Strings(chatIDs)
+	for _, id := range chatIDs {
+		id, sess := id, st.Chats[id]
+		if missing(sess.WorkDir) {
+			problems = append(problems, StateProblem{
+				Kind:   "会话",
+				Detail: fmt.Sprintf("聊天 %s 的工作目录 %s 已不存在（修复后回到根目录并开始新会话）", id, sess.WorkDir),
+				fix: func(st *State) {
+					s := st.Chats[id]
+					if s.ClaudeSessionID != "" {
+						s.History = append(s.History, s.ClaudeSessionID)
+					}
+					s.WorkDir, s.ClaudeSessionID = st.WorkRoot, ""
+				},
+			})
+		}
+		for _, dir := range sortedKeys(sess.DirSessions) {
+			if missing(dir) {
+				dir := dir
+				problems = append(problems, StateProblem{
+					Kind:   "目录会话",
+					Detail: fmt.Sprintf("聊天 %s 记住的 %s 的会话（目录已不存在）", id, dir),
+					fix:    func(st *State) { delete(st.Chats[id].DirSessions, dir) },
+				})
+			}
+		}
+	}
+	for _, w := range st.Watches {
+		if missing(w.Dir) {
+			id := w.ID
+			problems = append(problems, StateProblem{
+				Kind:   "监听",
+				Detail: fmt.Sprintf("%s（聊天 %s）监听的 %s 已不存在", w.ID, w.ChatID, w.Dir),
+				fix: func(st *State) {
+					st.Watches = removeWhere(st.Watches, func(w *WatchRule) bool { return w.ID == id })
+				},
+			})
+		}
+	}
+	for _, h := range st.Hooks {
+		if missing(h.Repo) {
+			id := h.ID
+			problems = append(problems, StateProblem{
+				Kind:   "git 钩子",
+				Detail: fmt.Sprintf("%s（聊天 %s）所在的仓库 %s 已不存在", h.ID, h.ChatID, h.Repo),
+				fix: func(st *State) {
+					st.Hooks = removeWhere(st.Hooks, func(h *RepoHook) bool { return h.ID == id })
+				},
+			})
+		}
+	}
+	for _, repo := range sortedKeys(st.SecBaselines) {
+		if missing(repo) {
+			repo := repo
+			problems = append(problems, StateProblem{Kind: "安全基线", Detail: repo + "（仓库已不存在）", fix: func(st *State) { delete(st.SecBaselines, repo) }})
+		}
+	}
+	for _, repo := range sortedKeys(st.Verifiers) {
+		if missing(repo) {
+			repo := repo
+			problems = append(problems, StateProblem{Kind: "校验命令", Detail: repo + "（仓库已不存在）", fix: func(st *State) { delete(st.Verifiers, repo) }})
+		}
+	}
+	for _, repo := range sortedKeys(st.Protected) {
+		if missing(repo) {
+			repo := repo
+			problems = append(problems, StateProblem{Kind: "保护规则", Detail: repo + "（仓库已不存在）", fix: func(st *State) { delete(st.Protected, repo) }})
+		}
+	}
+	return problems
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func removeWhere[T any](items []*T, drop func(*T) bool) []*T {
+	out := items[:0]
+	for _, it := range items {
+		if !drop(it) {
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
+// pruneState drops execution records and /doc sync entries from before
+// cutoff and guest links expired by now, returning how many of each.
+func pruneState(st *State, cutoff, now time.Time) (execs, syncs, links int) {
+	n := len(st.Executions)
+	st.Executions = removeWhere(st.Executions, func(rec *ExecRecord) bool { return rec.StartedAt.Before(cutoff) })
+	execs = n - len(st.Executions)
+	n = len(st.DocSyncs)
+	st.DocSyncs = removeWhere(st.DocSyncs, func(d *DocSync) bool { return d.At.Before(cutoff) })
+	syncs = n - len(st.DocSyncs)
+	n = len(st.GuestLinks)
+	st.GuestLinks = removeWhere(st.GuestLinks, func(g *GuestLink) bool { return !now.Before(g.ExpiresAt) })
+	links = n - len(st.GuestLinks)
+	return execs, syncs, links
+}
+
+// stateSummary renders the counts `devbot state show` prints.
+func stateSummary(path string, st *State) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "状态文件: %s\n", path)
+	fmt.Fprintf(&sb, "根目录:   %s\n\n", st.WorkRoot)
+	fmt.Fprintf(&sb, "聊天 (%d):\n", len(st.Chats))
+	for _, id := range sortedKeys(st.Chats) {
+		sess := st.Chats[id]
+		session := sess.ClaudeSessionID
+		if session == "" {
+			session = "-"
+		}
+		fmt.Fprintf(&sb, "  %s  目录 %s  会话 %s  历史会话 %d\n", id, sess.WorkDir, session, len(sess.History))
+	}
+	if len(st.Executions) > 0 {
+		fmt.Fprintf(&sb, "\n执行记录: %d 条（%s ~ %s）\n", len(st.Executions), st.Executions[0].StartedAt.Format("2006-01-02"), st.Executions[len(st.Executions)-1].StartedAt.Format("2006-01-02"))
+	} else {
+		sb.WriteString("\n执行记录: 0 条\n")
+	}
+	for _, c := range []struct {
+		name string
+		n    int
+	}{
+		{"文档绑定", len(st.DocBindings)}, {"文档同步记录", len(st.DocSyncs)}, {"监听", len(st.Watches)},
+		{"git 钩子", len(st.Hooks)}, {"升级战役", len(st.Campaigns)}, {"分享", len(st.Shares)},
+		{"访客链接", len(st.GuestLinks)}, {"安全基线", len(st.SecBaselines)}, {"校验命令", len(st.Verifiers)},
+		{"保护规则", len(st.Protected)}, {"提醒", len(st.Reminders)}, {"审批记录", len(st.Approvals)},
+		{"仓库订阅", len(st.RepoSubscriptions)}, {"事故", len(st.Incidents)}, {"待恢复任务", len(st.PendingTasks)},
+	} {
+		fmt.Fprintf(&sb, "%s: %d\n", c.name, c.n)
+	}
+	return sb.String()
+}
+
+// RunStateCommand implements `devbot state show|repair|prune` on the state
+// file at path. Questions are read from in; -y answers yes to all of them.
+// devbot should be stopped first, or it overwrites the changes on its next
+// save.
+func RunStateCommand(path string, args []string, in io.Reader, out io.Writer) error {
+	usage := "用法: devbot state show [-json]\n       devbot state repair [-y]\n       devbot state prune [-days N] [-y]"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	fs := flag.NewFlagSet("state "+args[0], flag.ContinueOnError)
+	fs.SetOutput(out)
+	asJSON := fs.Bool("json", false, "输出完整的 JSON")
+	yes := fs.Bool("y", false, "不逐项确认")
+	days := fs.Int("days", defaultPruneDays, "删除多少天以前的执行记录和文档同步记录")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("无法读取状态文件: %w", err)
+	}
+	store, err := NewStore(path)
+	if err != nil {
+		return fmt.Errorf("解析状态文件 %s: %w", path, err)
+	}
+	st := store.State()
+	answers := bufio.NewScanner(in)
+	confirm := func(question string) bool {
+		if *yes {
+			return true
+		}
+		fmt.Fprintf(out, "%s [y/N] ", question)
+		if !answers.Scan() {
+			fmt.Fprintln(out)
+			return false
+		}
+		answer := strings.ToLower(strings.TrimSpace(answers.Text()))
+		return answer == "y" || answer == "yes"
+	}
+
+	switch args[0] {
+	case "show":
+		if *asJSON {
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(st)
+		}
+		fmt.Fprint(out, stateSummary(path, st))
+		if problems := FindStateProblems(st); len(problems) > 0 {
+			fmt.Fprintf(out, "\n发现 %d 个问题，运行 devbot state repair 查看和修复。\n", len(problems))
+		}
+		return nil
+	case "repair":
+		problems := FindStateProblems(st)
+		if len(problems) == 0 {
+			fmt.Fprintln(out, "没有发现问题。")
+			return nil
+		}
+		fixed := 0
+		for i, p := range problems {
+			fmt.Fprintf(out, "%d/%d [%s] %s\n", i+1, len(problems), p.Kind, p.Detail)
+			if confirm("修复?") {
+				p.fix(st)
+				fixed++
+			}
+		}
+		if fixed == 0 {
+			fmt.Fprintln(out, "未做修改。")
+			return nil
+		}
+		if err := store.Save(); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "已修复 %d 个问题。\n", fixed)
+		return nil
+	case "prune":
+		if *days <= 0 {
+			return errors.New("-days 必须大于 0")
+		}
+		now := time.Now()
+		cutoff := now.AddDate(0, 0, -*days)
+		pruned := *st
+		pruned.Executions = append([]*ExecRecord(nil), st.Executions...)
+		pruned.DocSyncs = append([]*DocSync(nil), st.DocSyncs...)
+		pruned.GuestLinks = append([]*GuestLink(nil), st.GuestLinks...)
+		execs, syncs, links := pruneState(&pruned, cutoff, now)
+		if execs+syncs+links == 0 {
+			fmt.Fprintln(out, "没有可清理的内容。")
+			return nil
+		}
+		fmt.Fprintf(out, "将删除 %s 以前的 %d 条执行记录、%d 条文档同步记录，以及 %d 个已过期的访客链接。\n", cutoff.Format("2006-01-02"), execs, syncs, links)
+		if !confirm("继续?") {
+			fmt.Fprintln(out, "未做修改。")
+			return nil
+		}
+		*st = pruned
+		if err := store.Save(); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "已清理。")
+		return nil
+	}
+	return errors.New(usage)
+}
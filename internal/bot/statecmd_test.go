@@ -0,0 +1,126 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeState saves st to a fresh state file and returns its path.
+func writeState(t *testing.T, st *State) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "state.json")
+	data, _ := json.Marshal(st)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunStateCommandRepair(t *testing.T) {
+	root := t.TempDir()
+	kept := filepath.Join(root, "kept.md")
+	os.WriteFile(kept, []byte("# kept"), 0644)
+	gone := filepath.Join(root, "gone")
+	path := writeState(t, &State{
+		WorkRoot:    root,
+		DocBindings: map[string]string{kept: "doc1", filepath.Join(gone, "a.md"): "doc2"},
+		Chats: map[string]*Session{
+			"chat1": {WorkDir: gone, ClaudeSessionID: "s1", DirSessions: map[string]string{gone: "s0", root: "s2"}},
+			"chat2": {WorkDir: root},
+		},
+		Watches:   []*WatchRule{{ID: "w1", ChatID: "chat1", Dir: gone}, {ID: "w2", ChatID: "chat2", Dir: root}},
+		Verifiers: map[string]string{gone: "make"},
+	})
+
+	var out bytes.Buffer
+	if err := RunStateCommand(path, []string{"show"}, strings.NewReader(""), &out); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.Contains(got, "聊天 (2)") || !strings.Contains(got, "文档绑定: 2") || !strings.Contains(got, "发现 5 个问题") {
+		t.Fatalf("unexpected summary %q", got)
+	}
+
+	// Decline the doc binding, accept the rest.
+	out.Reset()
+	if err := RunStateCommand(path, []string{"repair"}, strings.NewReader("n\ny\ny\ny\ny\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "已修复 4 个问题") {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := store.State()
+	if len(st.DocBindings) != 2 {
+		t.Fatalf("expected the declined binding kept, got %v", st.DocBindings)
+	}
+	chat1 := st.Chats["chat1"]
+	if chat1.WorkDir != root || chat1.ClaudeSessionID != "" || len(chat1.History) != 1 || len(chat1.DirSessions) != 1 {
+		t.Fatalf("unexpected repaired session %+v", chat1)
+	}
+	if len(st.Watches) != 1 || st.Watches[0].ID != "w2" || len(st.Verifiers) != 0 {
+		t.Fatalf("unexpected repaired state %+v", st)
+	}
+
+	out.Reset()
+	if err := RunStateCommand(path, []string{"repair", "-y"}, strings.NewReader(""), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(FindStateProblems(mustLoadState(t, path))) != 0 {
+		t.Fatalf("expected no problems left, got %q", out.String())
+	}
+}
+
+func mustLoadState(t *testing.T, path string) *State {
+	t.Helper()
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store.State()
+}
+
+func TestRunStateCommandPrune(t *testing.T) {
+	now := time.Now()
+	path := writeState(t, &State{
+		Executions: []*ExecRecord{
+			{ID: "old", StartedAt: now.AddDate(0, 0, -100)},
+			{ID: "new", StartedAt: now.AddDate(0, 0, -1)},
+		},
+		DocSyncs:   []*DocSync{{Path: "a.md", At: now.AddDate(0, 0, -200)}},
+		GuestLinks: []*GuestLink{{ID: "g1", ExpiresAt: now.Add(-time.Hour)}, {ID: "g2", ExpiresAt: now.Add(time.Hour)}},
+	})
+
+	var out bytes.Buffer
+	if err := RunStateCommand(path, []string{"prune"}, strings.NewReader("n\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	if st := mustLoadState(t, path); len(st.Executions) != 2 || len(st.GuestLinks) != 2 {
+		t.Fatalf("expected nothing removed when declined, got %q", out.String())
+	}
+	out.Reset()
+	if err := RunStateCommand(path, []string{"prune", "-days", "30", "-y"}, strings.NewReader(""), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "1 条执行记录、1 条文档同步记录，以及 1 个") {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+	st := mustLoadState(t, path)
+	if len(st.Executions) != 1 || st.Executions[0].ID != "new" || len(st.DocSyncs) != 0 || len(st.GuestLinks) != 1 || st.GuestLinks[0].ID != "g2" {
+		t.Fatalf("unexpected pruned state %+v", st)
+	}
+
+	if err := RunStateCommand(path, []string{"bogus"}, strings.NewReader(""), &out); err == nil {
+		t.Fatal("expected an error for an unknown subcommand")
+	}
+	if err := RunStateCommand(filepath.Join(t.TempDir(), "none.json"), []string{"show"}, strings.NewReader(""), &out); err == nil {
+		t.Fatal("expected an error for a missing state file")
+	}
+}
@@ -1,12 +1,39 @@
 package bot
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
+// maxExecRecords bounds the persisted execution history across all chats.
+const maxExecRecords = 500
+
+// maxDocSyncs bounds the persisted /doc push and pull log.
+const maxDocSyncs = 1000
+
+// maxApprovalRecords bounds the persisted approval chains.
+const maxApprovalRecords = 500
+
+// maxRecordOutput bounds the output stored with each execution record (in runes).
+const maxRecordOutput = 20000
+
+// maxTurnOutput bounds the output kept with each transcript turn (in runes).
+const maxTurnOutput = 100000
+
+// maxTranscripts bounds the session transcripts kept; the least recently
+// written are removed first.
+const maxTranscripts = 200
+
 type Session struct {
 	ClaudeSessionID string            `json:"claudeSessionID,omitempty"`
 	WorkDir         string            `json:"workDir,omitempty"`
@@ -16,18 +43,333 @@ type Session struct {
 	LastOutput      string            `json:"lastOutput,omitempty"`
 	LastPrompt      string            `json:"lastPrompt,omitempty"`
 	DirSessions     map[string]string `json:"dirSessions,omitempty"`
+	// Summaries describes archived sessions, keyed by Claude session ID.
+	Summaries map[string]string `json:"summaries,omitempty"`
+	// Focus suggests relevant files before each prompt (see /focus).
+	Focus bool `json:"focus,omitempty"`
+	// OutputLimit is how many characters of command output cards show
+	// (0 = default, see /output).
+	OutputLimit int `json:"outputLimit,omitempty"`
+	// AckReaction acknowledges prompts with a reaction on the user's
+	// message instead of text (see /ack).
+	AckReaction bool `json:"ackReaction,omitempty"`
+	// CommandPrefix is an extra prefix for commands besides "/", e.g. "!";
+	// BareCommands makes commands work without any prefix and stops plain
+	// messages from reaching Claude (see /prefix).
+	CommandPrefix string `json:"commandPrefix,omitempty"`
+	BareCommands  bool   `json:"bareCommands,omitempty"`
+	// ExecHistory holds the chat's recent /exec command lines, oldest
+	// first (see /exec history).
+	ExecHistory []string `json:"execHistory,omitempty"`
+	// Checkpoints link commits to Claude sessions, oldest first (see
+	// /checkpoint).
+	Checkpoints []Checkpoint `json:"checkpoints,omitempty"`
+	// DefaultBranch and RepoSync override the configured default branch
+	// and refresh mode after idle ("off", "fetch", "pull"; see /sync).
+	DefaultBranch string `json:"defaultBranch,omitempty"`
+	RepoSync      string `json:"repoSync,omitempty"`
+	// About describes the environment of a repository (or directory) for
+	// new Claude sessions, keyed by its root (see /about).
+	About map[string]string `json:"about,omitempty"`
+	// NamedSessions are the Claude sessions named with /save, by name.
+	NamedSessions map[string]NamedSession `json:"namedSessions,omitempty"`
+}
+
+// NamedSession is a Claude session saved under a name, with the workdir
+// and model /load restores along with it.
+type NamedSession struct {
+	SessionID string    `json:"sessionID"`
+	WorkDir   string    `json:"workDir,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	SavedAt   time.Time `json:"savedAt"`
+}
+
+// ExecRecord is one finished Claude execution kept in the persistent history.
+type ExecRecord struct {
+	ID        string        `json:"id"`
+	ChatID    string        `json:"chatID"`
+	Prompt    string        `json:"prompt"`
+	Output    string        `json:"output,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	WorkDir   string        `json:"workDir,omitempty"`
+	SessionID string        `json:"sessionID,omitempty"`
+	Urgent    bool          `json:"urgent,omitempty"`
+	StartedAt time.Time     `json:"startedAt"`
+	Duration  time.Duration `json:"duration"`
+	// Reproducibility metadata: the exact model, CLI version, permission
+	// mode and git HEAD the execution ran with. ReproOf links a /repro run
+	// to the execution it replayed.
+	Model          string `json:"model,omitempty"`
+	CLIVersion     string `json:"cliVersion,omitempty"`
+	PermissionMode string `json:"permissionMode,omitempty"`
+	GitHead        string `json:"gitHead,omitempty"`
+	ReproOf        string `json:"reproOf,omitempty"`
+	// Labels group related executions for /history (see /label).
+	Labels []string `json:"labels,omitempty"`
+	// Issue is the URL of the GitHub issue filed for this failure.
+	Issue string `json:"issue,omitempty"`
+	// Incident is the ID of the /incident open in the chat when the
+	// execution finished.
+	Incident string `json:"incident,omitempty"`
+	// Rating ("up" or "down") and Feedback are what FeedbackBy said about
+	// the result (see /feedback).
+	Rating     string    `json:"rating,omitempty"`
+	Feedback   string    `json:"feedback,omitempty"`
+	FeedbackBy string    `json:"feedbackBy,omitempty"`
+	FeedbackAt time.Time `json:"feedbackAt,omitempty"`
+	// Template is the prompt template variant ("<kind>/<name>") the
+	// prompt was built from (see prompt_templates).
+	Template string `json:"template,omitempty"`
+}
+
+// WatchRule runs Prompt in ChatID whenever files under Dir matching Glob
+// change (see /watch).
+type WatchRule struct {
+	ID        string    `json:"id"`
+	ChatID    string    `json:"chatID"`
+	Dir       string    `json:"dir"`
+	Glob      string    `json:"glob"`
+	Prompt    string    `json:"prompt"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// RepoHook is a set of git hooks installed in Repo that notify ChatID when
+// the repository changes outside the bot (see /hooks).
+type RepoHook struct {
+	ID        string    `json:"id"`
+	ChatID    string    `json:"chatID"`
+	Repo      string    `json:"repo"`
+	Token     string    `json:"token"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Campaign is a dependency upgrade rolled out to every repository under
+// the work root that uses Module (see /campaign).
+type Campaign struct {
+	ID        string          `json:"id"`
+	ChatID    string          `json:"chatID"`
+	Module    string          `json:"module"`
+	Version   string          `json:"version"`
+	Branch    string          `json:"branch"`
+	Repos     []*CampaignRepo `json:"repos"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// CampaignRepo is one repository's progress in a campaign. Detail holds
+// the PR URL or what went wrong.
+type CampaignRepo struct {
+	Dir       string    `json:"dir"`
+	Status    string    `json:"status"`
+	Detail    string    `json:"detail,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt,omitempty"`
+}
+
+// Share is a result uploaded by /share. Ref identifies it to the paste
+// service for deletion: the gist ID, or the paste's management token.
+type Share struct {
+	ID        string    `json:"id"`
+	ChatID    string    `json:"chatID"`
+	Provider  string    `json:"provider"`
+	URL       string    `json:"url"`
+	Ref       string    `json:"ref,omitempty"`
+	Title     string    `json:"title"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Reminder is a /remind reminder: at At the bot posts Text to ChatID, or
+// runs it as a prompt when Run is set. EventID is its event on the shared
+// calendar, if any.
+type Reminder struct {
+	ID        string    `json:"id"`
+	ChatID    string    `json:"chatID"`
+	Text      string    `json:"text"`
+	Run       bool      `json:"run,omitempty"`
+	At        time.Time `json:"at"`
+	EventID   string    `json:"eventID,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ApprovalRecord is the approval chain of a command held by an approval
+// rule, kept for /audit. Outcome is "approved", "rejected" or "expired".
+type ApprovalRecord struct {
+	ID          string         `json:"id"`
+	ChatID      string         `json:"chatID"`
+	Command     string         `json:"command"`
+	Rule        string         `json:"rule"`
+	Requester   string         `json:"requester"`
+	Required    int            `json:"required"`
+	Votes       []ApprovalVote `json:"votes,omitempty"`
+	Outcome     string         `json:"outcome"`
+	RequestedAt time.Time      `json:"requestedAt"`
+	DecidedAt   time.Time      `json:"decidedAt"`
+}
+
+// ApprovalVote is one approver's decision on an approval request.
+type ApprovalVote struct {
+	UserID  string    `json:"userID"`
+	Approve bool      `json:"approve"`
+	At      time.Time `json:"at"`
+}
+
+// GuestLink is a read-only web link to one execution result, created by
+// /guest. Token is the secret in the link's URL.
+type GuestLink struct {
+	ID        string    `json:"id"`
+	Token     string    `json:"token"`
+	ChatID    string    `json:"chatID"`
+	ExecID    string    `json:"execID"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// DocSync is one /doc push or pull, kept for the weekly report.
+type DocSync struct {
+	ChatID    string    `json:"chatID"`
+	Path      string    `json:"path"`
+	DocID     string    `json:"docID"`
+	Direction string    `json:"direction"` // "push" or "pull"
+	At        time.Time `json:"at"`
+}
+
+// DocSyncState is what a bound file and its document looked like at their
+// last sync, so /doc sync can tell which side changed since.
+type DocSyncState struct {
+	LocalHash    string    `json:"localHash"`
+	RemoteHash   string    `json:"remoteHash,omitempty"` // "" if the document could not be read back; /doc sync then reports a conflict instead of guessing
+	LocalModTime time.Time `json:"localModTime"`
+	SyncedAt     time.Time `json:"syncedAt"`
+}
+
+// RepoSubscription forwards the GitHub webhook events of Repo ("owner/name",
+// lower case) to ChatID. Events lists the kinds forwarded ("push", "pr",
+// "ci"); empty means all of them.
+type RepoSubscription struct {
+	ChatID    string    `json:"chatId"`
+	Repo      string    `json:"repo"`
+	Events    []string  `json:"events,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// wants reports whether sub forwards events of kind.
+func (sub RepoSubscription) wants(kind string) bool {
+	if len(sub.Events) == 0 {
+		return true
+	}
+	for _, e := range sub.Events {
+		if e == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Incident is an /incident of a chat; EndedAt is zero while it is open.
+// Timeline holds what was said in the chat during the incident; the
+// executions are found by their Incident tag.
+type Incident struct {
+	ID        string          `json:"id"`
+	ChatID    string          `json:"chatID"`
+	Title     string          `json:"title"`
+	StartedBy string          `json:"startedBy,omitempty"`
+	StartedAt time.Time       `json:"startedAt"`
+	EndedAt   time.Time       `json:"endedAt,omitempty"`
+	PinnedID  string          `json:"pinnedID,omitempty"`
+	Timeline  []IncidentEvent `json:"timeline,omitempty"`
+	DocURL    string          `json:"docURL,omitempty"`
+}
+
+// IncidentEvent is one message sent in a chat during an incident.
+type IncidentEvent struct {
+	At     time.Time `json:"at"`
+	UserID string    `json:"userID,omitempty"`
+	Text   string    `json:"text"`
+}
+
+// PendingTask is a task that was still waiting in the queue when devbot
+// shut down. Prompts (Resumable) are queued again on the next start with
+// the same ID; other tasks, such as /review-local, only have their chat
+// told to resend them.
+type PendingTask struct {
+	ID        string    `json:"id"`
+	ChatID    string    `json:"chatID"`
+	Prompt    string    `json:"prompt"`
+	Urgent    bool      `json:"urgent,omitempty"`
+	Images    []string  `json:"images,omitempty"`
+	Template  string    `json:"template,omitempty"`
+	Resumable bool      `json:"resumable,omitempty"`
+	QueuedAt  time.Time `json:"queuedAt"`
+}
+
+// SecBaseline records the /sec findings accepted for a repository, by
+// fingerprint; later scans only report findings missing from it.
+type SecBaseline struct {
+	Fingerprints []string  `json:"fingerprints"`
+	CreatedAt    time.Time `json:"createdAt"`
 }
 
 type State struct {
 	Chats       map[string]*Session `json:"chats"`
 	DocBindings map[string]string   `json:"docBindings"`
 	WorkRoot    string              `json:"workRoot,omitempty"`
+	Executions  []*ExecRecord       `json:"executions,omitempty"`
+	Watches     []*WatchRule        `json:"watches,omitempty"`
+	Hooks       []*RepoHook         `json:"hooks,omitempty"`
+	// SecBaselines is keyed by repository root.
+	SecBaselines map[string]*SecBaseline `json:"secBaselines,omitempty"`
+	Campaigns    []*Campaign             `json:"campaigns,omitempty"`
+	Shares       []*Share                `json:"shares,omitempty"`
+	DocSyncs     []*DocSync              `json:"docSyncs,omitempty"`
+	// DocSyncStates is keyed by bound file path, like DocBindings.
+	DocSyncStates map[string]*DocSyncState `json:"docSyncStates,omitempty"`
+	GuestLinks    []*GuestLink             `json:"guestLinks,omitempty"`
+	// Verifiers maps repository roots to the /verify command run after
+	// executions that change files.
+	Verifiers map[string]string `json:"verifiers,omitempty"`
+	// Protected maps repository roots to the /protect globs of files
+	// Claude may not change.
+	Protected map[string][]string `json:"protected,omitempty"`
+	// TestHistory maps repository roots to the recent results of each Go
+	// test ("pkg.TestName"), one "P" or "F" per /test run, oldest first.
+	TestHistory map[string]map[string]string `json:"testHistory,omitempty"`
+	// Quarantine maps repository roots to the top-level tests /test runs
+	// separately so they cannot fail the main result.
+	Quarantine map[string][]string `json:"quarantine,omitempty"`
+	Reminders  []*Reminder         `json:"reminders,omitempty"`
+	Approvals  []*ApprovalRecord   `json:"approvals,omitempty"`
+	// RepoSubscriptions are the GitHub repositories chats follow with
+	// /watch repo.
+	RepoSubscriptions []*RepoSubscription `json:"repoSubscriptions,omitempty"`
+	Incidents         []*Incident         `json:"incidents,omitempty"`
+	// PendingTasks were waiting in the queue at the last shutdown; the
+	// next start takes them (see Router.ResumeQueue).
+	PendingTasks []*PendingTask `json:"pendingTasks,omitempty"`
+}
+
+// setResultMeta copies the model and CLI version reported by the executor.
+func (rec *ExecRecord) setResultMeta(result ExecResult) {
+	if result.Model != "" {
+		rec.Model = result.Model
+	}
+	rec.CLIVersion = result.CLIVersion
+}
+
+// newExecID returns a short random identifier for an execution.
+func newExecID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("150405.000")
+	}
+	return hex.EncodeToString(b)
 }
 
 type Store struct {
 	mu    sync.RWMutex
 	path  string
 	state *State
+	// turnMu serializes writes to the transcript files.
+	turnMu sync.Mutex
 }
 
 func NewStore(path string) (*Store, error) {
@@ -80,6 +422,25 @@ func (s *Store) GetSession(chatID, defaultWorkDir, defaultModel string) Session
 	// Return a value copy — callers get a consistent snapshot
 	cp := *sess
 	cp.History = append([]string(nil), sess.History...)
+	cp.Checkpoints = append([]Checkpoint(nil), sess.Checkpoints...)
+	if sess.Summaries != nil {
+		cp.Summaries = make(map[string]string, len(sess.Summaries))
+		for id, summary := range sess.Summaries {
+			cp.Summaries[id] = summary
+		}
+	}
+	if sess.NamedSessions != nil {
+		cp.NamedSessions = make(map[string]NamedSession, len(sess.NamedSessions))
+		for name, ns := range sess.NamedSessions {
+			cp.NamedSessions[name] = ns
+		}
+	}
+	if sess.About != nil {
+		cp.About = make(map[string]string, len(sess.About))
+		for dir, text := range sess.About {
+			cp.About[dir] = text
+		}
+	}
 	return cp
 }
 
@@ -106,9 +467,14 @@ func (s *Store) DocBindings() map[string]string {
 	return cp
 }
 
+// SetDocBinding binds filePath to docID. Binding it to another document
+// forgets the last sync state.
 func (s *Store) SetDocBinding(filePath, docID string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.state.DocBindings[filePath] != docID {
+		delete(s.state.DocSyncStates, filePath)
+	}
 	s.state.DocBindings[filePath] = docID
 }
 
@@ -116,6 +482,691 @@ func (s *Store) RemoveDocBinding(filePath string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	delete(s.state.DocBindings, filePath)
+	delete(s.state.DocSyncStates, filePath)
+}
+
+// DocSyncState returns the last sync state of the bound filePath.
+func (s *Store) DocSyncState(filePath string) (DocSyncState, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st, ok := s.state.DocSyncStates[filePath]
+	if !ok {
+		return DocSyncState{}, false
+	}
+	return *st, true
+}
+
+func (s *Store) SetDocSyncState(filePath string, st DocSyncState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state.DocSyncStates == nil {
+		s.state.DocSyncStates = make(map[string]*DocSyncState)
+	}
+	s.state.DocSyncStates[filePath] = &st
+}
+
+// SecBaseline returns a copy of the /sec baseline of repo.
+func (s *Store) SecBaseline(repo string) (SecBaseline, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.state.SecBaselines[repo]
+	if !ok {
+		return SecBaseline{}, false
+	}
+	cp := *b
+	cp.Fingerprints = append([]string(nil), b.Fingerprints...)
+	return cp, true
+}
+
+func (s *Store) SetSecBaseline(repo string, b SecBaseline) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state.SecBaselines == nil {
+		s.state.SecBaselines = make(map[string]*SecBaseline)
+	}
+	s.state.SecBaselines[repo] = &b
+}
+
+// Verifier returns the verification command of repo.
+func (s *Store) Verifier(repo string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cmd, ok := s.state.Verifiers[repo]
+	return cmd, ok
+}
+
+// SetVerifier sets the verification command of repo; an empty command
+// removes it.
+func (s *Store) SetVerifier(repo, command string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if command == "" {
+		delete(s.state.Verifiers, repo)
+		return
+	}
+	if s.state.Verifiers == nil {
+		s.state.Verifiers = make(map[string]string)
+	}
+	s.state.Verifiers[repo] = command
+}
+
+// ProtectedPatterns returns a copy of the /protect globs of repo.
+func (s *Store) ProtectedPatterns(repo string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.state.Protected[repo]...)
+}
+
+// SetProtectedPatterns replaces the /protect globs of repo; none removes
+// the entry.
+func (s *Store) SetProtectedPatterns(repo string, patterns []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(patterns) == 0 {
+		delete(s.state.Protected, repo)
+		return
+	}
+	if s.state.Protected == nil {
+		s.state.Protected = make(map[string][]string)
+	}
+	s.state.Protected[repo] = append([]string(nil), patterns...)
+}
+
+// RecordTestResults appends a /test run's results (true = passed) to the
+// test history of repo.
+func (s *Store) RecordTestResults(repo string, results map[string]bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state.TestHistory == nil {
+		s.state.TestHistory = make(map[string]map[string]string)
+	}
+	hist := s.state.TestHistory[repo]
+	if hist == nil {
+		hist = make(map[string]string)
+		s.state.TestHistory[repo] = hist
+	}
+	for test, passed := range results {
+		h := hist[test] + "F"
+		if passed {
+			h = hist[test] + "P"
+		}
+		if len(h) > maxTestHistory {
+			h = h[len(h)-maxTestHistory:]
+		}
+		hist[test] = h
+	}
+}
+
+// TestHistory returns a copy of the test history of repo.
+func (s *Store) TestHistory(repo string) map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[string]string, len(s.state.TestHistory[repo]))
+	for k, v := range s.state.TestHistory[repo] {
+		out[k] = v
+	}
+	return out
+}
+
+// QuarantinedTests returns a copy of the quarantined tests of repo.
+func (s *Store) QuarantinedTests(repo string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.state.Quarantine[repo]...)
+}
+
+// SetQuarantinedTests replaces the quarantined tests of repo; none removes
+// the entry.
+func (s *Store) SetQuarantinedTests(repo string, names []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(names) == 0 {
+		delete(s.state.Quarantine, repo)
+		return
+	}
+	if s.state.Quarantine == nil {
+		s.state.Quarantine = make(map[string][]string)
+	}
+	s.state.Quarantine[repo] = append([]string(nil), names...)
+}
+
+func (s *Store) AddWatch(rule WatchRule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Watches = append(s.state.Watches, &rule)
+}
+
+// Watches returns copies of the watch rules of chatID in creation order.
+// An empty chatID matches all chats.
+func (s *Store) Watches(chatID string) []WatchRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []WatchRule
+	for _, w := range s.state.Watches {
+		if chatID == "" || w.ChatID == chatID {
+			out = append(out, *w)
+		}
+	}
+	return out
+}
+
+// SetWatchEnabled enables or disables the rule id of chatID and returns the
+// updated rule.
+func (s *Store) SetWatchEnabled(chatID, id string, enabled bool) (WatchRule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.state.Watches {
+		if w.ID == id && w.ChatID == chatID {
+			w.Enabled = enabled
+			return *w, true
+		}
+	}
+	return WatchRule{}, false
+}
+
+// RemoveWatch deletes the rule id of chatID.
+func (s *Store) RemoveWatch(chatID, id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, w := range s.state.Watches {
+		if w.ID == id && w.ChatID == chatID {
+			s.state.Watches = append(s.state.Watches[:i], s.state.Watches[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// AddCampaign stores a new campaign.
+func (s *Store) AddCampaign(c Campaign) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Campaigns = append(s.state.Campaigns, &c)
+}
+
+// Campaigns returns copies of the campaigns of chatID in creation order.
+func (s *Store) Campaigns(chatID string) []Campaign {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Campaign
+	for _, c := range s.state.Campaigns {
+		if c.ChatID != chatID {
+			continue
+		}
+		cp := *c
+		cp.Repos = make([]*CampaignRepo, len(c.Repos))
+		for i, repo := range c.Repos {
+			rc := *repo
+			cp.Repos[i] = &rc
+		}
+		out = append(out, cp)
+	}
+	return out
+}
+
+// UpdateCampaignRepo applies fn to repository dir of campaign id.
+func (s *Store) UpdateCampaignRepo(id, dir string, fn func(*CampaignRepo)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.state.Campaigns {
+		if c.ID != id {
+			continue
+		}
+		for _, repo := range c.Repos {
+			if repo.Dir == dir {
+				fn(repo)
+			}
+		}
+	}
+}
+
+// AddShare records an uploaded share.
+func (s *Store) AddShare(sh Share) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Shares = append(s.state.Shares, &sh)
+}
+
+// Shares returns copies of the shares of chatID in creation order. An
+// empty chatID matches all chats.
+func (s *Store) Shares(chatID string) []Share {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Share
+	for _, sh := range s.state.Shares {
+		if chatID == "" || sh.ChatID == chatID {
+			out = append(out, *sh)
+		}
+	}
+	return out
+}
+
+// AddGuestLink records a guest link, dropping links that have expired.
+func (s *Store) AddGuestLink(g GuestLink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.state.GuestLinks[:0]
+	for _, old := range s.state.GuestLinks {
+		if old.ExpiresAt.After(g.CreatedAt) {
+			kept = append(kept, old)
+		}
+	}
+	s.state.GuestLinks = append(kept, &g)
+}
+
+// GuestLinkByToken returns the guest link with token if it has not expired
+// at now.
+func (s *Store) GuestLinkByToken(token string, now time.Time) (GuestLink, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, g := range s.state.GuestLinks {
+		if subtle.ConstantTimeCompare([]byte(g.Token), []byte(token)) == 1 && now.Before(g.ExpiresAt) {
+			return *g, true
+		}
+	}
+	return GuestLink{}, false
+}
+
+// GuestLinks returns copies of the chat's guest links that have not expired
+// at now, oldest first.
+func (s *Store) GuestLinks(chatID string, now time.Time) []GuestLink {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []GuestLink
+	for _, g := range s.state.GuestLinks {
+		if g.ChatID == chatID && now.Before(g.ExpiresAt) {
+			out = append(out, *g)
+		}
+	}
+	return out
+}
+
+// RemoveGuestLink revokes guest link id of chatID and reports whether it
+// existed.
+func (s *Store) RemoveGuestLink(chatID, id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, g := range s.state.GuestLinks {
+		if g.ID == id && g.ChatID == chatID {
+			s.state.GuestLinks = append(s.state.GuestLinks[:i], s.state.GuestLinks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// AddReminder records a pending reminder.
+func (s *Store) AddReminder(rem Reminder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Reminders = append(s.state.Reminders, &rem)
+}
+
+// Reminders returns copies of the pending reminders of chatID, soonest
+// first.
+func (s *Store) Reminders(chatID string) []Reminder {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Reminder
+	for _, rem := range s.state.Reminders {
+		if rem.ChatID == chatID {
+			out = append(out, *rem)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].At.Before(out[j].At) })
+	return out
+}
+
+// RemoveReminder cancels reminder id of chatID and returns it.
+func (s *Store) RemoveReminder(chatID, id string) (Reminder, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, rem := range s.state.Reminders {
+		if rem.ID == id && rem.ChatID == chatID {
+			s.state.Reminders = append(s.state.Reminders[:i], s.state.Reminders[i+1:]...)
+			return *rem, true
+		}
+	}
+	return Reminder{}, false
+}
+
+// TakeDueReminders removes and returns the reminders due at now, soonest
+// first.
+func (s *Store) TakeDueReminders(now time.Time) []Reminder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []Reminder
+	kept := s.state.Reminders[:0]
+	for _, rem := range s.state.Reminders {
+		if rem.At.After(now) {
+			kept = append(kept, rem)
+			continue
+		}
+		due = append(due, *rem)
+	}
+	s.state.Reminders = kept
+	sort.SliceStable(due, func(i, j int) bool { return due[i].At.Before(due[j].At) })
+	return due
+}
+
+// AddPendingTasks records tasks left waiting at shutdown.
+func (s *Store) AddPendingTasks(tasks []PendingTask) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range tasks {
+		t := tasks[i]
+		s.state.PendingTasks = append(s.state.PendingTasks, &t)
+	}
+}
+
+// TakePendingTasks removes and returns the tasks left waiting at the last
+// shutdown, in the order they were queued.
+func (s *Store) TakePendingTasks() []PendingTask {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]PendingTask, 0, len(s.state.PendingTasks))
+	for _, t := range s.state.PendingTasks {
+		out = append(out, *t)
+	}
+	s.state.PendingTasks = nil
+	return out
+}
+
+// AddApprovalRecord records a decided approval chain, dropping the oldest
+// once maxApprovalRecords is exceeded.
+func (s *Store) AddApprovalRecord(rec ApprovalRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Approvals = append(s.state.Approvals, &rec)
+	if over := len(s.state.Approvals) - maxApprovalRecords; over > 0 {
+		s.state.Approvals = s.state.Approvals[over:]
+	}
+}
+
+// ApprovalRecords returns copies of the most recent approval chains,
+// newest first; limit <= 0 returns all.
+func (s *Store) ApprovalRecords(limit int) []ApprovalRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []ApprovalRecord
+	for i := len(s.state.Approvals) - 1; i >= 0 && (limit <= 0 || len(out) < limit); i-- {
+		out = append(out, *s.state.Approvals[i])
+	}
+	return out
+}
+
+// RemoveShare forgets share id.
+func (s *Store) RemoveShare(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, sh := range s.state.Shares {
+		if sh.ID == id {
+			s.state.Shares = append(s.state.Shares[:i], s.state.Shares[i+1:]...)
+			return
+		}
+	}
+}
+
+// AddDocSync records a document sync, dropping the oldest once
+// maxDocSyncs is exceeded.
+func (s *Store) AddDocSync(d DocSync) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.DocSyncs = append(s.state.DocSyncs, &d)
+	if n := len(s.state.DocSyncs); n > maxDocSyncs {
+		s.state.DocSyncs = append([]*DocSync(nil), s.state.DocSyncs[n-maxDocSyncs:]...)
+	}
+}
+
+// DocSyncs returns copies of the document syncs at or after since, oldest
+// first.
+func (s *Store) DocSyncs(since time.Time) []DocSync {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []DocSync
+	for _, d := range s.state.DocSyncs {
+		if !d.At.Before(since) {
+			out = append(out, *d)
+		}
+	}
+	return out
+}
+
+// AddHook stores hook, replacing an earlier hook of the same chat and repo.
+func (s *Store) AddHook(hook RepoHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, h := range s.state.Hooks {
+		if h.ChatID == hook.ChatID && h.Repo == hook.Repo {
+			s.state.Hooks[i] = &hook
+			return
+		}
+	}
+	s.state.Hooks = append(s.state.Hooks, &hook)
+}
+
+// Hooks returns copies of the hooks of chatID in installation order. An
+// empty chatID matches all chats.
+func (s *Store) Hooks(chatID string) []RepoHook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []RepoHook
+	for _, h := range s.state.Hooks {
+		if chatID == "" || h.ChatID == chatID {
+			out = append(out, *h)
+		}
+	}
+	return out
+}
+
+// Hook returns the hook with the given id.
+func (s *Store) Hook(id string) (RepoHook, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, h := range s.state.Hooks {
+		if h.ID == id {
+			return *h, true
+		}
+	}
+	return RepoHook{}, false
+}
+
+// RemoveHook deletes the hook of chatID for repo and returns it.
+func (s *Store) RemoveHook(chatID, repo string) (RepoHook, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, h := range s.state.Hooks {
+		if h.ChatID == chatID && h.Repo == repo {
+			s.state.Hooks = append(s.state.Hooks[:i], s.state.Hooks[i+1:]...)
+			return *h, true
+		}
+	}
+	return RepoHook{}, false
+}
+
+// Sessions returns snapshot copies of all chat sessions keyed by chat ID.
+func (s *Store) Sessions() map[string]Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cp := make(map[string]Session, len(s.state.Chats))
+	for id, sess := range s.state.Chats {
+		c := *sess
+		c.History = append([]string(nil), sess.History...)
+		cp[id] = c
+	}
+	return cp
+}
+
+// AddExecRecord appends rec to the execution history, dropping the oldest
+// records once maxExecRecords is exceeded.
+func (s *Store) AddExecRecord(rec ExecRecord) {
+	if runes := []rune(rec.Output); len(runes) > maxRecordOutput {
+		rec.Output = string(runes[len(runes)-maxRecordOutput:])
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Executions = append(s.state.Executions, &rec)
+	if n := len(s.state.Executions); n > maxExecRecords {
+		s.state.Executions = append([]*ExecRecord(nil), s.state.Executions[n-maxExecRecords:]...)
+	}
+}
+
+// Turn is one prompt and its answer in a Claude session. Turns are kept
+// per session in a transcript file beside the state file, for /export;
+// unlike the execution history they are not dropped with other chats'
+// activity.
+type Turn struct {
+	ExecID   string        `json:"execID"`
+	At       time.Time     `json:"at"`
+	Prompt   string        `json:"prompt"`
+	Output   string        `json:"output,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+	WorkDir  string        `json:"workDir,omitempty"`
+	Model    string        `json:"model,omitempty"`
+}
+
+func (s *Store) transcriptDir() string {
+	return filepath.Join(filepath.Dir(s.path), "transcripts")
+}
+
+func (s *Store) transcriptPath(sessionID string) (string, error) {
+	if sessionID == "" || strings.ContainsAny(sessionID, `/\`) || strings.HasPrefix(sessionID, ".") {
+		return "", fmt.Errorf("invalid session ID %q", sessionID)
+	}
+	return filepath.Join(s.transcriptDir(), sessionID+".jsonl"), nil
+}
+
+// AppendTurn adds turn to sessionID's transcript. Starting a transcript
+// removes the oldest ones beyond maxTranscripts.
+func (s *Store) AppendTurn(sessionID string, turn Turn) error {
+	path, err := s.transcriptPath(sessionID)
+	if err != nil {
+		return err
+	}
+	if runes := []rune(turn.Output); len(runes) > maxTurnOutput {
+		turn.Output = string(runes[:maxTurnOutput])
+	}
+	line, err := json.Marshal(turn)
+	if err != nil {
+		return err
+	}
+	s.turnMu.Lock()
+	defer s.turnMu.Unlock()
+	if err := os.MkdirAll(s.transcriptDir(), 0755); err != nil {
+		return err
+	}
+	_, statErr := os.Stat(path)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && os.IsNotExist(statErr) {
+		s.pruneTranscripts()
+	}
+	return err
+}
+
+// pruneTranscripts removes the least recently written transcripts beyond
+// maxTranscripts. The caller holds turnMu.
+func (s *Store) pruneTranscripts() {
+	entries, err := os.ReadDir(s.transcriptDir())
+	if err != nil || len(entries) <= maxTranscripts {
+		return
+	}
+	type file struct {
+		path    string
+		modTime time.Time
+	}
+	var files []file
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && !e.IsDir() {
+			files = append(files, file{filepath.Join(s.transcriptDir(), e.Name()), info.ModTime()})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files[:max(0, len(files)-maxTranscripts)] {
+		os.Remove(f.path)
+	}
+}
+
+// Turns returns sessionID's transcript, oldest first; nil when there is
+// none.
+func (s *Store) Turns(sessionID string) ([]Turn, error) {
+	path, err := s.transcriptPath(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	s.turnMu.Lock()
+	data, err := os.ReadFile(path)
+	s.turnMu.Unlock()
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var turns []Turn
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var t Turn
+		if err := json.Unmarshal(line, &t); err != nil {
+			continue // a line cut short by a crash
+		}
+		turns = append(turns, t)
+	}
+	return turns, nil
+}
+
+// ExecRecords returns up to limit of the most recent execution records, newest
+// first. An empty chatID matches all chats; limit <= 0 means no limit.
+func (s *Store) ExecRecords(chatID string, limit int) []ExecRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []ExecRecord
+	for i := len(s.state.Executions) - 1; i >= 0; i-- {
+		rec := s.state.Executions[i]
+		if chatID != "" && rec.ChatID != chatID {
+			continue
+		}
+		out = append(out, *rec)
+		if limit > 0 && len(out) >= limit {
+			break
+		}
+	}
+	return out
+}
+
+// ExecRecord returns the finished execution with the given ID.
+func (s *Store) ExecRecord(id string) (ExecRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := len(s.state.Executions) - 1; i >= 0; i-- {
+		if s.state.Executions[i].ID == id {
+			return *s.state.Executions[i], true
+		}
+	}
+	return ExecRecord{}, false
+}
+
+// UpdateExecRecord runs fn on the finished execution id under the write
+// lock and reports whether it exists.
+func (s *Store) UpdateExecRecord(id string, fn func(*ExecRecord)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.state.Executions) - 1; i >= 0; i-- {
+		if s.state.Executions[i].ID == id {
+			fn(s.state.Executions[i])
+			return true
+		}
+	}
+	return false
 }
 
 // UpdateSession runs fn with the session for chatID under the write lock.
@@ -139,6 +1190,13 @@ func (s *Store) SessionExecParams(chatID string) (workDir, sessionID, permMode,
 	return sess.WorkDir, sess.ClaudeSessionID, sess.PermissionMode, sess.Model
 }
 
+// Snapshot returns the state as Save writes it.
+func (s *Store) Snapshot() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return json.MarshalIndent(s.state, "", "  ")
+}
+
 func (s *Store) Save() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -156,3 +1214,117 @@ func (s *Store) Save() error {
 	}
 	return os.Rename(tmp, s.path)
 }
+
+// SetRepoSubscription adds sub, replacing the chat's previous subscription
+// to the same repository.
+func (s *Store) SetRepoSubscription(sub RepoSubscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, old := range s.state.RepoSubscriptions {
+		if old.ChatID == sub.ChatID && old.Repo == sub.Repo {
+			s.state.RepoSubscriptions[i] = &sub
+			return
+		}
+	}
+	s.state.RepoSubscriptions = append(s.state.RepoSubscriptions, &sub)
+}
+
+// RemoveRepoSubscription unsubscribes chatID from repo and reports whether
+// it was subscribed.
+func (s *Store) RemoveRepoSubscription(chatID, repo string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, sub := range s.state.RepoSubscriptions {
+		if sub.ChatID == chatID && sub.Repo == repo {
+			s.state.RepoSubscriptions = append(s.state.RepoSubscriptions[:i], s.state.RepoSubscriptions[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// RepoSubscriptions returns copies of the subscriptions of chatID, or of
+// all chats when chatID is "".
+func (s *Store) RepoSubscriptions(chatID string) []RepoSubscription {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []RepoSubscription
+	for _, sub := range s.state.RepoSubscriptions {
+		if chatID == "" || sub.ChatID == chatID {
+			out = append(out, *sub)
+		}
+	}
+	return out
+}
+
+// StartIncident records inc as the chat's open incident. It reports false
+// when the chat already has one.
+func (s *Store) StartIncident(inc Incident) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.openIncident(inc.ChatID) != nil {
+		return false
+	}
+	s.state.Incidents = append(s.state.Incidents, &inc)
+	return true
+}
+
+func (s *Store) openIncident(chatID string) *Incident {
+	for _, inc := range s.state.Incidents {
+		if inc.ChatID == chatID && inc.EndedAt.IsZero() {
+			return inc
+		}
+	}
+	return nil
+}
+
+// OpenIncident returns a copy of the chat's open incident.
+func (s *Store) OpenIncident(chatID string) (Incident, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if inc := s.openIncident(chatID); inc != nil {
+		out := *inc
+		out.Timeline = append([]IncidentEvent(nil), inc.Timeline...)
+		return out, true
+	}
+	return Incident{}, false
+}
+
+// AddIncidentEvent appends ev to the timeline of the chat's open incident
+// and reports whether there is one.
+func (s *Store) AddIncidentEvent(chatID string, ev IncidentEvent) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inc := s.openIncident(chatID)
+	if inc == nil {
+		return false
+	}
+	inc.Timeline = append(inc.Timeline, ev)
+	return true
+}
+
+// UpdateIncident applies fn to incident id.
+func (s *Store) UpdateIncident(id string, fn func(*Incident)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, inc := range s.state.Incidents {
+		if inc.ID == id {
+			fn(inc)
+			return true
+		}
+	}
+	return false
+}
+
+// Incidents returns copies of the incidents of chatID, newest first.
+func (s *Store) Incidents(chatID string) []Incident {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Incident
+	for i := len(s.state.Incidents) - 1; i >= 0; i-- {
+		if inc := s.state.Incidents[i]; inc.ChatID == chatID {
+			out = append(out, *inc)
+		}
+	}
+	return out
+}
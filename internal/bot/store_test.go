@@ -1,9 +1,12 @@
 package bot
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestStoreLoadEmpty(t *testing.T) {
@@ -239,3 +242,153 @@ func TestStoreDocBindings(t *testing.T) {
 		t.Fatalf("expected a.md to be removed")
 	}
 }
+
+func TestStoreExecRecords(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore error: %v", err)
+	}
+
+	s.AddExecRecord(ExecRecord{ID: "a", ChatID: "chat1", Prompt: "first"})
+	s.AddExecRecord(ExecRecord{ID: "b", ChatID: "chat2", Prompt: "second"})
+	s.AddExecRecord(ExecRecord{ID: "c", ChatID: "chat1", Prompt: "third"})
+
+	all := s.ExecRecords("", 0)
+	if len(all) != 3 || all[0].ID != "c" || all[2].ID != "a" {
+		t.Fatalf("expected newest-first records, got %+v", all)
+	}
+	chat1 := s.ExecRecords("chat1", 0)
+	if len(chat1) != 2 || chat1[0].ID != "c" || chat1[1].ID != "a" {
+		t.Fatalf("expected chat1 records only, got %+v", chat1)
+	}
+	if limited := s.ExecRecords("", 1); len(limited) != 1 || limited[0].ID != "c" {
+		t.Fatalf("expected limit to keep newest, got %+v", limited)
+	}
+
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	s2, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("reload error: %v", err)
+	}
+	if got := s2.ExecRecords("chat2", 0); len(got) != 1 || got[0].Prompt != "second" {
+		t.Fatalf("records mismatch after reload: %+v", got)
+	}
+}
+
+func TestStoreExecRecords_Capped(t *testing.T) {
+	s, err := NewStore(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("NewStore error: %v", err)
+	}
+	for i := 0; i < maxExecRecords+10; i++ {
+		s.AddExecRecord(ExecRecord{ID: fmt.Sprintf("id%d", i), ChatID: "chat1"})
+	}
+	all := s.ExecRecords("", 0)
+	if len(all) != maxExecRecords {
+		t.Fatalf("expected %d records, got %d", maxExecRecords, len(all))
+	}
+	if all[len(all)-1].ID != "id10" {
+		t.Fatalf("expected oldest records dropped, oldest is %q", all[len(all)-1].ID)
+	}
+}
+
+func TestStoreExecRecords_OutputTruncated(t *testing.T) {
+	s, err := NewStore(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("NewStore error: %v", err)
+	}
+	s.AddExecRecord(ExecRecord{ID: "big", Output: strings.Repeat("x", maxRecordOutput+100) + "tail"})
+	rec := s.ExecRecords("", 1)[0]
+	if len([]rune(rec.Output)) != maxRecordOutput || !strings.HasSuffix(rec.Output, "tail") {
+		t.Fatalf("expected output trimmed to last %d runes, got len %d", maxRecordOutput, len([]rune(rec.Output)))
+	}
+}
+
+func TestStoreWatches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, _ := NewStore(path)
+	s.AddWatch(WatchRule{ID: "w1", ChatID: "chat1", Dir: "/repo", Glob: "*.go", Prompt: "test {{file}}", Enabled: true})
+	s.AddWatch(WatchRule{ID: "w2", ChatID: "chat2", Dir: "/repo", Glob: "*.md", Prompt: "review", Enabled: true})
+
+	if got := s.Watches("chat1"); len(got) != 1 || got[0].ID != "w1" {
+		t.Fatalf("expected chat1's rule, got %+v", got)
+	}
+	if got := s.Watches(""); len(got) != 2 {
+		t.Fatalf("expected all rules, got %+v", got)
+	}
+	if _, ok := s.SetWatchEnabled("chat2", "w1", false); ok {
+		t.Fatal("expected other chat's rule to be untouched")
+	}
+	if rule, ok := s.SetWatchEnabled("chat1", "w1", false); !ok || rule.Enabled {
+		t.Fatalf("expected rule to be disabled, got %+v, %v", rule, ok)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	s2, _ := NewStore(path)
+	if got := s2.Watches("chat1"); len(got) != 1 || got[0].Enabled || got[0].Glob != "*.go" {
+		t.Fatalf("expected persisted disabled rule, got %+v", got)
+	}
+	if s2.RemoveWatch("chat2", "w1") {
+		t.Fatal("expected remove from another chat to fail")
+	}
+	if !s2.RemoveWatch("chat1", "w1") || len(s2.Watches("")) != 1 {
+		t.Fatalf("expected rule to be removed, got %+v", s2.Watches(""))
+	}
+}
+
+func TestStoreHooks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, _ := NewStore(path)
+	s.AddHook(RepoHook{ID: "h1", ChatID: "chat1", Repo: "/repo", Token: "t1"})
+	s.AddHook(RepoHook{ID: "h2", ChatID: "chat2", Repo: "/repo", Token: "t2"})
+	s.AddHook(RepoHook{ID: "h3", ChatID: "chat1", Repo: "/repo", Token: "t3"})
+
+	if got := s.Hooks("chat1"); len(got) != 1 || got[0].ID != "h3" {
+		t.Fatalf("expected reinstall to replace chat1's hook, got %+v", got)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	s2, _ := NewStore(path)
+	if h, ok := s2.Hook("h2"); !ok || h.Token != "t2" {
+		t.Fatalf("expected persisted hook, got %+v, %v", h, ok)
+	}
+	if _, ok := s2.Hook("h1"); ok {
+		t.Fatal("expected replaced hook to be gone")
+	}
+	if _, ok := s2.RemoveHook("chat1", "/other"); ok {
+		t.Fatal("expected remove of unknown repo to fail")
+	}
+	if h, ok := s2.RemoveHook("chat1", "/repo"); !ok || h.ID != "h3" || len(s2.Hooks("")) != 1 {
+		t.Fatalf("expected hook to be removed, got %+v, %v", h, ok)
+	}
+}
+
+func TestStoreSecBaseline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, _ := NewStore(path)
+	if _, ok := s.SecBaseline("/repo"); ok {
+		t.Fatal("expected no baseline")
+	}
+	s.SetSecBaseline("/repo", SecBaseline{Fingerprints: []string{"gosec|G101|a.go|x"}, CreatedAt: time.Now()})
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	s2, _ := NewStore(path)
+	b, ok := s2.SecBaseline("/repo")
+	if !ok || len(b.Fingerprints) != 1 || b.CreatedAt.IsZero() {
+		t.Fatalf("expected persisted baseline, got %+v, %v", b, ok)
+	}
+	b.Fingerprints[0] = "changed"
+	if b2, _ := s2.SecBaseline("/repo"); b2.Fingerprints[0] != "gosec|G101|a.go|x" {
+		t.Fatal("expected SecBaseline to return a copy")
+	}
+}
@@ -0,0 +1,204 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// cloneTimeout bounds /clone, including submodules and LFS objects.
+const cloneTimeout = 10 * time.Minute
+
+// hasSubmodules reports whether the repository at repo declares submodules.
+func hasSubmodules(repo string) bool {
+	_, err := os.Stat(filepath.Join(repo, ".gitmodules"))
+	return err == nil
+}
+
+// usesLFS reports whether the repository at repo tracks files with Git LFS.
+func usesLFS(repo string) bool {
+	data, err := os.ReadFile(filepath.Join(repo, ".gitattributes"))
+	return err == nil && strings.Contains(string(data), "filter=lfs")
+}
+
+// lfsInstalled reports whether the git-lfs extension is available.
+func lfsInstalled() bool {
+	return exec.Command("git", "lfs", "version").Run() == nil
+}
+
+// updateSubmodulesAndLFS initializes and updates the submodules of repo
+// and downloads its LFS objects, when it has any. It returns one markdown
+// line per step taken and whether a step failed.
+func updateSubmodulesAndLFS(repo string) (notes []string, failed bool) {
+	if hasSubmodules(repo) {
+		out, err := runGitOutput(repo, "submodule", "update", "--init", "--recursive")
+		if err != nil {
+			notes = append(notes, "❌ 子模块更新失败: "+truncateRunes(orDash(out), 500))
+			failed = true
+		} else {
+			notes = append(notes, "✓ 子模块已初始化并更新到记录的提交")
+		}
+	}
+	if usesLFS(repo) {
+		if !lfsInstalled() {
+			notes = append(notes, "⚠️ 仓库使用 Git LFS，但未安装 git-lfs，LFS 文件仍是指针")
+			return notes, failed
+		}
+		if out, err := runGitOutput(repo, "lfs", "pull"); err != nil {
+			notes = append(notes, "❌ git lfs pull 失败: "+truncateRunes(orDash(out), 500))
+			failed = true
+		} else {
+			notes = append(notes, "✓ LFS 文件已下载")
+		}
+	}
+	return notes, failed
+}
+
+// submoduleSummary describes the submodules of repo for /status: how many
+// there are and how many are not initialized, at another commit than the
+// one recorded, or in conflict. It is "" when repo has none.
+func submoduleSummary(repo string) string {
+	if !hasSubmodules(repo) {
+		return ""
+	}
+	out, err := runGitOutput(repo, "submodule", "status", "--recursive")
+	if err != nil {
+		return ""
+	}
+	total, uninit, moved, conflict := 0, 0, 0, 0
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" {
+			continue
+		}
+		total++
+		switch line[0] {
+		case '-':
+			uninit++
+		case '+':
+			moved++
+		case 'U':
+			conflict++
+		}
+	}
+	if total == 0 {
+		return ""
+	}
+	parts := []string{fmt.Sprintf("%d 个", total)}
+	if uninit > 0 {
+		parts = append(parts, fmt.Sprintf("%d 个未初始化（/pull 会自动初始化）", uninit))
+	}
+	if moved > 0 {
+		parts = append(parts, fmt.Sprintf("%d 个不在记录的提交上", moved))
+	}
+	if conflict > 0 {
+		parts = append(parts, fmt.Sprintf("%d 个有冲突", conflict))
+	}
+	return strings.Join(parts, "，")
+}
+
+// lfsSummary describes the LFS files of repo for /status, or "" when repo
+// does not use LFS.
+func lfsSummary(repo string) string {
+	if !usesLFS(repo) {
+		return ""
+	}
+	if !lfsInstalled() {
+		return "仓库使用 LFS，但未安装 git-lfs"
+	}
+	out, err := runGitOutput(repo, "lfs", "ls-files")
+	if err != nil {
+		return ""
+	}
+	total, missing := 0, 0
+	for _, line := range strings.Split(out, "\n") {
+		// "<oid> * <path>" when downloaded, "<oid> - <path>" for a pointer.
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		total++
+		if fields[1] == "-" {
+			missing++
+		}
+	}
+	if missing > 0 {
+		return fmt.Sprintf("%d 个文件，%d 个未下载（/pull 会自动下载）", total, missing)
+	}
+	return fmt.Sprintf("%d 个文件", total)
+}
+
+// cloneDirName derives the directory /clone uses from a repository URL:
+// its last path element without ".git".
+func cloneDirName(url string) string {
+	url = strings.TrimSuffix(strings.TrimRight(url, "/"), ".git")
+	// scp-like addresses: git@host:owner/repo
+	return path.Base(strings.ReplaceAll(url, ":", "/"))
+}
+
+// cmdClone clones a repository under the work root with its submodules and
+// LFS objects.
+func (r *Router) cmdClone(ctx context.Context, chatID, args string) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 || len(fields) > 2 {
+		r.sender.SendText(ctx, chatID, "用法: /clone <仓库地址> [目录名]\n克隆到根目录下（默认目录名取自仓库地址），并初始化子模块、下载 LFS 文件。\n示例: /clone https://github.com/owner/repo.git")
+		return
+	}
+	url := fields[0]
+	name := cloneDirName(url)
+	if len(fields) == 2 {
+		name = fields[1]
+	}
+	root := r.store.WorkRoot()
+	target := filepath.Clean(filepath.Join(root, name))
+	if name == "" || name == "." || name == "/" || !underRoot(root, target) || target == root {
+		r.sender.SendText(ctx, chatID, "目录名无效，只能克隆到根目录 "+root+" 下。")
+		return
+	}
+	if _, err := os.Stat(target); err == nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("目录已存在: %s\n可指定其他目录名: /clone %s <目录名>", target, url))
+		return
+	}
+
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("⏳ 正在克隆 %s …", url))
+	cloneCtx, cancel := context.WithTimeout(ctx, cloneTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(cloneCtx, "git", "clone", "--recurse-submodules", "--", url, target)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		slog.WarnContext(ctx, "router: clone failed", "url", url, "err", err)
+		output := strings.TrimSpace(string(out))
+		if output == "" {
+			output = err.Error()
+		}
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "git clone 出错", Content: "```\n" + truncateRunes(output, 3000) + "\n```", Template: "red"})
+		return
+	}
+
+	// --recurse-submodules already checked out the submodules; LFS objects
+	// are only there when git-lfs was installed for the smudge filter.
+	var notes []string
+	failed := false
+	if usesLFS(target) {
+		notes, failed = updateSubmodulesAndLFS(target)
+	} else if line := submoduleSummary(target); line != "" {
+		notes = append(notes, "✓ 子模块: "+line)
+	}
+	content := fmt.Sprintf("**目录:** `%s`\n**分支:** %s", target, orDash(gitBranch(target)))
+	if len(notes) > 0 {
+		content += "\n" + strings.Join(notes, "\n")
+	}
+	rel, _ := filepath.Rel(root, target)
+	content += fmt.Sprintf("\n\n切换到该项目: `/cd %s`", filepath.ToSlash(rel))
+	tpl := "green"
+	if failed {
+		tpl = "orange"
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: "✓ 已克隆 " + name, Content: content, Template: tpl})
+}
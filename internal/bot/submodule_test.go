@@ -0,0 +1,147 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// superproject creates a repository with one submodule, "lib", and returns
+// its path. Local submodule URLs need protocol.file.allow.
+func superproject(t *testing.T, dir string) string {
+	t.Helper()
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "protocol.file.allow")
+	t.Setenv("GIT_CONFIG_VALUE_0", "always")
+	lib := filepath.Join(dir, "lib-upstream")
+	initTestRepo(t, lib, map[string]string{"lib.go": "package lib\n"})
+	super := filepath.Join(dir, "super")
+	git := initTestRepo(t, super, map[string]string{"main.go": "package main\n"})
+	git("submodule", "add", "-q", lib, "lib")
+	git("commit", "-m", "add lib")
+	return super
+}
+
+func TestGitStatusSummary_Submodule(t *testing.T) {
+	super := superproject(t, t.TempDir())
+	if got := gitStatusSummary(super); got != "无变更" {
+		t.Fatalf("expected clean, got %q", got)
+	}
+	os.WriteFile(filepath.Join(super, "lib", "lib.go"), []byte("package lib // changed\n"), 0644)
+	if got := gitStatusSummary(super); got != "1 个子模块有变更" {
+		t.Fatalf("expected a dirty submodule, got %q", got)
+	}
+	os.WriteFile(filepath.Join(super, "main.go"), []byte("package main // changed\n"), 0644)
+	if got := gitStatusSummary(super); got != "1 个文件变更，1 个子模块有变更" {
+		t.Fatalf("expected files and submodule counted apart, got %q", got)
+	}
+}
+
+func TestUpdateSubmodulesAndLFS_InitializesSubmodules(t *testing.T) {
+	dir := t.TempDir()
+	super := superproject(t, dir)
+	clone := filepath.Join(dir, "clone")
+	if out, err := exec.Command("git", "clone", "-q", super, clone).CombinedOutput(); err != nil {
+		t.Fatalf("git clone: %v\n%s", err, out)
+	}
+	if got := submoduleSummary(clone); got != "1 个，1 个未初始化（/pull 会自动初始化）" {
+		t.Fatalf("expected an uninitialized submodule, got %q", got)
+	}
+	notes, failed := updateSubmodulesAndLFS(clone)
+	if failed || len(notes) != 1 || !strings.Contains(notes[0], "子模块已初始化") {
+		t.Fatalf("unexpected notes %v %v", notes, failed)
+	}
+	if _, err := os.Stat(filepath.Join(clone, "lib", "lib.go")); err != nil {
+		t.Fatalf("submodule not checked out: %v", err)
+	}
+	if got := submoduleSummary(clone); got != "1 个" {
+		t.Fatalf("expected an up-to-date submodule, got %q", got)
+	}
+}
+
+func TestUpdateSubmodulesAndLFS_PlainRepo(t *testing.T) {
+	dir := t.TempDir()
+	initTestRepo(t, dir, map[string]string{"a.txt": "a\n"})
+	if notes, failed := updateSubmodulesAndLFS(dir); len(notes) != 0 || failed {
+		t.Fatalf("expected nothing to do, got %v %v", notes, failed)
+	}
+	if submoduleSummary(dir) != "" || lfsSummary(dir) != "" {
+		t.Fatal("expected no submodule or LFS summary")
+	}
+}
+
+func TestUpdateSubmodulesAndLFS_LFSWithoutGitLFS(t *testing.T) {
+	if lfsInstalled() {
+		t.Skip("git-lfs is installed")
+	}
+	dir := t.TempDir()
+	initTestRepo(t, dir, map[string]string{".gitattributes": "*.bin filter=lfs diff=lfs merge=lfs -text\n"})
+	notes, _ := updateSubmodulesAndLFS(dir)
+	if len(notes) != 1 || !strings.Contains(notes[0], "未安装 git-lfs") {
+		t.Fatalf("expected a git-lfs warning, got %v", notes)
+	}
+	if got := lfsSummary(dir); !strings.Contains(got, "未安装 git-lfs") {
+		t.Fatalf("unexpected LFS summary %q", got)
+	}
+}
+
+func TestCloneDirName(t *testing.T) {
+	cases := map[string]string{
+		"https://github.com/owner/repo.git": "repo",
+		"https://github.com/owner/repo/":    "repo",
+		"git@github.com:owner/repo.git":     "repo",
+		"git@host:repo.git":                 "repo",
+		"/srv/git/project":                  "project",
+	}
+	for url, want := range cases {
+		if got := cloneDirName(url); got != want {
+			t.Errorf("cloneDirName(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
+
+func TestRouterClone_WithSubmodules(t *testing.T) {
+	r, sender := newTestRouter(t)
+	super := superproject(t, t.TempDir())
+	r.Route(context.Background(), "chat1", "user1", "/clone "+super+" cloned")
+
+	root := r.store.WorkRoot()
+	if _, err := os.Stat(filepath.Join(root, "cloned", "lib", "lib.go")); err != nil {
+		t.Fatalf("submodule not cloned: %v", err)
+	}
+	msg := sender.LastMessage()
+	if !strings.Contains(msg, "已克隆 cloned") || !strings.Contains(msg, "子模块: 1 个") || !strings.Contains(msg, "/cd cloned") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/clone "+super+" cloned")
+	if !strings.Contains(sender.LastMessage(), "目录已存在") {
+		t.Fatalf("expected an existing directory error, got %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/clone "+super+" ../outside")
+	if !strings.Contains(sender.LastMessage(), "目录名无效") {
+		t.Fatalf("expected an invalid directory error, got %q", sender.LastMessage())
+	}
+}
+
+func TestRouterPull_UpdatesSubmodules(t *testing.T) {
+	r, sender := newTestRouter(t)
+	dir := r.store.WorkRoot()
+	super := superproject(t, dir)
+	clone := filepath.Join(dir, "clone")
+	if out, err := exec.Command("git", "clone", "-q", super, clone).CombinedOutput(); err != nil {
+		t.Fatalf("git clone: %v\n%s", err, out)
+	}
+	r.getSession("chat1")
+	r.store.UpdateSession("chat1", func(s *Session) { s.WorkDir = clone })
+	r.Route(context.Background(), "chat1", "user1", "/pull")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "git pull 成功") || !strings.Contains(msg, "子模块已初始化") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	if _, err := os.Stat(filepath.Join(clone, "lib", "lib.go")); err != nil {
+		t.Fatalf("submodule not initialized: %v", err)
+	}
+}
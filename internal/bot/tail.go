@@ -0,0 +1,466 @@
+package bot
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTailLines = 50
+	maxTailLines     = 500
+	// defaultTailFollow and maxTailFollow bound /tail follow.
+	defaultTailFollow = 2 * time.Minute
+	maxTailFollow     = 10 * time.Minute
+	// maxTailRead is how much of the end of a log file /tail reads.
+	maxTailRead = 1 << 20
+)
+
+// tailBatchInterval is how often /tail follow sends the lines collected
+// since the last update.
+var tailBatchInterval = 5 * time.Second
+
+// SetTailServices sets the services /tail can read besides files in the
+// workdir, keyed by name. Values are "systemd:<unit>" or
+// "docker:<container>".
+func (r *Router) SetTailServices(services map[string]string) {
+	r.tailServices = services
+}
+
+// validTailService reports whether spec names a supported log source.
+func validTailService(spec string) bool {
+	kind, name, ok := strings.Cut(spec, ":")
+	return ok && name != "" && (kind == "systemd" || kind == "docker")
+}
+
+// tailServiceCmd returns the command printing the last n lines of the
+// service described by spec, following new output if follow is set.
+func tailServiceCmd(ctx context.Context, spec string, n int, follow bool) *exec.Cmd {
+	kind, name, _ := strings.Cut(spec, ":")
+	var args []string
+	if kind == "systemd" {
+		args = []string{"journalctl", "-u", name, "-n", strconv.Itoa(n), "--no-pager", "-o", "short-iso"}
+		if follow {
+			args = append(args, "-f")
+		}
+	} else {
+		args = []string{"docker", "logs", "--tail", strconv.Itoa(n), "--timestamps"}
+		if follow {
+			args = append(args, "-f")
+		}
+		args = append(args, name)
+	}
+	return exec.CommandContext(ctx, args[0], args[1:]...)
+}
+
+// lastLines returns the last n lines of data.
+func lastLines(data string, n int) []string {
+	lines := strings.Split(strings.TrimRight(data, "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return nil
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// tailFile returns the last n lines of the file at path.
+func tailFile(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := info.Size() - maxTailRead
+	if offset < 0 {
+		offset = 0
+	}
+	data, err := io.ReadAll(io.NewSectionReader(f, offset, info.Size()-offset))
+	if err != nil {
+		return nil, err
+	}
+	text := string(data)
+	if offset > 0 {
+		// The first line was cut by the read window.
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			text = text[i+1:]
+		}
+	}
+	return lastLines(text, n), nil
+}
+
+// maxRangeLineChars caps the lines /head and /file ranges show, so one
+// minified or binary line cannot fill a card.
+const maxRangeLineChars = 1000
+
+// readLineRange returns lines first..last (1-based, inclusive) of the file
+// at path and the file's total line count. It streams the file, so large
+// logs are never loaded whole.
+func readLineRange(path string, first, last int) ([]string, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	var lines []string
+	total := 0
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			total++
+			if total >= first && total <= last {
+				lines = append(lines, truncateRunes(strings.TrimRight(line, "\r\n"), maxRangeLineChars))
+			}
+		}
+		if err == io.EOF {
+			return lines, total, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// numberedLines renders lines starting at line number first the way /file
+// shows them.
+func numberedLines(first int, lines []string) string {
+	var sb strings.Builder
+	for i, line := range lines {
+		fmt.Fprintf(&sb, "%4d  %s\n", first+i, line)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// cmdHead shows the first lines of a file in the workdir, numbered so a
+// section can be opened with /file <path>:<start>-<end>.
+func (r *Router) cmdHead(ctx context.Context, chatID, args string) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 || len(fields) > 2 {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("用法: /head <文件> [行数]\n示例: /head logs/app.log 100\n行数默认 %d（最多 %d）。", defaultTailLines, maxTailLines))
+		return
+	}
+	n := defaultTailLines
+	if len(fields) == 2 {
+		v, err := strconv.Atoi(fields[1])
+		if err != nil || v <= 0 {
+			r.sender.SendText(ctx, chatID, "行数必须是正整数。")
+			return
+		}
+		n = v
+	}
+	if n > maxTailLines {
+		n = maxTailLines
+	}
+	path := r.readablePath(r.getSession(chatID).WorkDir, fields[0])
+	if path == "" {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("文件不存在: %s", fields[0]))
+		return
+	}
+	lines, total, err := readLineRange(path, 1, n)
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("读取文件出错: %v", err))
+		return
+	}
+	if total == 0 {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("%s 是空文件。", fields[0]))
+		return
+	}
+	output, full := r.fitOutput(chatID, "head", cleanTerminal(numberedLines(1, lines)), false, "内容过长")
+	r.sender.SendCard(ctx, chatID, CardMsg{
+		Title:   fmt.Sprintf("%s（前 %d 行，共 %d 行）", filepath.Base(path), len(lines), total),
+		Content: "```" + langForPath(path) + "\n" + output + "\n```",
+	})
+	r.sendFullOutput(ctx, chatID, full)
+}
+
+// tailSource resolves a /tail target to either a file path or a service
+// spec.
+func (r *Router) tailSource(workDir, target string) (path, service string) {
+	if spec, ok := r.tailServices[target]; ok {
+		return "", spec
+	}
+	return r.readablePath(workDir, target), ""
+}
+
+// parseTailDuration parses the /tail follow duration: seconds or a Go
+// duration such as "5m".
+func parseTailDuration(s string) (time.Duration, bool) {
+	if n, err := strconv.Atoi(s); err == nil && n > 0 {
+		return time.Duration(n) * time.Second, true
+	}
+	d, err := time.ParseDuration(s)
+	return d, err == nil && d > 0
+}
+
+func (r *Router) cmdTail(ctx context.Context, chatID, args string) {
+	fields := strings.Fields(args)
+	usage := "用法: /tail <文件|服务> [行数]\n       /tail follow <文件|服务> [时长]\n       /tail stop\n示例: /tail logs/app.log 100\n示例: /tail follow api 5m\n行数默认 50（最多 500）；follow 默认跟踪 2 分钟（最多 10 分钟），每 5 秒发送一次新增日志。"
+	if len(fields) == 0 {
+		r.sender.SendText(ctx, chatID, usage)
+		return
+	}
+	switch fields[0] {
+	case "stop":
+		if !r.stopTail(chatID) {
+			r.sender.SendText(ctx, chatID, "当前没有正在跟踪的日志。")
+		}
+		return
+	case "follow":
+		d := defaultTailFollow
+		if len(fields) < 2 || len(fields) > 3 {
+			r.sender.SendText(ctx, chatID, usage)
+			return
+		}
+		if len(fields) == 3 {
+			var ok bool
+			if d, ok = parseTailDuration(fields[2]); !ok {
+				r.sender.SendText(ctx, chatID, usage)
+				return
+			}
+		}
+		if d > maxTailFollow {
+			d = maxTailFollow
+		}
+		r.followTail(ctx, chatID, fields[1], d)
+		return
+	}
+
+	n := defaultTailLines
+	if len(fields) > 2 {
+		r.sender.SendText(ctx, chatID, usage)
+		return
+	}
+	if len(fields) == 2 {
+		v, err := strconv.Atoi(fields[1])
+		if err != nil || v <= 0 {
+			r.sender.SendText(ctx, chatID, usage)
+			return
+		}
+		n = v
+	}
+	if n > maxTailLines {
+		n = maxTailLines
+	}
+
+	target := fields[0]
+	path, service := r.tailSource(r.getSession(chatID).WorkDir, target)
+	var lines []string
+	switch {
+	case service != "":
+		execCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		out, err := tailServiceCmd(execCtx, service, n, false).CombinedOutput()
+		if err != nil {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("读取 %s 日志失败: %s", target, truncateForDisplay(strings.TrimSpace(string(out)+"\n"+err.Error()), 1000)))
+			return
+		}
+		lines = lastLines(string(out), n)
+	case path != "":
+		var err error
+		if lines, err = tailFile(path, n); err != nil {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("读取文件出错: %v", err))
+			return
+		}
+	default:
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("找不到文件或服务: %s", target))
+		return
+	}
+
+	if len(lines) == 0 {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("%s 暂无日志。", target))
+		return
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{
+		Title:   fmt.Sprintf("%s（最后 %d 行）", target, len(lines)),
+		Content: "```\n" + truncateTail(cleanTerminal(strings.Join(lines, "\n")), 8000) + "\n```",
+	})
+}
+
+// truncateTail keeps the end of s within max runes, since the newest log
+// lines matter most.
+func truncateTail(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return "...\n" + string(runes[len(runes)-max:])
+}
+
+// tailFollow is a running /tail follow.
+type tailFollow struct {
+	cancel  context.CancelFunc
+	stopped bool // ended by /tail stop or a newer follow
+}
+
+// followTail starts sending new lines of target to the chat every
+// tailBatchInterval for duration d, replacing any earlier follow.
+func (r *Router) followTail(ctx context.Context, chatID, target string, d time.Duration) {
+	path, service := r.tailSource(r.getSession(chatID).WorkDir, target)
+	if path == "" && service == "" {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("找不到文件或服务: %s", target))
+		return
+	}
+	r.stopTail(chatID)
+
+	followCtx, cancel := context.WithTimeout(r.ctx, d)
+	follow := &tailFollow{cancel: cancel}
+	r.mu.Lock()
+	r.tails[chatID] = follow
+	r.mu.Unlock()
+
+	var mu sync.Mutex
+	var pending []string
+	add := func(line string) {
+		mu.Lock()
+		pending = append(pending, line)
+		mu.Unlock()
+	}
+
+	var producerDone chan error
+	if service != "" {
+		cmd := tailServiceCmd(followCtx, service, 0, true)
+		producerDone = make(chan error, 1)
+		go func() {
+			_, err := streamCommand(cmd, add)
+			producerDone <- err
+		}()
+	} else {
+		var offset int64
+		if info, err := os.Stat(path); err == nil {
+			offset = info.Size()
+		}
+		go pollFile(followCtx, path, offset, add)
+	}
+
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("开始跟踪 %s，持续 %s（/tail stop 停止）", target, d))
+	go func() {
+		defer cancel()
+		ticker := time.NewTicker(tailBatchInterval)
+		defer ticker.Stop()
+		total := 0
+		flush := func() {
+			mu.Lock()
+			batch := pending
+			pending = nil
+			mu.Unlock()
+			if len(batch) == 0 {
+				return
+			}
+			total += len(batch)
+			r.sender.SendCard(r.ctx, chatID, CardMsg{
+				Content: fmt.Sprintf("**%s** 新增 %d 行\n```\n%s\n```", target, len(batch), truncateTail(cleanTerminal(strings.Join(batch, "\n")), 3000)),
+			})
+		}
+		reason := "已到时，结束"
+	loop:
+		for {
+			select {
+			case <-ticker.C:
+				flush()
+			case err := <-producerDone:
+				flush()
+				if followCtx.Err() == nil {
+					reason = "日志输出已结束，停止"
+					if err != nil {
+						reason = fmt.Sprintf("读取日志出错（%v），停止", err)
+					}
+				}
+				break loop
+			case <-followCtx.Done():
+				flush()
+				break loop
+			}
+		}
+		r.mu.Lock()
+		if r.tails[chatID] == follow {
+			delete(r.tails, chatID)
+		}
+		stopped := follow.stopped
+		r.mu.Unlock()
+		if stopped {
+			reason = "已停止"
+		}
+		r.sender.SendText(r.ctx, chatID, fmt.Sprintf("%s跟踪 %s（共 %d 行）", reason, target, total))
+	}()
+}
+
+// stopTail ends the chat's /tail follow, reporting whether one was running.
+func (r *Router) stopTail(chatID string) bool {
+	r.mu.Lock()
+	follow := r.tails[chatID]
+	if follow != nil {
+		follow.stopped = true
+		delete(r.tails, chatID)
+	}
+	r.mu.Unlock()
+	if follow == nil {
+		return false
+	}
+	follow.cancel()
+	return true
+}
+
+// pollFile calls add for every line appended to path after offset until
+// ctx is done. A file that shrinks (truncated or rotated) is read again
+// from the start.
+func pollFile(ctx context.Context, path string, offset int64, add func(string)) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	var partial string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if info.Size() < offset {
+			offset, partial = 0, ""
+		}
+		if info.Size() == offset {
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		data, err := io.ReadAll(io.NewSectionReader(f, offset, info.Size()-offset))
+		f.Close()
+		if err != nil {
+			continue
+		}
+		offset += int64(len(data))
+		sc := bufio.NewScanner(strings.NewReader(partial + string(data)))
+		sc.Buffer(make([]byte, 64*1024), maxTailRead)
+		partial = ""
+		var lines []string
+		for sc.Scan() {
+			lines = append(lines, sc.Text())
+		}
+		// Hold back an unterminated last line until it is complete.
+		if len(lines) > 0 && !strings.HasSuffix(string(data), "\n") {
+			partial = lines[len(lines)-1]
+			lines = lines[:len(lines)-1]
+		}
+		for _, l := range lines {
+			add(l)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTailFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	var sb strings.Builder
+	for i := 1; i <= 100; i++ {
+		fmt.Fprintf(&sb, "line %d\n", i)
+	}
+	os.WriteFile(path, []byte(sb.String()), 0644)
+	lines, err := tailFile(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(lines, ",") != "line 98,line 99,line 100" {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+	os.WriteFile(path, nil, 0644)
+	if lines, _ := tailFile(path, 3); len(lines) != 0 {
+		t.Fatalf("expected no lines for an empty file, got %q", lines)
+	}
+}
+
+func TestTailServiceCmd(t *testing.T) {
+	cmd := tailServiceCmd(context.Background(), "systemd:api.service", 20, true)
+	if got := strings.Join(cmd.Args, " "); got != "journalctl -u api.service -n 20 --no-pager -o short-iso -f" {
+		t.Fatalf("unexpected command %q", got)
+	}
+	cmd = tailServiceCmd(context.Background(), "docker:web", 5, false)
+	if got := strings.Join(cmd.Args, " "); got != "docker logs --tail 5 --timestamps web" {
+		t.Fatalf("unexpected command %q", got)
+	}
+	for spec, want := range map[string]bool{"systemd:a": true, "docker:b": true, "docker:": false, "k8s:c": false, "api": false} {
+		if validTailService(spec) != want {
+			t.Errorf("validTailService(%q) != %v", spec, want)
+		}
+	}
+}
+
+func TestRouterTail_File(t *testing.T) {
+	r, sender := newTestRouter(t)
+	dir := r.getSession("chat1").WorkDir
+	os.MkdirAll(filepath.Join(dir, "logs"), 0755)
+	os.WriteFile(filepath.Join(dir, "logs", "app.log"), []byte("starting\nlistening on :8080\npanic: nil map\n"), 0644)
+
+	r.Route(context.Background(), "chat1", "user1", "/tail logs/app.log 2")
+	msg := sender.LastMessage()
+	if !strings.HasPrefix(msg, "logs/app.log（最后 2 行）") || strings.Contains(msg, "starting") || !strings.Contains(msg, "panic: nil map") {
+		t.Fatalf("unexpected tail card %q", msg)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/tail missing.log")
+	if !strings.Contains(sender.LastMessage(), "找不到文件或服务") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/tail logs/app.log many")
+	if !strings.HasPrefix(sender.LastMessage(), "用法:") {
+		t.Fatalf("expected usage, got %q", sender.LastMessage())
+	}
+}
+
+func TestRouterTail_Service(t *testing.T) {
+	r, sender := newTestRouter(t)
+	out := fakeScanner(t, "journalctl")
+	os.WriteFile(out, []byte("Oct 17 api[1]: ready\n"), 0644)
+	r.SetTailServices(map[string]string{"api": "systemd:api.service"})
+
+	// The fake exits 1, which surfaces as a read failure.
+	r.Route(context.Background(), "chat1", "user1", "/tail api")
+	if msg := sender.LastMessage(); !strings.HasPrefix(msg, "读取 api 日志失败") || !strings.Contains(msg, "api[1]: ready") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+}
+
+func TestRouterTail_Follow(t *testing.T) {
+	r, _ := newTestRouter(t)
+	sender := &syncSpySender{}
+	r.sender = sender
+	interval := tailBatchInterval
+	tailBatchInterval = 50 * time.Millisecond
+	t.Cleanup(func() { tailBatchInterval = interval })
+
+	path := filepath.Join(r.getSession("chat1").WorkDir, "app.log")
+	os.WriteFile(path, []byte("old line\n"), 0644)
+	r.Route(context.Background(), "chat1", "user1", "/tail follow app.log 1m")
+	if !strings.HasPrefix(sender.LastMessage(), "开始跟踪 app.log，持续 1m0s") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("GET /health 200\nGET /api")
+	f.Sync()
+	waitFor(t, func() bool {
+		return strings.Contains(sender.LastMessage(), "**app.log** 新增 1 行")
+	})
+	if msg := sender.LastMessage(); !strings.Contains(msg, "GET /health 200") || strings.Contains(msg, "old line") || strings.Contains(msg, "GET /api") {
+		t.Fatalf("expected only the new complete line, got %q", msg)
+	}
+	f.WriteString(" 500\n")
+	f.Close()
+	waitFor(t, func() bool {
+		return strings.Contains(sender.LastMessage(), "GET /api 500")
+	})
+
+	r.Route(context.Background(), "chat1", "user1", "/tail stop")
+	waitFor(t, func() bool {
+		return sender.LastMessage() == "已停止跟踪 app.log（共 2 行）"
+	})
+	r.Route(context.Background(), "chat1", "user1", "/tail stop")
+	if sender.LastMessage() != "当前没有正在跟踪的日志。" {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+}
+
+func TestRouterTail_FollowServiceEnds(t *testing.T) {
+	r, _ := newTestRouter(t)
+	sender := &syncSpySender{}
+	r.sender = sender
+	interval := tailBatchInterval
+	tailBatchInterval = 50 * time.Millisecond
+	t.Cleanup(func() { tailBatchInterval = interval })
+
+	bin := t.TempDir()
+	os.WriteFile(filepath.Join(bin, "docker"), []byte("#!/bin/sh\necho \"$@\"\n"), 0755)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	r.SetTailServices(map[string]string{"web": "docker:web"})
+
+	r.Route(context.Background(), "chat1", "user1", "/tail follow web 30")
+	waitFor(t, func() bool {
+		return sender.LastMessage() == "日志输出已结束，停止跟踪 web（共 1 行）"
+	})
+	var batch string
+	for _, m := range sender.Messages() {
+		if strings.Contains(m, "**web** 新增 1 行") {
+			batch = m
+		}
+	}
+	if !strings.Contains(batch, "logs --tail 0 --timestamps -f web") {
+		t.Fatalf("expected the follow command output, got %v", sender.Messages())
+	}
+}
+
+func TestReadLineRange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	os.WriteFile(path, []byte("one\r\ntwo\nthree\nfour"), 0644)
+
+	lines, total, err := readLineRange(path, 2, 3)
+	if err != nil || total != 4 || strings.Join(lines, ",") != "two,three" {
+		t.Fatalf("unexpected range %q total=%d err=%v", lines, total, err)
+	}
+	lines, total, _ = readLineRange(path, 10, 20)
+	if len(lines) != 0 || total != 4 {
+		t.Fatalf("expected no lines past the end, got %q total=%d", lines, total)
+	}
+}
+
+func TestRouterHead(t *testing.T) {
+	r, sender := newTestRouter(t)
+	dir := r.getSession("chat1").WorkDir
+	var sb strings.Builder
+	for i := 1; i <= 300; i++ {
+		fmt.Fprintf(&sb, "entry %d\n", i)
+	}
+	os.WriteFile(filepath.Join(dir, "app.log"), []byte(sb.String()), 0644)
+
+	r.Route(context.Background(), "chat1", "user1", "/head app.log 3")
+	msg := sender.LastMessage()
+	if !strings.HasPrefix(msg, "app.log（前 3 行，共 300 行）") || !strings.Contains(msg, "   3  entry 3") || strings.Contains(msg, "entry 4") {
+		t.Fatalf("unexpected head card %q", msg)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/head missing.log")
+	if !strings.Contains(sender.LastMessage(), "文件不存在") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/head app.log x")
+	if !strings.Contains(sender.LastMessage(), "正整数") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+}
@@ -0,0 +1,110 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// canManageExec reports whether the user in ctx may stop or dequeue, from
+// chatID, an execution of owner: their own chat's, or any chat's as an
+// admin (who sees them all in /tasks).
+func (r *Router) canManageExec(ctx context.Context, chatID, owner string) bool {
+	return owner == chatID || r.userRole(userIDFrom(ctx)) == RoleAdmin
+}
+
+// cmdTasks lists the executions running and waiting in every chat.
+func (r *Router) cmdTasks(ctx context.Context, chatID string) {
+	running := r.ActiveExecs()
+	var waiting []ExecRecord
+	if r.queue != nil {
+		for _, owner := range sortedKeys(r.queue.Snapshot()) {
+			for _, entry := range r.queue.Waiting(owner) {
+				rec, ok := r.queuedExec(entry.ID)
+				if !ok {
+					rec = ExecRecord{ID: entry.ID, ChatID: owner, Urgent: entry.Urgent}
+				}
+				waiting = append(waiting, rec)
+			}
+		}
+	}
+	if len(running) == 0 && len(waiting) == 0 {
+		r.sender.SendText(ctx, chatID, "当前没有执行中或排队的任务。")
+		return
+	}
+
+	line := func(rec ExecRecord, age string) string {
+		mark := ""
+		if rec.Urgent {
+			mark = "⚡ "
+		}
+		return fmt.Sprintf("- `%s` %s · %s · %s%s\n", orDash(rec.ID), rec.ChatID, age, mark, truncateRunes(strings.Join(strings.Fields(rec.Prompt), " "), 50))
+	}
+	var sb strings.Builder
+	if len(running) > 0 {
+		fmt.Fprintf(&sb, "**执行中（%d）:**\n", len(running))
+		for _, rec := range running {
+			sb.WriteString(line(rec, "已运行 "+time.Since(rec.StartedAt).Truncate(time.Second).String()))
+		}
+	}
+	if len(waiting) > 0 {
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "**排队中（%d）:**\n", len(waiting))
+		for _, rec := range waiting {
+			age := "-"
+			if !rec.StartedAt.IsZero() {
+				age = "已等待 " + time.Since(rec.StartedAt).Truncate(time.Second).String()
+			}
+			sb.WriteString(line(rec, age))
+		}
+	}
+	if r.queue != nil {
+		if _, _, workers := r.queue.PoolStats(); workers > 0 {
+			fmt.Fprintf(&sb, "\n并发上限: %d\n", workers)
+		}
+	}
+	sb.WriteString("\n`/kill <ID>` 终止执行中的任务，`/dequeue <ID>` 取消排队的任务。")
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("任务（执行中 %d · 排队 %d）", len(running), len(waiting)), Content: sb.String()})
+}
+
+// cmdDequeue cancels a waiting execution.
+func (r *Router) cmdDequeue(ctx context.Context, chatID, args string) {
+	id := strings.TrimSpace(args)
+	if id == "" {
+		r.sender.SendText(ctx, chatID, "用法: /dequeue <执行ID>\n取消一个排队中的任务（/queue 或 /tasks 查看 ID）。")
+		return
+	}
+	r.dequeueExec(ctx, chatID, id)
+}
+
+// dequeueExec takes waiting execution id out of the queue, telling its
+// chat when an admin does so from another chat.
+func (r *Router) dequeueExec(ctx context.Context, chatID, id string) {
+	rec, ok := r.queuedExec(id)
+	if !ok || !r.canManageExec(ctx, chatID, rec.ChatID) {
+		r.mu.Lock()
+		active, running := r.active[id]
+		r.mu.Unlock()
+		if running && r.canManageExec(ctx, chatID, active.ChatID) {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("执行 %s 已开始，使用 /kill %s 终止。", id, id))
+			return
+		}
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("队列中没有执行: %s", id))
+		return
+	}
+	if r.queue == nil || !r.queue.Remove(rec.ChatID, id) {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("执行 %s 已开始，使用 /kill %s 终止。", id, id))
+		return
+	}
+	r.clearQueued(id)
+	slog.InfoContext(ctx, "router: dequeued", "exec_id", id, "owner_chat", rec.ChatID)
+	prompt := truncateRunes(strings.Join(strings.Fields(rec.Prompt), " "), 60)
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已取消排队的执行 %s: %s", id, prompt))
+	if rec.ChatID != chatID {
+		r.sender.SendText(ctx, rec.ChatID, fmt.Sprintf("排队的执行 %s 已被管理员取消: %s", id, prompt))
+	}
+}
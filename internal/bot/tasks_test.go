@@ -0,0 +1,70 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTasksAndDequeue(t *testing.T) {
+	r, sender := newRolesRouter(t)
+	r.SetAdmins(map[string]bool{"admin": true})
+	q := NewMessageQueue()
+	r.SetQueue(q)
+	ctx := context.Background()
+
+	r.Route(ctx, "chat9", "admin", "/tasks")
+	if !strings.Contains(sender.LastMessage(), "没有执行中或排队的任务") {
+		t.Fatalf("expected empty notice, got %q", sender.LastMessage())
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	q.EnqueueTask("chat1", QueueEntry{ID: "blocker"}, func() {
+		close(started)
+		<-release
+	})
+	<-started
+	r.setActive(ExecRecord{ID: "blocker", ChatID: "chat1", Prompt: "long build"})
+	first, _ := r.enqueueExec(ctx, "chat1", "refactor the parser", execOptions{})
+	second, _ := r.enqueueExec(ctx, "chat1", "write the docs", execOptions{})
+
+	r.Route(ctx, "chat2", "op", "/tasks")
+	if !strings.Contains(sender.LastMessage(), "仅限管理员") {
+		t.Fatalf("expected /tasks to need an admin, got %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat9", "admin", "/tasks")
+	msg := sender.LastMessage()
+	for _, want := range []string{"执行中 1 · 排队 2", "`blocker` chat1", "long build", "`" + first + "` chat1", "refactor the parser", "write the docs"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected %q in /tasks, got %q", want, msg)
+		}
+	}
+
+	// Operators manage their own chat only.
+	r.Route(ctx, "chat2", "op", "/dequeue "+first)
+	if !strings.Contains(sender.LastMessage(), "队列中没有执行") {
+		t.Fatalf("expected another chat's task to be out of reach, got %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "op", "/kill "+second)
+	if !strings.Contains(sender.LastMessage(), "已取消排队的执行 "+second) {
+		t.Fatalf("expected /kill to dequeue, got %q", sender.LastMessage())
+	}
+
+	// Admins may dequeue from anywhere; the owning chat is told.
+	r.Route(ctx, "chat9", "admin", "/dequeue "+first)
+	msgs := sender.messages
+	if !strings.Contains(msgs[len(msgs)-2], "已取消排队的执行 "+first) || !strings.Contains(msgs[len(msgs)-1], "已被管理员取消") {
+		t.Fatalf("expected admin dequeue and notice, got %v", msgs[len(msgs)-2:])
+	}
+	if w := q.Waiting("chat1"); len(w) != 0 {
+		t.Fatalf("expected an empty queue, got %+v", w)
+	}
+	r.Route(ctx, "chat1", "op", "/dequeue blocker")
+	if !strings.Contains(sender.LastMessage(), "已开始") {
+		t.Fatalf("expected running notice, got %q", sender.LastMessage())
+	}
+
+	close(release)
+	q.Shutdown()
+}
@@ -0,0 +1,106 @@
+package bot
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// minRepeatCollapse is how many identical consecutive lines cleanTerminal
+// folds into one.
+const minRepeatCollapse = 3
+
+// ansiEscape matches CSI sequences (colors, cursor movement, erase line),
+// OSC sequences (window titles, hyperlinks), charset designators and other
+// two-byte escapes.
+var ansiEscape = regexp.MustCompile(`\x1b(?:\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(?:\x07|\x1b\\)?|[()][0-9A-Za-z]|[@-_])`)
+
+// cleanTerminal turns raw terminal output into plain text for a card: ANSI
+// escapes are stripped (output is shown in code blocks, where markdown
+// emphasis would not render anyway), a line rewritten with carriage returns
+// keeps only its last state, backspaces erase the preceding character, and
+// runs of identical lines collapse into one with a repeat count.
+func cleanTerminal(text string) string {
+	if !strings.ContainsAny(text, "\x1b\r\b") && !hasRepeatedLines(text) {
+		return text
+	}
+	text = ansiEscape.ReplaceAllString(text, "")
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+	prev, repeats := "", 0
+	flush := func() {
+		if repeats >= minRepeatCollapse {
+			out = append(out, fmt.Sprintf("（同上，共 %d 行）", repeats))
+		} else {
+			for i := 1; i < repeats; i++ {
+				out = append(out, prev)
+			}
+		}
+	}
+	for i, line := range lines {
+		line = cleanLine(line)
+		if i > 0 && line == prev && strings.TrimSpace(line) != "" {
+			repeats++
+			continue
+		}
+		if i > 0 {
+			flush()
+		}
+		out = append(out, line)
+		prev, repeats = line, 1
+	}
+	flush()
+	return strings.Join(out, "\n")
+}
+
+// hasRepeatedLines reports whether text has minRepeatCollapse identical
+// non-blank lines in a row, so cleanTerminal can skip clean output cheaply.
+func hasRepeatedLines(text string) bool {
+	prev, n := "", 0
+	for _, line := range strings.Split(text, "\n") {
+		if line == prev && strings.TrimSpace(line) != "" {
+			n++
+			if n >= minRepeatCollapse {
+				return true
+			}
+			continue
+		}
+		prev, n = line, 1
+	}
+	return false
+}
+
+// cleanLine resolves carriage returns and backspaces in a single line and
+// drops the remaining control characters except tabs.
+func cleanLine(line string) string {
+	line = strings.TrimSuffix(line, "\r")
+	if strings.Contains(line, "\r") {
+		// Progress bars redraw the line after \r; keep the last non-empty
+		// state.
+		segs := strings.Split(line, "\r")
+		line = segs[len(segs)-1]
+		for j := len(segs) - 1; j >= 0 && strings.TrimSpace(line) == ""; j-- {
+			line = segs[j]
+		}
+	}
+	if strings.IndexFunc(line, isControl) < 0 {
+		return line
+	}
+	var buf []rune
+	for _, c := range line {
+		switch {
+		case c == '\b':
+			if len(buf) > 0 {
+				buf = buf[:len(buf)-1]
+			}
+		case isControl(c):
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return string(buf)
+}
+
+func isControl(c rune) bool {
+	return (c < 0x20 && c != '\t') || c == 0x7f
+}
@@ -0,0 +1,36 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCleanTerminal(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"plain\noutput", "plain\noutput"},
+		{"\x1b[1;31mFAIL\x1b[0m pkg\x1b[K", "FAIL pkg"},
+		{"\x1b]0;title\x07ok \x1b]8;;http://x\x1b\\link\x1b]8;;\x1b\\", "ok link"},
+		{"\x1b(B\x1b[mdone", "done"},
+		{"  10%\r  50%\r 100%\r\nnext", " 100%\nnext"},
+		{"done\r   \r", "done"},
+		{"abc\b\bX", "aX"},
+		{"a\nwait\nwait\nwait\nwait\nb", "a\nwait\n（同上，共 4 行）\nb"},
+		{"x\nx\ny", "x\nx\ny"},
+		{"\n\n\n", "\n\n\n"},
+	}
+	for _, c := range cases {
+		if got := cleanTerminal(c.in); got != c.want {
+			t.Errorf("cleanTerminal(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestRouterExecStripsANSI(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", `/exec printf '\033[32mok\033[0m\n'; for i in 1 2 3; do printf 'step %d\r' $i; done; echo`)
+	msg := sender.LastMessage()
+	if strings.Contains(msg, "\x1b") || strings.Contains(msg, "\r") || !strings.Contains(msg, "ok\nstep 3") {
+		t.Fatalf("unexpected output %q", msg)
+	}
+}
@@ -0,0 +1,199 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// shardedTestTimeout bounds a sharded /test run as a whole.
+	shardedTestTimeout = 10 * time.Minute
+	// slowestTestPackages is how many packages the timing report lists.
+	slowestTestPackages = 5
+)
+
+// SetTestShards sets how many `go test` processes /test splits a module's
+// packages across (<= 1 runs a single `go test ./...`).
+func (r *Router) SetTestShards(n int) {
+	r.testShards = n
+}
+
+// testPkgResult is one package's line of `go test` output.
+type testPkgResult struct {
+	pkg    string
+	status string // ok, FAIL or ? (no test files)
+	dur    time.Duration
+	cached bool
+}
+
+// testShard is one `go test` process of a sharded run.
+type testShard struct {
+	pkgs    []string
+	output  string
+	results map[string]bool
+	err     error
+	dur     time.Duration
+}
+
+var goTestSummaryRe = regexp.MustCompile(`^(ok|FAIL|\?)\s+(\S+)\s+(?:(\d+(?:\.\d+)?)s|(\(cached\))|\[[^\]]+\])`)
+
+// parseGoTestSummary returns the per-package result lines of `go test`
+// output, in order.
+func parseGoTestSummary(output string) []testPkgResult {
+	var results []testPkgResult
+	for _, line := range strings.Split(output, "\n") {
+		m := goTestSummaryRe.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		res := testPkgResult{pkg: m[2], status: m[1], cached: m[4] != ""}
+		if secs, err := strconv.ParseFloat(m[3], 64); err == nil {
+			res.dur = time.Duration(secs * float64(time.Second))
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// shardPackages deals pkgs round-robin into at most n shards.
+func shardPackages(pkgs []string, n int) [][]string {
+	if n > len(pkgs) {
+		n = len(pkgs)
+	}
+	shards := make([][]string, n)
+	for i, pkg := range pkgs {
+		shards[i%n] = append(shards[i%n], pkg)
+	}
+	return shards
+}
+
+// runShardedGoTest runs the Go packages under workDir across r.testShards
+// concurrent `go test` processes, skipping the quarantined tests, and
+// reports one combined card with a timing report of the slowest packages.
+// It returns false, without running anything, when the module has too few
+// packages to shard.
+func (r *Router) runShardedGoTest(ctx context.Context, chatID, workDir, pattern string, quarantined []string) bool {
+	list := exec.CommandContext(ctx, "go", "list", "./...")
+	list.Dir = workDir
+	out, err := list.Output()
+	if err != nil {
+		return false
+	}
+	pkgs := strings.Fields(string(out))
+	if len(pkgs) < 2 {
+		return false
+	}
+
+	execCtx, cancel := context.WithTimeout(ctx, shardedTestTimeout)
+	defer cancel()
+	shards := make([]testShard, 0, r.testShards)
+	for _, group := range shardPackages(pkgs, r.testShards) {
+		shards = append(shards, testShard{pkgs: group})
+	}
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("⏳ 正在测试 %d 个包（%d 个分片并行）...", len(pkgs), len(shards)))
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := range shards {
+		wg.Add(1)
+		go func(s *testShard) {
+			defer wg.Done()
+			shardStart := time.Now()
+			s.output, s.results, s.err = runGoTests(execCtx, workDir, goTestArgs(pattern, quarantined, s.pkgs...), pattern != "")
+			s.dur = time.Since(shardStart)
+		}(&shards[i])
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	content, failed := shardedTestReport(shards, pattern != "")
+	results := make(map[string]bool)
+	for _, s := range shards {
+		r.recordTestCache(s.output)
+		for k, v := range s.results {
+			results[k] = v
+		}
+	}
+	output, full := r.fitOutput(chatID, "test", content, false, "输出过长")
+	title := fmt.Sprintf("go test 通过（%d 个包，%d 个分片，%s）", len(pkgs), len(shards), elapsed.Round(time.Second))
+	tpl := "green"
+	if failed {
+		title = fmt.Sprintf("go test 失败（%d 个包，%d 个分片，%s）", len(pkgs), len(shards), elapsed.Round(time.Second))
+		tpl = "red"
+	}
+	output += r.testHealthNote(execCtx, repoRoot(workDir), workDir, results, quarantined)
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: output, Template: tpl})
+	r.sendFullOutput(ctx, chatID, full)
+	return true
+}
+
+// shardedTestReport combines the shards of a run into card markdown: the
+// output of failing shards (of all shards when verbose), a package
+// summary, the slowest packages and each shard's wall time.
+func shardedTestReport(shards []testShard, verbose bool) (content string, failed bool) {
+	var results []testPkgResult
+	var sb strings.Builder
+	for i, s := range shards {
+		results = append(results, parseGoTestSummary(s.output)...)
+		if s.err == nil && !verbose {
+			continue
+		}
+		if s.err != nil {
+			failed = true
+		}
+		fmt.Fprintf(&sb, "**分片 %d 输出:**\n```\n%s\n```\n", i+1, orDash(s.output))
+	}
+
+	var passed, noTests, cached int
+	var failedPkgs []string
+	for _, res := range results {
+		switch res.status {
+		case "ok":
+			passed++
+			if res.cached {
+				cached++
+			}
+		case "FAIL":
+			failedPkgs = append(failedPkgs, res.pkg)
+		default:
+			noTests++
+		}
+	}
+	fmt.Fprintf(&sb, "**汇总:** 通过 %d，失败 %d，无测试 %d", passed, len(failedPkgs), noTests)
+	if cached > 0 {
+		fmt.Fprintf(&sb, "（%d 个使用缓存）", cached)
+	}
+	sb.WriteString("\n")
+	if len(failedPkgs) > 0 {
+		sb.WriteString("**失败的包:** " + strings.Join(failedPkgs, ", ") + "\n")
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].dur > results[j].dur })
+	var slow []string
+	for _, res := range results {
+		if res.dur == 0 || len(slow) == slowestTestPackages {
+			break
+		}
+		mark := ""
+		if res.status == "FAIL" {
+			mark = " ❌"
+		}
+		slow = append(slow, fmt.Sprintf("%d. `%s` %.2fs%s", len(slow)+1, res.pkg, res.dur.Seconds(), mark))
+	}
+	if len(slow) > 0 {
+		sb.WriteString("\n**最慢的包:**\n" + strings.Join(slow, "\n") + "\n")
+	}
+
+	sb.WriteString("\n**分片耗时:**")
+	for i, s := range shards {
+		fmt.Fprintf(&sb, " #%d %s（%d 个包）", i+1, s.dur.Round(100*time.Millisecond), len(s.pkgs))
+	}
+	return sb.String(), failed
+}
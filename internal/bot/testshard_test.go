@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseGoTestSummary(t *testing.T) {
+	out := "ok  \texample.com/m/a\t1.250s\n--- FAIL: TestX (0.00s)\nFAIL\nFAIL\texample.com/m/b\t0.031s\n?   \texample.com/m/c\t[no test files]\nok  \texample.com/m/d\t(cached)\nFAIL\texample.com/m/e [build failed]"
+	got := parseGoTestSummary(out)
+	if len(got) != 5 {
+		t.Fatalf("got %d results: %+v", len(got), got)
+	}
+	if got[0].pkg != "example.com/m/a" || got[0].status != "ok" || got[0].dur != 1250*time.Millisecond {
+		t.Errorf("first result = %+v", got[0])
+	}
+	if got[1].status != "FAIL" || got[2].status != "?" || !got[3].cached || got[4].status != "FAIL" {
+		t.Errorf("results = %+v", got)
+	}
+}
+
+func TestShardPackages(t *testing.T) {
+	shards := shardPackages([]string{"a", "b", "c", "d", "e"}, 2)
+	if len(shards) != 2 || strings.Join(shards[0], ",") != "a,c,e" || strings.Join(shards[1], ",") != "b,d" {
+		t.Fatalf("shards = %v", shards)
+	}
+	if shards := shardPackages([]string{"a", "b"}, 8); len(shards) != 2 {
+		t.Fatalf("more shards than packages: %v", shards)
+	}
+}
+
+func TestShardedTestReport(t *testing.T) {
+	shards := []testShard{
+		{pkgs: []string{"m/a"}, output: "ok  \tm/a\t3.000s"},
+		{pkgs: []string{"m/b", "m/c"}, output: "--- FAIL: TestB\nFAIL\tm/b\t0.500s\nok  \tm/c\t1.000s", err: os.ErrInvalid},
+	}
+	content, failed := shardedTestReport(shards, false)
+	if !failed {
+		t.Fatal("expected failure")
+	}
+	for _, want := range []string{"分片 2 输出", "通过 2，失败 1", "**失败的包:** m/b", "1. `m/a` 3.00s", "3. `m/b` 0.50s ❌"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("missing %q in:\n%s", want, content)
+		}
+	}
+	if strings.Contains(content, "分片 1 输出") {
+		t.Errorf("passing shard output shown:\n%s", content)
+	}
+}
+
+func TestRouterTest_Sharded(t *testing.T) {
+	r, sender := newTestRouter(t)
+	mod := filepath.Join(r.store.WorkRoot(), "project1")
+	os.WriteFile(filepath.Join(mod, "go.mod"), []byte("module example.com/shard\n\ngo 1.21\n"), 0644)
+	for _, pkg := range []string{"a", "b", "c"} {
+		os.MkdirAll(filepath.Join(mod, pkg), 0755)
+		os.WriteFile(filepath.Join(mod, pkg, pkg+"_test.go"), []byte("package "+pkg+"\n\nimport \"testing\"\n\nfunc TestOK(t *testing.T) {}\n"), 0644)
+	}
+	r.SetTestShards(2)
+	r.Route(context.Background(), "chat1", "user1", "/cd project1")
+	r.Route(context.Background(), "chat1", "user1", "/test")
+
+	msg := sender.LastMessage()
+	if !strings.Contains(msg, "go test 通过（3 个包，2 个分片") || !strings.Contains(msg, "通过 3，失败 0") {
+		t.Fatalf("sharded test card = %q", msg)
+	}
+}
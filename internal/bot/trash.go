@@ -0,0 +1,334 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// trashDirName is the workdir folder holding copies of deleted files.
+	trashDirName = ".devbot-trash"
+	// trashManifest describes one trash entry.
+	trashManifest = ".devbot-trash.json"
+	// defaultTrashRetention is how long trash entries are kept.
+	defaultTrashRetention = 7 * 24 * time.Hour
+	// maxTrashSize bounds how much one deletion copies into the trash;
+	// larger paths are deleted without a copy.
+	maxTrashSize = 200 << 20
+)
+
+// SetTrashRetention sets how long trash entries are kept (0 = default).
+func (r *Router) SetTrashRetention(d time.Duration) {
+	r.trashRetention = d
+}
+
+// trashEntry is one batch of files saved before a deletion.
+type trashEntry struct {
+	Dir     string    `json:"-"`
+	Source  string    `json:"source"` // what deleted them: claude, exec, clean
+	Time    time.Time `json:"time"`
+	Paths   []string  `json:"paths"` // workdir-relative, slash-separated
+	Size    int64     `json:"size"`
+	Skipped []string  `json:"skipped,omitempty"` // too large to keep
+}
+
+// pathSize returns the total size of the regular files under path.
+func pathSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// copyTree copies src to dst, recreating directories and symlinks.
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case !info.Mode().IsRegular():
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
+
+// excludeTrash keeps the trash folder out of git status and git clean.
+func excludeTrash(workDir string) {
+	if info, err := os.Stat(filepath.Join(workDir, ".git")); err != nil || !info.IsDir() {
+		return
+	}
+	exclude := filepath.Join(workDir, ".git", "info", "exclude")
+	data, _ := os.ReadFile(exclude)
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == trashDirName+"/" {
+			return
+		}
+	}
+	if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		data = append(data, '\n')
+	}
+	data = append(data, trashDirName+"/\n"...)
+	os.MkdirAll(filepath.Dir(exclude), 0755)
+	os.WriteFile(exclude, data, 0644)
+}
+
+// trashPaths copies the files at paths (relative to workDir, globs
+// allowed) into a new trash entry before they are deleted. Paths outside
+// workDir or missing are ignored. It returns nil when none of the paths
+// exist.
+func (r *Router) trashPaths(workDir, source string, paths []string) (*trashEntry, error) {
+	return saveTrash(workDir, source, paths, r.trashRetention)
+}
+
+// saveTrash is trashPaths with an explicit retention, for the execution
+// backend, which has no Router.
+func saveTrash(workDir, source string, paths []string, retention time.Duration) (*trashEntry, error) {
+	root := filepath.Join(workDir, trashDirName)
+	seen := make(map[string]bool)
+	var targets []string
+	for _, p := range paths {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(workDir, p)
+		}
+		matches, _ := filepath.Glob(filepath.Clean(p))
+		for _, m := range matches {
+			if m == workDir || !underRoot(workDir, m) || underRoot(root, m) || seen[m] {
+				continue
+			}
+			seen[m] = true
+			targets = append(targets, m)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, nil
+	}
+	pruneTrash(workDir, retention)
+
+	entry := &trashEntry{Source: source, Time: time.Now()}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	excludeTrash(workDir)
+	dir, err := os.MkdirTemp(root, entry.Time.Format("20060102-150405-"))
+	if err != nil {
+		return nil, err
+	}
+	entry.Dir = dir
+	for _, t := range targets {
+		rel, _ := filepath.Rel(workDir, t)
+		rel = filepath.ToSlash(rel)
+		size := pathSize(t)
+		if entry.Size+size > maxTrashSize {
+			entry.Skipped = append(entry.Skipped, rel)
+			continue
+		}
+		if err := copyTree(t, filepath.Join(dir, filepath.FromSlash(rel))); err != nil {
+			slog.Warn("trash: failed to save", "path", t, "err", err)
+			entry.Skipped = append(entry.Skipped, rel)
+			continue
+		}
+		entry.Paths = append(entry.Paths, rel)
+		entry.Size += size
+	}
+	if len(entry.Paths) == 0 {
+		os.RemoveAll(dir)
+		return entry, nil
+	}
+	data, _ := json.MarshalIndent(entry, "", "  ")
+	if err := os.WriteFile(filepath.Join(dir, trashManifest), data, 0644); err != nil {
+		return nil, err
+	}
+	slog.Info("trash: saved", "paths", len(entry.Paths), "source", source, "dir", dir)
+	return entry, nil
+}
+
+// trashEntries returns the workdir's trash entries, newest first.
+func trashEntries(workDir string) []trashEntry {
+	root := filepath.Join(workDir, trashDirName)
+	dirs, _ := os.ReadDir(root)
+	var entries []trashEntry
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, d.Name())
+		data, err := os.ReadFile(filepath.Join(dir, trashManifest))
+		if err != nil {
+			continue
+		}
+		var e trashEntry
+		if json.Unmarshal(data, &e) != nil {
+			continue
+		}
+		e.Dir = dir
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Time.After(entries[j].Time) })
+	return entries
+}
+
+// pruneTrash removes trash entries older than retention (0 = default).
+func pruneTrash(workDir string, retention time.Duration) {
+	if retention <= 0 {
+		retention = defaultTrashRetention
+	}
+	for _, e := range trashEntries(workDir) {
+		if time.Since(e.Time) > retention {
+			os.RemoveAll(e.Dir)
+		}
+	}
+}
+
+// trashNotice describes a trash entry for the chat, or "" if nothing was
+// saved.
+func trashNotice(e *trashEntry) string {
+	if e == nil {
+		return ""
+	}
+	var parts []string
+	if len(e.Paths) > 0 {
+		parts = append(parts, fmt.Sprintf("🗑 已将 %d 项（%s）备份到 %s，可用 /trash restore 恢复", len(e.Paths), formatSize(e.Size), trashDirName))
+	}
+	if len(e.Skipped) > 0 {
+		parts = append(parts, fmt.Sprintf("⚠️ 未能备份: %s", strings.Join(e.Skipped, ", ")))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// trashDeletion saves paths to the trash before a deletion and tells the
+// chat what was kept. For Claude's deletions it runs in the deletion guard,
+// which the PreToolUse hook calls before the tool runs, so the files are
+// still there to copy.
+func (r *Router) trashDeletion(ctx context.Context, chatID, workDir, source string, paths []string) {
+	e, err := r.trashPaths(workDir, source, paths)
+	if err != nil {
+		slog.WarnContext(ctx, "trash: save failed", "err", err)
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("⚠️ 备份待删除文件失败: %v", err))
+		return
+	}
+	if notice := trashNotice(e); notice != "" {
+		r.sender.SendText(ctx, chatID, notice)
+	}
+}
+
+func (r *Router) cmdTrash(ctx context.Context, chatID, args string) {
+	workDir := r.getSession(chatID).WorkDir
+	sub, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	switch sub {
+	case "", "list":
+		pruneTrash(workDir, r.trashRetention)
+		entries := trashEntries(workDir)
+		if len(entries) == 0 {
+			r.sender.SendText(ctx, chatID, "回收站为空。")
+			return
+		}
+		var sb strings.Builder
+		for i, e := range entries {
+			paths := strings.Join(e.Paths, ", ")
+			fmt.Fprintf(&sb, "%d. %s · %s · %d 项（%s）: %s\n", i+1, e.Time.Format("01-02 15:04"), e.Source, len(e.Paths), formatSize(e.Size), truncateRunes(paths, 200))
+		}
+		sb.WriteString("\n使用 `/trash restore <序号>` 恢复。")
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("回收站（%d）", len(entries)), Content: sb.String()})
+	case "restore":
+		n, err := strconv.Atoi(strings.TrimSpace(rest))
+		entries := trashEntries(workDir)
+		if err != nil || n < 1 || n > len(entries) {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("无效的序号: %s（/trash list 查看）", rest))
+			return
+		}
+		r.restoreTrash(ctx, chatID, workDir, entries[n-1])
+	default:
+		r.sender.SendText(ctx, chatID, "用法: /trash [list]\n       /trash restore <序号>\n机器人执行的删除会先备份到工作目录的 .devbot-trash 中。")
+	}
+}
+
+// restoreTrash copies an entry's files back into workDir, leaving any path
+// that has since been recreated alone. A fully restored entry is removed.
+func (r *Router) restoreTrash(ctx context.Context, chatID, workDir string, e trashEntry) {
+	var restored, conflicts []string
+	for _, rel := range e.Paths {
+		dst := filepath.Join(workDir, filepath.FromSlash(rel))
+		if _, err := os.Lstat(dst); err == nil {
+			conflicts = append(conflicts, rel)
+			continue
+		}
+		if err := copyTree(filepath.Join(e.Dir, filepath.FromSlash(rel)), dst); err != nil {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("恢复 %s 失败: %v", rel, err))
+			return
+		}
+		restored = append(restored, rel)
+	}
+	if len(conflicts) == 0 {
+		os.RemoveAll(e.Dir)
+	} else {
+		// Keep only what is still waiting to be restored.
+		e.Paths, e.Size = conflicts, 0
+		for _, rel := range restored {
+			os.RemoveAll(filepath.Join(e.Dir, filepath.FromSlash(rel)))
+		}
+		for _, rel := range conflicts {
+			e.Size += pathSize(filepath.Join(e.Dir, filepath.FromSlash(rel)))
+		}
+		data, _ := json.MarshalIndent(e, "", "  ")
+		os.WriteFile(filepath.Join(e.Dir, trashManifest), data, 0644)
+	}
+	var sb strings.Builder
+	for _, rel := range restored {
+		fmt.Fprintf(&sb, "- `%s`\n", rel)
+	}
+	if len(conflicts) > 0 {
+		fmt.Fprintf(&sb, "\n以下路径已存在，未覆盖（备份仍保留在回收站）:\n")
+		for _, rel := range conflicts {
+			fmt.Fprintf(&sb, "- `%s`\n", rel)
+		}
+	}
+	tpl := "green"
+	if len(conflicts) > 0 {
+		tpl = "orange"
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("✓ 已恢复 %d 项", len(restored)), Content: strings.TrimSpace(sb.String()), Template: tpl})
+}
@@ -0,0 +1,155 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrashPathsAndRestore(t *testing.T) {
+	r, sender := newTestRouter(t)
+	workDir := r.getSession("chat1").WorkDir
+	os.MkdirAll(filepath.Join(workDir, "logs"), 0755)
+	os.WriteFile(filepath.Join(workDir, "logs", "a.log"), []byte("aaa"), 0644)
+	os.WriteFile(filepath.Join(workDir, "logs", "b.log"), []byte("bb"), 0644)
+
+	e, err := r.trashPaths(workDir, "exec", []string{"logs/*.log", "missing.txt", "../outside", workDir})
+	if err != nil || e == nil {
+		t.Fatalf("trashPaths: %+v %v", e, err)
+	}
+	if strings.Join(e.Paths, ",") != "logs/a.log,logs/b.log" || e.Size != 5 {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+	if e, _ := r.trashPaths(workDir, "exec", []string{"missing.txt"}); e != nil {
+		t.Fatalf("expected nil entry for missing paths, got %+v", e)
+	}
+
+	os.RemoveAll(filepath.Join(workDir, "logs"))
+	os.MkdirAll(filepath.Join(workDir, "logs"), 0755)
+	os.WriteFile(filepath.Join(workDir, "logs", "b.log"), []byte("new"), 0644)
+
+	r.Route(context.Background(), "chat1", "user1", "/trash")
+	if msg := sender.LastMessage(); !strings.HasPrefix(msg, "回收站（1）") || !strings.Contains(msg, "1. ") || !strings.Contains(msg, "logs/a.log") {
+		t.Fatalf("unexpected list %q", msg)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/trash restore 1")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "已恢复 1 项") || !strings.Contains(msg, "未覆盖") {
+		t.Fatalf("unexpected restore reply %q", msg)
+	}
+	if data, _ := os.ReadFile(filepath.Join(workDir, "logs", "a.log")); string(data) != "aaa" {
+		t.Fatalf("expected a.log restored, got %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(workDir, "logs", "b.log")); string(data) != "new" {
+		t.Fatalf("expected b.log left alone, got %q", data)
+	}
+	if len(trashEntries(workDir)) != 1 {
+		t.Fatal("expected entry kept after partial restore")
+	}
+
+	os.Remove(filepath.Join(workDir, "logs", "b.log"))
+	r.Route(context.Background(), "chat1", "user1", "/trash restore 1")
+	if len(trashEntries(workDir)) != 0 {
+		t.Fatal("expected entry removed after full restore")
+	}
+	r.Route(context.Background(), "chat1", "user1", "/trash restore 1")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "无效的序号") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+}
+
+func TestTrashRetention(t *testing.T) {
+	r, _ := newTestRouter(t)
+	workDir := r.getSession("chat1").WorkDir
+	os.WriteFile(filepath.Join(workDir, "old.txt"), []byte("x"), 0644)
+	e, _ := r.trashPaths(workDir, "exec", []string{"old.txt"})
+	e.Time = time.Now().Add(-8 * 24 * time.Hour)
+	data, _ := json.Marshal(e)
+	os.WriteFile(filepath.Join(e.Dir, trashManifest), data, 0644)
+
+	r.SetTrashRetention(10 * 24 * time.Hour)
+	pruneTrash(workDir, r.trashRetention)
+	if len(trashEntries(workDir)) != 1 {
+		t.Fatal("expected entry within retention to be kept")
+	}
+	r.SetTrashRetention(0)
+	pruneTrash(workDir, r.trashRetention)
+	if len(trashEntries(workDir)) != 0 {
+		t.Fatal("expected entry past default retention to be pruned")
+	}
+}
+
+func TestRouterExecRmGoesToTrash(t *testing.T) {
+	r, sender := newTestRouter(t)
+	workDir := r.getSession("chat1").WorkDir
+	os.WriteFile(filepath.Join(workDir, "report.pdf"), []byte("pdf"), 0644)
+
+	r.Route(context.Background(), "chat1", "user1", "/exec rm -f report.pdf")
+	if fileExists(filepath.Join(workDir, "report.pdf")) {
+		t.Fatal("expected rm to run")
+	}
+	found := false
+	for _, m := range sender.messages {
+		found = found || strings.Contains(m, "已将 1 项")
+	}
+	if !found {
+		t.Fatalf("expected trash notice, got %v", sender.messages)
+	}
+	r.Route(context.Background(), "chat1", "user1", "/trash restore 1")
+	if data, _ := os.ReadFile(filepath.Join(workDir, "report.pdf")); string(data) != "pdf" {
+		t.Fatalf("expected report.pdf restored, got %q", data)
+	}
+}
+
+func TestRouterCleanGoesToTrash(t *testing.T) {
+	r, _ := newTestRouter(t)
+	workDir := r.getSession("chat1").WorkDir
+	if out, err := exec.Command("git", "-C", workDir, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v %s", err, out)
+	}
+	os.WriteFile(filepath.Join(workDir, "scratch.txt"), []byte("tmp"), 0644)
+
+	r.Route(context.Background(), "chat1", "user1", "/clean -f")
+	if fileExists(filepath.Join(workDir, "scratch.txt")) {
+		t.Fatal("expected git clean to remove scratch.txt")
+	}
+	entries := trashEntries(workDir)
+	if len(entries) != 1 || !strings.Contains(strings.Join(entries[0].Paths, ","), "scratch.txt") {
+		t.Fatalf("expected scratch.txt in trash, got %+v", entries)
+	}
+	exclude, _ := os.ReadFile(filepath.Join(workDir, ".git", "info", "exclude"))
+	if !strings.Contains(string(exclude), trashDirName+"/") {
+		t.Fatalf("expected trash excluded from git, got %q", exclude)
+	}
+
+	// A second clean must not remove the trash itself.
+	r.Route(context.Background(), "chat1", "user1", "/clean -f")
+	if len(trashEntries(workDir)) != 1 {
+		t.Fatal("expected trash to survive git clean")
+	}
+}
+
+func TestRouterClaudeDeletionGoesToTrash(t *testing.T) {
+	r, sender, _ := newDeleteRouter(t)
+	workDir := r.getSession("chat1").WorkDir
+	os.MkdirAll(filepath.Join(workDir, "build"), 0755)
+	os.WriteFile(filepath.Join(workDir, "build", "app"), []byte("bin"), 0755)
+	r.Route(context.Background(), "chat1", "user1", "/yolo")
+	r.Route(context.Background(), "chat1", "user1", "clean up the build")
+
+	entries := trashEntries(workDir)
+	if len(entries) != 1 || entries[0].Source != "claude" || strings.Join(entries[0].Paths, ",") != "build" {
+		t.Fatalf("expected build in trash, got %+v (%v)", entries, sender.Messages())
+	}
+	if data, _ := os.ReadFile(filepath.Join(entries[0].Dir, "build", "app")); string(data) != "bin" {
+		t.Fatalf("expected build/app copied, got %q", data)
+	}
+	// The backup is taken in the hook, before the rm runs.
+	if fileExists(filepath.Join(workDir, "build")) {
+		t.Fatal("expected the deletion to go ahead after the backup")
+	}
+}
@@ -0,0 +1,147 @@
+package bot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	// verifyTimeout bounds one run of a verification command.
+	verifyTimeout = 5 * time.Minute
+	// maxVerifyOutputRunes is how much of a failed verification's output
+	// (its end, where errors are) goes into the result card.
+	maxVerifyOutputRunes = 3000
+)
+
+// repoRoot returns the root of the git repository containing dir, or dir
+// itself outside a repository.
+func repoRoot(dir string) string {
+	if root, err := runGitOutput(dir, "rev-parse", "--show-toplevel"); err == nil && root != "" {
+		return root
+	}
+	return dir
+}
+
+// treeFingerprint identifies the state of the working tree at dir: HEAD,
+// the changed and untracked files and their diff. It is "" outside a git
+// repository.
+func treeFingerprint(dir string) string {
+	status, err := runGitOutput(dir, "status", "--porcelain", "-uall")
+	if err != nil {
+		return ""
+	}
+	h := sha256.New()
+	head, _ := runGitOutput(dir, "rev-parse", "HEAD")
+	diff, _ := runGitOutput(dir, "diff", "HEAD", "--no-ext-diff")
+	fmt.Fprintf(h, "%s\n%s\n%s", head, status, diff)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// verifyCheck is a repository's verification command together with the
+// tree state before an execution, so it only runs when files changed.
+type verifyCheck struct {
+	root    string
+	command string
+	before  string
+}
+
+// verifyBefore captures the tree state of workDir's repository when it has
+// a verification command, or returns nil.
+func (r *Router) verifyBefore(workDir string) *verifyCheck {
+	if workDir == "" {
+		return nil
+	}
+	root := repoRoot(workDir)
+	command, ok := r.store.Verifier(root)
+	if !ok {
+		return nil
+	}
+	return &verifyCheck{root: root, command: command, before: treeFingerprint(root)}
+}
+
+// run runs the verification command when the tree changed since
+// verifyBefore and returns a note for the result card and whether the
+// command passed. The note is "" when nothing changed.
+func (c *verifyCheck) run(ctx context.Context) (string, bool) {
+	if c == nil || c.before == "" || treeFingerprint(c.root) == c.before {
+		return "", true
+	}
+	return runVerify(ctx, c.root, c.command)
+}
+
+// runVerify runs command in root and renders the outcome.
+func runVerify(ctx context.Context, root, command string) (string, bool) {
+	start := time.Now()
+	out, err := runInDir(ctx, root, verifyTimeout, "sh", "-c", command)
+	elapsed := time.Since(start).Truncate(time.Second)
+	if err == nil {
+		return fmt.Sprintf("✅ 校验通过: `%s`（%s）", command, elapsed), true
+	}
+	slog.WarnContext(ctx, "verify: command failed", "command", command, "root", root, "err", err)
+	out = strings.TrimSpace(out)
+	if runes := []rune(out); len(runes) > maxVerifyOutputRunes {
+		out = "...\n" + string(runes[len(runes)-maxVerifyOutputRunes:])
+	}
+	note := fmt.Sprintf("❌ **校验失败:** `%s`（%v）", command, err)
+	if out != "" {
+		note += "\n```\n" + out + "\n```"
+	}
+	return note, false
+}
+
+// cmdVerify shows, sets, clears or runs the verification command of the
+// current repository.
+func (r *Router) cmdVerify(ctx context.Context, chatID, args string) {
+	session := r.getSession(chatID)
+	dir := session.WorkDir
+	if dir == "" {
+		dir = r.store.WorkRoot()
+	}
+	root := repoRoot(dir)
+	command, hasCommand := r.store.Verifier(root)
+	args = strings.TrimSpace(args)
+	switch args {
+	case "":
+		if !hasCommand {
+			r.sender.SendText(ctx, chatID, "当前仓库没有设置校验命令。\n用法: /verify <命令>  设置校验命令，如 /verify go build ./... && go vet ./...\n       /verify run  立即运行\n       /verify off  取消\nClaude 每次执行修改了文件后会自动运行校验命令，失败时把输出附在结果卡片中。")
+			return
+		}
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("当前仓库的校验命令: `%s`\n`/verify run` 立即运行，`/verify off` 取消。", command))
+	case "off":
+		if !hasCommand {
+			r.sender.SendText(ctx, chatID, "当前仓库没有设置校验命令。")
+			return
+		}
+		r.store.SetVerifier(root, "")
+		r.save()
+		r.sender.SendText(ctx, chatID, "✓ 已取消校验命令")
+	case "run":
+		if !hasCommand {
+			r.sender.SendText(ctx, chatID, "当前仓库没有设置校验命令，先用 /verify <命令> 设置。")
+			return
+		}
+		r.sender.SendText(ctx, chatID, "校验中...")
+		note, ok := runVerify(ctx, root, command)
+		tpl := "green"
+		if !ok {
+			tpl = "red"
+		}
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: "校验结果", Content: note, Template: tpl})
+	default:
+		// The command runs as shell on the host, so setting one needs the
+		// role /exec needs.
+		if userID := userIDFrom(ctx); r.userRole(userID) < r.requiredRole("/exec") {
+			slog.WarnContext(ctx, "router: verify command denied", "user_id", userID)
+			r.sender.SendText(ctx, chatID, "设置校验命令会在主机上运行任意 shell 命令，仅限管理员使用（admin_user_ids）。")
+			return
+		}
+		r.store.SetVerifier(root, args)
+		r.save()
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已设置 %s 的校验命令: `%s`\nClaude 修改文件后会自动运行。", root, args))
+	}
+}
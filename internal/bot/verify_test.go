@@ -0,0 +1,94 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newVerifyRouter returns a router whose chat1 works in a fresh git
+// repository, with a fake Claude that runs script there before answering.
+func newVerifyRouter(t *testing.T, script string) (*Router, *reactSpySender, string) {
+	t.Helper()
+	claude := filepath.Join(t.TempDir(), "claude")
+	os.WriteFile(claude, []byte("#!/bin/sh\n"+script+"\necho '{\"type\":\"result\",\"result\":\"edited\",\"session_id\":\"s1\"}'\n"), 0755)
+	r, sender := newAckRouter(t, claude)
+	repo := filepath.Join(r.store.WorkRoot(), "app")
+	os.Mkdir(repo, 0755)
+	os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n"), 0644)
+	for _, args := range [][]string{{"init", "-q"}, {"add", "."}, {"-c", "user.name=t", "-c", "user.email=t@t", "commit", "-qm", "init"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	repo = repoRoot(repo)
+	r.getSession("chat1")
+	r.store.UpdateSession("chat1", func(s *Session) { s.WorkDir = repo })
+	return r, sender, repo
+}
+
+func TestTreeFingerprint(t *testing.T) {
+	_, _, repo := newVerifyRouter(t, "")
+	before := treeFingerprint(repo)
+	if before == "" || treeFingerprint(repo) != before {
+		t.Fatal("expected a stable fingerprint")
+	}
+	os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644)
+	if treeFingerprint(repo) == before {
+		t.Fatal("expected an edit to change the fingerprint")
+	}
+	if treeFingerprint(t.TempDir()) != "" {
+		t.Fatal("expected no fingerprint outside a repository")
+	}
+}
+
+func TestRouterVerifyAfterEdit(t *testing.T) {
+	r, sender, _ := newVerifyRouter(t, "echo broken >> main.go")
+	ctx := context.Background()
+
+	r.Route(ctx, "chat1", "user1", "/verify echo 'main.go:3: syntax error' && exit 1")
+	r.Route(ctx, "chat1", "user1", "/verify")
+	if !strings.Contains(sender.LastMessage(), "exit 1") {
+		t.Fatalf("expected the command shown, got %q", sender.LastMessage())
+	}
+
+	r.Route(ctx, "chat1", "user1", "break it")
+	var card string
+	for _, m := range sender.messages {
+		if strings.Contains(m, "edited") {
+			card = m
+		}
+	}
+	if !strings.Contains(card, "校验失败") || !strings.Contains(card, "main.go:3: syntax error") {
+		t.Fatalf("expected the failed verification in the result card, got %q", sender.messages)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/verify off")
+	if _, ok := r.store.Verifier(r.getSession("chat1").WorkDir); ok {
+		t.Fatal("expected the command removed")
+	}
+}
+
+func TestRouterVerifySkipsUnchangedTree(t *testing.T) {
+	r, sender, repo := newVerifyRouter(t, "")
+	ctx := context.Background()
+	r.store.SetVerifier(repo, "exit 1")
+
+	r.Route(ctx, "chat1", "user1", "just look")
+	for _, m := range sender.messages {
+		if strings.Contains(m, "校验") {
+			t.Fatalf("expected no verification without changes, got %q", sender.messages)
+		}
+	}
+
+	r.store.SetVerifier(repo, "echo all good")
+	r.Route(ctx, "chat1", "user1", "/verify run")
+	if msg := sender.LastMessage(); !strings.Contains(msg, "校验通过") {
+		t.Fatalf("expected a passing run, got %q", msg)
+	}
+}
@@ -0,0 +1,395 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// watchDebounce collects the changes of one burst (a pull, a save-all)
+	// into a single trigger.
+	watchDebounce = 2 * time.Second
+	// maxWatchesPerChat bounds the rules a chat can create.
+	maxWatchesPerChat = 10
+	// maxWatchDirs bounds the directories one rule watches, to stay well
+	// within the inotify limits on large trees.
+	maxWatchDirs = 2000
+)
+
+// watchSkipDirs are never watched: VCS metadata, dependencies and build
+// output change far too often to be useful triggers.
+var watchSkipDirs = map[string]bool{"node_modules": true, "vendor": true, "dist": true, "build": true, "target": true}
+
+// Watcher runs the chats' /watch rules: it observes each enabled rule's
+// directory tree with fsnotify and, when matching files change, queues the
+// rule's prompt in its chat. Changes made while the chat has an execution
+// running are ignored (they are Claude's own edits), bursts are coalesced,
+// and each rule triggers at most once per interval.
+type Watcher struct {
+	router   *Router
+	interval time.Duration
+	debounce time.Duration
+
+	mu    sync.Mutex
+	rules map[string]*ruleWatch
+}
+
+type ruleWatch struct {
+	rule WatchRule
+	fsw  *fsnotify.Watcher
+	done chan struct{}
+}
+
+// NewWatcher creates a Watcher for r's rules. interval is the minimum time
+// between two triggers of the same rule.
+func NewWatcher(r *Router, interval time.Duration) *Watcher {
+	return &Watcher{
+		router:   r,
+		interval: interval,
+		debounce: watchDebounce,
+		rules:    make(map[string]*ruleWatch),
+	}
+}
+
+func (r *Router) SetWatcher(w *Watcher) {
+	r.watcher = w
+}
+
+// Start starts every enabled rule in the store and stops them all when ctx
+// is cancelled.
+func (w *Watcher) Start(ctx context.Context) {
+	for _, rule := range w.router.store.Watches("") {
+		if !rule.Enabled {
+			continue
+		}
+		if err := w.startRule(rule); err != nil {
+			slog.Warn("watch: start failed", "watch", rule.ID, "dir", rule.Dir, "err", err)
+		}
+	}
+	go func() {
+		<-ctx.Done()
+		w.Close()
+	}()
+}
+
+// Close stops all rules.
+func (w *Watcher) Close() {
+	w.mu.Lock()
+	ids := make([]string, 0, len(w.rules))
+	for id := range w.rules {
+		ids = append(ids, id)
+	}
+	w.mu.Unlock()
+	for _, id := range ids {
+		w.stopRule(id)
+	}
+}
+
+func (w *Watcher) startRule(rule WatchRule) error {
+	w.stopRule(rule.ID)
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := addWatchTree(fsw, rule.Dir); err != nil {
+		fsw.Close()
+		return err
+	}
+	rw := &ruleWatch{rule: rule, fsw: fsw, done: make(chan struct{})}
+	w.mu.Lock()
+	w.rules[rule.ID] = rw
+	w.mu.Unlock()
+	go w.loop(rw)
+	return nil
+}
+
+func (w *Watcher) stopRule(id string) {
+	w.mu.Lock()
+	rw, ok := w.rules[id]
+	delete(w.rules, id)
+	w.mu.Unlock()
+	if ok {
+		close(rw.done)
+		rw.fsw.Close()
+	}
+}
+
+// running reports whether rule id is being watched.
+func (w *Watcher) running(id string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.rules[id]
+	return ok
+}
+
+// addWatchTree watches root and its subdirectories, skipping hidden and
+// dependency directories.
+func addWatchTree(fsw *fsnotify.Watcher, root string) error {
+	n := 0
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != root && skipWatchDir(info.Name()) {
+			return filepath.SkipDir
+		}
+		if n >= maxWatchDirs {
+			return filepath.SkipDir
+		}
+		n++
+		return fsw.Add(path)
+	})
+}
+
+func skipWatchDir(name string) bool {
+	return strings.HasPrefix(name, ".") || watchSkipDirs[name]
+}
+
+// ignoredWatchPath reports whether rel lies in a directory that is never
+// watched (the event can still arrive for the directory entry itself).
+func ignoredWatchPath(rel string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		if skipWatchDir(part) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchWatchGlob matches rel (slash-separated, relative to the rule's
+// directory) against pattern. A pattern without "/" matches the base name
+// anywhere in the tree; "dir/**" matches everything under dir; otherwise
+// the pattern must match the whole relative path.
+func matchWatchGlob(pattern, rel string) bool {
+	if prefix := strings.TrimSuffix(pattern, "/**"); prefix != pattern {
+		return rel == prefix || strings.HasPrefix(rel, prefix+"/")
+	}
+	if !strings.Contains(pattern, "/") {
+		ok, _ := filepath.Match(pattern, filepath.Base(rel))
+		return ok
+	}
+	ok, _ := filepath.Match(pattern, rel)
+	return ok
+}
+
+// renderWatchPrompt substitutes {{file}} in tmpl with the changed files,
+// or appends them when the template does not reference them.
+func renderWatchPrompt(tmpl string, files []string) string {
+	list := strings.Join(files, ", ")
+	if strings.Contains(tmpl, "{{file}}") {
+		return strings.ReplaceAll(tmpl, "{{file}}", list)
+	}
+	return fmt.Sprintf("%s\n\n变更的文件: %s", tmpl, list)
+}
+
+func (w *Watcher) loop(rw *ruleWatch) {
+	rule := rw.rule
+	pending := make(map[string]bool)
+	var timer *time.Timer
+	var timerC <-chan time.Time
+	var lastRun time.Time
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-rw.done:
+			return
+		case err, ok := <-rw.fsw.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("watch: failed", "watch", rule.ID, "err", err)
+		case ev, ok := <-rw.fsw.Events:
+			if !ok {
+				return
+			}
+			rel, err := filepath.Rel(rule.Dir, ev.Name)
+			if err != nil || ignoredWatchPath(rel) {
+				continue
+			}
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					addWatchTree(rw.fsw, ev.Name)
+					continue
+				}
+			}
+			if ev.Op == fsnotify.Chmod || !matchWatchGlob(rule.Glob, filepath.ToSlash(rel)) {
+				continue
+			}
+			if w.router.chatBusy(rule.ChatID) {
+				continue
+			}
+			pending[filepath.ToSlash(rel)] = true
+			if timer == nil {
+				delay := w.debounce
+				if wait := time.Until(lastRun.Add(w.interval)); wait > delay {
+					delay = wait
+				}
+				timer = time.NewTimer(delay)
+				timerC = timer.C
+			}
+		case <-timerC:
+			timer, timerC = nil, nil
+			files := make([]string, 0, len(pending))
+			for f := range pending {
+				files = append(files, f)
+			}
+			sort.Strings(files)
+			pending = make(map[string]bool)
+			lastRun = time.Now()
+			w.trigger(rule, files)
+		}
+	}
+}
+
+func (w *Watcher) trigger(rule WatchRule, files []string) {
+	r := w.router
+	ctx := r.ctx
+	session := r.getSession(rule.ChatID)
+	// Paths are relative to the rule's directory; make them absolute if the
+	// chat has moved elsewhere since.
+	if session.WorkDir != rule.Dir {
+		for i, f := range files {
+			files[i] = filepath.Join(rule.Dir, f)
+		}
+	}
+	slog.Info("watch: triggered", "watch", rule.ID, "chat_id", rule.ChatID, "files", files)
+	r.sender.SendText(ctx, rule.ChatID, fmt.Sprintf("👀 监听 %s 检测到文件变更: %s", rule.ID, strings.Join(files, ", ")))
+	r.enqueueExec(ctx, rule.ChatID, renderWatchPrompt(rule.Prompt, files), execOptions{})
+}
+
+// chatBusy reports whether chatID has an execution running.
+func (r *Router) chatBusy(chatID string) bool {
+	for _, rec := range r.ActiveExecs() {
+		if rec.ChatID == chatID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Router) cmdWatch(ctx context.Context, chatID, args string) {
+	if sub, rest, _ := strings.Cut(args, " "); sub == "repo" {
+		r.cmdWatchRepo(ctx, chatID, rest)
+		return
+	}
+	if r.watcher == nil {
+		r.sender.SendText(ctx, chatID, "文件监听未启用。")
+		return
+	}
+	usage := "用法:\n/watch <glob> <prompt>  文件变更时执行 prompt（{{file}} 替换为变更的文件）\n/watch list  查看监听\n/watch off|on <id>  暂停/恢复监听\n/watch rm <id>  删除监听\n/watch repo <owner/name>  订阅 GitHub 仓库的推送、PR 和 CI 事件\n\n示例: /watch *.go 重新运行与 {{file}} 相关的测试"
+
+	sub, rest, _ := strings.Cut(args, " ")
+	rest = strings.TrimSpace(rest)
+	switch sub {
+	case "", "list":
+		r.listWatches(ctx, chatID)
+		return
+	case "on", "off":
+		if rest == "" {
+			r.sender.SendText(ctx, chatID, usage)
+			return
+		}
+		rule, ok := r.store.SetWatchEnabled(chatID, rest, sub == "on")
+		if !ok {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("未找到监听: %s", rest))
+			return
+		}
+		r.save()
+		if sub == "off" {
+			r.watcher.stopRule(rule.ID)
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("⏸ 已暂停监听 %s", rule.ID))
+			return
+		}
+		if err := r.watcher.startRule(rule); err != nil {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("恢复监听失败: %v", err))
+			return
+		}
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("▶ 已恢复监听 %s", rule.ID))
+		return
+	case "rm":
+		if rest == "" {
+			r.sender.SendText(ctx, chatID, usage)
+			return
+		}
+		if !r.store.RemoveWatch(chatID, rest) {
+			r.sender.SendText(ctx, chatID, fmt.Sprintf("未找到监听: %s", rest))
+			return
+		}
+		r.save()
+		r.watcher.stopRule(rest)
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已删除监听 %s", rest))
+		return
+	}
+
+	glob, prompt := sub, rest
+	if prompt == "" {
+		r.sender.SendText(ctx, chatID, usage)
+		return
+	}
+	if _, err := filepath.Match(strings.TrimSuffix(glob, "/**"), ""); err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("无效的 glob: %s", glob))
+		return
+	}
+	if len(r.store.Watches(chatID)) >= maxWatchesPerChat {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("每个聊天最多 %d 个监听，请先用 /watch rm <id> 删除不需要的监听。", maxWatchesPerChat))
+		return
+	}
+	session := r.getSession(chatID)
+	rule := WatchRule{
+		ID:        newExecID(),
+		ChatID:    chatID,
+		Dir:       session.WorkDir,
+		Glob:      glob,
+		Prompt:    prompt,
+		Enabled:   true,
+		CreatedAt: time.Now(),
+	}
+	if err := r.watcher.startRule(rule); err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("创建监听失败: %v", err))
+		return
+	}
+	r.store.AddWatch(rule)
+	r.save()
+	r.sender.SendText(ctx, chatID, fmt.Sprintf("✓ 已创建监听 %s: %s 中的 %s 变更时执行「%s」（同一监听最多每 %s 触发一次）",
+		rule.ID, rule.Dir, glob, truncateRunes(prompt, 60), r.watcher.interval))
+}
+
+func (r *Router) listWatches(ctx context.Context, chatID string) {
+	rules := r.store.Watches(chatID)
+	if len(rules) == 0 {
+		r.sender.SendText(ctx, chatID, "当前没有文件监听。使用 /watch <glob> <prompt> 创建。")
+		return
+	}
+	var sb strings.Builder
+	for _, rule := range rules {
+		state := "⏸ 已暂停"
+		if rule.Enabled {
+			state = "✓ 监听中"
+			if !r.watcher.running(rule.ID) {
+				state = "✗ 未运行"
+			}
+		}
+		fmt.Fprintf(&sb, "`%s` %s · `%s` → %s\n%s\n\n", rule.ID, state, rule.Glob, truncateRunes(rule.Prompt, 60), rule.Dir)
+	}
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("文件监听（%d）", len(rules)), Content: strings.TrimSpace(sb.String())})
+}
@@ -0,0 +1,229 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchWatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, rel string
+		want         bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "internal/bot/router.go", true},
+		{"*.go", "README.md", false},
+		{"internal/*/*.go", "internal/bot/router.go", true},
+		{"internal/*.go", "internal/bot/router.go", false},
+		{"docs/**", "docs/a/b.md", true},
+		{"docs/**", "docs", true},
+		{"docs/**", "docsx/a.md", false},
+		{"go.mod", "go.mod", true},
+	}
+	for _, tt := range tests {
+		if got := matchWatchGlob(tt.pattern, tt.rel); got != tt.want {
+			t.Errorf("matchWatchGlob(%q, %q) = %v, want %v", tt.pattern, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestIgnoredWatchPath(t *testing.T) {
+	for rel, want := range map[string]bool{
+		"main.go":                 true,
+		".git/index":              false,
+		"node_modules/x/index.js": false,
+		"src/.cache/x":            false,
+		"src/app.ts":              true,
+	} {
+		if got := !ignoredWatchPath(rel); got != want {
+			t.Errorf("ignoredWatchPath(%q) = %v, want %v", rel, !got, !want)
+		}
+	}
+}
+
+func TestRenderWatchPrompt(t *testing.T) {
+	if got := renderWatchPrompt("re-run tests for {{file}}", []string{"a.go", "b.go"}); got != "re-run tests for a.go, b.go" {
+		t.Fatalf("unexpected prompt %q", got)
+	}
+	if got := renderWatchPrompt("review the changes", []string{"a.go"}); got != "review the changes\n\n变更的文件: a.go" {
+		t.Fatalf("unexpected prompt %q", got)
+	}
+}
+
+// newWatchRouter returns an exec router with a fast Watcher and its work
+// directory.
+func newWatchRouter(t *testing.T, interval time.Duration) (*Router, *syncSpySender, string) {
+	t.Helper()
+	r, sender, q := newTestRouterForExec(t)
+	t.Cleanup(q.Shutdown)
+	w := NewWatcher(r, interval)
+	w.debounce = 20 * time.Millisecond
+	r.SetWatcher(w)
+	t.Cleanup(w.Close)
+	return r, sender, r.getSession("chat1").WorkDir
+}
+
+func hasMessage(sender *syncSpySender, prefix string) bool {
+	for _, m := range sender.Messages() {
+		if strings.HasPrefix(m, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func countMessages(sender *syncSpySender, prefix string) int {
+	n := 0
+	for _, m := range sender.Messages() {
+		if strings.HasPrefix(m, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestRouterWatch_TriggersOnChange(t *testing.T) {
+	r, sender, dir := newWatchRouter(t, 0)
+	r.Route(context.Background(), "chat1", "user1", "/watch *.go re-run tests for {{file}}")
+	rules := r.store.Watches("chat1")
+	if len(rules) != 1 || rules[0].Dir != dir || rules[0].Glob != "*.go" || !rules[0].Enabled {
+		t.Fatalf("expected rule to be stored, got %+v", rules)
+	}
+
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("ignored"), 0644)
+	os.MkdirAll(filepath.Join(dir, "pkg"), 0755)
+	time.Sleep(50 * time.Millisecond) // let the new directory be watched
+	os.WriteFile(filepath.Join(dir, "pkg", "util.go"), []byte("package pkg"), 0644)
+
+	waitFor(t, func() bool {
+		return hasMessage(sender, "👀 监听 "+rules[0].ID+" 检测到文件变更: pkg/util.go")
+	})
+	waitFor(t, func() bool {
+		recs := r.store.ExecRecords("chat1", 0)
+		return len(recs) == 1 && recs[0].Prompt == "re-run tests for pkg/util.go"
+	})
+}
+
+func TestRouterWatch_IgnoresChangesWhileChatBusy(t *testing.T) {
+	r, sender, dir := newWatchRouter(t, 0)
+	r.Route(context.Background(), "chat1", "user1", "/watch *.txt check {{file}}")
+
+	r.setActive(ExecRecord{ID: "busy", ChatID: "chat1"})
+	os.WriteFile(filepath.Join(dir, "claude.txt"), []byte("edited by claude"), 0644)
+	time.Sleep(150 * time.Millisecond)
+	if hasMessage(sender, "👀") {
+		t.Fatalf("expected changes during an execution to be ignored, got %v", sender.Messages())
+	}
+
+	r.clearActive("busy")
+	os.WriteFile(filepath.Join(dir, "teammate.txt"), []byte("pulled"), 0644)
+	waitFor(t, func() bool { return hasMessage(sender, "👀") })
+	for _, m := range sender.Messages() {
+		if strings.HasPrefix(m, "👀") && strings.Contains(m, "claude.txt") {
+			t.Fatalf("expected busy-time change to be dropped, got %q", m)
+		}
+	}
+}
+
+func TestRouterWatch_RateLimited(t *testing.T) {
+	r, sender, dir := newWatchRouter(t, time.Hour)
+	r.Route(context.Background(), "chat1", "user1", "/watch *.txt check {{file}}")
+
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("1"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("1"), 0644)
+	waitFor(t, func() bool { return hasMessage(sender, "👀") })
+	if !hasMessage(sender, "👀 监听") || countMessages(sender, "👀") != 1 {
+		t.Fatalf("expected one coalesced trigger, got %v", sender.Messages())
+	}
+	for _, m := range sender.Messages() {
+		if strings.HasPrefix(m, "👀") && !strings.HasSuffix(m, "a.txt, b.txt") {
+			t.Fatalf("expected both files in one trigger, got %q", m)
+		}
+	}
+
+	os.WriteFile(filepath.Join(dir, "c.txt"), []byte("2"), 0644)
+	time.Sleep(150 * time.Millisecond)
+	if n := countMessages(sender, "👀"); n != 1 {
+		t.Fatalf("expected rate limit to hold back the second trigger, got %d", n)
+	}
+}
+
+func TestRouterWatch_Manage(t *testing.T) {
+	r, sender, dir := newWatchRouter(t, 0)
+	r.Route(context.Background(), "chat1", "user1", "/watch")
+	if !strings.Contains(sender.LastMessage(), "当前没有文件监听") {
+		t.Fatalf("unexpected empty list reply %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/watch *.go")
+	if !strings.HasPrefix(sender.LastMessage(), "用法:") {
+		t.Fatalf("expected usage without prompt, got %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/watch [ bad")
+	if !strings.Contains(sender.LastMessage(), "无效的 glob") {
+		t.Fatalf("expected glob error, got %q", sender.LastMessage())
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/watch *.md summarize {{file}}")
+	id := r.store.Watches("chat1")[0].ID
+
+	r.Route(context.Background(), "chat1", "user1", "/watch off "+id)
+	if r.watcher.running(id) || r.store.Watches("chat1")[0].Enabled {
+		t.Fatal("expected rule to be stopped and disabled")
+	}
+	os.WriteFile(filepath.Join(dir, "notes.md"), []byte("x"), 0644)
+	time.Sleep(100 * time.Millisecond)
+	if hasMessage(sender, "👀") {
+		t.Fatal("expected paused rule not to trigger")
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/watch list")
+	if !strings.Contains(sender.LastMessage(), "`"+id+"` ⏸ 已暂停") {
+		t.Fatalf("expected paused rule in list, got %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/watch on "+id)
+	if !r.watcher.running(id) {
+		t.Fatal("expected rule to be running again")
+	}
+	r.Route(context.Background(), "chat1", "user1", "/watch off nope")
+	if !strings.Contains(sender.LastMessage(), "未找到监听") {
+		t.Fatalf("expected not found, got %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat2", "user1", "/watch rm "+id)
+	if !strings.Contains(sender.LastMessage(), "未找到监听") {
+		t.Fatalf("expected other chats not to remove the rule, got %q", sender.LastMessage())
+	}
+	r.Route(context.Background(), "chat1", "user1", "/watch rm "+id)
+	if r.watcher.running(id) || len(r.store.Watches("chat1")) != 0 {
+		t.Fatal("expected rule to be removed")
+	}
+}
+
+func TestWatcher_StartRestoresEnabledRules(t *testing.T) {
+	r, _, q := newTestRouterForExec(t)
+	t.Cleanup(q.Shutdown)
+	dir := r.getSession("chat1").WorkDir
+	r.store.AddWatch(WatchRule{ID: "on", ChatID: "chat1", Dir: dir, Glob: "*.go", Prompt: "x", Enabled: true})
+	r.store.AddWatch(WatchRule{ID: "off", ChatID: "chat1", Dir: dir, Glob: "*.go", Prompt: "x"})
+	r.store.AddWatch(WatchRule{ID: "gone", ChatID: "chat1", Dir: filepath.Join(dir, "missing"), Glob: "*.go", Prompt: "x", Enabled: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := NewWatcher(r, time.Minute)
+	w.Start(ctx)
+	if !w.running("on") || w.running("off") || w.running("gone") {
+		t.Fatalf("unexpected running rules: on=%v off=%v gone=%v", w.running("on"), w.running("off"), w.running("gone"))
+	}
+	cancel()
+	waitFor(t, func() bool { return !w.running("on") })
+}
+
+func TestRouterWatch_Disabled(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.Route(context.Background(), "chat1", "user1", "/watch *.go x")
+	if sender.LastMessage() != "文件监听未启用。" {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+}
@@ -0,0 +1,276 @@
+package bot
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// usageDays is the number of days shown in the dashboard usage graph.
+const usageDays = 14
+
+// WebServer serves the optional read-only team dashboard and, when enabled,
+// the REST API under /api/v1/. Every request must carry the matching token,
+// either as "Authorization: Bearer <token>" or as a ?token= query parameter
+// (for opening the dashboard in a browser). The dashboard token never grants
+// API access. Git hooks installed by /hooks post to /hooks/{id} with their
+// own per-installation token, and /guest/{token} result pages are
+// authenticated by the link itself.
+type WebServer struct {
+	router   *Router
+	token    string
+	apiToken string
+	mux      *http.ServeMux
+	api      *http.ServeMux
+}
+
+// NewWebServer creates a WebServer exposing the state of router.
+func NewWebServer(router *Router, token string) *WebServer {
+	w := &WebServer{router: router, token: token, mux: http.NewServeMux(), api: http.NewServeMux()}
+	w.mux.HandleFunc("/", w.handleDashboard)
+	w.mux.HandleFunc("/api/state", w.handleState)
+	w.api.HandleFunc("/api/v1/chats/", w.handleChatPrompts)
+	w.api.HandleFunc("/api/v1/executions/", w.handleExecution)
+	return w
+}
+
+// EnableAPI turns on the REST API, authenticated with its own token.
+func (w *WebServer) EnableAPI(token string) {
+	w.apiToken = token
+}
+
+func (w *WebServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if strings.HasPrefix(req.URL.Path, "/api/v1/") {
+		if w.apiToken == "" {
+			http.NotFound(rw, req)
+			return
+		}
+		if !tokenMatches(req, w.apiToken) {
+			writeAPIError(rw, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		w.api.ServeHTTP(rw, req)
+		return
+	}
+	if strings.HasPrefix(req.URL.Path, "/hooks/") {
+		w.handleHook(rw, req)
+		return
+	}
+	if req.URL.Path == githubWebhookPath {
+		w.handleGitHub(rw, req)
+		return
+	}
+	if strings.HasPrefix(req.URL.Path, "/guest/") {
+		w.handleGuest(rw, req)
+		return
+	}
+	if !tokenMatches(req, w.token) {
+		http.Error(rw, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.mux.ServeHTTP(rw, req)
+}
+
+// tokenMatches reports whether req carries want as a bearer token or ?token=.
+// An empty want never matches.
+func tokenMatches(req *http.Request, want string) bool {
+	if want == "" {
+		return false
+	}
+	got := req.URL.Query().Get("token")
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		got = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// ListenAndServe serves on addr until ctx is cancelled.
+func (w *WebServer) ListenAndServe(ctx context.Context, addr string) error {
+	srv := &http.Server{Addr: addr, Handler: w, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	slog.Info("web: dashboard listening", "addr", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+type dashboardChat struct {
+	ChatID    string `json:"chatID"`
+	WorkDir   string `json:"workDir"`
+	Model     string `json:"model"`
+	Mode      string `json:"mode"`
+	SessionID string `json:"sessionID"`
+	Pending   int    `json:"pending"`
+}
+
+type dashboardDay struct {
+	Date   string `json:"date"`
+	Count  int    `json:"count"`
+	Errors int    `json:"errors"`
+	// Width is the bar width in percent relative to the busiest day.
+	Width int `json:"-"`
+}
+
+type dashboardBinding struct {
+	Path  string `json:"path"`
+	DocID string `json:"docID"`
+}
+
+type dashboardData struct {
+	GeneratedAt time.Time          `json:"generatedAt"`
+	Uptime      string             `json:"uptime"`
+	ExecCount   int                `json:"execCount"`
+	Running     []ExecRecord       `json:"running"`
+	Chats       []dashboardChat    `json:"chats"`
+	History     []ExecRecord       `json:"history"`
+	Usage       []dashboardDay     `json:"usage"`
+	DocBindings []dashboardBinding `json:"docBindings"`
+}
+
+func (w *WebServer) snapshot() dashboardData {
+	r := w.router
+	now := time.Now()
+	data := dashboardData{
+		GeneratedAt: now,
+		Uptime:      now.Sub(r.startTime).Truncate(time.Second).String(),
+		ExecCount:   r.executor.ExecCount(),
+		Running:     r.ActiveExecs(),
+		History:     r.store.ExecRecords("", 50),
+	}
+
+	var pending map[string]int
+	if r.queue != nil {
+		pending = r.queue.Snapshot()
+	}
+	for id, sess := range r.store.Sessions() {
+		mode := sess.PermissionMode
+		if mode == "" {
+			mode = "safe"
+		}
+		data.Chats = append(data.Chats, dashboardChat{
+			ChatID:    id,
+			WorkDir:   sess.WorkDir,
+			Model:     sess.Model,
+			Mode:      mode,
+			SessionID: sess.ClaudeSessionID,
+			Pending:   pending[id],
+		})
+	}
+	sort.Slice(data.Chats, func(i, j int) bool { return data.Chats[i].ChatID < data.Chats[j].ChatID })
+
+	data.Usage = usageByDay(r.store.ExecRecords("", 0), now, usageDays)
+
+	for path, docID := range r.store.DocBindings() {
+		data.DocBindings = append(data.DocBindings, dashboardBinding{Path: path, DocID: docID})
+	}
+	sort.Slice(data.DocBindings, func(i, j int) bool { return data.DocBindings[i].Path < data.DocBindings[j].Path })
+	return data
+}
+
+// usageByDay buckets records into the last n calendar days (oldest first).
+func usageByDay(records []ExecRecord, now time.Time, n int) []dashboardDay {
+	days := make([]dashboardDay, n)
+	index := make(map[string]int, n)
+	for i := 0; i < n; i++ {
+		date := now.AddDate(0, 0, i-n+1).Format("2006-01-02")
+		days[i].Date = date
+		index[date] = i
+	}
+	max := 0
+	for _, rec := range records {
+		i, ok := index[rec.StartedAt.Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		days[i].Count++
+		if rec.Error != "" {
+			days[i].Errors++
+		}
+		if days[i].Count > max {
+			max = days[i].Count
+		}
+	}
+	if max > 0 {
+		for i := range days {
+			days[i].Width = days[i].Count * 100 / max
+		}
+	}
+	return days
+}
+
+func (w *WebServer) handleState(rw http.ResponseWriter, _ *http.Request) {
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(rw).Encode(w.snapshot())
+}
+
+func (w *WebServer) handleDashboard(rw http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		http.NotFound(rw, req)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(rw, w.snapshot()); err != nil {
+		slog.Warn("web: render dashboard", "err", err)
+	}
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"snippet": func(s string) string { return truncateRunes(strings.TrimSpace(s), 80) },
+	"since":   func(t time.Time) string { return time.Since(t).Truncate(time.Second).String() },
+	"clock":   func(t time.Time) string { return t.Format("01-02 15:04:05") },
+	"dur":     func(d time.Duration) string { return d.Truncate(time.Millisecond).String() },
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta http-equiv="refresh" content="15">
+<title>DevBot Dashboard</title>
+<style>
+body{font-family:sans-serif;margin:24px;color:#1f2329}
+table{border-collapse:collapse;margin-bottom:24px;width:100%}
+th,td{border-bottom:1px solid #dee0e3;padding:4px 8px;text-align:left;font-size:13px}
+code{font-size:12px}.err{color:#d83931}.bar{background:#3370ff;height:10px}
+</style></head><body>
+<h1>DevBot</h1>
+<p>运行时长 {{.Uptime}} · 执行次数 {{.ExecCount}} · 更新于 {{clock .GeneratedAt}}</p>
+
+<h2>执行中 ({{len .Running}})</h2>
+<table><tr><th>ID</th><th>Chat</th><th>Prompt</th><th>已运行</th></tr>
+{{range .Running}}<tr><td><code>{{.ID}}</code></td><td><code>{{.ChatID}}</code></td><td>{{snippet .Prompt}}</td><td>{{since .StartedAt}}</td></tr>
+{{else}}<tr><td colspan="4">空闲</td></tr>{{end}}</table>
+
+<h2>会话与队列</h2>
+<table><tr><th>Chat</th><th>工作目录</th><th>模型</th><th>模式</th><th>会话</th><th>排队</th></tr>
+{{range .Chats}}<tr><td><code>{{.ChatID}}</code></td><td><code>{{.WorkDir}}</code></td><td>{{.Model}}</td><td>{{.Mode}}</td><td><code>{{.SessionID}}</code></td><td>{{.Pending}}</td></tr>
+{{end}}</table>
+
+<h2>用量（最近 {{len .Usage}} 天）</h2>
+<table><tr><th>日期</th><th>执行</th><th>失败</th><th style="width:60%"></th></tr>
+{{range .Usage}}<tr><td>{{.Date}}</td><td>{{.Count}}</td><td>{{.Errors}}</td><td><div class="bar" style="width:{{.Width}}%"></div></td></tr>
+{{end}}</table>
+
+<h2>最近执行</h2>
+<table><tr><th>时间</th><th>ID</th><th>Chat</th><th>Prompt</th><th>耗时</th><th>结果</th></tr>
+{{range .History}}<tr><td>{{clock .StartedAt}}</td><td><code>{{.ID}}</code></td><td><code>{{.ChatID}}</code></td><td>{{snippet .Prompt}}</td><td>{{dur .Duration}}</td><td>{{if .Error}}<span class="err">{{snippet .Error}}</span>{{else}}✓{{end}}</td></tr>
+{{end}}</table>
+
+<h2>文档绑定</h2>
+<table><tr><th>文件</th><th>文档 ID</th></tr>
+{{range .DocBindings}}<tr><td><code>{{.Path}}</code></td><td><code>{{.DocID}}</code></td></tr>
+{{end}}</table>
+</body></html>
+`))
@@ -0,0 +1,145 @@
+package bot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestWebServer(t *testing.T) (*WebServer, *Router) {
+	t.Helper()
+	r, _ := newTestRouter(t)
+	r.SetQueue(NewMessageQueue())
+	return NewWebServer(r, "secret"), r
+}
+
+func TestWebServer_RejectsMissingToken(t *testing.T) {
+	w, _ := newTestWebServer(t)
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rec.Code)
+	}
+}
+
+func TestWebServer_RejectsWrongToken(t *testing.T) {
+	w, _ := newTestWebServer(t)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer nope")
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rec.Code)
+	}
+}
+
+func TestWebServer_EmptyTokenNeverAuthorizes(t *testing.T) {
+	r, _ := newTestRouter(t)
+	w := NewWebServer(r, "")
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?token=", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 when no token configured, got %d", rec.Code)
+	}
+}
+
+func TestWebServer_ReadOnly(t *testing.T) {
+	w, _ := newTestWebServer(t)
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/state?token=secret", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for POST, got %d", rec.Code)
+	}
+}
+
+func TestWebServer_Dashboard(t *testing.T) {
+	w, r := newTestWebServer(t)
+	r.getSession("chat1")
+	r.store.SetDocBinding("/tmp/a.md", "doc1")
+	r.store.AddExecRecord(ExecRecord{ID: "abc123", ChatID: "chat1", Prompt: "fix the <bug>", StartedAt: time.Now()})
+
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?token=secret", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"chat1", "abc123", "doc1", "fix the &lt;bug&gt;"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected %q in dashboard, got: %s", want, body)
+		}
+	}
+}
+
+func TestWebServer_UnknownPath(t *testing.T) {
+	w, _ := newTestWebServer(t)
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/nope?token=secret", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestWebServer_StateJSON(t *testing.T) {
+	w, r := newTestWebServer(t)
+	r.getSession("chat1")
+	r.store.AddExecRecord(ExecRecord{ID: "e1", ChatID: "chat1", Prompt: "hello", StartedAt: time.Now()})
+	r.store.AddExecRecord(ExecRecord{ID: "e2", ChatID: "chat1", Prompt: "boom", Error: "failed", StartedAt: time.Now()})
+	r.setActive(ExecRecord{ID: "run1", ChatID: "chat1", Prompt: "working", StartedAt: time.Now()})
+
+	block := make(chan struct{})
+	r.queue.Enqueue("chat1", func() { <-block })
+	defer close(block)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/state", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var data dashboardData
+	if err := json.Unmarshal(rec.Body.Bytes(), &data); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(data.History) != 2 || data.History[0].ID != "e2" {
+		t.Fatalf("unexpected history: %+v", data.History)
+	}
+	if len(data.Running) != 1 || data.Running[0].ID != "run1" {
+		t.Fatalf("unexpected running: %+v", data.Running)
+	}
+	if len(data.Chats) != 1 || data.Chats[0].Pending != 1 {
+		t.Fatalf("expected chat1 with 1 pending task, got %+v", data.Chats)
+	}
+	today := data.Usage[len(data.Usage)-1]
+	if today.Count != 2 || today.Errors != 1 {
+		t.Fatalf("expected today's usage 2/1, got %+v", today)
+	}
+}
+
+func TestUsageByDay(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.Local)
+	records := []ExecRecord{
+		{StartedAt: now},
+		{StartedAt: now.Add(-time.Hour), Error: "x"},
+		{StartedAt: now.AddDate(0, 0, -1)},
+		{StartedAt: now.AddDate(0, 0, -30)}, // outside the window
+	}
+	days := usageByDay(records, now, 3)
+	if len(days) != 3 {
+		t.Fatalf("expected 3 days, got %d", len(days))
+	}
+	if days[0].Date != "2024-05-08" || days[2].Date != "2024-05-10" {
+		t.Fatalf("unexpected dates: %+v", days)
+	}
+	if days[2].Count != 2 || days[2].Errors != 1 || days[2].Width != 100 {
+		t.Fatalf("unexpected today bucket: %+v", days[2])
+	}
+	if days[1].Count != 1 || days[1].Width != 50 {
+		t.Fatalf("unexpected yesterday bucket: %+v", days[1])
+	}
+}
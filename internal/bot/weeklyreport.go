@@ -0,0 +1,316 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// reportCommitSlack extends each execution's window when matching
+	// commits to it, for commits made just after Claude finished.
+	reportCommitSlack = 2 * time.Minute
+	// maxReportCommits bounds the commit subjects listed per repository.
+	maxReportCommits = 10
+)
+
+// SetReportFolder sets the Feishu folder token /report week creates its
+// document in ("" = the app's root folder).
+func (r *Router) SetReportFolder(token string) {
+	r.reportFolder = token
+}
+
+// repoActivity is one repository's share of the weekly report.
+type repoActivity struct {
+	Root       string
+	Executions int
+	Failures   int
+	Duration   time.Duration
+	Commits    []string // "<hash> <subject>", newest first
+	Feedback   feedbackTally
+	windows    [][2]time.Time
+}
+
+// weeklyStats aggregates the bot's activity over a period.
+type weeklyStats struct {
+	Start, End   time.Time
+	Executions   int
+	Failures     int
+	Duration     time.Duration
+	Chats        int
+	Repos        []*repoActivity // busiest first
+	FailureTypes map[string]int
+	DocPushes    int
+	DocPulls     int
+	DocPaths     []string
+	Feedback     feedbackSummary
+}
+
+// failureType classifies an execution error for the report.
+func failureType(msg string) string {
+	m := strings.ToLower(msg)
+	switch {
+	case strings.Contains(m, "timed out") || strings.Contains(m, "deadline exceeded") || strings.Contains(m, "超时"):
+		return "超时"
+	case strings.Contains(m, "canceled") || strings.Contains(m, "cancelled") || strings.Contains(m, "killed") || strings.Contains(m, "终止") || strings.Contains(m, "取消"):
+		return "被取消或终止"
+	case strings.Contains(m, "rate limit") || strings.Contains(m, "429") || strings.Contains(m, "overloaded") || strings.Contains(m, "529"):
+		return "限流或服务过载"
+	case strings.Contains(m, "executor") || strings.Contains(m, "failed to start"):
+		return "执行器不可用"
+	case strings.Contains(m, "failed to parse") || strings.Contains(m, "no result event"):
+		return "输出解析失败"
+	}
+	return "其他错误"
+}
+
+// botCommits lists the commits in the repository at root made inside one of
+// windows, newest first.
+func botCommits(root string, since time.Time, windows [][2]time.Time) []string {
+	out, err := runGitOutput(root, "log", "--all", "--since="+since.Format(time.RFC3339), "--format=%ct%x09%h%x09%s")
+	if err != nil || out == "" {
+		return nil
+	}
+	var commits []string
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(line, "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		sec, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		at := time.Unix(sec, 0)
+		for _, w := range windows {
+			if !at.Before(w[0]) && !at.After(w[1]) {
+				commits = append(commits, parts[1]+" "+parts[2])
+				break
+			}
+		}
+	}
+	return commits
+}
+
+// collectWeeklyStats aggregates the executions, commits made during them
+// and document syncs of the 7 days before now.
+func (r *Router) collectWeeklyStats(now time.Time) weeklyStats {
+	st := weeklyStats{Start: now.AddDate(0, 0, -7), End: now, FailureTypes: make(map[string]int)}
+	chats := make(map[string]bool)
+	roots := make(map[string]string) // workdir -> repo root
+	repos := make(map[string]*repoActivity)
+	var rated []ExecRecord
+	for _, rec := range r.store.ExecRecords("", 0) {
+		if rec.StartedAt.Before(st.Start) || rec.StartedAt.After(now) {
+			continue
+		}
+		if rec.Rating != "" {
+			rated = append(rated, rec)
+		}
+		st.Executions++
+		st.Duration += rec.Duration
+		chats[rec.ChatID] = true
+		if rec.Error != "" {
+			st.Failures++
+			st.FailureTypes[failureType(rec.Error)]++
+		}
+		if rec.WorkDir == "" {
+			continue
+		}
+		root, ok := roots[rec.WorkDir]
+		if !ok {
+			root = rec.WorkDir
+			if top, _, isRepo := repoState(rec.WorkDir); isRepo {
+				root = top
+			}
+			roots[rec.WorkDir] = root
+		}
+		a := repos[root]
+		if a == nil {
+			a = &repoActivity{Root: root}
+			repos[root] = a
+		}
+		a.Executions++
+		a.Duration += rec.Duration
+		if rec.Error != "" {
+			a.Failures++
+		}
+		a.Feedback.add(rec.Rating)
+		a.windows = append(a.windows, [2]time.Time{rec.StartedAt, rec.StartedAt.Add(rec.Duration + reportCommitSlack)})
+	}
+	st.Chats = len(chats)
+	st.Feedback = summarizeFeedback(rated)
+	for _, a := range repos {
+		a.Commits = botCommits(a.Root, st.Start, a.windows)
+		st.Repos = append(st.Repos, a)
+	}
+	sort.Slice(st.Repos, func(i, j int) bool {
+		if st.Repos[i].Executions != st.Repos[j].Executions {
+			return st.Repos[i].Executions > st.Repos[j].Executions
+		}
+		return st.Repos[i].Root < st.Repos[j].Root
+	})
+
+	seen := make(map[string]bool)
+	for _, d := range r.store.DocSyncs(st.Start) {
+		if d.Direction == "pull" {
+			st.DocPulls++
+		} else {
+			st.DocPushes++
+		}
+		if !seen[d.Path] {
+			seen[d.Path] = true
+			st.DocPaths = append(st.DocPaths, d.Path)
+		}
+	}
+	return st
+}
+
+// Markdown renders the statistics section of the report.
+func (st weeklyStats) Markdown() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "统计周期: %s ~ %s\n", st.Start.Format("2006-01-02"), st.End.Format("2006-01-02"))
+	fmt.Fprintf(&sb, "执行 %d 次，失败 %d 次，总耗时 %s，涉及 %d 个聊天、%d 个项目\n", st.Executions, st.Failures, st.Duration.Truncate(time.Second), st.Chats, len(st.Repos))
+
+	sb.WriteString("\n## 各项目\n")
+	if len(st.Repos) == 0 {
+		sb.WriteString("（无）\n")
+	}
+	for _, a := range st.Repos {
+		fmt.Fprintf(&sb, "\n### %s\n", filepath.Base(a.Root))
+		fmt.Fprintf(&sb, "执行 %d 次，失败 %d 次，耗时 %s，提交 %d 个", a.Executions, a.Failures, a.Duration.Truncate(time.Second), len(a.Commits))
+		if a.Feedback.Up+a.Feedback.Down > 0 {
+			sb.WriteString("，" + a.Feedback.String())
+		}
+		sb.WriteString("\n")
+		for i, c := range a.Commits {
+			if i == maxReportCommits {
+				fmt.Fprintf(&sb, "- ……另有 %d 个提交\n", len(a.Commits)-maxReportCommits)
+				break
+			}
+			fmt.Fprintf(&sb, "- %s\n", c)
+		}
+	}
+
+	sb.WriteString("\n## 失败类型\n")
+	if len(st.FailureTypes) == 0 {
+		sb.WriteString("（无）\n")
+	}
+	types := make([]string, 0, len(st.FailureTypes))
+	for t := range st.FailureTypes {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if st.FailureTypes[types[i]] != st.FailureTypes[types[j]] {
+			return st.FailureTypes[types[i]] > st.FailureTypes[types[j]]
+		}
+		return types[i] < types[j]
+	})
+	for _, t := range types {
+		fmt.Fprintf(&sb, "- %s: %d 次\n", t, st.FailureTypes[t])
+	}
+
+	sb.WriteString("\n## 用户反馈\n" + st.Feedback.Markdown())
+
+	fmt.Fprintf(&sb, "\n## 文档同步\n推送 %d 次，拉取 %d 次\n", st.DocPushes, st.DocPulls)
+	for _, p := range st.DocPaths {
+		fmt.Fprintf(&sb, "- %s\n", filepath.Base(p))
+	}
+	return sb.String()
+}
+
+// weeklyReportPrompt asks Claude for the narrative part of the report.
+func weeklyReportPrompt(stats string) string {
+	return "以下是团队本周通过 devbot 完成的工作统计（执行记录、每个项目在执行期间产生的提交、失败类型、用户对结果的反馈和飞书文档同步）。" +
+		"请据此用中文写一段周报总结：概括各项目完成了什么、值得关注的失败或风险、用户不满意的请求类型，以及下周可以改进的地方。" +
+		"只根据统计内容写，不要编造；不要重复罗列数字；不要使用 Markdown 标题；直接输出正文。\n\n" + stats
+}
+
+func (r *Router) cmdReport(ctx context.Context, chatID, args string) {
+	if strings.TrimSpace(args) != "week" {
+		r.sender.SendText(ctx, chatID, "用法: /report week\n汇总最近 7 天所有聊天的执行、各项目通过机器人产生的提交、常见失败类型和文档同步，由 Claude 撰写总结后生成飞书文档。")
+		return
+	}
+	id := newExecID()
+	if r.queue == nil {
+		r.runWeeklyReport(ctx, chatID, id)
+		return
+	}
+	r.setQueued(ExecRecord{ID: id, ChatID: chatID, Prompt: "/report week", StartedAt: time.Now()})
+	pos, err := r.queue.EnqueueTask(chatID, QueueEntry{ID: id}, func() {
+		r.runWeeklyReport(r.ctx, chatID, id)
+	})
+	if err != nil {
+		r.clearQueued(id)
+		r.sender.SendText(ctx, chatID, "队列已满，请稍后再试。")
+		return
+	}
+	if pos > 1 {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: fmt.Sprintf("已排队（第 %d 位）", pos), Content: "当前有任务正在执行，请稍候...", Template: "blue"})
+	}
+}
+
+// runWeeklyReport collects the week's statistics, has Claude draft the
+// summary and publishes both as a Feishu document.
+func (r *Router) runWeeklyReport(ctx context.Context, chatID, id string) {
+	r.clearQueued(id)
+	now := time.Now()
+	st := r.collectWeeklyStats(now)
+	if st.Executions == 0 && st.DocPushes+st.DocPulls == 0 {
+		r.sender.SendText(ctx, chatID, "最近 7 天没有执行记录或文档同步，无需生成周报。")
+		return
+	}
+	r.sender.SendText(ctx, chatID, "正在生成周报...")
+	stats := st.Markdown()
+
+	workDir := r.store.WorkRoot()
+	rec := ExecRecord{
+		ID:             id,
+		ChatID:         chatID,
+		Prompt:         "/report week",
+		WorkDir:        workDir,
+		StartedAt:      now,
+		Model:          r.summaryModel,
+		PermissionMode: "safe",
+	}
+	r.setActive(rec)
+	result, err := r.executor.ExecStream(ctx, weeklyReportPrompt(stats), workDir, "", "safe", r.summaryModel, nil)
+	r.clearActive(id)
+	rec.Duration = time.Since(now)
+	rec.setResultMeta(result)
+	summary := strings.TrimSpace(result.Output)
+	if err != nil {
+		rec.Error = err.Error()
+		summary = fmt.Sprintf("（Claude 生成总结失败: %s）", truncateRunes(err.Error(), 200))
+	} else {
+		rec.Output = result.Output
+	}
+	r.addExecRecord("report", rec)
+	r.save()
+
+	title := fmt.Sprintf("DevBot 周报 %s ~ %s", st.Start.Format("2006-01-02"), st.End.Format("2006-01-02"))
+	content := "# 总结\n" + summary + "\n\n# 统计\n" + stats
+	if r.docSyncer == nil {
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: truncateForDisplay(content, 8000)})
+		return
+	}
+	var docID, docURL string
+	if fp, ok := r.docSyncer.(folderDocPusher); ok && r.reportFolder != "" {
+		docID, docURL, err = fp.CreateDocInFolder(ctx, r.reportFolder, title, content)
+	} else {
+		docID, docURL, err = r.docSyncer.CreateAndPushDoc(ctx, title, content)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "router: weekly report doc failed", "chat_id", chatID, "err", err)
+		r.sender.SendCard(ctx, chatID, CardMsg{Title: title + "（文档创建失败）", Content: fmt.Sprintf("创建飞书文档出错: %v\n\n%s", err, truncateForDisplay(content, 6000)), Template: "orange"})
+		return
+	}
+	slog.InfoContext(ctx, "router: weekly report", "chat_id", chatID, "doc", docID)
+	md := fmt.Sprintf("**链接:** [%s](%s)\n\n执行 %d 次 · 失败 %d 次 · %d 个项目 · 文档同步 %d 次\n\n%s", docURL, docURL, st.Executions, st.Failures, len(st.Repos), st.DocPushes+st.DocPulls, truncateRunes(summary, 300))
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: "📊 " + title, Content: md, Template: "green"})
+}
@@ -0,0 +1,139 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFailureType(t *testing.T) {
+	cases := map[string]string{
+		"execution timed out after 10m0s":          "超时",
+		"claude error: signal: killed":             "被取消或终止",
+		"claude error: 429 rate limit exceeded":    "限流或服务过载",
+		"executor rpc: connection refused":         "执行器不可用",
+		"failed to parse claude response: EOF":     "输出解析失败",
+		"claude error: something unexpected broke": "其他错误",
+	}
+	for msg, want := range cases {
+		if got := failureType(msg); got != want {
+			t.Errorf("failureType(%q) = %q, want %q", msg, got, want)
+		}
+	}
+}
+
+// commitAt makes an empty commit in repo with the given time.
+func commitAt(t *testing.T, repo, msg string, at time.Time) {
+	t.Helper()
+	cmd := exec.Command("git", "-C", repo, "commit", "-q", "--allow-empty", "-m", msg)
+	date := at.Format(time.RFC3339)
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date,
+		"GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@t", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@t")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git commit: %v %s", err, out)
+	}
+}
+
+// newReportRouter returns a router whose store holds a week of activity in
+// one git repository.
+func newReportRouter(t *testing.T, claude string) (*Router, *spySender, time.Time) {
+	t.Helper()
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "api")
+	os.MkdirAll(filepath.Join(repo, "cmd"), 0755)
+	if out, err := exec.Command("git", "init", "-q", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v %s", err, out)
+	}
+	now := time.Now().Truncate(time.Second)
+	start := now.Add(-48 * time.Hour)
+	commitAt(t, repo, "manual change", start.Add(-time.Hour))
+	commitAt(t, repo, "fix login retry", start.Add(5*time.Minute))
+	commitAt(t, repo, "add tests", start.Add(11*time.Minute))
+	commitAt(t, repo, "unrelated later", start.Add(3*time.Hour))
+
+	store, _ := NewStore(filepath.Join(dir, "state.json"))
+	executor := NewClaudeExecutor(claude, "sonnet", 10*time.Second)
+	sender := &spySender{}
+	r := NewRouter(context.Background(), executor, store, sender, map[string]bool{"user1": true}, dir, nil)
+	store.AddExecRecord(ExecRecord{ID: "old", ChatID: "chat1", WorkDir: repo, StartedAt: now.AddDate(0, 0, -9), Error: "execution timed out"})
+	store.AddExecRecord(ExecRecord{ID: "e1", ChatID: "chat1", WorkDir: filepath.Join(repo, "cmd"), StartedAt: start, Duration: 10 * time.Minute})
+	store.AddExecRecord(ExecRecord{ID: "e2", ChatID: "chat2", WorkDir: repo, StartedAt: start.Add(time.Hour), Duration: time.Minute, Error: "execution timed out after 1m"})
+	store.AddExecRecord(ExecRecord{ID: "e3", ChatID: "chat2", WorkDir: dir, StartedAt: start.Add(2 * time.Hour), Error: "claude error: boom"})
+	store.AddDocSync(DocSync{ChatID: "chat1", Path: filepath.Join(repo, "README.md"), DocID: "d1", Direction: "push", At: start})
+	store.AddDocSync(DocSync{ChatID: "chat1", Path: filepath.Join(repo, "README.md"), DocID: "d1", Direction: "pull", At: start.Add(time.Hour)})
+	store.AddDocSync(DocSync{ChatID: "chat1", Path: "old.md", DocID: "d0", Direction: "push", At: now.AddDate(0, 0, -8)})
+	return r, sender, now
+}
+
+func TestCollectWeeklyStats(t *testing.T) {
+	r, _, now := newReportRouter(t, "claude")
+	st := r.collectWeeklyStats(now)
+	if st.Executions != 3 || st.Failures != 2 || st.Chats != 2 || st.Duration != 11*time.Minute {
+		t.Fatalf("unexpected totals %+v", st)
+	}
+	if st.FailureTypes["超时"] != 1 || st.FailureTypes["其他错误"] != 1 {
+		t.Fatalf("unexpected failure types %v", st.FailureTypes)
+	}
+	if len(st.Repos) != 2 || filepath.Base(st.Repos[0].Root) != "api" || st.Repos[0].Executions != 2 {
+		t.Fatalf("unexpected repos %+v", st.Repos)
+	}
+	commits := st.Repos[0].Commits
+	if len(commits) != 2 || !strings.HasSuffix(commits[0], " add tests") || !strings.HasSuffix(commits[1], " fix login retry") {
+		t.Fatalf("expected commits made during executions, got %v", commits)
+	}
+	if st.DocPushes != 1 || st.DocPulls != 1 || len(st.DocPaths) != 1 {
+		t.Fatalf("unexpected doc syncs %+v", st)
+	}
+	md := st.Markdown()
+	for _, want := range []string{"执行 3 次，失败 2 次", "### api", "提交 2 个", "- 超时: 1 次", "推送 1 次，拉取 1 次", "- README.md"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected %q in report:\n%s", want, md)
+		}
+	}
+}
+
+// fakeFolderDocPusher records the folder a document was created in.
+type fakeFolderDocPusher struct {
+	fakeDocPusher
+	folder string
+}
+
+func (f *fakeFolderDocPusher) CreateDocInFolder(ctx context.Context, folder, title, content string) (string, string, error) {
+	f.folder = folder
+	return f.CreateAndPushDoc(ctx, title, content)
+}
+
+func TestRouterWeeklyReport(t *testing.T) {
+	claude := filepath.Join(t.TempDir(), "claude")
+	os.WriteFile(claude, []byte(`#!/bin/sh
+case "$(cat)" in *"fix login retry"*) ;; *) exit 1 ;; esac
+echo '{"type":"result","result":"本周修复了登录重试。","session_id":"s1"}'
+`), 0755)
+	r, sender, _ := newReportRouter(t, claude)
+	docs := &fakeFolderDocPusher{fakeDocPusher: fakeDocPusher{returnDocID: "doc1", returnDocURL: "https://feishu.cn/docx/doc1"}}
+	r.docSyncer = docs
+	r.SetReportFolder("fld1")
+
+	r.Route(context.Background(), "chat1", "user1", "/report week")
+	if docs.folder != "fld1" || !strings.HasPrefix(docs.createdTitle, "DevBot 周报 ") {
+		t.Fatalf("expected report doc in folder, got %q %q", docs.folder, docs.createdTitle)
+	}
+	if !strings.HasPrefix(docs.createdContent, "# 总结\n本周修复了登录重试。\n\n# 统计\n") {
+		t.Fatalf("unexpected doc content %q", docs.createdContent)
+	}
+	if msg := sender.LastMessage(); !strings.Contains(msg, "https://feishu.cn/docx/doc1") || !strings.Contains(msg, "执行 3 次") {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	if rec, ok := r.store.ExecRecord(r.store.ExecRecords("chat1", 1)[0].ID); !ok || rec.Prompt != "/report week" || rec.Error != "" {
+		t.Fatalf("expected report execution recorded, got %+v", rec)
+	}
+
+	r.Route(context.Background(), "chat1", "user1", "/report")
+	if !strings.Contains(sender.LastMessage(), "用法: /report week") {
+		t.Fatalf("unexpected usage %q", sender.LastMessage())
+	}
+}
@@ -0,0 +1,210 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// pendingWriteTTL is how long /write or /append without content waits for
+// the next message.
+const pendingWriteTTL = 5 * time.Minute
+
+// configWriteNames are files and directories /write must not touch: they
+// configure what the bot or Claude run (.devbot.yaml commands, Claude
+// hooks and MCP servers), so writing them would give shell access.
+var configWriteNames = map[string]bool{repoConfigFile: true, ".claude": true, ".mcp.json": true}
+
+// pendingWrite is a /write or /append waiting for its content in the
+// next message of the user who sent it.
+type pendingWrite struct {
+	path    string // absolute
+	rel     string // as typed
+	append  bool
+	created time.Time
+}
+
+// writeTarget resolves the path of /write or /append against workDir. The
+// file must stay under the work root, even through symlinks, and outside
+// .git, the reference directories and configWriteNames.
+func (r *Router) writeTarget(workDir, rel string) (string, error) {
+	root := r.store.WorkRoot()
+	path := rel
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workDir, rel)
+	}
+	path = filepath.Clean(path)
+	if !underRoot(root, path) || path == root {
+		return "", fmt.Errorf("只能写入根目录 %s 下的文件", root)
+	}
+	if name, ok := r.referenceDirOf(path); ok {
+		return "", fmt.Errorf("%s 在只读参考目录 %s 中", rel, name)
+	}
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		if part == ".git" {
+			return "", fmt.Errorf("不能写入 .git 目录")
+		}
+		if configWriteNames[part] {
+			return "", fmt.Errorf("不能写入 %s（配置可执行的命令）", part)
+		}
+	}
+	// An existing file or directory on the way may be a symlink leading
+	// out of the root.
+	for dir := path; underRoot(root, dir) && dir != root; dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(dir); err != nil {
+			continue
+		}
+		real, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return "", err
+		}
+		if realRoot, err := filepath.EvalSymlinks(root); err == nil && !underRoot(realRoot, real) {
+			return "", fmt.Errorf("%s 指向根目录之外", rel)
+		}
+		if name, ok := r.referenceDirOf(real); ok {
+			return "", fmt.Errorf("%s 在只读参考目录 %s 中", rel, name)
+		}
+		break
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return "", fmt.Errorf("%s 是目录", rel)
+	}
+	return path, nil
+}
+
+// writeBody turns the content of a message into file content: a message
+// that is a single fenced code block is unwrapped, and the content ends
+// with a newline.
+func writeBody(text string) string {
+	body := strings.Trim(text, "\r\n")
+	if lines := strings.Split(body, "\n"); len(lines) >= 2 &&
+		strings.HasPrefix(strings.TrimSpace(lines[0]), "```") && strings.TrimSpace(lines[len(lines)-1]) == "```" {
+		body = strings.Join(lines[1:len(lines)-1], "\n")
+	}
+	if body != "" && !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+	return body
+}
+
+// cmdWrite handles /write and /append: the first line names the file and
+// the rest of the message is the content; without content the chat's next
+// message is used.
+func (r *Router) cmdWrite(ctx context.Context, chatID, args string, appendMode bool) {
+	name := "/write"
+	if appendMode {
+		name = "/append"
+	}
+	first, body, _ := strings.Cut(args, "\n")
+	rel := strings.TrimSpace(first)
+	if rel == "" {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("用法: %[1]s <文件路径>\n<内容>\n\n内容写在命令的下一行起；只发 %[1]s <文件路径> 时，下一条消息作为内容（%[2]d 分钟内有效，%[1]s cancel 取消）。整条内容是一个 ``` 代码块时自动去掉围栏。", name, int(pendingWriteTTL.Minutes())))
+		return
+	}
+	key := pendingWriteKey(chatID, userIDFrom(ctx))
+	if rel == "cancel" {
+		r.mu.Lock()
+		_, ok := r.pendingWrites[key]
+		delete(r.pendingWrites, key)
+		r.mu.Unlock()
+		if ok {
+			r.sender.SendText(ctx, chatID, "✓ 已取消等待写入的内容。")
+		} else {
+			r.sender.SendText(ctx, chatID, "当前没有等待内容的写入。")
+		}
+		return
+	}
+	path, err := r.writeTarget(r.getSession(chatID).WorkDir, rel)
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("无法写入: %v", err))
+		return
+	}
+	if strings.TrimSpace(body) == "" {
+		r.mu.Lock()
+		r.pendingWrites[key] = &pendingWrite{path: path, rel: rel, append: appendMode, created: time.Now()}
+		r.mu.Unlock()
+		verb := "写入"
+		if appendMode {
+			verb = "追加到"
+		}
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("请发送要%s %s 的内容（%d 分钟内有效，%s cancel 取消）。", verb, rel, int(pendingWriteTTL.Minutes()), name))
+		return
+	}
+	r.writeFile(ctx, chatID, pendingWrite{path: path, rel: rel, append: appendMode}, body)
+}
+
+// pendingWriteKey keys pending writes by chat and user, so only the user
+// who sent /write provides its content.
+func pendingWriteKey(chatID, userID string) string {
+	return chatID + "\x00" + userID
+}
+
+// takePendingWrite returns and clears userID's /write or /append in the
+// chat waiting for content, if it has not expired.
+func (r *Router) takePendingWrite(chatID, userID string) *pendingWrite {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := pendingWriteKey(chatID, userID)
+	p := r.pendingWrites[key]
+	delete(r.pendingWrites, key)
+	if p == nil || time.Since(p.created) > pendingWriteTTL {
+		return nil
+	}
+	return p
+}
+
+// writeFile writes or appends text to w.path, creating parent directories,
+// and confirms with a card. The target is checked again, as a symlink may
+// have appeared on the way since /write.
+func (r *Router) writeFile(ctx context.Context, chatID string, w pendingWrite, text string) {
+	if _, err := r.writeTarget("", w.path); err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("无法写入: %v", err))
+		return
+	}
+	body := writeBody(text)
+	if err := os.MkdirAll(filepath.Dir(w.path), 0755); err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("创建目录失败: %v", err))
+		return
+	}
+	_, statErr := os.Stat(w.path)
+	created := os.IsNotExist(statErr)
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if w.append {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		// Start on a new line when the file does not end with one.
+		if data, err := os.ReadFile(w.path); err == nil && len(data) > 0 && data[len(data)-1] != '\n' {
+			body = "\n" + body
+		}
+	}
+	f, err := os.OpenFile(w.path, flags, 0644)
+	if err == nil {
+		_, err = f.WriteString(body)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		r.sender.SendText(ctx, chatID, fmt.Sprintf("写入 %s 失败: %v", w.rel, err))
+		return
+	}
+	size := int64(0)
+	if info, err := os.Stat(w.path); err == nil {
+		size = info.Size()
+	}
+	slog.InfoContext(ctx, "router: wrote file", "path", w.path, "chat_id", chatID, "bytes", len(body), "append", w.append)
+
+	title := "✓ 已写入 " + w.rel
+	switch {
+	case w.append:
+		title = "✓ 已追加到 " + w.rel
+	case created:
+		title = "✓ 已创建 " + w.rel
+	}
+	lines := strings.Count(body, "\n")
+	content := fmt.Sprintf("**路径:** `%s`\n**本次写入:** %d 字节（%d 行）\n**文件大小:** %s", w.path, len(body), lines, formatSize(size))
+	r.sender.SendCard(ctx, chatID, CardMsg{Title: title, Content: content, Template: "green"})
+}
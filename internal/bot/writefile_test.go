@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteBody(t *testing.T) {
+	cases := map[string]string{
+		"key: value":                     "key: value\n",
+		"\na\nb\n\n":                     "a\nb\n",
+		"```yaml\nkey: value\n```":       "key: value\n",
+		"```\nline\n```\ntrailing prose": "```\nline\n```\ntrailing prose\n",
+	}
+	for in, want := range cases {
+		if got := writeBody(in); got != want {
+			t.Errorf("writeBody(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRouterWrite(t *testing.T) {
+	r, sender := newTestRouter(t)
+	ctx := context.Background()
+	dir := r.getSession("chat1").WorkDir
+
+	r.Route(ctx, "chat1", "user1", "/write conf/app.yaml\n```yaml\nport: 8080\n```")
+	data, _ := os.ReadFile(filepath.Join(dir, "conf", "app.yaml"))
+	if string(data) != "port: 8080\n" {
+		t.Fatalf("unexpected file content %q", data)
+	}
+	if msg := sender.LastMessage(); !strings.HasPrefix(msg, "✓ 已创建 conf/app.yaml") || !strings.Contains(msg, "11 字节") {
+		t.Fatalf("unexpected confirmation %q", msg)
+	}
+
+	r.Route(ctx, "chat1", "user1", "/append conf/app.yaml\nhost: localhost")
+	data, _ = os.ReadFile(filepath.Join(dir, "conf", "app.yaml"))
+	if string(data) != "port: 8080\nhost: localhost\n" || !strings.HasPrefix(sender.LastMessage(), "✓ 已追加到") {
+		t.Fatalf("unexpected append %q %q", data, sender.LastMessage())
+	}
+}
+
+func TestRouterWrite_NextMessage(t *testing.T) {
+	r, sender := newTestRouter(t)
+	ctx := context.Background()
+	dir := r.getSession("chat1").WorkDir
+
+	r.Route(ctx, "chat1", "user1", "/write NOTES.md")
+	if !strings.Contains(sender.LastMessage(), "请发送要写入 NOTES.md 的内容") {
+		t.Fatalf("expected a request for content, got %q", sender.LastMessage())
+	}
+	r.Route(ctx, "chat1", "user1", "# Notes\nremember the migration")
+	data, _ := os.ReadFile(filepath.Join(dir, "NOTES.md"))
+	if string(data) != "# Notes\nremember the migration\n" {
+		t.Fatalf("unexpected file content %q", data)
+	}
+	if r.getSession("chat1").LastPrompt != "" {
+		t.Fatal("the content must not be sent to Claude")
+	}
+
+	r.Route(ctx, "chat1", "user1", "/append NOTES.md")
+	r.Route(ctx, "chat1", "user1", "/append cancel")
+	if !strings.Contains(sender.LastMessage(), "已取消") {
+		t.Fatalf("unexpected reply %q", sender.LastMessage())
+	}
+}
+
+func TestRouterWrite_Rejects(t *testing.T) {
+	r, sender := newTestRouter(t)
+	ctx := context.Background()
+	root := r.store.WorkRoot()
+	outside := t.TempDir()
+	os.Symlink(outside, filepath.Join(root, "link"))
+
+	for _, cmd := range []string{"/write ../escape.txt\nx", "/write /etc/passwd\nx", "/write .git/config\nx", "/write link/evil.txt\nx", "/write project1\nx", "/write .devbot.yaml\nx", "/write .claude/settings.json\nx", "/write sub/.mcp.json\nx"} {
+		r.Route(ctx, "chat1", "user1", cmd)
+		if !strings.HasPrefix(sender.LastMessage(), "无法写入") {
+			t.Errorf("%q: expected a rejection, got %q", cmd, sender.LastMessage())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, "evil.txt")); err == nil {
+		t.Fatal("wrote through a symlink out of the root")
+	}
+}
+
+func TestRouterWrite_PendingIsPerUserAndRechecked(t *testing.T) {
+	r, sender := newTestRouter(t)
+	r.allowedUsers["user2"] = true
+	ctx := context.Background()
+	root := r.store.WorkRoot()
+
+	r.Route(ctx, "chat1", "user1", "/write NOTES.md")
+	r.Route(ctx, "chat1", "user2", "not the content")
+	if _, err := os.Stat(filepath.Join(root, "NOTES.md")); err == nil {
+		t.Fatal("another user's message was written")
+	}
+	r.Route(ctx, "chat1", "user1", "the content")
+	if data, _ := os.ReadFile(filepath.Join(root, "NOTES.md")); string(data) != "the content\n" {
+		t.Fatalf("unexpected file %q", data)
+	}
+
+	// A symlink out of the root created while waiting is caught.
+	outside := t.TempDir()
+	r.Route(ctx, "chat1", "user1", "/write later/evil.txt")
+	os.Symlink(outside, filepath.Join(root, "later"))
+	r.Route(ctx, "chat1", "user1", "x")
+	if !strings.HasPrefix(sender.LastMessage(), "无法写入") {
+		t.Fatalf("expected a rejection, got %q", sender.LastMessage())
+	}
+	if _, err := os.Stat(filepath.Join(outside, "evil.txt")); err == nil {
+		t.Fatal("wrote through a symlink out of the root")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
@@ -20,7 +21,7 @@ func main() {
 	configPath := flag.String("c", "", "配置文件路径")
 	showVersion := flag.Bool("v", false, "显示版本信息")
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: devbot [flags]\n\nFlags:\n")
+		fmt.Fprintf(os.Stderr, "Usage: devbot [flags]\n       devbot [-c 配置文件] state [-f 状态文件] show|repair|prune\n       devbot [-c 配置文件] restore [备份]\n\nFlags:\n")
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\n配置优先级: 命令行参数 > 配置文件 (-c) > 环境变量\n")
 	}
@@ -30,65 +31,232 @@ func main() {
 		fmt.Println(version.String())
 		return
 	}
+	switch flag.Arg(0) {
+	case bot.DeleteHookCommand:
+		// Run by Claude as a PreToolUse hook; see bot.RunDeleteHook.
+		os.Exit(bot.RunDeleteHook(os.Stdin, os.Stdout, os.Stderr))
+	case "state":
+		runState(*configPath, flag.Args()[1:])
+		return
+	case "restore":
+		cfg, err := bot.LoadConfigFrom(*configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := bot.RestoreState(cfg.StateFile, cfg.BackupDir, flag.Arg(1), os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	cfg, err := bot.LoadConfigFrom(*configPath)
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	client := lark.NewClient(cfg.AppID, cfg.AppSecret)
-	sender := bot.NewLarkSender(client)
-
-	store, err := bot.NewStore(cfg.StateFile)
-	if err != nil {
+	if err := bot.SetupLogging(os.Stderr, cfg.LogLevel, cfg.LogFormat); err != nil {
 		log.Fatal(err)
 	}
 
-	executor := bot.NewClaudeExecutor(
+	local := bot.NewClaudeExecutor(
 		cfg.ClaudePath,
 		cfg.ClaudeModel,
 		time.Duration(cfg.ClaudeTimeout)*time.Second,
 	)
+	if cfg.ExecutorListen != "" {
+		serveExecutor(cfg, local)
+		return
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	var executor bot.Executor = local
+	switch {
+	case len(cfg.Executors) > 0:
+		pool := bot.NewExecutorPool(cfg.ClaudeModel)
+		for _, b := range cfg.Executors {
+			if b.Addr == "local" {
+				pool.Add(b.Name, local, b.Roots)
+				continue
+			}
+			remote, err := bot.NewRemoteExecutor(b.Addr, cfg.ExecutorToken, cfg.ClaudeModel, cfg.ExecutorTLS)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer remote.Close()
+			pool.Add(b.Name, remote, b.Roots)
+		}
+		go pool.Run(ctx, 30*time.Second)
+		executor = pool
+		slog.Info("using executor pool", "backends", len(cfg.Executors))
+	case cfg.ExecutorAddr != "":
+		remote, err := bot.NewRemoteExecutor(cfg.ExecutorAddr, cfg.ExecutorToken, cfg.ClaudeModel, cfg.ExecutorTLS)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer remote.Close()
+		executor = remote
+		slog.Info("using remote executor", "addr", cfg.ExecutorAddr)
+	}
+
+	client := lark.NewClient(cfg.AppID, cfg.AppSecret)
+	sender := bot.NewLarkSender(client)
+	sender.SetDriveFolder(cfg.DriveFolder)
+
+	store, err := bot.NewStore(cfg.StateFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	docSyncer := bot.NewDocSyncer(client)
 	router := bot.NewRouter(ctx, executor, store, sender, cfg.AllowedUserIDs, cfg.WorkRoot, docSyncer)
 	queue := bot.NewMessageQueue()
+	queue.SetLimits(cfg.QueueWorkers, cfg.QueueChatLimit, cfg.QueueChatLimits)
 	router.SetQueue(queue)
+	router.SetKnowledgeCache(bot.NewKnowledgeCache(cfg.CacheFile))
+	watcher := bot.NewWatcher(router, time.Duration(cfg.WatchInterval)*time.Second)
+	router.SetWatcher(watcher)
+	watcher.Start(ctx)
+	router.SetHookURL(cfg.HookURL)
+	router.SetGuestURL(cfg.PublicURL)
+	router.SetLicensePolicy(cfg.LicenseDeny, cfg.LicenseBlockPR)
+	router.SetBuildConfig(cfg.BuildTargets, cfg.ArtifactDir)
+	router.SetDockerRegistry(cfg.DockerRegistry, cfg.DockerUsername)
+	secrets, err := bot.LoadSecrets(cfg.SecretsFile)
+	if err != nil {
+		log.Fatalf("load secrets: %v", err)
+	}
+	router.SetSecrets(secrets)
+	router.SetTailServices(cfg.TailServices)
+	router.SetReferenceDirs(cfg.ReferenceDirs)
+	router.SetFeedbackButtons(cfg.FeedbackButtons)
+	router.SetPromptTemplates(cfg.PromptTemplates)
+	router.SetAdmins(cfg.AdminUserIDs)
+	router.SetReadOnlyUsers(cfg.ReadOnlyUserIDs)
+	router.SetDBConnections(cfg.DBConnections, cfg.DBMaxRows)
+	router.SetCurlConfig(cfg.CurlHosts, time.Duration(cfg.CurlTimeout)*time.Second, cfg.CurlMaxBody)
+	router.SetScratchRoot(cfg.ScratchDir)
+	router.SetTrashRetention(time.Duration(cfg.TrashRetentionDays) * 24 * time.Hour)
+	router.SetSessionSummaryModel(cfg.SessionSummaryModel)
+	router.SetCostConfirmTokens(cfg.CostConfirmTokens)
+	router.SetShareConfig(cfg.ShareProvider, cfg.ShareURL, time.Duration(cfg.ShareExpiryHours)*time.Hour)
+	router.SetIssueConfig(cfg.IssueAfterFailures, time.Duration(cfg.IssueWindowMinutes)*time.Minute, cfg.IssueMode == "auto")
+	router.StartShareExpiry(ctx)
+	router.SetReportFolder(cfg.ReportFolder)
+	router.SetBackupConfig(cfg.BackupDir, time.Duration(cfg.BackupIntervalHours)*time.Hour, cfg.BackupKeep, cfg.BackupS3URL, cfg.BackupS3Region)
+	router.StartBackups(ctx)
+	if cfg.CalendarID != "" {
+		router.SetCalendar(bot.NewLarkCalendar(client), cfg.CalendarID)
+	}
+	router.StartReminders(ctx)
+	router.SetApprovalRules(cfg.ApprovalRules)
+	router.SetCleanRules(cfg.CleanRules)
+	router.SetFormatting(cfg.FormatAfterExec, cfg.Formatters)
+	router.SetOutputProcessors(cfg.OutputProcessors, cfg.ChatOutputProcessors)
+	router.SetRepoBrowserURL(cfg.RepoBrowserURL)
+	router.SetTranslateLanguage(cfg.TranslateTo)
+	router.SetTestShards(cfg.TestShards)
+	router.SetCacheWarming(time.Duration(cfg.CacheWarmIntervalMinutes)*time.Minute, cfg.CacheWarmRepos)
+	router.StartCacheWarming(ctx)
+	router.SetMaxPromptChars(cfg.MaxPromptChars)
+	router.SetRepoSync(cfg.DefaultBranch, cfg.RepoSync, time.Duration(cfg.RepoSyncIdleMinutes)*time.Minute)
+	router.SetJSONRetries(cfg.JSONRetries)
+	if cfg.JSONSchema != "" {
+		schema, err := os.ReadFile(cfg.JSONSchema)
+		if err != nil {
+			log.Fatalf("read json schema: %v", err)
+		}
+		if err := router.SetJSONSchema(string(schema)); err != nil {
+			log.Fatal(err)
+		}
+	}
 	downloader := bot.NewLarkDownloader(client)
 	handler := bot.NewHandler(router, downloader, sender, cfg.SkipBotSelf, cfg.BotOpenID, cfg.AllowedUserIDs)
 
+	if cfg.WebAddr != "" {
+		web := bot.NewWebServer(router, cfg.WebToken)
+		if cfg.APIToken != "" {
+			web.EnableAPI(cfg.APIToken)
+		}
+		go func() {
+			if err := web.ListenAndServe(ctx, cfg.WebAddr); err != nil {
+				slog.Warn("web server stopped", "err", err)
+			}
+		}()
+	}
+
 	// Signal handler only cancels the context
 	go func() {
 		sigCh := make(chan os.Signal, 1)
 		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 		sig := <-sigCh
-		log.Printf("Received %s, shutting down...", sig)
+		slog.Info("shutting down", "signal", sig.String())
 		cancel()
 	}()
 
-	log.Printf("Starting devbot (%s)...", version.Version)
+	router.ResumeQueue(ctx)
+	slog.Info("starting devbot", "version", version.Version)
 	if err := bot.Run(ctx, cfg, handler, nil); err != nil {
 		// Only fatal if not caused by context cancellation
 		if ctx.Err() == nil {
 			log.Fatal(err)
 		}
-		log.Printf("bot.Run stopped: %v", err)
+		slog.Info("bot.Run stopped", "err", err)
 	}
 
-	// Cleanup runs after bot.Run returns, so main() won't exit prematurely
+	// Cleanup runs after bot.Run returns, so main() won't exit prematurely.
+	// Waiting tasks are saved for the next start instead of being run.
+	if n := router.SuspendQueue(); n > 0 {
+		slog.Info("saved queued tasks for the next start", "tasks", n)
+	}
 	if executor.IsRunning() {
-		log.Println("Waiting for current execution to finish...")
+		slog.Info("waiting for current execution to finish")
 		if executor.WaitIdle(30 * time.Second) {
-			log.Println("Execution finished.")
+			slog.Info("execution finished")
 		} else {
-			log.Println("Timed out waiting, forcing shutdown.")
+			slog.Warn("timed out waiting, forcing shutdown")
 			executor.Kill()
 		}
 	}
 
 	queue.Shutdown()
-	log.Println("Shutdown complete.")
+	slog.Info("shutdown complete")
+}
+
+// serveExecutor runs this process as the execution backend: it serves the
+// executor gRPC service until SIGINT/SIGTERM.
+func serveExecutor(cfg bot.Config, executor *bot.ClaudeExecutor) {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	slog.Info("starting devbot executor", "version", version.Version)
+	srv, err := bot.NewExecutorServer(executor, cfg.ExecutorToken, cfg.ExecutorTLS)
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv.SetTrashRetention(time.Duration(cfg.TrashRetentionDays) * 24 * time.Hour)
+	if err := srv.ListenAndServe(ctx, cfg.ExecutorListen); err != nil {
+		log.Fatal(err)
+	}
+	slog.Info("shutdown complete")
+}
+
+// runState inspects and repairs the state file offline: devbot state
+// [-f file] show|repair|prune. The file defaults to the configured one.
+func runState(configPath string, args []string) {
+	fs := flag.NewFlagSet("state", flag.ExitOnError)
+	stateFile := fs.String("f", "", "状态文件路径（默认使用配置中的 state_file）")
+	fs.Parse(args)
+	if *stateFile == "" {
+		cfg, err := bot.LoadConfigFrom(configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		*stateFile = cfg.StateFile
+	}
+	if err := bot.RunStateCommand(*stateFile, fs.Args(), os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }